@@ -23,6 +23,9 @@ func newAdminCmd() *cobra.Command {
 		newAdminInitCmd(),
 		newAdminUserCmd(),
 		newAdminNamespaceCmd(),
+		newAdminLFSCmd(),
+		newAdminBackupCmd(),
+		newAdminRestoreCmd(),
 	)
 
 	return cmd
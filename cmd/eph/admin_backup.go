@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bantamhq/ephemeral/internal/server"
+)
+
+func newAdminBackupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup <file>",
+		Short: "Back up the data directory to an archive",
+		Long: `Writes the database, every repository and locally stored LFS objects and
+release assets to a gzipped tar archive with a checksummed manifest. Safe to
+run while the server is running: the database is copied with SQLite's online
+backup API and each repository is saved as a git bundle. Objects in S3
+storage are not included.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runAdminBackup,
+	}
+}
+
+func newAdminRestoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Restore the data directory from a backup archive",
+		Long: `Verifies a backup archive against its manifest and rebuilds the data
+directory from it. Stop the server first. Restoring over an existing data
+directory requires --force, and moves the existing directory aside instead of
+deleting it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runAdminRestore,
+	}
+
+	cmd.Flags().Bool("force", false, "Replace an existing data directory")
+
+	return cmd
+}
+
+func runAdminBackup(cmd *cobra.Command, args []string) error {
+	ctx, err := loadAdminContext()
+	if err != nil {
+		return err
+	}
+	defer ctx.Close()
+
+	dest := args[0]
+	out, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("create backup file: %w", err)
+	}
+	defer os.Remove(out.Name())
+
+	manifest, err := server.CreateBackup(context.Background(), ctx.store, ctx.dataDir, out)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("create backup: %w", err)
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("write backup file: %w", err)
+	}
+	if err := os.Rename(out.Name(), dest); err != nil {
+		return fmt.Errorf("write backup file: %w", err)
+	}
+
+	fmt.Printf("Backed up %d repositories and %d files (%d bytes) to %s\n",
+		len(manifest.Repos), len(manifest.Files), manifest.TotalSize(), dest)
+
+	return nil
+}
+
+func runAdminRestore(cmd *cobra.Command, args []string) error {
+	force, _ := cmd.Flags().GetBool("force")
+
+	cfg, _, err := loadConfig("server.toml")
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	in, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("open backup file: %w", err)
+	}
+	defer in.Close()
+
+	report, err := server.RestoreBackup(context.Background(), in, cfg.Storage.DataDir, server.RestoreOptions{Replace: force})
+	if err != nil {
+		return fmt.Errorf("restore backup: %w", err)
+	}
+
+	fmt.Printf("Restored %d repositories from backup created %s\n",
+		len(report.Manifest.Repos), report.Manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	if report.PreviousDataDir != "" {
+		fmt.Printf("Previous data directory moved to %s\n", report.PreviousDataDir)
+	}
+
+	return nil
+}
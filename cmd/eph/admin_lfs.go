@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bantamhq/ephemeral/internal/lfs"
+	"github.com/bantamhq/ephemeral/internal/server"
+)
+
+func newAdminLFSCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lfs",
+		Short: "Manage LFS storage",
+	}
+
+	cmd.AddCommand(newAdminLFSGCCmd())
+
+	return cmd
+}
+
+func newAdminLFSGCCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Delete LFS objects no longer referenced by any commit",
+		Long: `Scans every repository's history for LFS pointer files and deletes stored
+objects that are not referenced, including objects left behind by deleted
+repositories. Objects newer than --min-age are kept, since git-lfs uploads
+objects before the commits that reference them are pushed.`,
+		RunE: runAdminLFSGC,
+	}
+
+	cmd.Flags().Bool("dry-run", false, "Report what would be deleted without deleting anything")
+	cmd.Flags().Duration("min-age", server.DefaultLFSGCMinAge, "Keep objects newer than this")
+
+	return cmd
+}
+
+func runAdminLFSGC(cmd *cobra.Command, args []string) error {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	minAge, _ := cmd.Flags().GetDuration("min-age")
+
+	ctx, err := loadAdminContext()
+	if err != nil {
+		return err
+	}
+	defer ctx.Close()
+
+	storage, err := adminLFSStorage(ctx.dataDir)
+	if err != nil {
+		return err
+	}
+
+	report, err := server.CollectLFSGarbage(context.Background(), ctx.store, storage, ctx.dataDir, server.LFSGCOptions{
+		DryRun: dryRun,
+		MinAge: minAge,
+	})
+	if err != nil {
+		return fmt.Errorf("collect lfs garbage: %w", err)
+	}
+
+	for _, obj := range report.Objects {
+		fmt.Printf("%s  %s  %10d  %s\n", obj.RepoID, obj.OID, obj.Size, obj.Reason)
+	}
+
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+	fmt.Printf("%s %d objects (%d bytes) after scanning %d repositories\n",
+		verb, len(report.Objects), report.Bytes, report.ReposScanned)
+
+	return nil
+}
+
+// adminLFSStorage returns the configured LFS storage, defaulting to local
+// storage in the data directory.
+func adminLFSStorage(dataDir string) (lfs.Storage, error) {
+	cfg, _, err := loadConfig("server.toml")
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+
+	storage, err := newLFSStorage(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("configure lfs storage: %w", err)
+	}
+	if storage == nil {
+		storage = lfs.NewLocalStorage(filepath.Join(dataDir, "lfs"))
+	}
+
+	return storage, nil
+}
@@ -22,6 +22,8 @@ func newAdminNamespaceCmd() *cobra.Command {
 		newAdminNamespaceDeleteCmd(),
 		newAdminNamespaceGrantCmd(),
 		newAdminNamespaceRevokeCmd(),
+		newAdminNamespaceExportCmd(),
+		newAdminNamespaceImportCmd(),
 	)
 
 	return cmd
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bantamhq/ephemeral/internal/server"
+)
+
+func newAdminNamespaceExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <name>",
+		Short: "Export a namespace to an archive",
+		Long: `Writes a namespace's settings, folders, repositories, grants, git data and
+LFS objects to an archive that 'eph admin namespace import' can load on
+another server. Grants refer to users by username.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runAdminNamespaceExport,
+	}
+
+	cmd.Flags().StringP("output", "o", "", "Archive path (default <name>.tar.gz)")
+
+	return cmd
+}
+
+func newAdminNamespaceImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import a namespace from an archive",
+		Long: `Recreates the namespace in an archive written by 'eph admin namespace export',
+assigning new IDs. If the namespace already exists the repositories are added
+to it, as long as none of their names are taken. Grants for users that do not
+exist on this server are skipped.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runAdminNamespaceImport,
+	}
+
+	cmd.Flags().String("name", "", "Import into a namespace with a different name")
+
+	return cmd
+}
+
+func runAdminNamespaceExport(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	dest, _ := cmd.Flags().GetString("output")
+	if dest == "" {
+		dest = name + ".tar.gz"
+	}
+
+	ctx, err := loadAdminContext()
+	if err != nil {
+		return err
+	}
+	defer ctx.Close()
+
+	storage, err := adminLFSStorage(ctx.dataDir)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("create archive: %w", err)
+	}
+	defer os.Remove(out.Name())
+
+	export, err := server.ExportNamespace(context.Background(), ctx.store, storage, ctx.dataDir, name, out)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("export namespace: %w", err)
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("write archive: %w", err)
+	}
+	if err := os.Rename(out.Name(), dest); err != nil {
+		return fmt.Errorf("write archive: %w", err)
+	}
+
+	fmt.Printf("Exported namespace %q with %d repositories to %s\n", name, len(export.Repos), dest)
+
+	return nil
+}
+
+func runAdminNamespaceImport(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("name")
+
+	ctx, err := loadAdminContext()
+	if err != nil {
+		return err
+	}
+	defer ctx.Close()
+
+	storage, err := adminLFSStorage(ctx.dataDir)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer in.Close()
+
+	report, err := server.ImportNamespace(context.Background(), ctx.store, storage, ctx.dataDir, in, server.NamespaceImportOptions{Name: name})
+	if err != nil {
+		var conflict *server.ImportConflictError
+		if errors.As(err, &conflict) {
+			return fmt.Errorf("%w (use --name to import into another namespace)", err)
+		}
+		return fmt.Errorf("import namespace: %w", err)
+	}
+
+	target := "existing"
+	if report.Created {
+		target = "new"
+	}
+	fmt.Printf("Imported %d repositories into %s namespace %q\n", report.Repos, target, report.Namespace.Name)
+	for _, skipped := range report.SkippedGrants {
+		fmt.Printf("Skipped grant for unknown user %s\n", skipped)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -53,12 +54,28 @@ func newAdminUserDeleteCmd() *cobra.Command {
 }
 
 func newAdminUserTokenCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "token <username>",
 		Short: "Generate a new token for a user",
-		Args:  cobra.ExactArgs(1),
-		RunE:  runAdminUserToken,
+		Long: `Generate a new token for a user.
+
+By default the token has all of the user's permissions. --scope, --repo and
+--namespace limit it to part of the user's access: the token can do at most
+what --scope allows, and only on the listed repos and namespaces.
+
+Examples:
+  eph admin user token alice
+  eph admin user token alice --scope repo:read --repo alice/website
+  eph admin user token alice --scope repo:write --namespace ci`,
+		Args: cobra.ExactArgs(1),
+		RunE: runAdminUserToken,
 	}
+
+	cmd.Flags().StringSlice("scope", nil, "permissions the token is limited to, such as repo:read")
+	cmd.Flags().StringSlice("repo", nil, "limit the token to a repo, as namespace/name")
+	cmd.Flags().StringSlice("namespace", nil, "limit the token to the repos in a namespace")
+
+	return cmd
 }
 
 func runAdminUserAdd(cmd *cobra.Command, args []string) error {
@@ -114,7 +131,7 @@ func runAdminUserAdd(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("create grant: %w", err)
 	}
 
-	token, _, err := ctx.store.GenerateUserToken(user.ID, nil)
+	token, _, err := ctx.store.GenerateUserToken(user.ID, nil, nil, nil)
 	if err != nil {
 		return fmt.Errorf("generate token: %w", err)
 	}
@@ -239,7 +256,12 @@ func runAdminUserToken(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("user %q not found", username)
 	}
 
-	token, _, err := ctx.store.GenerateUserToken(user.ID, nil)
+	scope, err := parseTokenScopeFlags(cmd, ctx.store)
+	if err != nil {
+		return err
+	}
+
+	token, _, err := ctx.store.GenerateUserToken(user.ID, nil, nil, scope)
 	if err != nil {
 		return fmt.Errorf("generate token: %w", err)
 	}
@@ -248,3 +270,55 @@ func runAdminUserToken(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// parseTokenScopeFlags builds a token scope from the --scope, --repo and
+// --namespace flags. It returns nil when none are set.
+func parseTokenScopeFlags(cmd *cobra.Command, st store.Store) (*store.TokenScope, error) {
+	perms, _ := cmd.Flags().GetStringSlice("scope")
+	repos, _ := cmd.Flags().GetStringSlice("repo")
+	namespaces, _ := cmd.Flags().GetStringSlice("namespace")
+	if len(perms) == 0 && len(repos) == 0 && len(namespaces) == 0 {
+		return nil, nil
+	}
+
+	allow, err := store.ParsePermissions(perms)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scope: %w", err)
+	}
+	scope := &store.TokenScope{Allow: allow}
+
+	for _, arg := range repos {
+		nsName, repoName, ok := strings.Cut(arg, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid repo %q: use namespace/name", arg)
+		}
+		ns, err := st.GetNamespaceByName(nsName)
+		if err != nil {
+			return nil, fmt.Errorf("get namespace: %w", err)
+		}
+		if ns == nil {
+			return nil, fmt.Errorf("namespace %q not found", nsName)
+		}
+		repo, err := st.GetRepo(ns.ID, repoName)
+		if err != nil {
+			return nil, fmt.Errorf("get repo: %w", err)
+		}
+		if repo == nil {
+			return nil, fmt.Errorf("repo %q not found", arg)
+		}
+		scope.RepoIDs = append(scope.RepoIDs, repo.ID)
+	}
+
+	for _, name := range namespaces {
+		ns, err := st.GetNamespaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("get namespace: %w", err)
+		}
+		if ns == nil {
+			return nil, fmt.Errorf("namespace %q not found", name)
+		}
+		scope.NamespaceIDs = append(scope.NamespaceIDs, ns.ID)
+	}
+
+	return scope, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newAuthCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Approve logins from other machines",
+		Long: `Approve logins from other machines.
+
+Running 'eph login --device' on a machine without a browser shows a short
+code. Approving it here logs that machine in with a new token for your user,
+so no token has to be copied between machines.
+
+Examples:
+  eph auth approve BCDF-GHJK`,
+	}
+
+	cmd.AddCommand(newAuthApproveCmd())
+
+	return cmd
+}
+
+func newAuthApproveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "approve <code>",
+		Short: "Approve a device login",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runAuthApprove,
+	}
+}
+
+func runAuthApprove(cmd *cobra.Command, args []string) error {
+	c, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	if err := c.ApproveDeviceLogin(context.Background(), args[0]); err != nil {
+		return formatAPIError("approve login", err)
+	}
+
+	fmt.Printf("%s Approved login %s\n", styleCheckmark, args[0])
+	return nil
+}
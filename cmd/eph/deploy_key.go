@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bantamhq/ephemeral/internal/client"
+)
+
+func newDeployKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deploy-key",
+		Short: "Manage repo deploy keys",
+		Long: `Manage deploy keys, credentials that reach a single repo and belong to no
+user. Use them on deployment servers and CI. Managing them requires repo:admin.
+
+A deploy key is a token for git over HTTP, or an SSH public key when
+--public-key is given. Keys are read-only unless --write is set.
+
+Examples:
+  eph deploy-key add website production --public-key deploy.pub
+  eph deploy-key add website ci --write
+  eph deploy-key list website
+  eph deploy-key remove website ci`,
+	}
+
+	cmd.AddCommand(
+		newDeployKeyAddCmd(),
+		newDeployKeyListCmd(),
+		newDeployKeyRemoveCmd(),
+	)
+
+	return cmd
+}
+
+func newDeployKeyAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add <repo> <name>",
+		Short: "Add a deploy key to a repo",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runDeployKeyAdd,
+	}
+
+	cmd.Flags().String("public-key", "", "SSH public key file (default creates a token)")
+	cmd.Flags().Bool("write", false, "allow pushes as well as clones and fetches")
+
+	return cmd
+}
+
+func newDeployKeyListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list <repo>",
+		Short: "List a repo's deploy keys",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runDeployKeyList,
+	}
+}
+
+func newDeployKeyRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <repo> <id-or-name>",
+		Short: "Remove a deploy key",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runDeployKeyRemove,
+	}
+}
+
+func runDeployKeyAdd(cmd *cobra.Command, args []string) error {
+	c, repo, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	write, _ := cmd.Flags().GetBool("write")
+	opts := client.CreateDeployKeyOptions{Name: args[1], ReadOnly: !write}
+
+	if path, _ := cmd.Flags().GetString("public-key"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read public key: %w", err)
+		}
+		opts.PublicKey = strings.TrimSpace(string(data))
+	}
+
+	rawToken, key, err := c.CreateDeployKey(context.Background(), repo.ID, opts)
+	if err != nil {
+		return formatAPIError("add deploy key", err)
+	}
+
+	fmt.Printf("%s Added %s deploy key %s (%s)\n", styleCheckmark, deployKeyMode(*key), key.Name, key.ID[:8])
+	if rawToken != "" {
+		fmt.Println()
+		fmt.Println(rawToken)
+		fmt.Println()
+		fmt.Println("Copy the token now; it won't be shown again. Use it as the password for")
+		fmt.Println("git over HTTP with the username x-token.")
+	}
+	return nil
+}
+
+func runDeployKeyList(cmd *cobra.Command, args []string) error {
+	c, repo, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	keys, err := c.ListDeployKeys(context.Background(), repo.ID)
+	if err != nil {
+		return formatAPIError("list deploy keys", err)
+	}
+
+	if len(keys) == 0 {
+		fmt.Println("No deploy keys.")
+		return nil
+	}
+
+	for _, key := range keys {
+		kind := "token"
+		if key.Fingerprint != nil {
+			kind = *key.Fingerprint
+		}
+
+		lastUsed := "never used"
+		if key.LastUsedAt != nil {
+			lastUsed = "last used " + key.LastUsedAt.Format("2006-01-02")
+		}
+
+		fmt.Printf("%s  %-20s  %-10s  %s (%s)\n", key.ID[:8], key.Name, deployKeyMode(key), kind, lastUsed)
+	}
+
+	return nil
+}
+
+func deployKeyMode(key client.DeployKey) string {
+	if key.ReadOnly {
+		return "read-only"
+	}
+	return "read-write"
+}
+
+func runDeployKeyRemove(cmd *cobra.Command, args []string) error {
+	c, repo, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	target := args[1]
+
+	keys, err := c.ListDeployKeys(context.Background(), repo.ID)
+	if err != nil {
+		return formatAPIError("list deploy keys", err)
+	}
+
+	var matched []client.DeployKey
+	for _, key := range keys {
+		if key.ID == target || strings.HasPrefix(key.ID, target) || key.Name == target {
+			matched = append(matched, key)
+		}
+	}
+
+	switch len(matched) {
+	case 0:
+		return fmt.Errorf("no deploy key matching %q", target)
+	case 1:
+	default:
+		return fmt.Errorf("%q matches %d deploy keys, use a longer ID", target, len(matched))
+	}
+
+	if err := c.DeleteDeployKey(context.Background(), repo.ID, matched[0].ID); err != nil {
+		return formatAPIError("remove deploy key", err)
+	}
+
+	fmt.Printf("%s Removed deploy key %s\n", styleCheckmark, matched[0].Name)
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net/url"
@@ -12,6 +13,9 @@ import (
 	"github.com/charmbracelet/huh/spinner"
 	"github.com/charmbracelet/lipgloss"
 	"golang.org/x/term"
+
+	"github.com/bantamhq/ephemeral/internal/client"
+	"github.com/bantamhq/ephemeral/internal/config"
 )
 
 // parseCredentialInput parses git credential protocol input (key=value pairs terminated by empty line).
@@ -162,3 +166,52 @@ func runSpinner(spinnerTitle, completedTitle string, action func() error) error
 	}
 	return actionErr
 }
+
+// loadClient returns a client for the logged in server.
+func loadClient() (*client.Client, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, errNotLoggedIn
+	}
+
+	if !cfg.IsConfigured() {
+		return nil, errNotLoggedIn
+	}
+
+	return client.New(cfg.Server, cfg.Token), nil
+}
+
+// loadRepo resolves a repo argument to the repo it names.
+func loadRepo(arg string) (*client.Client, *client.Repo, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, nil, errNotLoggedIn
+	}
+
+	if !cfg.IsConfigured() {
+		return nil, nil, errNotLoggedIn
+	}
+
+	namespace, name := parseRepoArg(arg, cfg.DefaultNamespace)
+	c := client.New(cfg.Server, cfg.Token)
+	nsClient := c.WithNamespace(namespace)
+
+	cursor := ""
+	for {
+		repos, hasMore, err := nsClient.ListRepos(context.Background(), cursor, 100)
+		if err != nil {
+			return nil, nil, formatAPIError("list repos", err)
+		}
+		for _, repo := range repos {
+			if repo.Name == name {
+				return c, &repo, nil
+			}
+		}
+		if !hasMore || len(repos) == 0 {
+			break
+		}
+		cursor = repos[len(repos)-1].Name
+	}
+
+	return nil, nil, fmt.Errorf("repo %s/%s not found", namespace, name)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bantamhq/ephemeral/internal/server"
+)
+
+// newHookCmd is invoked by git from the hook scripts installed by the server.
+// It is not meant to be run by hand.
+func newHookCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "hook",
+		Short:  "Run server-side git hooks",
+		Hidden: true,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "pre-receive",
+		Short: "Enforce push policy before refs are updated",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return server.RunPreReceiveHook(context.Background(), os.Stdin, os.Stderr)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "post-receive",
+		Short: "Report the ref updates of a push to the server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return server.RunPostReceiveHook(os.Stdin)
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+
+	"github.com/bantamhq/ephemeral/internal/client"
+)
+
+func newKeysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage SSH keys for git over SSH",
+	}
+
+	cmd.AddCommand(
+		newKeysAddCmd(),
+		newKeysListCmd(),
+		newKeysRemoveCmd(),
+	)
+
+	return cmd
+}
+
+func newKeysAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add [public-key-file]",
+		Short: "Register an SSH public key",
+		Long: `Register an SSH public key with the server.
+
+If no file is given, public keys in ~/.ssh/*.pub are offered for selection.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runKeysAdd,
+	}
+
+	cmd.Flags().String("name", "", "name for the key (defaults to the key comment)")
+
+	return cmd
+}
+
+func newKeysListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List registered SSH keys",
+		RunE:  runKeysList,
+	}
+}
+
+func newKeysRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <id-or-fingerprint>",
+		Short: "Remove a registered SSH key",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runKeysRemove,
+	}
+}
+
+func runKeysAdd(cmd *cobra.Command, args []string) error {
+	c, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		path, err = selectLocalPublicKey()
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read public key: %w", err)
+	}
+
+	var name *string
+	if n, _ := cmd.Flags().GetString("name"); n != "" {
+		name = &n
+	}
+
+	key, err := c.AddSSHKey(context.Background(), name, strings.TrimSpace(string(data)))
+	if err != nil {
+		return formatAPIError("add key", err)
+	}
+
+	fmt.Printf("%s Added %s key %s\n", styleCheckmark, key.KeyType, key.Fingerprint)
+	return nil
+}
+
+// selectLocalPublicKey finds public keys in ~/.ssh and prompts when there is more than one.
+func selectLocalPublicKey() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("get home directory: %w", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(home, ".ssh", "*.pub"))
+	if err != nil {
+		return "", fmt.Errorf("find public keys: %w", err)
+	}
+
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no public keys found in ~/.ssh - generate one with 'ssh-keygen -t ed25519'")
+	}
+
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+
+	options := make([]huh.Option[string], len(matches))
+	for i, m := range matches {
+		options[i] = huh.NewOption(filepath.Base(m), m)
+	}
+
+	var selected string
+
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Select public key").
+				Options(options...).
+				Value(&selected),
+		),
+	).WithTheme(huh.ThemeBase())
+
+	if err := form.Run(); err != nil {
+		return "", fmt.Errorf("select key: %w", err)
+	}
+
+	return selected, nil
+}
+
+func runKeysList(cmd *cobra.Command, args []string) error {
+	c, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	keys, err := c.ListSSHKeys(context.Background())
+	if err != nil {
+		return formatAPIError("list keys", err)
+	}
+
+	if len(keys) == 0 {
+		fmt.Println("No SSH keys registered. Add one with 'eph keys add'.")
+		return nil
+	}
+
+	for _, key := range keys {
+		name := "-"
+		if key.Name != nil {
+			name = *key.Name
+		}
+
+		lastUsed := "never used"
+		if key.LastUsedAt != nil {
+			lastUsed = "last used " + key.LastUsedAt.Format("2006-01-02")
+		}
+
+		fmt.Printf("%s  %s  %s  %s (%s)\n", key.ID[:8], key.Fingerprint, key.KeyType, name, lastUsed)
+	}
+
+	return nil
+}
+
+func runKeysRemove(cmd *cobra.Command, args []string) error {
+	c, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	target := args[0]
+
+	keys, err := c.ListSSHKeys(context.Background())
+	if err != nil {
+		return formatAPIError("list keys", err)
+	}
+
+	var matched []client.SSHKey
+	for _, key := range keys {
+		if key.Fingerprint == target || key.ID == target || strings.HasPrefix(key.ID, target) {
+			matched = append(matched, key)
+		}
+	}
+
+	switch len(matched) {
+	case 0:
+		return fmt.Errorf("no SSH key matching %q", target)
+	case 1:
+	default:
+		return fmt.Errorf("%q matches %d keys, use a longer ID or the fingerprint", target, len(matched))
+	}
+
+	if err := c.DeleteSSHKey(context.Background(), matched[0].ID); err != nil {
+		return formatAPIError("remove key", err)
+	}
+
+	fmt.Printf("%s Removed key %s\n", styleCheckmark, matched[0].Fingerprint)
+	return nil
+}
@@ -19,17 +19,28 @@ import (
 )
 
 func newLoginCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "login [server]",
 		Short: "Authenticate with an Ephemeral server",
 		Long: `Authenticate with an Ephemeral server and save the credentials.
 
-If no server is specified, defaults to http://localhost:8080.`,
+If no server is specified, defaults to http://localhost:8080.
+
+On machines without a browser, use --device: login shows a short code to
+approve with 'eph auth approve <code>' on a machine that is already logged
+in, or on the server's /auth/device page.`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: runLogin,
 	}
+
+	cmd.Flags().Bool("device", false, "log in by approving a code from another machine")
+
+	return cmd
 }
 
+// deviceLoginTimeout is how long a device login waits to be approved.
+const deviceLoginTimeout = 10 * time.Minute
+
 type authConfigResponse struct {
 	AuthMethod   string `json:"auth_method"`
 	ServerURL    string `json:"server_url,omitempty"`
@@ -37,7 +48,8 @@ type authConfigResponse struct {
 }
 
 type createSessionRequest struct {
-	ExpiresInSeconds int `json:"expires_in_seconds"`
+	ExpiresInSeconds int  `json:"expires_in_seconds"`
+	Device           bool `json:"device,omitempty"`
 }
 
 type authSessionResponse struct {
@@ -45,6 +57,7 @@ type authSessionResponse struct {
 		ID        string    `json:"id"`
 		Status    string    `json:"status"`
 		Token     string    `json:"token,omitempty"`
+		UserCode  string    `json:"user_code,omitempty"`
 		ExpiresAt time.Time `json:"expires_at"`
 	} `json:"data"`
 	Error *struct {
@@ -68,8 +81,10 @@ func runLogin(cmd *cobra.Command, args []string) error {
 		serverURL = "http://" + serverURL
 	}
 
+	device, _ := cmd.Flags().GetBool("device")
+
 	var authConfig *authConfigResponse
-	var sessionID string
+	var sessionID, userCode string
 	var targetServer string
 
 	err := runSpinner(
@@ -90,8 +105,13 @@ func runLogin(cmd *cobra.Command, args []string) error {
 				}
 			}
 
+			if device {
+				sessionID, userCode, fetchErr = createAuthSession(serverURL, true)
+				return fetchErr
+			}
+
 			if authConfig.AuthMethod == "web" && authConfig.AuthEndpoint != "" {
-				sessionID, fetchErr = createAuthSession(serverURL)
+				sessionID, _, fetchErr = createAuthSession(serverURL, false)
 				return fetchErr
 			}
 
@@ -102,9 +122,19 @@ func runLogin(cmd *cobra.Command, args []string) error {
 		if isConnectionError(err) {
 			return fmt.Errorf("could not connect to Ephemeral server at %s", serverURL)
 		}
+		if device {
+			return fmt.Errorf("start device login: %w", err)
+		}
 		return loginWithToken(serverURL)
 	}
 
+	if device {
+		if userCode == "" {
+			return fmt.Errorf("server does not support device login")
+		}
+		return loginWithDeviceAuth(serverURL, targetServer, sessionID, userCode)
+	}
+
 	if authConfig.AuthMethod == "web" && authConfig.AuthEndpoint != "" {
 		return loginWithWebAuth(serverURL, targetServer, authConfig.AuthEndpoint, sessionID)
 	}
@@ -170,14 +200,44 @@ func loginWithWebAuth(connectedServer, targetServer, authEndpoint, sessionID str
 	return completeLogin(targetServer, connectedServer, token)
 }
 
-func createAuthSession(serverURL string) (string, error) {
+func loginWithDeviceAuth(connectedServer, targetServer, sessionID, userCode string) error {
+	fmt.Println()
+	fmt.Printf("Your login code is %s\n", userCode)
+	fmt.Println()
+	fmt.Println("Approve it on a machine where you're logged in:")
+	fmt.Printf("  eph auth approve %s\n", userCode)
+	fmt.Println()
+	fmt.Println("or open this URL:")
+	fmt.Printf("  %s/auth/device?code=%s\n", connectedServer, userCode)
+	fmt.Println()
+
+	var token string
+	err := runSpinner("Waiting for approval...", "Approved", func() error {
+		var pollErr error
+		token, pollErr = pollForToken(connectedServer, sessionID, deviceLoginTimeout)
+		return pollErr
+	})
+	if err != nil {
+		return err
+	}
+
+	return completeLogin(targetServer, connectedServer, token)
+}
+
+// createAuthSession starts a login and returns the session ID. Device logins
+// also return the user code to approve.
+func createAuthSession(serverURL string, device bool) (string, string, error) {
 	reqBody := createSessionRequest{
 		ExpiresInSeconds: 300,
+		Device:           device,
+	}
+	if device {
+		reqBody.ExpiresInSeconds = int(deviceLoginTimeout.Seconds())
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return "", "", fmt.Errorf("marshal request: %w", err)
 	}
 
 	httpClient := &http.Client{Timeout: 30 * time.Second}
@@ -187,23 +247,23 @@ func createAuthSession(serverURL string) (string, error) {
 		bytes.NewReader(bodyBytes),
 	)
 	if err != nil {
-		return "", fmt.Errorf("create session request: %w", err)
+		return "", "", fmt.Errorf("create session request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var sessionResp authSessionResponse
 	if err := json.NewDecoder(resp.Body).Decode(&sessionResp); err != nil {
-		return "", fmt.Errorf("decode response: %w", err)
+		return "", "", fmt.Errorf("decode response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusCreated {
 		if sessionResp.Error != nil {
-			return "", fmt.Errorf("create session failed (%s): %s", sessionResp.Error.Code, sessionResp.Error.Message)
+			return "", "", fmt.Errorf("create session failed (%s): %s", sessionResp.Error.Code, sessionResp.Error.Message)
 		}
-		return "", fmt.Errorf("create session failed: status %d", resp.StatusCode)
+		return "", "", fmt.Errorf("create session failed: status %d", resp.StatusCode)
 	}
 
-	return sessionResp.Data.ID, nil
+	return sessionResp.Data.ID, sessionResp.Data.UserCode, nil
 }
 
 func pollForToken(serverURL, sessionID string, timeout time.Duration) (string, error) {
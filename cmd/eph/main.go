@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/spf13/cobra"
 
 	"github.com/bantamhq/ephemeral/internal/client"
 	"github.com/bantamhq/ephemeral/internal/config"
+	"github.com/bantamhq/ephemeral/internal/lfs"
 	"github.com/bantamhq/ephemeral/internal/server"
 	"github.com/bantamhq/ephemeral/internal/store"
 	"github.com/bantamhq/ephemeral/internal/tui"
@@ -17,8 +20,9 @@ import (
 
 type Config struct {
 	Server struct {
-		Port int    `toml:"port"`
-		Host string `toml:"host"`
+		Port    int    `toml:"port"`
+		Host    string `toml:"host"`
+		SSHPort int    `toml:"ssh_port"`
 	} `toml:"server"`
 	Storage struct {
 		DataDir string `toml:"data_dir"`
@@ -27,7 +31,47 @@ type Config struct {
 		Enabled     bool   `toml:"enabled"`
 		MaxFileSize int64  `toml:"max_file_size"`
 		BaseURL     string `toml:"base_url"`
+		GCInterval  string `toml:"gc_interval"`
+		Storage     struct {
+			StorageConfig
+			DirectTransfer bool `toml:"direct_transfer"`
+		} `toml:"storage"`
 	} `toml:"lfs"`
+	Releases struct {
+		MaxAssetSize int64         `toml:"max_asset_size"`
+		Storage      StorageConfig `toml:"storage"`
+	} `toml:"releases"`
+	Mirrors struct {
+		AllowLocal  bool `toml:"allow_local"`
+		Credentials map[string]struct {
+			Username    string   `toml:"username"`
+			Password    string   `toml:"password"`
+			URLPrefixes []string `toml:"url_prefixes"`
+		} `toml:"credentials"`
+	} `toml:"mirrors"`
+	Webhooks struct {
+		AllowLocal bool `toml:"allow_local"`
+	} `toml:"webhooks"`
+	OIDC struct {
+		Issuer       string   `toml:"issuer"`
+		ClientID     string   `toml:"client_id"`
+		ClientSecret string   `toml:"client_secret"`
+		Scopes       []string `toml:"scopes"`
+		BaseURL      string   `toml:"base_url"`
+	} `toml:"oidc"`
+}
+
+// StorageConfig selects where objects are stored: "local" (the default) or
+// "s3".
+type StorageConfig struct {
+	Type            string `toml:"type"`
+	Endpoint        string `toml:"endpoint"`
+	Region          string `toml:"region"`
+	Bucket          string `toml:"bucket"`
+	Prefix          string `toml:"prefix"`
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+	PathStyle       bool   `toml:"path_style"`
 }
 
 var version = "dev"
@@ -54,10 +98,17 @@ func main() {
 		newAdminCmd(),
 		newLoginCmd(),
 		newLogoutCmd(),
+		newAuthCmd(),
 		newCredentialCmd(),
 		newNamespacesCmd(),
 		newNewCmd(),
 		newCloneCmd(),
+		newKeysCmd(),
+		newDeployKeyCmd(),
+		newTokenCmd(),
+		newMRCmd(),
+		newReleaseCmd(),
+		newHookCmd(),
 	)
 
 	if err := rootCmd.Execute(); err != nil {
@@ -119,22 +170,158 @@ func runServe(cmd *cobra.Command, args []string) error {
 		lfsBaseURL = fmt.Sprintf("http://%s:%d", cfg.Server.Host, cfg.Server.Port)
 	}
 
+	lfsStorage, err := newLFSStorage(cfg)
+	if err != nil {
+		return fmt.Errorf("configure lfs storage: %w", err)
+	}
+
+	lfsGCInterval := 24 * time.Hour
+	if cfg.LFS.GCInterval != "" {
+		lfsGCInterval, err = time.ParseDuration(cfg.LFS.GCInterval)
+		if err != nil {
+			return fmt.Errorf("parse lfs gc_interval: %w", err)
+		}
+	}
+
 	lfsOpts := server.LFSOptions{
-		Enabled:     cfg.LFS.Enabled,
-		MaxFileSize: cfg.LFS.MaxFileSize,
-		BaseURL:     lfsBaseURL,
+		Enabled:        cfg.LFS.Enabled,
+		MaxFileSize:    cfg.LFS.MaxFileSize,
+		BaseURL:        lfsBaseURL,
+		Storage:        lfsStorage,
+		DirectTransfer: cfg.LFS.Storage.DirectTransfer,
+		GCInterval:     lfsGCInterval,
+	}
+
+	mirrorOpts := server.MirrorOptions{
+		AllowLocal:  cfg.Mirrors.AllowLocal,
+		Credentials: make(map[string]server.MirrorCredential, len(cfg.Mirrors.Credentials)),
+	}
+	for name, cred := range cfg.Mirrors.Credentials {
+		if len(cred.URLPrefixes) == 0 {
+			return fmt.Errorf("mirror credentials %q: url_prefixes is required", name)
+		}
+		mirrorOpts.Credentials[name] = server.MirrorCredential{
+			Username:    cred.Username,
+			Password:    cred.Password,
+			URLPrefixes: cred.URLPrefixes,
+		}
+	}
+
+	releaseStorage, err := newReleaseStorage(cfg)
+	if err != nil {
+		return fmt.Errorf("configure release storage: %w", err)
 	}
 
-	srv := server.NewServer(st, cfg.Storage.DataDir, lfsOpts)
+	releaseOpts := server.ReleaseOptions{
+		Storage:      releaseStorage,
+		MaxAssetSize: cfg.Releases.MaxAssetSize,
+	}
+
+	oidcBaseURL := cfg.OIDC.BaseURL
+	if oidcBaseURL == "" {
+		oidcBaseURL = fmt.Sprintf("http://%s:%d", cfg.Server.Host, cfg.Server.Port)
+	}
+
+	if cfg.OIDC.Issuer != "" && cfg.OIDC.ClientID == "" {
+		return fmt.Errorf("oidc client_id is required when issuer is set")
+	}
+	if cfg.OIDC.Issuer != "" && !strings.HasPrefix(cfg.OIDC.Issuer, "https://") {
+		return fmt.Errorf("oidc issuer must be an https URL")
+	}
+
+	oidcOpts := server.OIDCOptions{
+		Issuer:       cfg.OIDC.Issuer,
+		ClientID:     cfg.OIDC.ClientID,
+		ClientSecret: cfg.OIDC.ClientSecret,
+		Scopes:       cfg.OIDC.Scopes,
+		BaseURL:      oidcBaseURL,
+	}
+
+	webhookOpts := server.WebhookOptions{AllowLocal: cfg.Webhooks.AllowLocal}
+
+	srv := server.NewServer(st, cfg.Storage.DataDir, server.ServerOptions{
+		LFS:     lfsOpts,
+		Mirror:  mirrorOpts,
+		Release: releaseOpts,
+		OIDC:    oidcOpts,
+		Webhook: webhookOpts,
+	})
+
+	if cfg.Server.SSHPort > 0 {
+		sshSrv, err := server.NewSSHServer(srv)
+		if err != nil {
+			return fmt.Errorf("create ssh server: %w", err)
+		}
+
+		go func() {
+			if err := sshSrv.Start(cfg.Server.Host, cfg.Server.SSHPort); err != nil {
+				fmt.Fprintln(os.Stderr, "SSH server error:", err)
+			}
+		}()
+	}
 
 	fmt.Printf("Starting Ephemeral server on %s:%d\n", cfg.Server.Host, cfg.Server.Port)
 	fmt.Printf("Data directory: %s\n", cfg.Storage.DataDir)
 	fmt.Println("\nServer is ready to accept connections.")
 	fmt.Println("Example: git clone http://x-token:<token>@localhost:8080/git/<namespace>/myrepo.git")
+	if cfg.Server.SSHPort > 0 {
+		fmt.Printf("Example: git clone ssh://git@localhost:%d/<namespace>/myrepo.git\n", cfg.Server.SSHPort)
+	}
 
 	return srv.Start(cfg.Server.Host, cfg.Server.Port)
 }
 
+// newLFSStorage builds the storage selected by [lfs.storage]. It returns nil
+// for local storage, which the server sets up under the data directory.
+func newLFSStorage(cfg *Config) (lfs.Storage, error) {
+	sc := cfg.LFS.Storage
+	if sc.DirectTransfer && (sc.Type == "" || sc.Type == "local") {
+		return nil, fmt.Errorf("direct_transfer requires s3 storage")
+	}
+	return newObjectStorage(sc.StorageConfig)
+}
+
+// newReleaseStorage builds the storage selected by [releases.storage]. LFS
+// garbage collection deletes objects it does not track, so release assets
+// cannot share a bucket prefix with LFS.
+func newReleaseStorage(cfg *Config) (lfs.Storage, error) {
+	sc, lfsSC := cfg.Releases.Storage, cfg.LFS.Storage.StorageConfig
+	if sc.Type == "s3" && lfsSC.Type == "s3" && sc.Endpoint == lfsSC.Endpoint && sc.Bucket == lfsSC.Bucket && sc.Prefix == lfsSC.Prefix {
+		return nil, fmt.Errorf("release assets must not share the lfs bucket prefix")
+	}
+	return newObjectStorage(sc)
+}
+
+// newObjectStorage builds the storage described by sc. It returns nil for
+// local storage.
+func newObjectStorage(sc StorageConfig) (lfs.Storage, error) {
+	switch sc.Type {
+	case "", "local":
+		return nil, nil
+	case "s3":
+		accessKeyID := sc.AccessKeyID
+		if accessKeyID == "" {
+			accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		}
+		secretAccessKey := sc.SecretAccessKey
+		if secretAccessKey == "" {
+			secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		}
+
+		return lfs.NewS3Storage(lfs.S3Config{
+			Endpoint:        sc.Endpoint,
+			Region:          sc.Region,
+			Bucket:          sc.Bucket,
+			Prefix:          sc.Prefix,
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			PathStyle:       sc.PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", sc.Type)
+	}
+}
+
 func initStore(dataDir string) (*store.SQLiteStore, error) {
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, fmt.Errorf("create data directory: %w", err)
@@ -158,8 +345,9 @@ func initStore(dataDir string) (*store.SQLiteStore, error) {
 func loadConfig(path string) (*Config, bool, error) {
 	config := Config{
 		Server: struct {
-			Port int    `toml:"port"`
-			Host string `toml:"host"`
+			Port    int    `toml:"port"`
+			Host    string `toml:"host"`
+			SSHPort int    `toml:"ssh_port"`
 		}{Port: 8080, Host: "0.0.0.0"},
 		Storage: struct {
 			DataDir string `toml:"data_dir"`
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bantamhq/ephemeral/internal/client"
+)
+
+func newMRCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "mr",
+		Aliases: []string{"merge-request"},
+		Short:   "Manage merge requests",
+		Long: `Manage merge requests.
+
+Repos are given as name or namespace/name.
+
+Examples:
+  eph mr list myrepo
+  eph mr create myrepo --source feature --title "Add feature"
+  eph mr show myrepo 3
+  eph mr merge myrepo 3 --strategy squash`,
+	}
+
+	cmd.AddCommand(
+		newMRListCmd(),
+		newMRCreateCmd(),
+		newMRShowCmd(),
+		newMRMergeCmd(),
+		newMRStatusCmd("close", "Close a merge request without merging", "closed", "Closed"),
+		newMRStatusCmd("reopen", "Reopen a closed merge request", "open", "Reopened"),
+	)
+
+	return cmd
+}
+
+func newMRListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list <repo>",
+		Short: "List merge requests",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMRList,
+	}
+
+	cmd.Flags().String("status", "open", "status to list: open, merged, closed or all")
+
+	return cmd
+}
+
+func newMRCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create <repo>",
+		Short: "Open a merge request",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMRCreate,
+	}
+
+	cmd.Flags().String("source", "", "branch to merge (required)")
+	cmd.Flags().String("target", "", "branch to merge into (defaults to the default branch)")
+	cmd.Flags().String("title", "", "title (required)")
+	cmd.Flags().String("description", "", "description")
+	cmd.MarkFlagRequired("source")
+	cmd.MarkFlagRequired("title")
+
+	return cmd
+}
+
+func newMRShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <repo> <number>",
+		Short: "Show a merge request and whether it can be merged",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runMRShow,
+	}
+}
+
+func newMRMergeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge <repo> <number>",
+		Short: "Merge a merge request",
+		Long: `Merge a merge request on the server.
+
+Strategies:
+  merge   create a merge commit
+  squash  combine the changes into a single commit
+  rebase  replay the commits onto the target branch and fast-forward it`,
+		Args: cobra.ExactArgs(2),
+		RunE: runMRMerge,
+	}
+
+	cmd.Flags().String("strategy", "merge", "merge strategy: merge, squash or rebase")
+	cmd.Flags().StringP("message", "m", "", "commit message for merge and squash commits")
+
+	return cmd
+}
+
+func newMRStatusCmd(use, short, status, done string) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " <repo> <number>",
+		Short: short,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, repo, err := loadRepo(args[0])
+			if err != nil {
+				return err
+			}
+
+			number, err := parseMRNumber(args[1])
+			if err != nil {
+				return err
+			}
+
+			mr, err := c.UpdateMergeRequest(context.Background(), repo.ID, number, client.MergeRequestUpdate{Status: &status})
+			if err != nil {
+				return formatMRError(use+" merge request", err)
+			}
+
+			fmt.Printf("%s %s !%d %s\n", styleCheckmark, done, mr.Number, mr.Title)
+			return nil
+		},
+	}
+}
+
+func parseMRNumber(arg string) (int64, error) {
+	number, err := strconv.ParseInt(strings.TrimPrefix(arg, "!"), 10, 64)
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("invalid merge request number %q", arg)
+	}
+	return number, nil
+}
+
+// formatMRError keeps the server's explanation for conflicts, which
+// formatAPIError would report as "already exists".
+func formatMRError(context string, err error) error {
+	var mergeErr *client.MergeError
+	if errors.As(err, &mergeErr) {
+		if len(mergeErr.Conflicts) == 0 {
+			return fmt.Errorf("%s: %s", context, mergeErr.Message)
+		}
+		return fmt.Errorf("%s: %s:\n  %s", context, mergeErr.Message, strings.Join(mergeErr.Conflicts, "\n  "))
+	}
+
+	if isConnectionError(err) {
+		return formatAPIError(context, err)
+	}
+
+	return fmt.Errorf("%s: %s", context, err.Error())
+}
+
+func runMRList(cmd *cobra.Command, args []string) error {
+	c, repo, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	status, _ := cmd.Flags().GetString("status")
+
+	var mrs []client.MergeRequest
+	cursor := ""
+	for {
+		page, hasMore, err := c.ListMergeRequests(context.Background(), repo.ID, status, cursor, 100)
+		if err != nil {
+			return formatMRError("list merge requests", err)
+		}
+		mrs = append(mrs, page...)
+		if !hasMore || len(page) == 0 {
+			break
+		}
+		cursor = strconv.FormatInt(page[len(page)-1].Number, 10)
+	}
+
+	if len(mrs) == 0 {
+		fmt.Println("No merge requests.")
+		return nil
+	}
+
+	for _, mr := range mrs {
+		fmt.Printf("!%-4d %-7s %s → %s  %s (%s)\n", mr.Number, mr.Status, mr.SourceBranch, mr.TargetBranch, mr.Title, mr.AuthorName)
+	}
+
+	return nil
+}
+
+func runMRCreate(cmd *cobra.Command, args []string) error {
+	c, repo, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	source, _ := cmd.Flags().GetString("source")
+	target, _ := cmd.Flags().GetString("target")
+	title, _ := cmd.Flags().GetString("title")
+	description, _ := cmd.Flags().GetString("description")
+
+	mr, err := c.CreateMergeRequest(context.Background(), repo.ID, title, description, source, target)
+	if err != nil {
+		return formatMRError("create merge request", err)
+	}
+
+	fmt.Printf("%s Opened !%d %s → %s\n", styleCheckmark, mr.Number, mr.SourceBranch, mr.TargetBranch)
+	printMergeStatus(mr)
+	return nil
+}
+
+func runMRShow(cmd *cobra.Command, args []string) error {
+	c, repo, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	number, err := parseMRNumber(args[1])
+	if err != nil {
+		return err
+	}
+
+	mr, err := c.GetMergeRequest(context.Background(), repo.ID, number)
+	if err != nil {
+		return formatMRError("get merge request", err)
+	}
+
+	fmt.Printf("!%d %s\n", mr.Number, mr.Title)
+	fmt.Printf("Status:   %s\n", mr.Status)
+	fmt.Printf("Author:   %s\n", mr.AuthorName)
+	fmt.Printf("Branches: %s → %s\n", mr.SourceBranch, mr.TargetBranch)
+	if mr.MergeCommitSHA != nil {
+		strategy := ""
+		if mr.MergeStrategy != nil {
+			strategy = " (" + *mr.MergeStrategy + ")"
+		}
+		fmt.Printf("Merged:   %s%s\n", *mr.MergeCommitSHA, strategy)
+	}
+	printMergeStatus(mr)
+
+	if mr.Description != "" {
+		fmt.Println()
+		fmt.Println(mr.Description)
+	}
+
+	return nil
+}
+
+// printMergeStatus describes whether an open merge request can be merged.
+func printMergeStatus(mr *client.MergeRequest) {
+	if mr.AheadBy != nil && mr.BehindBy != nil {
+		fmt.Printf("Commits:  %d ahead, %d behind\n", *mr.AheadBy, *mr.BehindBy)
+	}
+
+	switch mr.MergeStatus {
+	case "":
+	case "clean":
+		fmt.Println("Mergeable: yes")
+	case "conflicts":
+		fmt.Printf("Mergeable: no, conflicts in:\n  %s\n", strings.Join(mr.Conflicts, "\n  "))
+	case "up_to_date":
+		fmt.Println("Mergeable: no, nothing to merge")
+	case "missing_branch":
+		fmt.Println("Mergeable: no, a branch has been deleted")
+	case "unrelated":
+		fmt.Println("Mergeable: no, branches have no common history")
+	default:
+		fmt.Printf("Mergeable: %s\n", mr.MergeStatus)
+	}
+}
+
+func runMRMerge(cmd *cobra.Command, args []string) error {
+	c, repo, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	number, err := parseMRNumber(args[1])
+	if err != nil {
+		return err
+	}
+
+	strategy, _ := cmd.Flags().GetString("strategy")
+	message, _ := cmd.Flags().GetString("message")
+
+	mr, err := c.MergeMergeRequest(context.Background(), repo.ID, number, strategy, message)
+	if err != nil {
+		return formatMRError("merge", err)
+	}
+
+	sha := ""
+	if mr.MergeCommitSHA != nil {
+		sha = *mr.MergeCommitSHA
+		if len(sha) > 7 {
+			sha = sha[:7]
+		}
+	}
+
+	fmt.Printf("%s Merged !%d into %s at %s\n", styleCheckmark, mr.Number, mr.TargetBranch, sha)
+	return nil
+}
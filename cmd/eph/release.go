@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bantamhq/ephemeral/internal/client"
+)
+
+func newReleaseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "release",
+		Short: "Manage releases",
+		Long: `Manage releases.
+
+Repos are given as name or namespace/name. A release is created for an
+existing tag.
+
+Examples:
+  eph release create myrepo v1.0.0 --title "First release"
+  eph release upload myrepo v1.0.0 dist/app-linux-amd64 dist/app-darwin-arm64
+  eph release list myrepo`,
+	}
+
+	cmd.AddCommand(
+		newReleaseCreateCmd(),
+		newReleaseUploadCmd(),
+		newReleaseListCmd(),
+	)
+
+	return cmd
+}
+
+func newReleaseCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create <repo> <tag>",
+		Short: "Create a release for a tag",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runReleaseCreate,
+	}
+
+	cmd.Flags().String("title", "", "title (defaults to the tag name)")
+	cmd.Flags().String("notes", "", "release notes")
+	cmd.Flags().Bool("draft", false, "create a draft, visible only to users who can write to the repo")
+	cmd.Flags().Bool("prerelease", false, "mark the release as a prerelease")
+
+	return cmd
+}
+
+func newReleaseUploadCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upload <repo> <tag> <file>...",
+		Short: "Attach files to a release",
+		Args:  cobra.MinimumNArgs(3),
+		RunE:  runReleaseUpload,
+	}
+
+	cmd.Flags().String("name", "", "asset name (defaults to the file name; only with a single file)")
+
+	return cmd
+}
+
+func newReleaseListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list <repo>",
+		Short: "List releases",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runReleaseList,
+	}
+}
+
+func runReleaseCreate(cmd *cobra.Command, args []string) error {
+	c, repo, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	opts := client.CreateReleaseOptions{TagName: args[1]}
+	opts.Title, _ = cmd.Flags().GetString("title")
+	opts.Notes, _ = cmd.Flags().GetString("notes")
+	opts.Draft, _ = cmd.Flags().GetBool("draft")
+	opts.Prerelease, _ = cmd.Flags().GetBool("prerelease")
+
+	release, err := c.CreateRelease(context.Background(), repo.ID, opts)
+	if err != nil {
+		return formatAPIError("create release", err)
+	}
+
+	fmt.Printf("%s Created release %s (%s)\n", styleCheckmark, release.TagName, release.Title)
+	return nil
+}
+
+func runReleaseUpload(cmd *cobra.Command, args []string) error {
+	files := args[2:]
+	name, _ := cmd.Flags().GetString("name")
+	if name != "" && len(files) > 1 {
+		return fmt.Errorf("--name can only be used with a single file")
+	}
+
+	c, repo, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	release, err := c.GetReleaseByTag(context.Background(), repo.ID, args[1])
+	if err != nil {
+		return formatAPIError("get release", err)
+	}
+
+	for _, path := range files {
+		assetName := name
+		if assetName == "" {
+			assetName = filepath.Base(path)
+		}
+
+		asset, err := uploadReleaseFile(c, repo.ID, release.ID, assetName, path)
+		if err != nil {
+			return formatAPIError("upload "+path, err)
+		}
+
+		fmt.Printf("%s Uploaded %s (%d bytes)\n", styleCheckmark, asset.Name, asset.Size)
+	}
+
+	return nil
+}
+
+// uploadReleaseFile uploads a file as a release asset, guessing its content
+// type from the extension.
+func uploadReleaseFile(c *client.Client, repoID, releaseID, name, path string) (*client.ReleaseAsset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	return c.UploadReleaseAsset(context.Background(), repoID, releaseID, name, contentType, f, info.Size())
+}
+
+func runReleaseList(cmd *cobra.Command, args []string) error {
+	c, repo, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	var releases []client.Release
+	cursor := ""
+	for {
+		page, hasMore, err := c.ListReleases(context.Background(), repo.ID, cursor, 100)
+		if err != nil {
+			return formatAPIError("list releases", err)
+		}
+		releases = append(releases, page...)
+		if !hasMore || len(page) == 0 {
+			break
+		}
+		cursor = page[len(page)-1].ID
+	}
+
+	if len(releases) == 0 {
+		fmt.Println("No releases.")
+		return nil
+	}
+
+	for _, release := range releases {
+		label := ""
+		switch {
+		case release.Draft:
+			label = " [draft]"
+		case release.Prerelease:
+			label = " [prerelease]"
+		}
+		fmt.Printf("%-20s %s%s (%d assets)\n", release.TagName, release.Title, label, len(release.Assets))
+		for _, asset := range release.Assets {
+			fmt.Printf("  %-30s %d bytes\n", asset.Name, asset.Size)
+		}
+	}
+
+	return nil
+}
@@ -195,7 +195,7 @@ func (w *SetupWizard) createResources(createNamespace bool, namespaceName string
 		return result, fmt.Errorf("create grant: %w", err)
 	}
 
-	userToken, _, err := w.store.GenerateUserToken(user.ID, nil)
+	userToken, _, err := w.store.GenerateUserToken(user.ID, nil, nil, nil)
 	if err != nil {
 		return result, fmt.Errorf("create token: %w", err)
 	}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bantamhq/ephemeral/internal/client"
+)
+
+func newTokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage API tokens",
+		Long: `Manage your API tokens.
+
+Tokens authenticate the API and git over HTTP. A new token has all of your
+access unless --scope, --repo or --namespace limit it.
+
+Examples:
+  eph token create laptop --expires 90d
+  eph token create ci --scope repo:read --repo website
+  eph token list
+  eph token revoke ci`,
+	}
+
+	cmd.AddCommand(
+		newTokenListCmd(),
+		newTokenCreateCmd(),
+		newTokenRevokeCmd(),
+	)
+
+	return cmd
+}
+
+func newTokenListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List your tokens",
+		RunE:  runTokenList,
+	}
+}
+
+func newTokenCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a token",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runTokenCreate,
+	}
+
+	cmd.Flags().String("expires", "", "lifetime such as 30d or 12h (default never expires)")
+	cmd.Flags().StringSlice("scope", nil, "permissions the token is limited to, such as repo:read")
+	cmd.Flags().StringSlice("repo", nil, "limit the token to a repo, as name or namespace/name")
+	cmd.Flags().StringSlice("namespace", nil, "limit the token to the repos in a namespace")
+
+	return cmd
+}
+
+func newTokenRevokeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <id-or-name>",
+		Short: "Revoke a token",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runTokenRevoke,
+	}
+}
+
+func runTokenList(cmd *cobra.Command, args []string) error {
+	c, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	tokens, err := c.ListTokens(context.Background())
+	if err != nil {
+		return formatAPIError("list tokens", err)
+	}
+
+	if len(tokens) == 0 {
+		fmt.Println("No tokens.")
+		return nil
+	}
+
+	now := time.Now()
+	for _, token := range tokens {
+		name := "-"
+		if token.Name != nil {
+			name = *token.Name
+		}
+
+		var notes []string
+		if token.Current {
+			notes = append(notes, "current")
+		}
+		if token.Scope != nil {
+			notes = append(notes, "scoped")
+		}
+		switch {
+		case token.ExpiresAt == nil:
+		case token.ExpiresAt.Before(now):
+			notes = append(notes, "expired")
+		default:
+			notes = append(notes, "expires "+token.ExpiresAt.Format("2006-01-02"))
+		}
+		if token.LastUsedAt != nil {
+			notes = append(notes, "last used "+token.LastUsedAt.Format("2006-01-02"))
+		} else {
+			notes = append(notes, "never used")
+		}
+
+		fmt.Printf("%s  %-20s  created %s (%s)\n",
+			token.ID[:8], name, token.CreatedAt.Format("2006-01-02"), strings.Join(notes, ", "))
+	}
+
+	return nil
+}
+
+func runTokenCreate(cmd *cobra.Command, args []string) error {
+	c, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	opts := client.CreateTokenOptions{Name: args[0]}
+
+	if expires, _ := cmd.Flags().GetString("expires"); expires != "" {
+		lifetime, err := parseTokenLifetime(expires)
+		if err != nil {
+			return err
+		}
+		seconds := int(lifetime.Seconds())
+		opts.ExpiresInSeconds = &seconds
+	}
+
+	opts.Scope, err = tokenScopeFromFlags(cmd, c)
+	if err != nil {
+		return err
+	}
+
+	rawToken, token, err := c.CreateToken(context.Background(), opts)
+	if err != nil {
+		return formatAPIError("create token", err)
+	}
+
+	fmt.Printf("%s Created token %s (%s)\n", styleCheckmark, args[0], token.ID[:8])
+	fmt.Println()
+	fmt.Println(rawToken)
+	fmt.Println()
+	fmt.Println("Copy the token now; it won't be shown again.")
+	return nil
+}
+
+// parseTokenLifetime parses a duration, also accepting whole days such as 30d.
+func parseTokenLifetime(s string) (time.Duration, error) {
+	var lifetime time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid --expires %q", s)
+		}
+		lifetime = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if lifetime, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid --expires %q", s)
+		}
+	}
+
+	if lifetime <= 0 {
+		return 0, fmt.Errorf("--expires must be positive")
+	}
+	return lifetime, nil
+}
+
+// tokenScopeFromFlags builds a token scope from the --scope, --repo and
+// --namespace flags. It returns nil when none are set.
+func tokenScopeFromFlags(cmd *cobra.Command, c *client.Client) (*client.TokenScope, error) {
+	perms, _ := cmd.Flags().GetStringSlice("scope")
+	repos, _ := cmd.Flags().GetStringSlice("repo")
+	namespaces, _ := cmd.Flags().GetStringSlice("namespace")
+	if len(perms) == 0 && len(repos) == 0 && len(namespaces) == 0 {
+		return nil, nil
+	}
+
+	scope := &client.TokenScope{Allow: perms}
+
+	for _, arg := range repos {
+		_, repo, err := loadRepo(arg)
+		if err != nil {
+			return nil, err
+		}
+		scope.RepoIDs = append(scope.RepoIDs, repo.ID)
+	}
+
+	if len(namespaces) > 0 {
+		available, err := c.ListNamespaces(context.Background())
+		if err != nil {
+			return nil, formatAPIError("list namespaces", err)
+		}
+		for _, name := range namespaces {
+			id := ""
+			for _, ns := range available {
+				if ns.Name == name {
+					id = ns.ID
+				}
+			}
+			if id == "" {
+				return nil, fmt.Errorf("namespace %q not found", name)
+			}
+			scope.NamespaceIDs = append(scope.NamespaceIDs, id)
+		}
+	}
+
+	return scope, nil
+}
+
+func runTokenRevoke(cmd *cobra.Command, args []string) error {
+	c, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	target := args[0]
+
+	tokens, err := c.ListTokens(context.Background())
+	if err != nil {
+		return formatAPIError("list tokens", err)
+	}
+
+	var matched []client.UserToken
+	for _, token := range tokens {
+		if token.ID == target || strings.HasPrefix(token.ID, target) || (token.Name != nil && *token.Name == target) {
+			matched = append(matched, token)
+		}
+	}
+
+	switch len(matched) {
+	case 0:
+		return fmt.Errorf("no token matching %q", target)
+	case 1:
+	default:
+		return fmt.Errorf("%q matches %d tokens, use a longer ID", target, len(matched))
+	}
+
+	if matched[0].Current {
+		return fmt.Errorf("%q is the token this CLI is logged in with - log in with another token first", target)
+	}
+
+	if err := c.DeleteToken(context.Background(), matched[0].ID); err != nil {
+		return formatAPIError("revoke token", err)
+	}
+
+	fmt.Printf("%s Revoked token %s\n", styleCheckmark, matched[0].ID[:8])
+	return nil
+}
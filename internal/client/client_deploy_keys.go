@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DeployKey is a credential bound to a single repo, either a token or an SSH
+// public key.
+type DeployKey struct {
+	ID          string     `json:"id"`
+	RepoID      string     `json:"repo_id"`
+	Name        string     `json:"name"`
+	ReadOnly    bool       `json:"read_only"`
+	KeyType     *string    `json:"key_type,omitempty"`
+	Fingerprint *string    `json:"fingerprint,omitempty"`
+	PublicKey   *string    `json:"public_key,omitempty"`
+	CreatedBy   *string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateDeployKeyOptions holds the fields of a new deploy key. A token deploy
+// key is created when PublicKey is empty.
+type CreateDeployKeyOptions struct {
+	Name      string `json:"name"`
+	ReadOnly  bool   `json:"read_only"`
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// ListDeployKeys lists a repo's deploy keys.
+func (c *Client) ListDeployKeys(ctx context.Context, repoID string) ([]DeployKey, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/repos/"+repoID+"/deploy-keys")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	var dataResp response
+	if err := json.NewDecoder(resp.Body).Decode(&dataResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	var keys []DeployKey
+	if err := json.Unmarshal(dataResp.Data, &keys); err != nil {
+		return nil, fmt.Errorf("decode deploy keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// CreateDeployKey adds a deploy key to a repo. For token deploy keys the raw
+// token is only returned here and cannot be retrieved again.
+func (c *Client) CreateDeployKey(ctx context.Context, repoID string, opts CreateDeployKeyOptions) (string, *DeployKey, error) {
+	resp, err := c.doRequestWithBody(ctx, http.MethodPost, "/api/v1/repos/"+repoID+"/deploy-keys", opts)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", nil, c.decodeError(resp)
+	}
+
+	var dataResp response
+	if err := json.NewDecoder(resp.Body).Decode(&dataResp); err != nil {
+		return "", nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	var created struct {
+		Token    string    `json:"token"`
+		Metadata DeployKey `json:"metadata"`
+	}
+	if err := json.Unmarshal(dataResp.Data, &created); err != nil {
+		return "", nil, fmt.Errorf("decode deploy key: %w", err)
+	}
+
+	return created.Token, &created.Metadata, nil
+}
+
+// DeleteDeployKey removes a deploy key from a repo.
+func (c *Client) DeleteDeployKey(ctx context.Context, repoID, keyID string) error {
+	resp, err := c.doRequest(ctx, http.MethodDelete, "/api/v1/repos/"+repoID+"/deploy-keys/"+keyID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return c.decodeError(resp)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SSHKey represents a public key registered for git over SSH.
+type SSHKey struct {
+	ID          string     `json:"id"`
+	Name        *string    `json:"name,omitempty"`
+	KeyType     string     `json:"key_type"`
+	Fingerprint string     `json:"fingerprint"`
+	PublicKey   string     `json:"public_key"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// ListSSHKeys lists the SSH keys registered to the current user.
+func (c *Client) ListSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/user/keys")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	var dataResp response
+	if err := json.NewDecoder(resp.Body).Decode(&dataResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	var keys []SSHKey
+	if err := json.Unmarshal(dataResp.Data, &keys); err != nil {
+		return nil, fmt.Errorf("decode ssh keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// AddSSHKey registers a public key in authorized_keys format for the current user.
+func (c *Client) AddSSHKey(ctx context.Context, name *string, publicKey string) (*SSHKey, error) {
+	body := map[string]any{"public_key": publicKey}
+	if name != nil {
+		body["name"] = *name
+	}
+
+	resp, err := c.doRequestWithBody(ctx, http.MethodPost, "/api/v1/user/keys", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, c.decodeError(resp)
+	}
+
+	var dataResp response
+	if err := json.NewDecoder(resp.Body).Decode(&dataResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	var key SSHKey
+	if err := json.Unmarshal(dataResp.Data, &key); err != nil {
+		return nil, fmt.Errorf("decode ssh key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// DeleteSSHKey removes one of the current user's SSH keys.
+func (c *Client) DeleteSSHKey(ctx context.Context, id string) error {
+	resp, err := c.doRequest(ctx, http.MethodDelete, "/api/v1/user/keys/"+id)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return c.decodeError(resp)
+	}
+
+	return nil
+}
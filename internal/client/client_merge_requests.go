@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MergeRequest represents a request to merge a source branch into a target branch.
+type MergeRequest struct {
+	ID             string     `json:"id"`
+	RepoID         string     `json:"repo_id"`
+	Number         int64      `json:"number"`
+	Title          string     `json:"title"`
+	Description    string     `json:"description"`
+	SourceBranch   string     `json:"source_branch"`
+	TargetBranch   string     `json:"target_branch"`
+	Status         string     `json:"status"`
+	AuthorID       *string    `json:"author_id,omitempty"`
+	AuthorName     string     `json:"author_name"`
+	SourceSHA      *string    `json:"source_sha,omitempty"`
+	TargetSHA      *string    `json:"target_sha,omitempty"`
+	MergeStrategy  *string    `json:"merge_strategy,omitempty"`
+	MergeCommitSHA *string    `json:"merge_commit_sha,omitempty"`
+	MergedAt       *time.Time `json:"merged_at,omitempty"`
+	ClosedAt       *time.Time `json:"closed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Live state of an open merge request, returned when fetching one.
+	AheadBy     *int     `json:"ahead_by,omitempty"`
+	BehindBy    *int     `json:"behind_by,omitempty"`
+	MergeStatus string   `json:"merge_status,omitempty"`
+	Mergeable   *bool    `json:"mergeable,omitempty"`
+	Conflicts   []string `json:"conflicts,omitempty"`
+}
+
+// MergeRequestUpdate holds the fields to change on a merge request.
+type MergeRequestUpdate struct {
+	Title        *string `json:"title,omitempty"`
+	Description  *string `json:"description,omitempty"`
+	TargetBranch *string `json:"target_branch,omitempty"`
+	Status       *string `json:"status,omitempty"`
+}
+
+// MergeError is returned when the server refuses a merge, for example
+// because of conflicts.
+type MergeError struct {
+	Message   string   `json:"error"`
+	Code      string   `json:"code"`
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+func (e *MergeError) Error() string {
+	return e.Message
+}
+
+// ListMergeRequests lists a repo's merge requests with the given status:
+// open, merged, closed or all. An empty status lists open merge requests.
+func (c *Client) ListMergeRequests(ctx context.Context, repoID, status, cursor string, limit int) ([]MergeRequest, bool, error) {
+	params := url.Values{}
+	if status != "" {
+		params.Set("status", status)
+	}
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	path := "/api/v1/repos/" + repoID + "/merge-requests"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	resp, err := c.doRequest(ctx, http.MethodGet, path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, c.decodeError(resp)
+	}
+
+	var listResp listResponse
+	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+		return nil, false, fmt.Errorf("decode response: %w", err)
+	}
+
+	var mrs []MergeRequest
+	if err := json.Unmarshal(listResp.Data, &mrs); err != nil {
+		return nil, false, fmt.Errorf("decode merge requests: %w", err)
+	}
+
+	return mrs, listResp.HasMore, nil
+}
+
+// CreateMergeRequest opens a merge request. An empty target branch means the
+// repo's default branch.
+func (c *Client) CreateMergeRequest(ctx context.Context, repoID, title, description, sourceBranch, targetBranch string) (*MergeRequest, error) {
+	body := map[string]any{
+		"title":         title,
+		"description":   description,
+		"source_branch": sourceBranch,
+	}
+	if targetBranch != "" {
+		body["target_branch"] = targetBranch
+	}
+
+	resp, err := c.doRequestWithBody(ctx, http.MethodPost, "/api/v1/repos/"+repoID+"/merge-requests", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, c.decodeError(resp)
+	}
+
+	return decodeMergeRequest(resp)
+}
+
+// GetMergeRequest retrieves a merge request by its number.
+func (c *Client) GetMergeRequest(ctx context.Context, repoID string, number int64) (*MergeRequest, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, mergeRequestPath(repoID, number))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	return decodeMergeRequest(resp)
+}
+
+// UpdateMergeRequest changes a merge request. Setting the status to closed or
+// open closes or reopens it.
+func (c *Client) UpdateMergeRequest(ctx context.Context, repoID string, number int64, update MergeRequestUpdate) (*MergeRequest, error) {
+	resp, err := c.doRequestWithBody(ctx, http.MethodPatch, mergeRequestPath(repoID, number), update)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	return decodeMergeRequest(resp)
+}
+
+// MergeMergeRequest merges a merge request with the given strategy: merge,
+// squash or rebase. An empty message uses the server's default. Conflicts
+// are returned as a *MergeError.
+func (c *Client) MergeMergeRequest(ctx context.Context, repoID string, number int64, strategy, message string) (*MergeRequest, error) {
+	body := map[string]any{}
+	if strategy != "" {
+		body["strategy"] = strategy
+	}
+	if message != "" {
+		body["message"] = message
+	}
+
+	resp, err := c.doRequestWithBody(ctx, http.MethodPost, mergeRequestPath(repoID, number)+"/merge", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		var mergeErr MergeError
+		if err := json.NewDecoder(resp.Body).Decode(&mergeErr); err != nil || mergeErr.Message == "" {
+			return nil, fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil, &mergeErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	return decodeMergeRequest(resp)
+}
+
+func mergeRequestPath(repoID string, number int64) string {
+	return "/api/v1/repos/" + repoID + "/merge-requests/" + strconv.FormatInt(number, 10)
+}
+
+func decodeMergeRequest(resp *http.Response) (*MergeRequest, error) {
+	var dataResp response
+	if err := json.NewDecoder(resp.Body).Decode(&dataResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	var mr MergeRequest
+	if err := json.Unmarshal(dataResp.Data, &mr); err != nil {
+		return nil, fmt.Errorf("decode merge request: %w", err)
+	}
+
+	return &mr, nil
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Release represents a release of a repo, tied to a tag.
+type Release struct {
+	ID          string         `json:"id"`
+	RepoID      string         `json:"repo_id"`
+	TagName     string         `json:"tag_name"`
+	Title       string         `json:"title"`
+	Notes       string         `json:"notes"`
+	Draft       bool           `json:"draft"`
+	Prerelease  bool           `json:"prerelease"`
+	AuthorID    *string        `json:"author_id,omitempty"`
+	AuthorName  string         `json:"author_name"`
+	Assets      []ReleaseAsset `json:"assets"`
+	PublishedAt *time.Time     `json:"published_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// ReleaseAsset represents a file attached to a release.
+type ReleaseAsset struct {
+	ID          string    `json:"id"`
+	ReleaseID   string    `json:"release_id"`
+	RepoID      string    `json:"repo_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	UploaderID  *string   `json:"uploader_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateReleaseOptions holds the fields of a new release.
+type CreateReleaseOptions struct {
+	TagName    string `json:"tag_name"`
+	Title      string `json:"title,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// ListReleases lists a repo's releases, newest first. Drafts are included
+// when the token can write to the repo.
+func (c *Client) ListReleases(ctx context.Context, repoID, cursor string, limit int) ([]Release, bool, error) {
+	path := buildPaginatedPath("/api/v1/repos/"+repoID+"/releases", cursor, limit)
+
+	resp, err := c.doRequest(ctx, http.MethodGet, path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, c.decodeError(resp)
+	}
+
+	var listResp listResponse
+	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+		return nil, false, fmt.Errorf("decode response: %w", err)
+	}
+
+	var releases []Release
+	if err := json.Unmarshal(listResp.Data, &releases); err != nil {
+		return nil, false, fmt.Errorf("decode releases: %w", err)
+	}
+
+	return releases, listResp.HasMore, nil
+}
+
+// CreateRelease creates a release for an existing tag.
+func (c *Client) CreateRelease(ctx context.Context, repoID string, opts CreateReleaseOptions) (*Release, error) {
+	resp, err := c.doRequestWithBody(ctx, http.MethodPost, "/api/v1/repos/"+repoID+"/releases", opts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, c.decodeError(resp)
+	}
+
+	return decodeRelease(resp)
+}
+
+// GetReleaseByTag retrieves the release for a tag.
+func (c *Client) GetReleaseByTag(ctx context.Context, repoID, tag string) (*Release, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/repos/"+repoID+"/releases/tags/"+tag)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	return decodeRelease(resp)
+}
+
+// UploadReleaseAsset attaches the content of body to a release as name.
+// Uploads are not subject to the client's request timeout.
+func (c *Client) UploadReleaseAsset(ctx context.Context, repoID, releaseID, name, contentType string, body io.Reader, size int64) (*ReleaseAsset, error) {
+	path := "/api/v1/repos/" + repoID + "/releases/" + releaseID + "/assets?name=" + url.QueryEscape(name)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.ContentLength = size
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	httpClient := *c.http
+	httpClient.Timeout = 0
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, c.decodeError(resp)
+	}
+
+	var dataResp response
+	if err := json.NewDecoder(resp.Body).Decode(&dataResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	var asset ReleaseAsset
+	if err := json.Unmarshal(dataResp.Data, &asset); err != nil {
+		return nil, fmt.Errorf("decode release asset: %w", err)
+	}
+
+	return &asset, nil
+}
+
+func decodeRelease(resp *http.Response) (*Release, error) {
+	var dataResp response
+	if err := json.NewDecoder(resp.Body).Decode(&dataResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	var release Release
+	if err := json.Unmarshal(dataResp.Data, &release); err != nil {
+		return nil, fmt.Errorf("decode release: %w", err)
+	}
+
+	return &release, nil
+}
@@ -27,6 +27,19 @@ type RepoWithFolders struct {
 	Folders []Folder `json:"folders,omitempty"`
 }
 
+// PushEvent is a single ref update made by a git push.
+type PushEvent struct {
+	ID        string    `json:"id"`
+	RepoID    string    `json:"repo_id"`
+	Ref       string    `json:"ref"`
+	OldSHA    string    `json:"old_sha"`
+	NewSHA    string    `json:"new_sha"`
+	UserID    *string   `json:"user_id,omitempty"`
+	TokenID   *string   `json:"token_id,omitempty"`
+	Forced    bool      `json:"forced"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // ListRepos lists repositories in the current namespace.
 func (c *Client) ListRepos(ctx context.Context, cursor string, limit int) ([]Repo, bool, error) {
 	path := buildPaginatedPath("/api/v1/repos", cursor, limit)
@@ -236,3 +249,30 @@ func (c *Client) RemoveRepoFolder(ctx context.Context, repoID, folderID string)
 
 	return nil
 }
+
+// ListPushEvents lists the push audit log for a repository, newest first.
+func (c *Client) ListPushEvents(ctx context.Context, repoID, cursor string, limit int) ([]PushEvent, bool, error) {
+	path := buildPaginatedPath("/api/v1/repos/"+repoID+"/events", cursor, limit)
+
+	resp, err := c.doRequest(ctx, http.MethodGet, path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, c.decodeError(resp)
+	}
+
+	var listResp listResponse
+	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+		return nil, false, fmt.Errorf("decode response: %w", err)
+	}
+
+	var events []PushEvent
+	if err := json.Unmarshal(listResp.Data, &events); err != nil {
+		return nil, false, fmt.Errorf("decode push events: %w", err)
+	}
+
+	return events, listResp.HasMore, nil
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CodeSearchResult represents a file with lines matching a code search.
+type CodeSearchResult struct {
+	RepoID    string            `json:"repo_id"`
+	Repo      string            `json:"repo"`
+	Namespace string            `json:"namespace"`
+	Path      string            `json:"path"`
+	BlobSHA   string            `json:"blob_sha"`
+	Ref       string            `json:"ref"`
+	CommitSHA string            `json:"commit_sha"`
+	Matches   []CodeSearchMatch `json:"matches"`
+	Truncated bool              `json:"truncated"`
+}
+
+// CodeSearchMatch represents a matching line and the lines around it.
+type CodeSearchMatch struct {
+	LineNumber int      `json:"line_number"`
+	Line       string   `json:"line"`
+	Ranges     [][2]int `json:"ranges"`
+	Before     []string `json:"before,omitempty"`
+	After      []string `json:"after,omitempty"`
+}
+
+// CodeSearchOptions narrows a code search.
+type CodeSearchOptions struct {
+	Repo          string
+	Regex         bool
+	CaseSensitive bool
+	Path          string
+	Context       *int
+}
+
+// SearchCode searches the default branches of the repos in the client's
+// namespace. It returns the cursor for the next page, or "" if there is none.
+func (c *Client) SearchCode(ctx context.Context, query string, opts CodeSearchOptions, cursor string, limit int) ([]CodeSearchResult, string, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	if opts.Repo != "" {
+		params.Set("repo", opts.Repo)
+	}
+	if opts.Regex {
+		params.Set("mode", "regex")
+	}
+	if opts.CaseSensitive {
+		params.Set("case_sensitive", "true")
+	}
+	if opts.Path != "" {
+		params.Set("path", opts.Path)
+	}
+	if opts.Context != nil {
+		params.Set("context", strconv.Itoa(*opts.Context))
+	}
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/search/code?"+params.Encode())
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", c.decodeError(resp)
+	}
+
+	var listResp listResponse
+	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+		return nil, "", fmt.Errorf("decode response: %w", err)
+	}
+
+	var results []CodeSearchResult
+	if err := json.Unmarshal(listResp.Data, &results); err != nil {
+		return nil, "", fmt.Errorf("decode search results: %w", err)
+	}
+
+	var nextCursor string
+	if listResp.HasMore && listResp.NextCursor != nil {
+		nextCursor = *listResp.NextCursor
+	}
+
+	return results, nextCursor, nil
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// UserToken represents one of the current user's API tokens.
+type UserToken struct {
+	ID         string      `json:"id"`
+	Name       *string     `json:"name,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	ExpiresAt  *time.Time  `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time  `json:"last_used_at,omitempty"`
+	Scope      *TokenScope `json:"scope,omitempty"`
+	Current    bool        `json:"current"`
+}
+
+// TokenScope limits a token to part of its user's access.
+type TokenScope struct {
+	Allow        []string `json:"allow"`
+	RepoIDs      []string `json:"repo_ids,omitempty"`
+	NamespaceIDs []string `json:"namespace_ids,omitempty"`
+}
+
+// CreateTokenOptions holds the fields of a new token.
+type CreateTokenOptions struct {
+	Name             string      `json:"name,omitempty"`
+	ExpiresInSeconds *int        `json:"expires_in_seconds,omitempty"`
+	Scope            *TokenScope `json:"scope,omitempty"`
+}
+
+// ListTokens lists the current user's tokens, newest first.
+func (c *Client) ListTokens(ctx context.Context) ([]UserToken, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/user/tokens")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	var dataResp response
+	if err := json.NewDecoder(resp.Body).Decode(&dataResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	var tokens []UserToken
+	if err := json.Unmarshal(dataResp.Data, &tokens); err != nil {
+		return nil, fmt.Errorf("decode tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// CreateToken creates a token for the current user. The raw token is only
+// returned here and cannot be retrieved again.
+func (c *Client) CreateToken(ctx context.Context, opts CreateTokenOptions) (string, *UserToken, error) {
+	resp, err := c.doRequestWithBody(ctx, http.MethodPost, "/api/v1/user/tokens", opts)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", nil, c.decodeError(resp)
+	}
+
+	var dataResp response
+	if err := json.NewDecoder(resp.Body).Decode(&dataResp); err != nil {
+		return "", nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	var created struct {
+		Token    string    `json:"token"`
+		Metadata UserToken `json:"metadata"`
+	}
+	if err := json.Unmarshal(dataResp.Data, &created); err != nil {
+		return "", nil, fmt.Errorf("decode token: %w", err)
+	}
+
+	return created.Token, &created.Metadata, nil
+}
+
+// DeleteToken revokes one of the current user's tokens.
+func (c *Client) DeleteToken(ctx context.Context, id string) error {
+	resp, err := c.doRequest(ctx, http.MethodDelete, "/api/v1/user/tokens/"+id)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return c.decodeError(resp)
+	}
+
+	return nil
+}
+
+// ApproveDeviceLogin logs in the device showing the user code with a new
+// token for the current user.
+func (c *Client) ApproveDeviceLogin(ctx context.Context, userCode string) error {
+	body := map[string]any{"user_code": userCode}
+	resp, err := c.doRequestWithBody(ctx, http.MethodPost, "/api/v1/auth/device/approve", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return c.decodeError(resp)
+	}
+
+	return nil
+}
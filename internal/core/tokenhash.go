@@ -101,7 +101,29 @@ func BuildToken(lookup, secret string) string {
 // ParseToken extracts components from a token string.
 // Returns lookup key and secret.
 func ParseToken(token string) (lookup, secret string, err error) {
-	if !strings.HasPrefix(token, "eph_") {
+	return parseTokenParts(token, "eph_")
+}
+
+// BuildDeployToken constructs a deploy key token string. The distinct prefix
+// keeps deploy tokens out of places that only accept user tokens.
+// Format: ephd_<lookup>_<secret>
+func BuildDeployToken(lookup, secret string) string {
+	return fmt.Sprintf("ephd_%s_%s", lookup, secret)
+}
+
+// IsDeployToken reports whether a token string has the deploy token prefix.
+func IsDeployToken(token string) bool {
+	return strings.HasPrefix(token, "ephd_")
+}
+
+// ParseDeployToken extracts components from a deploy key token string.
+// Returns lookup key and secret.
+func ParseDeployToken(token string) (lookup, secret string, err error) {
+	return parseTokenParts(token, "ephd_")
+}
+
+func parseTokenParts(token, prefix string) (lookup, secret string, err error) {
+	if !strings.HasPrefix(token, prefix) {
 		return "", "", ErrInvalidToken
 	}
 
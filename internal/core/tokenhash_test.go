@@ -122,3 +122,28 @@ func TestParseToken(t *testing.T) {
 		}
 	})
 }
+
+func TestParseDeployToken(t *testing.T) {
+	token := BuildDeployToken("abc12345", "secretsecretsecretsecret")
+	if token != "ephd_abc12345_secretsecretsecretsecret" {
+		t.Errorf("BuildDeployToken() = %s", token)
+	}
+
+	lookup, secret, err := ParseDeployToken(token)
+	if err != nil {
+		t.Fatalf("ParseDeployToken() error = %v", err)
+	}
+	if lookup != "abc12345" || secret != "secretsecretsecretsecret" {
+		t.Errorf("ParseDeployToken() = %s, %s", lookup, secret)
+	}
+
+	if !IsDeployToken(token) {
+		t.Error("IsDeployToken() = false for a deploy token")
+	}
+	if _, _, err := ParseToken(token); err != ErrInvalidToken {
+		t.Errorf("ParseToken() accepted a deploy token, error = %v", err)
+	}
+	if _, _, err := ParseDeployToken("eph_abc12345_secret"); err != ErrInvalidToken {
+		t.Errorf("ParseDeployToken() accepted a user token, error = %v", err)
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 )
 
 var oidPattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
@@ -155,3 +158,45 @@ func (s *LocalStorage) Size(ctx context.Context, repoID, oid string) (int64, err
 	}
 	return info.Size(), nil
 }
+
+// Walk calls fn for every object under the storage root. Temporary uploads are skipped.
+func (s *LocalStorage) Walk(ctx context.Context, fn func(StoredObject) error) error {
+	err := filepath.WalkDir(s.basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.basePath, path)
+		if err != nil {
+			return err
+		}
+
+		// <repoID>/objects/<xx>/<yy>/<oid>
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) != 5 || parts[1] != "objects" || ValidateOID(parts[4]) != nil {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		return fn(StoredObject{
+			RepoID:  parts[0],
+			OID:     parts[4],
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
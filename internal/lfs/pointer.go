@@ -0,0 +1,34 @@
+package lfs
+
+import (
+	"bytes"
+	"strings"
+)
+
+// MaxPointerSize is the largest blob treated as a possible pointer file, the
+// same cutoff git-lfs uses.
+const MaxPointerSize = 1024
+
+const pointerVersionPrefix = "version https://git-lfs.github.com/spec/"
+
+// ParsePointer returns the OID referenced by an LFS pointer file, or false if
+// the content is not a pointer.
+func ParsePointer(content []byte) (string, bool) {
+	if len(content) > MaxPointerSize || !bytes.HasPrefix(content, []byte(pointerVersionPrefix)) {
+		return "", false
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		oid, ok := strings.CutPrefix(line, "oid sha256:")
+		if !ok {
+			continue
+		}
+		oid = strings.TrimSpace(oid)
+		if ValidateOID(oid) != nil {
+			return "", false
+		}
+		return oid, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,473 @@
+package lfs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3Service       = "s3"
+	s3DateFormat    = "20060102T150405Z"
+	s3UnsignedBody  = "UNSIGNED-PAYLOAD"
+	s3EmptyBodyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3DefaultRegion = "us-east-1"
+	s3MaxErrorBytes = 4096
+)
+
+// S3Config configures an S3-compatible object store such as AWS S3 or MinIO.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses objects as endpoint/bucket/key instead of
+	// bucket.endpoint/key. MinIO and most self-hosted stores need this.
+	PathStyle bool
+}
+
+// S3Storage stores LFS objects in an S3-compatible bucket, signing requests
+// with AWS Signature Version 4. Objects use the same key layout as LocalStorage.
+type S3Storage struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("s3 endpoint is required")
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 credentials are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = s3DefaultRegion
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse s3 endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("s3 endpoint must be an http or https URL")
+	}
+
+	return &S3Storage{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   &http.Client{},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3Storage) objectKey(repoID, oid string) string {
+	return s.cfg.Prefix + repoID + "/objects/" + oid[:2] + "/" + oid[2:4] + "/" + oid
+}
+
+func (s *S3Storage) objectURL(repoID, oid string) *url.URL {
+	return s.keyURL(s.objectKey(repoID, oid))
+}
+
+// keyURL returns the URL of a key in the bucket. An empty key addresses the bucket itself.
+func (s *S3Storage) keyURL(key string) *url.URL {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+
+	if s.cfg.PathStyle {
+		u.Path = base + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = base + "/" + key
+	}
+	u.RawPath = ""
+	return &u
+}
+
+func (s *S3Storage) Exists(ctx context.Context, repoID, oid string) (bool, error) {
+	_, err := s.Size(ctx, repoID, oid)
+	if err == ErrObjectNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *S3Storage) Size(ctx context.Context, repoID, oid string) (int64, error) {
+	if err := ValidateOID(oid); err != nil {
+		return 0, err
+	}
+
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL(repoID, oid), nil, 0, s3EmptyBodyHash)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.ContentLength, nil
+	case http.StatusNotFound:
+		return 0, ErrObjectNotFound
+	default:
+		return 0, s3ResponseError("head object", resp)
+	}
+}
+
+func (s *S3Storage) Get(ctx context.Context, repoID, oid string) (io.ReadCloser, int64, error) {
+	if err := ValidateOID(oid); err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(repoID, oid), nil, 0, s3EmptyBodyHash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.ContentLength, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, 0, ErrObjectNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, 0, s3ResponseError("get object", resp)
+	}
+}
+
+// Put sends the OID as the signed payload hash, so the store itself rejects
+// content that does not match it.
+func (s *S3Storage) Put(ctx context.Context, repoID, oid string, content io.Reader, size int64) error {
+	if err := ValidateOID(oid); err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(repoID, oid), content, size, oid)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	err = s3ResponseError("put object", resp)
+	if strings.Contains(err.Error(), "XAmzContentSHA256Mismatch") {
+		return ErrHashMismatch
+	}
+	return err
+}
+
+// Delete returns ErrObjectNotFound for missing objects, matching LocalStorage,
+// even though S3 itself treats deleting a missing key as success.
+func (s *S3Storage) Delete(ctx context.Context, repoID, oid string) error {
+	exists, err := s.Exists(ctx, repoID, oid)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrObjectNotFound
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(repoID, oid), nil, 0, s3EmptyBodyHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3ResponseError("delete object", resp)
+	}
+	return nil
+}
+
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// Walk calls fn for every object under the configured prefix.
+func (s *S3Storage) Walk(ctx context.Context, fn func(StoredObject) error) error {
+	token := ""
+	for {
+		u := s.keyURL("")
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if s.cfg.Prefix != "" {
+			query.Set("prefix", s.cfg.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = s3CanonicalQuery(query)
+
+		result, err := s.list(ctx, u)
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range result.Contents {
+			// <prefix><repoID>/objects/<xx>/<yy>/<oid>
+			parts := strings.Split(strings.TrimPrefix(obj.Key, s.cfg.Prefix), "/")
+			if len(parts) != 5 || parts[1] != "objects" || ValidateOID(parts[4]) != nil {
+				continue
+			}
+
+			if err := fn(StoredObject{
+				RepoID:  parts[0],
+				OID:     parts[4],
+				Size:    obj.Size,
+				ModTime: obj.LastModified,
+			}); err != nil {
+				return err
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Storage) list(ctx context.Context, u *url.URL) (*s3ListResult, error) {
+	resp, err := s.do(ctx, http.MethodGet, u, nil, 0, s3EmptyBodyHash)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3ResponseError("list objects", resp)
+	}
+
+	var result s3ListResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode s3 list: %w", err)
+	}
+	return &result, nil
+}
+
+// PresignGet returns a URL that downloads the object without credentials until it expires.
+func (s *S3Storage) PresignGet(repoID, oid string, expires time.Duration) (string, error) {
+	if err := ValidateOID(oid); err != nil {
+		return "", err
+	}
+	return s.presign(http.MethodGet, s.objectURL(repoID, oid), nil, expires, s.now()), nil
+}
+
+// PresignPut returns a URL that uploads the object without credentials until it
+// expires. The returned headers must be sent with the upload; they bind the
+// payload hash to the OID and the length to size, so the store rejects
+// mismatched content and uploads larger than the size that was approved.
+func (s *S3Storage) PresignPut(repoID, oid string, size int64, expires time.Duration) (string, map[string]string, error) {
+	if err := ValidateOID(oid); err != nil {
+		return "", nil, err
+	}
+	if size < 0 {
+		return "", nil, fmt.Errorf("invalid object size %d", size)
+	}
+
+	length := strconv.FormatInt(size, 10)
+	header := http.Header{}
+	header.Set("X-Amz-Content-Sha256", oid)
+	header.Set("Content-Length", length)
+
+	href := s.presign(http.MethodPut, s.objectURL(repoID, oid), header, expires, s.now())
+	return href, map[string]string{"X-Amz-Content-Sha256": oid, "Content-Length": length}, nil
+}
+
+func (s *S3Storage) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("build s3 request: %w", err)
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	s.sign(req, payloadHash, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 request: %w", err)
+	}
+	return resp, nil
+}
+
+// sign adds SigV4 authorization to a request. Every header already set on the
+// request is signed along with the host.
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3DateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders, canonicalHeaders := s3CanonicalHeaders(req.URL.Host, req.Header)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EncodePath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := s.scope(now)
+	signature := s.signature(now, scope, canonicalRequest)
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// presign returns a SigV4 query-string authenticated URL. header lists extra
+// headers the client must send with the request.
+func (s *S3Storage) presign(method string, u *url.URL, header http.Header, expires time.Duration, now time.Time) string {
+	now = now.UTC()
+	scope := s.scope(now)
+	signedHeaders, canonicalHeaders := s3CanonicalHeaders(u.Host, header)
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.cfg.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.Format(s3DateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+
+	canonicalQuery := s3CanonicalQuery(query)
+	canonicalRequest := strings.Join([]string{
+		method,
+		s3EncodePath(u.Path),
+		canonicalQuery,
+		canonicalHeaders,
+		signedHeaders,
+		s3UnsignedBody,
+	}, "\n")
+
+	signed := *u
+	signed.RawQuery = canonicalQuery + "&X-Amz-Signature=" + s.signature(now, scope, canonicalRequest)
+	return signed.String()
+}
+
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.cfg.Region + "/" + s3Service + "/aws4_request"
+}
+
+func (s *S3Storage) signature(now time.Time, scope, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3DateFormat),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := s3HMAC([]byte("AWS4"+s.cfg.SecretAccessKey), now.Format("20060102"))
+	key = s3HMAC(key, s.cfg.Region)
+	key = s3HMAC(key, s3Service)
+	key = s3HMAC(key, "aws4_request")
+
+	return hex.EncodeToString(s3HMAC(key, stringToSign))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalHeaders returns the signed header list and the canonical header
+// block for the host plus the given headers.
+func s3CanonicalHeaders(host string, header http.Header) (string, string) {
+	values := map[string]string{"host": host}
+	for name, vals := range header {
+		values[strings.ToLower(name)] = strings.TrimSpace(strings.Join(vals, ","))
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	return strings.Join(names, ";"), canonical.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		vals := append([]string(nil), query[key]...)
+		sort.Strings(vals)
+		for _, val := range vals {
+			parts = append(parts, s3Encode(key, true)+"="+s3Encode(val, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3EncodePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return s3Encode(path, false)
+}
+
+// s3Encode percent-encodes everything except RFC 3986 unreserved characters,
+// as SigV4 requires. Slashes are kept when encoding paths.
+func s3Encode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3ResponseError(op string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, s3MaxErrorBytes))
+	return fmt.Errorf("s3 %s: %s: %s", op, resp.Status, strings.TrimSpace(string(body)))
+}
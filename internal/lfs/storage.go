@@ -3,6 +3,7 @@ package lfs
 import (
 	"context"
 	"io"
+	"time"
 )
 
 type Storage interface {
@@ -12,3 +13,26 @@ type Storage interface {
 	Delete(ctx context.Context, repoID, oid string) error
 	Size(ctx context.Context, repoID, oid string) (int64, error)
 }
+
+// Presigner is implemented by storages that can hand out time-limited URLs,
+// letting clients transfer objects directly instead of through the server.
+type Presigner interface {
+	PresignGet(repoID, oid string, expires time.Duration) (string, error)
+	// PresignPut also returns headers the client must send with the upload.
+	// The URL only accepts an upload of exactly size bytes.
+	PresignPut(repoID, oid string, size int64, expires time.Duration) (string, map[string]string, error)
+}
+
+// StoredObject describes an object found by walking a storage.
+type StoredObject struct {
+	RepoID  string
+	OID     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Walker is implemented by storages that can enumerate their objects, which
+// lets garbage collection find objects left behind by deleted repos.
+type Walker interface {
+	Walk(ctx context.Context, fn func(StoredObject) error) error
+}
@@ -55,3 +55,49 @@ type VerifyRequest struct {
 	OID  string `json:"oid"`
 	Size int64  `json:"size"`
 }
+
+// Git LFS File Locking API types per https://github.com/git-lfs/git-lfs/blob/main/docs/api/locking.md
+
+type LockOwner struct {
+	Name string `json:"name"`
+}
+
+type Lock struct {
+	ID       string     `json:"id"`
+	Path     string     `json:"path"`
+	LockedAt time.Time  `json:"locked_at"`
+	Owner    *LockOwner `json:"owner,omitempty"`
+}
+
+type CreateLockRequest struct {
+	Path string `json:"path"`
+	Ref  *Ref   `json:"ref,omitempty"`
+}
+
+// LockResponse is returned by create and unlock. Message is set on conflicts.
+type LockResponse struct {
+	Lock    *Lock  `json:"lock,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type LockListResponse struct {
+	Locks      []Lock `json:"locks"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type VerifyLocksRequest struct {
+	Ref    *Ref   `json:"ref,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+type VerifyLocksResponse struct {
+	Ours       []Lock `json:"ours"`
+	Theirs     []Lock `json:"theirs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type UnlockRequest struct {
+	Force bool `json:"force,omitempty"`
+	Ref   *Ref `json:"ref,omitempty"`
+}
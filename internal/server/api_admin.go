@@ -2,7 +2,7 @@ package server
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -158,9 +158,11 @@ type adminTokenResponse struct {
 	ID              string                      `json:"id"`
 	IsAdmin         bool                        `json:"is_admin"`
 	UserID          *string                     `json:"user_id,omitempty"`
+	Name            *string                     `json:"name,omitempty"`
 	CreatedAt       time.Time                   `json:"created_at"`
 	ExpiresAt       *time.Time                  `json:"expires_at,omitempty"`
 	LastUsedAt      *time.Time                  `json:"last_used_at,omitempty"`
+	Scope           *tokenScopeAPI              `json:"scope,omitempty"`
 	NamespaceGrants []namespaceGrantAPIResponse `json:"namespace_grants,omitempty"`
 	RepoGrants      []repoGrantAPIResponse      `json:"repo_grants,omitempty"`
 }
@@ -182,9 +184,11 @@ func (s *Server) adminTokenToResponse(t store.Token) adminTokenResponse {
 		ID:         t.ID,
 		IsAdmin:    t.IsAdmin,
 		UserID:     t.UserID,
+		Name:       t.Name,
 		CreatedAt:  t.CreatedAt,
 		ExpiresAt:  t.ExpiresAt,
 		LastUsedAt: t.LastUsedAt,
+		Scope:      tokenScopeToAPI(t.Scope),
 	}
 
 	if t.IsAdmin || t.UserID == nil {
@@ -355,32 +359,42 @@ func (s *Server) handleAdminCreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, err := s.createUser(req.NamespaceID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+
+	JSON(w, http.StatusCreated, userToResponse(*user))
+}
+
+// createUser creates a user owning the given primary namespace, with the
+// default grant on it.
+func (s *Server) createUser(namespaceID string) (*store.User, error) {
 	now := time.Now()
 	user := &store.User{
 		ID:                 uuid.New().String(),
-		PrimaryNamespaceID: req.NamespaceID,
+		PrimaryNamespaceID: namespaceID,
 		CreatedAt:          now,
 		UpdatedAt:          now,
 	}
 
 	if err := s.store.CreateUser(user); err != nil {
-		JSONError(w, http.StatusInternalServerError, "Failed to create user")
-		return
+		return nil, fmt.Errorf("create user: %w", err)
 	}
 
 	grant := &store.NamespaceGrant{
 		UserID:      user.ID,
-		NamespaceID: req.NamespaceID,
+		NamespaceID: namespaceID,
 		AllowBits:   store.DefaultNamespaceGrant(),
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
 	if err := s.store.UpsertNamespaceGrant(grant); err != nil {
-		JSONError(w, http.StatusInternalServerError, "Failed to create grant")
-		return
+		return nil, fmt.Errorf("create grant: %w", err)
 	}
 
-	JSON(w, http.StatusCreated, userToResponse(*user))
+	return user, nil
 }
 
 func (s *Server) handleAdminGetUser(w http.ResponseWriter, r *http.Request) {
@@ -438,10 +452,6 @@ func (s *Server) handleAdminListUserTokens(w http.ResponseWriter, r *http.Reques
 	JSON(w, http.StatusOK, resp)
 }
 
-type adminCreateUserTokenRequest struct {
-	ExpiresIn *int `json:"expires_in_seconds,omitempty"`
-}
-
 type adminCreateUserTokenResponse struct {
 	Token    string             `json:"token"`
 	Metadata adminTokenResponse `json:"metadata"`
@@ -457,30 +467,8 @@ func (s *Server) handleAdminCreateUserToken(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	var req adminCreateUserTokenRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err.Error() != "EOF" {
-		JSONError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	if req.ExpiresIn != nil && *req.ExpiresIn < 0 {
-		JSONError(w, http.StatusBadRequest, "expires_in_seconds cannot be negative")
-		return
-	}
-
-	var expiresAt *time.Time
-	if req.ExpiresIn != nil {
-		exp := time.Now().Add(time.Duration(*req.ExpiresIn) * time.Second)
-		expiresAt = &exp
-	}
-
-	rawToken, token, err := s.store.GenerateUserToken(user.ID, expiresAt)
-	if err != nil {
-		if errors.Is(err, store.ErrTokenLookupCollision) {
-			JSONError(w, http.StatusInternalServerError, "Failed to create token after retries")
-			return
-		}
-		JSONError(w, http.StatusInternalServerError, "Failed to create token")
+	rawToken, token := s.generateTokenForUser(w, r, user.ID)
+	if token == nil {
 		return
 	}
 
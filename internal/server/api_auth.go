@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"net/http"
 	"time"
 
@@ -23,6 +24,7 @@ func generateSessionID() (string, error) {
 
 // AuthConfigResponse describes available authentication methods.
 // Standalone servers return auth_method="token".
+// Servers with OIDC login return auth_method="web" with auth_endpoint.
 // Platform-managed servers return auth_method="web" with server_url and auth_endpoint.
 type AuthConfigResponse struct {
 	AuthMethod   string `json:"auth_method"`
@@ -32,17 +34,25 @@ type AuthConfigResponse struct {
 
 func (s *Server) handleAuthConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(AuthConfigResponse{AuthMethod: "token"})
+	resp := AuthConfigResponse{AuthMethod: "token"}
+	if s.oidc != nil {
+		resp = AuthConfigResponse{AuthMethod: "web", AuthEndpoint: s.oidc.loginURL()}
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
+// createAuthSessionRequest creates an auth session. Device sessions get a
+// user code that a logged-in user approves.
 type createAuthSessionRequest struct {
-	ExpiresInSeconds int `json:"expires_in_seconds"`
+	ExpiresInSeconds int  `json:"expires_in_seconds"`
+	Device           bool `json:"device"`
 }
 
 type authSessionResponse struct {
 	ID        string    `json:"id"`
 	Status    string    `json:"status"`
 	Token     string    `json:"token,omitempty"`
+	UserCode  string    `json:"user_code,omitempty"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
@@ -72,16 +82,26 @@ func (s *Server) handleCreateAuthSession(w http.ResponseWriter, r *http.Request)
 		ExpiresAt: now.Add(time.Duration(expiresIn) * time.Second),
 	}
 
-	if err := s.store.CreateAuthSession(session); err != nil {
+	if req.Device {
+		err = s.createDeviceSession(session)
+	} else {
+		err = s.store.CreateAuthSession(session)
+	}
+	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to create auth session")
 		return
 	}
 
-	JSON(w, http.StatusCreated, authSessionResponse{
+	resp := authSessionResponse{
 		ID:        session.ID,
 		Status:    session.Status,
 		ExpiresAt: session.ExpiresAt,
-	})
+	}
+	if session.UserCode != nil {
+		resp.UserCode = formatUserCode(*session.UserCode)
+	}
+
+	JSON(w, http.StatusCreated, resp)
 }
 
 func (s *Server) handleGetAuthSession(w http.ResponseWriter, r *http.Request) {
@@ -168,7 +188,7 @@ func (s *Server) handleCompleteAuthSession(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	rawToken, _, err := s.store.GenerateUserToken(req.UserID, nil)
+	rawToken, _, err := s.store.GenerateUserToken(req.UserID, nil, nil, nil)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to generate token")
 		return
@@ -185,3 +205,20 @@ func (s *Server) handleCompleteAuthSession(w http.ResponseWriter, r *http.Reques
 		ExpiresAt: session.ExpiresAt,
 	})
 }
+
+var authPage = template.Must(template.New("auth").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}} - Ephemeral</title></head>
+<body style="font-family: sans-serif; max-width: 32em; margin: 4em auto">
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`))
+
+// renderAuthPage renders the result of a browser login step.
+func renderAuthPage(w http.ResponseWriter, status int, title, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	authPage.Execute(w, struct{ Title, Message string }{title, message})
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"container/heap"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// maxCommitSearchScan bounds how many commits of each repo a namespace commit
+// search walks.
+const maxCommitSearchScan = 10000
+
+// CommitSearchResult is a commit found by a namespace commit search.
+type CommitSearchResult struct {
+	RepoID string `json:"repo_id"`
+	Repo   string `json:"repo"`
+	CommitResponse
+}
+
+// commitFilter narrows commit listings by author, commit date and message.
+type commitFilter struct {
+	// author matches the author or committer email, ignoring case.
+	author string
+	since  *time.Time
+	until  *time.Time
+	grep   *regexp.Regexp
+}
+
+// parseCommitFilter reads the author, since, until and grep query parameters.
+// It returns an error message suitable for a 400 response if they are invalid.
+func parseCommitFilter(query url.Values) (*commitFilter, string) {
+	filter := &commitFilter{author: strings.TrimSpace(query.Get("author"))}
+
+	if v := query.Get("since"); v != "" {
+		since, ok := parseCommitTime(v, false)
+		if !ok {
+			return nil, "Invalid since: use RFC 3339 or YYYY-MM-DD"
+		}
+		filter.since = &since
+	}
+
+	if v := query.Get("until"); v != "" {
+		until, ok := parseCommitTime(v, true)
+		if !ok {
+			return nil, "Invalid until: use RFC 3339 or YYYY-MM-DD"
+		}
+		filter.until = &until
+	}
+
+	if filter.since != nil && filter.until != nil && filter.until.Before(*filter.since) {
+		return nil, "until must not be before since"
+	}
+
+	if v := query.Get("grep"); v != "" {
+		if len(v) > maxSearchQueryLength {
+			return nil, "grep is too long"
+		}
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, "Invalid grep: " + err.Error()
+		}
+		filter.grep = re
+	}
+
+	return filter, ""
+}
+
+// parseCommitTime parses an RFC 3339 timestamp or a UTC date. A date used as
+// an upper bound covers the whole day.
+func parseCommitTime(value string, endOfDay bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, true
+}
+
+// match reports whether a commit passes every filter. Dates are compared
+// against the commit date, like git log --since and --until.
+func (f *commitFilter) match(commit *object.Commit) bool {
+	if f.author != "" &&
+		!strings.EqualFold(commit.Author.Email, f.author) &&
+		!strings.EqualFold(commit.Committer.Email, f.author) {
+		return false
+	}
+	if f.since != nil && commit.Committer.When.Before(*f.since) {
+		return false
+	}
+	if f.until != nil && commit.Committer.When.After(*f.until) {
+		return false
+	}
+	if f.grep != nil && !f.grep.MatchString(commit.Message) {
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleSearchNamespaceCommits(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, errMsg := parseCommitFilter(query)
+	if errMsg != "" {
+		JSONError(w, http.StatusBadRequest, errMsg)
+		return
+	}
+
+	offset := 0
+	if cursor := query.Get("cursor"); cursor != "" {
+		n, err := strconv.Atoi(cursor)
+		if err != nil || n < 0 {
+			JSONError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		offset = n
+	}
+	limit := parseLimit(query.Get("limit"), defaultPageSize)
+
+	token := GetTokenFromContext(r.Context())
+	if token != nil && token.IsAdmin {
+		JSONError(w, http.StatusForbidden, "Admin token cannot be used for this operation")
+		return
+	}
+
+	ns := s.resolveSearchNamespace(w, token, chi.URLParam(r, "name"))
+	if ns == nil {
+		return
+	}
+
+	repos, ok := s.searchableRepos(w, token, ns, "")
+	if !ok {
+		return
+	}
+
+	// Each repo contributes at most the number of commits needed to fill the
+	// requested page of the merged, newest-first results.
+	need := offset + limit + 1
+
+	var results []CommitSearchResult
+	var dates []time.Time
+	for _, repo := range repos {
+		gitRepo, err := s.openGitRepo(repo.NamespaceID, repo.Name)
+		if err != nil {
+			continue
+		}
+
+		commits, err := searchCommits(gitRepo, filter, need)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to search commits")
+			return
+		}
+
+		for _, commit := range commits {
+			results = append(results, CommitSearchResult{
+				RepoID:         repo.ID,
+				Repo:           repo.Name,
+				CommitResponse: commitToResponse(commit),
+			})
+			dates = append(dates, commit.Committer.When)
+		}
+	}
+
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if !dates[a].Equal(dates[b]) {
+			return dates[a].After(dates[b])
+		}
+		if results[a].Repo != results[b].Repo {
+			return results[a].Repo < results[b].Repo
+		}
+		return results[a].SHA < results[b].SHA
+	})
+
+	page := []CommitSearchResult{}
+	for _, i := range order[min(offset, len(order)):] {
+		page = append(page, results[i])
+	}
+
+	var nextCursor *string
+	hasMore := len(page) > limit
+	if hasMore {
+		page = page[:limit]
+		c := strconv.Itoa(offset + limit)
+		nextCursor = &c
+	}
+
+	JSONList(w, page, nextCursor, hasMore)
+}
+
+// searchCommits walks every branch of a repo newest first by commit date and
+// returns up to max commits that match the filter.
+func searchCommits(gitRepo *git.Repository, filter *commitFilter, max int) ([]*object.Commit, error) {
+	branches, err := gitRepo.Branches()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	queue := &commitQueue{}
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		if seen[ref.Hash()] {
+			return nil
+		}
+		commit, err := gitRepo.CommitObject(ref.Hash())
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		seen[commit.Hash] = true
+		heap.Push(queue, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*object.Commit
+	for scanned := 0; queue.Len() > 0 && scanned < maxCommitSearchScan; scanned++ {
+		commit := heap.Pop(queue).(*object.Commit)
+
+		// Everything left in the queue is older, so nothing more can match.
+		if filter.since != nil && commit.Committer.When.Before(*filter.since) {
+			break
+		}
+
+		if filter.match(commit) {
+			matches = append(matches, commit)
+			if len(matches) >= max {
+				break
+			}
+		}
+
+		for _, parentHash := range commit.ParentHashes {
+			if seen[parentHash] {
+				continue
+			}
+			seen[parentHash] = true
+			parent, err := gitRepo.CommitObject(parentHash)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			heap.Push(queue, parent)
+		}
+	}
+
+	return matches, nil
+}
+
+// commitQueue is a max-heap of commits ordered by commit date.
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int { return len(q) }
+
+func (q commitQueue) Less(i, j int) bool {
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *commitQueue) Push(x any) { *q = append(*q, x.(*object.Commit)) }
+
+func (q *commitQueue) Pop() any {
+	old := *q
+	n := len(old)
+	commit := old[n-1]
+	*q = old[:n-1]
+	return commit
+}
@@ -337,6 +337,12 @@ func (s *Server) handleListCommits(w http.ResponseWriter, r *http.Request) {
 	pathQuery := strings.TrimPrefix(r.URL.Query().Get("path"), "/")
 	limit := parseLimit(r.URL.Query().Get("limit"), defaultPageSize)
 
+	filter, errMsg := parseCommitFilter(r.URL.Query())
+	if errMsg != "" {
+		JSONError(w, http.StatusBadRequest, errMsg)
+		return
+	}
+
 	commit, hash, ok := s.loadCommitFromRef(w, gitRepo, refStr)
 	if !ok {
 		return
@@ -396,7 +402,12 @@ func (s *Server) handleListCommits(w http.ResponseWriter, r *http.Request) {
 
 	var commits []CommitResponse
 
-	for i := 0; i <= limit; i++ {
+	// A filter that rarely matches would otherwise walk the whole history in
+	// one request, so the scan stops after maxCommitSearchScan commits and the
+	// page ends at the last commit scanned.
+	var lastScanned string
+	scanned := 0
+	for len(commits) <= limit && scanned < maxCommitSearchScan {
 		commit, err := commitIter.Next()
 		if err == io.EOF {
 			break
@@ -405,16 +416,25 @@ func (s *Server) handleListCommits(w http.ResponseWriter, r *http.Request) {
 			JSONError(w, http.StatusInternalServerError, "Failed to iterate commits")
 			return
 		}
+		scanned++
+		lastScanned = commit.Hash.String()
 
+		if !filter.match(commit) {
+			continue
+		}
 		commits = append(commits, commitToResponse(commit))
 	}
 
 	hasMore := len(commits) > limit
 
+	// The cursor is the last commit returned; the next page starts after it.
 	var nextCursor *string
 	if hasMore {
-		nextCursor = &commits[limit].SHA
 		commits = commits[:limit]
+		nextCursor = &commits[limit-1].SHA
+	} else if scanned == maxCommitSearchScan {
+		hasMore = true
+		nextCursor = &lastScanned
 	}
 
 	JSONList(w, commits, nextCursor, hasMore)
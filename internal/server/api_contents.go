@@ -0,0 +1,428 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// maxContentsRequestSize caps the body of a contents API request, including
+// base64-encoded content.
+const maxContentsRequestSize = 32 << 20
+
+// Actions for files in a multi-file commit.
+const (
+	fileActionPut    = "put"
+	fileActionDelete = "delete"
+)
+
+// contentCommitRequest holds the commit options shared by contents API requests.
+type contentCommitRequest struct {
+	Branch    string          `json:"branch,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	ParentSHA string          `json:"parent_sha,omitempty"`
+	Author    *commitIdentity `json:"author,omitempty"`
+}
+
+type contentFileRequest struct {
+	Path     string  `json:"path,omitempty"`
+	Action   string  `json:"action,omitempty"`
+	Content  *string `json:"content,omitempty"`
+	Encoding string  `json:"encoding,omitempty"`
+	SHA      *string `json:"sha,omitempty"`
+}
+
+type putContentRequest struct {
+	contentCommitRequest
+	contentFileRequest
+}
+
+type commitFilesRequest struct {
+	contentCommitRequest
+	Files []contentFileRequest `json:"files"`
+}
+
+type contentFileResponse struct {
+	Path string `json:"path"`
+	// Action is created, updated or deleted.
+	Action string `json:"action"`
+	SHA    string `json:"sha,omitempty"`
+	Size   int64  `json:"size"`
+}
+
+type contentCommitResponse struct {
+	Branch string                `json:"branch"`
+	Commit CommitResponse        `json:"commit"`
+	Files  []contentFileResponse `json:"files"`
+}
+
+// decodeContentRequest reads a contents API request body. An empty body is
+// allowed for deletes.
+func decodeContentRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxContentsRequestSize)
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil || (errors.Is(err, io.EOF) && r.Method == http.MethodDelete) {
+		return true
+	}
+
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		JSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must be at most %d bytes", maxContentsRequestSize))
+		return false
+	}
+	JSONError(w, http.StatusBadRequest, "Invalid request body")
+	return false
+}
+
+// parseFileChange validates a file from a request. It returns an error
+// message if the file is invalid.
+func parseFileChange(f contentFileRequest) (fileChange, string) {
+	p := normalizeContentPath(f.Path)
+	if p == "" {
+		if strings.TrimSpace(f.Path) == "" {
+			return fileChange{}, "path is required"
+		}
+		return fileChange{}, fmt.Sprintf("Invalid path: %s", f.Path)
+	}
+
+	change := fileChange{Path: p}
+	if f.SHA != nil {
+		sha := strings.TrimSpace(*f.SHA)
+		change.ExpectedSHA = &sha
+	}
+
+	switch f.Action {
+	case fileActionDelete:
+		change.Delete = true
+		return change, ""
+	case "", fileActionPut:
+	default:
+		return fileChange{}, "action must be put or delete"
+	}
+
+	if f.Content == nil {
+		return fileChange{}, fmt.Sprintf("content is required for %s", p)
+	}
+
+	switch f.Encoding {
+	case "", "utf-8":
+		change.Content = []byte(*f.Content)
+	case "base64":
+		content, err := base64.StdEncoding.DecodeString(*f.Content)
+		if err != nil {
+			return fileChange{}, fmt.Sprintf("content of %s is not valid base64", p)
+		}
+		change.Content = content
+	default:
+		return fileChange{}, "encoding must be utf-8 or base64"
+	}
+
+	return change, ""
+}
+
+func (s *Server) handlePutContent(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil || rejectMirrorWrite(w, repo) {
+		return
+	}
+
+	var req putContentRequest
+	if !decodeContentRequest(w, r, &req) {
+		return
+	}
+
+	req.Path = chi.URLParam(r, "*")
+	req.Action = fileActionPut
+	change, msg := parseFileChange(req.contentFileRequest)
+	if msg != "" {
+		JSONError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	s.commitFileChanges(w, r, token, repo, req.contentCommitRequest, []fileChange{change})
+}
+
+func (s *Server) handleDeleteContent(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil || rejectMirrorWrite(w, repo) {
+		return
+	}
+
+	var req putContentRequest
+	if !decodeContentRequest(w, r, &req) {
+		return
+	}
+
+	req.Path = chi.URLParam(r, "*")
+	req.Action = fileActionDelete
+	change, msg := parseFileChange(req.contentFileRequest)
+	if msg != "" {
+		JSONError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	s.commitFileChanges(w, r, token, repo, req.contentCommitRequest, []fileChange{change})
+}
+
+// handleCommitFiles writes and deletes several files in one commit.
+func (s *Server) handleCommitFiles(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil || rejectMirrorWrite(w, repo) {
+		return
+	}
+
+	var req commitFilesRequest
+	if !decodeContentRequest(w, r, &req) {
+		return
+	}
+
+	if len(req.Files) == 0 {
+		JSONError(w, http.StatusBadRequest, "files is required")
+		return
+	}
+	if len(req.Files) > 1 && strings.TrimSpace(req.Message) == "" {
+		JSONError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+
+	changes := make([]fileChange, 0, len(req.Files))
+	seen := make(map[string]bool, len(req.Files))
+	for _, f := range req.Files {
+		change, msg := parseFileChange(f)
+		if msg != "" {
+			JSONError(w, http.StatusBadRequest, msg)
+			return
+		}
+		if seen[change.Path] {
+			JSONError(w, http.StatusBadRequest, fmt.Sprintf("%s is listed more than once", change.Path))
+			return
+		}
+		seen[change.Path] = true
+		changes = append(changes, change)
+	}
+
+	s.commitFileChanges(w, r, token, repo, req.contentCommitRequest, changes)
+}
+
+// commitFileChanges commits changes on top of a branch and moves the branch
+// to the new commit, as a push of that commit would.
+func (s *Server) commitFileChanges(w http.ResponseWriter, r *http.Request, token *store.Token, repo *store.Repo, req contentCommitRequest, changes []fileChange) {
+	if req.Author != nil {
+		if msg := validateCommitIdentity(req.Author); msg != "" {
+			JSONError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	gitRepo, ok := s.openGitRepoForRepo(w, repo)
+	if !ok {
+		return
+	}
+
+	repoPath, err := SafeRepoPath(s.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to resolve repo path")
+		return
+	}
+
+	branch := req.Branch
+	if branch == "" {
+		if branch, err = defaultBranchName(gitRepo); err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get default branch")
+			return
+		}
+		if branch == "" {
+			JSONError(w, http.StatusBadRequest, "branch is required")
+			return
+		}
+	}
+	if branch, err = validateBranchName(branch); err != nil {
+		JSONError(w, http.StatusBadRequest, "branch: "+err.Error())
+		return
+	}
+
+	head, err := branchHead(gitRepo, branch)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get branch")
+		return
+	}
+
+	// A repo with no branches yet gets a root commit on the branch.
+	var tree *object.Tree
+	if head == "" {
+		hasBranches, err := repoHasBranches(gitRepo)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to list branches")
+			return
+		}
+		if hasBranches || req.ParentSHA != "" {
+			JSONError(w, http.StatusNotFound, "Branch not found: "+branch)
+			return
+		}
+	} else {
+		if req.ParentSHA != "" && req.ParentSHA != head {
+			writeContentError(w, &contentError{Code: contentCodeRefMoved, Message: fmt.Sprintf("%s has moved: expected %s, found %s", branch, req.ParentSHA, head)})
+			return
+		}
+
+		commit, err := gitRepo.CommitObject(plumbing.NewHash(head))
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to load commit")
+			return
+		}
+		if tree, err = commit.Tree(); err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get tree")
+			return
+		}
+	}
+
+	if err := checkFileChanges(tree, changes); err != nil {
+		writeContentError(w, err)
+		return
+	}
+
+	// Everything that can reject the commit is checked before its objects
+	// are written. updateBranch checks protection again under the ref update.
+	paths := make([]string, len(changes))
+	for i, c := range changes {
+		paths[i] = c.Path
+	}
+	if err := s.checkProtectedCommit(token, repo, plumbing.NewBranchReferenceName(branch).String(), paths); err != nil {
+		writeProtectionError(w, err)
+		return
+	}
+
+	var size int64
+	for _, c := range changes {
+		size += int64(len(c.Content))
+	}
+	if err := checkStorageQuota(s.store, repo.NamespaceID, size); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		message = defaultContentMessage(changes[0])
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), gitCommandTimeout)
+	defer cancel()
+
+	newTree, blobs, err := writeFileChanges(ctx, repoPath, head, changes)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to write files")
+		return
+	}
+	if tree != nil && newTree == tree.Hash.String() {
+		JSONError(w, http.StatusConflict, "No changes to commit")
+		return
+	}
+
+	committer, err := s.userSignature(r, *token.UserID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+	author := committer
+	if req.Author != nil {
+		author = object.Signature{Name: req.Author.Name, Email: req.Author.Email}
+	}
+
+	var parents []string
+	oldSHA := plumbing.ZeroHash.String()
+	if head != "" {
+		parents = []string{head}
+		oldSHA = head
+	}
+
+	commitSHA, err := gitCommitTree(ctx, repoPath, newTree, parents, message, author, committer)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to create commit")
+		return
+	}
+
+	if !s.updateBranch(ctx, w, token, repo, repoPath, branch, oldSHA, commitSHA) {
+		return
+	}
+
+	commit, err := gitRepo.CommitObject(plumbing.NewHash(commitSHA))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to load commit")
+		return
+	}
+
+	resp := contentCommitResponse{
+		Branch: branch,
+		Commit: commitToResponse(commit),
+		Files:  make([]contentFileResponse, len(changes)),
+	}
+	for i, c := range changes {
+		file := contentFileResponse{Path: c.Path, Action: "updated", SHA: blobs[i], Size: int64(len(c.Content))}
+		switch {
+		case c.Delete:
+			file.Action = "deleted"
+		case !c.Exists:
+			file.Action = "created"
+		}
+		resp.Files[i] = file
+	}
+
+	JSON(w, http.StatusCreated, resp)
+}
+
+// defaultContentMessage describes a single file change.
+func defaultContentMessage(c fileChange) string {
+	switch {
+	case c.Delete:
+		return "Delete " + c.Path
+	case c.Exists:
+		return "Update " + c.Path
+	default:
+		return "Create " + c.Path
+	}
+}
+
+// repoHasBranches reports whether the repo has any branches.
+func repoHasBranches(gitRepo *git.Repository) (bool, error) {
+	iter, err := gitRepo.Branches()
+	if err != nil {
+		return false, err
+	}
+	defer iter.Close()
+
+	found := false
+	err = iter.ForEach(func(*plumbing.Reference) error {
+		found = true
+		return storer.ErrStop
+	})
+	return found, err
+}
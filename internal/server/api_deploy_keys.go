@@ -0,0 +1,154 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// createDeployKeyRequest creates an SSH deploy key when PublicKey is set and a
+// token deploy key otherwise. ReadOnly defaults to true.
+type createDeployKeyRequest struct {
+	Name      *string `json:"name,omitempty"`
+	ReadOnly  *bool   `json:"read_only,omitempty"`
+	PublicKey *string `json:"public_key,omitempty"`
+}
+
+// createDeployKeyResponse returns a new deploy key. Token is only set for
+// token deploy keys and can't be retrieved again.
+type createDeployKeyResponse struct {
+	Token    string          `json:"token,omitempty"`
+	Metadata store.DeployKey `json:"metadata"`
+}
+
+func (s *Server) handleListDeployKeys(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	keys, err := s.store.ListRepoDeployKeys(repo.ID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list deploy keys")
+		return
+	}
+
+	if keys == nil {
+		keys = []store.DeployKey{}
+	}
+
+	JSON(w, http.StatusOK, keys)
+}
+
+func (s *Server) handleCreateDeployKey(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	var req createDeployKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	key := &store.DeployKey{
+		RepoID:    repo.ID,
+		ReadOnly:  req.ReadOnly == nil || *req.ReadOnly,
+		CreatedBy: token.UserID,
+		CreatedAt: time.Now(),
+	}
+
+	name := req.Name
+	if req.PublicKey != nil {
+		parsed, err := parseSSHPublicKey("", name, *req.PublicKey)
+		if err != nil {
+			JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		key.ID = uuid.New().String()
+		key.KeyType = &parsed.KeyType
+		key.Fingerprint = &parsed.Fingerprint
+		key.PublicKey = &parsed.PublicKey
+		name = parsed.Name
+	}
+
+	if name == nil || strings.TrimSpace(*name) == "" {
+		JSONError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	key.Name = strings.TrimSpace(*name)
+
+	var rawToken string
+	var err error
+	if key.PublicKey != nil {
+		err = s.store.CreateDeployKey(key)
+	} else {
+		rawToken, err = s.store.GenerateDeployKeyToken(key)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateSSHKey):
+			JSONError(w, http.StatusConflict, "SSH key already registered")
+		case errors.Is(err, store.ErrTokenLookupCollision):
+			JSONError(w, http.StatusInternalServerError, "Failed to create deploy key after retries")
+		default:
+			JSONError(w, http.StatusInternalServerError, "Failed to create deploy key")
+		}
+		return
+	}
+
+	JSON(w, http.StatusCreated, createDeployKeyResponse{Token: rawToken, Metadata: *key})
+}
+
+func (s *Server) handleDeleteDeployKey(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	key, err := s.store.GetDeployKey(chi.URLParam(r, "keyID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get deploy key")
+		return
+	}
+	if key == nil || key.RepoID != repo.ID {
+		JSONError(w, http.StatusNotFound, "Deploy key not found")
+		return
+	}
+
+	if err := s.store.DeleteDeployKey(key.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			JSONError(w, http.StatusNotFound, "Deploy key not found")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to delete deploy key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+func (s *Server) handleListPushEvents(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccess(w, r, token)
+	if repo == nil {
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	limit := parseLimit(r.URL.Query().Get("limit"), defaultPageSize)
+
+	events, err := s.store.ListRepoPushEvents(repo.ID, cursor, limit+1)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list push events")
+		return
+	}
+
+	events, nextCursor, hasMore := paginateSlice(events, limit, func(e store.PushEvent) string {
+		return e.ID
+	})
+
+	if events == nil {
+		events = []store.PushEvent{}
+	}
+
+	JSONList(w, events, nextCursor, hasMore)
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/bantamhq/ephemeral/internal/store"
 )
 
 type DiffResponse struct {
@@ -23,6 +25,8 @@ type DiffResponse struct {
 	HeadSHA string      `json:"head_sha"`
 	Stats   CommitStats `json:"stats"`
 	Patch   string      `json:"patch"`
+	// ReviewThreads are the review threads on this diff.
+	ReviewThreads []store.ReviewThread `json:"review_threads"`
 }
 
 type CompareResponse struct {
@@ -129,6 +133,11 @@ func (s *Server) handleGetCommitDiff(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if resp.ReviewThreads, err = s.listDiffReviewThreads(repo.ID, baseSHA, resp.HeadSHA); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list review threads")
+		return
+	}
+
 	JSON(w, http.StatusOK, resp)
 }
 
@@ -174,19 +183,34 @@ func (s *Server) handleCompareCommits(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	resp, ok := s.compareCommits(w, r, repo.ID, gitRepo, repoPath, *baseHash, *headHash, false)
+	if !ok {
+		return
+	}
+	resp.BaseRef = baseRef
+	resp.HeadRef = headRef
+
+	JSON(w, http.StatusOK, resp)
+}
+
+// compareCommits compares two commits: the commits reachable from head but
+// not from base, paginated by the request's cursor and limit, and the diff
+// between them. With fromMergeBase the diff starts at the merge base, so it
+// shows only the changes made on head.
+func (s *Server) compareCommits(w http.ResponseWriter, r *http.Request, repoID string, gitRepo *git.Repository, repoPath string, baseHash, headHash plumbing.Hash, fromMergeBase bool) (*CompareResponse, bool) {
 	ctx, cancel := context.WithTimeout(r.Context(), gitCommandTimeout)
 	defer cancel()
 
 	mergeBaseSHA, err := gitMergeBase(ctx, repoPath, baseHash.String(), headHash.String())
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to compute merge base")
-		return
+		return nil, false
 	}
 
 	behindBy, aheadBy, err := gitAheadBehind(ctx, repoPath, baseHash.String(), headHash.String())
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to compute ahead/behind")
-		return
+		return nil, false
 	}
 
 	cursor := r.URL.Query().Get("cursor")
@@ -195,7 +219,7 @@ func (s *Server) handleCompareCommits(w http.ResponseWriter, r *http.Request) {
 	commitSHAs, nextCursor, hasMore, err := gitRevList(ctx, repoPath, baseHash.String(), headHash.String(), cursor, limit)
 	if err != nil {
 		JSONError(w, http.StatusBadRequest, err.Error())
-		return
+		return nil, false
 	}
 
 	commits := make([]CommitResponse, 0, len(commitSHAs))
@@ -203,42 +227,50 @@ func (s *Server) handleCompareCommits(w http.ResponseWriter, r *http.Request) {
 		commit, err := gitRepo.CommitObject(plumbing.NewHash(sha))
 		if err != nil {
 			JSONError(w, http.StatusInternalServerError, "Failed to load commit")
-			return
+			return nil, false
 		}
 		commits = append(commits, commitToResponse(commit))
 	}
 
-	baseCommit, err := gitRepo.CommitObject(*baseHash)
+	diffBase := baseHash
+	if fromMergeBase {
+		diffBase = plumbing.NewHash(mergeBaseSHA)
+	}
+
+	baseCommit, err := gitRepo.CommitObject(diffBase)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to get base commit")
-		return
+		return nil, false
 	}
-	headCommit, err := gitRepo.CommitObject(*headHash)
+	headCommit, err := gitRepo.CommitObject(headHash)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to get head commit")
-		return
+		return nil, false
 	}
 
 	baseTree, err := baseCommit.Tree()
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to get base tree")
-		return
+		return nil, false
 	}
 	headTree, err := headCommit.Tree()
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to get head tree")
-		return
+		return nil, false
 	}
 
-	diffResp, err := buildDiffResponse(ctx, baseHash.String(), baseTree, headHash.String(), headTree)
+	diffResp, err := buildDiffResponse(ctx, diffBase.String(), baseTree, headHash.String(), headTree)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to compute diff")
-		return
+		return nil, false
+	}
+
+	if diffResp.ReviewThreads, err = s.listDiffReviewThreads(repoID, diffResp.BaseSHA, diffResp.HeadSHA); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list review threads")
+		return nil, false
 	}
 
-	resp := CompareResponse{
-		BaseRef:      baseRef,
-		HeadRef:      headRef,
+	return &CompareResponse{
 		BaseSHA:      baseHash.String(),
 		HeadSHA:      headHash.String(),
 		MergeBaseSHA: mergeBaseSHA,
@@ -248,9 +280,7 @@ func (s *Server) handleCompareCommits(w http.ResponseWriter, r *http.Request) {
 		NextCursor:   nextCursor,
 		HasMore:      hasMore,
 		Diff:         diffResp,
-	}
-
-	JSON(w, http.StatusOK, resp)
+	}, true
 }
 
 func (s *Server) handleGetBlame(w http.ResponseWriter, r *http.Request) {
@@ -455,10 +485,11 @@ func buildDiffResponse(ctx context.Context, baseSHA string, baseTree *object.Tre
 	}
 
 	return DiffResponse{
-		BaseSHA: baseSHA,
-		HeadSHA: headSHA,
-		Stats:   *stats,
-		Patch:   patch.String(),
+		BaseSHA:       baseSHA,
+		HeadSHA:       headSHA,
+		Stats:         *stats,
+		Patch:         patch.String(),
+		ReviewThreads: []store.ReviewThread{},
 	}, nil
 }
 
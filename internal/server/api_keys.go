@@ -0,0 +1,235 @@
+package server
+
+import (
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for SSH keys.
+const minRSAKeyBits = 2048
+
+// allowedSSHKeyTypes lists the public key algorithms accepted for git over SSH.
+var allowedSSHKeyTypes = map[string]bool{
+	ssh.KeyAlgoED25519:    true,
+	ssh.KeyAlgoSKED25519:  true,
+	ssh.KeyAlgoECDSA256:   true,
+	ssh.KeyAlgoECDSA384:   true,
+	ssh.KeyAlgoECDSA521:   true,
+	ssh.KeyAlgoSKECDSA256: true,
+	ssh.KeyAlgoRSA:        true,
+}
+
+type createSSHKeyRequest struct {
+	Name      *string `json:"name,omitempty"`
+	PublicKey string  `json:"public_key"`
+}
+
+// parseSSHPublicKey validates an authorized_keys formatted key and builds a store record.
+// The key comment is used as the name when no name is given.
+func parseSSHPublicKey(userID string, name *string, raw string) (*store.SSHKey, error) {
+	pubKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key")
+	}
+
+	keyType := pubKey.Type()
+	if !allowedSSHKeyTypes[keyType] {
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+
+	if keyType == ssh.KeyAlgoRSA {
+		cryptoKey, ok := pubKey.(ssh.CryptoPublicKey)
+		if !ok {
+			return nil, fmt.Errorf("invalid public key")
+		}
+		rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey)
+		if !ok || rsaKey.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+		}
+	}
+
+	if name == nil && comment != "" {
+		name = &comment
+	}
+
+	return &store.SSHKey{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Name:        name,
+		KeyType:     keyType,
+		Fingerprint: ssh.FingerprintSHA256(pubKey),
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey))),
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// createSSHKeyForUser decodes, validates and stores a key for the given user.
+func (s *Server) createSSHKeyForUser(w http.ResponseWriter, r *http.Request, userID string) {
+	var req createSSHKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.PublicKey == "" {
+		JSONError(w, http.StatusBadRequest, "public_key is required")
+		return
+	}
+
+	key, err := parseSSHPublicKey(userID, req.Name, req.PublicKey)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.store.CreateSSHKey(key); err != nil {
+		if errors.Is(err, store.ErrDuplicateSSHKey) {
+			JSONError(w, http.StatusConflict, "SSH key already registered")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to create SSH key")
+		return
+	}
+
+	JSON(w, http.StatusCreated, key)
+}
+
+// deleteSSHKeyForUser deletes a key if it belongs to the given user.
+func (s *Server) deleteSSHKeyForUser(w http.ResponseWriter, r *http.Request, userID string) {
+	keyID := chi.URLParam(r, "keyID")
+
+	key, err := s.store.GetSSHKey(keyID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get SSH key")
+		return
+	}
+	if key == nil || key.UserID != userID {
+		JSONError(w, http.StatusNotFound, "SSH key not found")
+		return
+	}
+
+	if err := s.store.DeleteSSHKey(key.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			JSONError(w, http.StatusNotFound, "SSH key not found")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to delete SSH key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listSSHKeysForUser(w http.ResponseWriter, userID string) {
+	keys, err := s.store.ListUserSSHKeys(userID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list SSH keys")
+		return
+	}
+
+	if keys == nil {
+		keys = []store.SSHKey{}
+	}
+
+	JSON(w, http.StatusOK, keys)
+}
+
+// requireTokenUserID returns the user ID bound to a user token or writes an error.
+// Scoped tokens are rejected, since the credentials they would manage carry all
+// of the user's access; what names those credentials in the error.
+func (s *Server) requireTokenUserID(w http.ResponseWriter, r *http.Request, what string) string {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return ""
+	}
+
+	if token.UserID == nil {
+		JSONError(w, http.StatusForbidden, "Token has no associated user")
+		return ""
+	}
+
+	if token.Scope != nil {
+		JSONError(w, http.StatusForbidden, "Scoped tokens cannot manage "+what)
+		return ""
+	}
+
+	return *token.UserID
+}
+
+func (s *Server) handleListUserKeys(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireTokenUserID(w, r, "SSH keys")
+	if userID == "" {
+		return
+	}
+
+	s.listSSHKeysForUser(w, userID)
+}
+
+func (s *Server) handleCreateUserKey(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireTokenUserID(w, r, "SSH keys")
+	if userID == "" {
+		return
+	}
+
+	s.createSSHKeyForUser(w, r, userID)
+}
+
+func (s *Server) handleDeleteUserKey(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireTokenUserID(w, r, "SSH keys")
+	if userID == "" {
+		return
+	}
+
+	s.deleteSSHKeyForUser(w, r, userID)
+}
+
+func (s *Server) handleAdminListUserKeys(w http.ResponseWriter, r *http.Request) {
+	if s.requireAdminToken(w, r) == nil {
+		return
+	}
+
+	user := s.getUserByID(w, r)
+	if user == nil {
+		return
+	}
+
+	s.listSSHKeysForUser(w, user.ID)
+}
+
+func (s *Server) handleAdminCreateUserKey(w http.ResponseWriter, r *http.Request) {
+	if s.requireAdminToken(w, r) == nil {
+		return
+	}
+
+	user := s.getUserByID(w, r)
+	if user == nil {
+		return
+	}
+
+	s.createSSHKeyForUser(w, r, user.ID)
+}
+
+func (s *Server) handleAdminDeleteUserKey(w http.ResponseWriter, r *http.Request) {
+	if s.requireAdminToken(w, r) == nil {
+		return
+	}
+
+	user := s.getUserByID(w, r)
+	if user == nil {
+		return
+	}
+
+	s.deleteSSHKeyForUser(w, r, user.ID)
+}
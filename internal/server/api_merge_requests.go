@@ -0,0 +1,680 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const maxMergeRequestTitleLength = 256
+
+// Merge statuses of an open merge request.
+const (
+	mergeStatusClean         = "clean"
+	mergeStatusConflicts     = "conflicts"
+	mergeStatusUpToDate      = "up_to_date"
+	mergeStatusMissingBranch = "missing_branch"
+	mergeStatusUnrelated     = "unrelated"
+)
+
+type createMergeRequestRequest struct {
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch,omitempty"`
+}
+
+type updateMergeRequestRequest struct {
+	Title        *string `json:"title,omitempty"`
+	Description  *string `json:"description,omitempty"`
+	TargetBranch *string `json:"target_branch,omitempty"`
+	Status       *string `json:"status,omitempty"`
+}
+
+type mergeMergeRequestRequest struct {
+	Strategy string  `json:"strategy,omitempty"`
+	Message  *string `json:"message,omitempty"`
+}
+
+// mergeRequestResponse is a merge request with the live state of its
+// branches, filled in for open merge requests when a single one is fetched.
+type mergeRequestResponse struct {
+	store.MergeRequest
+	AheadBy     *int   `json:"ahead_by,omitempty"`
+	BehindBy    *int   `json:"behind_by,omitempty"`
+	MergeStatus string `json:"merge_status,omitempty"`
+	Mergeable   *bool  `json:"mergeable,omitempty"`
+	// Conflicts lists the files that conflict when merging with a merge commit.
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+func (s *Server) getMergeRequestForRepo(w http.ResponseWriter, r *http.Request, repo *store.Repo) *store.MergeRequest {
+	number, err := strconv.ParseInt(chi.URLParam(r, "number"), 10, 64)
+	if err != nil || number < 1 {
+		JSONError(w, http.StatusNotFound, "Merge request not found")
+		return nil
+	}
+
+	mr, err := s.store.GetMergeRequest(repo.ID, number)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get merge request")
+		return nil
+	}
+	if mr == nil {
+		JSONError(w, http.StatusNotFound, "Merge request not found")
+		return nil
+	}
+	return mr
+}
+
+// branchHead returns the commit a branch points at, or "" if it does not exist.
+func branchHead(gitRepo *git.Repository, branch string) (string, error) {
+	ref, err := gitRepo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return ref.Hash().String(), nil
+}
+
+// defaultBranchName returns the branch HEAD points at, or "" if it is detached.
+func defaultBranchName(gitRepo *git.Repository) (string, error) {
+	head, err := gitRepo.Reference(plumbing.HEAD, false)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", nil
+	}
+	return head.Target().Short(), nil
+}
+
+// validateBranchName normalizes a branch name from a request.
+func validateBranchName(name string) (string, error) {
+	refName, err := buildRefName(refTypeBranch, name)
+	if err != nil {
+		return "", err
+	}
+	return refName.Short(), nil
+}
+
+// describeMergeRequest fills in the live branch heads and mergeability of an
+// open merge request.
+func describeMergeRequest(ctx context.Context, gitRepo *git.Repository, repoPath string, mr *store.MergeRequest) (mergeRequestResponse, error) {
+	resp := mergeRequestResponse{MergeRequest: *mr}
+	if mr.Status != store.MergeRequestOpen {
+		return resp, nil
+	}
+
+	notMergeable := false
+	resp.Mergeable = &notMergeable
+
+	sourceSHA, err := branchHead(gitRepo, mr.SourceBranch)
+	if err != nil {
+		return resp, err
+	}
+	targetSHA, err := branchHead(gitRepo, mr.TargetBranch)
+	if err != nil {
+		return resp, err
+	}
+	if sourceSHA == "" || targetSHA == "" {
+		resp.MergeStatus = mergeStatusMissingBranch
+		return resp, nil
+	}
+	resp.SourceSHA = &sourceSHA
+	resp.TargetSHA = &targetSHA
+
+	behindBy, aheadBy, err := gitAheadBehind(ctx, repoPath, targetSHA, sourceSHA)
+	if err != nil {
+		return resp, err
+	}
+	resp.AheadBy = &aheadBy
+	resp.BehindBy = &behindBy
+	if aheadBy == 0 {
+		resp.MergeStatus = mergeStatusUpToDate
+		return resp, nil
+	}
+
+	_, err = gitMergeTree(ctx, repoPath, targetSHA, sourceSHA)
+	var conflictErr *mergeConflictError
+	switch {
+	case err == nil:
+		mergeable := true
+		resp.Mergeable = &mergeable
+		resp.MergeStatus = mergeStatusClean
+	case errors.As(err, &conflictErr):
+		resp.MergeStatus = mergeStatusConflicts
+		resp.Conflicts = conflictErr.Files
+	case errors.Is(err, errUnrelatedHistories):
+		resp.MergeStatus = mergeStatusUnrelated
+	default:
+		return resp, err
+	}
+	return resp, nil
+}
+
+func (s *Server) writeMergeRequest(w http.ResponseWriter, r *http.Request, status int, repo *store.Repo, mr *store.MergeRequest) {
+	gitRepo, ok := s.openGitRepoForRepo(w, repo)
+	if !ok {
+		return
+	}
+
+	repoPath, err := SafeRepoPath(s.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to resolve repo path")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), gitCommandTimeout)
+	defer cancel()
+
+	resp, err := describeMergeRequest(ctx, gitRepo, repoPath, mr)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to check mergeability")
+		return
+	}
+
+	JSON(w, status, resp)
+}
+
+func (s *Server) handleListMergeRequests(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccess(w, r, token)
+	if repo == nil {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = store.MergeRequestOpen
+	case "all":
+		status = ""
+	case store.MergeRequestOpen, store.MergeRequestMerged, store.MergeRequestClosed:
+	default:
+		JSONError(w, http.StatusBadRequest, "status must be open, merged, closed or all")
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	if cursor != "" {
+		if _, err := strconv.ParseInt(cursor, 10, 64); err != nil {
+			JSONError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+	limit := parseLimit(r.URL.Query().Get("limit"), defaultPageSize)
+
+	mrs, err := s.store.ListMergeRequests(repo.ID, status, cursor, limit+1)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list merge requests")
+		return
+	}
+
+	var nextCursor *string
+	hasMore := len(mrs) > limit
+	if hasMore {
+		mrs = mrs[:limit]
+		c := strconv.FormatInt(mrs[limit-1].Number, 10)
+		nextCursor = &c
+	}
+
+	if mrs == nil {
+		mrs = []store.MergeRequest{}
+	}
+
+	JSONList(w, mrs, nextCursor, hasMore)
+}
+
+func (s *Server) handleCreateMergeRequest(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil {
+		return
+	}
+
+	var req createMergeRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		JSONError(w, http.StatusBadRequest, "title is required")
+		return
+	}
+	if len(title) > maxMergeRequestTitleLength {
+		JSONError(w, http.StatusBadRequest, fmt.Sprintf("title must be at most %d characters", maxMergeRequestTitleLength))
+		return
+	}
+
+	source, err := validateBranchName(req.SourceBranch)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "source_branch: "+err.Error())
+		return
+	}
+
+	gitRepo, ok := s.openGitRepoForRepo(w, repo)
+	if !ok {
+		return
+	}
+
+	target := req.TargetBranch
+	if target == "" {
+		target, err = defaultBranchName(gitRepo)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get default branch")
+			return
+		}
+	}
+	target, err = validateBranchName(target)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "target_branch: "+err.Error())
+		return
+	}
+	if source == target {
+		JSONError(w, http.StatusBadRequest, "Source and target branches must differ")
+		return
+	}
+
+	for _, branch := range []string{source, target} {
+		head, err := branchHead(gitRepo, branch)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get branch")
+			return
+		}
+		if head == "" {
+			JSONError(w, http.StatusNotFound, fmt.Sprintf("Branch not found: %s", branch))
+			return
+		}
+	}
+
+	now := time.Now()
+	mr := &store.MergeRequest{
+		ID:           uuid.New().String(),
+		RepoID:       repo.ID,
+		Title:        title,
+		Description:  req.Description,
+		SourceBranch: source,
+		TargetBranch: target,
+		Status:       store.MergeRequestOpen,
+		AuthorID:     token.UserID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if err := s.store.CreateMergeRequest(mr); err != nil {
+		if errors.Is(err, store.ErrDuplicateMergeRequest) {
+			JSONError(w, http.StatusConflict, "An open merge request already exists for these branches")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to create merge request")
+		return
+	}
+
+	created, err := s.store.GetMergeRequest(repo.ID, mr.Number)
+	if err != nil || created == nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get merge request")
+		return
+	}
+
+	s.writeMergeRequest(w, r, http.StatusCreated, repo, created)
+}
+
+func (s *Server) handleGetMergeRequest(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccess(w, r, token)
+	if repo == nil {
+		return
+	}
+
+	mr := s.getMergeRequestForRepo(w, r, repo)
+	if mr == nil {
+		return
+	}
+
+	s.writeMergeRequest(w, r, http.StatusOK, repo, mr)
+}
+
+func (s *Server) handleUpdateMergeRequest(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil {
+		return
+	}
+
+	mr := s.getMergeRequestForRepo(w, r, repo)
+	if mr == nil {
+		return
+	}
+
+	var req updateMergeRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if mr.Status == store.MergeRequestMerged {
+		JSONError(w, http.StatusConflict, "Merge request is already merged")
+		return
+	}
+
+	gitRepo, ok := s.openGitRepoForRepo(w, repo)
+	if !ok {
+		return
+	}
+
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			JSONError(w, http.StatusBadRequest, "title is required")
+			return
+		}
+		if len(title) > maxMergeRequestTitleLength {
+			JSONError(w, http.StatusBadRequest, fmt.Sprintf("title must be at most %d characters", maxMergeRequestTitleLength))
+			return
+		}
+		mr.Title = title
+	}
+
+	if req.Description != nil {
+		mr.Description = *req.Description
+	}
+
+	if req.TargetBranch != nil {
+		target, err := validateBranchName(*req.TargetBranch)
+		if err != nil {
+			JSONError(w, http.StatusBadRequest, "target_branch: "+err.Error())
+			return
+		}
+		if target == mr.SourceBranch {
+			JSONError(w, http.StatusBadRequest, "Source and target branches must differ")
+			return
+		}
+		head, err := branchHead(gitRepo, target)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get branch")
+			return
+		}
+		if head == "" {
+			JSONError(w, http.StatusNotFound, fmt.Sprintf("Branch not found: %s", target))
+			return
+		}
+		mr.TargetBranch = target
+	}
+
+	now := time.Now()
+	if req.Status != nil && *req.Status != mr.Status {
+		switch *req.Status {
+		case store.MergeRequestClosed:
+			// Record where the branches were so the diff can still be shown.
+			if sha, err := branchHead(gitRepo, mr.SourceBranch); err == nil && sha != "" {
+				mr.SourceSHA = &sha
+			}
+			if sha, err := branchHead(gitRepo, mr.TargetBranch); err == nil && sha != "" {
+				mr.TargetSHA = &sha
+			}
+			mr.Status = store.MergeRequestClosed
+			mr.ClosedAt = &now
+		case store.MergeRequestOpen:
+			mr.Status = store.MergeRequestOpen
+			mr.ClosedAt = nil
+			mr.SourceSHA = nil
+			mr.TargetSHA = nil
+		default:
+			JSONError(w, http.StatusBadRequest, "status must be open or closed")
+			return
+		}
+	}
+	mr.UpdatedAt = now
+
+	if err := s.store.UpdateMergeRequest(mr); err != nil {
+		if errors.Is(err, store.ErrDuplicateMergeRequest) {
+			JSONError(w, http.StatusConflict, "An open merge request already exists for these branches")
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			JSONError(w, http.StatusNotFound, "Merge request not found")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to update merge request")
+		return
+	}
+
+	s.writeMergeRequest(w, r, http.StatusOK, repo, mr)
+}
+
+// handleGetMergeRequestDiff compares the source branch with the target branch.
+// Merged and closed merge requests compare the branch heads recorded then.
+func (s *Server) handleGetMergeRequestDiff(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccess(w, r, token)
+	if repo == nil {
+		return
+	}
+
+	mr := s.getMergeRequestForRepo(w, r, repo)
+	if mr == nil {
+		return
+	}
+
+	gitRepo, ok := s.openGitRepoForRepo(w, repo)
+	if !ok {
+		return
+	}
+
+	var sourceSHA, targetSHA string
+	if mr.Status == store.MergeRequestOpen {
+		var err error
+		if sourceSHA, err = branchHead(gitRepo, mr.SourceBranch); err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get branch")
+			return
+		}
+		if targetSHA, err = branchHead(gitRepo, mr.TargetBranch); err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get branch")
+			return
+		}
+	} else if mr.SourceSHA != nil && mr.TargetSHA != nil {
+		sourceSHA, targetSHA = *mr.SourceSHA, *mr.TargetSHA
+	}
+	if sourceSHA == "" || targetSHA == "" {
+		JSONError(w, http.StatusConflict, "Merge request branches no longer exist")
+		return
+	}
+
+	repoPath, err := SafeRepoPath(s.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to resolve repo path")
+		return
+	}
+
+	resp, ok := s.compareCommits(w, r, repo.ID, gitRepo, repoPath, plumbing.NewHash(targetSHA), plumbing.NewHash(sourceSHA), true)
+	if !ok {
+		return
+	}
+	resp.BaseRef = mr.TargetBranch
+	resp.HeadRef = mr.SourceBranch
+
+	JSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleMergeMergeRequest(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil || rejectMirrorWrite(w, repo) {
+		return
+	}
+
+	mr := s.getMergeRequestForRepo(w, r, repo)
+	if mr == nil {
+		return
+	}
+
+	var req mergeMergeRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	strategy := req.Strategy
+	if strategy == "" {
+		strategy = mergeStrategyMerge
+	}
+	if !isValidMergeStrategy(strategy) {
+		JSONError(w, http.StatusBadRequest, "strategy must be merge, squash or rebase")
+		return
+	}
+
+	if mr.Status != store.MergeRequestOpen {
+		JSONError(w, http.StatusConflict, "Merge request is not open")
+		return
+	}
+
+	gitRepo, ok := s.openGitRepoForRepo(w, repo)
+	if !ok {
+		return
+	}
+
+	repoPath, err := SafeRepoPath(s.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to resolve repo path")
+		return
+	}
+
+	sourceSHA, err := branchHead(gitRepo, mr.SourceBranch)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get branch")
+		return
+	}
+	targetSHA, err := branchHead(gitRepo, mr.TargetBranch)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get branch")
+		return
+	}
+	if sourceSHA == "" || targetSHA == "" {
+		JSONError(w, http.StatusConflict, "Merge request branches no longer exist")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), gitCommandTimeout)
+	defer cancel()
+
+	_, aheadBy, err := gitAheadBehind(ctx, repoPath, targetSHA, sourceSHA)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to compute ahead/behind")
+		return
+	}
+	if aheadBy == 0 {
+		JSONError(w, http.StatusConflict, "Nothing to merge")
+		return
+	}
+
+	committer, err := s.userSignature(r, *token.UserID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+
+	opts := mergeOptions{
+		Strategy:  strategy,
+		BaseSHA:   targetSHA,
+		HeadSHA:   sourceSHA,
+		Message:   defaultMergeRequestMessage(mr, strategy),
+		Author:    committer,
+		Committer: committer,
+	}
+	if req.Message != nil && strings.TrimSpace(*req.Message) != "" {
+		opts.Message = *req.Message
+	}
+	if strategy == mergeStrategySquash {
+		// Credit the squashed work to the author of the branch's last commit.
+		head, err := gitRepo.CommitObject(plumbing.NewHash(sourceSHA))
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to load commit")
+			return
+		}
+		opts.Author = object.Signature{Name: head.Author.Name, Email: head.Author.Email}
+	}
+
+	mergedSHA, err := mergeCommits(ctx, gitRepo, repoPath, opts)
+	if err != nil {
+		writeMergeError(w, err)
+		return
+	}
+
+	if !s.updateBranch(ctx, w, token, repo, repoPath, mr.TargetBranch, targetSHA, mergedSHA) {
+		return
+	}
+
+	now := time.Now()
+	mr.Status = store.MergeRequestMerged
+	mr.SourceSHA = &sourceSHA
+	mr.TargetSHA = &targetSHA
+	mr.MergeStrategy = &strategy
+	mr.MergeCommitSHA = &mergedSHA
+	mr.MergedBy = token.UserID
+	mr.MergedAt = &now
+	mr.UpdatedAt = now
+	if err := s.store.UpdateMergeRequest(mr); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Branch merged but failed to update merge request")
+		return
+	}
+
+	JSON(w, http.StatusOK, mergeRequestResponse{MergeRequest: *mr})
+}
+
+func defaultMergeRequestMessage(mr *store.MergeRequest, strategy string) string {
+	if strategy == mergeStrategySquash {
+		msg := fmt.Sprintf("%s (#%d)", mr.Title, mr.Number)
+		if description := strings.TrimSpace(mr.Description); description != "" {
+			msg += "\n\n" + description
+		}
+		return msg
+	}
+
+	return fmt.Sprintf("Merge branch '%s' into '%s'\n\n%s\n\nMerge request #%d", mr.SourceBranch, mr.TargetBranch, mr.Title, mr.Number)
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// Fast-forward modes for branch merges, after git merge --ff, --no-ff and --ff-only.
+const (
+	fastForwardAllow = "allow"
+	fastForwardNever = "never"
+	fastForwardOnly  = "only"
+)
+
+// Results of a branch merge.
+const (
+	mergeResultMerged      = "merged"
+	mergeResultFastForward = "fast_forward"
+	mergeResultUpToDate    = "up_to_date"
+)
+
+type createMergeRequest struct {
+	Base        string          `json:"base"`
+	Head        string          `json:"head"`
+	Strategy    string          `json:"strategy,omitempty"`
+	FastForward string          `json:"fast_forward,omitempty"`
+	Message     *string         `json:"message,omitempty"`
+	Author      *commitIdentity `json:"author,omitempty"`
+}
+
+type mergeResponse struct {
+	Base     string `json:"base"`
+	Head     string `json:"head"`
+	HeadSHA  string `json:"head_sha"`
+	OldSHA   string `json:"old_sha"`
+	SHA      string `json:"sha"`
+	Strategy string `json:"strategy"`
+	Result   string `json:"result"`
+}
+
+// handleCreateMerge merges a head ref into a base branch without a working
+// tree, for clients that only have the API.
+func (s *Server) handleCreateMerge(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil || rejectMirrorWrite(w, repo) {
+		return
+	}
+
+	var req createMergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	base, err := validateBranchName(req.Base)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "base: "+err.Error())
+		return
+	}
+
+	head := strings.TrimSpace(req.Head)
+	if head == "" {
+		JSONError(w, http.StatusBadRequest, "head is required")
+		return
+	}
+
+	strategy := req.Strategy
+	if strategy == "" {
+		strategy = mergeStrategyMerge
+	}
+	if !isValidMergeStrategy(strategy) {
+		JSONError(w, http.StatusBadRequest, "strategy must be merge, squash or rebase")
+		return
+	}
+
+	fastForward := req.FastForward
+	if fastForward == "" {
+		fastForward = fastForwardAllow
+	}
+	switch fastForward {
+	case fastForwardAllow, fastForwardNever, fastForwardOnly:
+	default:
+		JSONError(w, http.StatusBadRequest, "fast_forward must be allow, never or only")
+		return
+	}
+	if fastForward != fastForwardAllow && strategy != mergeStrategyMerge {
+		JSONError(w, http.StatusBadRequest, "fast_forward only applies to the merge strategy")
+		return
+	}
+
+	if req.Author != nil {
+		if msg := validateCommitIdentity(req.Author); msg != "" {
+			JSONError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	gitRepo, ok := s.openGitRepoForRepo(w, repo)
+	if !ok {
+		return
+	}
+
+	repoPath, err := SafeRepoPath(s.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to resolve repo path")
+		return
+	}
+
+	baseSHA, err := branchHead(gitRepo, base)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get branch")
+		return
+	}
+	if baseSHA == "" {
+		JSONError(w, http.StatusNotFound, "Branch not found: "+base)
+		return
+	}
+
+	headCommit, headHash, ok := s.loadCommitFromRef(w, gitRepo, head)
+	if !ok {
+		return
+	}
+	headSHA := headHash.String()
+
+	ctx, cancel := context.WithTimeout(r.Context(), gitCommandTimeout)
+	defer cancel()
+
+	resp := mergeResponse{
+		Base:     base,
+		Head:     head,
+		HeadSHA:  headSHA,
+		OldSHA:   baseSHA,
+		SHA:      baseSHA,
+		Strategy: strategy,
+		Result:   mergeResultUpToDate,
+	}
+
+	upToDate, err := gitIsAncestor(ctx, repoPath, headSHA, baseSHA)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to compare commits")
+		return
+	}
+	if upToDate {
+		JSON(w, http.StatusOK, resp)
+		return
+	}
+
+	canFastForward, err := gitIsAncestor(ctx, repoPath, baseSHA, headSHA)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to compare commits")
+		return
+	}
+
+	var mergedSHA string
+	switch {
+	case canFastForward && strategy == mergeStrategyMerge && fastForward != fastForwardNever:
+		mergedSHA = headSHA
+	case fastForward == fastForwardOnly:
+		writeMergeError(w, errNotFastForward)
+		return
+	default:
+		committer, err := s.userSignature(r, *token.UserID)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get user")
+			return
+		}
+
+		opts := mergeOptions{
+			Strategy:  strategy,
+			BaseSHA:   baseSHA,
+			HeadSHA:   headSHA,
+			Message:   defaultMergeMessage(base, describeMergeHead(gitRepo, head, headSHA), strategy),
+			Author:    committer,
+			Committer: committer,
+		}
+		if strategy == mergeStrategySquash {
+			opts.Author = object.Signature{Name: headCommit.Author.Name, Email: headCommit.Author.Email}
+		}
+		if req.Author != nil {
+			opts.Author = object.Signature{Name: req.Author.Name, Email: req.Author.Email}
+		}
+		if req.Message != nil && strings.TrimSpace(*req.Message) != "" {
+			opts.Message = *req.Message
+		}
+
+		mergedSHA, err = mergeCommits(ctx, gitRepo, repoPath, opts)
+		if err != nil {
+			writeMergeError(w, err)
+			return
+		}
+	}
+
+	if !s.updateBranch(ctx, w, token, repo, repoPath, base, baseSHA, mergedSHA) {
+		return
+	}
+
+	resp.SHA = mergedSHA
+	resp.Result = mergeResultMerged
+	if mergedSHA == headSHA {
+		resp.Result = mergeResultFastForward
+	}
+
+	JSON(w, http.StatusOK, resp)
+}
+
+// describeMergeHead names what head was resolved as, the way git merge
+// messages do: branch 'name', tag 'name' or commit 'sha'.
+func describeMergeHead(gitRepo *git.Repository, head, headSHA string) string {
+	if head != headSHA {
+		if sha, err := branchHead(gitRepo, head); err == nil && sha != "" {
+			return fmt.Sprintf("branch '%s'", head)
+		}
+		if _, err := gitRepo.Tag(head); err == nil {
+			return fmt.Sprintf("tag '%s'", head)
+		}
+	}
+	return fmt.Sprintf("commit '%s'", headSHA[:7])
+}
+
+// defaultMergeMessage is the message for merging or squashing head into base.
+func defaultMergeMessage(base, head, strategy string) string {
+	if strategy == mergeStrategySquash {
+		return fmt.Sprintf("Squash %s into %s", head, base)
+	}
+	return fmt.Sprintf("Merge %s into %s", head, base)
+}
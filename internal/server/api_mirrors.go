@@ -0,0 +1,311 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const errMirrorReadOnly = "Repository is a mirror and is read-only"
+
+type mirrorRequest struct {
+	URL             string  `json:"url"`
+	IntervalSeconds *int    `json:"interval_seconds,omitempty"`
+	Credentials     *string `json:"credentials,omitempty"`
+}
+
+// parseMirrorRequest validates a mirror config, writing a 400 and returning
+// nil if it is invalid.
+func (s *Server) parseMirrorRequest(w http.ResponseWriter, req *mirrorRequest) *store.RepoMirror {
+	req.URL = strings.TrimSpace(req.URL)
+	if err := s.mirrors.opts.validateURL(req.URL); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	if err := s.mirrors.opts.validateCredentials(req.Credentials, req.URL); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	interval := int(defaultMirrorInterval.Seconds())
+	if req.IntervalSeconds != nil {
+		interval = *req.IntervalSeconds
+	}
+	if time.Duration(interval)*time.Second < minMirrorInterval {
+		JSONError(w, http.StatusBadRequest, "Mirror interval must be at least 60 seconds")
+		return nil
+	}
+
+	return &store.RepoMirror{
+		URL:             req.URL,
+		IntervalSeconds: interval,
+		Credentials:     req.Credentials,
+		Status:          store.MirrorStatusPending,
+	}
+}
+
+// rejectMirrorWrite refuses ref changes on a mirror, which the next sync would
+// overwrite. Returns true if the request was rejected.
+func rejectMirrorWrite(w http.ResponseWriter, repo *store.Repo) bool {
+	if repo.Mirror == nil {
+		return false
+	}
+	JSONError(w, http.StatusForbidden, errMirrorReadOnly)
+	return true
+}
+
+// handleSetRepoMirror turns a repo into a pull mirror or changes its upstream.
+// The next sync prunes any refs the upstream does not have.
+func (s *Server) handleSetRepoMirror(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	var req mirrorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	mirror := s.parseMirrorRequest(w, &req)
+	if mirror == nil {
+		return
+	}
+
+	if err := s.store.UpdateRepoMirror(repo.ID, mirror); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to update mirror")
+		return
+	}
+	s.mirrors.notify()
+
+	updated, err := s.store.GetRepoByID(repo.ID)
+	if err != nil || updated == nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get repo")
+		return
+	}
+
+	JSON(w, http.StatusOK, updated)
+}
+
+// handleDeleteRepoMirror stops mirroring, leaving a regular repo with the
+// refs of the last sync.
+func (s *Server) handleDeleteRepoMirror(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	if repo.Mirror == nil {
+		JSONError(w, http.StatusNotFound, "Repository is not a mirror")
+		return
+	}
+
+	if err := s.store.UpdateRepoMirror(repo.ID, nil); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to remove mirror")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSyncRepoMirror fetches a mirror from its upstream immediately, after
+// any sync already in progress.
+func (s *Server) handleSyncRepoMirror(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil {
+		return
+	}
+
+	if repo.Mirror == nil {
+		JSONError(w, http.StatusNotFound, "Repository is not a mirror")
+		return
+	}
+
+	// The git error can describe whatever answered at the mirror URL, so it
+	// is only kept in the mirror's last_error.
+	if err := s.mirrors.sync(r.Context(), repo, true); err != nil {
+		var qErr *quotaError
+		if errors.As(err, &qErr) {
+			JSONError(w, http.StatusBadGateway, "Mirror sync failed: "+qErr.Error())
+			return
+		}
+		JSONError(w, http.StatusBadGateway, "Mirror sync failed")
+		return
+	}
+
+	updated, err := s.store.GetRepoByID(repo.ID)
+	if err != nil || updated == nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get repo")
+		return
+	}
+
+	JSON(w, http.StatusOK, updated)
+}
+
+type pushMirrorRequest struct {
+	URL         string  `json:"url"`
+	Credentials *string `json:"credentials,omitempty"`
+}
+
+// handleListPushMirrors lists a repo's push mirrors with the status of their
+// last push.
+func (s *Server) handleListPushMirrors(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	mirrors, err := s.store.ListPushMirrors(repo.ID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list push mirrors")
+		return
+	}
+
+	if mirrors == nil {
+		mirrors = []store.PushMirror{}
+	}
+
+	JSON(w, http.StatusOK, mirrors)
+}
+
+// handleCreatePushMirror adds a push mirror and queues an initial push.
+func (s *Server) handleCreatePushMirror(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	var req pushMirrorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.URL = strings.TrimSpace(req.URL)
+	if err := s.pushMirrors.opts.validateURL(req.URL); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.pushMirrors.opts.validateCredentials(req.Credentials, req.URL); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now()
+	mirror := &store.PushMirror{
+		ID:            uuid.New().String(),
+		RepoID:        repo.ID,
+		URL:           req.URL,
+		Credentials:   req.Credentials,
+		Status:        store.MirrorStatusPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	}
+
+	if err := s.store.CreatePushMirror(mirror); err != nil {
+		if errors.Is(err, store.ErrDuplicatePushMirror) {
+			JSONError(w, http.StatusConflict, "Push mirror for this URL already exists")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to create push mirror")
+		return
+	}
+	s.pushMirrors.notify()
+
+	JSON(w, http.StatusCreated, mirror)
+}
+
+func (s *Server) handleDeletePushMirror(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	mirror, err := s.store.GetPushMirror(repo.ID, chi.URLParam(r, "mirrorID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get push mirror")
+		return
+	}
+	if mirror == nil {
+		JSONError(w, http.StatusNotFound, "Push mirror not found")
+		return
+	}
+
+	if err := s.store.DeletePushMirror(mirror.ID); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to delete push mirror")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSyncPushMirrors queues a push to all of a repo's push mirrors, which
+// also retries mirrors that gave up after repeated failures.
+func (s *Server) handleSyncPushMirrors(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	if err := s.store.QueuePushMirrors(repo.ID, time.Now()); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to queue push mirrors")
+		return
+	}
+	s.pushMirrors.notify()
+
+	mirrors, err := s.store.ListPushMirrors(repo.ID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list push mirrors")
+		return
+	}
+
+	if mirrors == nil {
+		mirrors = []store.PushMirror{}
+	}
+
+	JSON(w, http.StatusAccepted, mirrors)
+}
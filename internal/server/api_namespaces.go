@@ -60,6 +60,16 @@ func (s *Server) handleListNamespaces(w http.ResponseWriter, r *http.Request) {
 		if err != nil || ns == nil {
 			continue
 		}
+		if token.Scope != nil {
+			canAccess, err := s.permissions.CanAccessNamespace(token.ID, ns.ID)
+			if err != nil {
+				JSONError(w, http.StatusInternalServerError, "Failed to check namespace access")
+				return
+			}
+			if !canAccess {
+				continue
+			}
+		}
 		result = append(result, namespaceListResponse{
 			Namespace: *ns,
 			IsPrimary: ns.ID == user.PrimaryNamespaceID,
@@ -233,3 +243,54 @@ func (s *Server) handleListNamespaceGrants(w http.ResponseWriter, r *http.Reques
 
 	JSON(w, http.StatusOK, result)
 }
+
+// namespaceUsageResponse reports a namespace's usage alongside its quotas.
+// Limits are omitted when the namespace is unlimited.
+type namespaceUsageResponse struct {
+	RepoCount         int   `json:"repo_count"`
+	RepoLimit         *int  `json:"repo_limit,omitempty"`
+	GitBytes          int64 `json:"git_bytes"`
+	LFSBytes          int64 `json:"lfs_bytes"`
+	ReleaseBytes      int64 `json:"release_bytes"`
+	StorageBytes      int64 `json:"storage_bytes"`
+	StorageLimitBytes *int  `json:"storage_limit_bytes,omitempty"`
+}
+
+// handleGetNamespaceUsage returns repo and storage usage for a namespace.
+func (s *Server) handleGetNamespaceUsage(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	ns, err := s.store.GetNamespaceByName(name)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get namespace")
+		return
+	}
+	if ns == nil {
+		JSONError(w, http.StatusNotFound, "Namespace not found")
+		return
+	}
+
+	if !s.requireNamespacePermission(w, token, ns.ID, store.PermNamespaceRead) {
+		return
+	}
+
+	usage, err := s.store.GetNamespaceUsage(ns.ID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get namespace usage")
+		return
+	}
+
+	JSON(w, http.StatusOK, namespaceUsageResponse{
+		RepoCount:         usage.RepoCount,
+		RepoLimit:         ns.RepoLimit,
+		GitBytes:          usage.GitBytes,
+		LFSBytes:          usage.LFSBytes,
+		ReleaseBytes:      usage.ReleaseBytes,
+		StorageBytes:      usage.StorageBytes(),
+		StorageLimitBytes: ns.StorageLimitBytes,
+	})
+}
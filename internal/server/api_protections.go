@@ -0,0 +1,241 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+type branchProtectionRequest struct {
+	Pattern              *string `json:"pattern,omitempty"`
+	BlockForcePush       *bool   `json:"block_force_push,omitempty"`
+	BlockDeletion        *bool   `json:"block_deletion,omitempty"`
+	RequireLinearHistory *bool   `json:"require_linear_history,omitempty"`
+	PushPermission       *string `json:"push_permission,omitempty"`
+}
+
+type branchProtectionResponse struct {
+	ID                   string    `json:"id"`
+	RepoID               string    `json:"repo_id"`
+	Pattern              string    `json:"pattern"`
+	BlockForcePush       bool      `json:"block_force_push"`
+	BlockDeletion        bool      `json:"block_deletion"`
+	RequireLinearHistory bool      `json:"require_linear_history"`
+	PushPermission       string    `json:"push_permission"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+func branchProtectionToResponse(rule store.BranchProtection) branchProtectionResponse {
+	pushPermission := store.PermStringRepoWrite
+	if rule.PushPermission != 0 {
+		pushPermission = rule.PushPermission.String()
+	}
+
+	return branchProtectionResponse{
+		ID:                   rule.ID,
+		RepoID:               rule.RepoID,
+		Pattern:              rule.Pattern,
+		BlockForcePush:       rule.BlockForcePush,
+		BlockDeletion:        rule.BlockDeletion,
+		RequireLinearHistory: rule.RequireLinearHistory,
+		PushPermission:       pushPermission,
+		CreatedAt:            rule.CreatedAt,
+		UpdatedAt:            rule.UpdatedAt,
+	}
+}
+
+// applyBranchProtectionRequest copies the provided fields onto the rule, validating as it goes.
+func applyBranchProtectionRequest(rule *store.BranchProtection, req branchProtectionRequest) error {
+	if req.Pattern != nil {
+		pattern := normalizeRefName(*req.Pattern)
+		if pattern == "" {
+			return fmt.Errorf("pattern is required")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern")
+		}
+		rule.Pattern = pattern
+	}
+
+	if req.BlockForcePush != nil {
+		rule.BlockForcePush = *req.BlockForcePush
+	}
+	if req.BlockDeletion != nil {
+		rule.BlockDeletion = *req.BlockDeletion
+	}
+	if req.RequireLinearHistory != nil {
+		rule.RequireLinearHistory = *req.RequireLinearHistory
+	}
+
+	if req.PushPermission != nil {
+		switch strings.TrimSpace(*req.PushPermission) {
+		case "", store.PermStringRepoWrite:
+			rule.PushPermission = 0
+		case store.PermStringRepoAdmin:
+			rule.PushPermission = store.PermRepoAdmin
+		default:
+			return fmt.Errorf("push_permission must be repo:write or repo:admin")
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) getBranchProtectionForRepo(w http.ResponseWriter, r *http.Request, repo *store.Repo) *store.BranchProtection {
+	rule, err := s.store.GetBranchProtection(chi.URLParam(r, "ruleID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get branch protection")
+		return nil
+	}
+	if rule == nil || rule.RepoID != repo.ID {
+		JSONError(w, http.StatusNotFound, "Branch protection not found")
+		return nil
+	}
+	return rule
+}
+
+func (s *Server) handleListBranchProtections(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccess(w, r, token)
+	if repo == nil {
+		return
+	}
+
+	rules, err := s.store.ListBranchProtections(repo.ID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list branch protections")
+		return
+	}
+
+	resp := make([]branchProtectionResponse, len(rules))
+	for i, rule := range rules {
+		resp[i] = branchProtectionToResponse(rule)
+	}
+
+	JSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateBranchProtection(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	var req branchProtectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Pattern == nil {
+		JSONError(w, http.StatusBadRequest, "pattern is required")
+		return
+	}
+
+	now := time.Now()
+	rule := &store.BranchProtection{
+		ID:        uuid.New().String(),
+		RepoID:    repo.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := applyBranchProtectionRequest(rule, req); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.store.CreateBranchProtection(rule); err != nil {
+		if errors.Is(err, store.ErrDuplicateBranchProtection) {
+			JSONError(w, http.StatusConflict, "Branch protection for this pattern already exists")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to create branch protection")
+		return
+	}
+
+	JSON(w, http.StatusCreated, branchProtectionToResponse(*rule))
+}
+
+func (s *Server) handleUpdateBranchProtection(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	rule := s.getBranchProtectionForRepo(w, r, repo)
+	if rule == nil {
+		return
+	}
+
+	var req branchProtectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := applyBranchProtectionRequest(rule, req); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rule.UpdatedAt = time.Now()
+
+	if err := s.store.UpdateBranchProtection(rule); err != nil {
+		if errors.Is(err, store.ErrDuplicateBranchProtection) {
+			JSONError(w, http.StatusConflict, "Branch protection for this pattern already exists")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to update branch protection")
+		return
+	}
+
+	JSON(w, http.StatusOK, branchProtectionToResponse(*rule))
+}
+
+func (s *Server) handleDeleteBranchProtection(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return
+	}
+
+	rule := s.getBranchProtectionForRepo(w, r, repo)
+	if rule == nil {
+		return
+	}
+
+	if err := s.store.DeleteBranchProtection(rule.ID); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to delete branch protection")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -90,7 +90,7 @@ func (s *Server) handleCreateRef(w http.ResponseWriter, r *http.Request) {
 	}
 
 	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
-	if repo == nil {
+	if repo == nil || rejectMirrorWrite(w, repo) {
 		return
 	}
 
@@ -138,12 +138,23 @@ func (s *Server) handleCreateRef(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newRef := plumbing.NewHashReference(refName, *hash)
-	if err := gitRepo.Storer.SetReference(newRef); err != nil {
-		JSONError(w, http.StatusInternalServerError, "Failed to create reference")
+	update := refUpdate{OldSHA: plumbing.ZeroHash.String(), NewSHA: hash.String(), Ref: refName.String()}
+	if err := s.checkProtectedRefUpdate(r.Context(), token, repo, update); err != nil {
+		writeProtectionError(w, err)
 		return
 	}
 
+	repoPath, err := SafeRepoPath(s.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to resolve repo path")
+		return
+	}
+	if err := gitUpdateRefs(r.Context(), repoPath, []refUpdate{update}); err != nil {
+		writeRefUpdateError(w, err, "Failed to create reference")
+		return
+	}
+	s.gitHandler.recordPush(repo, repoPath, pushActor{UserID: *token.UserID, TokenID: &token.ID}, []refUpdate{update})
+
 	resp := RefResponse{
 		Name:      refName.Short(),
 		Type:      refType,
@@ -161,7 +172,7 @@ func (s *Server) handleUpdateRef(w http.ResponseWriter, r *http.Request) {
 	}
 
 	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
-	if repo == nil {
+	if repo == nil || rejectMirrorWrite(w, repo) {
 		return
 	}
 
@@ -229,23 +240,41 @@ func (s *Server) handleUpdateRef(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	updatedRef := plumbing.NewHashReference(newRefName, targetHash)
-	if err := gitRepo.Storer.SetReference(updatedRef); err != nil {
-		JSONError(w, http.StatusInternalServerError, "Failed to update reference")
-		return
+	var updates []refUpdate
+	if newRefName == refName {
+		updates = append(updates, refUpdate{OldSHA: existingRef.Hash().String(), NewSHA: targetHash.String(), Ref: refName.String()})
+	} else {
+		updates = append(updates,
+			refUpdate{OldSHA: existingRef.Hash().String(), NewSHA: plumbing.ZeroHash.String(), Ref: refName.String()},
+			refUpdate{OldSHA: plumbing.ZeroHash.String(), NewSHA: targetHash.String(), Ref: newRefName.String()},
+		)
 	}
-
-	if newRefName != refName {
-		if err := gitRepo.Storer.RemoveReference(refName); err != nil {
-			JSONError(w, http.StatusInternalServerError, "Failed to remove old reference")
+	for _, update := range updates {
+		if err := s.checkProtectedRefUpdate(r.Context(), token, repo, update); err != nil {
+			writeProtectionError(w, err)
 			return
 		}
+	}
+
+	// The check above saw each ref at its OldSHA, so the write only goes
+	// through if no push has moved them since.
+	repoPath, err := SafeRepoPath(s.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to resolve repo path")
+		return
+	}
+	if err := gitUpdateRefs(r.Context(), repoPath, updates); err != nil {
+		writeRefUpdateError(w, err, "Failed to update reference")
+		return
+	}
 
+	if newRefName != refName {
 		if err := updateHeadReference(gitRepo, refName, newRefName); err != nil {
 			JSONError(w, http.StatusInternalServerError, "Failed to update default branch")
 			return
 		}
 	}
+	s.gitHandler.recordPush(repo, repoPath, pushActor{UserID: *token.UserID, TokenID: &token.ID}, updates)
 
 	resp := RefResponse{
 		Name:      newRefName.Short(),
@@ -264,7 +293,7 @@ func (s *Server) handleDeleteRef(w http.ResponseWriter, r *http.Request) {
 	}
 
 	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
-	if repo == nil {
+	if repo == nil || rejectMirrorWrite(w, repo) {
 		return
 	}
 
@@ -290,14 +319,32 @@ func (s *Server) handleDeleteRef(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := gitRepo.Storer.RemoveReference(refName); err != nil {
+	existingRef, err := gitRepo.Reference(refName, true)
+	if err != nil {
 		if errors.Is(err, plumbing.ErrReferenceNotFound) {
 			JSONError(w, http.StatusNotFound, "Reference not found")
 			return
 		}
-		JSONError(w, http.StatusInternalServerError, "Failed to delete reference")
+		JSONError(w, http.StatusInternalServerError, "Failed to get reference")
+		return
+	}
+
+	update := refUpdate{OldSHA: existingRef.Hash().String(), NewSHA: plumbing.ZeroHash.String(), Ref: refName.String()}
+	if err := s.checkProtectedRefUpdate(r.Context(), token, repo, update); err != nil {
+		writeProtectionError(w, err)
+		return
+	}
+
+	repoPath, err := SafeRepoPath(s.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to resolve repo path")
+		return
+	}
+	if err := gitUpdateRefs(r.Context(), repoPath, []refUpdate{update}); err != nil {
+		writeRefUpdateError(w, err, "Failed to delete reference")
 		return
 	}
+	s.gitHandler.recordPush(repo, repoPath, pushActor{UserID: *token.UserID, TokenID: &token.ID}, []refUpdate{update})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -309,7 +356,7 @@ func (s *Server) handleSetDefaultBranch(w http.ResponseWriter, r *http.Request)
 	}
 
 	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
-	if repo == nil {
+	if repo == nil || rejectMirrorWrite(w, repo) {
 		return
 	}
 
@@ -345,6 +392,7 @@ func (s *Server) handleSetDefaultBranch(w http.ResponseWriter, r *http.Request)
 		JSONError(w, http.StatusInternalServerError, "Failed to update default branch")
 		return
 	}
+	s.searchIndex.queue(repo.ID)
 
 	resp := RefResponse{
 		Name:      refName.Short(),
@@ -356,6 +404,16 @@ func (s *Server) handleSetDefaultBranch(w http.ResponseWriter, r *http.Request)
 	JSON(w, http.StatusOK, resp)
 }
 
+// writeRefUpdateError writes a 409 when a ref moved after it was checked and
+// a 500 with msg otherwise.
+func writeRefUpdateError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, errRefMoved) {
+		JSONError(w, http.StatusConflict, "Reference was updated concurrently, try again")
+		return
+	}
+	JSONError(w, http.StatusInternalServerError, msg)
+}
+
 func updateHeadReference(repo *git.Repository, oldRef, newRef plumbing.ReferenceName) error {
 	headRef, err := repo.Reference(plumbing.HEAD, false)
 	if err != nil {
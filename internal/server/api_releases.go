@@ -0,0 +1,608 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/lfs"
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const (
+	maxReleaseTitleLength     = 256
+	maxReleaseAssetNameLength = 255
+	defaultAssetContentType   = "application/octet-stream"
+)
+
+// ReleaseOptions configures storage for release assets.
+type ReleaseOptions struct {
+	// Storage defaults to local storage under the data directory. It must not
+	// be shared with LFS, whose garbage collection would remove the assets.
+	Storage lfs.Storage
+	// MaxAssetSize limits the size of an uploaded asset. Zero means no limit.
+	MaxAssetSize int64
+}
+
+type createReleaseRequest struct {
+	TagName    string `json:"tag_name"`
+	Title      string `json:"title"`
+	Notes      string `json:"notes"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+type updateReleaseRequest struct {
+	TagName    *string `json:"tag_name,omitempty"`
+	Title      *string `json:"title,omitempty"`
+	Notes      *string `json:"notes,omitempty"`
+	Draft      *bool   `json:"draft,omitempty"`
+	Prerelease *bool   `json:"prerelease,omitempty"`
+}
+
+// canWriteRepo reports whether the request's token can write to the repo.
+// Anonymous requests and admin tokens cannot.
+func (s *Server) canWriteRepo(r *http.Request, repo *store.Repo) (bool, error) {
+	token := GetTokenFromContext(r.Context())
+	if token == nil || token.IsAdmin {
+		return false, nil
+	}
+	return s.permissions.CheckRepoPermission(token.ID, repo, store.PermRepoWrite)
+}
+
+// releaseVisible reports whether a release can be shown. Drafts are only
+// visible to users who can write to the repo.
+func (s *Server) releaseVisible(w http.ResponseWriter, r *http.Request, repo *store.Repo, release *store.Release) bool {
+	if release == nil {
+		JSONError(w, http.StatusNotFound, "Release not found")
+		return false
+	}
+	if !release.Draft {
+		return true
+	}
+
+	canWrite, err := s.canWriteRepo(r, repo)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to check permissions")
+		return false
+	}
+	if !canWrite {
+		JSONError(w, http.StatusNotFound, "Release not found")
+		return false
+	}
+	return true
+}
+
+func (s *Server) getReleaseForRepo(w http.ResponseWriter, r *http.Request, repo *store.Repo) *store.Release {
+	release, err := s.store.GetRelease(repo.ID, chi.URLParam(r, "releaseID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get release")
+		return nil
+	}
+	if release == nil {
+		JSONError(w, http.StatusNotFound, "Release not found")
+		return nil
+	}
+	return release
+}
+
+// validateReleaseTag normalizes a tag name and checks that the tag exists.
+func (s *Server) validateReleaseTag(w http.ResponseWriter, repo *store.Repo, name string) (string, bool) {
+	refName, err := buildRefName(refTypeTag, name)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "tag_name: "+err.Error())
+		return "", false
+	}
+
+	gitRepo, ok := s.openGitRepoForRepo(w, repo)
+	if !ok {
+		return "", false
+	}
+
+	exists, err := refExists(gitRepo, refName)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get tag")
+		return "", false
+	}
+	if !exists {
+		JSONError(w, http.StatusNotFound, "Tag not found: "+refName.Short())
+		return "", false
+	}
+
+	return refName.Short(), true
+}
+
+// normalizeAssetName validates an asset file name. Returns "" if invalid.
+func normalizeAssetName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || len(name) > maxReleaseAssetNameLength {
+		return ""
+	}
+	if strings.ContainsAny(name, `/\`) || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return ""
+	}
+	return name
+}
+
+// deleteReleaseBlobs removes the stored content of deleted assets that no
+// remaining asset of the repo shares.
+func (s *Server) deleteReleaseBlobs(ctx context.Context, repoID string, assets []store.ReleaseAsset) {
+	seen := make(map[string]bool, len(assets))
+	for _, asset := range assets {
+		if seen[asset.SHA256] {
+			continue
+		}
+		seen[asset.SHA256] = true
+
+		count, err := s.store.CountReleaseAssetBlobs(repoID, asset.SHA256)
+		if err != nil {
+			slog.Warn("failed to count release assets", "repo_id", repoID, "sha256", asset.SHA256, "error", err)
+			continue
+		}
+		if count > 0 {
+			continue
+		}
+
+		if err := s.releaseStorage.Delete(ctx, repoID, asset.SHA256); err != nil && !errors.Is(err, lfs.ErrObjectNotFound) {
+			slog.Warn("failed to delete release asset", "repo_id", repoID, "sha256", asset.SHA256, "error", err)
+		}
+	}
+}
+
+func (s *Server) handleListReleases(w http.ResponseWriter, r *http.Request) {
+	repo, _, ok := s.checkRepoAccess(w, r)
+	if !ok {
+		return
+	}
+
+	includeDrafts, err := s.canWriteRepo(r, repo)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to check permissions")
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	limit := parseLimit(r.URL.Query().Get("limit"), defaultPageSize)
+
+	releases, err := s.store.ListReleases(repo.ID, includeDrafts, cursor, limit+1)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list releases")
+		return
+	}
+
+	var nextCursor *string
+	hasMore := len(releases) > limit
+	if hasMore {
+		releases = releases[:limit]
+		nextCursor = &releases[limit-1].ID
+	}
+
+	if releases == nil {
+		releases = []store.Release{}
+	}
+
+	JSONList(w, releases, nextCursor, hasMore)
+}
+
+func (s *Server) handleGetRelease(w http.ResponseWriter, r *http.Request) {
+	repo, _, ok := s.checkRepoAccess(w, r)
+	if !ok {
+		return
+	}
+
+	release, err := s.store.GetRelease(repo.ID, chi.URLParam(r, "releaseID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get release")
+		return
+	}
+	if !s.releaseVisible(w, r, repo, release) {
+		return
+	}
+
+	JSON(w, http.StatusOK, release)
+}
+
+func (s *Server) handleGetReleaseByTag(w http.ResponseWriter, r *http.Request) {
+	repo, _, ok := s.checkRepoAccess(w, r)
+	if !ok {
+		return
+	}
+
+	release, err := s.store.GetReleaseByTag(repo.ID, chi.URLParam(r, "*"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get release")
+		return
+	}
+	if !s.releaseVisible(w, r, repo, release) {
+		return
+	}
+
+	JSON(w, http.StatusOK, release)
+}
+
+func (s *Server) handleCreateRelease(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil {
+		return
+	}
+
+	var req createReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tag, ok := s.validateReleaseTag(w, repo, req.TagName)
+	if !ok {
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = tag
+	}
+	if len(title) > maxReleaseTitleLength {
+		JSONError(w, http.StatusBadRequest, fmt.Sprintf("title must be at most %d characters", maxReleaseTitleLength))
+		return
+	}
+
+	now := time.Now()
+	release := &store.Release{
+		ID:         uuid.New().String(),
+		RepoID:     repo.ID,
+		TagName:    tag,
+		Title:      title,
+		Notes:      req.Notes,
+		Draft:      req.Draft,
+		Prerelease: req.Prerelease,
+		AuthorID:   token.UserID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if !release.Draft {
+		release.PublishedAt = &now
+	}
+
+	if err := s.store.CreateRelease(release); err != nil {
+		if errors.Is(err, store.ErrDuplicateRelease) {
+			JSONError(w, http.StatusConflict, "A release already exists for tag "+tag)
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to create release")
+		return
+	}
+
+	created, err := s.store.GetRelease(repo.ID, release.ID)
+	if err != nil || created == nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get release")
+		return
+	}
+
+	JSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) handleUpdateRelease(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil {
+		return
+	}
+
+	release := s.getReleaseForRepo(w, r, repo)
+	if release == nil {
+		return
+	}
+
+	var req updateReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.TagName != nil {
+		tag, ok := s.validateReleaseTag(w, repo, *req.TagName)
+		if !ok {
+			return
+		}
+		release.TagName = tag
+	}
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			JSONError(w, http.StatusBadRequest, "title cannot be empty")
+			return
+		}
+		if len(title) > maxReleaseTitleLength {
+			JSONError(w, http.StatusBadRequest, fmt.Sprintf("title must be at most %d characters", maxReleaseTitleLength))
+			return
+		}
+		release.Title = title
+	}
+	if req.Notes != nil {
+		release.Notes = *req.Notes
+	}
+	if req.Prerelease != nil {
+		release.Prerelease = *req.Prerelease
+	}
+
+	now := time.Now()
+	if req.Draft != nil {
+		release.Draft = *req.Draft
+		switch {
+		case release.Draft:
+			release.PublishedAt = nil
+		case release.PublishedAt == nil:
+			release.PublishedAt = &now
+		}
+	}
+	release.UpdatedAt = now
+
+	if err := s.store.UpdateRelease(release); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateRelease):
+			JSONError(w, http.StatusConflict, "A release already exists for tag "+release.TagName)
+		case errors.Is(err, sql.ErrNoRows):
+			JSONError(w, http.StatusNotFound, "Release not found")
+		default:
+			JSONError(w, http.StatusInternalServerError, "Failed to update release")
+		}
+		return
+	}
+
+	JSON(w, http.StatusOK, release)
+}
+
+func (s *Server) handleDeleteRelease(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil {
+		return
+	}
+
+	release := s.getReleaseForRepo(w, r, repo)
+	if release == nil {
+		return
+	}
+
+	if err := s.store.DeleteRelease(release.ID); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to delete release")
+		return
+	}
+
+	s.deleteReleaseBlobs(r.Context(), repo.ID, release.Assets)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUploadReleaseAsset stores the request body as an asset of a release.
+// The file name comes from the name query parameter and the content type from
+// the Content-Type header.
+func (s *Server) handleUploadReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil {
+		return
+	}
+
+	release := s.getReleaseForRepo(w, r, repo)
+	if release == nil {
+		return
+	}
+
+	name := normalizeAssetName(r.URL.Query().Get("name"))
+	if name == "" {
+		JSONError(w, http.StatusBadRequest, "name must be a file name")
+		return
+	}
+	for _, asset := range release.Assets {
+		if asset.Name == name {
+			JSONError(w, http.StatusConflict, "Release already has an asset named "+name)
+			return
+		}
+	}
+
+	contentType := defaultAssetContentType
+	if header := r.Header.Get("Content-Type"); header != "" {
+		if _, _, err := mime.ParseMediaType(header); err != nil {
+			JSONError(w, http.StatusBadRequest, "Invalid Content-Type")
+			return
+		}
+		contentType = header
+	}
+
+	if s.maxAssetSize > 0 {
+		if r.ContentLength > s.maxAssetSize {
+			JSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Asset exceeds maximum size of %d bytes", s.maxAssetSize))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxAssetSize)
+	}
+	if r.ContentLength > 0 {
+		if err := checkStorageQuota(s.store, repo.NamespaceID, r.ContentLength); err != nil {
+			writeQuotaError(w, err)
+			return
+		}
+	}
+
+	// The storage is keyed by content hash, so the upload is spooled to a
+	// temp file to hash it before it is stored.
+	tmp, err := os.CreateTemp("", "ephemeral-asset-")
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to store asset")
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			JSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Asset exceeds maximum size of %d bytes", s.maxAssetSize))
+			return
+		}
+		JSONError(w, http.StatusBadRequest, "Failed to read asset")
+		return
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+
+	// Content already stored for this repo takes no more space.
+	shared, err := s.store.CountReleaseAssetBlobs(repo.ID, sum)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to check release assets")
+		return
+	}
+	if shared == 0 {
+		if err := checkStorageQuota(s.store, repo.NamespaceID, size); err != nil {
+			writeQuotaError(w, err)
+			return
+		}
+
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to store asset")
+			return
+		}
+		if err := s.releaseStorage.Put(r.Context(), repo.ID, sum, tmp, size); err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to store asset")
+			return
+		}
+	}
+
+	asset := &store.ReleaseAsset{
+		ID:          uuid.New().String(),
+		ReleaseID:   release.ID,
+		RepoID:      repo.ID,
+		Name:        name,
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      sum,
+		UploaderID:  token.UserID,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.store.CreateReleaseAsset(asset); err != nil {
+		s.deleteReleaseBlobs(r.Context(), repo.ID, []store.ReleaseAsset{*asset})
+		if errors.Is(err, store.ErrDuplicateReleaseAsset) {
+			JSONError(w, http.StatusConflict, "Release already has an asset named "+name)
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to record asset")
+		return
+	}
+
+	JSON(w, http.StatusCreated, asset)
+}
+
+// handleDownloadReleaseAsset streams an asset's content.
+func (s *Server) handleDownloadReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	repo, _, ok := s.checkRepoAccess(w, r)
+	if !ok {
+		return
+	}
+
+	release, err := s.store.GetRelease(repo.ID, chi.URLParam(r, "releaseID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get release")
+		return
+	}
+	if !s.releaseVisible(w, r, repo, release) {
+		return
+	}
+
+	asset, err := s.store.GetReleaseAsset(release.ID, chi.URLParam(r, "assetID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get release asset")
+		return
+	}
+	if asset == nil {
+		JSONError(w, http.StatusNotFound, "Release asset not found")
+		return
+	}
+
+	reader, size, err := s.releaseStorage.Get(r.Context(), repo.ID, asset.SHA256)
+	if errors.Is(err, lfs.ErrObjectNotFound) {
+		JSONError(w, http.StatusNotFound, "Release asset content not found")
+		return
+	}
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to read release asset")
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", asset.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": asset.Name}))
+	w.Header().Set("ETag", `"`+asset.SHA256+`"`)
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, reader)
+}
+
+func (s *Server) handleDeleteReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoWrite)
+	if repo == nil {
+		return
+	}
+
+	release := s.getReleaseForRepo(w, r, repo)
+	if release == nil {
+		return
+	}
+
+	asset, err := s.store.GetReleaseAsset(release.ID, chi.URLParam(r, "assetID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get release asset")
+		return
+	}
+	if asset == nil {
+		JSONError(w, http.StatusNotFound, "Release asset not found")
+		return
+	}
+
+	if err := s.store.DeleteReleaseAsset(asset.ID); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to delete release asset")
+		return
+	}
+
+	s.deleteReleaseBlobs(r.Context(), repo.ID, []store.ReleaseAsset{*asset})
+
+	w.WriteHeader(http.StatusNoContent)
+}
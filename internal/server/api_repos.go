@@ -2,15 +2,18 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"github.com/bantamhq/ephemeral/internal/lfs"
 	"github.com/bantamhq/ephemeral/internal/store"
 )
 
@@ -42,6 +45,12 @@ func (s *Server) handleListRepos(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if token.Scope != nil {
+			repos = slices.DeleteFunc(repos, func(repo store.Repo) bool {
+				return !token.Scope.AllowsRepo(&repo, store.PermRepoRead)
+			})
+		}
+
 		JSONList(w, repos, nil, false)
 		return
 	}
@@ -103,6 +112,17 @@ func (s *Server) handleListRepos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if token.Scope != nil {
+		repos, err := s.listScopedRepos(token, nsID)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to list repos")
+			return
+		}
+
+		JSONList(w, repos, nil, false)
+		return
+	}
+
 	repos, err := s.store.ListUserReposWithGrants(*token.UserID, nsID)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to list repos")
@@ -112,11 +132,49 @@ func (s *Server) handleListRepos(w http.ResponseWriter, r *http.Request) {
 	JSONList(w, repos, nil, false)
 }
 
+// listScopedRepos lists the repos in a namespace that a scoped token without
+// namespace:read can read, sorted by name.
+func (s *Server) listScopedRepos(token *store.Token, nsID string) ([]store.Repo, error) {
+	var candidates []store.Repo
+	if token.Scope.CoversNamespace(nsID) {
+		all, err := s.store.ListRepos(nsID, "", 0)
+		if err != nil {
+			return nil, err
+		}
+		candidates = all
+	} else {
+		for _, id := range token.Scope.RepoIDs {
+			repo, err := s.store.GetRepoByID(id)
+			if err != nil {
+				return nil, err
+			}
+			if repo != nil && repo.NamespaceID == nsID {
+				candidates = append(candidates, *repo)
+			}
+		}
+	}
+
+	repos := []store.Repo{}
+	for _, repo := range candidates {
+		canRead, err := s.permissions.CheckRepoPermission(token.ID, &repo, store.PermRepoRead)
+		if err != nil {
+			return nil, err
+		}
+		if canRead {
+			repos = append(repos, repo)
+		}
+	}
+
+	slices.SortFunc(repos, func(a, b store.Repo) int { return strings.Compare(a.Name, b.Name) })
+	return repos, nil
+}
+
 type createRepoRequest struct {
-	Name        string  `json:"name"`
-	Description *string `json:"description,omitempty"`
-	Public      bool    `json:"public"`
-	Namespace   *string `json:"namespace,omitempty"`
+	Name        string         `json:"name"`
+	Description *string        `json:"description,omitempty"`
+	Public      bool           `json:"public"`
+	Namespace   *string        `json:"namespace,omitempty"`
+	Mirror      *mirrorRequest `json:"mirror,omitempty"`
 }
 
 func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
@@ -151,6 +209,13 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var mirror *store.RepoMirror
+	if req.Mirror != nil {
+		if mirror = s.parseMirrorRequest(w, req.Mirror); mirror == nil {
+			return
+		}
+	}
+
 	existing, err := s.store.GetRepo(nsID, req.Name)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to check existing repo")
@@ -161,6 +226,11 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := checkRepoQuota(s.store, nsID); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
 	now := time.Now()
 	repo := &store.Repo{
 		ID:          uuid.New().String(),
@@ -171,6 +241,7 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		SizeBytes:   0,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Mirror:      mirror,
 	}
 
 	repoPath, err := SafeRepoPath(s.dataDir, nsID, req.Name)
@@ -190,6 +261,11 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.webhooks.emitRepoEvent(WebhookEventRepoCreate, repo, token.UserID, "")
+	if mirror != nil {
+		s.mirrors.notify()
+	}
+
 	JSON(w, http.StatusCreated, repo)
 }
 
@@ -224,6 +300,23 @@ func (s *Server) handleDeleteRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// LFS rows cascade with the repo, so collect them first to delete the blobs.
+	var lfsObjects []store.LFSObject
+	if s.lfsHandler != nil {
+		lfsObjects, err = s.store.ListLFSObjects(repo.ID)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to list LFS objects")
+			return
+		}
+	}
+
+	// Release assets cascade too, and their content is stored the same way.
+	releaseAssets, err := s.store.ListRepoReleaseAssets(repo.ID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list release assets")
+		return
+	}
+
 	if err := s.store.DeleteRepo(repo.ID); err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to delete repo")
 		return
@@ -233,6 +326,16 @@ func (s *Server) handleDeleteRepo(w http.ResponseWriter, r *http.Request) {
 		slog.Warn("failed to remove repo directory", "path", repoPath, "error", err)
 	}
 
+	for _, obj := range lfsObjects {
+		if err := s.lfsHandler.storage.Delete(r.Context(), repo.ID, obj.OID); err != nil && !errors.Is(err, lfs.ErrObjectNotFound) {
+			slog.Warn("failed to delete lfs object", "repo_id", repo.ID, "oid", obj.OID, "error", err)
+		}
+	}
+	s.deleteReleaseBlobs(r.Context(), repo.ID, releaseAssets)
+
+	// Repo-level hooks are deleted with the repo, so only namespace hooks see this.
+	s.webhooks.emitRepoEvent(WebhookEventRepoDelete, repo, token.UserID, "")
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -260,6 +363,7 @@ func (s *Server) handleUpdateRepo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	oldName := repo.Name
+	oldPublic := repo.Public
 	nameChanged := req.Name != nil && strings.ToLower(*req.Name) != oldName
 
 	if nameChanged {
@@ -315,6 +419,13 @@ func (s *Server) handleUpdateRepo(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if nameChanged {
+		s.webhooks.emitRepoEvent(WebhookEventRepoRename, repo, token.UserID, oldName)
+	}
+	if repo.Public != oldPublic {
+		s.webhooks.emitRepoEvent(WebhookEventRepoVisibility, repo, token.UserID, "")
+	}
+
 	JSON(w, http.StatusOK, repo)
 }
 
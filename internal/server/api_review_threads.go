@@ -0,0 +1,511 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const maxReviewCommentLength = 65536
+
+type createReviewThreadRequest struct {
+	CommitSHA string  `json:"commit_sha"`
+	BaseSHA   *string `json:"base_sha,omitempty"`
+	Path      string  `json:"path"`
+	Side      string  `json:"side,omitempty"`
+	Line      int     `json:"line"`
+	Ref       string  `json:"ref,omitempty"`
+	Body      string  `json:"body"`
+}
+
+type updateReviewThreadRequest struct {
+	Resolved *bool `json:"resolved,omitempty"`
+}
+
+type reviewCommentRequest struct {
+	Body string `json:"body"`
+}
+
+// validateReviewCommentBody returns an error message if a comment body is invalid.
+func validateReviewCommentBody(body string) string {
+	if strings.TrimSpace(body) == "" {
+		return "body is required"
+	}
+	if len(body) > maxReviewCommentLength {
+		return fmt.Sprintf("body must be at most %d bytes", maxReviewCommentLength)
+	}
+	return ""
+}
+
+// listDiffReviewThreads returns the review threads on the diff from base to head.
+func (s *Server) listDiffReviewThreads(repoID, baseSHA, headSHA string) ([]store.ReviewThread, error) {
+	return s.store.ListReviewThreads(store.ReviewThreadQuery{
+		RepoID:    repoID,
+		CommitSHA: headSHA,
+		BaseSHA:   &baseSHA,
+	})
+}
+
+func (s *Server) getReviewThreadForRepo(w http.ResponseWriter, r *http.Request, repo *store.Repo) *store.ReviewThread {
+	thread, err := s.store.GetReviewThread(repo.ID, chi.URLParam(r, "threadID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get review thread")
+		return nil
+	}
+	if thread == nil {
+		JSONError(w, http.StatusNotFound, "Review thread not found")
+		return nil
+	}
+	return thread
+}
+
+func (s *Server) handleListReviewThreads(w http.ResponseWriter, r *http.Request) {
+	repo, _, ok := s.checkRepoAccess(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	q := store.ReviewThreadQuery{
+		RepoID:          repo.ID,
+		CommitSHA:       query.Get("commit"),
+		Path:            query.Get("path"),
+		Ref:             query.Get("ref"),
+		ExcludeOutdated: query.Get("outdated") == "false",
+	}
+	if query.Has("base") {
+		base := query.Get("base")
+		q.BaseSHA = &base
+	}
+	if q.CommitSHA == "" && q.Ref == "" {
+		JSONError(w, http.StatusBadRequest, "commit or ref is required")
+		return
+	}
+
+	threads, err := s.store.ListReviewThreads(q)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list review threads")
+		return
+	}
+
+	if threads == nil {
+		threads = []store.ReviewThread{}
+	}
+
+	JSON(w, http.StatusOK, threads)
+}
+
+func (s *Server) handleGetReviewThread(w http.ResponseWriter, r *http.Request) {
+	repo, _, ok := s.checkRepoAccess(w, r)
+	if !ok {
+		return
+	}
+
+	thread := s.getReviewThreadForRepo(w, r, repo)
+	if thread == nil {
+		return
+	}
+
+	JSON(w, http.StatusOK, thread)
+}
+
+func (s *Server) handleCreateReviewThread(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccess(w, r, token)
+	if repo == nil {
+		return
+	}
+
+	var req createReviewThreadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if msg := validateReviewCommentBody(req.Body); msg != "" {
+		JSONError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	side := req.Side
+	if side == "" {
+		side = store.ReviewSideNew
+	}
+	if side != store.ReviewSideNew && side != store.ReviewSideOld {
+		JSONError(w, http.StatusBadRequest, "side must be new or old")
+		return
+	}
+
+	path := strings.Trim(req.Path, "/")
+	if path == "" {
+		JSONError(w, http.StatusBadRequest, "path is required")
+		return
+	}
+	if req.Line < 1 {
+		JSONError(w, http.StatusBadRequest, "line must be at least 1")
+		return
+	}
+	if req.CommitSHA == "" {
+		JSONError(w, http.StatusBadRequest, "commit_sha is required")
+		return
+	}
+
+	gitRepo, ok := s.openGitRepoForRepo(w, repo)
+	if !ok {
+		return
+	}
+
+	commit, _, ok := s.loadCommitFromRef(w, gitRepo, req.CommitSHA)
+	if !ok {
+		return
+	}
+
+	// The base defaults to the first parent, the diff shown for a commit.
+	var base *object.Commit
+	if req.BaseSHA != nil {
+		if *req.BaseSHA != "" {
+			base, _, ok = s.loadCommitFromRef(w, gitRepo, *req.BaseSHA)
+			if !ok {
+				return
+			}
+		}
+	} else if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get parent commit")
+			return
+		}
+		base = parent
+	}
+
+	lineCommit := commit
+	if side == store.ReviewSideOld {
+		if base == nil {
+			JSONError(w, http.StatusBadRequest, "A comment on the old side needs a base commit")
+			return
+		}
+		lineCommit = base
+	}
+
+	if msg := checkReviewLine(lineCommit, path, req.Line); msg != "" {
+		JSONError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	var ref *string
+	if req.Ref != "" {
+		branch, err := validateBranchName(req.Ref)
+		if err != nil {
+			JSONError(w, http.StatusBadRequest, "ref: "+err.Error())
+			return
+		}
+		head, err := branchHead(gitRepo, branch)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get branch")
+			return
+		}
+		if head != commit.Hash.String() {
+			JSONError(w, http.StatusBadRequest, "commit_sha must be the head of ref")
+			return
+		}
+		ref = &branch
+	}
+
+	baseSHA := ""
+	if base != nil {
+		baseSHA = base.Hash.String()
+	}
+
+	now := time.Now()
+	thread := &store.ReviewThread{
+		ID:                uuid.New().String(),
+		RepoID:            repo.ID,
+		CommitSHA:         commit.Hash.String(),
+		BaseSHA:           baseSHA,
+		Path:              path,
+		Side:              side,
+		Line:              req.Line,
+		Ref:               ref,
+		OriginalCommitSHA: commit.Hash.String(),
+		OriginalLine:      req.Line,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	comment := &store.ReviewComment{
+		ID:        uuid.New().String(),
+		ThreadID:  thread.ID,
+		AuthorID:  token.UserID,
+		Body:      req.Body,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.store.CreateReviewThread(thread, comment); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to create review thread")
+		return
+	}
+
+	created, err := s.store.GetReviewThread(repo.ID, thread.ID)
+	if err != nil || created == nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get review thread")
+		return
+	}
+
+	JSON(w, http.StatusCreated, created)
+}
+
+// checkReviewLine returns an error message unless line is a line of the text
+// file at path in commit.
+func checkReviewLine(commit *object.Commit, path string, line int) string {
+	file, err := commit.File(path)
+	if errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return fmt.Sprintf("Path not found in %s: %s", commit.Hash.String()[:7], path)
+	}
+	if err != nil {
+		return "Invalid path"
+	}
+
+	binary, err := file.IsBinary()
+	if err != nil {
+		return "Failed to read file"
+	}
+	if binary {
+		return "Cannot comment on a binary file"
+	}
+
+	lines, err := file.Lines()
+	if err != nil {
+		return "Failed to read file"
+	}
+	if line > len(lines) {
+		return fmt.Sprintf("line must be at most %d", len(lines))
+	}
+	return ""
+}
+
+// handleUpdateReviewThread resolves or unresolves a thread. The author of the
+// thread's first comment may do so; anyone else needs repo:write.
+func (s *Server) handleUpdateReviewThread(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccess(w, r, token)
+	if repo == nil {
+		return
+	}
+
+	thread := s.getReviewThreadForRepo(w, r, repo)
+	if thread == nil {
+		return
+	}
+
+	var req updateReviewThreadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Resolved == nil {
+		JSON(w, http.StatusOK, thread)
+		return
+	}
+
+	startedBy := thread.Comments[0].AuthorID
+	if startedBy == nil || *startedBy != *token.UserID {
+		if !s.requireRepoPermission(w, token, repo, store.PermRepoWrite) {
+			return
+		}
+	}
+
+	now := time.Now()
+	if *req.Resolved && !thread.Resolved {
+		thread.Resolved = true
+		thread.ResolvedBy = token.UserID
+		thread.ResolvedAt = &now
+	} else if !*req.Resolved {
+		thread.Resolved = false
+		thread.ResolvedBy = nil
+		thread.ResolvedAt = nil
+	}
+	thread.UpdatedAt = now
+
+	if err := s.store.UpdateReviewThread(thread); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			JSONError(w, http.StatusNotFound, "Review thread not found")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to update review thread")
+		return
+	}
+
+	JSON(w, http.StatusOK, thread)
+}
+
+func (s *Server) handleCreateReviewComment(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccess(w, r, token)
+	if repo == nil {
+		return
+	}
+
+	thread := s.getReviewThreadForRepo(w, r, repo)
+	if thread == nil {
+		return
+	}
+
+	var req reviewCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if msg := validateReviewCommentBody(req.Body); msg != "" {
+		JSONError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	now := time.Now()
+	comment := &store.ReviewComment{
+		ID:        uuid.New().String(),
+		ThreadID:  thread.ID,
+		AuthorID:  token.UserID,
+		Body:      req.Body,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.store.CreateReviewComment(comment); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to create review comment")
+		return
+	}
+
+	created, err := s.store.GetReviewComment(thread.ID, comment.ID)
+	if err != nil || created == nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get review comment")
+		return
+	}
+
+	JSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) getReviewCommentForThread(w http.ResponseWriter, r *http.Request, thread *store.ReviewThread) *store.ReviewComment {
+	comment, err := s.store.GetReviewComment(thread.ID, chi.URLParam(r, "commentID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get review comment")
+		return nil
+	}
+	if comment == nil {
+		JSONError(w, http.StatusNotFound, "Review comment not found")
+		return nil
+	}
+	return comment
+}
+
+// handleUpdateReviewComment edits a comment. Only its author may edit it.
+func (s *Server) handleUpdateReviewComment(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccess(w, r, token)
+	if repo == nil {
+		return
+	}
+
+	thread := s.getReviewThreadForRepo(w, r, repo)
+	if thread == nil {
+		return
+	}
+
+	comment := s.getReviewCommentForThread(w, r, thread)
+	if comment == nil {
+		return
+	}
+
+	if comment.AuthorID == nil || *comment.AuthorID != *token.UserID {
+		JSONError(w, http.StatusForbidden, "Only the author can edit a comment")
+		return
+	}
+
+	var req reviewCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if msg := validateReviewCommentBody(req.Body); msg != "" {
+		JSONError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	comment.Body = req.Body
+	comment.UpdatedAt = time.Now()
+	if err := s.store.UpdateReviewComment(comment); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			JSONError(w, http.StatusNotFound, "Review comment not found")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to update review comment")
+		return
+	}
+
+	JSON(w, http.StatusOK, comment)
+}
+
+// handleDeleteReviewComment deletes a comment, and its thread if it was the
+// last one. Authors may delete their own comments; others need repo:admin.
+func (s *Server) handleDeleteReviewComment(w http.ResponseWriter, r *http.Request) {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return
+	}
+
+	repo := s.requireRepoAccess(w, r, token)
+	if repo == nil {
+		return
+	}
+
+	thread := s.getReviewThreadForRepo(w, r, repo)
+	if thread == nil {
+		return
+	}
+
+	comment := s.getReviewCommentForThread(w, r, thread)
+	if comment == nil {
+		return
+	}
+
+	if comment.AuthorID == nil || *comment.AuthorID != *token.UserID {
+		if !s.requireRepoPermission(w, token, repo, store.PermRepoAdmin) {
+			return
+		}
+	}
+
+	if err := s.store.DeleteReviewComment(comment.ID); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to delete review comment")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
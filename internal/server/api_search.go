@@ -0,0 +1,452 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const (
+	searchModeLiteral = "literal"
+	searchModeRegex   = "regex"
+)
+
+const (
+	defaultSearchContext    = 2
+	maxSearchContext        = 10
+	maxSearchQueryLength    = 256
+	maxSearchMatchesPerFile = 20
+	maxSearchLineLength     = 500
+	searchScanBatchSize     = 100
+
+	// maxCodeSearchScan bounds how many indexed documents one search request
+	// reads, which matters for queries the index cannot narrow.
+	maxCodeSearchScan = 5000
+
+	// minIndexedSearchLength is the shortest string the trigram index can match.
+	minIndexedSearchLength = 3
+)
+
+// CodeSearchResult is a file on a repo's default branch with matching lines.
+type CodeSearchResult struct {
+	RepoID    string            `json:"repo_id"`
+	Repo      string            `json:"repo"`
+	Namespace string            `json:"namespace"`
+	Path      string            `json:"path"`
+	BlobSHA   string            `json:"blob_sha"`
+	Ref       string            `json:"ref"`
+	CommitSHA string            `json:"commit_sha"`
+	Matches   []CodeSearchMatch `json:"matches"`
+	// Truncated is set when the file has more matching lines than returned.
+	Truncated bool `json:"truncated"`
+}
+
+// CodeSearchMatch is a matching line with the lines around it.
+type CodeSearchMatch struct {
+	LineNumber int    `json:"line_number"`
+	Line       string `json:"line"`
+	// Ranges are the [start, end) byte offsets of each match within Line.
+	Ranges [][2]int `json:"ranges"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// codeSearch is a parsed code search request.
+type codeSearch struct {
+	pattern *regexp.Regexp
+	// contains narrows candidate documents through the index; empty when the
+	// query has no literal long enough to use.
+	contains   string
+	pathFilter string
+	context    int
+}
+
+func (s *Server) handleSearchCode(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	search, errMsg := parseCodeSearch(query.Get("q"), query.Get("mode"), query.Get("case_sensitive") == "true", query.Get("path"), query.Get("context"))
+	if errMsg != "" {
+		JSONError(w, http.StatusBadRequest, errMsg)
+		return
+	}
+
+	var afterID int64
+	if cursor := query.Get("cursor"); cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || id < 0 {
+			JSONError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		afterID = id
+	}
+	limit := parseLimit(query.Get("limit"), defaultPageSize)
+
+	token := GetTokenFromContext(r.Context())
+	if token != nil && token.IsAdmin {
+		JSONError(w, http.StatusForbidden, "Admin token cannot be used for this operation")
+		return
+	}
+
+	nsName := query.Get("namespace")
+	if nsName == "" {
+		nsName = r.Header.Get("X-Namespace")
+	}
+
+	ns := s.resolveSearchNamespace(w, token, nsName)
+	if ns == nil {
+		return
+	}
+
+	repos, ok := s.searchableRepos(w, token, ns, query.Get("repo"))
+	if !ok {
+		return
+	}
+
+	reposByID := make(map[string]*store.Repo, len(repos))
+	states := make(map[string]*store.SearchIndexState, len(repos))
+	repoIDs := make([]string, 0, len(repos))
+	for i := range repos {
+		state, err := s.store.GetSearchIndexState(repos[i].ID)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get search index state")
+			return
+		}
+		if state == nil {
+			continue
+		}
+		reposByID[repos[i].ID] = &repos[i]
+		states[repos[i].ID] = state
+		repoIDs = append(repoIDs, repos[i].ID)
+	}
+
+	var results []CodeSearchResult
+	var resultIDs []int64
+	scanned := 0
+	for len(results) <= limit && scanned < maxCodeSearchScan {
+		batch := min(searchScanBatchSize, maxCodeSearchScan-scanned)
+		docs, err := s.store.SearchDocuments(store.SearchDocumentQuery{
+			RepoIDs:  repoIDs,
+			Contains: search.contains,
+			AfterID:  afterID,
+			Limit:    batch,
+		})
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to search code")
+			return
+		}
+
+		for _, doc := range docs {
+			afterID = doc.ID
+			scanned++
+			if !matchSearchPath(search.pathFilter, doc.Path) {
+				continue
+			}
+
+			matches, truncated := findSearchMatches(doc.Content, search.pattern, search.context)
+			if len(matches) == 0 {
+				continue
+			}
+
+			repo, state := reposByID[doc.RepoID], states[doc.RepoID]
+			results = append(results, CodeSearchResult{
+				RepoID:    repo.ID,
+				Repo:      repo.Name,
+				Namespace: ns.Name,
+				Path:      doc.Path,
+				BlobSHA:   doc.BlobSHA,
+				Ref:       strings.TrimPrefix(state.Ref, "refs/heads/"),
+				CommitSHA: state.CommitSHA,
+				Matches:   matches,
+				Truncated: truncated,
+			})
+			resultIDs = append(resultIDs, doc.ID)
+			if len(results) > limit {
+				break
+			}
+		}
+
+		if len(docs) < batch {
+			break
+		}
+	}
+
+	// When the scan limit is hit first, the next page resumes after the last
+	// document read.
+	var nextCursor *string
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+		c := strconv.FormatInt(resultIDs[limit-1], 10)
+		nextCursor = &c
+	} else if scanned == maxCodeSearchScan {
+		hasMore = true
+		c := strconv.FormatInt(afterID, 10)
+		nextCursor = &c
+	}
+
+	if results == nil {
+		results = []CodeSearchResult{}
+	}
+
+	JSONList(w, results, nextCursor, hasMore)
+}
+
+// parseCodeSearch validates search parameters. It returns an error message
+// suitable for a 400 response if they are invalid.
+func parseCodeSearch(q, mode string, caseSensitive bool, pathFilter, contextStr string) (*codeSearch, string) {
+	if q == "" {
+		return nil, "Query is required"
+	}
+	if len(q) > maxSearchQueryLength {
+		return nil, fmt.Sprintf("Query must be at most %d bytes", maxSearchQueryLength)
+	}
+
+	flags := ""
+	if !caseSensitive {
+		flags = "(?i)"
+	}
+
+	search := &codeSearch{pathFilter: pathFilter, context: defaultSearchContext}
+
+	switch mode {
+	case "", searchModeLiteral:
+		search.pattern = regexp.MustCompile(flags + regexp.QuoteMeta(q))
+		search.contains = q
+	case searchModeRegex:
+		pattern, err := regexp.Compile(flags + q)
+		if err != nil {
+			return nil, fmt.Sprintf("Invalid regular expression: %v", err)
+		}
+		if pattern.MatchString("") {
+			return nil, "Regular expression must not match empty text"
+		}
+		search.pattern = pattern
+
+		if parsed, err := syntax.Parse(flags+q, syntax.Perl); err == nil {
+			search.contains = requiredLiteral(parsed.Simplify())
+		}
+	default:
+		return nil, "Mode must be literal or regex"
+	}
+
+	if utf8.RuneCountInString(search.contains) < minIndexedSearchLength {
+		search.contains = ""
+	}
+
+	if pathFilter != "" {
+		if _, err := path.Match(strings.TrimSuffix(pathFilter, "/"), ""); err != nil {
+			return nil, "Invalid path filter"
+		}
+	}
+
+	if contextStr != "" {
+		n, err := strconv.Atoi(contextStr)
+		if err != nil || n < 0 || n > maxSearchContext {
+			return nil, fmt.Sprintf("Context must be between 0 and %d", maxSearchContext)
+		}
+		search.context = n
+	}
+
+	return search, ""
+}
+
+// requiredLiteral returns the longest literal string that every match of a
+// regular expression contains, or "" if there is none.
+func requiredLiteral(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return string(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredLiteral(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		var longest string
+		for _, sub := range re.Sub {
+			if lit := requiredLiteral(sub); len(lit) > len(longest) {
+				longest = lit
+			}
+		}
+		return longest
+	}
+	return ""
+}
+
+// matchSearchPath reports whether a file path passes a path filter. A filter
+// ending in "/" matches everything under that directory. Otherwise it is a
+// glob matched against the whole path, or against the file name if the
+// filter has no "/".
+func matchSearchPath(filter, filePath string) bool {
+	if filter == "" {
+		return true
+	}
+	if dir, ok := strings.CutSuffix(filter, "/"); ok {
+		return strings.HasPrefix(filePath, dir+"/")
+	}
+	if !strings.Contains(filter, "/") {
+		filePath = path.Base(filePath)
+	}
+	matched, _ := path.Match(filter, filePath)
+	return matched
+}
+
+// findSearchMatches returns the lines of content that match pattern, each
+// with up to contextLines lines on either side. It reports whether matching
+// lines past the per-file limit were left out.
+func findSearchMatches(content string, pattern *regexp.Regexp, contextLines int) ([]CodeSearchMatch, bool) {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	var matches []CodeSearchMatch
+	for i, line := range lines {
+		locs := pattern.FindAllStringIndex(line, -1)
+		if locs == nil {
+			continue
+		}
+		if len(matches) == maxSearchMatchesPerFile {
+			return matches, true
+		}
+
+		shown := truncateSearchLine(line)
+		var ranges [][2]int
+		for _, loc := range locs {
+			if loc[0] >= len(shown) {
+				break
+			}
+			ranges = append(ranges, [2]int{loc[0], min(loc[1], len(shown))})
+		}
+
+		matches = append(matches, CodeSearchMatch{
+			LineNumber: i + 1,
+			Line:       shown,
+			Ranges:     ranges,
+			Before:     truncateSearchLines(lines[max(0, i-contextLines):i]),
+			After:      truncateSearchLines(lines[i+1 : min(len(lines), i+1+contextLines)]),
+		})
+	}
+
+	return matches, false
+}
+
+// truncateSearchLine shortens long lines, such as those in minified files, on
+// a rune boundary.
+func truncateSearchLine(line string) string {
+	if len(line) <= maxSearchLineLength {
+		return line
+	}
+	cut := maxSearchLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut]
+}
+
+func truncateSearchLines(lines []string) []string {
+	if len(lines) == 0 {
+		return nil
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = truncateSearchLine(line)
+	}
+	return out
+}
+
+// resolveSearchNamespace returns the namespace to search, defaulting to the
+// user's primary namespace. Anonymous searches must name a namespace.
+func (s *Server) resolveSearchNamespace(w http.ResponseWriter, token *store.Token, name string) *store.Namespace {
+	if name == "" && token == nil {
+		JSONError(w, http.StatusBadRequest, "Namespace is required")
+		return nil
+	}
+
+	nsID := s.resolveNamespaceID(w, token, &name)
+	if nsID == "" {
+		return nil
+	}
+
+	ns, err := s.store.GetNamespace(nsID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get namespace")
+		return nil
+	}
+	if ns == nil {
+		JSONError(w, http.StatusNotFound, "Namespace not found")
+		return nil
+	}
+	return ns
+}
+
+// searchableRepos returns the repos in a namespace that the token can read:
+// public repos, plus those the token's user has read access to. If repoName
+// is set, only that repo is searched and it must be readable.
+func (s *Server) searchableRepos(w http.ResponseWriter, token *store.Token, ns *store.Namespace, repoName string) ([]store.Repo, bool) {
+	if repoName != "" {
+		repo, err := s.store.GetRepo(ns.ID, repoName)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get repository")
+			return nil, false
+		}
+		if repo == nil {
+			JSONError(w, http.StatusNotFound, "Repository not found")
+			return nil, false
+		}
+
+		canRead, err := s.canReadRepo(token, repo)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to check access")
+			return nil, false
+		}
+		if !canRead {
+			if token == nil {
+				JSONError(w, http.StatusUnauthorized, "Authentication required")
+			} else {
+				JSONError(w, http.StatusForbidden, "Access denied")
+			}
+			return nil, false
+		}
+		return []store.Repo{*repo}, true
+	}
+
+	repos, err := listNamespaceRepos(s.store, ns.ID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list repos")
+		return nil, false
+	}
+
+	var readable []store.Repo
+	for i := range repos {
+		canRead, err := s.canReadRepo(token, &repos[i])
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to check access")
+			return nil, false
+		}
+		if canRead {
+			readable = append(readable, repos[i])
+		}
+	}
+	return readable, true
+}
+
+// canReadRepo reports whether a token, which may be nil for anonymous
+// requests, can read a repo's content.
+func (s *Server) canReadRepo(token *store.Token, repo *store.Repo) (bool, error) {
+	if repo.Public {
+		return true, nil
+	}
+	if token == nil {
+		return false, nil
+	}
+	return s.permissions.CheckRepoPermission(token.ID, repo, store.PermRepoRead)
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+type createUserTokenRequest struct {
+	Name      *string        `json:"name,omitempty"`
+	ExpiresIn *int           `json:"expires_in_seconds,omitempty"`
+	Scope     *tokenScopeAPI `json:"scope,omitempty"`
+}
+
+// userTokenResponse describes one of the current user's tokens. Current marks
+// the token the request was made with.
+type userTokenResponse struct {
+	ID         string         `json:"id"`
+	Name       *string        `json:"name,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time     `json:"last_used_at,omitempty"`
+	Scope      *tokenScopeAPI `json:"scope,omitempty"`
+	Current    bool           `json:"current"`
+}
+
+type createUserTokenResponse struct {
+	Token    string            `json:"token"`
+	Metadata userTokenResponse `json:"metadata"`
+}
+
+func userTokenToResponse(t store.Token, currentID string) userTokenResponse {
+	return userTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		Scope:      tokenScopeToAPI(t.Scope),
+		Current:    t.ID == currentID,
+	}
+}
+
+// tokenScopeAPI is a token scope as sent and returned by the API. An empty
+// allow list places no limit on permissions.
+type tokenScopeAPI struct {
+	Allow        []string `json:"allow"`
+	RepoIDs      []string `json:"repo_ids,omitempty"`
+	NamespaceIDs []string `json:"namespace_ids,omitempty"`
+}
+
+func tokenScopeToAPI(scope *store.TokenScope) *tokenScopeAPI {
+	if scope == nil {
+		return nil
+	}
+	allow := scope.Allow.ToStrings()
+	if allow == nil {
+		allow = []string{}
+	}
+	return &tokenScopeAPI{Allow: allow, RepoIDs: scope.RepoIDs, NamespaceIDs: scope.NamespaceIDs}
+}
+
+// generateTokenForUser decodes a token request and creates the token for the
+// given user. It writes an error response and returns a nil token on failure.
+func (s *Server) generateTokenForUser(w http.ResponseWriter, r *http.Request, userID string) (string, *store.Token) {
+	var req createUserTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return "", nil
+	}
+
+	if req.ExpiresIn != nil && *req.ExpiresIn < 0 {
+		JSONError(w, http.StatusBadRequest, "expires_in_seconds cannot be negative")
+		return "", nil
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != nil {
+		exp := time.Now().Add(time.Duration(*req.ExpiresIn) * time.Second)
+		expiresAt = &exp
+	}
+
+	var scope *store.TokenScope
+	if req.Scope != nil {
+		if scope = s.parseTokenScope(w, req.Scope); scope == nil {
+			return "", nil
+		}
+	}
+
+	rawToken, token, err := s.store.GenerateUserToken(userID, req.Name, expiresAt, scope)
+	if err != nil {
+		if errors.Is(err, store.ErrTokenLookupCollision) {
+			JSONError(w, http.StatusInternalServerError, "Failed to create token after retries")
+			return "", nil
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to create token")
+		return "", nil
+	}
+
+	return rawToken, token
+}
+
+// parseTokenScope validates a requested token scope, writing an error
+// response if it is invalid.
+func (s *Server) parseTokenScope(w http.ResponseWriter, req *tokenScopeAPI) *store.TokenScope {
+	if len(req.Allow) == 0 && len(req.RepoIDs) == 0 && len(req.NamespaceIDs) == 0 {
+		JSONError(w, http.StatusBadRequest, "scope must set allow, repo_ids or namespace_ids")
+		return nil
+	}
+
+	allow, err := store.ParsePermissions(req.Allow)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid permission: "+err.Error())
+		return nil
+	}
+
+	for _, id := range req.RepoIDs {
+		repo, err := s.store.GetRepoByID(id)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get repo")
+			return nil
+		}
+		if repo == nil {
+			JSONError(w, http.StatusNotFound, "Repository not found: "+id)
+			return nil
+		}
+	}
+
+	for _, id := range req.NamespaceIDs {
+		ns, err := s.store.GetNamespace(id)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to get namespace")
+			return nil
+		}
+		if ns == nil {
+			JSONError(w, http.StatusNotFound, "Namespace not found: "+id)
+			return nil
+		}
+	}
+
+	return &store.TokenScope{
+		Allow:        allow,
+		RepoIDs:      slices.Compact(slices.Sorted(slices.Values(req.RepoIDs))),
+		NamespaceIDs: slices.Compact(slices.Sorted(slices.Values(req.NamespaceIDs))),
+	}
+}
+
+func (s *Server) handleListOwnTokens(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireTokenUserID(w, r, "tokens")
+	if userID == "" {
+		return
+	}
+
+	tokens, err := s.store.ListUserTokens(userID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list tokens")
+		return
+	}
+
+	current := GetTokenFromContext(r.Context())
+	resp := make([]userTokenResponse, len(tokens))
+	for i, t := range tokens {
+		resp[i] = userTokenToResponse(t, current.ID)
+	}
+
+	JSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateOwnToken(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireTokenUserID(w, r, "tokens")
+	if userID == "" {
+		return
+	}
+
+	rawToken, token := s.generateTokenForUser(w, r, userID)
+	if token == nil {
+		return
+	}
+
+	JSON(w, http.StatusCreated, createUserTokenResponse{
+		Token:    rawToken,
+		Metadata: userTokenToResponse(*token, ""),
+	})
+}
+
+func (s *Server) handleDeleteOwnToken(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireTokenUserID(w, r, "tokens")
+	if userID == "" {
+		return
+	}
+
+	token, err := s.store.GetTokenByID(chi.URLParam(r, "tokenID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get token")
+		return
+	}
+	if token == nil || token.UserID == nil || *token.UserID != userID {
+		JSONError(w, http.StatusNotFound, "Token not found")
+		return
+	}
+
+	if err := s.store.DeleteToken(token.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			JSONError(w, http.StatusNotFound, "Token not found")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to delete token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
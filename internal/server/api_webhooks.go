@@ -0,0 +1,417 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// webhookScope is the repo or namespace that owns the hooks being managed.
+// Exactly one of the fields is set.
+type webhookScope struct {
+	repoID      *string
+	namespaceID *string
+}
+
+func (sc *webhookScope) owns(hook *store.Webhook) bool {
+	if sc.repoID != nil {
+		return hook.RepoID != nil && *hook.RepoID == *sc.repoID
+	}
+	return hook.NamespaceID != nil && *hook.NamespaceID == *sc.namespaceID
+}
+
+// webhookScopeResolver authorizes the request and returns the scope, or writes an error.
+type webhookScopeResolver func(w http.ResponseWriter, r *http.Request) *webhookScope
+
+type webhookRequest struct {
+	URL    *string   `json:"url,omitempty"`
+	Secret *string   `json:"secret,omitempty"`
+	Events *[]string `json:"events,omitempty"`
+	Active *bool     `json:"active,omitempty"`
+}
+
+type webhookResponse struct {
+	ID          string    `json:"id"`
+	RepoID      *string   `json:"repo_id,omitempty"`
+	NamespaceID *string   `json:"namespace_id,omitempty"`
+	URL         string    `json:"url"`
+	HasSecret   bool      `json:"has_secret"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type webhookDeliveryResponse struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	ResponseBody   *string         `json:"response_body,omitempty"`
+	Error          *string         `json:"error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+func webhookToResponse(hook store.Webhook) webhookResponse {
+	return webhookResponse{
+		ID:          hook.ID,
+		RepoID:      hook.RepoID,
+		NamespaceID: hook.NamespaceID,
+		URL:         hook.URL,
+		HasSecret:   hook.Secret != "",
+		Events:      hook.Events,
+		Active:      hook.Active,
+		CreatedAt:   hook.CreatedAt,
+		UpdatedAt:   hook.UpdatedAt,
+	}
+}
+
+func webhookDeliveryToResponse(d store.WebhookDelivery) webhookDeliveryResponse {
+	return webhookDeliveryResponse{
+		ID:             d.ID,
+		WebhookID:      d.WebhookID,
+		Event:          d.Event,
+		Payload:        json.RawMessage(d.Payload),
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		LastAttemptAt:  d.LastAttemptAt,
+		ResponseStatus: d.ResponseStatus,
+		ResponseBody:   d.ResponseBody,
+		Error:          d.Error,
+		CreatedAt:      d.CreatedAt,
+	}
+}
+
+// applyWebhookRequest copies the provided fields onto the hook, validating as it goes.
+func applyWebhookRequest(hook *store.Webhook, req webhookRequest) error {
+	if req.URL != nil {
+		u, err := url.Parse(*req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an absolute http or https URL")
+		}
+		hook.URL = u.String()
+	}
+
+	if req.Secret != nil {
+		hook.Secret = *req.Secret
+	}
+
+	if req.Events != nil {
+		events := []string{}
+		for _, event := range *req.Events {
+			if event != webhookEventAll && !slices.Contains(webhookEvents, event) {
+				return fmt.Errorf("unknown event: %s", event)
+			}
+			if !slices.Contains(events, event) {
+				events = append(events, event)
+			}
+		}
+		if len(events) == 0 {
+			return fmt.Errorf("events must not be empty")
+		}
+		hook.Events = events
+	}
+
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+
+	return nil
+}
+
+func (s *Server) requireRepoWebhookScope(w http.ResponseWriter, r *http.Request) *webhookScope {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return nil
+	}
+
+	repo := s.requireRepoAccessWithPermission(w, r, token, store.PermRepoAdmin)
+	if repo == nil {
+		return nil
+	}
+
+	return &webhookScope{repoID: &repo.ID}
+}
+
+func (s *Server) requireNamespaceWebhookScope(w http.ResponseWriter, r *http.Request) *webhookScope {
+	token := s.requireUserToken(w, r)
+	if token == nil {
+		return nil
+	}
+
+	ns, err := s.store.GetNamespaceByName(chi.URLParam(r, "name"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get namespace")
+		return nil
+	}
+	if ns == nil {
+		JSONError(w, http.StatusNotFound, "Namespace not found")
+		return nil
+	}
+
+	if !s.requireNamespacePermission(w, token, ns.ID, store.PermNamespaceAdmin) {
+		return nil
+	}
+
+	return &webhookScope{namespaceID: &ns.ID}
+}
+
+// webhookRoutes registers the webhook management API for a scope. It is mounted
+// under both /repos/{id}/hooks and /namespaces/{name}/hooks.
+func (s *Server) webhookRoutes(resolve webhookScopeResolver) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			s.handleListWebhooks(w, r, resolve)
+		})
+		r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+			s.handleCreateWebhook(w, r, resolve)
+		})
+		r.Get("/{hookID}", func(w http.ResponseWriter, r *http.Request) {
+			s.handleGetWebhook(w, r, resolve)
+		})
+		r.Patch("/{hookID}", func(w http.ResponseWriter, r *http.Request) {
+			s.handleUpdateWebhook(w, r, resolve)
+		})
+		r.Delete("/{hookID}", func(w http.ResponseWriter, r *http.Request) {
+			s.handleDeleteWebhook(w, r, resolve)
+		})
+		r.Get("/{hookID}/deliveries", func(w http.ResponseWriter, r *http.Request) {
+			s.handleListWebhookDeliveries(w, r, resolve)
+		})
+		r.Get("/{hookID}/deliveries/{deliveryID}", func(w http.ResponseWriter, r *http.Request) {
+			s.handleGetWebhookDelivery(w, r, resolve)
+		})
+		r.Post("/{hookID}/deliveries/{deliveryID}/redeliver", func(w http.ResponseWriter, r *http.Request) {
+			s.handleRedeliverWebhook(w, r, resolve)
+		})
+	}
+}
+
+// requireWebhook resolves the scope and returns the hook named in the URL if the scope owns it.
+func (s *Server) requireWebhook(w http.ResponseWriter, r *http.Request, resolve webhookScopeResolver) *store.Webhook {
+	scope := resolve(w, r)
+	if scope == nil {
+		return nil
+	}
+
+	hook, err := s.store.GetWebhook(chi.URLParam(r, "hookID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get webhook")
+		return nil
+	}
+	if hook == nil || !scope.owns(hook) {
+		JSONError(w, http.StatusNotFound, "Webhook not found")
+		return nil
+	}
+	return hook
+}
+
+func (s *Server) requireWebhookDelivery(w http.ResponseWriter, r *http.Request, hook *store.Webhook) *store.WebhookDelivery {
+	delivery, err := s.store.GetWebhookDelivery(chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to get delivery")
+		return nil
+	}
+	if delivery == nil || delivery.WebhookID != hook.ID {
+		JSONError(w, http.StatusNotFound, "Delivery not found")
+		return nil
+	}
+	return delivery
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request, resolve webhookScopeResolver) {
+	scope := resolve(w, r)
+	if scope == nil {
+		return
+	}
+
+	var hooks []store.Webhook
+	var err error
+	if scope.repoID != nil {
+		hooks, err = s.store.ListRepoWebhooks(*scope.repoID)
+	} else {
+		hooks, err = s.store.ListNamespaceWebhooks(*scope.namespaceID)
+	}
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list webhooks")
+		return
+	}
+
+	resp := make([]webhookResponse, len(hooks))
+	for i, hook := range hooks {
+		resp[i] = webhookToResponse(hook)
+	}
+
+	JSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request, resolve webhookScopeResolver) {
+	scope := resolve(w, r)
+	if scope == nil {
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.URL == nil {
+		JSONError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+
+	now := time.Now()
+	hook := &store.Webhook{
+		ID:          uuid.New().String(),
+		RepoID:      scope.repoID,
+		NamespaceID: scope.namespaceID,
+		Events:      []string{WebhookEventPush},
+		Active:      true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := applyWebhookRequest(hook, req); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.store.CreateWebhook(hook); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+
+	JSON(w, http.StatusCreated, webhookToResponse(*hook))
+}
+
+func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request, resolve webhookScopeResolver) {
+	hook := s.requireWebhook(w, r, resolve)
+	if hook == nil {
+		return
+	}
+
+	JSON(w, http.StatusOK, webhookToResponse(*hook))
+}
+
+func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request, resolve webhookScopeResolver) {
+	hook := s.requireWebhook(w, r, resolve)
+	if hook == nil {
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := applyWebhookRequest(hook, req); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	hook.UpdatedAt = time.Now()
+
+	if err := s.store.UpdateWebhook(hook); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to update webhook")
+		return
+	}
+
+	JSON(w, http.StatusOK, webhookToResponse(*hook))
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request, resolve webhookScopeResolver) {
+	hook := s.requireWebhook(w, r, resolve)
+	if hook == nil {
+		return
+	}
+
+	if err := s.store.DeleteWebhook(hook.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			JSONError(w, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request, resolve webhookScopeResolver) {
+	hook := s.requireWebhook(w, r, resolve)
+	if hook == nil {
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	limit := parseLimit(r.URL.Query().Get("limit"), defaultPageSize)
+
+	deliveries, err := s.store.ListWebhookDeliveries(hook.ID, cursor, limit+1)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to list deliveries")
+		return
+	}
+
+	deliveries, nextCursor, hasMore := paginateSlice(deliveries, limit, func(d store.WebhookDelivery) string {
+		return d.ID
+	})
+
+	resp := make([]webhookDeliveryResponse, len(deliveries))
+	for i, d := range deliveries {
+		resp[i] = webhookDeliveryToResponse(d)
+	}
+
+	JSONList(w, resp, nextCursor, hasMore)
+}
+
+func (s *Server) handleGetWebhookDelivery(w http.ResponseWriter, r *http.Request, resolve webhookScopeResolver) {
+	hook := s.requireWebhook(w, r, resolve)
+	if hook == nil {
+		return
+	}
+
+	delivery := s.requireWebhookDelivery(w, r, hook)
+	if delivery == nil {
+		return
+	}
+
+	JSON(w, http.StatusOK, webhookDeliveryToResponse(*delivery))
+}
+
+func (s *Server) handleRedeliverWebhook(w http.ResponseWriter, r *http.Request, resolve webhookScopeResolver) {
+	hook := s.requireWebhook(w, r, resolve)
+	if hook == nil {
+		return
+	}
+
+	delivery := s.requireWebhookDelivery(w, r, hook)
+	if delivery == nil {
+		return
+	}
+
+	retry, err := s.webhooks.redeliver(delivery)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to queue redelivery")
+		return
+	}
+
+	JSON(w, http.StatusAccepted, webhookDeliveryToResponse(*retry))
+}
@@ -0,0 +1,620 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const (
+	backupFormatVersion = 1
+	backupManifestName  = "manifest.json"
+	backupDBName        = "ephemeral.db"
+	backupBundleDir     = "bundles"
+	backupLFSDir        = "lfs"
+	backupReleasesDir   = "releases"
+
+	backupMaxManifestBytes = 64 << 20
+)
+
+// backupDataFiles are copied from the data directory as-is when present.
+var backupDataFiles = []string{"admin-token", sshHostKeyFile}
+
+// BackupManifest describes the contents of a backup archive. It is the last
+// entry of the archive and lists a checksum for every other entry.
+type BackupManifest struct {
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	Repos     []BackupRepo `json:"repos"`
+	Files     []BackupFile `json:"files"`
+}
+
+// BackupRepo is a repository in a backup, stored as a git bundle. Bundle is
+// empty for repos without any refs, which git cannot bundle.
+type BackupRepo struct {
+	ID          string `json:"id"`
+	NamespaceID string `json:"namespace_id"`
+	Name        string `json:"name"`
+	Head        string `json:"head,omitempty"`
+	Bundle      string `json:"bundle,omitempty"`
+}
+
+// BackupFile is an archive entry with its size and SHA-256 checksum.
+type BackupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// TotalSize returns the combined size of the files in the backup.
+func (m *BackupManifest) TotalSize() int64 {
+	var total int64
+	for _, f := range m.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// backupWriter writes a gzipped tar archive, recording the checksum of each
+// entry for the manifest.
+type backupWriter struct {
+	gz    *gzip.Writer
+	tw    *tar.Writer
+	files []BackupFile
+}
+
+func newBackupWriter(w io.Writer) *backupWriter {
+	gz := gzip.NewWriter(w)
+	return &backupWriter{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+// addFile copies a file into the archive.
+func (b *backupWriter) addFile(name, srcPath string) error {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", name, err)
+	}
+
+	return b.add(name, f, info.Size(), int64(info.Mode().Perm()), info.ModTime())
+}
+
+// add copies size bytes from r into the archive and records their checksum.
+func (b *backupWriter) add(name string, r io.Reader, size, mode int64, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    mode,
+		Size:    size,
+		ModTime: modTime,
+	}
+	if err := b.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("write header for %s: %w", name, err)
+	}
+
+	hasher := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(b.tw, hasher), r, size); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+
+	b.files = append(b.files, BackupFile{
+		Path:   name,
+		Size:   size,
+		SHA256: hex.EncodeToString(hasher.Sum(nil)),
+	})
+	return nil
+}
+
+// close writes the manifest as the final entry and flushes the archive.
+func (b *backupWriter) close(manifest any, modTime time.Time) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+
+	header := &tar.Header{
+		Name:    backupManifestName,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := b.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("write manifest header: %w", err)
+	}
+	if _, err := b.tw.Write(data); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	if err := b.tw.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	if err := b.gz.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	return nil
+}
+
+// CreateBackup writes a gzipped tar archive of the data directory to w. It is
+// safe to run while the server is running: the database is copied with
+// SQLite's online backup API, and only repos present in that copy are
+// bundled, so the archive never references a repo the database does not know.
+// LFS objects and release assets are included only when stored locally in the
+// data directory.
+func CreateBackup(ctx context.Context, st store.Store, dataDir string, w io.Writer) (*BackupManifest, error) {
+	tmpDir, err := os.MkdirTemp("", "eph-backup-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dbPath := filepath.Join(tmpDir, backupDBName)
+	if err := st.Backup(ctx, dbPath); err != nil {
+		return nil, fmt.Errorf("back up database: %w", err)
+	}
+
+	repos, err := snapshotRepos(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BackupManifest{Version: backupFormatVersion, CreatedAt: time.Now().UTC(), Repos: []BackupRepo{}}
+	b := newBackupWriter(w)
+
+	if err := b.addFile(backupDBName, dbPath); err != nil {
+		return nil, err
+	}
+
+	for _, repo := range repos {
+		entry, err := backupRepo(ctx, b, dataDir, tmpDir, repo)
+		if err != nil {
+			return nil, fmt.Errorf("back up repo %s: %w", repo.ID, err)
+		}
+		manifest.Repos = append(manifest.Repos, *entry)
+	}
+
+	for _, dir := range []string{backupLFSDir, backupReleasesDir} {
+		if err := backupStoredObjects(b, dataDir, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range backupDataFiles {
+		srcPath := filepath.Join(dataDir, name)
+		if _, err := os.Stat(srcPath); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := b.addFile(name, srcPath); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest.Files = b.files
+	if err := b.close(manifest, manifest.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// snapshotRepos lists the repos in a database copy.
+func snapshotRepos(dbPath string) ([]store.Repo, error) {
+	snapshot, err := store.NewSQLiteStore(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("open database copy: %w", err)
+	}
+	defer snapshot.Close()
+
+	repos, err := listAllRepos(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("list repos: %w", err)
+	}
+	return repos, nil
+}
+
+func backupRepo(ctx context.Context, b *backupWriter, dataDir, tmpDir string, repo store.Repo) (*BackupRepo, error) {
+	entry := &BackupRepo{ID: repo.ID, NamespaceID: repo.NamespaceID, Name: repo.Name}
+
+	repoPath, err := SafeRepoPath(dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		return nil, fmt.Errorf("resolve repo path: %w", err)
+	}
+
+	entry.Head, entry.Bundle, err = bundleRepo(ctx, b, repoPath, tmpDir, repo.ID)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// bundleRepo adds a repo to the archive as a git bundle, returning the ref
+// HEAD points to and the bundle's archive path. The path is empty for repos
+// without refs, which git cannot bundle, and for missing repo directories.
+func bundleRepo(ctx context.Context, b *backupWriter, repoPath, tmpDir, repoID string) (head, bundle string, err error) {
+	if _, err := os.Stat(repoPath); errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("repo directory missing, archiving as empty", "repo_id", repoID, "repo_path", repoPath)
+		return "", "", nil
+	}
+
+	if output, err := gitCommandOutput(ctx, repoPath, "symbolic-ref", "HEAD"); err == nil {
+		head = strings.TrimSpace(string(output))
+	}
+
+	refs, err := listRefs(ctx, repoPath)
+	if err != nil {
+		return "", "", fmt.Errorf("read refs: %w", err)
+	}
+	if len(refs) == 0 {
+		return head, "", nil
+	}
+
+	// A bundle is built from a single ref snapshot, so it is consistent even
+	// if the repo is pushed to while the archive is written.
+	bundlePath := filepath.Join(tmpDir, repoID+".bundle")
+	if _, err := gitCommandOutput(ctx, repoPath, "bundle", "create", "--quiet", bundlePath, "--all"); err != nil {
+		return "", "", err
+	}
+	defer os.Remove(bundlePath)
+
+	bundle = path.Join(backupBundleDir, repoID+".bundle")
+	if err := b.addFile(bundle, bundlePath); err != nil {
+		return "", "", err
+	}
+	return head, bundle, nil
+}
+
+// backupStoredObjects adds the objects of a local storage directory (LFS
+// objects or release assets), skipping in-progress uploads. Objects are
+// written once under their content hash, so copying them while the server
+// runs is safe.
+func backupStoredObjects(b *backupWriter, dataDir, dir string) error {
+	storageDir := filepath.Join(dataDir, dir)
+	if _, err := os.Stat(storageDir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return filepath.WalkDir(storageDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(storageDir, p)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+
+		if d.IsDir() {
+			if len(parts) == 2 && parts[1] != "objects" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(parts) < 3 || parts[1] != "objects" || !d.Type().IsRegular() {
+			return nil
+		}
+
+		return b.addFile(path.Join(dir, filepath.ToSlash(rel)), p)
+	})
+}
+
+// RestoreOptions controls a restore.
+type RestoreOptions struct {
+	// Replace allows restoring over a non-empty data directory, which is moved
+	// aside rather than deleted.
+	Replace bool
+}
+
+// RestoreReport summarizes a restore.
+type RestoreReport struct {
+	Manifest *BackupManifest
+	// PreviousDataDir is where the replaced data directory was moved, if any.
+	PreviousDataDir string
+}
+
+// RestoreBackup rebuilds a data directory from an archive written by
+// CreateBackup. The archive is unpacked and verified against its manifest in
+// a staging directory next to dataDir, which only replaces dataDir once every
+// checksum, the database and every repo have been verified. The server must
+// not be running.
+func RestoreBackup(ctx context.Context, r io.Reader, dataDir string, opts RestoreOptions) (*RestoreReport, error) {
+	dataDir, err := filepath.Abs(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve data directory: %w", err)
+	}
+
+	existing, err := dirHasEntries(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if existing && !opts.Replace {
+		return nil, fmt.Errorf("data directory %s is not empty", dataDir)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dataDir), 0755); err != nil {
+		return nil, fmt.Errorf("create parent directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(dataDir), filepath.Base(dataDir)+".restore-")
+	if err != nil {
+		return nil, fmt.Errorf("create staging directory: %w", err)
+	}
+	restored := false
+	defer func() {
+		if !restored {
+			os.RemoveAll(staging)
+		}
+	}()
+
+	manifest, err := extractBackup(r, staging)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rebuildDataDir(ctx, staging, manifest); err != nil {
+		return nil, err
+	}
+
+	report := &RestoreReport{Manifest: manifest}
+	if existing {
+		report.PreviousDataDir = fmt.Sprintf("%s.pre-restore-%d", dataDir, time.Now().Unix())
+		if err := os.Rename(dataDir, report.PreviousDataDir); err != nil {
+			return nil, fmt.Errorf("move existing data directory: %w", err)
+		}
+	} else if err := os.RemoveAll(dataDir); err != nil {
+		return nil, fmt.Errorf("remove empty data directory: %w", err)
+	}
+
+	if err := os.Rename(staging, dataDir); err != nil {
+		return nil, fmt.Errorf("move restored data directory into place: %w", err)
+	}
+	restored = true
+
+	return report, nil
+}
+
+func dirHasEntries(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read data directory: %w", err)
+	}
+	return len(entries) > 0, nil
+}
+
+// extractBackup unpacks an archive into dir and checks every entry against
+// the manifest's checksums.
+func extractBackup(r io.Reader, dir string) (*BackupManifest, error) {
+	manifestData, extracted, err := extractArchive(r, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	if manifest.Version != backupFormatVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+
+	bundles := make([]string, 0, len(manifest.Repos))
+	for _, repo := range manifest.Repos {
+		bundles = append(bundles, repo.Bundle)
+	}
+	if err := verifyArchive(manifest.Files, extracted, append(bundles, backupDBName)); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// extractArchive unpacks a gzipped tar archive into dir, returning the raw
+// manifest and the checksums of the other entries.
+func extractArchive(r io.Reader, dir string) ([]byte, map[string]BackupFile, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read archive: %w", err)
+	}
+	defer gz.Close()
+
+	var manifest []byte
+	extracted := make(map[string]BackupFile)
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("read archive: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return nil, nil, fmt.Errorf("unexpected archive entry %q", header.Name)
+		}
+		if !filepath.IsLocal(header.Name) || path.Clean(header.Name) != header.Name {
+			return nil, nil, fmt.Errorf("invalid archive path %q", header.Name)
+		}
+
+		if header.Name == backupManifestName {
+			manifest, err = io.ReadAll(io.LimitReader(tr, backupMaxManifestBytes))
+			if err != nil {
+				return nil, nil, fmt.Errorf("read manifest: %w", err)
+			}
+			continue
+		}
+
+		file, err := extractFile(tr, dir, header)
+		if err != nil {
+			return nil, nil, err
+		}
+		extracted[file.Path] = *file
+	}
+
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("archive has no manifest")
+	}
+	return manifest, extracted, nil
+}
+
+// verifyArchive checks that the extracted entries match the manifest's file
+// list exactly, and that every required path is listed. Empty required paths
+// are ignored.
+func verifyArchive(files []BackupFile, extracted map[string]BackupFile, required []string) error {
+	listed := make(map[string]bool, len(files))
+	for _, f := range files {
+		listed[f.Path] = true
+	}
+	for _, p := range required {
+		if p != "" && !listed[p] {
+			return fmt.Errorf("archive manifest does not list %s", p)
+		}
+	}
+
+	for _, want := range files {
+		got, ok := extracted[want.Path]
+		if !ok {
+			return fmt.Errorf("archive is missing %s", want.Path)
+		}
+		if got != want {
+			return fmt.Errorf("checksum mismatch for %s", want.Path)
+		}
+	}
+	if len(extracted) != len(listed) {
+		for name := range extracted {
+			if !listed[name] {
+				return fmt.Errorf("archive entry %s is not in the manifest", name)
+			}
+		}
+	}
+	return nil
+}
+
+func extractFile(tr *tar.Reader, dir string, header *tar.Header) (*BackupFile, error) {
+	dest := filepath.Join(dir, filepath.FromSlash(header.Name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, fmt.Errorf("create directory for %s: %w", header.Name, err)
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(header.Mode).Perm())
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %w", header.Name, err)
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hasher), tr)
+	if err != nil {
+		return nil, fmt.Errorf("extract %s: %w", header.Name, err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("extract %s: %w", header.Name, err)
+	}
+
+	return &BackupFile{Path: header.Name, Size: size, SHA256: hex.EncodeToString(hasher.Sum(nil))}, nil
+}
+
+// rebuildDataDir checks the extracted database and recreates each repo from
+// its bundle.
+func rebuildDataDir(ctx context.Context, dir string, manifest *BackupManifest) error {
+	st, err := store.NewSQLiteStore(filepath.Join(dir, backupDBName))
+	if err != nil {
+		return fmt.Errorf("open restored database: %w", err)
+	}
+	defer st.Close()
+
+	if err := st.CheckIntegrity(); err != nil {
+		return err
+	}
+	if err := st.Initialize(); err != nil {
+		return fmt.Errorf("migrate restored database: %w", err)
+	}
+
+	repos, err := listAllRepos(st)
+	if err != nil {
+		return fmt.Errorf("list restored repos: %w", err)
+	}
+	backedUp := make(map[string]bool, len(manifest.Repos))
+	for _, repo := range manifest.Repos {
+		backedUp[repo.ID] = true
+	}
+	for _, repo := range repos {
+		if !backedUp[repo.ID] {
+			return fmt.Errorf("repo %s is in the database but not in the backup", repo.ID)
+		}
+	}
+
+	for _, repo := range manifest.Repos {
+		repoPath, err := restoreRepo(ctx, dir, repo)
+		if err != nil {
+			return fmt.Errorf("restore repo %s: %w", repo.ID, err)
+		}
+
+		sizeBytes, err := repoDiskUsage(repoPath)
+		if err != nil {
+			return fmt.Errorf("compute size of repo %s: %w", repo.ID, err)
+		}
+		if err := st.UpdateRepoSize(repo.ID, sizeBytes); err != nil {
+			return fmt.Errorf("update size of repo %s: %w", repo.ID, err)
+		}
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, backupBundleDir)); err != nil {
+		return fmt.Errorf("remove bundles: %w", err)
+	}
+	return nil
+}
+
+func restoreRepo(ctx context.Context, dir string, repo BackupRepo) (string, error) {
+	repoPath, err := SafeRepoPath(dir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		return "", fmt.Errorf("resolve repo path: %w", err)
+	}
+	if err := unbundleRepo(ctx, repoPath, dir, repo.Head, repo.Bundle); err != nil {
+		return "", err
+	}
+	return repoPath, nil
+}
+
+// unbundleRepo creates a bare repo from a bundle written by bundleRepo.
+// bundle is relative to archiveDir and may be empty for a repo without refs.
+func unbundleRepo(ctx context.Context, repoPath, archiveDir, head, bundle string) error {
+	if err := initBareRepo(repoPath); err != nil {
+		return err
+	}
+
+	if bundle != "" {
+		bundlePath := filepath.Join(archiveDir, filepath.FromSlash(bundle))
+		if _, err := gitCommandOutput(ctx, repoPath, "fetch", "--quiet", bundlePath, "+refs/*:refs/*"); err != nil {
+			return err
+		}
+	}
+
+	if strings.HasPrefix(head, "refs/heads/") {
+		if _, err := gitCommandOutput(ctx, repoPath, "symbolic-ref", "HEAD", head); err != nil {
+			return err
+		}
+	}
+	return nil
+}
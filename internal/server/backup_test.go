@@ -0,0 +1,158 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dataDir := t.TempDir()
+	st, repo := newRepoTestStore(t)
+	ctx := context.Background()
+
+	repoPath, err := SafeRepoPath(dataDir, repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	require.NoError(t, initBareRepo(repoPath))
+
+	work := t.TempDir()
+	runGit(t, work, "init", "-q", "-b", "trunk")
+	require.NoError(t, os.WriteFile(filepath.Join(work, "README.md"), []byte("hello\n"), 0644))
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "-q", "-m", "Initial commit")
+	runGit(t, work, "tag", "v1")
+	runGit(t, work, "push", "-q", repoPath, "trunk", "v1")
+	runGit(t, repoPath, "symbolic-ref", "HEAD", "refs/heads/trunk")
+
+	now := time.Now()
+	empty := &store.Repo{ID: "repo-2", NamespaceID: "ns-1", Name: "empty", CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, st.CreateRepo(empty))
+	emptyPath, err := SafeRepoPath(dataDir, empty.NamespaceID, empty.Name)
+	require.NoError(t, err)
+	require.NoError(t, initBareRepo(emptyPath))
+
+	oid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	lfsObject := filepath.Join(dataDir, "lfs", repo.ID, "objects", oid[:2], oid[2:4], oid)
+	require.NoError(t, os.MkdirAll(filepath.Dir(lfsObject), 0755))
+	require.NoError(t, os.WriteFile(lfsObject, []byte("large file"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, "lfs", repo.ID, "tmp"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "lfs", repo.ID, "tmp", "upload-1"), []byte("partial"), 0644))
+	releaseAsset := filepath.Join(dataDir, "releases", repo.ID, "objects", oid[:2], oid[2:4], oid)
+	require.NoError(t, os.MkdirAll(filepath.Dir(releaseAsset), 0755))
+	require.NoError(t, os.WriteFile(releaseAsset, []byte("large file"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "admin-token"), []byte("eph_admin"), 0600))
+
+	var archive bytes.Buffer
+	manifest, err := CreateBackup(ctx, st, dataDir, &archive)
+	require.NoError(t, err)
+	assert.Len(t, manifest.Repos, 2)
+
+	restoreDir := filepath.Join(t.TempDir(), "data")
+	report, err := RestoreBackup(ctx, bytes.NewReader(archive.Bytes()), restoreDir, RestoreOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, report.PreviousDataDir)
+
+	restoredPath, err := SafeRepoPath(restoreDir, repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	refs, err := listRefs(ctx, restoredPath)
+	require.NoError(t, err)
+	original, err := listRefs(ctx, repoPath)
+	require.NoError(t, err)
+	assert.Equal(t, original, refs)
+
+	head, err := gitCommandOutput(ctx, restoredPath, "symbolic-ref", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "refs/heads/trunk\n", string(head))
+
+	restoredEmpty, err := SafeRepoPath(restoreDir, empty.NamespaceID, empty.Name)
+	require.NoError(t, err)
+	assert.DirExists(t, restoredEmpty)
+
+	content, err := os.ReadFile(filepath.Join(restoreDir, "lfs", repo.ID, "objects", oid[:2], oid[2:4], oid))
+	require.NoError(t, err)
+	assert.Equal(t, "large file", string(content))
+	assert.NoDirExists(t, filepath.Join(restoreDir, "lfs", repo.ID, "tmp"), "in-progress uploads are skipped")
+	assert.FileExists(t, filepath.Join(restoreDir, "releases", repo.ID, "objects", oid[:2], oid[2:4], oid))
+	assert.FileExists(t, filepath.Join(restoreDir, "admin-token"))
+	assert.NoDirExists(t, filepath.Join(restoreDir, backupBundleDir))
+
+	restored, err := store.NewSQLiteStore(filepath.Join(restoreDir, backupDBName))
+	require.NoError(t, err)
+	defer restored.Close()
+	got, err := restored.GetRepoByID(repo.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Positive(t, got.SizeBytes)
+
+	t.Run("refuses to overwrite without replace", func(t *testing.T) {
+		_, err := RestoreBackup(ctx, bytes.NewReader(archive.Bytes()), restoreDir, RestoreOptions{})
+		assert.ErrorContains(t, err, "not empty")
+	})
+
+	t.Run("moves replaced data directory aside", func(t *testing.T) {
+		report, err := RestoreBackup(ctx, bytes.NewReader(archive.Bytes()), restoreDir, RestoreOptions{Replace: true})
+		require.NoError(t, err)
+		assert.DirExists(t, report.PreviousDataDir)
+		assert.FileExists(t, filepath.Join(restoreDir, backupDBName))
+	})
+
+	t.Run("rejects tampered archives", func(t *testing.T) {
+		tampered := rewriteArchive(t, archive.Bytes(), "admin-token", []byte("eph_other"))
+		target := filepath.Join(t.TempDir(), "data")
+
+		_, err := RestoreBackup(ctx, bytes.NewReader(tampered), target, RestoreOptions{})
+		assert.ErrorContains(t, err, "checksum mismatch")
+		assert.NoDirExists(t, target)
+
+		entries, err := os.ReadDir(filepath.Dir(target))
+		require.NoError(t, err)
+		assert.Empty(t, entries, "staging directory is removed")
+	})
+}
+
+// rewriteArchive returns a copy of a backup archive with one entry's content replaced.
+func rewriteArchive(t *testing.T, archive []byte, name string, content []byte) []byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	var out bytes.Buffer
+	gzw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gzw)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		if header.Name == name {
+			data = content
+			header.Size = int64(len(content))
+		}
+
+		require.NoError(t, tw.WriteHeader(header))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	return out.Bytes()
+}
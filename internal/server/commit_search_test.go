@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommitFilter(t *testing.T) {
+	filter, errMsg := parseCommitFilter(url.Values{
+		"author": {"Alice@Example.com"},
+		"since":  {"2024-03-04"},
+		"until":  {"2024-03-10"},
+		"grep":   {"^Fix"},
+	})
+	require.Empty(t, errMsg)
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), *filter.since)
+	assert.Equal(t, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond), *filter.until,
+		"a date as upper bound covers the whole day")
+
+	commit := &object.Commit{
+		Author:    object.Signature{Email: "alice@example.com", When: time.Date(2024, 3, 10, 23, 0, 0, 0, time.UTC)},
+		Committer: object.Signature{Email: "bot@example.com", When: time.Date(2024, 3, 10, 23, 0, 0, 0, time.UTC)},
+		Message:   "Fix login redirect\n",
+	}
+	assert.True(t, filter.match(commit))
+
+	commit.Message = "Add login redirect\n"
+	assert.False(t, filter.match(commit), "grep")
+
+	t.Run("rejects invalid filters", func(t *testing.T) {
+		for _, query := range []url.Values{
+			{"since": {"last week"}},
+			{"until": {"2024-13-01"}},
+			{"since": {"2024-03-10"}, "until": {"2024-03-04"}},
+			{"grep": {"("}},
+		} {
+			_, errMsg := parseCommitFilter(query)
+			assert.NotEmpty(t, errMsg, "%v", query)
+		}
+	})
+}
+
+func TestSearchCommits(t *testing.T) {
+	gitRepo, err := git.PlainInit(t.TempDir(), false)
+	require.NoError(t, err)
+	wt, err := gitRepo.Worktree()
+	require.NoError(t, err)
+
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 12, 0, 0, 0, time.UTC) }
+	commit := func(msg, email string, when time.Time) plumbing.Hash {
+		sig := &object.Signature{Name: "test", Email: email, When: when}
+		hash, err := wt.Commit(msg, &git.CommitOptions{Author: sig, Committer: sig, AllowEmptyCommits: true})
+		require.NoError(t, err)
+		return hash
+	}
+
+	commit("Initial commit", "alice@example.com", day(1))
+	base := commit("Add parser", "bob@example.com", day(2))
+	commit("Fix parser", "alice@example.com", day(5))
+	require.NoError(t, gitRepo.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature", base)))
+	require.NoError(t, wt.Checkout(&git.CheckoutOptions{Branch: "refs/heads/feature"}))
+	commit("Add feature", "alice@example.com", day(4))
+
+	messages := func(commits []*object.Commit) []string {
+		var out []string
+		for _, c := range commits {
+			out = append(out, c.Message)
+		}
+		return out
+	}
+
+	commits, err := searchCommits(gitRepo, &commitFilter{author: "alice@example.com"}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Fix parser", "Add feature", "Initial commit"}, messages(commits),
+		"every branch is searched, newest first")
+
+	since := day(3)
+	commits, err = searchCommits(gitRepo, &commitFilter{since: &since}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Fix parser", "Add feature"}, messages(commits))
+
+	commits, err = searchCommits(gitRepo, &commitFilter{}, 2)
+	require.NoError(t, err)
+	assert.Len(t, commits, 2, "stops at max")
+}
+
+func TestListCommits_ScanLimit(t *testing.T) {
+	srv, _, repo, token := newRefAPITestServer(t)
+	repoPath, err := srv.gitHandler.getRepoPath(repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+
+	// More commits than one request scans, none of which match the filter.
+	var stream strings.Builder
+	for i := 0; i < maxCommitSearchScan+10; i++ {
+		fmt.Fprintf(&stream, "commit refs/heads/long\ncommitter Bot <bot@example.com> %d +0000\ndata 7\nfiller\n\n", 1700000000+i)
+	}
+	cmd := exec.Command("git", "-C", repoPath, "fast-import", "--quiet")
+	cmd.Stdin = strings.NewReader(stream.String())
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	rec := serveAs(srv, token, http.MethodGet, "/api/v1/repos/"+repo.ID+"/commits?ref=long&author=nobody@example.com", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp ListResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Empty(t, resp.Data)
+	assert.True(t, resp.HasMore, "the scan stopped before the end of history")
+	require.NotNil(t, resp.NextCursor)
+
+	rec = serveAs(srv, token, http.MethodGet, "/api/v1/repos/"+repo.ID+"/commits?ref=long&author=nobody@example.com&cursor="+*resp.NextCursor, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	resp = ListResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.False(t, resp.HasMore, "the next page scans the rest")
+}
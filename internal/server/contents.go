@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Codes for file changes that cannot be applied.
+const (
+	contentCodeNotFound     = "not_found"
+	contentCodeSHAMismatch  = "sha_mismatch"
+	contentCodePathConflict = "path_conflict"
+	// contentCodeRefMoved matches the merge error for a branch that moved.
+	contentCodeRefMoved = "ref_moved"
+)
+
+// fileChange is a file to write or delete in a commit made through the
+// contents API.
+type fileChange struct {
+	Path    string
+	Delete  bool
+	Content []byte
+	// ExpectedSHA, when set, is the blob the file must have before the change.
+	ExpectedSHA *string
+
+	// Mode and Exists are filled in by checkFileChanges.
+	Mode   filemode.FileMode
+	Exists bool
+}
+
+// contentError is a file change that cannot be applied to the branch.
+type contentError struct {
+	Code    string
+	Path    string
+	Message string
+}
+
+func (e *contentError) Error() string {
+	return e.Message
+}
+
+type contentErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	Path  string `json:"path,omitempty"`
+}
+
+// writeContentError reports why file changes could not be committed. Missing
+// files are 404s; other problems with the changes are 409s naming the path.
+func writeContentError(w http.ResponseWriter, err error) {
+	var contentErr *contentError
+	if !errors.As(err, &contentErr) {
+		writeMergeError(w, err)
+		return
+	}
+
+	status := http.StatusConflict
+	if contentErr.Code == contentCodeNotFound {
+		status = http.StatusNotFound
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(contentErrorResponse{
+		Error: contentErr.Message,
+		Code:  contentErr.Code,
+		Path:  contentErr.Path,
+	})
+}
+
+// normalizeContentPath validates a file path for the contents API. Returns ""
+// if invalid.
+func normalizeContentPath(p string) string {
+	p = normalizeLockPath(p)
+	if strings.IndexFunc(p, unicode.IsControl) >= 0 {
+		return ""
+	}
+	for _, part := range strings.Split(p, "/") {
+		if strings.EqualFold(part, ".git") {
+			return ""
+		}
+	}
+	return p
+}
+
+// checkFileChanges checks changes against the tree they will be applied to,
+// which is nil for a new branch, and fills in each file's current mode.
+func checkFileChanges(tree *object.Tree, changes []fileChange) error {
+	puts := make(map[string]bool, len(changes))
+	deletes := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		if c.Delete {
+			deletes[c.Path] = true
+		} else {
+			puts[c.Path] = true
+		}
+	}
+
+	entry := func(p string) *object.TreeEntry {
+		if tree == nil {
+			return nil
+		}
+		e, err := tree.FindEntry(p)
+		if err != nil {
+			return nil
+		}
+		return e
+	}
+
+	for i := range changes {
+		c := &changes[i]
+		current := entry(c.Path)
+
+		if current != nil && current.Mode == filemode.Dir {
+			return &contentError{contentCodePathConflict, c.Path, fmt.Sprintf("%s is a directory", c.Path)}
+		}
+		if current != nil && current.Mode != filemode.Regular && current.Mode != filemode.Executable {
+			return &contentError{contentCodePathConflict, c.Path, fmt.Sprintf("%s is not a regular file", c.Path)}
+		}
+
+		if current == nil && (c.Delete || c.ExpectedSHA != nil) {
+			return &contentError{contentCodeNotFound, c.Path, fmt.Sprintf("Path not found: %s", c.Path)}
+		}
+		if current != nil && c.ExpectedSHA != nil && current.Hash.String() != *c.ExpectedSHA {
+			return &contentError{contentCodeSHAMismatch, c.Path, fmt.Sprintf("%s has changed: expected blob %s, found %s", c.Path, *c.ExpectedSHA, current.Hash)}
+		}
+
+		c.Exists = current != nil
+		c.Mode = filemode.Regular
+		if current != nil {
+			c.Mode = current.Mode
+		}
+
+		if c.Delete {
+			continue
+		}
+
+		// A file cannot be written below another file that stays in place.
+		for dir := path.Dir(c.Path); dir != "."; dir = path.Dir(dir) {
+			if puts[dir] {
+				return &contentError{contentCodePathConflict, c.Path, fmt.Sprintf("%s is also written as a file", dir)}
+			}
+			if e := entry(dir); e != nil && e.Mode != filemode.Dir && !deletes[dir] {
+				return &contentError{contentCodePathConflict, c.Path, fmt.Sprintf("%s is a file", dir)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeFileChanges applies changes to the tree of parent, or to an empty tree
+// when parent is "", and writes the new tree to the repo. It returns the new
+// tree and the blob written for each change, "" for deletions.
+func writeFileChanges(ctx context.Context, repoPath, parent string, changes []fileChange) (string, []string, error) {
+	tmpDir, err := os.MkdirTemp("", "ephemeral-index-")
+	if err != nil {
+		return "", nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(tmpDir, "index"))
+	run := func(stdin []byte, args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repoPath}, args...)...)
+		cmd.Env = env
+		cmd.Stdin = bytes.NewReader(stdin)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	if parent != "" {
+		if _, err := run(nil, "read-tree", parent); err != nil {
+			return "", nil, err
+		}
+	}
+
+	blobs := make([]string, len(changes))
+	var indexInfo strings.Builder
+	for i, c := range changes {
+		if c.Delete {
+			fmt.Fprintf(&indexInfo, "0 %s\t%s\n", plumbing.ZeroHash, c.Path)
+			continue
+		}
+
+		blob, err := run(c.Content, "hash-object", "-w", "--no-filters", "--stdin")
+		if err != nil {
+			return "", nil, err
+		}
+		blobs[i] = blob
+		fmt.Fprintf(&indexInfo, "%o %s\t%s\n", uint32(c.Mode), blob, c.Path)
+	}
+
+	if _, err := run([]byte(indexInfo.String()), "update-index", "--index-info"); err != nil {
+		return "", nil, err
+	}
+
+	tree, err := run(nil, "write-tree")
+	if err != nil {
+		return "", nil, err
+	}
+	return tree, blobs, nil
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func contentsTestTree(t *testing.T) (*git.Repository, string, string, *object.Tree) {
+	t.Helper()
+
+	repoPath, work := newMergeTestRepo(t)
+	writeMergeTestFile(t, work, "run.sh", "#!/bin/sh\n")
+	require.NoError(t, os.Chmod(filepath.Join(work, "run.sh"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(work, "docs"), 0755))
+	commitMergeTestFile(t, work, "docs/guide.md", "guide\n", "Add files")
+	runGit(t, work, "push", "-q", repoPath, "main")
+
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	head := mergeTestHead(t, gitRepo, "main")
+	commit, err := gitRepo.CommitObject(plumbing.NewHash(head))
+	require.NoError(t, err)
+	tree, err := commit.Tree()
+	require.NoError(t, err)
+	return gitRepo, repoPath, head, tree
+}
+
+func TestNormalizeContentPath(t *testing.T) {
+	assert.Equal(t, "docs/a.md", normalizeContentPath("docs/a.md"))
+	assert.Equal(t, "a.md", normalizeContentPath("./a.md"))
+	for _, p := range []string{"", "/a", "a/../b", "../a", "a//b", ".git/config", "x/.GIT/y", "a\tb", "a\nb"} {
+		assert.Empty(t, normalizeContentPath(p), p)
+	}
+}
+
+func TestCheckFileChanges(t *testing.T) {
+	_, _, _, tree := contentsTestTree(t)
+	readme, err := tree.FindEntry("README")
+	require.NoError(t, err)
+	readmeSHA := readme.Hash.String()
+	stale := plumbing.ZeroHash.String()
+
+	changes := []fileChange{
+		{Path: "README", ExpectedSHA: &readmeSHA},
+		{Path: "run.sh"},
+		{Path: "new/file.txt"},
+		{Path: "docs/guide.md", Delete: true},
+	}
+	require.NoError(t, checkFileChanges(tree, changes))
+	assert.True(t, changes[0].Exists)
+	assert.Equal(t, filemode.Executable, changes[1].Mode, "updates keep the file mode")
+	assert.False(t, changes[2].Exists)
+	assert.Equal(t, filemode.Regular, changes[2].Mode)
+
+	tests := []struct {
+		name    string
+		changes []fileChange
+		code    string
+	}{
+		{"stale sha", []fileChange{{Path: "README", ExpectedSHA: &stale}}, contentCodeSHAMismatch},
+		{"delete missing", []fileChange{{Path: "nope", Delete: true}}, contentCodeNotFound},
+		{"sha for missing file", []fileChange{{Path: "nope", ExpectedSHA: &stale}}, contentCodeNotFound},
+		{"write a directory", []fileChange{{Path: "docs"}}, contentCodePathConflict},
+		{"write below a file", []fileChange{{Path: "README/x"}}, contentCodePathConflict},
+		{"write below a new file", []fileChange{{Path: "a"}, {Path: "a/b"}}, contentCodePathConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFileChanges(tree, tt.changes)
+			var contentErr *contentError
+			require.ErrorAs(t, err, &contentErr)
+			assert.Equal(t, tt.code, contentErr.Code)
+		})
+	}
+
+	// Replacing a file with a directory is fine when the file is deleted.
+	assert.NoError(t, checkFileChanges(tree, []fileChange{{Path: "README", Delete: true}, {Path: "README/x"}}))
+	assert.NoError(t, checkFileChanges(nil, []fileChange{{Path: "a/b"}}), "a new branch has no files")
+}
+
+func TestWriteFileChanges(t *testing.T) {
+	gitRepo, repoPath, head, tree := contentsTestTree(t)
+
+	changes := []fileChange{
+		{Path: "README", Content: []byte("updated\n")},
+		{Path: "new/file.txt", Content: []byte("new\n")},
+		{Path: "docs/guide.md", Delete: true},
+	}
+	require.NoError(t, checkFileChanges(tree, changes))
+
+	treeSHA, blobs, err := writeFileChanges(context.Background(), repoPath, head, changes)
+	require.NoError(t, err)
+	assert.Empty(t, blobs[2])
+
+	newTree, err := gitRepo.TreeObject(plumbing.NewHash(treeSHA))
+	require.NoError(t, err)
+
+	readme, err := newTree.File("README")
+	require.NoError(t, err)
+	content, err := readme.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "updated\n", content)
+	assert.Equal(t, blobs[0], readme.Hash.String())
+
+	_, err = newTree.File("new/file.txt")
+	assert.NoError(t, err)
+	_, err = newTree.File("docs/guide.md")
+	assert.Error(t, err, "deleted file is gone")
+
+	script, err := newTree.FindEntry("run.sh")
+	require.NoError(t, err)
+	assert.Equal(t, filemode.Executable, script.Mode, "untouched files are kept")
+
+	rootTree, _, err := writeFileChanges(context.Background(), repoPath, "", []fileChange{{Path: "only.txt", Content: []byte("x"), Mode: filemode.Regular}})
+	require.NoError(t, err)
+	root, err := gitRepo.TreeObject(plumbing.NewHash(rootTree))
+	require.NoError(t, err)
+	assert.Len(t, root.Entries, 1)
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const (
+	// userCodeAlphabet leaves out vowels and look-alike characters, so codes
+	// are easy to read out and don't spell words.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	deviceLoginPath = "/auth/device"
+)
+
+func generateUserCode() (string, error) {
+	code := make([]byte, 0, userCodeLength)
+	buf := make([]byte, userCodeLength*2)
+
+	// Bytes past the largest multiple of the alphabet size are skipped so
+	// every character is equally likely.
+	limit := byte(256 - 256%len(userCodeAlphabet))
+	for len(code) < userCodeLength {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("generate random bytes: %w", err)
+		}
+		for _, b := range buf {
+			if b < limit && len(code) < userCodeLength {
+				code = append(code, userCodeAlphabet[int(b)%len(userCodeAlphabet)])
+			}
+		}
+	}
+
+	return string(code), nil
+}
+
+// formatUserCode splits a user code in two halves for display.
+func formatUserCode(code string) string {
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// normalizeUserCode accepts a user code as typed: in any case, with or
+// without the separator.
+func normalizeUserCode(input string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(input)))
+}
+
+// createDeviceSession stores the auth session with a new user code, retrying
+// on the unlikely collision with another session's code.
+func (s *Server) createDeviceSession(session *store.AuthSession) error {
+	const maxAttempts = 3
+
+	for range maxAttempts {
+		code, err := generateUserCode()
+		if err != nil {
+			return err
+		}
+		session.UserCode = &code
+
+		err = s.store.CreateAuthSession(session)
+		if !errors.Is(err, store.ErrDuplicateUserCode) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("create device session: %w", store.ErrDuplicateUserCode)
+}
+
+// pendingDeviceSession returns the device login waiting for approval with
+// the user code.
+func (s *Server) pendingDeviceSession(userCode string) (*store.AuthSession, *authError) {
+	code := normalizeUserCode(userCode)
+	if code == "" {
+		return nil, &authError{"user_code is required", http.StatusBadRequest}
+	}
+
+	session, err := s.store.GetAuthSessionByUserCode(code)
+	if err != nil {
+		return nil, &authError{"Failed to get auth session", http.StatusInternalServerError}
+	}
+	if session == nil || time.Now().After(session.ExpiresAt) {
+		return nil, &authError{"Unknown or expired code", http.StatusNotFound}
+	}
+	if session.Status != "pending" {
+		return nil, &authError{"Code already used", http.StatusConflict}
+	}
+
+	return session, nil
+}
+
+// approveDeviceLogin completes the device login with a new token for the
+// user.
+func (s *Server) approveDeviceLogin(userCode, userID string) *authError {
+	session, authErr := s.pendingDeviceSession(userCode)
+	if authErr != nil {
+		return authErr
+	}
+
+	rawToken, token, err := s.store.GenerateUserToken(userID, nil, nil, nil)
+	if err != nil {
+		return &authError{"Failed to generate token", http.StatusInternalServerError}
+	}
+
+	if err := s.store.CompleteAuthSession(session.ID, userID, rawToken); err != nil {
+		s.store.DeleteToken(token.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return &authError{"Code already used", http.StatusConflict}
+		}
+		return &authError{"Failed to complete auth session", http.StatusInternalServerError}
+	}
+
+	return nil
+}
+
+type approveDeviceLoginRequest struct {
+	UserCode string `json:"user_code"`
+}
+
+func (s *Server) handleApproveDeviceLogin(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireTokenUserID(w, r, "device logins")
+	if userID == "" {
+		return
+	}
+
+	var req approveDeviceLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if authErr := s.approveDeviceLogin(req.UserCode, userID); authErr != nil {
+		JSONError(w, authErr.status, authErr.message)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var deviceLoginPage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Approve login - Ephemeral</title></head>
+<body style="font-family: sans-serif; max-width: 32em; margin: 4em auto">
+<h1>Approve login</h1>
+<p>Enter the code shown by <code>eph login --device</code>.</p>
+<form method="post">
+<p><label>Code <input name="user_code" value="{{.Code}}" autocomplete="off" autofocus required></label></p>
+{{if .OIDC}}<p><button>Sign in and approve</button></p>
+{{else}}<p><label>Your token <input name="token" type="password" autocomplete="off" required></label></p>
+<p><button>Approve</button></p>
+{{end}}</form>
+</body>
+</html>
+`))
+
+func (s *Server) handleDeviceLoginPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	deviceLoginPage.Execute(w, struct {
+		Code string
+		OIDC bool
+	}{r.URL.Query().Get("code"), s.oidc != nil})
+}
+
+// handleDeviceLoginForm approves a device login from the browser. With OIDC
+// the user signs in with the provider, which completes the device's session;
+// otherwise they authenticate with one of their tokens.
+//
+// The OIDC login starts here rather than at the login link: the session ID
+// is what the device polls with, so it must not reach whoever typed the code.
+func (s *Server) handleDeviceLoginForm(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderAuthPage(w, http.StatusBadRequest, "Approval failed", "Invalid form.")
+		return
+	}
+
+	if s.oidc != nil {
+		session, authErr := s.pendingDeviceSession(r.PostForm.Get("user_code"))
+		if authErr != nil {
+			renderAuthPage(w, authErr.status, "Approval failed", authErr.message+".")
+			return
+		}
+
+		target, err := s.oidc.begin(session)
+		if err != nil {
+			slog.Error("start oidc login", "error", err)
+			renderAuthPage(w, http.StatusBadGateway, "Approval failed", "The identity provider is unavailable.")
+			return
+		}
+
+		http.Redirect(w, r, target, http.StatusSeeOther)
+		return
+	}
+
+	token, err := lookupToken(s.store, strings.TrimSpace(r.PostForm.Get("token")))
+	if err != nil {
+		renderAuthPage(w, http.StatusUnauthorized, "Approval failed", err.Error()+".")
+		return
+	}
+	if token.UserID == nil || token.Scope != nil {
+		renderAuthPage(w, http.StatusForbidden, "Approval failed", "Use an unscoped token that belongs to your user.")
+		return
+	}
+
+	if authErr := s.approveDeviceLogin(r.PostForm.Get("user_code"), *token.UserID); authErr != nil {
+		renderAuthPage(w, authErr.status, "Approval failed", authErr.message+".")
+		return
+	}
+
+	renderAuthPage(w, http.StatusOK, "Login approved", "The other machine is now logged in. You can close this window.")
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,14 +28,24 @@ type GitHTTPHandler struct {
 	store       store.Store
 	dataDir     string
 	permissions *store.PermissionChecker
+	hooksDir    string
+	webhooks    *webhookDispatcher
+	pushMirrors *pushMirrorer
+	searchIndex *searchIndexer
 }
 
 // NewGitHTTPHandler creates a new Git HTTP handler.
 func NewGitHTTPHandler(st store.Store, dataDir string) *GitHTTPHandler {
+	hooksDir, err := installHooks(dataDir)
+	if err != nil {
+		slog.Warn("git hooks unavailable, pushes to protected branches will be refused and push events will not be recorded", "error", err)
+	}
+
 	return &GitHTTPHandler{
 		store:       st,
 		dataDir:     dataDir,
 		permissions: store.NewPermissionChecker(st),
+		hooksDir:    hooksDir,
 	}
 }
 
@@ -92,7 +104,7 @@ func (h *GitHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		} else {
-			hasWrite, err := h.permissions.CheckRepoPermission(token.ID, repo, store.PermRepoWrite)
+			hasWrite, err := checkGitRepoPermission(h.permissions, token, repo, store.PermRepoWrite)
 			if err != nil {
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 				return
@@ -101,6 +113,10 @@ func (h *GitHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, "Write access denied", http.StatusForbidden)
 				return
 			}
+			if repo.Mirror != nil {
+				http.Error(w, errMirrorReadOnly, http.StatusForbidden)
+				return
+			}
 		}
 	} else {
 		if repo != nil && repo.Public && token == nil {
@@ -115,7 +131,7 @@ func (h *GitHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			hasRead, err := h.permissions.CheckRepoPermission(token.ID, repo, store.PermRepoRead)
+			hasRead, err := checkGitRepoPermission(h.permissions, token, repo, store.PermRepoRead)
 			if err != nil {
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 				return
@@ -139,6 +155,15 @@ func (h *GitHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// checkGitRepoPermission checks a git credential's access to a repo. Deploy
+// keys reach only their own repo; user tokens go through the grant checks.
+func checkGitRepoPermission(permissions *store.PermissionChecker, token *store.Token, repo *store.Repo, required store.Permission) (bool, error) {
+	if token.DeployKey != nil {
+		return token.DeployKey.AllowsRepo(repo, required), nil
+	}
+	return permissions.CheckRepoPermission(token.ID, repo, required)
+}
+
 func (h *GitHTTPHandler) isWriteOperation(r *http.Request) bool {
 	if strings.HasSuffix(r.URL.Path, "/git-receive-pack") {
 		return true
@@ -155,7 +180,7 @@ func (h *GitHTTPHandler) handleInfoRefs(w http.ResponseWriter, r *http.Request,
 
 	repo, err := h.getOrCreateRepo(namespaceID, repoName, isWrite, token)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get repository: %v", err), http.StatusInternalServerError)
+		writeGetRepoError(w, err)
 		return
 	}
 	if repo == nil {
@@ -233,7 +258,11 @@ func (h *GitHTTPHandler) handleUploadPack(w http.ResponseWriter, r *http.Request
 func (h *GitHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Request, namespaceID, repoName string, token *store.Token) {
 	repo, err := h.getOrCreateRepo(namespaceID, repoName, true, token)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get repository: %v", err), http.StatusInternalServerError)
+		writeGetRepoError(w, err)
+		return
+	}
+	if repo == nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 
@@ -243,6 +272,21 @@ func (h *GitHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	actor := tokenPushActor(token)
+
+	env, hooks, err := h.receivePackEnv(actor.UserID, token.Scope, token.DeployKey, repo)
+	defer hooks.close()
+	if err != nil {
+		var qErr *quotaError
+		if errors.As(err, &qErr) {
+			writeQuotaError(w, err)
+			return
+		}
+		slog.Warn("failed to prepare receive-pack policy", "repo_id", repo.ID, "error", err)
+		http.Error(w, "Failed to load push policy", http.StatusInternalServerError)
+		return
+	}
+
 	bodyReader, err := h.getRequestBody(w, r)
 	if err != nil {
 		return
@@ -258,6 +302,7 @@ func (h *GitHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Reques
 	w.Header().Set("Cache-Control", "no-cache")
 
 	cmd := exec.CommandContext(ctx, "git-receive-pack", "--stateless-rpc", repoPath)
+	cmd.Env = env
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -287,6 +332,143 @@ func (h *GitHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Reques
 		slog.Warn("git-receive-pack error", "error", err)
 	}
 
+	h.recordReceivePack(repo, repoPath, actor, hooks)
+}
+
+// receivePackEnv returns the environment for git-receive-pack and the hook
+// files of the push, which must be closed once receive-pack has exited. It
+// enables the hooks, which record the ref updates and enforce the push policy
+// when the repo has protection rules or LFS locks held by other users, and
+// caps the pack size at the storage left in the namespace quota. The pusher is
+// deployKey when it is set, and otherwise userID through a token limited to scope.
+// Returns a *quotaError when the namespace is already at its storage limit.
+func (h *GitHTTPHandler) receivePackEnv(userID string, scope *store.TokenScope, deployKey *store.DeployKey, repo *store.Repo) ([]string, *pushHooks, error) {
+	var policy pushPolicy
+	var err error
+	if deployKey != nil {
+		policy, err = loadDeployKeyPushPolicy(h.store, deployKey, repo)
+	} else {
+		policy, err = loadPushPolicy(h.store, h.permissions, userID, scope, repo)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var config [][2]string
+	limit, used, limited, err := storageUsage(h.store, repo.NamespaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if limited {
+		if used >= limit {
+			return nil, nil, &quotaError{Quota: quotaStorageLimit, Limit: limit, Used: used}
+		}
+		config = append(config, [2]string{"receive.maxInputSize", strconv.FormatInt(limit-used, 10)})
+	}
+
+	if h.hooksDir == "" {
+		if !policy.empty() {
+			return nil, nil, fmt.Errorf("repository has a push policy but hooks are unavailable")
+		}
+		return gitConfigEnv(os.Environ(), config), nil, nil
+	}
+
+	hooks, err := newPushHooks(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config = append(config, [2]string{"core.hooksPath", h.hooksDir})
+	return append(gitConfigEnv(os.Environ(), config), hooks.env()...), hooks, nil
+}
+
+// pushHooks are the files a receive-pack shares with its hooks: the push
+// policy for pre-receive and the ref updates reported by post-receive. The ref
+// updates come from receive-pack itself, so ref changes made by anyone else
+// during the push are never attributed to the pusher.
+type pushHooks struct {
+	dir        string
+	policyPath string
+}
+
+func newPushHooks(policy pushPolicy) (*pushHooks, error) {
+	dir, err := os.MkdirTemp("", "eph-push-")
+	if err != nil {
+		return nil, fmt.Errorf("create push hook directory: %w", err)
+	}
+
+	hooks := &pushHooks{dir: dir}
+	if !policy.empty() {
+		hooks.policyPath = filepath.Join(dir, "policy.json")
+		if err := writePushPolicy(hooks.policyPath, policy); err != nil {
+			hooks.close()
+			return nil, err
+		}
+	}
+	return hooks, nil
+}
+
+func (p *pushHooks) env() []string {
+	env := []string{pushUpdatesEnv + "=" + p.updatesPath()}
+	if p.policyPath != "" {
+		env = append(env, pushPolicyEnv+"="+p.policyPath)
+	}
+	return env
+}
+
+func (p *pushHooks) updatesPath() string {
+	return filepath.Join(p.dir, "updates")
+}
+
+// updates returns the ref updates receive-pack made, in the order it made
+// them. A push that updated nothing has none.
+func (p *pushHooks) updates() ([]refUpdate, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	f, err := os.Open(p.updatesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open ref updates: %w", err)
+	}
+	defer f.Close()
+
+	return parseRefUpdates(f)
+}
+
+func (p *pushHooks) close() {
+	if p != nil {
+		os.RemoveAll(p.dir)
+	}
+}
+
+// recordReceivePack records a completed receive-pack on any transport, with
+// the ref updates its post-receive hook reported.
+func (h *GitHTTPHandler) recordReceivePack(repo *store.Repo, repoPath string, actor pushActor, hooks *pushHooks) {
+	updates, err := hooks.updates()
+	if err != nil {
+		slog.Warn("failed to read pushed ref updates", "repo_id", repo.ID, "error", err)
+	}
+	h.recordPush(repo, repoPath, actor, updates)
+}
+
+// recordPush updates repo stats after refs were updated by a push or on the
+// server, and records and emits events for the updates.
+func (h *GitHTTPHandler) recordPush(repo *store.Repo, repoPath string, actor pushActor, updates []refUpdate) {
+	ctx := context.Background()
+
+	if len(updates) > 0 {
+		markForcedUpdates(ctx, repoPath, updates)
+		h.recordPushEvents(repo, actor, updates)
+		reanchorReviewThreads(ctx, h.store, repo.ID, repoPath, updates)
+		h.webhooks.emitPush(repo, actor, updates)
+		h.pushMirrors.queue(repo.ID)
+		h.searchIndex.queue(repo.ID)
+	}
+
 	if err := h.store.UpdateRepoLastPush(repo.ID, time.Now()); err != nil {
 		slog.Warn("failed to update repo last_push_at", "repo_id", repo.ID, "error", err)
 	}
@@ -315,6 +497,17 @@ func (h *GitHTTPHandler) getRequestBody(w http.ResponseWriter, r *http.Request)
 	return gzipReader, nil
 }
 
+// writeGetRepoError reports a getOrCreateRepo failure, using the quota error
+// body when auto-creation was rejected by the namespace repo limit.
+func writeGetRepoError(w http.ResponseWriter, err error) {
+	var qErr *quotaError
+	if errors.As(err, &qErr) {
+		writeQuotaError(w, err)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to get repository: %v", err), http.StatusInternalServerError)
+}
+
 // getOrCreateRepo gets a repo, optionally creating it if autoCreate is true.
 // Auto-creation requires the token to have PermNamespaceWrite on the namespace.
 func (h *GitHTTPHandler) getOrCreateRepo(namespaceID, repoName string, autoCreate bool, token *store.Token) (*store.Repo, error) {
@@ -340,15 +533,20 @@ func (h *GitHTTPHandler) getOrCreateRepo(namespaceID, repoName string, autoCreat
 		return nil, nil
 	}
 
-	return h.createRepo(namespaceID, repoName)
+	return h.createRepo(namespaceID, repoName, *token.UserID)
 }
 
-func (h *GitHTTPHandler) createRepo(namespaceID, repoName string) (*store.Repo, error) {
+// createRepo creates a repository on first push. userID is the pusher.
+func (h *GitHTTPHandler) createRepo(namespaceID, repoName, userID string) (*store.Repo, error) {
 	if err := ValidateName(repoName); err != nil {
 		return nil, fmt.Errorf("invalid repo name: %w", err)
 	}
 	repoName = strings.ToLower(repoName)
 
+	if err := checkRepoQuota(h.store, namespaceID); err != nil {
+		return nil, err
+	}
+
 	repoPath, err := h.getRepoPath(namespaceID, repoName)
 	if err != nil {
 		return nil, fmt.Errorf("resolve repo path: %w", err)
@@ -375,9 +573,73 @@ func (h *GitHTTPHandler) createRepo(namespaceID, repoName string) (*store.Repo,
 	}
 
 	fmt.Printf("Created new repository: %s/%s\n", namespaceID, repoName)
+	h.webhooks.emitRepoEvent(WebhookEventRepoCreate, repo, &userID, "")
 	return repo, nil
 }
 
+// recordPushEvents stores the ref updates of a push in the audit log.
+func (h *GitHTTPHandler) recordPushEvents(repo *store.Repo, actor pushActor, updates []refUpdate) {
+	var userID *string
+	if actor.UserID != "" {
+		userID = &actor.UserID
+	}
+
+	now := time.Now()
+	events := make([]store.PushEvent, len(updates))
+	for i, u := range updates {
+		events[i] = store.PushEvent{
+			ID:          uuid.New().String(),
+			RepoID:      repo.ID,
+			Ref:         u.Ref,
+			OldSHA:      u.OldSHA,
+			NewSHA:      u.NewSHA,
+			UserID:      userID,
+			TokenID:     actor.TokenID,
+			DeployKeyID: actor.DeployKeyID,
+			Forced:      u.Forced,
+			CreatedAt:   now,
+		}
+	}
+
+	if err := h.store.CreatePushEvents(events); err != nil {
+		slog.Warn("failed to record push events", "repo_id", repo.ID, "error", err)
+	}
+}
+
+// markForcedUpdates flags updates that moved a ref to a commit that does not
+// descend from its previous target.
+func markForcedUpdates(ctx context.Context, repoPath string, updates []refUpdate) {
+	for i, u := range updates {
+		if isZeroSHA(u.OldSHA) || isZeroSHA(u.NewSHA) {
+			continue
+		}
+
+		ancestor, err := gitIsAncestor(ctx, repoPath, u.OldSHA, u.NewSHA)
+		if err != nil {
+			slog.Warn("failed to check fast-forward", "ref", u.Ref, "error", err)
+			continue
+		}
+		updates[i].Forced = !ancestor
+	}
+}
+
+// listRefs returns a snapshot of every ref in the repository, keyed by full ref name.
+func listRefs(ctx context.Context, repoPath string) (map[string]string, error) {
+	output, err := gitCommandOutput(ctx, repoPath, "for-each-ref", "--format=%(objectname) %(refname)")
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		sha, ref, ok := strings.Cut(line, " ")
+		if ok {
+			refs[ref] = sha
+		}
+	}
+	return refs, nil
+}
+
 func (h *GitHTTPHandler) getRepoPath(namespaceID, repoName string) (string, error) {
 	return SafeRepoPath(h.dataDir, namespaceID, repoName)
 }
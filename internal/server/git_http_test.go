@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// TestMain runs the hooks that GitHTTPHandler installs, which call back into
+// the running executable as "hook <name>" the way they call the eph binary.
+func TestMain(m *testing.M) {
+	if len(os.Args) == 3 && os.Args[1] == "hook" {
+		var err error
+		switch os.Args[2] {
+		case "pre-receive":
+			err = RunPreReceiveHook(context.Background(), os.Stdin, os.Stderr)
+		case "post-receive":
+			err = RunPostReceiveHook(os.Stdin)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// useTestHooks replaces the installed hooks, which call back into the eph
+// binary, with a post-receive script that reports the ref updates the same way.
+func useTestHooks(t *testing.T, h *GitHTTPHandler) {
+	t.Helper()
+
+	h.hooksDir = t.TempDir()
+	script := "#!/bin/sh\ncat >> \"$" + pushUpdatesEnv + "\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(h.hooksDir, "post-receive"), []byte(script), 0755))
+}
+
+func TestGitHTTPHandler_PushEvents(t *testing.T) {
+	st, repo := newRepoTestStore(t)
+	now := time.Now()
+
+	require.NoError(t, st.CreateUser(&store.User{ID: "user-1", PrimaryNamespaceID: repo.NamespaceID, CreatedAt: now, UpdatedAt: now}))
+	require.NoError(t, st.UpsertNamespaceGrant(&store.NamespaceGrant{
+		UserID: "user-1", NamespaceID: repo.NamespaceID, AllowBits: store.DefaultNamespaceGrant(), CreatedAt: now, UpdatedAt: now,
+	}))
+	_, token, err := st.GenerateUserToken("user-1", nil, nil, nil)
+	require.NoError(t, err)
+
+	dataDir := t.TempDir()
+	h := NewGitHTTPHandler(st, dataDir)
+	repoPath, err := h.getRepoPath(repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	require.NoError(t, initBareRepo(repoPath))
+
+	work := t.TempDir()
+	runGit(t, work, "init", "-q", "-b", "main")
+	commitMergeTestFile(t, work, "README", "one\n", "Initial commit")
+	runGit(t, work, "push", "-q", repoPath, "main")
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	base := mergeTestHead(t, gitRepo, "main")
+
+	// pre-receive moves a ref outside the push while it is in progress, as a
+	// concurrent push or API call would.
+	useTestHooks(t, h)
+	preReceive := "#!/bin/sh\nunset GIT_QUARANTINE_PATH GIT_OBJECT_DIRECTORY GIT_ALTERNATE_OBJECT_DIRECTORIES\ngit update-ref refs/heads/concurrent " + base + "\ncat >/dev/null\n"
+	require.NoError(t, os.WriteFile(filepath.Join(h.hooksDir, "pre-receive"), []byte(preReceive), 0755))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey, token)))
+	}))
+	t.Cleanup(srv.Close)
+
+	commitMergeTestFile(t, work, "pushed.txt", "pushed\n", "Pushed change")
+	cmd := exec.Command("git", "push", "-q", srv.URL+"/git/acme/app.git", "main", "main:refs/heads/feature")
+	cmd.Dir = work
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	head := mergeTestHead(t, gitRepo, "main")
+	assert.Equal(t, base, mergeTestHead(t, gitRepo, "concurrent"))
+
+	events, err := st.ListRepoPushEvents(repo.ID, "", 10)
+	require.NoError(t, err)
+
+	got := make(map[string][2]string)
+	for _, e := range events {
+		got[e.Ref] = [2]string{e.OldSHA, e.NewSHA}
+		assert.Equal(t, "user-1", *e.UserID)
+	}
+	assert.Equal(t, map[string][2]string{
+		"refs/heads/main":    {base, head},
+		"refs/heads/feature": {strings.Repeat("0", 40), head},
+	}, got)
+}
+
+func TestRefAPI_RecordsPushEvents(t *testing.T) {
+	srv, _, repo, token := newRefAPITestServer(t)
+
+	repoPath, err := srv.gitHandler.getRepoPath(repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	main := mergeTestHead(t, gitRepo, "main")
+	feature := mergeTestHead(t, gitRepo, "feature")
+
+	rec := serveAs(srv, token, http.MethodPatch, "/api/v1/repos/"+repo.ID+"/refs/branch/main", `{"target":"`+feature+`"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = serveAs(srv, token, http.MethodPatch, "/api/v1/repos/"+repo.ID+"/refs/branch/main", `{"target":"`+main+`"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serveAs(srv, token, http.MethodGet, "/api/v1/repos/"+repo.ID+"/events", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp struct {
+		Data []store.PushEvent `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 2)
+
+	forced := resp.Data[0]
+	assert.Equal(t, "refs/heads/main", forced.Ref)
+	assert.Equal(t, feature, forced.OldSHA)
+	assert.Equal(t, main, forced.NewSHA)
+	assert.True(t, forced.Forced, "moving main back is a force update")
+	require.NotNil(t, forced.UserID)
+	assert.Equal(t, "user-1", *forced.UserID)
+	assert.NotNil(t, forced.TokenID)
+
+	assert.False(t, resp.Data[1].Forced, "fast-forward")
+}
+
+func TestGitHTTPHandler_PreReceiveHook(t *testing.T) {
+	st, repo := newRepoTestStore(t)
+	now := time.Now()
+
+	require.NoError(t, st.CreateUser(&store.User{ID: "user-1", PrimaryNamespaceID: repo.NamespaceID, CreatedAt: now, UpdatedAt: now}))
+	require.NoError(t, st.UpsertNamespaceGrant(&store.NamespaceGrant{
+		UserID: "user-1", NamespaceID: repo.NamespaceID, AllowBits: store.DefaultNamespaceGrant(), CreatedAt: now, UpdatedAt: now,
+	}))
+	_, token, err := st.GenerateUserToken("user-1", nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, st.CreateNamespace(&store.Namespace{ID: "ns-alice", Name: "alice", CreatedAt: now}))
+	require.NoError(t, st.CreateUser(&store.User{ID: "alice", PrimaryNamespaceID: "ns-alice", CreatedAt: now, UpdatedAt: now}))
+
+	// The installed hooks run this test binary, see TestMain.
+	dataDir := t.TempDir()
+	h := NewGitHTTPHandler(st, dataDir)
+	require.NotEmpty(t, h.hooksDir)
+	repoPath, err := h.getRepoPath(repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	require.NoError(t, initBareRepo(repoPath))
+
+	work := t.TempDir()
+	runGit(t, work, "init", "-q", "-b", "main")
+	commitMergeTestFile(t, work, "README", "one\n", "Initial commit")
+	commitMergeTestFile(t, work, "README", "two\n", "Second commit")
+	runGit(t, work, "push", "-q", repoPath, "main")
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	base := mergeTestHead(t, gitRepo, "main")
+
+	require.NoError(t, st.CreateBranchProtection(&store.BranchProtection{
+		ID: "rule-1", RepoID: repo.ID, Pattern: "main", BlockForcePush: true, CreatedAt: now, UpdatedAt: now,
+	}))
+	require.NoError(t, st.CreateLFSLock(&store.LFSLock{ID: "lock-1", RepoID: repo.ID, Path: "locked.txt", OwnerID: "alice", LockedAt: now}))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey, token)))
+	}))
+	t.Cleanup(srv.Close)
+	remote := srv.URL + "/git/acme/app.git"
+
+	push := func(t *testing.T, args ...string) (string, error) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"push", remote}, args...)...)
+		cmd.Dir = work
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	t.Run("rejects a force push to a protected branch", func(t *testing.T) {
+		runGit(t, work, "reset", "-q", "--hard", "HEAD~1")
+		commitMergeTestFile(t, work, "README", "rewritten\n", "Rewrite history")
+
+		out, err := push(t, "-f", "main")
+		require.Error(t, err, out)
+		assert.Contains(t, out, "ephemeral: rejected main: force push to protected branch is not allowed")
+		assert.Equal(t, base, mergeTestHead(t, gitRepo, "main"), "main did not move")
+
+		runGit(t, work, "reset", "-q", "--hard", base)
+	})
+
+	t.Run("rejects changes to locked paths", func(t *testing.T) {
+		runGit(t, work, "checkout", "-q", "-b", "topic", base)
+		commitMergeTestFile(t, work, "locked.txt", "mine\n", "Edit locked file")
+
+		out, err := push(t, "topic")
+		require.Error(t, err, out)
+		assert.Contains(t, out, "ephemeral: rejected topic: locked.txt is locked by alice")
+		_, err = gitRepo.Reference("refs/heads/topic", true)
+		assert.Error(t, err, "topic was not created")
+
+		runGit(t, work, "checkout", "-q", "main")
+	})
+
+	t.Run("accepts fast-forwards", func(t *testing.T) {
+		commitMergeTestFile(t, work, "README", "three\n", "Third commit")
+
+		out, err := push(t, "main")
+		require.NoError(t, err, out)
+		assert.NotEqual(t, base, mergeTestHead(t, gitRepo, "main"))
+
+		events, err := st.ListRepoPushEvents(repo.ID, "", 10)
+		require.NoError(t, err)
+		require.Len(t, events, 1, "the installed post-receive hook reports the update")
+		assert.Equal(t, base, events[0].OldSHA)
+	})
+}
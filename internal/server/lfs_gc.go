@@ -0,0 +1,326 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/bantamhq/ephemeral/internal/lfs"
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// DefaultLFSGCMinAge keeps recent uploads, since git-lfs uploads objects
+// before pushing the commits that reference them.
+const DefaultLFSGCMinAge = 24 * time.Hour
+
+// LFS garbage collection reasons.
+const (
+	LFSGCUnreferenced = "unreferenced"
+	LFSGCRepoDeleted  = "repo_deleted"
+	LFSGCUntracked    = "untracked"
+)
+
+// LFSGCOptions controls a garbage collection run.
+type LFSGCOptions struct {
+	DryRun bool
+	// MinAge skips objects newer than this.
+	MinAge time.Duration
+}
+
+// LFSGCObject is an object removed (or, in a dry run, that would be removed).
+type LFSGCObject struct {
+	RepoID string `json:"repo_id"`
+	OID    string `json:"oid"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+}
+
+// LFSGCReport summarizes a garbage collection run.
+type LFSGCReport struct {
+	DryRun       bool          `json:"dry_run"`
+	ReposScanned int           `json:"repos_scanned"`
+	Objects      []LFSGCObject `json:"objects"`
+	Bytes        int64         `json:"bytes"`
+}
+
+func (r *LFSGCReport) add(obj LFSGCObject) {
+	r.Objects = append(r.Objects, obj)
+	r.Bytes += obj.Size
+}
+
+// CollectLFSGarbage deletes LFS objects that no reachable commit references.
+// Recorded objects are checked against the pointer files in each repo's
+// history. If the storage implements lfs.Walker, stored objects that belong to
+// deleted repos or were never recorded are removed as well.
+func CollectLFSGarbage(ctx context.Context, st store.Store, storage lfs.Storage, dataDir string, opts LFSGCOptions) (*LFSGCReport, error) {
+	report := &LFSGCReport{DryRun: opts.DryRun}
+	cutoff := time.Now().Add(-opts.MinAge)
+
+	repos, err := listAllRepos(st)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := make(map[string]map[string]bool, len(repos))
+	for _, repo := range repos {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		objects, err := st.ListLFSObjects(repo.ID)
+		if err != nil {
+			return nil, fmt.Errorf("list lfs objects for %s: %w", repo.ID, err)
+		}
+
+		recorded[repo.ID] = make(map[string]bool, len(objects))
+		for _, obj := range objects {
+			recorded[repo.ID][obj.OID] = true
+		}
+		report.ReposScanned++
+
+		if len(objects) == 0 {
+			continue
+		}
+
+		repoPath, err := SafeRepoPath(dataDir, repo.NamespaceID, repo.Name)
+		if err != nil {
+			return nil, fmt.Errorf("resolve repo path: %w", err)
+		}
+
+		referenced, err := referencedLFSObjects(ctx, repoPath)
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", repo.ID, err)
+		}
+
+		for _, obj := range objects {
+			if referenced[obj.OID] || obj.CreatedAt.After(cutoff) {
+				continue
+			}
+
+			orphan := LFSGCObject{RepoID: repo.ID, OID: obj.OID, Size: obj.Size, Reason: LFSGCUnreferenced}
+			if !opts.DryRun {
+				if err := deleteLFSObject(ctx, st, storage, repo.ID, obj.OID); err != nil {
+					return nil, err
+				}
+			}
+			report.add(orphan)
+		}
+	}
+
+	walker, ok := storage.(lfs.Walker)
+	if !ok {
+		return report, nil
+	}
+
+	var stray []LFSGCObject
+	err = walker.Walk(ctx, func(obj lfs.StoredObject) error {
+		if obj.ModTime.After(cutoff) {
+			return nil
+		}
+
+		objects, repoExists := recorded[obj.RepoID]
+		switch {
+		case !repoExists:
+			stray = append(stray, LFSGCObject{RepoID: obj.RepoID, OID: obj.OID, Size: obj.Size, Reason: LFSGCRepoDeleted})
+		case !objects[obj.OID]:
+			stray = append(stray, LFSGCObject{RepoID: obj.RepoID, OID: obj.OID, Size: obj.Size, Reason: LFSGCUntracked})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk lfs storage: %w", err)
+	}
+
+	for _, obj := range stray {
+		if !opts.DryRun {
+			if err := storage.Delete(ctx, obj.RepoID, obj.OID); err != nil && !errors.Is(err, lfs.ErrObjectNotFound) {
+				return nil, fmt.Errorf("delete lfs object %s: %w", obj.OID, err)
+			}
+		}
+		report.add(obj)
+	}
+
+	return report, nil
+}
+
+// deleteLFSObject removes an object from storage and then forgets it.
+func deleteLFSObject(ctx context.Context, st store.Store, storage lfs.Storage, repoID, oid string) error {
+	if err := storage.Delete(ctx, repoID, oid); err != nil && !errors.Is(err, lfs.ErrObjectNotFound) {
+		return fmt.Errorf("delete lfs object %s: %w", oid, err)
+	}
+	if err := st.DeleteLFSObject(repoID, oid); err != nil {
+		return fmt.Errorf("forget lfs object %s: %w", oid, err)
+	}
+	return nil
+}
+
+// listAllRepos pages through every repo in every namespace.
+func listAllRepos(st store.Store) ([]store.Repo, error) {
+	const pageSize = 100
+
+	var namespaces []store.Namespace
+	cursor := ""
+	for {
+		page, err := st.ListNamespaces(cursor, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("list namespaces: %w", err)
+		}
+		namespaces = append(namespaces, page...)
+		if len(page) < pageSize {
+			break
+		}
+		cursor = page[len(page)-1].ID
+	}
+
+	var repos []store.Repo
+	for _, ns := range namespaces {
+		cursor := ""
+		for {
+			page, err := st.ListRepos(ns.ID, cursor, pageSize)
+			if err != nil {
+				return nil, fmt.Errorf("list repos: %w", err)
+			}
+			repos = append(repos, page...)
+			if len(page) < pageSize {
+				break
+			}
+			cursor = page[len(page)-1].Name
+		}
+	}
+
+	return repos, nil
+}
+
+// referencedLFSObjects returns the OIDs of pointer files in any commit reachable from a ref.
+func referencedLFSObjects(ctx context.Context, repoPath string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+
+	repo, err := git.PlainOpen(repoPath)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return referenced, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open repo: %w", err)
+	}
+
+	commits, err := repo.Log(&git.LogOptions{All: true})
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return referenced, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("walk commits: %w", err)
+	}
+	defer commits.Close()
+
+	seenTrees := make(map[plumbing.Hash]bool)
+	seenBlobs := make(map[plumbing.Hash]bool)
+
+	err = commits.ForEach(func(commit *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		tree, err := commit.Tree()
+		if err != nil {
+			return err
+		}
+		return collectTreePointers(tree, seenTrees, seenBlobs, referenced)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return referenced, nil
+}
+
+func collectTreePointers(tree *object.Tree, seenTrees, seenBlobs map[plumbing.Hash]bool, referenced map[string]bool) error {
+	if seenTrees[tree.Hash] {
+		return nil
+	}
+	seenTrees[tree.Hash] = true
+
+	for i := range tree.Entries {
+		entry := &tree.Entries[i]
+		switch {
+		case entry.Mode.IsFile():
+			if seenBlobs[entry.Hash] {
+				continue
+			}
+			seenBlobs[entry.Hash] = true
+
+			oid, err := readPointerBlob(tree, entry)
+			if err != nil {
+				return err
+			}
+			if oid != "" {
+				referenced[oid] = true
+			}
+		case entry.Mode == filemode.Dir:
+			subtree, err := tree.Tree(entry.Name)
+			if err != nil {
+				return err
+			}
+			if err := collectTreePointers(subtree, seenTrees, seenBlobs, referenced); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readPointerBlob returns the OID if the blob is an LFS pointer, or "" otherwise.
+func readPointerBlob(tree *object.Tree, entry *object.TreeEntry) (string, error) {
+	file, err := tree.TreeEntryFile(entry)
+	if err != nil {
+		return "", err
+	}
+	if file.Size > lfs.MaxPointerSize {
+		return "", nil
+	}
+
+	reader, err := file.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	oid, _ := lfs.ParsePointer(content)
+	return oid, nil
+}
+
+// runLFSGC collects LFS garbage every interval until the context is cancelled.
+func (s *Server) runLFSGC(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := CollectLFSGarbage(ctx, s.store, s.lfsHandler.storage, s.dataDir, LFSGCOptions{MinAge: DefaultLFSGCMinAge})
+		if err != nil {
+			slog.Warn("lfs garbage collection failed", "error", err)
+			continue
+		}
+		if len(report.Objects) > 0 {
+			slog.Info("lfs garbage collected", "objects", len(report.Objects), "bytes", report.Bytes)
+		}
+	}
+}
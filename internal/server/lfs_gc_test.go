@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/lfs"
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+func putLFSTestObject(t *testing.T, storage lfs.Storage, repoID, content string) string {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	require.NoError(t, storage.Put(context.Background(), repoID, oid, bytes.NewReader([]byte(content)), int64(len(content))))
+	return oid
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func TestCollectLFSGarbage(t *testing.T) {
+	dataDir := t.TempDir()
+	st, repo := newRepoTestStore(t)
+	storage := lfs.NewLocalStorage(filepath.Join(dataDir, "lfs"))
+
+	referenced := putLFSTestObject(t, storage, repo.ID, "referenced")
+	unreferenced := putLFSTestObject(t, storage, repo.ID, "unreferenced")
+	stray := putLFSTestObject(t, storage, "deleted-repo", "stray")
+
+	old := time.Now().Add(-time.Hour)
+	for _, oid := range []string{referenced, unreferenced} {
+		require.NoError(t, st.CreateLFSObject(&store.LFSObject{RepoID: repo.ID, OID: oid, Size: 10, CreatedAt: old}))
+	}
+
+	repoPath, err := SafeRepoPath(dataDir, repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	require.NoError(t, initBareRepo(repoPath))
+
+	work := t.TempDir()
+	runGit(t, work, "init", "-q", "-b", "main")
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize 10\n", referenced)
+	require.NoError(t, os.MkdirAll(filepath.Join(work, "assets"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(work, "assets", "big.bin"), []byte(pointer), 0644))
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "-q", "-m", "Add asset")
+	runGit(t, work, "push", "-q", repoPath, "main")
+
+	report, err := CollectLFSGarbage(context.Background(), st, storage, dataDir, LFSGCOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.ReposScanned)
+	assert.ElementsMatch(t, []LFSGCObject{
+		{RepoID: repo.ID, OID: unreferenced, Size: 10, Reason: LFSGCUnreferenced},
+		{RepoID: "deleted-repo", OID: stray, Size: 5, Reason: LFSGCRepoDeleted},
+	}, report.Objects)
+
+	exists, err := storage.Exists(context.Background(), repo.ID, unreferenced)
+	require.NoError(t, err)
+	assert.True(t, exists, "dry run deletes nothing")
+
+	_, err = CollectLFSGarbage(context.Background(), st, storage, dataDir, LFSGCOptions{})
+	require.NoError(t, err)
+
+	exists, err = storage.Exists(context.Background(), repo.ID, referenced)
+	require.NoError(t, err)
+	assert.True(t, exists, "referenced object is kept")
+
+	exists, err = storage.Exists(context.Background(), repo.ID, unreferenced)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = storage.Exists(context.Background(), "deleted-repo", stray)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	objects, err := st.ListLFSObjects(repo.ID)
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, referenced, objects[0].OID)
+}
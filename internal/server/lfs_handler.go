@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -16,15 +17,27 @@ import (
 
 const lfsMediaType = "application/vnd.git-lfs+json"
 
+// lfsPresignExpiry is how long presigned transfer URLs stay valid.
+const lfsPresignExpiry = time.Hour
+
 type LFSOptions struct {
 	Enabled     bool
 	MaxFileSize int64
 	BaseURL     string
+	// Storage defaults to local storage under the data directory.
+	Storage lfs.Storage
+	// DirectTransfer hands out presigned storage URLs in batch responses
+	// instead of proxying objects through the server. Requires a Storage
+	// that implements lfs.Presigner.
+	DirectTransfer bool
+	// GCInterval schedules LFS garbage collection. Zero disables it.
+	GCInterval time.Duration
 }
 
 type LFSHandler struct {
 	store       store.Store
 	storage     lfs.Storage
+	presigner   lfs.Presigner
 	permissions *store.PermissionChecker
 	baseURL     string
 	maxFileSize int64
@@ -46,6 +59,10 @@ func (h *LFSHandler) Routes() chi.Router {
 	r.Get("/objects/{oid}", h.handleDownload)
 	r.Put("/objects/{oid}", h.handleUpload)
 	r.Post("/verify", h.handleVerify)
+	r.Post("/locks", h.handleCreateLock)
+	r.Get("/locks", h.handleListLocks)
+	r.Post("/locks/verify", h.handleVerifyLocks)
+	r.Post("/locks/{id}/unlock", h.handleUnlock)
 	return r
 }
 
@@ -88,6 +105,9 @@ func (h *LFSHandler) processObject(r *http.Request, ns *store.Namespace, repo *s
 	if err := lfs.ValidateOID(obj.OID); err != nil {
 		return objectError(obj, 422, "Invalid OID format")
 	}
+	if obj.Size < 0 {
+		return objectError(obj, 422, "Invalid object size")
+	}
 
 	if h.maxFileSize > 0 && obj.Size > h.maxFileSize {
 		return objectError(obj, 413, fmt.Sprintf("Object exceeds maximum size of %d bytes", h.maxFileSize))
@@ -102,10 +122,31 @@ func (h *LFSHandler) processObject(r *http.Request, ns *store.Namespace, repo *s
 	authHeader := h.buildAuthHeader(token)
 
 	if operation == "download" {
+		if exists && h.presigner != nil {
+			return h.presignedDownloadResponse(obj, repo)
+		}
 		return h.downloadResponse(obj, exists, baseObjURL, authHeader)
 	}
 
-	return h.uploadResponse(obj, exists, baseObjURL, authHeader, ns.Name, repo.Name)
+	if !exists {
+		if err := checkStorageQuota(h.store, repo.NamespaceID, obj.Size); err != nil {
+			var qErr *quotaError
+			if errors.As(err, &qErr) {
+				return objectError(obj, qErr.status(), qErr.Error())
+			}
+			return objectError(obj, 500, "Failed to check namespace quota")
+		}
+	}
+
+	resp := h.uploadResponse(obj, exists, baseObjURL, authHeader, ns.Name, repo.Name)
+	if !exists && h.presigner != nil {
+		href, header, err := h.presigner.PresignPut(repo.ID, obj.OID, obj.Size, lfsPresignExpiry)
+		if err != nil {
+			return objectError(obj, 500, "Failed to presign upload")
+		}
+		resp.Actions["upload"] = lfs.Action{Href: href, Header: header, ExpiresIn: int(lfsPresignExpiry.Seconds())}
+	}
+	return resp
 }
 
 func objectError(obj lfs.ObjectSpec, code int, message string) lfs.ObjectResponse {
@@ -130,6 +171,21 @@ func (h *LFSHandler) downloadResponse(obj lfs.ObjectSpec, exists bool, url strin
 	}
 }
 
+func (h *LFSHandler) presignedDownloadResponse(obj lfs.ObjectSpec, repo *store.Repo) lfs.ObjectResponse {
+	href, err := h.presigner.PresignGet(repo.ID, obj.OID, lfsPresignExpiry)
+	if err != nil {
+		return objectError(obj, 500, "Failed to presign download")
+	}
+
+	return lfs.ObjectResponse{
+		OID:  obj.OID,
+		Size: obj.Size,
+		Actions: map[string]lfs.Action{
+			"download": {Href: href, ExpiresIn: int(lfsPresignExpiry.Seconds())},
+		},
+	}
+}
+
 func (h *LFSHandler) uploadResponse(obj lfs.ObjectSpec, exists bool, url string, header map[string]string, nsName, repoName string) lfs.ObjectResponse {
 	resp := lfs.ObjectResponse{
 		OID:     obj.OID,
@@ -211,6 +267,16 @@ func (h *LFSHandler) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := checkStorageQuota(h.store, repo.NamespaceID, size); err != nil {
+		var qErr *quotaError
+		if errors.As(err, &qErr) {
+			h.lfsError(w, qErr.status(), qErr.Error())
+			return
+		}
+		h.lfsError(w, http.StatusInternalServerError, "Failed to check namespace quota")
+		return
+	}
+
 	err := h.storage.Put(r.Context(), repo.ID, oid, r.Body, size)
 	if errors.Is(err, lfs.ErrHashMismatch) {
 		h.lfsError(w, http.StatusBadRequest, "Content hash does not match OID")
@@ -267,6 +333,36 @@ func (h *LFSHandler) handleVerify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Direct uploads bypass handleUpload, so the object is checked and
+	// recorded here.
+	if h.presigner != nil {
+		existing, err := h.store.GetLFSObject(repo.ID, req.OID)
+		if err != nil {
+			h.lfsError(w, http.StatusInternalServerError, "Failed to verify object")
+			return
+		}
+		if existing == nil {
+			if status, message := h.checkDirectUpload(repo, req, size); status != 0 {
+				if err := h.storage.Delete(r.Context(), repo.ID, req.OID); err != nil {
+					slog.Warn("failed to delete rejected lfs object", "repo_id", repo.ID, "oid", req.OID, "error", err)
+				}
+				h.lfsError(w, status, message)
+				return
+			}
+
+			lfsObj := &store.LFSObject{
+				RepoID:    repo.ID,
+				OID:       req.OID,
+				Size:      size,
+				CreatedAt: time.Now(),
+			}
+			if err := h.store.CreateLFSObject(lfsObj); err != nil {
+				h.lfsError(w, http.StatusInternalServerError, "Failed to record object")
+				return
+			}
+		}
+	}
+
 	if size != req.Size {
 		h.lfsError(w, http.StatusBadRequest, fmt.Sprintf("Size mismatch: expected %d, got %d", req.Size, size))
 		return
@@ -275,6 +371,31 @@ func (h *LFSHandler) handleVerify(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// checkDirectUpload applies the checks of handleUpload to an object uploaded
+// with a presigned URL. The URL only accepts the size approved in batch, so
+// the stored size must match the size being verified, and both the size limit
+// and quota are checked again in case they changed since. Returns a zero
+// status if the object may be kept.
+func (h *LFSHandler) checkDirectUpload(repo *store.Repo, req lfs.VerifyRequest, size int64) (int, string) {
+	if size != req.Size {
+		return http.StatusBadRequest, fmt.Sprintf("Size mismatch: expected %d, got %d", req.Size, size)
+	}
+
+	if h.maxFileSize > 0 && size > h.maxFileSize {
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("Object exceeds maximum size of %d bytes", h.maxFileSize)
+	}
+
+	if err := checkStorageQuota(h.store, repo.NamespaceID, size); err != nil {
+		var qErr *quotaError
+		if errors.As(err, &qErr) {
+			return qErr.status(), qErr.Error()
+		}
+		return http.StatusInternalServerError, "Failed to check namespace quota"
+	}
+
+	return 0, ""
+}
+
 func (h *LFSHandler) resolveRepo(w http.ResponseWriter, r *http.Request) (*store.Namespace, *store.Repo, *store.Token) {
 	namespaceName := chi.URLParam(r, "namespace")
 	repoName := chi.URLParam(r, "repo")
@@ -318,7 +439,7 @@ func (h *LFSHandler) checkPermission(w http.ResponseWriter, token *store.Token,
 		return false
 	}
 
-	hasWrite, err := h.permissions.CheckRepoPermission(token.ID, repo, store.PermRepoWrite)
+	hasWrite, err := checkGitRepoPermission(h.permissions, token, repo, store.PermRepoWrite)
 	if err != nil {
 		h.lfsError(w, http.StatusInternalServerError, "Failed to check permissions")
 		return false
@@ -342,7 +463,7 @@ func (h *LFSHandler) checkReadPermission(w http.ResponseWriter, token *store.Tok
 		return false
 	}
 
-	hasRead, err := h.permissions.CheckRepoPermission(token.ID, repo, store.PermRepoRead)
+	hasRead, err := checkGitRepoPermission(h.permissions, token, repo, store.PermRepoRead)
 	if err != nil {
 		h.lfsError(w, http.StatusInternalServerError, "Failed to check permissions")
 		return false
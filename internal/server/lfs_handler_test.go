@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/lfs"
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// presignedTestStorage stands in for a storage with direct transfers, whose
+// uploads reach the storage without going through handleUpload.
+type presignedTestStorage struct {
+	*lfs.LocalStorage
+}
+
+func (presignedTestStorage) PresignGet(repoID, oid string, expires time.Duration) (string, error) {
+	return "https://storage.test/" + oid, nil
+}
+
+func (presignedTestStorage) PresignPut(repoID, oid string, size int64, expires time.Duration) (string, map[string]string, error) {
+	return "https://storage.test/" + oid, map[string]string{"Content-Length": fmt.Sprint(size)}, nil
+}
+
+func TestLFSHandler_VerifyDirectUpload(t *testing.T) {
+	st, repo := newRepoTestStore(t)
+	now := time.Now()
+
+	require.NoError(t, st.CreateUser(&store.User{ID: "user-1", PrimaryNamespaceID: repo.NamespaceID, CreatedAt: now, UpdatedAt: now}))
+	require.NoError(t, st.UpsertNamespaceGrant(&store.NamespaceGrant{
+		UserID: "user-1", NamespaceID: repo.NamespaceID, AllowBits: store.DefaultNamespaceGrant(), CreatedAt: now, UpdatedAt: now,
+	}))
+	_, token, err := st.GenerateUserToken("user-1", nil, nil, nil)
+	require.NoError(t, err)
+
+	storage := presignedTestStorage{lfs.NewLocalStorage(filepath.Join(t.TempDir(), "lfs"))}
+	h := NewLFSHandler(st, storage, "http://eph.test", 16)
+	h.presigner = storage
+
+	router := chi.NewRouter()
+	router.Route("/{namespace}/{repo}.git/info/lfs", func(r chi.Router) {
+		r.Mount("/", h.Routes())
+	})
+
+	call := func(path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/acme/app.git/info/lfs"+path, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), tokenContextKey, token))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	verify := func(oid string, size int) *httptest.ResponseRecorder {
+		t.Helper()
+		return call("/verify", fmt.Sprintf(`{"oid":%q,"size":%d}`, oid, size))
+	}
+	stored := func(oid string) bool {
+		t.Helper()
+		exists, err := storage.Exists(context.Background(), repo.ID, oid)
+		require.NoError(t, err)
+		return exists
+	}
+
+	t.Run("batch presigns the declared size", func(t *testing.T) {
+		oid := strings.Repeat("ab", 32)
+		rec := call("/objects/batch", fmt.Sprintf(`{"operation":"upload","objects":[{"oid":%q,"size":12}]}`, oid))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), `"Content-Length":"12"`)
+	})
+
+	t.Run("records an upload within limits", func(t *testing.T) {
+		oid := putLFSTestObject(t, storage, repo.ID, "small")
+		assert.Equal(t, http.StatusOK, verify(oid, 5).Code)
+
+		obj, err := st.GetLFSObject(repo.ID, oid)
+		require.NoError(t, err)
+		require.NotNil(t, obj)
+		assert.Equal(t, int64(5), obj.Size)
+	})
+
+	t.Run("deletes an upload larger than declared", func(t *testing.T) {
+		oid := putLFSTestObject(t, storage, repo.ID, "larger than declared")
+		assert.Equal(t, http.StatusBadRequest, verify(oid, 4).Code)
+		assert.False(t, stored(oid))
+	})
+
+	t.Run("deletes an upload over the max file size", func(t *testing.T) {
+		content := "well over sixteen bytes"
+		oid := putLFSTestObject(t, storage, repo.ID, content)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, verify(oid, len(content)).Code)
+		assert.False(t, stored(oid))
+	})
+
+	t.Run("deletes an upload over the storage quota", func(t *testing.T) {
+		ns, err := st.GetNamespace(repo.NamespaceID)
+		require.NoError(t, err)
+		limit := 8
+		ns.StorageLimitBytes = &limit
+		require.NoError(t, st.UpdateNamespace(ns))
+
+		oid := putLFSTestObject(t, storage, repo.ID, "quota")
+		assert.Equal(t, http.StatusInsufficientStorage, verify(oid, 5).Code)
+		assert.False(t, stored(oid))
+
+		obj, err := st.GetLFSObject(repo.ID, oid)
+		require.NoError(t, err)
+		assert.Nil(t, obj)
+	})
+}
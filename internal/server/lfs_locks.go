@@ -0,0 +1,270 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/lfs"
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const lfsLockPageSize = 100
+
+func lockToResponse(lock store.LFSLock) lfs.Lock {
+	return lfs.Lock{
+		ID:       lock.ID,
+		Path:     lock.Path,
+		LockedAt: lock.LockedAt,
+		Owner:    &lfs.LockOwner{Name: lock.OwnerName},
+	}
+}
+
+// normalizeLockPath validates a repo-relative file path. Returns "" if invalid.
+func normalizeLockPath(p string) string {
+	p = strings.TrimPrefix(strings.TrimSpace(p), "./")
+	if p == "" || strings.HasPrefix(p, "/") || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") {
+		return ""
+	}
+	return p
+}
+
+// requireLockUser checks write access and returns the user the lock belongs to.
+func (h *LFSHandler) requireLockUser(w http.ResponseWriter, token *store.Token, repo *store.Repo) string {
+	if !h.checkPermission(w, token, repo, true) {
+		return ""
+	}
+	if token.UserID == nil {
+		h.lfsError(w, http.StatusForbidden, "Token has no associated user")
+		return ""
+	}
+	return *token.UserID
+}
+
+func (h *LFSHandler) handleCreateLock(w http.ResponseWriter, r *http.Request) {
+	_, repo, token := h.resolveRepo(w, r)
+	if repo == nil {
+		return
+	}
+
+	userID := h.requireLockUser(w, token, repo)
+	if userID == "" {
+		return
+	}
+
+	var req lfs.CreateLockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.lfsError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	lockPath := normalizeLockPath(req.Path)
+	if lockPath == "" {
+		h.lfsError(w, http.StatusUnprocessableEntity, "Invalid path")
+		return
+	}
+
+	lock := &store.LFSLock{
+		ID:       uuid.New().String(),
+		RepoID:   repo.ID,
+		Path:     lockPath,
+		OwnerID:  userID,
+		LockedAt: time.Now(),
+	}
+	if req.Ref != nil && req.Ref.Name != "" {
+		lock.Ref = &req.Ref.Name
+	}
+
+	if err := h.store.CreateLFSLock(lock); err != nil {
+		if errors.Is(err, store.ErrDuplicateLFSLock) {
+			h.writeLockConflict(w, repo, lockPath)
+			return
+		}
+		h.lfsError(w, http.StatusInternalServerError, "Failed to create lock")
+		return
+	}
+
+	created, err := h.store.GetLFSLock(repo.ID, lock.ID)
+	if err != nil || created == nil {
+		h.lfsError(w, http.StatusInternalServerError, "Failed to get lock")
+		return
+	}
+
+	resp := lockToResponse(*created)
+	h.lfsJSON(w, http.StatusCreated, lfs.LockResponse{Lock: &resp})
+}
+
+func (h *LFSHandler) writeLockConflict(w http.ResponseWriter, repo *store.Repo, lockPath string) {
+	existing, err := h.store.ListLFSLocks(repo.ID, lockPath, "", 1)
+	if err != nil || len(existing) == 0 {
+		h.lfsError(w, http.StatusConflict, "Path is already locked")
+		return
+	}
+
+	resp := lockToResponse(existing[0])
+	h.lfsJSON(w, http.StatusConflict, lfs.LockResponse{Lock: &resp, Message: "Path is already locked"})
+}
+
+func (h *LFSHandler) handleListLocks(w http.ResponseWriter, r *http.Request) {
+	_, repo, token := h.resolveRepo(w, r)
+	if repo == nil {
+		return
+	}
+
+	if !h.checkPermission(w, token, repo, false) {
+		return
+	}
+
+	q := r.URL.Query()
+
+	if id := q.Get("id"); id != "" {
+		lock, err := h.store.GetLFSLock(repo.ID, id)
+		if err != nil {
+			h.lfsError(w, http.StatusInternalServerError, "Failed to get lock")
+			return
+		}
+
+		resp := lfs.LockListResponse{Locks: []lfs.Lock{}}
+		if lock != nil && (q.Get("path") == "" || lock.Path == normalizeLockPath(q.Get("path"))) {
+			resp.Locks = append(resp.Locks, lockToResponse(*lock))
+		}
+		h.lfsJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	lockPath := ""
+	if q.Get("path") != "" {
+		lockPath = normalizeLockPath(q.Get("path"))
+		if lockPath == "" {
+			h.lfsError(w, http.StatusUnprocessableEntity, "Invalid path")
+			return
+		}
+	}
+
+	limit := parseLimit(q.Get("limit"), lfsLockPageSize)
+	locks, err := h.store.ListLFSLocks(repo.ID, lockPath, q.Get("cursor"), limit+1)
+	if err != nil {
+		h.lfsError(w, http.StatusInternalServerError, "Failed to list locks")
+		return
+	}
+
+	locks, nextCursor, _ := paginateSlice(locks, limit, func(l store.LFSLock) string { return l.ID })
+
+	resp := lfs.LockListResponse{Locks: make([]lfs.Lock, len(locks))}
+	for i, lock := range locks {
+		resp.Locks[i] = lockToResponse(lock)
+	}
+	if nextCursor != nil {
+		resp.NextCursor = *nextCursor
+	}
+
+	h.lfsJSON(w, http.StatusOK, resp)
+}
+
+func (h *LFSHandler) handleVerifyLocks(w http.ResponseWriter, r *http.Request) {
+	_, repo, token := h.resolveRepo(w, r)
+	if repo == nil {
+		return
+	}
+
+	userID := h.requireLockUser(w, token, repo)
+	if userID == "" {
+		return
+	}
+
+	var req lfs.VerifyLocksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.lfsError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	limit := req.Limit
+	if limit < 1 || limit > lfsLockPageSize {
+		limit = lfsLockPageSize
+	}
+
+	locks, err := h.store.ListLFSLocks(repo.ID, "", req.Cursor, limit+1)
+	if err != nil {
+		h.lfsError(w, http.StatusInternalServerError, "Failed to list locks")
+		return
+	}
+
+	locks, nextCursor, _ := paginateSlice(locks, limit, func(l store.LFSLock) string { return l.ID })
+
+	resp := lfs.VerifyLocksResponse{Ours: []lfs.Lock{}, Theirs: []lfs.Lock{}}
+	for _, lock := range locks {
+		if lock.OwnerID == userID {
+			resp.Ours = append(resp.Ours, lockToResponse(lock))
+		} else {
+			resp.Theirs = append(resp.Theirs, lockToResponse(lock))
+		}
+	}
+	if nextCursor != nil {
+		resp.NextCursor = *nextCursor
+	}
+
+	h.lfsJSON(w, http.StatusOK, resp)
+}
+
+// handleUnlock releases a lock. Other users' locks can only be released with
+// force, which requires repo:admin.
+func (h *LFSHandler) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	_, repo, token := h.resolveRepo(w, r)
+	if repo == nil {
+		return
+	}
+
+	userID := h.requireLockUser(w, token, repo)
+	if userID == "" {
+		return
+	}
+
+	var req lfs.UnlockRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.lfsError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	lock, err := h.store.GetLFSLock(repo.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		h.lfsError(w, http.StatusInternalServerError, "Failed to get lock")
+		return
+	}
+	if lock == nil {
+		h.lfsError(w, http.StatusNotFound, "Lock not found")
+		return
+	}
+
+	if lock.OwnerID != userID {
+		if !req.Force {
+			h.lfsError(w, http.StatusForbidden, "Lock is owned by "+lock.OwnerName+", use --force to unlock")
+			return
+		}
+
+		isAdmin, err := h.permissions.CheckRepoPermission(token.ID, repo, store.PermRepoAdmin)
+		if err != nil {
+			h.lfsError(w, http.StatusInternalServerError, "Failed to check permissions")
+			return
+		}
+		if !isAdmin {
+			h.lfsError(w, http.StatusForbidden, "Force unlock requires repo:admin")
+			return
+		}
+	}
+
+	if err := h.store.DeleteLFSLock(lock.ID); err != nil {
+		h.lfsError(w, http.StatusInternalServerError, "Failed to delete lock")
+		return
+	}
+
+	resp := lockToResponse(*lock)
+	h.lfsJSON(w, http.StatusOK, lfs.LockResponse{Lock: &resp})
+}
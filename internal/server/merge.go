@@ -0,0 +1,369 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// Strategies for combining a head branch into a base branch.
+const (
+	// mergeStrategyMerge creates a merge commit, even when a fast-forward is possible.
+	mergeStrategyMerge = "merge"
+	// mergeStrategySquash creates a single commit with all of head's changes.
+	mergeStrategySquash = "squash"
+	// mergeStrategyRebase replays head's commits onto base, then fast-forwards.
+	mergeStrategyRebase = "rebase"
+)
+
+var (
+	errUnrelatedHistories = errors.New("branches have no common history")
+	errRebaseMergeCommits = errors.New("branch contains merge commits and cannot be rebased")
+	errRefMoved           = errors.New("branch was updated during the merge, try again")
+	errNotFastForward     = errors.New("branch cannot be fast-forwarded")
+)
+
+// mergeConflictError lists the files that could not be merged cleanly.
+type mergeConflictError struct {
+	Files []string
+}
+
+func (e *mergeConflictError) Error() string {
+	if len(e.Files) == 1 {
+		return "merge conflict in 1 file"
+	}
+	return fmt.Sprintf("merge conflicts in %d files", len(e.Files))
+}
+
+type mergeErrorResponse struct {
+	Error     string   `json:"error"`
+	Code      string   `json:"code"`
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// writeMergeError reports why a merge could not be made. Conflicts and other
+// problems with the branches are 409s that name the conflicting files.
+func writeMergeError(w http.ResponseWriter, err error) {
+	resp := mergeErrorResponse{Error: err.Error()}
+
+	var conflictErr *mergeConflictError
+	switch {
+	case errors.As(err, &conflictErr):
+		resp.Code = "merge_conflict"
+		resp.Conflicts = conflictErr.Files
+	case errors.Is(err, errUnrelatedHistories):
+		resp.Code = "unrelated_histories"
+	case errors.Is(err, errRebaseMergeCommits):
+		resp.Code = "rebase_merge_commits"
+	case errors.Is(err, errRefMoved):
+		resp.Code = "ref_moved"
+	case errors.Is(err, errNotFastForward):
+		resp.Code = "not_fast_forward"
+	default:
+		slog.Warn("merge failed", "error", err)
+		JSONError(w, http.StatusInternalServerError, "Failed to merge")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func isValidMergeStrategy(strategy string) bool {
+	switch strategy {
+	case mergeStrategyMerge, mergeStrategySquash, mergeStrategyRebase:
+		return true
+	default:
+		return false
+	}
+}
+
+// mergeOptions describes how to combine head into base.
+type mergeOptions struct {
+	Strategy string
+	BaseSHA  string
+	HeadSHA  string
+	// Message is used for merge and squash commits.
+	Message string
+	// Author of merge and squash commits; rebased commits keep their authors.
+	Author    object.Signature
+	Committer object.Signature
+}
+
+// mergeCommits combines head into base with the given strategy and returns
+// the commit that base should move to. New commits are written to the repo,
+// but no refs are updated.
+func mergeCommits(ctx context.Context, gitRepo *git.Repository, repoPath string, opts mergeOptions) (string, error) {
+	switch opts.Strategy {
+	case mergeStrategyMerge, mergeStrategySquash:
+		tree, err := gitMergeTree(ctx, repoPath, opts.BaseSHA, opts.HeadSHA)
+		if err != nil {
+			return "", err
+		}
+
+		parents := []string{opts.BaseSHA}
+		if opts.Strategy == mergeStrategyMerge {
+			parents = append(parents, opts.HeadSHA)
+		}
+		return gitCommitTree(ctx, repoPath, tree, parents, opts.Message, opts.Author, opts.Committer)
+
+	case mergeStrategyRebase:
+		return rebaseCommits(ctx, gitRepo, repoPath, opts.BaseSHA, opts.HeadSHA, opts.Committer)
+
+	default:
+		return "", fmt.Errorf("unknown merge strategy %q", opts.Strategy)
+	}
+}
+
+// rebaseCommits replays the commits on head that are not on base onto base,
+// like git rebase, and returns the new tip. Each commit is cherry-picked by
+// merging it with a temporary commit that has the current tip's tree and the
+// original parent, which makes that parent the merge base. Commits whose
+// changes are already on base are dropped.
+func rebaseCommits(ctx context.Context, gitRepo *git.Repository, repoPath, base, head string, committer object.Signature) (string, error) {
+	ancestor, err := gitIsAncestor(ctx, repoPath, base, head)
+	if err != nil {
+		return "", err
+	}
+	if ancestor {
+		return head, nil
+	}
+
+	output, err := gitCommandOutput(ctx, repoPath, "rev-list", "--reverse", "--topo-order", "--parents", base+".."+head)
+	if err != nil {
+		return "", err
+	}
+
+	tip := base
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case len(fields) == 1:
+			return "", errUnrelatedHistories
+		case len(fields) > 2:
+			return "", errRebaseMergeCommits
+		}
+
+		sha, parent := fields[0], fields[1]
+		if parent == tip {
+			tip = sha
+			continue
+		}
+
+		commit, err := gitRepo.CommitObject(plumbing.NewHash(sha))
+		if err != nil {
+			return "", fmt.Errorf("load commit %s: %w", sha, err)
+		}
+
+		tipTree, err := gitCommandOutput(ctx, repoPath, "rev-parse", tip+"^{tree}")
+		if err != nil {
+			return "", err
+		}
+
+		pick, err := gitCommitTree(ctx, repoPath, strings.TrimSpace(string(tipTree)), []string{parent}, "rebase", committer, committer)
+		if err != nil {
+			return "", err
+		}
+
+		tree, err := gitMergeTree(ctx, repoPath, pick, sha)
+		if err != nil {
+			return "", err
+		}
+		if tree == strings.TrimSpace(string(tipTree)) {
+			continue
+		}
+
+		tip, err = gitCommitTree(ctx, repoPath, tree, []string{tip}, commit.Message, commit.Author, committer)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return tip, nil
+}
+
+// gitMergeTree merges two commits without a working tree and returns the
+// resulting tree. Conflicts are reported as a *mergeConflictError.
+func gitMergeTree(ctx context.Context, repoPath, ours, theirs string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "merge-tree", "--write-tree", "-z", "--name-only", "--no-messages", ours, theirs)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		if strings.Contains(stderr.String(), "unrelated histories") {
+			return "", errUnrelatedHistories
+		}
+		return "", fmt.Errorf("git merge-tree: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	fields := strings.Split(string(output), "\x00")
+	tree := strings.TrimSpace(fields[0])
+	if err == nil {
+		return tree, nil
+	}
+
+	// Exit code 1 means conflicts; the conflicted paths follow the tree.
+	conflictErr := &mergeConflictError{}
+	seen := make(map[string]bool)
+	for _, path := range fields[1:] {
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		conflictErr.Files = append(conflictErr.Files, path)
+	}
+	return tree, conflictErr
+}
+
+// gitCommitTree writes a commit for tree with the given parents and returns
+// its SHA. A zero When in a signature means now.
+func gitCommitTree(ctx context.Context, repoPath, tree string, parents []string, message string, author, committer object.Signature) (string, error) {
+	args := []string{"-C", repoPath, "commit-tree", tree}
+	for _, parent := range parents {
+		args = append(args, "-p", parent)
+	}
+
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), signatureEnv("AUTHOR", author)...)
+	cmd.Env = append(cmd.Env, signatureEnv("COMMITTER", committer)...)
+	cmd.Stdin = strings.NewReader(message)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git commit-tree: %s", strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// signatureEnv sets the git identity for role, either AUTHOR or COMMITTER.
+func signatureEnv(role string, sig object.Signature) []string {
+	env := []string{
+		"GIT_" + role + "_NAME=" + sig.Name,
+		"GIT_" + role + "_EMAIL=" + sig.Email,
+	}
+	if !sig.When.IsZero() {
+		env = append(env, fmt.Sprintf("GIT_%s_DATE=%d %s", role, sig.When.Unix(), sig.When.Format("-0700")))
+	}
+	return env
+}
+
+// gitUpdateRef points ref at newSHA, provided it still points at oldSHA.
+func gitUpdateRef(ctx context.Context, repoPath, ref, newSHA, oldSHA string) error {
+	return gitUpdateRefs(ctx, repoPath, []refUpdate{{OldSHA: oldSHA, NewSHA: newSHA, Ref: ref}})
+}
+
+// gitUpdateRefs applies updates in a single transaction, provided every ref
+// still points at its OldSHA. A zero OldSHA requires the ref not to exist and
+// a zero NewSHA deletes it.
+func gitUpdateRefs(ctx context.Context, repoPath string, updates []refUpdate) error {
+	var input strings.Builder
+	for _, u := range updates {
+		fmt.Fprintf(&input, "update %s %s %s\n", u.Ref, u.NewSHA, u.OldSHA)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "update-ref", "--stdin")
+	cmd.Stdin = strings.NewReader(input.String())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := string(output)
+		if strings.Contains(msg, "but expected") || strings.Contains(msg, "reference already exists") || strings.Contains(msg, "unable to resolve reference") {
+			return errRefMoved
+		}
+		return fmt.Errorf("git update-ref: %s", strings.TrimSpace(msg))
+	}
+	return nil
+}
+
+// updateBranch moves a branch from oldSHA to a commit made on the server,
+// subject to branch protection, and records the update like a push. A zero
+// oldSHA creates the branch. It writes an error response and returns false on
+// failure.
+func (s *Server) updateBranch(ctx context.Context, w http.ResponseWriter, token *store.Token, repo *store.Repo, repoPath, branch, oldSHA, newSHA string) bool {
+	ref := plumbing.NewBranchReferenceName(branch).String()
+	update := refUpdate{OldSHA: oldSHA, NewSHA: newSHA, Ref: ref}
+	if err := s.checkProtectedRefUpdate(ctx, token, repo, update); err != nil {
+		writeProtectionError(w, err)
+		return false
+	}
+
+	if err := gitUpdateRef(ctx, repoPath, ref, newSHA, oldSHA); err != nil {
+		writeMergeError(w, err)
+		return false
+	}
+	s.gitHandler.recordPush(repo, repoPath, pushActor{UserID: *token.UserID, TokenID: &token.ID}, []refUpdate{update})
+	return true
+}
+
+// commitIdentity is an author identity supplied in a request.
+type commitIdentity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// validateCommitIdentity checks a commit identity from a request.
+func validateCommitIdentity(id *commitIdentity) string {
+	id.Name = strings.TrimSpace(id.Name)
+	id.Email = strings.TrimSpace(id.Email)
+	if id.Name == "" || id.Email == "" {
+		return "author name and email are required"
+	}
+	if strings.ContainsAny(id.Name+id.Email, "<>\n\r\x00") {
+		return "author name and email cannot contain <, > or newlines"
+	}
+	return ""
+}
+
+// userSignature is the identity recorded on commits the server makes for a
+// user: their primary namespace name, at the host the request was made to.
+func (s *Server) userSignature(r *http.Request, userID string) (object.Signature, error) {
+	name := userID
+
+	user, err := s.store.GetUser(userID)
+	if err != nil {
+		return object.Signature{}, fmt.Errorf("get user: %w", err)
+	}
+	if user != nil {
+		ns, err := s.store.GetNamespace(user.PrimaryNamespaceID)
+		if err != nil {
+			return object.Signature{}, fmt.Errorf("get namespace: %w", err)
+		}
+		if ns != nil {
+			name = ns.Name
+		}
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	return object.Signature{Name: name, Email: name + "@" + host}, nil
+}
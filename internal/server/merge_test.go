@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMergeTestRepo pushes a main branch with one file and returns the bare
+// repo and a work tree to build branches in.
+func newMergeTestRepo(t *testing.T) (string, string) {
+	t.Helper()
+
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	require.NoError(t, initBareRepo(repoPath))
+
+	work := t.TempDir()
+	runGit(t, work, "init", "-q", "-b", "main")
+	writeMergeTestFile(t, work, "README", "one\ntwo\nthree\n")
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "-q", "-m", "Initial commit")
+	runGit(t, work, "push", "-q", repoPath, "main")
+	return repoPath, work
+}
+
+func writeMergeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
+
+func commitMergeTestFile(t *testing.T, work, name, content, message string) {
+	t.Helper()
+	writeMergeTestFile(t, work, name, content)
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "-q", "-m", message)
+}
+
+func mergeTestHead(t *testing.T, gitRepo *git.Repository, branch string) string {
+	t.Helper()
+	sha, err := branchHead(gitRepo, branch)
+	require.NoError(t, err)
+	require.NotEmpty(t, sha)
+	return sha
+}
+
+func mergeTestFile(t *testing.T, gitRepo *git.Repository, sha, name string) string {
+	t.Helper()
+	commit, err := gitRepo.CommitObject(plumbing.NewHash(sha))
+	require.NoError(t, err)
+	file, err := commit.File(name)
+	require.NoError(t, err)
+	content, err := file.Contents()
+	require.NoError(t, err)
+	return content
+}
+
+func TestMergeCommits(t *testing.T) {
+	repoPath, work := newMergeTestRepo(t)
+
+	runGit(t, work, "checkout", "-q", "-b", "feature")
+	commitMergeTestFile(t, work, "feature.txt", "feature\n", "Add feature")
+	commitMergeTestFile(t, work, "README", "one\ntwo\nthree\nfour\n", "Extend readme")
+	runGit(t, work, "checkout", "-q", "main")
+	commitMergeTestFile(t, work, "main.txt", "main\n", "Work on main")
+	runGit(t, work, "push", "-q", repoPath, "main", "feature")
+
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	base := mergeTestHead(t, gitRepo, "main")
+	head := mergeTestHead(t, gitRepo, "feature")
+
+	ctx := context.Background()
+	sig := object.Signature{Name: "merger", Email: "merger@example.com"}
+	opts := mergeOptions{BaseSHA: base, HeadSHA: head, Message: "Merge feature", Author: sig, Committer: sig}
+
+	t.Run("merge", func(t *testing.T) {
+		opts := opts
+		opts.Strategy = mergeStrategyMerge
+		sha, err := mergeCommits(ctx, gitRepo, repoPath, opts)
+		require.NoError(t, err)
+
+		commit, err := gitRepo.CommitObject(plumbing.NewHash(sha))
+		require.NoError(t, err)
+		assert.Equal(t, []plumbing.Hash{plumbing.NewHash(base), plumbing.NewHash(head)}, commit.ParentHashes)
+		assert.Equal(t, "Merge feature\n", commit.Message)
+		assert.Equal(t, "merger@example.com", commit.Committer.Email)
+		assert.Equal(t, "feature\n", mergeTestFile(t, gitRepo, sha, "feature.txt"))
+		assert.Equal(t, "main\n", mergeTestFile(t, gitRepo, sha, "main.txt"))
+	})
+
+	t.Run("squash", func(t *testing.T) {
+		opts := opts
+		opts.Strategy = mergeStrategySquash
+		opts.Author = object.Signature{Name: "dev", Email: "dev@example.com"}
+		sha, err := mergeCommits(ctx, gitRepo, repoPath, opts)
+		require.NoError(t, err)
+
+		commit, err := gitRepo.CommitObject(plumbing.NewHash(sha))
+		require.NoError(t, err)
+		assert.Equal(t, []plumbing.Hash{plumbing.NewHash(base)}, commit.ParentHashes)
+		assert.Equal(t, "dev@example.com", commit.Author.Email)
+		assert.Equal(t, "merger@example.com", commit.Committer.Email)
+		assert.Equal(t, "one\ntwo\nthree\nfour\n", mergeTestFile(t, gitRepo, sha, "README"))
+	})
+
+	t.Run("rebase", func(t *testing.T) {
+		opts := opts
+		opts.Strategy = mergeStrategyRebase
+		sha, err := mergeCommits(ctx, gitRepo, repoPath, opts)
+		require.NoError(t, err)
+
+		output, err := gitCommandOutput(ctx, repoPath, "log", "--format=%s|%ae|%ce", base+".."+sha)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"Extend readme|test@example.com|merger@example.com",
+			"Add feature|test@example.com|merger@example.com",
+		}, strings.Split(strings.TrimSpace(string(output)), "\n"), "commits keep their authors and order")
+
+		ancestor, err := gitIsAncestor(ctx, repoPath, base, sha)
+		require.NoError(t, err)
+		assert.True(t, ancestor)
+		assert.Equal(t, "main\n", mergeTestFile(t, gitRepo, sha, "main.txt"))
+	})
+
+	t.Run("rebase fast-forwards", func(t *testing.T) {
+		sha, err := rebaseCommits(ctx, gitRepo, repoPath, base, base, sig)
+		require.NoError(t, err)
+		assert.Equal(t, base, sha)
+	})
+}
+
+func TestMergeCommits_Conflict(t *testing.T) {
+	repoPath, work := newMergeTestRepo(t)
+
+	runGit(t, work, "checkout", "-q", "-b", "feature")
+	commitMergeTestFile(t, work, "README", "one\nfeature\nthree\n", "Change readme on feature")
+	runGit(t, work, "checkout", "-q", "main")
+	commitMergeTestFile(t, work, "README", "one\nmain\nthree\n", "Change readme on main")
+	runGit(t, work, "push", "-q", repoPath, "main", "feature")
+
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	base := mergeTestHead(t, gitRepo, "main")
+	head := mergeTestHead(t, gitRepo, "feature")
+
+	sig := object.Signature{Name: "merger", Email: "merger@example.com"}
+	for _, strategy := range []string{mergeStrategyMerge, mergeStrategySquash, mergeStrategyRebase} {
+		_, err := mergeCommits(context.Background(), gitRepo, repoPath, mergeOptions{
+			Strategy: strategy, BaseSHA: base, HeadSHA: head, Message: "Merge", Author: sig, Committer: sig,
+		})
+		var conflictErr *mergeConflictError
+		require.ErrorAs(t, err, &conflictErr, strategy)
+		assert.Equal(t, []string{"README"}, conflictErr.Files, strategy)
+	}
+}
+
+func TestGitUpdateRef(t *testing.T) {
+	repoPath, work := newMergeTestRepo(t)
+	commitMergeTestFile(t, work, "README", "changed\n", "Change readme")
+	runGit(t, work, "push", "-q", repoPath, "main:other")
+
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	main := mergeTestHead(t, gitRepo, "main")
+	other := mergeTestHead(t, gitRepo, "other")
+
+	ctx := context.Background()
+	err = gitUpdateRef(ctx, repoPath, "refs/heads/main", other, other)
+	assert.ErrorIs(t, err, errRefMoved, "ref no longer at the expected commit")
+
+	require.NoError(t, gitUpdateRef(ctx, repoPath, "refs/heads/main", other, main))
+	assert.Equal(t, other, mergeTestHead(t, gitRepo, "main"))
+}
+
+func TestGitUpdateRefs(t *testing.T) {
+	repoPath, work := newMergeTestRepo(t)
+	commitMergeTestFile(t, work, "README", "changed\n", "Change readme")
+	runGit(t, work, "push", "-q", repoPath, "main:other")
+
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	main := mergeTestHead(t, gitRepo, "main")
+	other := mergeTestHead(t, gitRepo, "other")
+	zero := plumbing.ZeroHash.String()
+
+	ctx := context.Background()
+	rename := []refUpdate{
+		{OldSHA: other, NewSHA: zero, Ref: "refs/heads/main"},
+		{OldSHA: zero, NewSHA: main, Ref: "refs/heads/renamed"},
+	}
+	assert.ErrorIs(t, gitUpdateRefs(ctx, repoPath, rename), errRefMoved, "old ref moved")
+	_, err = gitRepo.Reference("refs/heads/renamed", true)
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound, "failed rename leaves no new ref")
+
+	create := []refUpdate{{OldSHA: zero, NewSHA: main, Ref: "refs/heads/other"}}
+	assert.ErrorIs(t, gitUpdateRefs(ctx, repoPath, create), errRefMoved, "ref created concurrently")
+
+	rename[0].OldSHA = main
+	require.NoError(t, gitUpdateRefs(ctx, repoPath, rename))
+	assert.Equal(t, main, mergeTestHead(t, gitRepo, "renamed"))
+	_, err = gitRepo.Reference("refs/heads/main", true)
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+	remove := []refUpdate{{OldSHA: main, NewSHA: zero, Ref: "refs/heads/other"}}
+	assert.ErrorIs(t, gitUpdateRefs(ctx, repoPath, remove), errRefMoved, "deleted ref moved")
+	assert.Equal(t, other, mergeTestHead(t, gitRepo, "other"))
+}
+
+func TestDescribeMergeHead(t *testing.T) {
+	repoPath, work := newMergeTestRepo(t)
+	runGit(t, work, "checkout", "-q", "-b", "feature")
+	commitMergeTestFile(t, work, "feature.txt", "feature\n", "Add feature")
+	runGit(t, work, "tag", "v1.0")
+	runGit(t, work, "push", "-q", repoPath, "feature", "v1.0")
+
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	sha := mergeTestHead(t, gitRepo, "feature")
+
+	tests := []struct {
+		head string
+		want string
+	}{
+		{"feature", "branch 'feature'"},
+		{"v1.0", "tag 'v1.0'"},
+		{sha, "commit '" + sha[:7] + "'"},
+		{sha[:10], "commit '" + sha[:7] + "'"},
+		{"feature~0", "commit '" + sha[:7] + "'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.head, func(t *testing.T) {
+			assert.Equal(t, tt.want, describeMergeHead(gitRepo, tt.head, sha))
+		})
+	}
+}
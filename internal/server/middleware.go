@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
@@ -15,6 +16,10 @@ type contextKey string
 
 const tokenContextKey contextKey = "token"
 
+// tokenLastUsedInterval is how stale a token's last_used_at may get before
+// it is refreshed.
+const tokenLastUsedInterval = time.Minute
+
 // authError represents an authentication error with an associated HTTP status code.
 type authError struct {
 	message string
@@ -102,10 +107,19 @@ func lookupToken(st store.Store, rawToken string) (*store.Token, error) {
 		return nil, &authError{"Invalid token", http.StatusUnauthorized}
 	}
 
-	if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()) {
+	now := time.Now()
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(now) {
 		return nil, &authError{"Token expired", http.StatusUnauthorized}
 	}
 
+	// Only record use once per interval so busy tokens don't write on
+	// every request.
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= tokenLastUsedInterval {
+		if err := st.UpdateTokenLastUsed(token.ID, now); err != nil {
+			slog.Warn("failed to update token last_used_at", "token_id", token.ID, "error", err)
+		}
+	}
+
 	return token, nil
 }
 
@@ -132,9 +146,44 @@ func validateBasicAuth(st store.Store, r *http.Request) (*store.Token, error) {
 		return nil, &authError{"Invalid credentials", http.StatusUnauthorized}
 	}
 
+	if core.IsDeployToken(password) {
+		return lookupDeployToken(st, password)
+	}
+
 	return lookupToken(st, password)
 }
 
+// lookupDeployToken verifies a deploy key token and returns a token carrying
+// the key. Deploy tokens are only accepted on the git routes, which check
+// Token.DeployKey; everywhere else the token matches no grants.
+func lookupDeployToken(st store.Store, rawToken string) (*store.Token, error) {
+	lookup, _, err := core.ParseDeployToken(rawToken)
+	if err != nil {
+		return nil, &authError{"Invalid token format", http.StatusUnauthorized}
+	}
+
+	key, err := st.GetDeployKeyByLookup(lookup)
+	if err != nil {
+		return nil, &authError{"Internal server error", http.StatusInternalServerError}
+	}
+	if key == nil {
+		return nil, &authError{"Invalid token", http.StatusUnauthorized}
+	}
+
+	if err := core.VerifyToken(rawToken, key.TokenHash); err != nil {
+		return nil, &authError{"Invalid token", http.StatusUnauthorized}
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= tokenLastUsedInterval {
+		if err := st.UpdateDeployKeyLastUsed(key.ID, now); err != nil {
+			slog.Warn("failed to update deploy key last_used_at", "deploy_key_id", key.ID, "error", err)
+		}
+	}
+
+	return &store.Token{ID: key.ID, CreatedAt: key.CreatedAt, DeployKey: key}, nil
+}
+
 // GetTokenFromContext retrieves the token from the request context.
 func GetTokenFromContext(ctx context.Context) *store.Token {
 	token, _ := ctx.Value(tokenContextKey).(*store.Token)
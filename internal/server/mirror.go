@@ -0,0 +1,608 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const (
+	defaultMirrorInterval = time.Hour
+	minMirrorInterval     = time.Minute
+	mirrorPollInterval    = 30 * time.Second
+	mirrorBatchSize       = 10
+	mirrorGitTimeout      = 10 * time.Minute
+	mirrorMaxErrorBytes   = 1024
+
+	// mirrorStagingPollInterval is how often a quota-limited fetch checks how
+	// much it has downloaded.
+	mirrorStagingPollInterval = time.Second
+)
+
+var mirrorRefspecs = []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+
+var (
+	errMirrorSyncInProgress   = errors.New("mirror sync already in progress")
+	errMirrorAddressNotPublic = errors.New("mirror address is not public")
+)
+
+// MirrorCredential authenticates mirror fetches and pushes over HTTP(S).
+// Password may be a personal access token.
+type MirrorCredential struct {
+	Username string
+	Password string
+	// URLPrefixes are the URLs the credential may be sent to, such as
+	// "https://github.com/acme/". Mirrors can only use it for URLs under one
+	// of them, so users can't send the secret to a host of their choosing.
+	URLPrefixes []string
+}
+
+// allows reports whether the credential may be sent to the mirror URL: the
+// scheme and host must match a prefix exactly and the path must be at or
+// below the prefix's path.
+func (c MirrorCredential) allows(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.User != nil {
+		return false
+	}
+	urlPath := path.Clean("/" + u.Path)
+
+	for _, prefix := range c.URLPrefixes {
+		p, err := url.Parse(prefix)
+		if err != nil || p.Host == "" {
+			continue
+		}
+		if !strings.EqualFold(u.Scheme, p.Scheme) || !strings.EqualFold(u.Host, p.Host) {
+			continue
+		}
+		prefixPath := strings.TrimSuffix(path.Clean("/"+p.Path), "/")
+		if urlPath == prefixPath || strings.HasPrefix(urlPath, prefixPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// MirrorOptions configures pull and push mirrors.
+type MirrorOptions struct {
+	// Credentials are referenced by name from a repo's mirror config, so
+	// secrets stay in the server config instead of the database.
+	Credentials map[string]MirrorCredential
+	// AllowLocal permits file:// mirror URLs and remotes on loopback, private
+	// and link-local addresses. It lets users read and write any repository
+	// the server process can access and reach services on the server's
+	// network, so only enable it on trusted servers.
+	AllowLocal bool
+}
+
+// mirrorSyncer fetches pull mirrors from their upstreams on their configured
+// interval. A repo is never synced by two goroutines at once.
+type mirrorSyncer struct {
+	store   store.Store
+	dataDir string
+	opts    MirrorOptions
+	wake    chan struct{}
+
+	// git records the ref updates of a sync like a push by the system, so
+	// they reach push events, webhooks, push mirrors and search.
+	git *GitHTTPHandler
+
+	mu      sync.Mutex
+	running map[string]chan struct{} // closed when the repo's sync finishes
+}
+
+func newMirrorSyncer(st store.Store, dataDir string, opts MirrorOptions) *mirrorSyncer {
+	return &mirrorSyncer{
+		store:   st,
+		dataDir: dataDir,
+		opts:    opts,
+		wake:    make(chan struct{}, 1),
+		running: make(map[string]chan struct{}),
+	}
+}
+
+// validateURL checks that a mirror URL uses an allowed scheme and carries no
+// credentials, which would otherwise be exposed in API responses. Unless
+// AllowLocal is set, a host given as an address must be public; host names
+// are checked each time they are resolved, by remoteEnv.
+func (o MirrorOptions) validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("mirror URL must be an absolute URL")
+	}
+
+	switch u.Scheme {
+	case "http", "https", "git":
+		if u.Host == "" {
+			return fmt.Errorf("mirror URL must include a host")
+		}
+		if !o.AllowLocal && !isPublicMirrorHost(u.Hostname()) {
+			return fmt.Errorf("mirror URL must not point to a local or private address")
+		}
+	case "file":
+		if !o.AllowLocal {
+			return fmt.Errorf("local mirror URLs are not allowed on this server")
+		}
+	default:
+		return fmt.Errorf("mirror URL scheme must be http, https or git")
+	}
+
+	if u.User != nil {
+		return fmt.Errorf("mirror URL must not contain credentials, use a configured credential instead")
+	}
+	return nil
+}
+
+// isPublicMirrorHost reports whether a URL host may be public: names other
+// than localhost, and public addresses.
+func isPublicMirrorHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return isPublicAddr(addr)
+	}
+	return true
+}
+
+// validateCredentials checks that a credential reference names a configured
+// credential that may be used for the mirror URL.
+func (o MirrorOptions) validateCredentials(name *string, rawURL string) error {
+	_, err := o.credential(name, rawURL)
+	return err
+}
+
+// credential returns the named credential, or nil if name is nil. It is
+// looked up again on every use, so a mirror stops using a credential as soon
+// as the URL is no longer allowed by the server config.
+func (o MirrorOptions) credential(name *string, rawURL string) (*MirrorCredential, error) {
+	if name == nil {
+		return nil, nil
+	}
+	cred, ok := o.Credentials[*name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mirror credentials %q", *name)
+	}
+	if !cred.allows(rawURL) {
+		return nil, fmt.Errorf("mirror credentials %q cannot be used for this URL", *name)
+	}
+	return &cred, nil
+}
+
+func (m *mirrorSyncer) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run syncs due mirrors until the context is cancelled.
+func (m *mirrorSyncer) run(ctx context.Context) {
+	ticker := time.NewTicker(mirrorPollInterval)
+	defer ticker.Stop()
+
+	for {
+		m.syncDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.wake:
+		}
+	}
+}
+
+func (m *mirrorSyncer) syncDue(ctx context.Context) {
+	repos, err := m.store.ListDueRepoMirrors(time.Now(), mirrorBatchSize)
+	if err != nil {
+		slog.Warn("failed to list due mirrors", "error", err)
+		return
+	}
+
+	for i := range repos {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := m.sync(ctx, &repos[i], false); err != nil && !errors.Is(err, errMirrorSyncInProgress) {
+			slog.Warn("mirror sync failed", "repo_id", repos[i].ID, "error", err)
+		}
+	}
+}
+
+// sync fetches a mirror from its upstream and records the outcome. If the repo
+// is already being synced, it waits for that sync to finish when wait is set
+// and returns errMirrorSyncInProgress otherwise.
+func (m *mirrorSyncer) sync(ctx context.Context, repo *store.Repo, wait bool) error {
+	if repo.Mirror == nil {
+		return fmt.Errorf("repository is not a mirror")
+	}
+	if err := m.acquire(ctx, repo.ID, wait); err != nil {
+		return err
+	}
+	defer m.release(repo.ID)
+
+	started := time.Now()
+	syncErr := m.fetch(ctx, repo)
+
+	var msg *string
+	if syncErr != nil {
+		text := syncErr.Error()
+		if len(text) > mirrorMaxErrorBytes {
+			text = text[:mirrorMaxErrorBytes]
+		}
+		msg = &text
+	}
+
+	next := started.Add(time.Duration(repo.Mirror.IntervalSeconds) * time.Second)
+	if err := m.store.RecordRepoMirrorSync(repo.ID, started, next, msg); err != nil {
+		slog.Warn("failed to record mirror sync", "repo_id", repo.ID, "error", err)
+	}
+
+	return syncErr
+}
+
+func (m *mirrorSyncer) acquire(ctx context.Context, repoID string, wait bool) error {
+	for {
+		m.mu.Lock()
+		done, busy := m.running[repoID]
+		if !busy {
+			m.running[repoID] = make(chan struct{})
+			m.mu.Unlock()
+			return nil
+		}
+		m.mu.Unlock()
+
+		if !wait {
+			return errMirrorSyncInProgress
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *mirrorSyncer) release(repoID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	close(m.running[repoID])
+	delete(m.running, repoID)
+}
+
+// fetch mirrors the upstream's branches and tags into the bare repo, pruning
+// refs the upstream no longer has, and points HEAD at the upstream default branch.
+func (m *mirrorSyncer) fetch(ctx context.Context, repo *store.Repo) error {
+	ctx, cancel := context.WithTimeout(ctx, mirrorGitTimeout)
+	defer cancel()
+
+	repoPath, err := SafeRepoPath(m.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		return fmt.Errorf("resolve repo path: %w", err)
+	}
+
+	limit, used, limited, err := storageUsage(m.store, repo.NamespaceID)
+	if err != nil {
+		return err
+	}
+	if limited && used >= limit {
+		return &quotaError{Quota: quotaStorageLimit, Limit: limit, Used: used}
+	}
+
+	env, upstream, err := m.opts.remoteEnv(ctx, repo.Mirror.Credentials, repo.Mirror.URL)
+	if err != nil {
+		return err
+	}
+
+	before, err := listRefs(ctx, repoPath)
+	if err != nil {
+		return fmt.Errorf("read refs: %w", err)
+	}
+
+	if limited {
+		err = fetchWithinQuota(ctx, repoPath, env, upstream, limit, used)
+	} else {
+		err = runMirrorGit(ctx, repoPath, env, append([]string{"fetch", "--prune", "--quiet", upstream}, mirrorRefspecs...)...)
+	}
+	if err != nil {
+		return err
+	}
+
+	if head, err := remoteHead(ctx, repoPath, env, upstream); err != nil {
+		slog.Warn("failed to read mirror upstream HEAD", "repo_id", repo.ID, "error", err)
+	} else if head != "" {
+		if err := runMirrorGit(ctx, repoPath, env, "symbolic-ref", "HEAD", head); err != nil {
+			slog.Warn("failed to update mirror HEAD", "repo_id", repo.ID, "error", err)
+		}
+	}
+
+	after, err := listRefs(ctx, repoPath)
+	if err != nil {
+		return fmt.Errorf("read refs: %w", err)
+	}
+	// A sync that changes refs is recorded like a push, which also updates
+	// the repo size.
+	if updates := diffRefs(before, after); len(updates) > 0 {
+		m.git.recordPush(repo, repoPath, pushActor{}, updates)
+		return nil
+	}
+
+	sizeBytes, err := repoDiskUsage(repoPath)
+	if err != nil {
+		slog.Warn("failed to compute repo size", "repo_path", repoPath, "error", err)
+		return nil
+	}
+	if err := m.store.UpdateRepoSize(repo.ID, sizeBytes); err != nil {
+		slog.Warn("failed to update repo size_bytes", "repo_id", repo.ID, "error", err)
+	}
+
+	return nil
+}
+
+// diffRefs returns the ref updates between two snapshots, sorted by ref name.
+// Mirrors take their updates from snapshots around the fetch, which only see
+// the fetch's own changes since mirrors reject pushes and syncs of a repo
+// never overlap.
+func diffRefs(before, after map[string]string) []refUpdate {
+	zero := plumbing.ZeroHash.String()
+
+	var updates []refUpdate
+	for ref, newSHA := range after {
+		oldSHA, ok := before[ref]
+		if !ok {
+			oldSHA = zero
+		}
+		if oldSHA != newSHA {
+			updates = append(updates, refUpdate{OldSHA: oldSHA, NewSHA: newSHA, Ref: ref})
+		}
+	}
+	for ref, oldSHA := range before {
+		if _, ok := after[ref]; !ok {
+			updates = append(updates, refUpdate{OldSHA: oldSHA, NewSHA: zero, Ref: ref})
+		}
+	}
+
+	slices.SortFunc(updates, func(a, b refUpdate) int {
+		return strings.Compare(a.Ref, b.Ref)
+	})
+	return updates
+}
+
+// remoteEnv restricts git to the allowed transports, disables prompts and adds
+// the named credentials as a basic auth header for the mirror URL, returning
+// the URL to pass to git along with the environment. Redirects are not
+// followed when credentials are sent, since git would send the header on to
+// the redirect target.
+//
+// Unless AllowLocal is set, the remote's host is resolved here and every
+// address must be public. This covers pushes as well as fetches, and so the
+// credentials too, which would otherwise go wherever the name resolves at
+// push time. git would resolve the name again itself, so it is pinned to the
+// checked address, and redirects, which git would follow without the check,
+// are refused.
+func (o MirrorOptions) remoteEnv(ctx context.Context, credentials *string, rawURL string) ([]string, string, error) {
+	protocols := "http:https:git"
+	if o.AllowLocal {
+		protocols += ":file"
+	}
+
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL="+protocols)
+	cred, err := o.credential(credentials, rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	remote := rawURL
+	var config [][2]string
+	if !o.AllowLocal {
+		if remote, config, err = pinMirrorURL(ctx, rawURL); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if cred != nil {
+		auth := base64.StdEncoding.EncodeToString([]byte(cred.Username + ":" + cred.Password))
+		config = append(config, [2]string{"http.extraHeader", "Authorization: Basic " + auth})
+		if o.AllowLocal {
+			config = append(config, [2]string{"http.followRedirects", "false"})
+		}
+	}
+	if config == nil {
+		return env, remote, nil
+	}
+	return gitConfigEnv(env, config), remote, nil
+}
+
+// pinMirrorURL resolves the host of a mirror URL, checks that all of its
+// addresses are public and returns the URL and git config that make git
+// connect to the first of them. http(s) URLs keep their host name for TLS
+// and virtual hosting, with the address passed to curl; git:// URLs are
+// rewritten to the address.
+func pinMirrorURL(ctx context.Context, rawURL string) (string, [][2]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("parse mirror URL: %w", err)
+	}
+
+	var config [][2]string
+	switch u.Scheme {
+	case "http", "https":
+		config = append(config, [2]string{"http.followRedirects", "false"})
+	case "git":
+	default:
+		return "", nil, fmt.Errorf("mirror URL scheme must be http, https or git")
+	}
+
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !isPublicAddr(addr) {
+			return "", nil, fmt.Errorf("%w: %s", errMirrorAddressNotPublic, addr)
+		}
+		return rawURL, config, nil
+	}
+	if !isPublicMirrorHost(host) {
+		return "", nil, fmt.Errorf("%w: %s", errMirrorAddressNotPublic, host)
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolve %s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return "", nil, fmt.Errorf("resolve %s: no addresses", host)
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return "", nil, fmt.Errorf("%w: %s resolves to %s", errMirrorAddressNotPublic, host, addr.Unmap())
+		}
+	}
+
+	addr := addrs[0].Unmap().String()
+	if addrs[0].Unmap().Is6() {
+		addr = "[" + addr + "]"
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		config = append(config, [2]string{"http.curloptResolve", host + ":" + port + ":" + addr})
+		return rawURL, config, nil
+	default:
+		pinned := *u
+		pinned.Host = addr
+		if port := u.Port(); port != "" {
+			pinned.Host += ":" + port
+		}
+		return pinned.String(), config, nil
+	}
+}
+
+// fetchWithinQuota fetches the upstream without letting the namespace go over
+// its storage limit. git has no fetch-side equivalent of receive.maxInputSize,
+// so the upstream is first fetched into a staging repo that borrows the
+// mirror's objects, which therefore only receives new objects. The fetch is
+// stopped as soon as the staging repo outgrows the remaining quota, and the
+// new objects and refs are only moved into the mirror once they fit.
+func fetchWithinQuota(ctx context.Context, repoPath string, env []string, upstream string, limit, used int64) error {
+	staging, err := os.MkdirTemp("", "eph-mirror-")
+	if err != nil {
+		return fmt.Errorf("create staging repo: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := runMirrorGit(ctx, staging, nil, "init", "--bare", "--quiet"); err != nil {
+		return err
+	}
+	objects, err := filepath.Abs(filepath.Join(repoPath, "objects"))
+	if err != nil {
+		return fmt.Errorf("resolve objects path: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(staging, "objects", "info", "alternates"), []byte(objects+"\n"), 0644); err != nil {
+		return fmt.Errorf("link staging repo: %w", err)
+	}
+
+	stagedObjects := filepath.Join(staging, "objects")
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var staged atomic.Int64
+	go func() {
+		ticker := time.NewTicker(mirrorStagingPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-fetchCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			if size, err := repoDiskUsage(stagedObjects); err == nil && used+size > limit {
+				staged.Store(size)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	fetchErr := runMirrorGit(fetchCtx, staging, env, append([]string{"fetch", "--quiet", upstream}, mirrorRefspecs...)...)
+	cancel()
+
+	size := staged.Load()
+	if size == 0 {
+		if size, err = repoDiskUsage(stagedObjects); err != nil {
+			return fmt.Errorf("compute staging repo size: %w", err)
+		}
+	}
+	if used+size > limit {
+		return &quotaError{Quota: quotaStorageLimit, Limit: limit, Used: used + size}
+	}
+	if fetchErr != nil {
+		return fetchErr
+	}
+
+	return runMirrorGit(ctx, repoPath, nil, append([]string{"fetch", "--prune", "--quiet", staging}, mirrorRefspecs...)...)
+}
+
+// remoteHead returns the ref the upstream HEAD points to, or "" if it has none.
+func remoteHead(ctx context.Context, repoPath string, env []string, upstream string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "ls-remote", "--symref", upstream, "HEAD")
+	cmd.Env = env
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git ls-remote: %w", err)
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		target, ok := strings.CutPrefix(line, "ref: ")
+		if !ok {
+			continue
+		}
+		if ref, _, ok := strings.Cut(target, "\t"); ok && strings.HasPrefix(ref, "refs/heads/") {
+			return ref, nil
+		}
+	}
+	return "", nil
+}
+
+func runMirrorGit(ctx context.Context, repoPath string, env []string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repoPath}, args...)...)
+	cmd.Env = env
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,696 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/lfs"
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const namespaceExportVersion = 1
+
+// NamespaceExport is the manifest of a namespace export archive. IDs are only
+// meaningful within the archive; imports assign new ones. Users are identified
+// by username, since user IDs differ between servers.
+type NamespaceExport struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Namespace  ExportedNamespace `json:"namespace"`
+	Folders    []ExportedFolder  `json:"folders"`
+	Repos      []ExportedRepo    `json:"repos"`
+	Grants     []ExportedGrant   `json:"grants"`
+	Files      []BackupFile      `json:"files"`
+}
+
+type ExportedNamespace struct {
+	Name              string  `json:"name"`
+	RepoLimit         *int    `json:"repo_limit,omitempty"`
+	StorageLimitBytes *int    `json:"storage_limit_bytes,omitempty"`
+	ExternalID        *string `json:"external_id,omitempty"`
+}
+
+type ExportedFolder struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Color *string `json:"color,omitempty"`
+}
+
+type ExportedRepo struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	Description *string             `json:"description,omitempty"`
+	Public      bool                `json:"public"`
+	FolderIDs   []string            `json:"folder_ids"`
+	CreatedAt   time.Time           `json:"created_at"`
+	LastPushAt  *time.Time          `json:"last_push_at,omitempty"`
+	Head        string              `json:"head,omitempty"`
+	Bundle      string              `json:"bundle,omitempty"`
+	LFSObjects  []ExportedLFSObject `json:"lfs_objects"`
+	Grants      []ExportedGrant     `json:"grants"`
+}
+
+type ExportedLFSObject struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+	Path string `json:"path"`
+}
+
+type ExportedGrant struct {
+	User  string   `json:"user"`
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// ExportNamespace writes a namespace, its folders, repos, grants and git and
+// LFS data to w as an archive that ImportNamespace can load on another server.
+func ExportNamespace(ctx context.Context, st store.Store, storage lfs.Storage, dataDir, name string, w io.Writer) (*NamespaceExport, error) {
+	ns, err := st.GetNamespaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("get namespace: %w", err)
+	}
+	if ns == nil {
+		return nil, fmt.Errorf("namespace %q not found", name)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "eph-export-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	export := &NamespaceExport{
+		Version:    namespaceExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Namespace: ExportedNamespace{
+			Name:              ns.Name,
+			RepoLimit:         ns.RepoLimit,
+			StorageLimitBytes: ns.StorageLimitBytes,
+			ExternalID:        ns.ExternalID,
+		},
+		Folders: []ExportedFolder{},
+		Repos:   []ExportedRepo{},
+	}
+
+	folders, err := listAllFolders(st, ns.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range folders {
+		export.Folders = append(export.Folders, ExportedFolder{ID: f.ID, Name: f.Name, Color: f.Color})
+	}
+
+	usernames := usernameResolver(st)
+
+	nsGrants, err := st.ListNamespaceGrants(ns.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list namespace grants: %w", err)
+	}
+	if export.Grants, err = exportGrants(usernames, nsGrants, func(g store.NamespaceGrant) (string, store.Permission, store.Permission) {
+		return g.UserID, g.AllowBits, g.DenyBits
+	}); err != nil {
+		return nil, err
+	}
+
+	repoGrants, err := st.ListNamespaceRepoGrants(ns.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list repo grants: %w", err)
+	}
+
+	repos, err := listNamespaceRepos(st, ns.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	b := newBackupWriter(w)
+	for _, repo := range repos {
+		entry, err := exportRepo(ctx, st, storage, b, dataDir, tmpDir, repo)
+		if err != nil {
+			return nil, fmt.Errorf("export repo %s: %w", repo.Name, err)
+		}
+
+		var grants []store.RepoGrant
+		for _, g := range repoGrants {
+			if g.RepoID == repo.ID {
+				grants = append(grants, g)
+			}
+		}
+		if entry.Grants, err = exportGrants(usernames, grants, func(g store.RepoGrant) (string, store.Permission, store.Permission) {
+			return g.UserID, g.AllowBits, g.DenyBits
+		}); err != nil {
+			return nil, err
+		}
+
+		export.Repos = append(export.Repos, *entry)
+	}
+
+	export.Files = b.files
+	if err := b.close(export, export.ExportedAt); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func exportRepo(ctx context.Context, st store.Store, storage lfs.Storage, b *backupWriter, dataDir, tmpDir string, repo store.Repo) (*ExportedRepo, error) {
+	entry := &ExportedRepo{
+		ID:          repo.ID,
+		Name:        repo.Name,
+		Description: repo.Description,
+		Public:      repo.Public,
+		FolderIDs:   []string{},
+		CreatedAt:   repo.CreatedAt,
+		LastPushAt:  repo.LastPushAt,
+		LFSObjects:  []ExportedLFSObject{},
+	}
+
+	folders, err := st.ListRepoFolders(repo.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list folders: %w", err)
+	}
+	for _, f := range folders {
+		entry.FolderIDs = append(entry.FolderIDs, f.ID)
+	}
+
+	repoPath, err := SafeRepoPath(dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		return nil, fmt.Errorf("resolve repo path: %w", err)
+	}
+	if entry.Head, entry.Bundle, err = bundleRepo(ctx, b, repoPath, tmpDir, repo.ID); err != nil {
+		return nil, err
+	}
+
+	if storage == nil {
+		return entry, nil
+	}
+
+	objects, err := st.ListLFSObjects(repo.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list lfs objects: %w", err)
+	}
+	for _, obj := range objects {
+		archivePath := path.Join(backupLFSDir, repo.ID, obj.OID)
+		if err := exportLFSObject(ctx, storage, b, archivePath, obj); err != nil {
+			if errors.Is(err, lfs.ErrObjectNotFound) {
+				slog.Warn("lfs object missing from storage, skipping", "repo_id", repo.ID, "oid", obj.OID)
+				continue
+			}
+			return nil, err
+		}
+		entry.LFSObjects = append(entry.LFSObjects, ExportedLFSObject{OID: obj.OID, Size: obj.Size, Path: archivePath})
+	}
+
+	return entry, nil
+}
+
+func exportLFSObject(ctx context.Context, storage lfs.Storage, b *backupWriter, archivePath string, obj store.LFSObject) error {
+	content, size, err := storage.Get(ctx, obj.RepoID, obj.OID)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	return b.add(archivePath, content, size, 0644, obj.CreatedAt)
+}
+
+// usernameResolver returns a cached lookup from user ID to username.
+func usernameResolver(st store.Store) func(userID string) (string, error) {
+	names := make(map[string]string)
+
+	return func(userID string) (string, error) {
+		if name, ok := names[userID]; ok {
+			return name, nil
+		}
+
+		user, err := st.GetUser(userID)
+		if err != nil {
+			return "", fmt.Errorf("get user: %w", err)
+		}
+		if user == nil {
+			return "", fmt.Errorf("user %s not found", userID)
+		}
+		ns, err := st.GetNamespace(user.PrimaryNamespaceID)
+		if err != nil {
+			return "", fmt.Errorf("get user namespace: %w", err)
+		}
+		if ns == nil {
+			return "", fmt.Errorf("primary namespace of user %s not found", userID)
+		}
+
+		names[userID] = ns.Name
+		return ns.Name, nil
+	}
+}
+
+func exportGrants[G any](username func(string) (string, error), grants []G, fields func(G) (string, store.Permission, store.Permission)) ([]ExportedGrant, error) {
+	exported := []ExportedGrant{}
+	for _, g := range grants {
+		userID, allow, deny := fields(g)
+		name, err := username(userID)
+		if err != nil {
+			return nil, err
+		}
+		exported = append(exported, ExportedGrant{User: name, Allow: allow.ToStrings(), Deny: deny.ToStrings()})
+	}
+	return exported, nil
+}
+
+func listAllFolders(st store.Store, namespaceID string) ([]store.Folder, error) {
+	const pageSize = 100
+
+	var folders []store.Folder
+	cursor := ""
+	for {
+		page, err := st.ListFolders(namespaceID, cursor, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("list folders: %w", err)
+		}
+		folders = append(folders, page...)
+		if len(page) < pageSize {
+			return folders, nil
+		}
+		cursor = page[len(page)-1].Name
+	}
+}
+
+func listNamespaceRepos(st store.Store, namespaceID string) ([]store.Repo, error) {
+	const pageSize = 100
+
+	var repos []store.Repo
+	cursor := ""
+	for {
+		page, err := st.ListRepos(namespaceID, cursor, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("list repos: %w", err)
+		}
+		repos = append(repos, page...)
+		if len(page) < pageSize {
+			return repos, nil
+		}
+		cursor = page[len(page)-1].Name
+	}
+}
+
+// NamespaceImportOptions controls an import.
+type NamespaceImportOptions struct {
+	// Name imports into a namespace with a different name than the export.
+	Name string
+}
+
+// NamespaceImportReport summarizes an import.
+type NamespaceImportReport struct {
+	Namespace *store.Namespace
+	// Created is false when the repos were added to an existing namespace.
+	Created bool
+	Repos   int
+	// SkippedGrants lists grants for users that do not exist on this server.
+	SkippedGrants []string
+}
+
+// ImportConflictError reports names that already exist in the target namespace.
+type ImportConflictError struct {
+	Namespace string
+	Repos     []string
+}
+
+func (e *ImportConflictError) Error() string {
+	return fmt.Sprintf("namespace %q already has repos named %s", e.Namespace, strings.Join(e.Repos, ", "))
+}
+
+// namespaceImport tracks what an import has created so a failed import can be
+// rolled back.
+type namespaceImport struct {
+	ctx     context.Context
+	st      store.Store
+	storage lfs.Storage
+	dataDir string
+
+	namespace *store.Namespace
+	created   bool
+	folders   []string
+	repos     []store.Repo
+	lfs       map[string][]string
+}
+
+// ImportNamespace loads an archive written by ExportNamespace. Repos are
+// added to the namespace named in the archive (or opts.Name), which is created
+// if it does not exist. Folders are matched by name, and the import is refused
+// before anything is written if any repo name is already taken. Grants are
+// matched to users by username and skipped for users this server does not
+// have. Everything created is removed again if the import fails.
+func ImportNamespace(ctx context.Context, st store.Store, storage lfs.Storage, dataDir string, r io.Reader, opts NamespaceImportOptions) (*NamespaceImportReport, error) {
+	tmpDir, err := os.MkdirTemp("", "eph-import-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	export, err := extractNamespaceExport(r, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	name := export.Namespace.Name
+	if opts.Name != "" {
+		name = opts.Name
+	}
+	if err := ValidateName(name); err != nil {
+		return nil, fmt.Errorf("invalid namespace name: %w", err)
+	}
+
+	ns, err := st.GetNamespaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("get namespace: %w", err)
+	}
+	if ns != nil {
+		if err := checkImportConflicts(st, ns, export); err != nil {
+			return nil, err
+		}
+	}
+	if storage == nil {
+		for _, repo := range export.Repos {
+			if len(repo.LFSObjects) > 0 {
+				return nil, fmt.Errorf("archive contains LFS objects but LFS storage is not configured")
+			}
+		}
+	}
+
+	imp := &namespaceImport{ctx: ctx, st: st, storage: storage, dataDir: dataDir, namespace: ns, lfs: make(map[string][]string)}
+	report, err := imp.run(tmpDir, name, export)
+	if err != nil {
+		imp.rollback()
+		return nil, err
+	}
+	return report, nil
+}
+
+func extractNamespaceExport(r io.Reader, dir string) (*NamespaceExport, error) {
+	manifestData, extracted, err := extractArchive(r, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var export NamespaceExport
+	if err := json.Unmarshal(manifestData, &export); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	if export.Version != namespaceExportVersion {
+		return nil, fmt.Errorf("unsupported export version %d", export.Version)
+	}
+
+	var required []string
+	for _, repo := range export.Repos {
+		required = append(required, repo.Bundle)
+		for _, obj := range repo.LFSObjects {
+			required = append(required, obj.Path)
+		}
+	}
+	if err := verifyArchive(export.Files, extracted, required); err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+func checkImportConflicts(st store.Store, ns *store.Namespace, export *NamespaceExport) error {
+	conflict := &ImportConflictError{Namespace: ns.Name}
+	for _, repo := range export.Repos {
+		existing, err := st.GetRepo(ns.ID, repo.Name)
+		if err != nil {
+			return fmt.Errorf("check repo %s: %w", repo.Name, err)
+		}
+		if existing != nil {
+			conflict.Repos = append(conflict.Repos, repo.Name)
+		}
+	}
+
+	if len(conflict.Repos) > 0 {
+		return conflict
+	}
+	return nil
+}
+
+func (imp *namespaceImport) run(archiveDir, name string, export *NamespaceExport) (*NamespaceImportReport, error) {
+	now := time.Now()
+
+	if imp.namespace == nil {
+		imp.namespace = &store.Namespace{
+			ID:                uuid.New().String(),
+			Name:              name,
+			CreatedAt:         now,
+			RepoLimit:         export.Namespace.RepoLimit,
+			StorageLimitBytes: export.Namespace.StorageLimitBytes,
+			ExternalID:        export.Namespace.ExternalID,
+		}
+		if err := imp.st.CreateNamespace(imp.namespace); err != nil {
+			imp.namespace = nil
+			return nil, fmt.Errorf("create namespace: %w", err)
+		}
+		imp.created = true
+	}
+
+	report := &NamespaceImportReport{Namespace: imp.namespace, Created: imp.created}
+	users := userResolver(imp.st)
+
+	folderIDs, err := imp.importFolders(export.Folders)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, exported := range export.Repos {
+		repo, err := imp.importRepo(archiveDir, exported, folderIDs)
+		if err != nil {
+			return nil, fmt.Errorf("import repo %s: %w", exported.Name, err)
+		}
+
+		for _, g := range exported.Grants {
+			err := importGrant(users, g, func(userID string, allow, deny store.Permission) error {
+				return imp.st.UpsertRepoGrant(&store.RepoGrant{
+					UserID: userID, RepoID: repo.ID, AllowBits: allow, DenyBits: deny, CreatedAt: now, UpdatedAt: now,
+				})
+			})
+			if errors.Is(err, errUnknownImportUser) {
+				report.SkippedGrants = append(report.SkippedGrants, g.User+" on "+repo.Name)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("grant %s access to %s: %w", g.User, repo.Name, err)
+			}
+		}
+		report.Repos++
+	}
+
+	for _, g := range export.Grants {
+		err := importGrant(users, g, func(userID string, allow, deny store.Permission) error {
+			return imp.st.UpsertNamespaceGrant(&store.NamespaceGrant{
+				UserID: userID, NamespaceID: imp.namespace.ID, AllowBits: allow, DenyBits: deny, CreatedAt: now, UpdatedAt: now,
+			})
+		})
+		if errors.Is(err, errUnknownImportUser) {
+			report.SkippedGrants = append(report.SkippedGrants, g.User+" on "+imp.namespace.Name)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("grant %s access to %s: %w", g.User, imp.namespace.Name, err)
+		}
+	}
+
+	return report, nil
+}
+
+// importFolders maps exported folder IDs to folders in the target namespace,
+// reusing existing folders with the same name.
+func (imp *namespaceImport) importFolders(folders []ExportedFolder) (map[string]string, error) {
+	ids := make(map[string]string, len(folders))
+	for _, f := range folders {
+		existing, err := imp.st.GetFolderByName(imp.namespace.ID, f.Name)
+		if err != nil {
+			return nil, fmt.Errorf("get folder %s: %w", f.Name, err)
+		}
+		if existing != nil {
+			ids[f.ID] = existing.ID
+			continue
+		}
+
+		folder := &store.Folder{
+			ID:          uuid.New().String(),
+			NamespaceID: imp.namespace.ID,
+			Name:        f.Name,
+			Color:       f.Color,
+			CreatedAt:   time.Now(),
+		}
+		if err := imp.st.CreateFolder(folder); err != nil {
+			return nil, fmt.Errorf("create folder %s: %w", f.Name, err)
+		}
+		imp.folders = append(imp.folders, folder.ID)
+		ids[f.ID] = folder.ID
+	}
+	return ids, nil
+}
+
+func (imp *namespaceImport) importRepo(archiveDir string, exported ExportedRepo, folderIDs map[string]string) (*store.Repo, error) {
+	repoPath, err := SafeRepoPath(imp.dataDir, imp.namespace.ID, exported.Name)
+	if err != nil {
+		return nil, fmt.Errorf("resolve repo path: %w", err)
+	}
+
+	repo := &store.Repo{
+		ID:          uuid.New().String(),
+		NamespaceID: imp.namespace.ID,
+		Name:        exported.Name,
+		Description: exported.Description,
+		Public:      exported.Public,
+		CreatedAt:   exported.CreatedAt,
+		UpdatedAt:   time.Now(),
+	}
+	if err := imp.st.CreateRepo(repo); err != nil {
+		return nil, fmt.Errorf("create repo: %w", err)
+	}
+	imp.repos = append(imp.repos, *repo)
+
+	if err := unbundleRepo(imp.ctx, repoPath, archiveDir, exported.Head, exported.Bundle); err != nil {
+		return nil, err
+	}
+
+	for _, obj := range exported.LFSObjects {
+		if err := imp.importLFSObject(archiveDir, repo.ID, obj); err != nil {
+			return nil, fmt.Errorf("import lfs object %s: %w", obj.OID, err)
+		}
+	}
+
+	var folders []string
+	for _, id := range exported.FolderIDs {
+		if mapped, ok := folderIDs[id]; ok {
+			folders = append(folders, mapped)
+		}
+	}
+	if len(folders) > 0 {
+		if err := imp.st.AddRepoFolders(repo.ID, folders); err != nil {
+			return nil, fmt.Errorf("add folders: %w", err)
+		}
+	}
+
+	if exported.LastPushAt != nil {
+		if err := imp.st.UpdateRepoLastPush(repo.ID, *exported.LastPushAt); err != nil {
+			return nil, fmt.Errorf("set last push: %w", err)
+		}
+	}
+
+	sizeBytes, err := repoDiskUsage(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("compute size: %w", err)
+	}
+	if err := imp.st.UpdateRepoSize(repo.ID, sizeBytes); err != nil {
+		return nil, fmt.Errorf("update size: %w", err)
+	}
+
+	return repo, nil
+}
+
+func (imp *namespaceImport) importLFSObject(archiveDir, repoID string, obj ExportedLFSObject) error {
+	f, err := os.Open(filepath.Join(archiveDir, filepath.FromSlash(obj.Path)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := imp.storage.Put(imp.ctx, repoID, obj.OID, f, obj.Size); err != nil {
+		return err
+	}
+	imp.lfs[repoID] = append(imp.lfs[repoID], obj.OID)
+
+	return imp.st.CreateLFSObject(&store.LFSObject{RepoID: repoID, OID: obj.OID, Size: obj.Size, CreatedAt: time.Now()})
+}
+
+// rollback removes everything a failed import created.
+func (imp *namespaceImport) rollback() {
+	for _, repo := range imp.repos {
+		for _, oid := range imp.lfs[repo.ID] {
+			if err := imp.storage.Delete(imp.ctx, repo.ID, oid); err != nil && !errors.Is(err, lfs.ErrObjectNotFound) {
+				slog.Warn("failed to remove imported lfs object", "repo_id", repo.ID, "oid", oid, "error", err)
+			}
+		}
+		if err := imp.st.DeleteRepo(repo.ID); err != nil {
+			slog.Warn("failed to remove imported repo", "repo_id", repo.ID, "error", err)
+		}
+		if repoPath, err := SafeRepoPath(imp.dataDir, repo.NamespaceID, repo.Name); err == nil {
+			os.RemoveAll(repoPath)
+		}
+	}
+
+	for _, id := range imp.folders {
+		if err := imp.st.DeleteFolder(id); err != nil {
+			slog.Warn("failed to remove imported folder", "folder_id", id, "error", err)
+		}
+	}
+
+	if imp.created {
+		if err := imp.st.DeleteNamespace(imp.namespace.ID); err != nil {
+			slog.Warn("failed to remove imported namespace", "namespace_id", imp.namespace.ID, "error", err)
+		}
+		if nsPath, err := SafeNamespacePath(imp.dataDir, imp.namespace.ID); err == nil {
+			os.RemoveAll(nsPath)
+		}
+	}
+}
+
+var errUnknownImportUser = errors.New("user does not exist")
+
+// userResolver returns a cached lookup from username to user ID, returning
+// errUnknownImportUser for names that are not a user's primary namespace.
+func userResolver(st store.Store) func(username string) (string, error) {
+	ids := make(map[string]string)
+
+	return func(username string) (string, error) {
+		if id, ok := ids[username]; ok {
+			return id, nil
+		}
+
+		ns, err := st.GetNamespaceByName(username)
+		if err != nil {
+			return "", fmt.Errorf("get namespace: %w", err)
+		}
+		if ns == nil {
+			return "", errUnknownImportUser
+		}
+		user, err := st.GetUserByPrimaryNamespaceID(ns.ID)
+		if err != nil {
+			return "", fmt.Errorf("get user: %w", err)
+		}
+		if user == nil {
+			return "", errUnknownImportUser
+		}
+
+		ids[username] = user.ID
+		return user.ID, nil
+	}
+}
+
+func importGrant(userID func(string) (string, error), g ExportedGrant, upsert func(userID string, allow, deny store.Permission) error) error {
+	id, err := userID(g.User)
+	if err != nil {
+		return err
+	}
+
+	allow, err := store.ParsePermissions(g.Allow)
+	if err != nil {
+		return err
+	}
+	deny, err := store.ParsePermissions(g.Deny)
+	if err != nil {
+		return err
+	}
+
+	return upsert(id, allow, deny)
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/lfs"
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+func createTestUser(t *testing.T, st store.Store, id, name string) {
+	t.Helper()
+
+	now := time.Now()
+	require.NoError(t, st.CreateNamespace(&store.Namespace{ID: "ns-" + id, Name: name, CreatedAt: now}))
+	require.NoError(t, st.CreateUser(&store.User{ID: id, PrimaryNamespaceID: "ns-" + id, CreatedAt: now, UpdatedAt: now}))
+}
+
+func TestNamespaceExportImport(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	srcDir := t.TempDir()
+	src, repo := newRepoTestStore(t)
+	srcLFS := lfs.NewLocalStorage(filepath.Join(srcDir, "lfs"))
+
+	description := "The app"
+	repo.Description = &description
+	repo.Public = true
+	require.NoError(t, src.UpdateRepo(repo))
+
+	color := "#ff0000"
+	require.NoError(t, src.CreateFolder(&store.Folder{ID: "folder-1", NamespaceID: "ns-1", Name: "services", Color: &color, CreatedAt: now}))
+	require.NoError(t, src.AddRepoFolder(repo.ID, "folder-1"))
+
+	createTestUser(t, src, "user-bob", "bob")
+	createTestUser(t, src, "user-carol", "carol")
+	require.NoError(t, src.UpsertNamespaceGrant(&store.NamespaceGrant{
+		UserID: "user-bob", NamespaceID: "ns-1", AllowBits: store.DefaultNamespaceGrant(), CreatedAt: now, UpdatedAt: now,
+	}))
+	require.NoError(t, src.UpsertRepoGrant(&store.RepoGrant{
+		UserID: "user-carol", RepoID: repo.ID, AllowBits: store.PermRepoRead, CreatedAt: now, UpdatedAt: now,
+	}))
+
+	repoPath, err := SafeRepoPath(srcDir, repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	require.NoError(t, initBareRepo(repoPath))
+	work := t.TempDir()
+	runGit(t, work, "init", "-q", "-b", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(work, "README.md"), []byte("hello\n"), 0644))
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "-q", "-m", "Initial commit")
+	runGit(t, work, "push", "-q", repoPath, "main")
+
+	content := []byte("large file")
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+	require.NoError(t, srcLFS.Put(ctx, repo.ID, oid, bytes.NewReader(content), int64(len(content))))
+	require.NoError(t, src.CreateLFSObject(&store.LFSObject{RepoID: repo.ID, OID: oid, Size: int64(len(content)), CreatedAt: now}))
+
+	var archive bytes.Buffer
+	export, err := ExportNamespace(ctx, src, srcLFS, srcDir, "acme", &archive)
+	require.NoError(t, err)
+	require.Len(t, export.Repos, 1)
+
+	// The target server has bob but not carol.
+	dstDir := t.TempDir()
+	dst, err := store.NewSQLiteStore(":memory:")
+	require.NoError(t, err)
+	require.NoError(t, dst.Initialize())
+	t.Cleanup(func() { dst.Close() })
+	dstLFS := lfs.NewLocalStorage(filepath.Join(dstDir, "lfs"))
+	createTestUser(t, dst, "user-bob-2", "bob")
+
+	report, err := ImportNamespace(ctx, dst, dstLFS, dstDir, bytes.NewReader(archive.Bytes()), NamespaceImportOptions{})
+	require.NoError(t, err)
+	assert.True(t, report.Created)
+	assert.Equal(t, 1, report.Repos)
+	assert.Equal(t, []string{"carol on app"}, report.SkippedGrants)
+
+	ns, err := dst.GetNamespaceByName("acme")
+	require.NoError(t, err)
+	require.NotNil(t, ns)
+
+	imported, err := dst.GetRepo(ns.ID, "app")
+	require.NoError(t, err)
+	require.NotNil(t, imported)
+	assert.NotEqual(t, repo.ID, imported.ID, "imported repos get new IDs")
+	assert.Equal(t, &description, imported.Description)
+	assert.True(t, imported.Public)
+	assert.Positive(t, imported.SizeBytes)
+
+	folders, err := dst.ListRepoFolders(imported.ID)
+	require.NoError(t, err)
+	require.Len(t, folders, 1)
+	assert.Equal(t, "services", folders[0].Name)
+	assert.Equal(t, &color, folders[0].Color)
+
+	grant, err := dst.GetNamespaceGrant("user-bob-2", ns.ID)
+	require.NoError(t, err)
+	require.NotNil(t, grant)
+	assert.Equal(t, store.DefaultNamespaceGrant(), grant.AllowBits)
+
+	importedPath, err := SafeRepoPath(dstDir, ns.ID, "app")
+	require.NoError(t, err)
+	srcRefs, err := listRefs(ctx, repoPath)
+	require.NoError(t, err)
+	dstRefs, err := listRefs(ctx, importedPath)
+	require.NoError(t, err)
+	assert.Equal(t, srcRefs, dstRefs)
+
+	obj, err := dst.GetLFSObject(imported.ID, oid)
+	require.NoError(t, err)
+	require.NotNil(t, obj)
+	rc, _, err := dstLFS.Get(ctx, imported.ID, oid)
+	require.NoError(t, err)
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	t.Run("refuses repo name conflicts", func(t *testing.T) {
+		_, err := ImportNamespace(ctx, dst, dstLFS, dstDir, bytes.NewReader(archive.Bytes()), NamespaceImportOptions{})
+		var conflict *ImportConflictError
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, []string{"app"}, conflict.Repos)
+	})
+
+	t.Run("imports under another name", func(t *testing.T) {
+		report, err := ImportNamespace(ctx, dst, dstLFS, dstDir, bytes.NewReader(archive.Bytes()), NamespaceImportOptions{Name: "acme-copy"})
+		require.NoError(t, err)
+		assert.Equal(t, "acme-copy", report.Namespace.Name)
+	})
+
+	t.Run("rolls back failed imports", func(t *testing.T) {
+		_, err := ImportNamespace(ctx, dst, failingStorage{dstLFS}, dstDir, bytes.NewReader(archive.Bytes()), NamespaceImportOptions{Name: "acme-broken"})
+		require.ErrorContains(t, err, "storage unavailable")
+
+		ns, err := dst.GetNamespaceByName("acme-broken")
+		require.NoError(t, err)
+		assert.Nil(t, ns)
+
+		entries, err := os.ReadDir(filepath.Join(dstDir, "repos"))
+		require.NoError(t, err)
+		assert.Len(t, entries, 2, "only the successful imports have repo directories")
+	})
+}
+
+// failingStorage is an LFS storage whose uploads always fail.
+type failingStorage struct {
+	lfs.Storage
+}
+
+func (failingStorage) Put(context.Context, string, string, io.Reader, int64) error {
+	return errors.New("storage unavailable")
+}
@@ -0,0 +1,579 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/core"
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// OIDCOptions configures login through an OpenID Connect provider. Login is
+// enabled when Issuer is set.
+type OIDCOptions struct {
+	// Issuer must be an https URL, since ID tokens are trusted because they
+	// come from the provider over TLS.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Scopes are requested in addition to openid. Defaults to profile and
+	// email.
+	Scopes []string
+	// BaseURL is the server's public URL. The provider must accept
+	// BaseURL + "/auth/oidc/callback" as a redirect URL.
+	BaseURL string
+}
+
+const (
+	oidcLoginPath    = "/auth/oidc/login"
+	oidcCallbackPath = "/auth/oidc/callback"
+
+	// oidcClockSkew is the leeway given to ID token expiry.
+	oidcClockSkew = time.Minute
+)
+
+// oidcAuthenticator completes auth sessions by signing users in with an
+// OpenID Connect provider using the authorization code flow with PKCE.
+// Logins in progress are kept in memory, keyed by their state parameter.
+type oidcAuthenticator struct {
+	opts   OIDCOptions
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	logins    map[string]oidcLogin
+}
+
+type oidcLogin struct {
+	sessionID string
+	nonce     string
+	verifier  string
+	expiresAt time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+type oidcClaims struct {
+	Issuer            string       `json:"iss"`
+	Subject           string       `json:"sub"`
+	Audience          oidcAudience `json:"aud"`
+	ExpiresAt         int64        `json:"exp"`
+	Nonce             string       `json:"nonce"`
+	PreferredUsername string       `json:"preferred_username"`
+	Email             string       `json:"email"`
+}
+
+// oidcAudience accepts both forms of the aud claim: a single string or an
+// array of strings.
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings")
+	}
+	*a = multiple
+	return nil
+}
+
+func newOIDCAuthenticator(opts OIDCOptions) *oidcAuthenticator {
+	opts.Issuer = strings.TrimSuffix(opts.Issuer, "/")
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	if len(opts.Scopes) == 0 {
+		opts.Scopes = []string{"profile", "email"}
+	}
+
+	return &oidcAuthenticator{
+		opts:   opts,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logins: make(map[string]oidcLogin),
+	}
+}
+
+func (a *oidcAuthenticator) loginURL() string {
+	return a.opts.BaseURL + oidcLoginPath
+}
+
+func (a *oidcAuthenticator) redirectURL() string {
+	return a.opts.BaseURL + oidcCallbackPath
+}
+
+// provider returns the provider's discovery document, fetching it on first
+// use.
+func (a *oidcAuthenticator) provider() (*oidcDiscovery, error) {
+	a.mu.Lock()
+	cached := a.discovery
+	a.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	if !isHTTPSURL(a.opts.Issuer) {
+		return nil, fmt.Errorf("issuer %q is not an https URL", a.opts.Issuer)
+	}
+
+	resp, err := a.client.Get(a.opts.Issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch discovery document: status %d", resp.StatusCode)
+	}
+
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("decode discovery document: %w", err)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != a.opts.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" {
+		return nil, fmt.Errorf("discovery document is missing endpoints")
+	}
+	if !isHTTPSURL(discovery.TokenEndpoint) {
+		return nil, fmt.Errorf("token endpoint %q is not an https URL", discovery.TokenEndpoint)
+	}
+
+	a.mu.Lock()
+	a.discovery = &discovery
+	a.mu.Unlock()
+
+	return &discovery, nil
+}
+
+// begin records a login for the auth session and returns the provider URL to
+// send the browser to.
+func (a *oidcAuthenticator) begin(session *store.AuthSession) (string, error) {
+	provider, err := a.provider()
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomURLString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomURLString()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomURLString()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	for key, login := range a.logins {
+		if now.After(login.expiresAt) {
+			delete(a.logins, key)
+		}
+	}
+	a.logins[state] = oidcLogin{
+		sessionID: session.ID,
+		nonce:     nonce,
+		verifier:  verifier,
+		expiresAt: session.ExpiresAt,
+	}
+	a.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {a.opts.ClientID},
+		"redirect_uri":          {a.redirectURL()},
+		"scope":                 {strings.Join(append([]string{"openid"}, a.opts.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return provider.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// takeLogin removes and returns the login started with state. Each state can
+// only be used once.
+func (a *oidcAuthenticator) takeLogin(state string) (oidcLogin, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	login, ok := a.logins[state]
+	delete(a.logins, state)
+	if !ok || time.Now().After(login.expiresAt) {
+		return oidcLogin{}, false
+	}
+	return login, true
+}
+
+// exchange redeems an authorization code and returns the validated claims of
+// the ID token. The token comes straight from the token endpoint, so as
+// allowed by OpenID Connect Core 3.1.3.7 the TLS connection authenticates
+// the issuer in place of the token signature. provider only accepts https
+// issuers and token endpoints for this reason.
+func (a *oidcAuthenticator) exchange(login oidcLogin, code string) (*oidcClaims, error) {
+	provider, err := a.provider()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {a.redirectURL()},
+		"client_id":     {a.opts.ClientID},
+		"code_verifier": {login.verifier},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if a.opts.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(a.opts.ClientID), url.QueryEscape(a.opts.ClientSecret))
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("exchange code: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("decode token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+
+	claims, err := decodeIDToken(tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.validateClaims(claims, login.nonce); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (a *oidcAuthenticator) validateClaims(claims *oidcClaims, nonce string) error {
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != a.opts.Issuer:
+		return fmt.Errorf("id token issued by %q", claims.Issuer)
+	case !claims.Audience.contains(a.opts.ClientID):
+		return fmt.Errorf("id token not issued for this client")
+	case time.Now().After(time.Unix(claims.ExpiresAt, 0).Add(oidcClockSkew)):
+		return fmt.Errorf("id token expired")
+	case claims.Nonce != nonce:
+		return fmt.Errorf("id token nonce mismatch")
+	case claims.Subject == "":
+		return fmt.Errorf("id token has no subject")
+	}
+	return nil
+}
+
+func (a oidcAudience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeIDToken(raw string) (*oidcClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed id token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("decode id token: %w", err)
+	}
+
+	var claims oidcClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("decode id token claims: %w", err)
+	}
+	return &claims, nil
+}
+
+func isHTTPSURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+func randomURLString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// pendingAuthSession returns the auth session if it's still waiting to be
+// completed, rendering an error page otherwise.
+func (s *Server) pendingAuthSession(w http.ResponseWriter, sessionID string) *store.AuthSession {
+	if sessionID == "" {
+		renderAuthPage(w, http.StatusBadRequest, "Login failed", "The login link is missing its session. Run eph login again.")
+		return nil
+	}
+
+	session, err := s.store.GetAuthSession(sessionID)
+	if err != nil {
+		renderAuthPage(w, http.StatusInternalServerError, "Login failed", "Failed to get auth session.")
+		return nil
+	}
+	if session == nil || time.Now().After(session.ExpiresAt) {
+		renderAuthPage(w, http.StatusNotFound, "Login expired", "This login link has expired. Run eph login again.")
+		return nil
+	}
+	if session.Status != "pending" {
+		renderAuthPage(w, http.StatusConflict, "Already logged in", "This login link has already been used.")
+		return nil
+	}
+
+	return session
+}
+
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	session := s.pendingAuthSession(w, r.URL.Query().Get("session"))
+	if session == nil {
+		return
+	}
+
+	target, err := s.oidc.begin(session)
+	if err != nil {
+		slog.Error("start oidc login", "error", err)
+		renderAuthPage(w, http.StatusBadGateway, "Login failed", "The identity provider is unavailable.")
+		return
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	login, ok := s.oidc.takeLogin(query.Get("state"))
+	if !ok {
+		renderAuthPage(w, http.StatusBadRequest, "Login failed", "This login has expired or was already used. Run eph login again.")
+		return
+	}
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		message := "The identity provider returned " + providerErr + "."
+		if description := query.Get("error_description"); description != "" {
+			message = description
+		}
+		renderAuthPage(w, http.StatusUnauthorized, "Login failed", message)
+		return
+	}
+
+	session := s.pendingAuthSession(w, login.sessionID)
+	if session == nil {
+		return
+	}
+
+	claims, err := s.oidc.exchange(login, query.Get("code"))
+	if err != nil {
+		slog.Warn("oidc login rejected", "error", err)
+		renderAuthPage(w, http.StatusUnauthorized, "Login failed", "The identity provider's response could not be verified.")
+		return
+	}
+
+	user, err := s.oidcUser(claims)
+	if err != nil {
+		slog.Error("provision oidc user", "subject", claims.Subject, "error", err)
+		renderAuthPage(w, http.StatusInternalServerError, "Login failed", "Failed to set up your account.")
+		return
+	}
+
+	rawToken, _, err := s.store.GenerateUserToken(user.ID, nil, nil, nil)
+	if err != nil {
+		renderAuthPage(w, http.StatusInternalServerError, "Login failed", "Failed to generate token.")
+		return
+	}
+
+	if err := s.store.CompleteAuthSession(session.ID, user.ID, rawToken); err != nil {
+		renderAuthPage(w, http.StatusInternalServerError, "Login failed", "Failed to complete auth session.")
+		return
+	}
+
+	renderAuthPage(w, http.StatusOK, "Logged in", "You can close this window and return to the terminal.")
+}
+
+// oidcExternalID is the namespace external ID of a provider's user. Subjects
+// are only unique within their issuer, and the issuer also keeps them apart
+// from external IDs provisioned through the admin API.
+func oidcExternalID(issuer, subject string) string {
+	return issuer + "#" + subject
+}
+
+// oidcUser returns the user whose primary namespace has the issuer and subject
+// as its external ID, creating the namespace and user on first login. Two
+// first logins can race; the external ID is unique, so the one that loses
+// finds the winner's user on its next attempt.
+func (s *Server) oidcUser(claims *oidcClaims) (*store.User, error) {
+	const maxAttempts = 3
+
+	externalID := oidcExternalID(s.oidc.opts.Issuer, claims.Subject)
+	for range maxAttempts {
+		user, err := s.oidcExistingUser(externalID)
+		if err != nil || user != nil {
+			return user, err
+		}
+
+		name, err := s.availableNamespaceName(oidcNamespaceName(claims))
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		ns := &store.Namespace{
+			ID:         uuid.New().String(),
+			Name:       name,
+			CreatedAt:  now,
+			ExternalID: &externalID,
+		}
+		user = &store.User{
+			ID:                 uuid.New().String(),
+			PrimaryNamespaceID: ns.ID,
+			CreatedAt:          now,
+			UpdatedAt:          now,
+		}
+		grant := &store.NamespaceGrant{
+			UserID:      user.ID,
+			NamespaceID: ns.ID,
+			AllowBits:   store.DefaultNamespaceGrant(),
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+
+		// A duplicate is either a concurrent login for the same subject or
+		// another namespace taking the name, so look again in both cases.
+		err = s.store.CreateNamespaceWithOwner(ns, user, grant)
+		if !errors.Is(err, store.ErrDuplicateNamespace) {
+			if err != nil {
+				return nil, fmt.Errorf("create user: %w", err)
+			}
+			return user, nil
+		}
+	}
+
+	return nil, fmt.Errorf("create user: %w", store.ErrDuplicateNamespace)
+}
+
+// oidcExistingUser returns the user of the namespace with the external ID, or
+// nil if there is no such namespace. A namespace without a user gets one.
+func (s *Server) oidcExistingUser(externalID string) (*store.User, error) {
+	ns, err := s.store.GetNamespaceByExternalID(externalID)
+	if err != nil {
+		return nil, fmt.Errorf("get namespace: %w", err)
+	}
+	if ns == nil {
+		return nil, nil
+	}
+
+	user, err := s.store.GetUserByPrimaryNamespaceID(ns.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	if user != nil {
+		return user, nil
+	}
+	return s.createUser(ns.ID)
+}
+
+// oidcNamespaceName derives a namespace name from the preferred username or
+// the local part of the email, replacing characters names can't contain.
+func oidcNamespaceName(claims *oidcClaims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(candidate) {
+		switch {
+		case core.IsValidNameChar(r, b.Len() == 0):
+			b.WriteRune(r)
+		case b.Len() > 0:
+			b.WriteByte('-')
+		}
+	}
+
+	name := b.String()
+	for strings.Contains(name, "..") {
+		name = strings.ReplaceAll(name, "..", ".")
+	}
+	name = strings.TrimRight(name, ".-_")
+	if len(name) > 64 {
+		name = strings.TrimRight(name[:64], ".-_")
+	}
+
+	if core.ValidateName(name) != nil {
+		return "user"
+	}
+	return name
+}
+
+// availableNamespaceName returns name, or name with the first numeric suffix
+// that isn't taken.
+func (s *Server) availableNamespaceName(name string) (string, error) {
+	candidate := name
+	for i := 2; i <= 100; i++ {
+		existing, err := s.store.GetNamespaceByName(candidate)
+		if err != nil {
+			return "", fmt.Errorf("check namespace name: %w", err)
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	return "", fmt.Errorf("no available namespace name for %q", name)
+}
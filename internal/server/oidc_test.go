@@ -0,0 +1,395 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// stubOIDCProvider is a minimal OpenID Connect provider. Codes are issued by
+// authorize and redeemed once for an ID token with the given claims.
+type stubOIDCProvider struct {
+	*httptest.Server
+
+	t      *testing.T
+	mu     sync.Mutex
+	claims map[string]any
+	codes  map[string]url.Values
+}
+
+func newStubOIDCProvider(t *testing.T) *stubOIDCProvider {
+	p := &stubOIDCProvider{t: t, codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "eph" || secret != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+
+		p.mu.Lock()
+		authorize, ok := p.codes[r.PostFormValue("code")]
+		delete(p.codes, r.PostFormValue("code"))
+		claims := p.claims
+		p.mu.Unlock()
+
+		challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || authorize.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		payload := map[string]any{"iss": p.URL, "aud": "eph", "exp": 4102444800, "nonce": authorize.Get("nonce")}
+		for key, value := range claims {
+			payload[key] = value
+		}
+		body, _ := json.Marshal(payload)
+		idToken := "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(body) + ".sig"
+
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+	})
+	p.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// authorize stands in for the user signing in: it accepts the authorization
+// request and returns the callback URL the provider redirects to.
+func (p *stubOIDCProvider) authorize(location string, claims map[string]any) string {
+	target, err := url.Parse(location)
+	require.NoError(p.t, err)
+	require.Equal(p.t, p.URL+"/authorize", target.Scheme+"://"+target.Host+target.Path)
+
+	query := target.Query()
+	assert.Equal(p.t, "eph", query.Get("client_id"))
+	assert.Equal(p.t, "S256", query.Get("code_challenge_method"))
+	assert.Contains(p.t, query.Get("scope"), "openid")
+
+	code := "code-" + query.Get("state")[:8]
+	p.mu.Lock()
+	p.codes[code] = query
+	p.claims = claims
+	p.mu.Unlock()
+
+	return query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+}
+
+// racingStore runs race once, just before the first account is created, to
+// stand in for a concurrent login.
+type racingStore struct {
+	store.Store
+	race    func()
+	creates int
+}
+
+func (r *racingStore) CreateNamespaceWithOwner(ns *store.Namespace, user *store.User, grant *store.NamespaceGrant) error {
+	r.creates++
+	if r.race != nil {
+		r.race()
+		r.race = nil
+	}
+	return r.Store.CreateNamespaceWithOwner(ns, user, grant)
+}
+
+func newOIDCTestServer(t *testing.T, provider *stubOIDCProvider) (*Server, store.Store) {
+	t.Helper()
+
+	st, err := store.NewSQLiteStore(":memory:")
+	require.NoError(t, err)
+	require.NoError(t, st.Initialize())
+	t.Cleanup(func() { st.Close() })
+
+	srv := NewServer(st, t.TempDir(), ServerOptions{OIDC: OIDCOptions{
+		Issuer:       provider.URL,
+		ClientID:     "eph",
+		ClientSecret: "s3cret",
+		BaseURL:      "http://eph.test",
+	}})
+	srv.oidc.client = provider.Client()
+	return srv, st
+}
+
+func serve(srv *Server, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+// startOIDCLogin creates an auth session and follows the login link,
+// returning the session ID and the provider authorization URL.
+func startOIDCLogin(t *testing.T, srv *Server) (string, string) {
+	t.Helper()
+
+	rec := serve(srv, http.MethodPost, "/api/v1/auth/sessions", `{}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var created struct {
+		Data authSessionResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	rec = serve(srv, http.MethodGet, oidcLoginPath+"?session="+created.Data.ID, "")
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+
+	return created.Data.ID, rec.Header().Get("Location")
+}
+
+func pollAuthSession(t *testing.T, srv *Server, sessionID string) authSessionResponse {
+	t.Helper()
+
+	rec := serve(srv, http.MethodGet, "/api/v1/auth/sessions/"+sessionID, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Data authSessionResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp.Data
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newStubOIDCProvider(t)
+	srv, st := newOIDCTestServer(t, provider)
+
+	rec := serve(srv, http.MethodGet, "/.well-known/ephemeral-auth", "")
+	assert.JSONEq(t, `{"auth_method":"web","auth_endpoint":"http://eph.test/auth/oidc/login"}`, rec.Body.String())
+
+	claims := map[string]any{"sub": "subject-1", "preferred_username": "Jane Doe", "email": "jane@example.com"}
+
+	sessionID, location := startOIDCLogin(t, srv)
+	callback := provider.authorize(location, claims)
+	require.True(t, strings.HasPrefix(callback, "http://eph.test"+oidcCallbackPath))
+
+	rec = serve(srv, http.MethodGet, callback, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	session := pollAuthSession(t, srv, sessionID)
+	assert.Equal(t, "completed", session.Status)
+	require.NotEmpty(t, session.Token)
+
+	token, err := lookupToken(st, session.Token)
+	require.NoError(t, err)
+	require.NotNil(t, token)
+	require.NotNil(t, token.UserID)
+
+	ns, err := st.GetNamespaceByExternalID(oidcExternalID(provider.URL, "subject-1"))
+	require.NoError(t, err)
+	require.NotNil(t, ns)
+	assert.Equal(t, "jane-doe", ns.Name)
+
+	user, err := st.GetUserByPrimaryNamespaceID(ns.ID)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, user.ID, *token.UserID)
+
+	t.Run("callback state is single use", func(t *testing.T) {
+		rec := serve(srv, http.MethodGet, callback, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("returning user keeps their account", func(t *testing.T) {
+		sessionID, location := startOIDCLogin(t, srv)
+		rec := serve(srv, http.MethodGet, provider.authorize(location, claims), "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		session := pollAuthSession(t, srv, sessionID)
+		token, err := lookupToken(st, session.Token)
+		require.NoError(t, err)
+		require.NotNil(t, token)
+		assert.Equal(t, user.ID, *token.UserID)
+	})
+
+	t.Run("new user with a taken name gets a suffix", func(t *testing.T) {
+		sessionID, location := startOIDCLogin(t, srv)
+		rec := serve(srv, http.MethodGet, provider.authorize(location, map[string]any{"sub": "subject-2", "email": "jane-doe@example.org"}), "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, "completed", pollAuthSession(t, srv, sessionID).Status)
+
+		ns, err := st.GetNamespaceByExternalID(oidcExternalID(provider.URL, "subject-2"))
+		require.NoError(t, err)
+		require.NotNil(t, ns)
+		assert.Equal(t, "jane-doe-2", ns.Name)
+	})
+
+	t.Run("first login that loses a race reuses the winner's account", func(t *testing.T) {
+		externalID := oidcExternalID(provider.URL, "subject-race")
+		winner := &store.User{ID: "user-winner", PrimaryNamespaceID: "ns-winner", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+
+		// The other login creates the account between this one's lookup and
+		// its insert.
+		racing := &racingStore{Store: st, race: func() {
+			require.NoError(t, st.CreateNamespaceWithOwner(
+				&store.Namespace{ID: "ns-winner", Name: "racer", CreatedAt: time.Now(), ExternalID: &externalID},
+				winner,
+				&store.NamespaceGrant{UserID: winner.ID, NamespaceID: "ns-winner", AllowBits: store.DefaultNamespaceGrant(), CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			))
+		}}
+		srv.store = racing
+		t.Cleanup(func() { srv.store = st })
+
+		user, err := srv.oidcUser(&oidcClaims{Subject: "subject-race", PreferredUsername: "racer"})
+		require.NoError(t, err)
+		assert.Equal(t, winner.ID, user.ID)
+		assert.Equal(t, 1, racing.creates, "the losing login looks the account up instead of creating another")
+
+		taken, err := st.GetNamespaceByName("racer-2")
+		require.NoError(t, err)
+		assert.Nil(t, taken, "no second namespace was created")
+	})
+
+	t.Run("subject does not match an external ID from the admin API", func(t *testing.T) {
+		externalID := "subject-3"
+		require.NoError(t, st.CreateNamespace(&store.Namespace{ID: "ns-platform", Name: "platform", CreatedAt: time.Now(), ExternalID: &externalID}))
+		require.NoError(t, st.CreateUser(&store.User{ID: "user-platform", PrimaryNamespaceID: "ns-platform", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+
+		sessionID, location := startOIDCLogin(t, srv)
+		rec := serve(srv, http.MethodGet, provider.authorize(location, map[string]any{"sub": "subject-3", "preferred_username": "mallory"}), "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		token, err := lookupToken(st, pollAuthSession(t, srv, sessionID).Token)
+		require.NoError(t, err)
+		require.NotNil(t, token)
+		assert.NotEqual(t, "user-platform", *token.UserID)
+
+		ns, err := st.GetNamespaceByExternalID(oidcExternalID(provider.URL, "subject-3"))
+		require.NoError(t, err)
+		require.NotNil(t, ns)
+		assert.Equal(t, "mallory", ns.Name)
+	})
+}
+
+func TestOIDCDeviceLogin(t *testing.T) {
+	provider := newStubOIDCProvider(t)
+	srv, _ := newOIDCTestServer(t, provider)
+
+	rec := serve(srv, http.MethodPost, "/api/v1/auth/sessions", `{"device":true}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var created struct {
+		Data authSessionResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.NotEmpty(t, created.Data.UserCode)
+
+	rec = serve(srv, http.MethodGet, deviceLoginPath, "")
+	assert.Contains(t, rec.Body.String(), "Sign in and approve")
+	assert.NotContains(t, rec.Body.String(), `name="token"`, "OIDC servers don't ask for a token")
+
+	form := url.Values{"user_code": {strings.ToLower(created.Data.UserCode)}}
+	req := httptest.NewRequest(http.MethodPost, deviceLoginPath, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusSeeOther, rec.Code, rec.Body.String())
+	assert.NotContains(t, rec.Header().Get("Location"), created.Data.ID, "the session ID lets its holder collect the token")
+
+	rec = serve(srv, http.MethodGet, provider.authorize(rec.Header().Get("Location"), map[string]any{"sub": "subject-1"}), "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	session := pollAuthSession(t, srv, created.Data.ID)
+	assert.Equal(t, "completed", session.Status)
+	assert.NotEmpty(t, session.Token)
+}
+
+func TestOIDCLogin_Rejected(t *testing.T) {
+	provider := newStubOIDCProvider(t)
+	srv, _ := newOIDCTestServer(t, provider)
+
+	t.Run("unknown session", func(t *testing.T) {
+		rec := serve(srv, http.MethodGet, oidcLoginPath+"?session=missing", "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		sessionID, location := startOIDCLogin(t, srv)
+		rec := serve(srv, http.MethodGet, provider.authorize(location, map[string]any{"sub": "subject-1", "aud": "other"}), "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "pending", pollAuthSession(t, srv, sessionID).Status)
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		sessionID, location := startOIDCLogin(t, srv)
+		rec := serve(srv, http.MethodGet, provider.authorize(location, map[string]any{"sub": "subject-1", "nonce": "replayed"}), "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "pending", pollAuthSession(t, srv, sessionID).Status)
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		_, location := startOIDCLogin(t, srv)
+		target, err := url.Parse(location)
+		require.NoError(t, err)
+
+		rec := serve(srv, http.MethodGet, oidcCallbackPath+"?error=access_denied&state="+target.Query().Get("state"), "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Body.String(), "access_denied")
+	})
+}
+
+func TestOIDCProvider_RequiresHTTPS(t *testing.T) {
+	t.Run("issuer", func(t *testing.T) {
+		provider := newStubOIDCProvider(t)
+		insecure := httptest.NewServer(provider.Config.Handler)
+		t.Cleanup(insecure.Close)
+
+		a := newOIDCAuthenticator(OIDCOptions{Issuer: insecure.URL, ClientID: "eph"})
+		_, err := a.provider()
+		assert.ErrorContains(t, err, "not an https URL")
+	})
+
+	t.Run("token endpoint", func(t *testing.T) {
+		var issuer string
+		discovery := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 issuer,
+				"authorization_endpoint": issuer + "/authorize",
+				"token_endpoint":         "http://" + r.Host + "/token",
+			})
+		}))
+		t.Cleanup(discovery.Close)
+		issuer = discovery.URL
+
+		a := newOIDCAuthenticator(OIDCOptions{Issuer: issuer, ClientID: "eph"})
+		a.client = discovery.Client()
+		_, err := a.provider()
+		assert.ErrorContains(t, err, "token endpoint")
+	})
+}
+
+func TestOIDCNamespaceName(t *testing.T) {
+	tests := []struct {
+		claims oidcClaims
+		want   string
+	}{
+		{oidcClaims{PreferredUsername: "alice"}, "alice"},
+		{oidcClaims{PreferredUsername: "Alice Smith"}, "alice-smith"},
+		{oidcClaims{Email: "bob..jones@example.com"}, "bob.jones"},
+		{oidcClaims{PreferredUsername: "_admin_"}, "admin"},
+		{oidcClaims{PreferredUsername: "名前"}, "user"},
+		{oidcClaims{}, "user"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, oidcNamespaceName(&tt.claims))
+	}
+}
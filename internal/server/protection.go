@@ -0,0 +1,511 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// pushPolicyEnv names the file that carries the serialized pushPolicy from the
+// server to the pre-receive hook. The policy lists every LFS lock held by other
+// users, which can be far more than fits in a single environment variable.
+const pushPolicyEnv = "EPHEMERAL_PUSH_POLICY_FILE"
+
+// pushUpdatesEnv names the file the post-receive hook appends the ref updates
+// of a push to.
+const pushUpdatesEnv = "EPHEMERAL_PUSH_UPDATES_FILE"
+
+// pushPolicy is everything the pre-receive hook needs to judge a push without
+// access to the database.
+type pushPolicy struct {
+	Rules      []store.BranchProtection `json:"rules"`
+	Permission store.Permission         `json:"permission"`
+	// Locks are LFS locks held by other users. Pushes may not modify these paths.
+	Locks []pushLock `json:"locks,omitempty"`
+}
+
+type pushLock struct {
+	Path  string `json:"path"`
+	Owner string `json:"owner"`
+}
+
+// empty reports whether the policy has nothing to enforce.
+func (p pushPolicy) empty() bool {
+	return len(p.Rules) == 0 && len(p.Locks) == 0
+}
+
+// refUpdate is a single ref change requested by a push or a ref API call.
+// A zero OldSHA means the ref is being created; a zero NewSHA means it is being deleted.
+// Forced is only filled in for completed pushes, see markForcedUpdates.
+type refUpdate struct {
+	OldSHA string
+	NewSHA string
+	Ref    string
+	Forced bool
+}
+
+// protectionError describes why a ref update was rejected.
+type protectionError struct {
+	Ref    string
+	Reason string
+}
+
+func (e *protectionError) Error() string {
+	return fmt.Sprintf("%s: %s", plumbing.ReferenceName(e.Ref).Short(), e.Reason)
+}
+
+func isZeroSHA(sha string) bool {
+	return sha == "" || sha == plumbing.ZeroHash.String()
+}
+
+// matchingProtections returns the rules whose pattern matches a full ref name.
+// Only branches can be protected.
+func matchingProtections(rules []store.BranchProtection, ref string) []store.BranchProtection {
+	refName := plumbing.ReferenceName(ref)
+	if !refName.IsBranch() {
+		return nil
+	}
+
+	branch := refName.Short()
+
+	var matched []store.BranchProtection
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.Pattern, branch); ok {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// checkRefUpdate applies the policy to a single ref update. Objects referenced by
+// NewSHA must be readable from repoPath, which is the case inside a pre-receive
+// hook (quarantine) and for ref API calls.
+func checkRefUpdate(ctx context.Context, repoPath string, policy pushPolicy, update refUpdate) error {
+	if err := checkProtectionRules(ctx, repoPath, policy, update); err != nil {
+		return err
+	}
+	return checkLockedPaths(ctx, repoPath, policy.Locks, update)
+}
+
+func checkProtectionRules(ctx context.Context, repoPath string, policy pushPolicy, update refUpdate) error {
+	rules := matchingProtections(policy.Rules, update.Ref)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	isCreate := isZeroSHA(update.OldSHA)
+	isDelete := isZeroSHA(update.NewSHA)
+
+	for _, rule := range rules {
+		if err := checkPushPermission(policy, rule, update.Ref); err != nil {
+			return err
+		}
+
+		if isDelete {
+			if rule.BlockDeletion {
+				return &protectionError{update.Ref, "protected branch cannot be deleted"}
+			}
+			continue
+		}
+
+		if rule.BlockForcePush && !isCreate {
+			ancestor, err := gitIsAncestor(ctx, repoPath, update.OldSHA, update.NewSHA)
+			if err != nil {
+				return fmt.Errorf("check fast-forward: %w", err)
+			}
+			if !ancestor {
+				return &protectionError{update.Ref, "force push to protected branch is not allowed"}
+			}
+		}
+
+		if rule.RequireLinearHistory {
+			args := []string{"rev-list", "--merges", update.NewSHA}
+			if isCreate {
+				args = append(args, "--not", "--all")
+			} else {
+				args = append(args, "^"+update.OldSHA)
+			}
+
+			output, err := gitCommandOutput(ctx, repoPath, args...)
+			if err != nil {
+				return fmt.Errorf("check linear history: %w", err)
+			}
+			if strings.TrimSpace(string(output)) != "" {
+				return &protectionError{update.Ref, "protected branch requires linear history, merge commits are not allowed"}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkPushPermission rejects pushes to ref by callers without the rule's push permission.
+func checkPushPermission(policy pushPolicy, rule store.BranchProtection, ref string) error {
+	if rule.PushPermission != 0 && !policy.Permission.Has(rule.PushPermission) {
+		return &protectionError{ref, fmt.Sprintf("protected branch requires %s to push", rule.PushPermission)}
+	}
+	return nil
+}
+
+// checkCommitPolicy applies the policy to a single commit the server is about
+// to make on ref, changing paths, before any of its objects are written. The
+// commit fast-forwards ref and has no merges, so only push permission and
+// locks can reject it.
+func checkCommitPolicy(policy pushPolicy, ref string, paths []string) error {
+	for _, rule := range matchingProtections(policy.Rules, ref) {
+		if err := checkPushPermission(policy, rule, ref); err != nil {
+			return err
+		}
+	}
+
+	owners := make(map[string]string, len(policy.Locks))
+	for _, lock := range policy.Locks {
+		owners[lock.Path] = lock.Owner
+	}
+	for _, path := range paths {
+		if owner, ok := owners[path]; ok {
+			return &protectionError{ref, fmt.Sprintf("%s is locked by %s", path, owner)}
+		}
+	}
+
+	return nil
+}
+
+// checkLockedPaths rejects updates whose new commits modify a path locked by another user.
+func checkLockedPaths(ctx context.Context, repoPath string, locks []pushLock, update refUpdate) error {
+	if len(locks) == 0 || isZeroSHA(update.NewSHA) {
+		return nil
+	}
+
+	owners := make(map[string]string, len(locks))
+	for _, lock := range locks {
+		owners[lock.Path] = lock.Owner
+	}
+
+	// Renames are listed as a deletion and an addition, so moving a locked
+	// file away also counts as changing it.
+	args := []string{"log", "--format=", "--name-only", "--no-renames", "-z", update.NewSHA}
+	if isZeroSHA(update.OldSHA) {
+		args = append(args, "--not", "--all")
+	} else {
+		args = append(args, "^"+update.OldSHA)
+	}
+
+	output, err := gitCommandOutput(ctx, repoPath, args...)
+	if err != nil {
+		return fmt.Errorf("list changed paths: %w", err)
+	}
+
+	// Paths are NUL-terminated and used verbatim, since they may start or end
+	// with whitespace.
+	for _, changed := range strings.Split(string(output), "\x00") {
+		if changed == "" {
+			continue
+		}
+		if owner, ok := owners[changed]; ok {
+			return &protectionError{update.Ref, fmt.Sprintf("%s is locked by %s", changed, owner)}
+		}
+	}
+
+	return nil
+}
+
+// gitIsAncestor reports whether ancestor is reachable from descendant.
+func gitIsAncestor(ctx context.Context, repoPath, ancestor, descendant string) (bool, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "merge-base", "--is-ancestor", ancestor, descendant)
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, err
+}
+
+// RunPreReceiveHook evaluates the push policy for the ref updates read from a
+// pre-receive hook's stdin. Rejection reasons are written to stderr, which git
+// relays to the client over the sideband. It is invoked by the hook script that
+// GitHTTPHandler installs, from within the repository directory.
+func RunPreReceiveHook(ctx context.Context, stdin io.Reader, stderr io.Writer) error {
+	policyPath := os.Getenv(pushPolicyEnv)
+	if policyPath == "" {
+		return nil
+	}
+
+	raw, err := os.ReadFile(policyPath)
+	if err != nil {
+		return fmt.Errorf("read push policy: %w", err)
+	}
+
+	var policy pushPolicy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return fmt.Errorf("decode push policy: %w", err)
+	}
+
+	updates, err := parseRefUpdates(stdin)
+	if err != nil {
+		return err
+	}
+
+	var rejected bool
+	for _, update := range updates {
+		if err := checkRefUpdate(ctx, ".", policy, update); err != nil {
+			var protErr *protectionError
+			if !errors.As(err, &protErr) {
+				return err
+			}
+			fmt.Fprintf(stderr, "ephemeral: rejected %s\n", protErr.Error())
+			rejected = true
+		}
+	}
+
+	if rejected {
+		return fmt.Errorf("push rejected by push policy")
+	}
+	return nil
+}
+
+// parseRefUpdates reads the "<old> <new> <ref>" lines git passes to the
+// pre-receive and post-receive hooks.
+func parseRefUpdates(r io.Reader) ([]refUpdate, error) {
+	var updates []refUpdate
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		updates = append(updates, refUpdate{OldSHA: fields[0], NewSHA: fields[1], Ref: fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ref updates: %w", err)
+	}
+	return updates, nil
+}
+
+// RunPostReceiveHook saves the ref updates read from a post-receive hook's
+// stdin for the server, which records them once receive-pack exits. It is
+// invoked by the hook script that GitHTTPHandler installs.
+func RunPostReceiveHook(stdin io.Reader) error {
+	path := os.Getenv(pushUpdatesEnv)
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open ref updates: %w", err)
+	}
+	if _, err := io.Copy(f, stdin); err != nil {
+		f.Close()
+		return fmt.Errorf("write ref updates: %w", err)
+	}
+	return f.Close()
+}
+
+// gitConfigEnv appends config overrides to env as GIT_CONFIG_* variables,
+// which keeps values such as credentials out of the command line.
+func gitConfigEnv(env []string, config [][2]string) []string {
+	env = append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(config)))
+	for i, kv := range config {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, kv[0]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, kv[1]),
+		)
+	}
+	return env
+}
+
+// pushActor identifies who made a push. TokenID is nil for SSH pushes.
+// Pushes with a deploy key have no user and set DeployKeyID instead.
+type pushActor struct {
+	UserID      string
+	TokenID     *string
+	DeployKeyID *string
+}
+
+// tokenPushActor returns the actor for a push over HTTP.
+func tokenPushActor(token *store.Token) pushActor {
+	if token.DeployKey != nil {
+		return pushActor{DeployKeyID: &token.DeployKey.ID}
+	}
+	return pushActor{UserID: *token.UserID, TokenID: &token.ID}
+}
+
+// writePushPolicy saves the policy for the pre-receive hook to path.
+func writePushPolicy(path string, policy pushPolicy) error {
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("encode push policy: %w", err)
+	}
+	if err := os.WriteFile(path, encoded, 0600); err != nil {
+		return fmt.Errorf("write push policy: %w", err)
+	}
+	return nil
+}
+
+// installHooks writes the hook scripts that call back into this executable:
+// pre-receive enforces the push policy and post-receive reports the ref
+// updates that were made.
+// Returns the hooks directory to use as core.hooksPath.
+func installHooks(dataDir string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("resolve executable: %w", err)
+	}
+
+	hooksDir, err := filepath.Abs(filepath.Join(dataDir, "hooks"))
+	if err != nil {
+		return "", fmt.Errorf("resolve hooks directory: %w", err)
+	}
+
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return "", fmt.Errorf("create hooks directory: %w", err)
+	}
+
+	quoted := "'" + strings.ReplaceAll(exe, "'", `'\''`) + "'"
+	for _, hook := range []string{"pre-receive", "post-receive"} {
+		script := fmt.Sprintf("#!/bin/sh\nexec %s hook %s\n", quoted, hook)
+		if err := os.WriteFile(filepath.Join(hooksDir, hook), []byte(script), 0755); err != nil {
+			return "", fmt.Errorf("write %s hook: %w", hook, err)
+		}
+	}
+
+	return hooksDir, nil
+}
+
+// loadPushPolicy builds the policy for a user pushing to a repo, through a
+// token limited to scope when scope is not nil.
+func loadPushPolicy(st store.Store, permissions *store.PermissionChecker, userID string, scope *store.TokenScope, repo *store.Repo) (pushPolicy, error) {
+	rules, err := st.ListBranchProtections(repo.ID)
+	if err != nil {
+		return pushPolicy{}, fmt.Errorf("list branch protections: %w", err)
+	}
+
+	locks, err := otherUsersLocks(st, repo.ID, userID)
+	if err != nil {
+		return pushPolicy{}, err
+	}
+
+	policy := pushPolicy{Rules: rules, Locks: locks}
+	if len(rules) == 0 {
+		return policy, nil
+	}
+
+	for _, perm := range []store.Permission{store.PermRepoAdmin, store.PermRepoWrite} {
+		has, err := permissions.CheckUserRepoPermission(userID, repo, perm)
+		if err != nil {
+			return pushPolicy{}, fmt.Errorf("check permission: %w", err)
+		}
+		if has && scope.AllowsRepo(repo, perm) {
+			policy.Permission = store.ExpandImplied(perm)
+			break
+		}
+	}
+
+	return policy, nil
+}
+
+// loadDeployKeyPushPolicy builds the policy for a deploy key pushing to its
+// repo. Deploy keys hold no LFS locks, so every lock applies.
+func loadDeployKeyPushPolicy(st store.Store, key *store.DeployKey, repo *store.Repo) (pushPolicy, error) {
+	rules, err := st.ListBranchProtections(repo.ID)
+	if err != nil {
+		return pushPolicy{}, fmt.Errorf("list branch protections: %w", err)
+	}
+
+	locks, err := otherUsersLocks(st, repo.ID, "")
+	if err != nil {
+		return pushPolicy{}, err
+	}
+
+	return pushPolicy{Rules: rules, Locks: locks, Permission: key.Permission()}, nil
+}
+
+// otherUsersLocks returns the repo's LFS locks that are not held by userID.
+func otherUsersLocks(st store.Store, repoID, userID string) ([]pushLock, error) {
+	var locks []pushLock
+	cursor := ""
+	for {
+		page, err := st.ListLFSLocks(repoID, "", cursor, lfsLockPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("list lfs locks: %w", err)
+		}
+
+		for _, lock := range page {
+			if lock.OwnerID != userID {
+				locks = append(locks, pushLock{Path: lock.Path, Owner: lock.OwnerName})
+			}
+		}
+
+		if len(page) < lfsLockPageSize {
+			return locks, nil
+		}
+		cursor = page[len(page)-1].ID
+	}
+}
+
+// checkProtectedRefUpdate applies branch protection to a ref change made through the API.
+func (s *Server) checkProtectedRefUpdate(ctx context.Context, token *store.Token, repo *store.Repo, update refUpdate) error {
+	if token.UserID == nil {
+		return &protectionError{update.Ref, "token has no associated user"}
+	}
+
+	policy, err := loadPushPolicy(s.store, s.permissions, *token.UserID, token.Scope, repo)
+	if err != nil {
+		return err
+	}
+	if policy.empty() {
+		return nil
+	}
+
+	repoPath, err := SafeRepoPath(s.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		return err
+	}
+
+	return checkRefUpdate(ctx, repoPath, policy, update)
+}
+
+// checkProtectedCommit applies branch protection to a commit the API is about
+// to make on ref, so that a rejected commit writes no objects.
+func (s *Server) checkProtectedCommit(token *store.Token, repo *store.Repo, ref string, paths []string) error {
+	if token.UserID == nil {
+		return &protectionError{ref, "token has no associated user"}
+	}
+
+	policy, err := loadPushPolicy(s.store, s.permissions, *token.UserID, token.Scope, repo)
+	if err != nil {
+		return err
+	}
+
+	return checkCommitPolicy(policy, ref, paths)
+}
+
+// writeProtectionError writes a 403 for policy rejections and a 500 otherwise.
+func writeProtectionError(w http.ResponseWriter, err error) {
+	var protErr *protectionError
+	if errors.As(err, &protErr) {
+		JSONError(w, http.StatusForbidden, "Branch protection: "+protErr.Error())
+		return
+	}
+	slog.Warn("branch protection check failed", "error", err)
+	JSONError(w, http.StatusInternalServerError, "Failed to check branch protection")
+}
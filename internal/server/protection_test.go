@@ -0,0 +1,331 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// newProtectionTestRepo builds a bare repo where main is at b, which
+// fast-forwards a; side is at c, which diverges from b; and merged is at m, a
+// merge of b and c.
+func newProtectionTestRepo(t *testing.T) (repoPath string, a, b, c, m string) {
+	t.Helper()
+
+	repoPath, work := newMergeTestRepo(t)
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	a = mergeTestHead(t, gitRepo, "main")
+
+	commitMergeTestFile(t, work, "main.txt", "main\n", "Main change")
+	runGit(t, work, "checkout", "-q", "-b", "side", "HEAD~1")
+	commitMergeTestFile(t, work, "side.txt", "side\n", "Side change")
+	runGit(t, work, "checkout", "-q", "-b", "merged", "main")
+	runGit(t, work, "merge", "-q", "--no-edit", "side")
+	runGit(t, work, "push", "-q", repoPath, "main", "side", "merged")
+
+	return repoPath, a, mergeTestHead(t, gitRepo, "main"), mergeTestHead(t, gitRepo, "side"), mergeTestHead(t, gitRepo, "merged")
+}
+
+func TestCheckRefUpdate(t *testing.T) {
+	repoPath, a, b, c, m := newProtectionTestRepo(t)
+	zero := strings.Repeat("0", 40)
+	write := store.ExpandImplied(store.PermRepoWrite)
+	admin := store.ExpandImplied(store.PermRepoAdmin)
+
+	tests := []struct {
+		name       string
+		rule       store.BranchProtection
+		permission store.Permission
+		update     refUpdate
+		wantErr    string
+	}{
+		{
+			name:   "unprotected branch allows force push",
+			rule:   store.BranchProtection{Pattern: "main", BlockForcePush: true},
+			update: refUpdate{OldSHA: b, NewSHA: c, Ref: "refs/heads/feature"},
+		},
+		{
+			name:   "fast-forward allowed",
+			rule:   store.BranchProtection{Pattern: "main", BlockForcePush: true},
+			update: refUpdate{OldSHA: a, NewSHA: b, Ref: "refs/heads/main"},
+		},
+		{
+			name:    "force push rejected",
+			rule:    store.BranchProtection{Pattern: "main", BlockForcePush: true},
+			update:  refUpdate{OldSHA: b, NewSHA: c, Ref: "refs/heads/main"},
+			wantErr: "force push to protected branch is not allowed",
+		},
+		{
+			name:   "force push rejection does not block deletion",
+			rule:   store.BranchProtection{Pattern: "main", BlockForcePush: true},
+			update: refUpdate{OldSHA: b, NewSHA: zero, Ref: "refs/heads/main"},
+		},
+		{
+			name:    "deletion rejected",
+			rule:    store.BranchProtection{Pattern: "main", BlockDeletion: true},
+			update:  refUpdate{OldSHA: b, NewSHA: zero, Ref: "refs/heads/main"},
+			wantErr: "protected branch cannot be deleted",
+		},
+		{
+			name:   "pattern matches branches",
+			rule:   store.BranchProtection{Pattern: "release/*", BlockForcePush: true},
+			update: refUpdate{OldSHA: a, NewSHA: b, Ref: "refs/heads/release/1.0"},
+		},
+		{
+			name:    "pattern rejects force push",
+			rule:    store.BranchProtection{Pattern: "release/*", BlockForcePush: true},
+			update:  refUpdate{OldSHA: b, NewSHA: c, Ref: "refs/heads/release/1.0"},
+			wantErr: "force push",
+		},
+		{
+			name:   "tags are not protected",
+			rule:   store.BranchProtection{Pattern: "*", BlockDeletion: true},
+			update: refUpdate{OldSHA: b, NewSHA: zero, Ref: "refs/tags/v1"},
+		},
+		{
+			name:   "linear update allowed",
+			rule:   store.BranchProtection{Pattern: "main", RequireLinearHistory: true},
+			update: refUpdate{OldSHA: a, NewSHA: b, Ref: "refs/heads/main"},
+		},
+		{
+			name:    "merge commit rejected",
+			rule:    store.BranchProtection{Pattern: "main", RequireLinearHistory: true},
+			update:  refUpdate{OldSHA: b, NewSHA: m, Ref: "refs/heads/main"},
+			wantErr: "requires linear history",
+		},
+		{
+			name:   "new branch with merges already in the repo allowed",
+			rule:   store.BranchProtection{Pattern: "*", RequireLinearHistory: true},
+			update: refUpdate{OldSHA: zero, NewSHA: m, Ref: "refs/heads/copy"},
+		},
+		{
+			name:       "push permission missing",
+			rule:       store.BranchProtection{Pattern: "main", PushPermission: store.PermRepoAdmin},
+			permission: write,
+			update:     refUpdate{OldSHA: a, NewSHA: b, Ref: "refs/heads/main"},
+			wantErr:    "protected branch requires repo:admin to push",
+		},
+		{
+			name:       "push permission held",
+			rule:       store.BranchProtection{Pattern: "main", PushPermission: store.PermRepoAdmin},
+			permission: admin,
+			update:     refUpdate{OldSHA: a, NewSHA: b, Ref: "refs/heads/main"},
+		},
+		{
+			name:       "push permission checked before deletion",
+			rule:       store.BranchProtection{Pattern: "main", PushPermission: store.PermRepoAdmin},
+			permission: write,
+			update:     refUpdate{OldSHA: b, NewSHA: zero, Ref: "refs/heads/main"},
+			wantErr:    "requires repo:admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := pushPolicy{Rules: []store.BranchProtection{tt.rule}, Permission: tt.permission}
+			err := checkRefUpdate(context.Background(), repoPath, policy, tt.update)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var protErr *protectionError
+			require.ErrorAs(t, err, &protErr)
+			assert.Contains(t, protErr.Reason, tt.wantErr)
+		})
+	}
+}
+
+func TestCheckLockedPaths(t *testing.T) {
+	repoPath, work := newMergeTestRepo(t)
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	base := mergeTestHead(t, gitRepo, "main")
+
+	commit := func(t *testing.T, branch string, change func()) string {
+		t.Helper()
+		runGit(t, work, "checkout", "-q", "-B", branch, base)
+		change()
+		runGit(t, work, "add", "-A")
+		runGit(t, work, "commit", "-q", "-m", "Change "+branch)
+		runGit(t, work, "push", "-q", "-f", repoPath, branch)
+		sha := mergeTestHead(t, gitRepo, branch)
+
+		// Like a push in progress, the commit is in the repo but no ref
+		// points at it yet.
+		runGit(t, repoPath, "update-ref", "-d", "refs/heads/"+branch)
+		return sha
+	}
+
+	writeMergeTestFile(t, work, "my file.txt", "one\n")
+	writeMergeTestFile(t, work, " padded.txt ", "one\n")
+	writeMergeTestFile(t, work, "notes.txt", "one\n")
+	runGit(t, work, "add", "-A")
+	runGit(t, work, "commit", "-q", "-m", "Add files")
+	runGit(t, work, "push", "-q", repoPath, "main")
+	base = mergeTestHead(t, gitRepo, "main")
+
+	spaced := commit(t, "spaced", func() { writeMergeTestFile(t, work, "my file.txt", "two\n") })
+	padded := commit(t, "padded", func() { writeMergeTestFile(t, work, " padded.txt ", "two\n") })
+	renamed := commit(t, "renamed", func() { runGit(t, work, "mv", "notes.txt", "moved.txt") })
+	unlocked := commit(t, "unlocked", func() { writeMergeTestFile(t, work, "README", "changed\n") })
+
+	locks := []pushLock{
+		{Path: "my file.txt", Owner: "alice"},
+		{Path: " padded.txt ", Owner: "bob"},
+		{Path: "notes.txt", Owner: "carol"},
+	}
+	trimmedLocks := []pushLock{{Path: "padded.txt", Owner: "dave"}}
+
+	tests := []struct {
+		name    string
+		locks   []pushLock
+		newSHA  string
+		wantErr string
+	}{
+		{"path with spaces", locks, spaced, "my file.txt is locked by alice"},
+		{"path with surrounding whitespace", locks, padded, " padded.txt  is locked by bob"},
+		{"whitespace is not trimmed", trimmedLocks, padded, ""},
+		{"renamed away", locks, renamed, "notes.txt is locked by carol"},
+		{"unlocked path", locks, unlocked, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, oldSHA := range []string{base, strings.Repeat("0", 40)} {
+				err := checkLockedPaths(context.Background(), repoPath, tt.locks, refUpdate{OldSHA: oldSHA, NewSHA: tt.newSHA, Ref: "refs/heads/topic"})
+				if tt.wantErr == "" {
+					assert.NoError(t, err)
+					continue
+				}
+				var protErr *protectionError
+				require.ErrorAs(t, err, &protErr)
+				assert.Equal(t, tt.wantErr, protErr.Reason)
+			}
+		})
+	}
+}
+
+func TestCheckCommitPolicy(t *testing.T) {
+	rules := []store.BranchProtection{{Pattern: "main", PushPermission: store.PermRepoAdmin}}
+	locks := []pushLock{{Path: "docs/guide.md", Owner: "alice"}}
+
+	tests := []struct {
+		name    string
+		policy  pushPolicy
+		ref     string
+		paths   []string
+		wantErr string
+	}{
+		{"no policy", pushPolicy{}, "refs/heads/main", []string{"README"}, ""},
+		{"missing push permission", pushPolicy{Rules: rules, Permission: store.ExpandImplied(store.PermRepoWrite)}, "refs/heads/main", []string{"README"}, "protected branch requires repo:admin to push"},
+		{"push permission held", pushPolicy{Rules: rules, Permission: store.ExpandImplied(store.PermRepoAdmin)}, "refs/heads/main", []string{"README"}, ""},
+		{"unprotected branch", pushPolicy{Rules: rules}, "refs/heads/topic", []string{"README"}, ""},
+		{"locked path", pushPolicy{Locks: locks}, "refs/heads/topic", []string{"README", "docs/guide.md"}, "docs/guide.md is locked by alice"},
+		{"unlocked path", pushPolicy{Locks: locks}, "refs/heads/topic", []string{"docs/other.md"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCommitPolicy(tt.policy, tt.ref, tt.paths)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var protErr *protectionError
+			require.ErrorAs(t, err, &protErr)
+			assert.Equal(t, tt.wantErr, protErr.Reason)
+		})
+	}
+}
+
+func TestRunPreReceiveHook(t *testing.T) {
+	repoPath, a, b, c, _ := newProtectionTestRepo(t)
+	zero := strings.Repeat("0", 40)
+
+	// Enough locks to go over the kernel's 128 KiB limit on a single
+	// environment variable, which the policy file avoids.
+	policy := pushPolicy{Rules: []store.BranchProtection{{Pattern: "main", BlockForcePush: true, BlockDeletion: true}}}
+	for i := range 5000 {
+		policy.Locks = append(policy.Locks, pushLock{Path: fmt.Sprintf("assets/texture-%04d.png", i), Owner: "alice"})
+	}
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, writePushPolicy(policyPath, policy))
+
+	info, err := os.Stat(policyPath)
+	require.NoError(t, err)
+	require.Greater(t, info.Size(), int64(128*1024))
+
+	t.Chdir(repoPath)
+
+	run := func(t *testing.T, input string) (string, error) {
+		t.Helper()
+		var stderr bytes.Buffer
+		err := RunPreReceiveHook(context.Background(), strings.NewReader(input), &stderr)
+		return stderr.String(), err
+	}
+
+	t.Run("without a policy", func(t *testing.T) {
+		t.Setenv(pushPolicyEnv, "")
+		stderr, err := run(t, b+" "+zero+" refs/heads/main\n")
+		assert.NoError(t, err)
+		assert.Empty(t, stderr)
+	})
+
+	t.Run("accepts allowed updates", func(t *testing.T) {
+		t.Setenv(pushPolicyEnv, policyPath)
+		stderr, err := run(t, a+" "+b+" refs/heads/main\n"+zero+" "+c+" refs/heads/feature\n")
+		assert.NoError(t, err)
+		assert.Empty(t, stderr)
+	})
+
+	t.Run("reports every rejected update", func(t *testing.T) {
+		t.Setenv(pushPolicyEnv, policyPath)
+		stderr, err := run(t, b+" "+c+" refs/heads/main\n"+a+" "+b+" refs/heads/other\n"+b+" "+zero+" refs/heads/main\n")
+		assert.ErrorContains(t, err, "push rejected by push policy")
+		assert.Contains(t, stderr, "ephemeral: rejected main: force push to protected branch is not allowed\n")
+		assert.Contains(t, stderr, "ephemeral: rejected main: protected branch cannot be deleted\n")
+		assert.NotContains(t, stderr, "other")
+	})
+
+	t.Run("fails on a missing policy file", func(t *testing.T) {
+		t.Setenv(pushPolicyEnv, filepath.Join(t.TempDir(), "missing.json"))
+		_, err := run(t, a+" "+b+" refs/heads/main\n")
+		assert.ErrorContains(t, err, "read push policy")
+	})
+}
+
+func TestRunPostReceiveHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates")
+
+	t.Run("without an updates file", func(t *testing.T) {
+		t.Setenv(pushUpdatesEnv, "")
+		assert.NoError(t, RunPostReceiveHook(strings.NewReader("a b refs/heads/main\n")))
+	})
+
+	t.Run("appends the ref updates", func(t *testing.T) {
+		t.Setenv(pushUpdatesEnv, path)
+		require.NoError(t, RunPostReceiveHook(strings.NewReader("a b refs/heads/main\n")))
+		require.NoError(t, RunPostReceiveHook(strings.NewReader("c d refs/tags/v1\nmalformed\n")))
+
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+
+		updates, err := parseRefUpdates(f)
+		require.NoError(t, err)
+		assert.Equal(t, []refUpdate{
+			{OldSHA: "a", NewSHA: "b", Ref: "refs/heads/main"},
+			{OldSHA: "c", NewSHA: "d", Ref: "refs/tags/v1"},
+		}, updates)
+	})
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const (
+	pushMirrorMaxAttempts    = 5
+	pushMirrorRetryBaseDelay = 30 * time.Second
+	pushMirrorPollInterval   = 30 * time.Second
+	pushMirrorBatchSize      = 10
+)
+
+// pushMirrorer replicates repos to their push mirrors in the background.
+// Pushes are queued in the store, so pending pushes survive a restart, and
+// failed attempts are retried with exponential backoff.
+type pushMirrorer struct {
+	store   store.Store
+	dataDir string
+	opts    MirrorOptions
+	wake    chan struct{}
+}
+
+func newPushMirrorer(st store.Store, dataDir string, opts MirrorOptions) *pushMirrorer {
+	return &pushMirrorer{
+		store:   st,
+		dataDir: dataDir,
+		opts:    opts,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// queue schedules a push of the repo to all of its push mirrors.
+func (p *pushMirrorer) queue(repoID string) {
+	if p == nil {
+		return
+	}
+
+	if err := p.store.QueuePushMirrors(repoID, time.Now()); err != nil {
+		slog.Warn("failed to queue push mirrors", "repo_id", repoID, "error", err)
+		return
+	}
+	p.notify()
+}
+
+func (p *pushMirrorer) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run pushes due mirrors until the context is cancelled.
+func (p *pushMirrorer) run(ctx context.Context) {
+	ticker := time.NewTicker(pushMirrorPollInterval)
+	defer ticker.Stop()
+
+	for {
+		p.pushDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+	}
+}
+
+func (p *pushMirrorer) pushDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		mirrors, err := p.store.ListDuePushMirrors(time.Now(), pushMirrorBatchSize)
+		if err != nil {
+			slog.Warn("failed to list due push mirrors", "error", err)
+			return
+		}
+
+		for i := range mirrors {
+			p.attempt(ctx, &mirrors[i])
+		}
+
+		if len(mirrors) < pushMirrorBatchSize {
+			return
+		}
+	}
+}
+
+// attempt pushes to a mirror once and records the outcome, scheduling a retry
+// on failure.
+func (p *pushMirrorer) attempt(ctx context.Context, mirror *store.PushMirror) {
+	now := time.Now()
+	err := p.push(ctx, mirror)
+
+	if err == nil {
+		mirror.Status = store.MirrorStatusSucceeded
+		mirror.Attempts = 0
+		mirror.LastError = nil
+		mirror.LastSyncAt = &now
+		mirror.NextAttemptAt = nil
+	} else {
+		msg := err.Error()
+		if len(msg) > mirrorMaxErrorBytes {
+			msg = msg[:mirrorMaxErrorBytes]
+		}
+		mirror.Attempts++
+		mirror.LastError = &msg
+
+		if mirror.Attempts >= pushMirrorMaxAttempts {
+			mirror.Status = store.MirrorStatusFailed
+			mirror.NextAttemptAt = nil
+		} else {
+			next := now.Add(pushMirrorRetryBaseDelay << (mirror.Attempts - 1))
+			mirror.NextAttemptAt = &next
+		}
+		slog.Warn("push mirror failed", "mirror_id", mirror.ID, "attempts", mirror.Attempts, "error", err)
+	}
+
+	if _, err := p.store.RecordPushMirrorAttempt(mirror); err != nil {
+		slog.Warn("failed to record push mirror attempt", "mirror_id", mirror.ID, "error", err)
+	}
+}
+
+// push runs git push --mirror, which makes the remote's refs match the repo,
+// deleting remote refs the repo no longer has.
+func (p *pushMirrorer) push(ctx context.Context, mirror *store.PushMirror) error {
+	ctx, cancel := context.WithTimeout(ctx, mirrorGitTimeout)
+	defer cancel()
+
+	repo, err := p.store.GetRepoByID(mirror.RepoID)
+	if err != nil {
+		return fmt.Errorf("get repo: %w", err)
+	}
+	if repo == nil {
+		return fmt.Errorf("repository not found")
+	}
+
+	repoPath, err := SafeRepoPath(p.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		return fmt.Errorf("resolve repo path: %w", err)
+	}
+
+	env, remote, err := p.opts.remoteEnv(ctx, mirror.Credentials, mirror.URL)
+	if err != nil {
+		return err
+	}
+
+	return runMirrorGit(ctx, repoPath, env, "push", "--mirror", "--quiet", remote)
+}
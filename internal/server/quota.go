@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// Quota names reported in quota error bodies.
+const (
+	quotaRepoLimit    = "repo_limit"
+	quotaStorageLimit = "storage_limit_bytes"
+)
+
+// quotaError is returned when an operation would exceed a namespace quota.
+type quotaError struct {
+	Quota string
+	Limit int64
+	Used  int64
+}
+
+func (e *quotaError) Error() string {
+	if e.Quota == quotaRepoLimit {
+		return fmt.Sprintf("namespace repository limit reached (%d of %d)", e.Used, e.Limit)
+	}
+	return fmt.Sprintf("namespace storage quota exceeded (%d of %d bytes used)", e.Used, e.Limit)
+}
+
+// status is 403 for the repo limit and 507 Insufficient Storage for the storage limit.
+func (e *quotaError) status() int {
+	if e.Quota == quotaRepoLimit {
+		return http.StatusForbidden
+	}
+	return http.StatusInsufficientStorage
+}
+
+// quotaErrorResponse is the error body for quota rejections. It extends the
+// standard {"error": ...} body so existing clients still get a message.
+type quotaErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	Quota string `json:"quota"`
+	Limit int64  `json:"limit"`
+	Used  int64  `json:"used"`
+}
+
+// checkRepoQuota returns a *quotaError if the namespace cannot hold another repo.
+func checkRepoQuota(st store.Store, namespaceID string) error {
+	ns, err := st.GetNamespace(namespaceID)
+	if err != nil {
+		return fmt.Errorf("get namespace: %w", err)
+	}
+	if ns == nil || ns.RepoLimit == nil {
+		return nil
+	}
+
+	usage, err := st.GetNamespaceUsage(namespaceID)
+	if err != nil {
+		return err
+	}
+
+	if usage.RepoCount >= *ns.RepoLimit {
+		return &quotaError{Quota: quotaRepoLimit, Limit: int64(*ns.RepoLimit), Used: int64(usage.RepoCount)}
+	}
+	return nil
+}
+
+// storageUsage returns the storage limit and current usage of a namespace.
+// limited is false when the namespace has no storage limit.
+func storageUsage(st store.Store, namespaceID string) (limit, used int64, limited bool, err error) {
+	ns, err := st.GetNamespace(namespaceID)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("get namespace: %w", err)
+	}
+	if ns == nil || ns.StorageLimitBytes == nil {
+		return 0, 0, false, nil
+	}
+
+	usage, err := st.GetNamespaceUsage(namespaceID)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return int64(*ns.StorageLimitBytes), usage.StorageBytes(), true, nil
+}
+
+// checkStorageQuota returns a *quotaError if storing size more bytes would
+// exceed the namespace storage limit.
+func checkStorageQuota(st store.Store, namespaceID string, size int64) error {
+	limit, used, limited, err := storageUsage(st, namespaceID)
+	if err != nil || !limited {
+		return err
+	}
+
+	if used+size > limit {
+		return &quotaError{Quota: quotaStorageLimit, Limit: limit, Used: used}
+	}
+	return nil
+}
+
+// writeQuotaError writes the quota error body for quota rejections and a 500 otherwise.
+func writeQuotaError(w http.ResponseWriter, err error) {
+	var qErr *quotaError
+	if !errors.As(err, &qErr) {
+		slog.Warn("quota check failed", "error", err)
+		JSONError(w, http.StatusInternalServerError, "Failed to check namespace quota")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(qErr.status())
+	json.NewEncoder(w).Encode(quotaErrorResponse{
+		Error: qErr.Error(),
+		Code:  "quota_exceeded",
+		Quota: qErr.Quota,
+		Limit: qErr.Limit,
+		Used:  qErr.Used,
+	})
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// reanchorReviewThreads moves the review threads that follow a pushed branch
+// to the branch's new head. A thread on the new side of a diff keeps its line,
+// renumbered past lines added or removed above it, unless the line itself
+// changed, in which case the thread is marked outdated. Threads on the old
+// side refer to the unchanged base and just move. Threads on a deleted branch
+// are marked outdated.
+func reanchorReviewThreads(ctx context.Context, st store.Store, repoID, repoPath string, updates []refUpdate) {
+	for _, u := range updates {
+		ref := plumbing.ReferenceName(u.Ref)
+		if !ref.IsBranch() {
+			continue
+		}
+
+		threads, err := st.ListReviewThreads(store.ReviewThreadQuery{
+			RepoID:          repoID,
+			Ref:             ref.Short(),
+			ExcludeOutdated: true,
+		})
+		if err != nil {
+			slog.Warn("failed to list review threads", "repo_id", repoID, "ref", u.Ref, "error", err)
+			continue
+		}
+
+		for i := range threads {
+			thread := &threads[i]
+			if thread.CommitSHA == u.NewSHA {
+				continue
+			}
+
+			switch {
+			case isZeroSHA(u.NewSHA):
+				thread.Outdated = true
+			case thread.Side == store.ReviewSideOld:
+				thread.CommitSHA = u.NewSHA
+			default:
+				line, ok, err := mapLine(ctx, repoPath, thread.CommitSHA, u.NewSHA, thread.Path, thread.Line)
+				if err != nil {
+					slog.Warn("failed to map review thread line", "thread_id", thread.ID, "error", err)
+				}
+				if ok {
+					thread.CommitSHA = u.NewSHA
+					thread.Line = line
+				} else {
+					thread.Outdated = true
+				}
+			}
+
+			thread.UpdatedAt = time.Now()
+			if err := st.UpdateReviewThread(thread); err != nil {
+				slog.Warn("failed to update review thread", "thread_id", thread.ID, "error", err)
+			}
+		}
+	}
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// diffHunk is a changed range of a file: OldCount lines from OldStart were
+// replaced by NewCount lines. A count of zero means lines were only added
+// after, or only removed before, the start line.
+type diffHunk struct {
+	OldStart, OldCount int
+	NewStart, NewCount int
+}
+
+// mapLine finds where a line of path at one commit is at another. It reports
+// false if the line was changed or removed, or the file no longer exists.
+func mapLine(ctx context.Context, repoPath, fromSHA, toSHA, path string, line int) (int, bool, error) {
+	if _, err := gitCommandOutput(ctx, repoPath, "cat-file", "-e", toSHA+":"+path); err != nil {
+		return 0, false, nil
+	}
+
+	output, err := gitCommandOutput(ctx, repoPath, "diff", "--no-ext-diff", "--no-color", "-U0", fromSHA, toSHA, "--", path)
+	if err != nil {
+		return 0, false, err
+	}
+
+	hunks, err := parseHunks(string(output))
+	if err != nil {
+		return 0, false, err
+	}
+
+	mapped, ok := mapLineThroughHunks(hunks, line)
+	return mapped, ok, nil
+}
+
+// parseHunks reads the hunk headers of a unified diff.
+func parseHunks(diff string) ([]diffHunk, error) {
+	var hunks []diffHunk
+	for _, line := range strings.Split(diff, "\n") {
+		if !strings.HasPrefix(line, "@@ ") {
+			continue
+		}
+
+		m := hunkHeaderPattern.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("invalid hunk header %q", line)
+		}
+
+		count := func(s string) int {
+			if s == "" {
+				return 1
+			}
+			n, _ := strconv.Atoi(s)
+			return n
+		}
+		oldStart, _ := strconv.Atoi(m[1])
+		newStart, _ := strconv.Atoi(m[3])
+		hunks = append(hunks, diffHunk{
+			OldStart: oldStart,
+			OldCount: count(m[2]),
+			NewStart: newStart,
+			NewCount: count(m[4]),
+		})
+	}
+	return hunks, nil
+}
+
+// mapLineThroughHunks renumbers an old line past the hunks above it. It
+// reports false if a hunk changed the line.
+func mapLineThroughHunks(hunks []diffHunk, line int) (int, bool) {
+	offset := 0
+	for _, h := range hunks {
+		if h.OldCount == 0 {
+			// Pure insertion after OldStart.
+			if h.OldStart >= line {
+				break
+			}
+			offset += h.NewCount
+			continue
+		}
+
+		if line < h.OldStart {
+			break
+		}
+		if line < h.OldStart+h.OldCount {
+			return 0, false
+		}
+		offset += h.NewCount - h.OldCount
+	}
+	return line + offset, true
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+func TestParseHunks(t *testing.T) {
+	diff := "diff --git a/f b/f\n" +
+		"--- a/f\n" +
+		"+++ b/f\n" +
+		"@@ -0,0 +1,2 @@\n" +
+		"+a\n" +
+		"+b\n" +
+		"@@ -5 +7 @@ func x() {\n" +
+		"-old\n" +
+		"+new\n" +
+		"@@ -9,2 +10,0 @@\n"
+
+	hunks, err := parseHunks(diff)
+	require.NoError(t, err)
+	assert.Equal(t, []diffHunk{
+		{OldStart: 0, OldCount: 0, NewStart: 1, NewCount: 2},
+		{OldStart: 5, OldCount: 1, NewStart: 7, NewCount: 1},
+		{OldStart: 9, OldCount: 2, NewStart: 10, NewCount: 0},
+	}, hunks)
+
+	_, err = parseHunks("@@ bogus @@\n")
+	assert.Error(t, err)
+}
+
+func TestMapLineThroughHunks(t *testing.T) {
+	hunks := []diffHunk{
+		{OldStart: 0, OldCount: 0, NewStart: 1, NewCount: 2},   // two lines added at the top
+		{OldStart: 5, OldCount: 1, NewStart: 7, NewCount: 1},   // line 5 changed
+		{OldStart: 9, OldCount: 2, NewStart: 10, NewCount: 0},  // lines 9-10 removed
+		{OldStart: 12, OldCount: 0, NewStart: 12, NewCount: 3}, // three lines added after 12
+	}
+
+	tests := []struct {
+		line   int
+		want   int
+		wantOK bool
+	}{
+		{line: 1, want: 3, wantOK: true},
+		{line: 4, want: 6, wantOK: true},
+		{line: 5, wantOK: false},
+		{line: 6, want: 8, wantOK: true},
+		{line: 9, wantOK: false},
+		{line: 10, wantOK: false},
+		{line: 11, want: 11, wantOK: true},
+		{line: 12, want: 12, wantOK: true},
+		{line: 13, want: 16, wantOK: true},
+	}
+	for _, tt := range tests {
+		got, ok := mapLineThroughHunks(hunks, tt.line)
+		assert.Equal(t, tt.wantOK, ok, "line %d", tt.line)
+		if tt.wantOK {
+			assert.Equal(t, tt.want, got, "line %d", tt.line)
+		}
+	}
+}
+
+func TestReanchorReviewThreads(t *testing.T) {
+	st, repo := newRepoTestStore(t)
+	repoPath, work := newMergeTestRepo(t)
+
+	runGit(t, work, "checkout", "-q", "-b", "feature")
+	commitMergeTestFile(t, work, "README", "one\ntwo\nthree\nfour\n", "Extend readme")
+	runGit(t, work, "push", "-q", repoPath, "feature")
+
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	before := mergeTestHead(t, gitRepo, "feature")
+
+	ref := "feature"
+	now := time.Now()
+	newThread := func(id string, line int) {
+		require.NoError(t, st.CreateReviewThread(&store.ReviewThread{
+			ID: id, RepoID: repo.ID, CommitSHA: before, Path: "README",
+			Side: store.ReviewSideNew, Line: line, Ref: &ref,
+			OriginalCommitSHA: before, OriginalLine: line,
+			CreatedAt: now, UpdatedAt: now,
+		}, &store.ReviewComment{ID: id + "-c", ThreadID: id, Body: "Comment", CreatedAt: now, UpdatedAt: now}))
+	}
+	newThread("moves", 3)
+	newThread("changes", 4)
+
+	commitMergeTestFile(t, work, "README", "zero\none\ntwo\nthree\nFOUR\n", "Rework readme")
+	runGit(t, work, "push", "-q", repoPath, "feature")
+	after := mergeTestHead(t, gitRepo, "feature")
+
+	updates := []refUpdate{{OldSHA: before, NewSHA: after, Ref: "refs/heads/feature"}}
+	reanchorReviewThreads(context.Background(), st, repo.ID, repoPath, updates)
+
+	moved, err := st.GetReviewThread(repo.ID, "moves")
+	require.NoError(t, err)
+	assert.Equal(t, after, moved.CommitSHA)
+	assert.Equal(t, 4, moved.Line)
+	assert.False(t, moved.Outdated)
+	assert.Equal(t, before, moved.OriginalCommitSHA)
+	assert.Equal(t, 3, moved.OriginalLine)
+
+	changed, err := st.GetReviewThread(repo.ID, "changes")
+	require.NoError(t, err)
+	assert.True(t, changed.Outdated)
+	assert.Equal(t, before, changed.CommitSHA)
+
+	deleted := []refUpdate{{OldSHA: after, NewSHA: plumbing.ZeroHash.String(), Ref: "refs/heads/feature"}}
+	reanchorReviewThreads(context.Background(), st, repo.ID, repoPath, deleted)
+
+	moved, err = st.GetReviewThread(repo.ID, "moves")
+	require.NoError(t, err)
+	assert.True(t, moved.Outdated, "threads on a deleted branch are outdated")
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+
+	"github.com/bantamhq/ephemeral/internal/lfs"
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const (
+	searchIndexMaxFileSize  = 512 * 1024
+	searchIndexMaxRepoBytes = 64 * 1024 * 1024
+	searchIndexMaxFiles     = 20000
+	searchIndexPollInterval = 10 * time.Minute
+)
+
+// searchIndexer keeps the code search index in step with the default branch
+// of every repo. Queued repos are indexed right away, and a periodic sweep
+// catches changes the server was not told about, such as those made while it
+// was down.
+type searchIndexer struct {
+	store   store.Store
+	dataDir string
+	wake    chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+func newSearchIndexer(st store.Store, dataDir string) *searchIndexer {
+	return &searchIndexer{
+		store:   st,
+		dataDir: dataDir,
+		wake:    make(chan struct{}, 1),
+		pending: make(map[string]bool),
+	}
+}
+
+// queue schedules the repo to be re-indexed if its default branch moved.
+func (x *searchIndexer) queue(repoID string) {
+	if x == nil {
+		return
+	}
+
+	x.mu.Lock()
+	x.pending[repoID] = true
+	x.mu.Unlock()
+
+	select {
+	case x.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run indexes queued repos until the context is cancelled.
+func (x *searchIndexer) run(ctx context.Context) {
+	ticker := time.NewTicker(searchIndexPollInterval)
+	defer ticker.Stop()
+
+	x.indexAll(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			x.indexAll(ctx)
+		case <-x.wake:
+			x.indexPending(ctx)
+		}
+	}
+}
+
+func (x *searchIndexer) indexPending(ctx context.Context) {
+	x.mu.Lock()
+	pending := x.pending
+	x.pending = make(map[string]bool)
+	x.mu.Unlock()
+
+	for repoID := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+
+		repo, err := x.store.GetRepoByID(repoID)
+		if err != nil {
+			slog.Warn("failed to get repo for search indexing", "repo_id", repoID, "error", err)
+			continue
+		}
+		if repo == nil {
+			continue
+		}
+
+		if err := x.indexRepo(ctx, repo); err != nil {
+			slog.Warn("failed to index repo for search", "repo_id", repoID, "error", err)
+		}
+	}
+}
+
+func (x *searchIndexer) indexAll(ctx context.Context) {
+	repos, err := listAllRepos(x.store)
+	if err != nil {
+		slog.Warn("failed to list repos for search indexing", "error", err)
+		return
+	}
+
+	for i := range repos {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := x.indexRepo(ctx, &repos[i]); err != nil {
+			slog.Warn("failed to index repo for search", "repo_id", repos[i].ID, "error", err)
+		}
+	}
+}
+
+// indexRepo re-indexes a repo if its default branch has changed since it was
+// last indexed.
+func (x *searchIndexer) indexRepo(ctx context.Context, repo *store.Repo) error {
+	repoPath, err := SafeRepoPath(x.dataDir, repo.NamespaceID, repo.Name)
+	if err != nil {
+		return err
+	}
+
+	gitRepo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("open repo: %w", err)
+	}
+
+	head, err := gitRepo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return fmt.Errorf("read HEAD: %w", err)
+	}
+	ref := head.Name().String()
+	if head.Type() == plumbing.SymbolicReference {
+		ref = head.Target().String()
+	}
+
+	var commitSHA string
+	resolved, err := gitRepo.Reference(plumbing.HEAD, true)
+	switch {
+	case err == nil:
+		commitSHA = resolved.Hash().String()
+	case !errors.Is(err, plumbing.ErrReferenceNotFound):
+		return fmt.Errorf("resolve HEAD: %w", err)
+	}
+
+	state, err := x.store.GetSearchIndexState(repo.ID)
+	if err != nil {
+		return err
+	}
+	if state != nil && state.Ref == ref && state.CommitSHA == commitSHA {
+		return nil
+	}
+
+	var docs []store.SearchDocument
+	if commitSHA != "" {
+		docs, err = readSearchDocuments(ctx, gitRepo, plumbing.NewHash(commitSHA))
+		if err != nil {
+			return err
+		}
+	}
+
+	return x.store.ReplaceSearchDocuments(&store.SearchIndexState{
+		RepoID:    repo.ID,
+		Ref:       ref,
+		CommitSHA: commitSHA,
+		IndexedAt: time.Now(),
+	}, docs)
+}
+
+// readSearchDocuments reads the searchable files of a commit. Binary files,
+// LFS pointers and files over the size limit are skipped, and reading stops
+// once the per-repo limits are reached.
+func readSearchDocuments(ctx context.Context, gitRepo *git.Repository, hash plumbing.Hash) ([]store.SearchDocument, error) {
+	commit, err := gitRepo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("get commit: %w", err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("get tree: %w", err)
+	}
+
+	var docs []store.SearchDocument
+	var total int64
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(docs) >= searchIndexMaxFiles {
+			return storer.ErrStop
+		}
+		if (f.Mode != filemode.Regular && f.Mode != filemode.Executable) || f.Size > searchIndexMaxFileSize {
+			return nil
+		}
+		if total+f.Size > searchIndexMaxRepoBytes {
+			return storer.ErrStop
+		}
+
+		content, err := f.Contents()
+		if err != nil {
+			return fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		if isBinaryContent([]byte(content)) {
+			return nil
+		}
+		if _, ok := lfs.ParsePointer([]byte(content)); ok {
+			return nil
+		}
+
+		total += f.Size
+		docs = append(docs, store.SearchDocument{Path: f.Name, BlobSHA: f.Hash.String(), Content: content})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read tree: %w", err)
+	}
+
+	return docs, nil
+}
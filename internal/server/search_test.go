@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+func TestSearchIndexer_IndexRepo(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	st, repo := newRepoTestStore(t)
+	indexer := newSearchIndexer(st, dataDir)
+
+	repoPath, err := SafeRepoPath(dataDir, repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	require.NoError(t, initBareRepo(repoPath))
+
+	require.NoError(t, indexer.indexRepo(ctx, repo))
+	state, err := st.GetSearchIndexState(repo.ID)
+	require.NoError(t, err)
+	require.NotNil(t, state)
+	assert.Empty(t, state.CommitSHA, "empty repos are indexed with no documents")
+
+	work := t.TempDir()
+	runGit(t, work, "init", "-q", "-b", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(work, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(work, "logo.png"), []byte{0x89, 'P', 'N', 'G', 0, 0}, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(work, "video.mp4"), []byte(
+		"version https://git-lfs.github.com/spec/v1\n"+
+			"oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\n"+
+			"size 12345\n"), 0644))
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "-q", "-m", "Initial commit")
+	runGit(t, work, "checkout", "-q", "-b", "feature")
+	require.NoError(t, os.WriteFile(filepath.Join(work, "feature.go"), []byte("package feature\n"), 0644))
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "-q", "-m", "Add feature")
+	runGit(t, work, "push", "-q", repoPath, "main", "feature")
+	runGit(t, repoPath, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	require.NoError(t, indexer.indexRepo(ctx, repo))
+
+	docs, err := st.SearchDocuments(store.SearchDocumentQuery{RepoIDs: []string{repo.ID}, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, docs, 1, "only text files on the default branch are indexed")
+	assert.Equal(t, "main.go", docs[0].Path)
+
+	state, err = st.GetSearchIndexState(repo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "refs/heads/main", state.Ref)
+	assert.NotEmpty(t, state.CommitSHA)
+
+	t.Run("follows the default branch", func(t *testing.T) {
+		runGit(t, repoPath, "symbolic-ref", "HEAD", "refs/heads/feature")
+		require.NoError(t, indexer.indexRepo(ctx, repo))
+
+		docs, err := st.SearchDocuments(store.SearchDocumentQuery{RepoIDs: []string{repo.ID}, Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, docs, 2)
+	})
+}
+
+func TestFindSearchMatches(t *testing.T) {
+	content := "one\ntwo Foo\r\nthree\nfour foo foo\nfive\n"
+
+	search, errMsg := parseCodeSearch("foo", "", false, "", "1")
+	require.Empty(t, errMsg)
+	assert.Equal(t, "foo", search.contains)
+
+	matches, truncated := findSearchMatches(content, search.pattern, search.context)
+	assert.False(t, truncated)
+	require.Len(t, matches, 2)
+
+	assert.Equal(t, 2, matches[0].LineNumber)
+	assert.Equal(t, "two Foo", matches[0].Line)
+	assert.Equal(t, [][2]int{{4, 7}}, matches[0].Ranges)
+	assert.Equal(t, []string{"one"}, matches[0].Before)
+	assert.Equal(t, []string{"three"}, matches[0].After)
+
+	assert.Equal(t, [][2]int{{5, 8}, {9, 12}}, matches[1].Ranges)
+
+	t.Run("case sensitive", func(t *testing.T) {
+		search, errMsg := parseCodeSearch("Foo", "", true, "", "")
+		require.Empty(t, errMsg)
+		matches, _ := findSearchMatches(content, search.pattern, search.context)
+		assert.Len(t, matches, 1)
+	})
+
+	t.Run("regex uses its required literal for the index", func(t *testing.T) {
+		search, errMsg := parseCodeSearch(`func\s+(Parse|Load)Config\(`, searchModeRegex, true, "", "")
+		require.Empty(t, errMsg)
+		assert.Equal(t, "Config(", search.contains)
+
+		search, errMsg = parseCodeSearch(`ab|cd`, searchModeRegex, false, "", "")
+		require.Empty(t, errMsg)
+		assert.Empty(t, search.contains)
+	})
+
+	t.Run("rejects invalid searches", func(t *testing.T) {
+		for _, tc := range []struct{ q, mode, path, context string }{
+			{"", "", "", ""},
+			{"(", searchModeRegex, "", ""},
+			{"a*", searchModeRegex, "", ""},
+			{"foo", "fuzzy", "", ""},
+			{"foo", "", "[", ""},
+			{"foo", "", "", "99"},
+		} {
+			_, errMsg := parseCodeSearch(tc.q, tc.mode, false, tc.path, tc.context)
+			assert.NotEmpty(t, errMsg, "%+v", tc)
+		}
+	})
+}
+
+func TestMatchSearchPath(t *testing.T) {
+	assert.True(t, matchSearchPath("", "cmd/eph/main.go"))
+	assert.True(t, matchSearchPath("*.go", "cmd/eph/main.go"))
+	assert.False(t, matchSearchPath("*.go", "README.md"))
+	assert.True(t, matchSearchPath("cmd/*/main.go", "cmd/eph/main.go"))
+	assert.False(t, matchSearchPath("cmd/*.go", "cmd/eph/main.go"))
+	assert.True(t, matchSearchPath("cmd/", "cmd/eph/main.go"))
+	assert.False(t, matchSearchPath("cmd/", "internal/cmd.go"))
+}
+
+func TestHandleSearchCode_ScanLimit(t *testing.T) {
+	srv, st, repo, token := newRefAPITestServer(t)
+
+	// More documents than one request reads, none of which match.
+	docs := make([]store.SearchDocument, maxCodeSearchScan+10)
+	for i := range docs {
+		docs[i] = store.SearchDocument{RepoID: repo.ID, Path: fmt.Sprintf("file%d.txt", i), BlobSHA: strings.Repeat("a", 40), Content: "filler\n"}
+	}
+	require.NoError(t, st.ReplaceSearchDocuments(&store.SearchIndexState{RepoID: repo.ID, Ref: "refs/heads/main", IndexedAt: time.Now()}, docs))
+
+	// The regex has no literal the index can use, so every document is a candidate.
+	target := "/api/v1/search/code?namespace=acme&mode=regex&q=" + url.QueryEscape("x[0-9]")
+	rec := serveAs(srv, token, http.MethodGet, target, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp ListResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Empty(t, resp.Data)
+	assert.True(t, resp.HasMore, "the scan stopped before the last document")
+	require.NotNil(t, resp.NextCursor)
+
+	rec = serveAs(srv, token, http.MethodGet, target+"&cursor="+*resp.NextCursor, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	resp = ListResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.False(t, resp.HasMore, "the next page reads the rest")
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"path/filepath"
@@ -21,22 +22,65 @@ type Server struct {
 	router      *chi.Mux
 	permissions *store.PermissionChecker
 	lfsHandler  *LFSHandler
+	gitHandler  *GitHTTPHandler
+	webhooks    *webhookDispatcher
+	mirrors     *mirrorSyncer
+	pushMirrors *pushMirrorer
+	searchIndex *searchIndexer
+	oidc        *oidcAuthenticator
+
+	releaseStorage lfs.Storage
+	maxAssetSize   int64
+}
+
+// ServerOptions configures the optional parts of a Server. The zero value
+// disables LFS and OIDC and keeps releases under the data directory.
+type ServerOptions struct {
+	LFS     LFSOptions
+	Mirror  MirrorOptions
+	Release ReleaseOptions
+	OIDC    OIDCOptions
+	Webhook WebhookOptions
 }
 
 // NewServer creates a new server instance.
-func NewServer(st store.Store, dataDir string, lfsOpts LFSOptions) *Server {
+func NewServer(st store.Store, dataDir string, opts ServerOptions) *Server {
 	s := &Server{
-		store:   st,
-		dataDir: dataDir,
-		lfsOpts: lfsOpts,
+		store:       st,
+		dataDir:     dataDir,
+		lfsOpts:     opts.LFS,
 		router:      chi.NewRouter(),
 		permissions: store.NewPermissionChecker(st),
+		webhooks:    newWebhookDispatcher(st, opts.Webhook),
+		mirrors:     newMirrorSyncer(st, dataDir, opts.Mirror),
+		pushMirrors: newPushMirrorer(st, dataDir, opts.Mirror),
+		searchIndex: newSearchIndexer(st, dataDir),
+
+		releaseStorage: opts.Release.Storage,
+		maxAssetSize:   opts.Release.MaxAssetSize,
+	}
+	if s.releaseStorage == nil {
+		s.releaseStorage = lfs.NewLocalStorage(filepath.Join(dataDir, "releases"))
+	}
+	if opts.OIDC.Issuer != "" {
+		s.oidc = newOIDCAuthenticator(opts.OIDC)
 	}
+	s.gitHandler = NewGitHTTPHandler(st, dataDir)
+	s.gitHandler.webhooks = s.webhooks
+	s.gitHandler.pushMirrors = s.pushMirrors
+	s.gitHandler.searchIndex = s.searchIndex
+	s.mirrors.git = s.gitHandler
+
+	if opts.LFS.Enabled {
+		storage := opts.LFS.Storage
+		if storage == nil {
+			storage = lfs.NewLocalStorage(filepath.Join(dataDir, "lfs"))
+		}
+		s.lfsHandler = NewLFSHandler(st, storage, opts.LFS.BaseURL, opts.LFS.MaxFileSize)
 
-	if lfsOpts.Enabled {
-		lfsPath := filepath.Join(dataDir, "lfs")
-		storage := lfs.NewLocalStorage(lfsPath)
-		s.lfsHandler = NewLFSHandler(st, storage, lfsOpts.BaseURL, lfsOpts.MaxFileSize)
+		if presigner, ok := storage.(lfs.Presigner); ok && opts.LFS.DirectTransfer {
+			s.lfsHandler.presigner = presigner
+		}
 	}
 
 	s.setupRoutes()
@@ -50,6 +94,14 @@ func (s *Server) setupRoutes() {
 	s.router.Get("/health", s.handleHealth)
 	s.router.Get("/.well-known/ephemeral-auth", s.handleAuthConfig)
 
+	s.router.Get(deviceLoginPath, s.handleDeviceLoginPage)
+	s.router.Post(deviceLoginPath, s.handleDeviceLoginForm)
+
+	if s.oidc != nil {
+		s.router.Get(oidcLoginPath, s.handleOIDCLogin)
+		s.router.Get(oidcCallbackPath, s.handleOIDCCallback)
+	}
+
 	s.router.Route("/api/v1", func(r chi.Router) {
 		// Auth session routes - no auth required
 		r.Post("/auth/sessions", s.handleCreateAuthSession)
@@ -83,6 +135,11 @@ func (s *Server) setupRoutes() {
 			r.Get("/users/{id}/tokens", s.handleAdminListUserTokens)
 			r.Post("/users/{id}/tokens", s.handleAdminCreateUserToken)
 
+			// User SSH keys
+			r.Get("/users/{id}/keys", s.handleAdminListUserKeys)
+			r.Post("/users/{id}/keys", s.handleAdminCreateUserKey)
+			r.Delete("/users/{id}/keys/{keyID}", s.handleAdminDeleteUserKey)
+
 			// User namespace grants
 			r.Post("/users/{id}/namespace-grants", s.handleAdminCreateUserNamespaceGrant)
 			r.Get("/users/{id}/namespace-grants", s.handleAdminListUserNamespaceGrants)
@@ -102,11 +159,26 @@ func (s *Server) setupRoutes() {
 
 			// Namespaces
 			r.Get("/namespaces", s.handleListNamespaces)
+			r.Get("/namespaces/{name}/usage", s.handleGetNamespaceUsage)
+
+			// Current user's SSH keys
+			r.Get("/user/keys", s.handleListUserKeys)
+			r.Post("/user/keys", s.handleCreateUserKey)
+			r.Delete("/user/keys/{keyID}", s.handleDeleteUserKey)
+
+			// Current user's tokens
+			r.Get("/user/tokens", s.handleListOwnTokens)
+			r.Post("/user/tokens", s.handleCreateOwnToken)
+			r.Delete("/user/tokens/{tokenID}", s.handleDeleteOwnToken)
+
+			// Device logins the current user approves
+			r.Post("/auth/device/approve", s.handleApproveDeviceLogin)
 
 			// Namespace-scoped admin routes (requires namespace:admin)
 			r.Patch("/namespaces/{name}", s.handleUpdateNamespace)
 			r.Delete("/namespaces/{name}", s.handleDeleteNamespaceScoped)
 			r.Get("/namespaces/{name}/grants", s.handleListNamespaceGrants)
+			r.Route("/namespaces/{name}/hooks", s.webhookRoutes(s.requireNamespaceWebhookScope))
 
 			// Repos
 			r.Get("/repos", s.handleListRepos)
@@ -118,6 +190,60 @@ func (s *Server) setupRoutes() {
 			r.Patch("/repos/{id}/refs/{refType}/*", s.handleUpdateRef)
 			r.Delete("/repos/{id}/refs/{refType}/*", s.handleDeleteRef)
 			r.Put("/repos/{id}/default-branch", s.handleSetDefaultBranch)
+			r.Post("/repos/{id}/merges", s.handleCreateMerge)
+			r.Get("/repos/{id}/events", s.handleListPushEvents)
+
+			// File contents
+			r.Post("/repos/{id}/contents", s.handleCommitFiles)
+			r.Put("/repos/{id}/contents/*", s.handlePutContent)
+			r.Delete("/repos/{id}/contents/*", s.handleDeleteContent)
+
+			// Pull mirror
+			r.Put("/repos/{id}/mirror", s.handleSetRepoMirror)
+			r.Delete("/repos/{id}/mirror", s.handleDeleteRepoMirror)
+			r.Post("/repos/{id}/mirror/sync", s.handleSyncRepoMirror)
+
+			// Push mirrors
+			r.Get("/repos/{id}/mirrors", s.handleListPushMirrors)
+			r.Post("/repos/{id}/mirrors", s.handleCreatePushMirror)
+			r.Delete("/repos/{id}/mirrors/{mirrorID}", s.handleDeletePushMirror)
+			r.Post("/repos/{id}/mirrors/sync", s.handleSyncPushMirrors)
+
+			// Deploy keys
+			r.Get("/repos/{id}/deploy-keys", s.handleListDeployKeys)
+			r.Post("/repos/{id}/deploy-keys", s.handleCreateDeployKey)
+			r.Delete("/repos/{id}/deploy-keys/{keyID}", s.handleDeleteDeployKey)
+
+			// Branch protection
+			r.Get("/repos/{id}/protections", s.handleListBranchProtections)
+			r.Post("/repos/{id}/protections", s.handleCreateBranchProtection)
+			r.Patch("/repos/{id}/protections/{ruleID}", s.handleUpdateBranchProtection)
+			r.Delete("/repos/{id}/protections/{ruleID}", s.handleDeleteBranchProtection)
+
+			// Merge requests
+			r.Get("/repos/{id}/merge-requests", s.handleListMergeRequests)
+			r.Post("/repos/{id}/merge-requests", s.handleCreateMergeRequest)
+			r.Get("/repos/{id}/merge-requests/{number}", s.handleGetMergeRequest)
+			r.Patch("/repos/{id}/merge-requests/{number}", s.handleUpdateMergeRequest)
+			r.Get("/repos/{id}/merge-requests/{number}/diff", s.handleGetMergeRequestDiff)
+			r.Post("/repos/{id}/merge-requests/{number}/merge", s.handleMergeMergeRequest)
+
+			// Review threads
+			r.Post("/repos/{id}/review-threads", s.handleCreateReviewThread)
+			r.Patch("/repos/{id}/review-threads/{threadID}", s.handleUpdateReviewThread)
+			r.Post("/repos/{id}/review-threads/{threadID}/comments", s.handleCreateReviewComment)
+			r.Patch("/repos/{id}/review-threads/{threadID}/comments/{commentID}", s.handleUpdateReviewComment)
+			r.Delete("/repos/{id}/review-threads/{threadID}/comments/{commentID}", s.handleDeleteReviewComment)
+
+			// Releases
+			r.Post("/repos/{id}/releases", s.handleCreateRelease)
+			r.Patch("/repos/{id}/releases/{releaseID}", s.handleUpdateRelease)
+			r.Delete("/repos/{id}/releases/{releaseID}", s.handleDeleteRelease)
+			r.Post("/repos/{id}/releases/{releaseID}/assets", s.handleUploadReleaseAsset)
+			r.Delete("/repos/{id}/releases/{releaseID}/assets/{assetID}", s.handleDeleteReleaseAsset)
+
+			// Webhooks
+			r.Route("/repos/{id}/hooks", s.webhookRoutes(s.requireRepoWebhookScope))
 
 			// Repo folders (M2M)
 			r.Get("/repos/{id}/folders", s.handleListRepoFolders)
@@ -142,14 +268,21 @@ func (s *Server) setupRoutes() {
 			r.Get("/repos/{id}/commits/{sha}/diff", s.handleGetCommitDiff)
 			r.Get("/repos/{id}/commits/{sha}", s.handleGetCommit)
 			r.Get("/repos/{id}/compare/{base}...{head}", s.handleCompareCommits)
+			r.Get("/repos/{id}/review-threads", s.handleListReviewThreads)
+			r.Get("/repos/{id}/review-threads/{threadID}", s.handleGetReviewThread)
 			r.Get("/repos/{id}/tree/{ref}/*", s.handleGetTree)
 			r.Get("/repos/{id}/blob/{ref}/*", s.handleGetBlob)
 			r.Get("/repos/{id}/blame/{ref}/*", s.handleGetBlame)
 			r.Get("/repos/{id}/archive/{ref}", s.handleGetArchive)
+			r.Get("/repos/{id}/releases", s.handleListReleases)
+			r.Get("/repos/{id}/releases/tags/*", s.handleGetReleaseByTag)
+			r.Get("/repos/{id}/releases/{releaseID}", s.handleGetRelease)
+			r.Get("/repos/{id}/releases/{releaseID}/assets/{assetID}", s.handleDownloadReleaseAsset)
+			r.Get("/search/code", s.handleSearchCode)
+			r.Get("/namespaces/{name}/commits/search", s.handleSearchNamespaceCommits)
 		})
 	})
 
-	gitHandler := NewGitHTTPHandler(s.store, s.dataDir)
 	s.router.Route("/git", func(r chi.Router) {
 		r.Use(OptionalAuthMiddleware(s.store))
 
@@ -159,7 +292,7 @@ func (s *Server) setupRoutes() {
 			})
 		}
 
-		r.HandleFunc("/*", gitHandler.ServeHTTP)
+		r.HandleFunc("/*", s.gitHandler.ServeHTTP)
 	})
 }
 
@@ -186,5 +319,14 @@ func (s *Server) Start(host string, port int) error {
 		IdleTimeout:       120 * time.Second,
 	}
 
+	go s.webhooks.run(context.Background())
+	go s.mirrors.run(context.Background())
+	go s.pushMirrors.run(context.Background())
+	go s.searchIndex.run(context.Background())
+
+	if s.lfsHandler != nil && s.lfsOpts.GCInterval > 0 {
+		go s.runLFSGC(context.Background(), s.lfsOpts.GCInterval)
+	}
+
 	return server.ListenAndServe()
 }
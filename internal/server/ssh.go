@@ -0,0 +1,477 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+const (
+	sshHostKeyFile          = "ssh_host_ed25519_key"
+	sshUserIDExtension      = "ephemeral-user-id"
+	sshKeyIDExtension       = "ephemeral-key-id"
+	sshDeployKeyIDExtension = "ephemeral-deploy-key-id"
+
+	// sshHandshakeTimeout bounds the key exchange and authentication of a
+	// new connection. sshIdleTimeout closes connections with no traffic.
+	sshHandshakeTimeout = 30 * time.Second
+	sshIdleTimeout      = 2 * time.Minute
+)
+
+// SSHServer serves git upload-pack and receive-pack over SSH.
+// Clients authenticate with public keys registered to a user, or with a
+// repo's deploy keys.
+type SSHServer struct {
+	store       store.Store
+	git         *GitHTTPHandler
+	permissions *store.PermissionChecker
+	config      *ssh.ServerConfig
+
+	handshakeTimeout time.Duration
+	idleTimeout      time.Duration
+}
+
+// NewSSHServer creates an SSH server that shares the store and git handling of
+// the HTTP server. The host key is loaded from the data directory, and generated
+// on first start if it does not exist.
+func NewSSHServer(srv *Server) (*SSHServer, error) {
+	signer, err := loadOrCreateHostKey(filepath.Join(srv.dataDir, sshHostKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("load host key: %w", err)
+	}
+
+	s := &SSHServer{
+		store:       srv.store,
+		git:         srv.gitHandler,
+		permissions: srv.permissions,
+
+		handshakeTimeout: sshHandshakeTimeout,
+		idleTimeout:      sshIdleTimeout,
+	}
+
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: s.authenticate,
+	}
+	s.config.AddHostKey(signer)
+
+	return s, nil
+}
+
+// Start listens on the given host and port and serves SSH connections.
+func (s *SSHServer) Start(host string, port int) error {
+	addr := fmt.Sprintf("%s:%d", host, port)
+	fmt.Printf("Starting SSH server on %s\n", addr)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on the listener until it is closed.
+func (s *SSHServer) Serve(listener net.Listener) error {
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+func (s *SSHServer) authenticate(conn ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
+	key, err := s.store.GetSSHKeyByFingerprint(ssh.FingerprintSHA256(pubKey))
+	if err != nil {
+		slog.Warn("ssh key lookup failed", "error", err)
+		return nil, fmt.Errorf("internal error")
+	}
+	if key == nil {
+		return s.authenticateDeployKey(pubKey)
+	}
+
+	return &ssh.Permissions{
+		Extensions: map[string]string{
+			sshUserIDExtension: key.UserID,
+			sshKeyIDExtension:  key.ID,
+		},
+	}, nil
+}
+
+func (s *SSHServer) authenticateDeployKey(pubKey ssh.PublicKey) (*ssh.Permissions, error) {
+	key, err := s.store.GetDeployKeyByFingerprint(ssh.FingerprintSHA256(pubKey))
+	if err != nil {
+		slog.Warn("deploy key lookup failed", "error", err)
+		return nil, fmt.Errorf("internal error")
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown public key")
+	}
+
+	return &ssh.Permissions{
+		Extensions: map[string]string{
+			sshDeployKeyIDExtension: key.ID,
+		},
+	}, nil
+}
+
+// sshPrincipal is who an SSH connection authenticated as: a user, or a deploy
+// key that reaches only its own repo.
+type sshPrincipal struct {
+	userID    string
+	deployKey *store.DeployKey
+}
+
+// pushActor returns the actor recorded for the principal's pushes.
+func (p sshPrincipal) pushActor() pushActor {
+	if p.deployKey != nil {
+		return pushActor{DeployKeyID: &p.deployKey.ID}
+	}
+	return pushActor{UserID: p.userID}
+}
+
+// checkRepo checks the principal's access to a repo.
+func (p sshPrincipal) checkRepo(permissions *store.PermissionChecker, repo *store.Repo, required store.Permission) (bool, error) {
+	if p.deployKey != nil {
+		return p.deployKey.AllowsRepo(repo, required), nil
+	}
+	return permissions.CheckUserRepoPermission(p.userID, repo, required)
+}
+
+func (s *SSHServer) handleConn(netConn net.Conn) {
+	defer netConn.Close()
+
+	// The handshake deadline is absolute, so a client cannot hold the
+	// connection open by trickling bytes. Afterwards any traffic extends it.
+	idleConn := &sshIdleConn{Conn: netConn, timeout: s.idleTimeout}
+	netConn.SetDeadline(time.Now().Add(s.handshakeTimeout))
+	conn, chans, reqs, err := ssh.NewServerConn(idleConn, s.config)
+	if err != nil {
+		slog.Debug("ssh handshake failed", "remote", netConn.RemoteAddr(), "error", err)
+		return
+	}
+	defer conn.Close()
+	idleConn.active.Store(true)
+	netConn.SetDeadline(time.Now().Add(s.idleTimeout))
+
+	principal, err := s.loadPrincipal(conn.Permissions.Extensions)
+	if err != nil {
+		slog.Warn("ssh principal lookup failed", "error", err)
+		return
+	}
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			slog.Warn("ssh channel accept failed", "error", err)
+			continue
+		}
+
+		go s.handleSession(channel, requests, principal)
+	}
+}
+
+// sshIdleConn closes a connection that has no reads or writes for timeout,
+// once active is set.
+type sshIdleConn struct {
+	net.Conn
+	timeout time.Duration
+	active  atomic.Bool
+}
+
+func (c *sshIdleConn) Read(b []byte) (int, error) {
+	c.extendDeadline()
+	return c.Conn.Read(b)
+}
+
+func (c *sshIdleConn) Write(b []byte) (int, error) {
+	c.extendDeadline()
+	return c.Conn.Write(b)
+}
+
+func (c *sshIdleConn) extendDeadline() {
+	if c.active.Load() {
+		c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+}
+
+// loadPrincipal resolves the key an SSH connection authenticated with and
+// records its use.
+func (s *SSHServer) loadPrincipal(extensions map[string]string) (sshPrincipal, error) {
+	if deployKeyID := extensions[sshDeployKeyIDExtension]; deployKeyID != "" {
+		key, err := s.store.GetDeployKey(deployKeyID)
+		if err != nil {
+			return sshPrincipal{}, err
+		}
+		if key == nil {
+			return sshPrincipal{}, fmt.Errorf("deploy key %s was deleted", deployKeyID)
+		}
+
+		if err := s.store.UpdateDeployKeyLastUsed(key.ID, time.Now()); err != nil {
+			slog.Warn("failed to update deploy key last_used_at", "deploy_key_id", key.ID, "error", err)
+		}
+		return sshPrincipal{deployKey: key}, nil
+	}
+
+	keyID := extensions[sshKeyIDExtension]
+	if err := s.store.UpdateSSHKeyLastUsed(keyID, time.Now()); err != nil {
+		slog.Warn("failed to update ssh key last_used_at", "key_id", keyID, "error", err)
+	}
+	return sshPrincipal{userID: extensions[sshUserIDExtension]}, nil
+}
+
+// handleSession waits for an exec request and runs the requested git service.
+// Shell and pty requests are refused; only git commands are supported.
+func (s *SSHServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request, principal sshPrincipal) {
+	defer channel.Close()
+
+	var env []string
+
+	for req := range requests {
+		switch req.Type {
+		case "env":
+			var payload struct{ Name, Value string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err == nil && payload.Name == "GIT_PROTOCOL" {
+				env = append(env, "GIT_PROTOCOL="+payload.Value)
+			}
+			req.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				return
+			}
+			req.Reply(true, nil)
+
+			status := s.runGitCommand(channel, principal, payload.Command, env)
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		case "shell":
+			req.Reply(true, nil)
+			fmt.Fprintln(channel.Stderr(), "Hi! You've successfully authenticated, but Ephemeral does not provide shell access.")
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{1}))
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// runGitCommand authorizes and executes a git service command, returning its exit status.
+func (s *SSHServer) runGitCommand(channel ssh.Channel, principal sshPrincipal, command string, env []string) uint32 {
+	fail := func(msg string) uint32 {
+		fmt.Fprintf(channel.Stderr(), "ephemeral: %s\n", msg)
+		return 1
+	}
+
+	service, namespaceName, repoName, err := parseSSHGitCommand(command)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	if err := ValidateName(repoName); err != nil {
+		return fail(fmt.Sprintf("invalid repository name: %v", err))
+	}
+	repoName = strings.ToLower(repoName)
+
+	ns, err := s.store.GetNamespaceByName(namespaceName)
+	if err != nil {
+		return fail("internal server error")
+	}
+	if ns == nil {
+		return fail("namespace not found")
+	}
+
+	repo, err := s.store.GetRepo(ns.ID, repoName)
+	if err != nil {
+		return fail("internal server error")
+	}
+
+	isWrite := service == "git-receive-pack"
+
+	if isWrite {
+		if repo == nil {
+			if principal.deployKey != nil {
+				return fail("permission denied: cannot create repository")
+			}
+
+			hasNSWrite, err := s.permissions.CheckUserNamespacePermission(principal.userID, ns.ID, store.PermNamespaceWrite)
+			if err != nil {
+				return fail("internal server error")
+			}
+			if !hasNSWrite {
+				return fail("permission denied: cannot create repository")
+			}
+
+			repo, err = s.git.createRepo(ns.ID, repoName, principal.userID)
+			if err != nil {
+				return fail(fmt.Sprintf("failed to create repository: %v", err))
+			}
+		} else {
+			hasWrite, err := principal.checkRepo(s.permissions, repo, store.PermRepoWrite)
+			if err != nil {
+				return fail("internal server error")
+			}
+			if !hasWrite {
+				return fail("write access denied")
+			}
+			if repo.Mirror != nil {
+				return fail("repository is a mirror and is read-only")
+			}
+		}
+	} else {
+		if repo == nil {
+			return fail("repository not found")
+		}
+
+		if !repo.Public {
+			hasRead, err := principal.checkRepo(s.permissions, repo, store.PermRepoRead)
+			if err != nil {
+				return fail("internal server error")
+			}
+			if !hasRead {
+				return fail("access denied")
+			}
+		}
+	}
+
+	repoPath, err := s.git.getRepoPath(ns.ID, repoName)
+	if err != nil {
+		return fail("failed to resolve repository path")
+	}
+
+	baseEnv := os.Environ()
+	var hooks *pushHooks
+	if isWrite {
+		var policyEnv []string
+		policyEnv, hooks, err = s.git.receivePackEnv(principal.userID, nil, principal.deployKey, repo)
+		defer hooks.close()
+		if err != nil {
+			var qErr *quotaError
+			if errors.As(err, &qErr) {
+				return fail(qErr.Error())
+			}
+			slog.Warn("failed to prepare receive-pack policy", "repo_id", repo.ID, "error", err)
+			return fail("failed to load push policy")
+		}
+		if policyEnv != nil {
+			baseEnv = policyEnv
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, service, repoPath)
+	cmd.Env = append(baseEnv, env...)
+	cmd.Stdin = channel
+	cmd.Stdout = channel
+	cmd.Stderr = channel.Stderr()
+
+	runErr := cmd.Run()
+	if runErr != nil {
+		slog.Warn(service+" error", "error", runErr)
+	}
+
+	if isWrite {
+		s.git.recordReceivePack(repo, repoPath, principal.pushActor(), hooks)
+	}
+
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) && exitErr.ExitCode() > 0 {
+			return uint32(exitErr.ExitCode())
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// parseSSHGitCommand parses an SSH exec command such as
+// git-upload-pack 'namespace/repo.git' into its service and repo path.
+func parseSSHGitCommand(command string) (service, namespace, repo string, err error) {
+	fields := strings.SplitN(strings.TrimSpace(command), " ", 2)
+	if len(fields) != 2 {
+		return "", "", "", fmt.Errorf("unsupported command")
+	}
+
+	service = fields[0]
+	switch service {
+	case "git-upload-pack", "git-receive-pack":
+	default:
+		return "", "", "", fmt.Errorf("unsupported command: %s", service)
+	}
+
+	path := strings.Trim(strings.TrimSpace(fields[1]), `'"`)
+	path = strings.TrimPrefix(path, "/")
+	path = strings.TrimSuffix(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", fmt.Errorf("invalid repository path: expected namespace/repo.git")
+	}
+
+	return service, parts[0], parts[1], nil
+}
+
+// loadOrCreateHostKey reads a PEM-encoded host key, generating an ed25519 key if missing.
+func loadOrCreateHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ssh.ParsePrivateKey(data)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read host key: %w", err)
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate host key: %w", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(privateKey, "ephemeral host key")
+	if err != nil {
+		return nil, fmt.Errorf("marshal host key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create host key directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, fmt.Errorf("write host key: %w", err)
+	}
+
+	return ssh.NewSignerFromKey(privateKey)
+}
@@ -0,0 +1,439 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+func commitSSHTestFile(t *testing.T, work, name, content, message string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(work, name), []byte(content), 0644))
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "-q", "-m", message)
+}
+
+// sshTestKey is a client key pair, with the private key also written to a
+// file for the ssh command.
+type sshTestKey struct {
+	signer ssh.Signer
+	path   string
+}
+
+func newSSHTestKey(t *testing.T) sshTestKey {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	require.NoError(t, err)
+
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+
+	return sshTestKey{signer: signer, path: path}
+}
+
+func (k sshTestKey) fingerprint() string {
+	return ssh.FingerprintSHA256(k.signer.PublicKey())
+}
+
+type sshTestServer struct {
+	t        *testing.T
+	store    store.Store
+	repo     *store.Repo
+	repoPath string
+	addr     string
+}
+
+// newSSHTestServer serves SSH for a store with the acme/app repo, which has
+// one commit on main.
+func newSSHTestServer(t *testing.T) *sshTestServer {
+	t.Helper()
+
+	st, repo := newRepoTestStore(t)
+	srv := NewServer(st, t.TempDir(), ServerOptions{})
+	useTestHooks(t, srv.gitHandler)
+
+	repoPath, err := srv.gitHandler.getRepoPath(repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	require.NoError(t, initBareRepo(repoPath))
+	work := t.TempDir()
+	runGit(t, work, "init", "-q", "-b", "main")
+	commitSSHTestFile(t, work, "README", "one\n", "Initial commit")
+	runGit(t, work, "push", "-q", repoPath, "main")
+
+	sshServer, err := NewSSHServer(srv)
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go sshServer.Serve(listener)
+	t.Cleanup(func() { listener.Close() })
+
+	return &sshTestServer{t: t, store: st, repo: repo, repoPath: repoPath, addr: listener.Addr().String()}
+}
+
+// addUser creates a user with the grant on the acme namespace and an SSH key.
+func (s *sshTestServer) addUser(id string, grant store.Permission) sshTestKey {
+	s.t.Helper()
+
+	now := time.Now()
+	require.NoError(s.t, s.store.CreateNamespace(&store.Namespace{ID: "ns-" + id, Name: id, CreatedAt: now}))
+	require.NoError(s.t, s.store.CreateUser(&store.User{ID: id, PrimaryNamespaceID: "ns-" + id, CreatedAt: now, UpdatedAt: now}))
+	if grant != 0 {
+		require.NoError(s.t, s.store.UpsertNamespaceGrant(&store.NamespaceGrant{
+			UserID: id, NamespaceID: s.repo.NamespaceID, AllowBits: grant, CreatedAt: now, UpdatedAt: now,
+		}))
+	}
+
+	key := newSSHTestKey(s.t)
+	require.NoError(s.t, s.store.CreateSSHKey(&store.SSHKey{
+		ID:          id + "-key",
+		UserID:      id,
+		KeyType:     key.signer.PublicKey().Type(),
+		Fingerprint: key.fingerprint(),
+		PublicKey:   string(ssh.MarshalAuthorizedKey(key.signer.PublicKey())),
+		CreatedAt:   now,
+	}))
+	return key
+}
+
+// addDeployKey creates an SSH deploy key for the repo.
+func (s *sshTestServer) addDeployKey(id string, readOnly bool) sshTestKey {
+	s.t.Helper()
+
+	key := newSSHTestKey(s.t)
+	keyType := key.signer.PublicKey().Type()
+	fingerprint := key.fingerprint()
+	publicKey := string(ssh.MarshalAuthorizedKey(key.signer.PublicKey()))
+	require.NoError(s.t, s.store.CreateDeployKey(&store.DeployKey{
+		ID:          id,
+		RepoID:      s.repo.ID,
+		Name:        id,
+		ReadOnly:    readOnly,
+		KeyType:     &keyType,
+		Fingerprint: &fingerprint,
+		PublicKey:   &publicKey,
+		CreatedAt:   time.Now(),
+	}))
+	return key
+}
+
+// git runs a git command that reaches the server with the key, returning its
+// combined output.
+func (s *sshTestServer) git(key sshTestKey, dir string, args ...string) (string, error) {
+	s.t.Helper()
+
+	_, port, err := net.SplitHostPort(s.addr)
+	require.NoError(s.t, err)
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		fmt.Sprintf("GIT_SSH_COMMAND=ssh -F /dev/null -i %s -p %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o LogLevel=ERROR", key.path, port),
+	)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func (s *sshTestServer) url(repo string) string {
+	_, port, err := net.SplitHostPort(s.addr)
+	require.NoError(s.t, err)
+	return "ssh://git@127.0.0.1:" + port + "/acme/" + repo + ".git"
+}
+
+// dial opens an SSH connection authenticated with the key.
+func (s *sshTestServer) dial(key sshTestKey) (*ssh.Client, error) {
+	return ssh.Dial("tcp", s.addr, &ssh.ClientConfig{
+		User:            "git",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key.signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         10 * time.Second,
+	})
+}
+
+func (s *sshTestServer) session(key sshTestKey) *ssh.Session {
+	s.t.Helper()
+
+	client, err := s.dial(key)
+	require.NoError(s.t, err)
+	s.t.Cleanup(func() { client.Close() })
+
+	session, err := client.NewSession()
+	require.NoError(s.t, err)
+	s.t.Cleanup(func() { session.Close() })
+	return session
+}
+
+func requireSSHExitStatus(t *testing.T, err error, status int) {
+	t.Helper()
+
+	var exitErr *ssh.ExitError
+	require.True(t, errors.As(err, &exitErr), "expected exit status %d, got %v", status, err)
+	assert.Equal(t, status, exitErr.ExitStatus())
+}
+
+func TestSSHServer_Auth(t *testing.T) {
+	s := newSSHTestServer(t)
+	user := s.addUser("user-1", store.DefaultNamespaceGrant())
+	deployKey := s.addDeployKey("deploy-1", true)
+
+	t.Run("accepts registered user keys", func(t *testing.T) {
+		client, err := s.dial(user)
+		require.NoError(t, err)
+		client.Close()
+
+		require.Eventually(t, func() bool {
+			key, err := s.store.GetSSHKeyByFingerprint(user.fingerprint())
+			return err == nil && key.LastUsedAt != nil
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("accepts deploy keys", func(t *testing.T) {
+		client, err := s.dial(deployKey)
+		require.NoError(t, err)
+		client.Close()
+	})
+
+	t.Run("rejects unknown keys", func(t *testing.T) {
+		_, err := s.dial(newSSHTestKey(t))
+		assert.ErrorContains(t, err, "unable to authenticate")
+	})
+}
+
+func TestSSHServer_Git(t *testing.T) {
+	s := newSSHTestServer(t)
+	writer := s.addUser("writer", store.DefaultNamespaceGrant())
+	reader := s.addUser("reader", store.ExpandImplied(store.PermRepoRead))
+	stranger := s.addUser("stranger", 0)
+	readOnlyDeployKey := s.addDeployKey("deploy-ro", true)
+
+	t.Run("clones and pushes", func(t *testing.T) {
+		work := filepath.Join(t.TempDir(), "app")
+		out, err := s.git(writer, "", "clone", "-q", s.url("app"), work)
+		require.NoError(t, err, out)
+
+		commitSSHTestFile(t, work, "pushed.txt", "pushed\n", "Pushed change")
+		out, err = s.git(writer, work, "push", "-q", "origin", "main")
+		require.NoError(t, err, out)
+
+		head, err := exec.Command("git", "-C", work, "rev-parse", "HEAD").Output()
+		require.NoError(t, err)
+		remote, err := exec.Command("git", "-C", s.repoPath, "rev-parse", "main").Output()
+		require.NoError(t, err)
+		assert.Equal(t, string(head), string(remote))
+
+		events, err := s.store.ListRepoPushEvents(s.repo.ID, "", 10)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "refs/heads/main", events[0].Ref)
+		assert.Equal(t, "writer", *events[0].UserID)
+	})
+
+	t.Run("creates repositories on push", func(t *testing.T) {
+		work := t.TempDir()
+		runGit(t, work, "init", "-q", "-b", "main")
+		commitSSHTestFile(t, work, "README", "new\n", "Initial commit")
+
+		out, err := s.git(writer, work, "push", "-q", s.url("new"), "main")
+		require.NoError(t, err, out)
+
+		repo, err := s.store.GetRepo(s.repo.NamespaceID, "new")
+		require.NoError(t, err)
+		require.NotNil(t, repo)
+		assert.False(t, repo.Public)
+	})
+
+	t.Run("denies reads without access", func(t *testing.T) {
+		out, err := s.git(stranger, "", "clone", "-q", s.url("app"), filepath.Join(t.TempDir(), "app"))
+		assert.Error(t, err)
+		assert.Contains(t, out, "ephemeral: access denied")
+
+		out, err = s.git(stranger, "", "clone", "-q", s.url("missing"), filepath.Join(t.TempDir(), "missing"))
+		assert.Error(t, err)
+		assert.Contains(t, out, "ephemeral: repository not found")
+	})
+
+	t.Run("denies writes without access", func(t *testing.T) {
+		work := filepath.Join(t.TempDir(), "app")
+		out, err := s.git(reader, "", "clone", "-q", s.url("app"), work)
+		require.NoError(t, err, out)
+		commitSSHTestFile(t, work, "denied.txt", "denied\n", "Denied change")
+
+		out, err = s.git(reader, work, "push", "-q", "origin", "main")
+		assert.Error(t, err)
+		assert.Contains(t, out, "ephemeral: write access denied")
+
+		out, err = s.git(reader, work, "push", "-q", s.url("reader-new"), "main")
+		assert.Error(t, err)
+		assert.Contains(t, out, "ephemeral: permission denied: cannot create repository")
+
+		repo, err := s.store.GetRepo(s.repo.NamespaceID, "reader-new")
+		require.NoError(t, err)
+		assert.Nil(t, repo)
+	})
+
+	t.Run("limits deploy keys to their access", func(t *testing.T) {
+		work := filepath.Join(t.TempDir(), "app")
+		out, err := s.git(readOnlyDeployKey, "", "clone", "-q", s.url("app"), work)
+		require.NoError(t, err, out)
+		commitSSHTestFile(t, work, "deploy.txt", "deploy\n", "Deploy change")
+
+		out, err = s.git(readOnlyDeployKey, work, "push", "-q", "origin", "main")
+		assert.Error(t, err)
+		assert.Contains(t, out, "ephemeral: write access denied")
+
+		out, err = s.git(readOnlyDeployKey, "", "clone", "-q", s.url("new"), filepath.Join(t.TempDir(), "new"))
+		assert.Error(t, err)
+		assert.Contains(t, out, "ephemeral: access denied")
+	})
+}
+
+func TestSSHServer_Session(t *testing.T) {
+	s := newSSHTestServer(t)
+	user := s.addUser("user-1", store.DefaultNamespaceGrant())
+
+	t.Run("refuses shells", func(t *testing.T) {
+		session := s.session(user)
+		var stderr bytes.Buffer
+		session.Stderr = &stderr
+
+		require.NoError(t, session.Shell())
+		requireSSHExitStatus(t, session.Wait(), 1)
+		assert.Contains(t, stderr.String(), "does not provide shell access")
+	})
+
+	t.Run("refuses ptys", func(t *testing.T) {
+		session := s.session(user)
+		assert.Error(t, session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}))
+	})
+
+	t.Run("refuses other commands", func(t *testing.T) {
+		for command, message := range map[string]string{
+			"ls -la":                            "ephemeral: unsupported command: ls",
+			"git-upload-archive 'acme/app.git'": "ephemeral: unsupported command: git-upload-archive",
+			"git-upload-pack":                   "ephemeral: unsupported command",
+			"git-upload-pack 'app.git'":         "ephemeral: invalid repository path",
+		} {
+			session := s.session(user)
+			var stderr bytes.Buffer
+			session.Stderr = &stderr
+
+			requireSSHExitStatus(t, session.Run(command), 1)
+			assert.Contains(t, stderr.String(), message, command)
+		}
+	})
+
+	// firstPktLine starts upload-pack and returns the first line it sends,
+	// which shows the protocol version it speaks.
+	firstPktLine := func(t *testing.T, gitProtocol string) string {
+		t.Helper()
+
+		session := s.session(user)
+		if gitProtocol != "" {
+			require.NoError(t, session.Setenv("GIT_PROTOCOL", gitProtocol))
+		}
+		stdout, err := session.StdoutPipe()
+		require.NoError(t, err)
+		require.NoError(t, session.Start("git-upload-pack 'acme/app.git'"))
+
+		r := bufio.NewReader(stdout)
+		header := make([]byte, 4)
+		_, err = io.ReadFull(r, header)
+		require.NoError(t, err)
+		length, err := strconv.ParseUint(string(header), 16, 16)
+		require.NoError(t, err)
+		require.Greater(t, length, uint64(4))
+
+		line := make([]byte, length-4)
+		_, err = io.ReadFull(r, line)
+		require.NoError(t, err)
+		return string(line)
+	}
+
+	t.Run("passes GIT_PROTOCOL through", func(t *testing.T) {
+		assert.Equal(t, "version 2\n", firstPktLine(t, "version=2"))
+		assert.Contains(t, firstPktLine(t, ""), "HEAD")
+	})
+}
+
+func TestSSHServer_Timeouts(t *testing.T) {
+	st, repo := newRepoTestStore(t)
+	srv := NewServer(st, t.TempDir(), ServerOptions{})
+	sshServer, err := NewSSHServer(srv)
+	require.NoError(t, err)
+	sshServer.handshakeTimeout = 200 * time.Millisecond
+	sshServer.idleTimeout = 200 * time.Millisecond
+
+	// serve handles one connection and reports when the server drops it.
+	serve := func() (net.Conn, <-chan struct{}) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+
+		clientConn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { clientConn.Close() })
+		serverConn, err := listener.Accept()
+		require.NoError(t, err)
+
+		done := make(chan struct{})
+		go func() {
+			sshServer.handleConn(serverConn)
+			close(done)
+		}()
+		return clientConn, done
+	}
+
+	t.Run("drops clients that never finish the handshake", func(t *testing.T) {
+		_, done := serve()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection still open after the handshake timeout")
+		}
+	})
+
+	t.Run("drops idle connections", func(t *testing.T) {
+		s := &sshTestServer{t: t, store: st, repo: repo}
+		user := s.addUser("user-1", store.DefaultNamespaceGrant())
+
+		conn, done := serve()
+		clientConn, chans, reqs, err := ssh.NewClientConn(conn, "pipe", &ssh.ClientConfig{
+			User:            "git",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(user.signer)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		})
+		require.NoError(t, err, "the handshake completes within the timeout")
+		client := ssh.NewClient(clientConn, chans, reqs)
+		defer client.Close()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("idle connection still open")
+		}
+	})
+}
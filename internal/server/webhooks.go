@@ -0,0 +1,408 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+// Webhook event names.
+const (
+	WebhookEventPush           = "push"
+	WebhookEventRepoCreate     = "repo.create"
+	WebhookEventRepoRename     = "repo.rename"
+	WebhookEventRepoDelete     = "repo.delete"
+	WebhookEventRepoVisibility = "repo.visibility"
+
+	webhookEventAll = "*"
+)
+
+var webhookEvents = []string{
+	WebhookEventPush,
+	WebhookEventRepoCreate,
+	WebhookEventRepoRename,
+	WebhookEventRepoDelete,
+	WebhookEventRepoVisibility,
+}
+
+const (
+	webhookMaxAttempts      = 6
+	webhookRetryBaseDelay   = 30 * time.Second
+	webhookPollInterval     = 10 * time.Second
+	webhookRequestTimeout   = 10 * time.Second
+	webhookBatchSize        = 20
+	webhookMaxResponseBytes = 4096
+)
+
+// WebhookOptions configures webhook delivery.
+type WebhookOptions struct {
+	// AllowLocal permits deliveries to loopback, private and link-local
+	// addresses. Hook owners could then reach services on the server's
+	// network, so only enable it on trusted servers.
+	AllowLocal bool
+}
+
+var errWebhookAddressNotPublic = errors.New("webhook address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not routable on
+// the internet but not covered by netip.Addr.IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// webhookDispatcher queues events as deliveries in the store and sends them in
+// the background, retrying failed attempts with exponential backoff.
+type webhookDispatcher struct {
+	store  store.Store
+	client *http.Client
+	wake   chan struct{}
+}
+
+func newWebhookDispatcher(st store.Store, opts WebhookOptions) *webhookDispatcher {
+	dialer := &net.Dialer{Timeout: webhookRequestTimeout}
+	if !opts.AllowLocal {
+		dialer.Control = rejectNonPublicAddress
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would be the only address the dialer sees, so none is used.
+	transport.Proxy = nil
+
+	return &webhookDispatcher{
+		store:  st,
+		client: &http.Client{Timeout: webhookRequestTimeout, Transport: transport},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// rejectNonPublicAddress refuses connections to addresses that are not
+// publicly routable. As a net.Dialer Control func it sees the resolved address
+// of every connection, including redirects, so a hook's hostname can't be
+// pointed at an internal address after it is checked.
+func rejectNonPublicAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddr(addr) {
+		return fmt.Errorf("%w: %s", errWebhookAddressNotPublic, addr)
+	}
+	return nil
+}
+
+// isPublicAddr reports whether addr is a globally routable unicast address.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || sharedAddressSpace.Contains(addr) {
+		return false
+	}
+	// 0.0.0.0/8 means "this network" and reaches the local host on Linux.
+	return !addr.Is4() || addr.As4()[0] != 0
+}
+
+type webhookRepository struct {
+	ID        string `json:"id"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Public    bool   `json:"public"`
+}
+
+type webhookPushRef struct {
+	Ref     string `json:"ref"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Created bool   `json:"created"`
+	Deleted bool   `json:"deleted"`
+	Forced  bool   `json:"forced"`
+}
+
+type webhookPushPayload struct {
+	Event       string            `json:"event"`
+	Repository  webhookRepository `json:"repository"`
+	PusherID    string            `json:"pusher_id,omitempty"`
+	DeployKeyID string            `json:"deploy_key_id,omitempty"`
+	Refs        []webhookPushRef  `json:"refs"`
+}
+
+type webhookRepoPayload struct {
+	Event      string            `json:"event"`
+	Repository webhookRepository `json:"repository"`
+	SenderID   *string           `json:"sender_id,omitempty"`
+	OldName    string            `json:"old_name,omitempty"`
+}
+
+func (d *webhookDispatcher) repository(repo *store.Repo) webhookRepository {
+	r := webhookRepository{ID: repo.ID, Name: repo.Name, Public: repo.Public}
+	if ns, err := d.store.GetNamespace(repo.NamespaceID); err == nil && ns != nil {
+		r.Namespace = ns.Name
+	}
+	return r
+}
+
+// emitPush queues a push event for the ref updates of a completed receive-pack.
+func (d *webhookDispatcher) emitPush(repo *store.Repo, actor pushActor, updates []refUpdate) {
+	if d == nil {
+		return
+	}
+
+	refs := make([]webhookPushRef, len(updates))
+	for i, u := range updates {
+		refs[i] = webhookPushRef{
+			Ref:     u.Ref,
+			Before:  u.OldSHA,
+			After:   u.NewSHA,
+			Created: isZeroSHA(u.OldSHA),
+			Deleted: isZeroSHA(u.NewSHA),
+			Forced:  u.Forced,
+		}
+	}
+
+	payload := webhookPushPayload{
+		Event:      WebhookEventPush,
+		Repository: d.repository(repo),
+		PusherID:   actor.UserID,
+		Refs:       refs,
+	}
+	if actor.DeployKeyID != nil {
+		payload.DeployKeyID = *actor.DeployKeyID
+	}
+
+	d.emit(repo, WebhookEventPush, payload)
+}
+
+// emitRepoEvent queues a repo lifecycle event. oldName is only set for renames.
+func (d *webhookDispatcher) emitRepoEvent(event string, repo *store.Repo, senderID *string, oldName string) {
+	if d == nil {
+		return
+	}
+
+	d.emit(repo, event, webhookRepoPayload{
+		Event:      event,
+		Repository: d.repository(repo),
+		SenderID:   senderID,
+		OldName:    oldName,
+	})
+}
+
+// emit creates a pending delivery for every active hook subscribed to the event.
+func (d *webhookDispatcher) emit(repo *store.Repo, event string, payload any) {
+	hooks, err := d.store.ListActiveWebhooksForRepo(repo.ID, repo.NamespaceID)
+	if err != nil {
+		slog.Warn("failed to list webhooks", "repo_id", repo.ID, "error", err)
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Warn("failed to encode webhook payload", "event", event, "error", err)
+		return
+	}
+
+	queued := false
+	for _, hook := range hooks {
+		if !webhookSubscribed(hook, event) {
+			continue
+		}
+
+		if err := d.queue(hook.ID, event, string(body)); err != nil {
+			slog.Warn("failed to queue webhook delivery", "webhook_id", hook.ID, "error", err)
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		d.notify()
+	}
+}
+
+func (d *webhookDispatcher) queue(webhookID, event, payload string) error {
+	now := time.Now()
+	return d.store.CreateWebhookDelivery(&store.WebhookDelivery{
+		ID:            uuid.New().String(),
+		WebhookID:     webhookID,
+		Event:         event,
+		Payload:       payload,
+		Status:        store.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	})
+}
+
+// redeliver queues a fresh copy of a previous delivery.
+func (d *webhookDispatcher) redeliver(delivery *store.WebhookDelivery) (*store.WebhookDelivery, error) {
+	now := time.Now()
+	retry := &store.WebhookDelivery{
+		ID:            uuid.New().String(),
+		WebhookID:     delivery.WebhookID,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        store.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	}
+
+	if err := d.store.CreateWebhookDelivery(retry); err != nil {
+		return nil, err
+	}
+
+	d.notify()
+	return retry, nil
+}
+
+func (d *webhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func webhookSubscribed(hook store.Webhook, event string) bool {
+	return slices.Contains(hook.Events, webhookEventAll) || slices.Contains(hook.Events, event)
+}
+
+// run sends due deliveries until the context is cancelled. Pending deliveries
+// left over from a previous process are picked up on the first poll.
+func (d *webhookDispatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *webhookDispatcher) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := d.store.ListDueWebhookDeliveries(time.Now(), webhookBatchSize)
+		if err != nil {
+			slog.Warn("failed to list due webhook deliveries", "error", err)
+			return
+		}
+
+		for i := range deliveries {
+			if !d.attempt(ctx, &deliveries[i]) {
+				return
+			}
+		}
+
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry on failure.
+// Returns false if the outcome could not be recorded.
+func (d *webhookDispatcher) attempt(ctx context.Context, delivery *store.WebhookDelivery) bool {
+	hook, err := d.store.GetWebhook(delivery.WebhookID)
+	if err != nil {
+		slog.Warn("failed to get webhook", "webhook_id", delivery.WebhookID, "error", err)
+		return false
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = nil
+	delivery.ResponseBody = nil
+	delivery.Error = nil
+
+	if hook == nil || !hook.Active {
+		msg := "webhook is inactive"
+		delivery.Status = store.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.Error = &msg
+	} else if status, body, err := d.send(ctx, hook, delivery); err != nil || status < 200 || status >= 300 {
+		if err != nil {
+			msg := err.Error()
+			delivery.Error = &msg
+		} else {
+			delivery.ResponseStatus = &status
+			delivery.ResponseBody = &body
+		}
+
+		if delivery.Attempts >= webhookMaxAttempts {
+			delivery.Status = store.WebhookDeliveryFailed
+			delivery.NextAttemptAt = nil
+		} else {
+			next := now.Add(webhookRetryDelay(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+	} else {
+		delivery.Status = store.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+		delivery.ResponseStatus = &status
+		delivery.ResponseBody = &body
+	}
+
+	if err := d.store.UpdateWebhookDelivery(delivery); err != nil {
+		slog.Warn("failed to update webhook delivery", "delivery_id", delivery.ID, "error", err)
+		return false
+	}
+	return true
+}
+
+// webhookRetryDelay doubles the wait after every failed attempt.
+func webhookRetryDelay(attempts int) time.Duration {
+	return webhookRetryBaseDelay << (attempts - 1)
+}
+
+func (d *webhookDispatcher) send(ctx context.Context, hook *store.Webhook, delivery *store.WebhookDelivery) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, "", fmt.Errorf("build request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Ephemeral-Webhook")
+	req.Header.Set("X-Ephemeral-Event", delivery.Event)
+	req.Header.Set("X-Ephemeral-Delivery", delivery.ID)
+	if hook.Secret != "" {
+		req.Header.Set("X-Ephemeral-Signature-256", signWebhookPayload(hook.Secret, []byte(delivery.Payload)))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBytes))
+	return resp.StatusCode, string(body), nil
+}
+
+// signWebhookPayload returns the signature header value for a payload:
+// "sha256=" followed by the hex HMAC-SHA256 of the body keyed by the hook secret.
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/store"
+)
+
+func newRepoTestStore(t *testing.T) (*store.SQLiteStore, *store.Repo) {
+	t.Helper()
+
+	st, err := store.NewSQLiteStore(":memory:")
+	require.NoError(t, err)
+	require.NoError(t, st.Initialize())
+	t.Cleanup(func() { st.Close() })
+
+	now := time.Now()
+	require.NoError(t, st.CreateNamespace(&store.Namespace{ID: "ns-1", Name: "acme", CreatedAt: now}))
+
+	repo := &store.Repo{ID: "repo-1", NamespaceID: "ns-1", Name: "app", CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, st.CreateRepo(repo))
+
+	return st, repo
+}
+
+// newRefAPITestServer returns a server whose repo has a main branch and a
+// feature branch one commit ahead of it, and a token that can write to it.
+func newRefAPITestServer(t *testing.T) (*Server, *store.SQLiteStore, *store.Repo, string) {
+	t.Helper()
+
+	st, repo := newRepoTestStore(t)
+	now := time.Now()
+	require.NoError(t, st.CreateUser(&store.User{ID: "user-1", PrimaryNamespaceID: repo.NamespaceID, CreatedAt: now, UpdatedAt: now}))
+	require.NoError(t, st.UpsertNamespaceGrant(&store.NamespaceGrant{
+		UserID: "user-1", NamespaceID: repo.NamespaceID, AllowBits: store.DefaultNamespaceGrant(), CreatedAt: now, UpdatedAt: now,
+	}))
+	token, _, err := st.GenerateUserToken("user-1", nil, nil, nil)
+	require.NoError(t, err)
+
+	srv := NewServer(st, t.TempDir(), ServerOptions{})
+	repoPath, err := srv.gitHandler.getRepoPath(repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	require.NoError(t, initBareRepo(repoPath))
+
+	work := t.TempDir()
+	runGit(t, work, "init", "-q", "-b", "main")
+	commitMergeTestFile(t, work, "README", "one\n", "Initial commit")
+	runGit(t, work, "push", "-q", repoPath, "main")
+	commitMergeTestFile(t, work, "README", "two\n", "Feature")
+	runGit(t, work, "push", "-q", repoPath, "main:feature")
+
+	return srv, st, repo, token
+}
+
+// serveAs makes an API request to srv with a bearer token.
+func serveAs(srv *Server, token, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWebhookDispatcher_SignedDelivery(t *testing.T) {
+	st, repo := newRepoTestStore(t)
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan received, 1)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Clone(), body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	now := time.Now()
+	require.NoError(t, st.CreateWebhook(&store.Webhook{
+		ID:          "hook-1",
+		NamespaceID: &repo.NamespaceID,
+		URL:         receiver.URL,
+		Secret:      "s3cret",
+		Events:      []string{WebhookEventPush},
+		Active:      true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}))
+
+	d := newWebhookDispatcher(st, WebhookOptions{AllowLocal: true})
+	d.emitRepoEvent(WebhookEventRepoCreate, repo, nil, "")
+	d.emitPush(repo, pushActor{UserID: "user-1"}, []refUpdate{{
+		OldSHA: "0000000000000000000000000000000000000000",
+		NewSHA: "1111111111111111111111111111111111111111",
+		Ref:    "refs/heads/main",
+	}})
+	d.deliverDue(context.Background())
+
+	req := <-got
+	assert.Equal(t, WebhookEventPush, req.header.Get("X-Ephemeral-Event"), "unsubscribed events are not delivered")
+	assert.Equal(t, signWebhookPayload("s3cret", req.body), req.header.Get("X-Ephemeral-Signature-256"))
+
+	var payload webhookPushPayload
+	require.NoError(t, json.Unmarshal(req.body, &payload))
+	assert.Equal(t, "acme", payload.Repository.Namespace)
+	require.Len(t, payload.Refs, 1)
+	assert.True(t, payload.Refs[0].Created)
+
+	deliveries, err := st.ListWebhookDeliveries("hook-1", "", 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, store.WebhookDeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, http.StatusNoContent, *deliveries[0].ResponseStatus)
+}
+
+func TestWebhookDispatcher_RetryWithBackoff(t *testing.T) {
+	st, repo := newRepoTestStore(t)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	now := time.Now()
+	require.NoError(t, st.CreateWebhook(&store.Webhook{
+		ID:        "hook-1",
+		RepoID:    &repo.ID,
+		URL:       receiver.URL,
+		Events:    []string{webhookEventAll},
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}))
+
+	d := newWebhookDispatcher(st, WebhookOptions{AllowLocal: true})
+	d.emitRepoEvent(WebhookEventRepoVisibility, repo, nil, "")
+	d.deliverDue(context.Background())
+
+	deliveries, err := st.ListWebhookDeliveries("hook-1", "", 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+
+	delivery := deliveries[0]
+	assert.Equal(t, store.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, *delivery.ResponseStatus)
+	require.NotNil(t, delivery.NextAttemptAt)
+	assert.True(t, delivery.NextAttemptAt.After(time.Now()), "retry is scheduled in the future")
+
+	due, err := st.ListDueWebhookDeliveries(time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due, "delivery is not retried before its backoff expires")
+
+	// Exhaust the remaining attempts.
+	for delivery.Status == store.WebhookDeliveryPending {
+		d.attempt(context.Background(), &delivery)
+	}
+	assert.Equal(t, store.WebhookDeliveryFailed, delivery.Status)
+	assert.Equal(t, webhookMaxAttempts, delivery.Attempts)
+	assert.Nil(t, delivery.NextAttemptAt)
+}
+
+func TestWebhookDispatcher_RejectsLocalAddresses(t *testing.T) {
+	st, repo := newRepoTestStore(t)
+
+	hit := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+		w.Write([]byte("internal secret"))
+	}))
+	defer receiver.Close()
+
+	now := time.Now()
+	require.NoError(t, st.CreateWebhook(&store.Webhook{
+		ID:        "hook-1",
+		RepoID:    &repo.ID,
+		URL:       receiver.URL,
+		Events:    []string{webhookEventAll},
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}))
+
+	d := newWebhookDispatcher(st, WebhookOptions{})
+	d.emitRepoEvent(WebhookEventRepoVisibility, repo, nil, "")
+	d.deliverDue(context.Background())
+
+	deliveries, err := st.ListWebhookDeliveries("hook-1", "", 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+
+	assert.False(t, hit, "receiver is never contacted")
+	assert.Nil(t, deliveries[0].ResponseStatus)
+	assert.Nil(t, deliveries[0].ResponseBody)
+	require.NotNil(t, deliveries[0].Error)
+	assert.Contains(t, *deliveries[0].Error, errWebhookAddressNotPublic.Error())
+}
+
+func TestRefAPI_EmitsPushWebhooks(t *testing.T) {
+	srv, st, repo, token := newRefAPITestServer(t)
+
+	now := time.Now()
+	require.NoError(t, st.CreateWebhook(&store.Webhook{
+		ID:        "hook-1",
+		RepoID:    &repo.ID,
+		URL:       "https://ci.example.com/hook",
+		Events:    []string{WebhookEventPush},
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}))
+
+	repoPath, err := srv.gitHandler.getRepoPath(repo.NamespaceID, repo.Name)
+	require.NoError(t, err)
+	gitRepo, err := git.PlainOpen(repoPath)
+	require.NoError(t, err)
+	main := mergeTestHead(t, gitRepo, "main")
+	feature := mergeTestHead(t, gitRepo, "feature")
+
+	base := "/api/v1/repos/" + repo.ID + "/refs"
+	rec := serveAs(srv, token, http.MethodPost, base, `{"name":"topic","type":"branch","target":"main"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = serveAs(srv, token, http.MethodPatch, base+"/branch/feature", `{"target":"main"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = serveAs(srv, token, http.MethodPatch, base+"/branch/topic", `{"new_name":"renamed"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = serveAs(srv, token, http.MethodDelete, base+"/branch/renamed", "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	deliveries, err := st.ListWebhookDeliveries("hook-1", "", 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 4, "one push delivery per ref API change")
+
+	var refs []webhookPushRef
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		assert.Equal(t, WebhookEventPush, deliveries[i].Event)
+		var payload webhookPushPayload
+		require.NoError(t, json.Unmarshal([]byte(deliveries[i].Payload), &payload))
+		assert.Equal(t, "user-1", payload.PusherID)
+		refs = append(refs, payload.Refs...)
+	}
+
+	zero := strings.Repeat("0", 40)
+	assert.Equal(t, []webhookPushRef{
+		{Ref: "refs/heads/topic", Before: zero, After: main, Created: true},
+		{Ref: "refs/heads/feature", Before: feature, After: main, Forced: true},
+		{Ref: "refs/heads/topic", Before: main, After: zero, Deleted: true},
+		{Ref: "refs/heads/renamed", Before: zero, After: main, Created: true},
+		{Ref: "refs/heads/renamed", Before: main, After: zero, Deleted: true},
+	}, refs)
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.public, isPublicAddr(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
@@ -4,3 +4,12 @@ import "errors"
 
 var ErrTokenLookupCollision = errors.New("token lookup collision")
 var ErrPrimaryNamespaceGrant = errors.New("cannot grant other users access to a primary namespace")
+var ErrDuplicateSSHKey = errors.New("ssh key already registered")
+var ErrDuplicateBranchProtection = errors.New("branch protection pattern already exists")
+var ErrDuplicateLFSLock = errors.New("path is already locked")
+var ErrDuplicatePushMirror = errors.New("push mirror URL already exists")
+var ErrDuplicateMergeRequest = errors.New("an open merge request already exists for these branches")
+var ErrDuplicateRelease = errors.New("a release already exists for this tag")
+var ErrDuplicateReleaseAsset = errors.New("release already has an asset with this name")
+var ErrDuplicateUserCode = errors.New("user code already in use")
+var ErrDuplicateNamespace = errors.New("namespace name or external ID already in use")
@@ -16,6 +16,61 @@ func (s *SQLiteStore) Initialize() error {
 		return fmt.Errorf("create schema: %w", err)
 	}
 
+	if err := s.addMissingColumns(); err != nil {
+		return fmt.Errorf("add missing columns: %w", err)
+	}
+
+	if _, err := s.db.Exec(addedIndexes); err != nil {
+		return fmt.Errorf("create added indexes: %w", err)
+	}
+
+	return nil
+}
+
+// addedColumns are columns added to tables after their first release.
+// createSchema skips tables that already exist, so databases created before a
+// column was added get it here.
+var addedColumns = []struct{ table, column, definition string }{
+	{"repos", "mirror_url", "TEXT"},
+	{"repos", "mirror_interval_seconds", "INTEGER"},
+	{"repos", "mirror_credentials", "TEXT"},
+	{"repos", "mirror_status", "TEXT"},
+	{"repos", "mirror_error", "TEXT"},
+	{"repos", "mirror_last_sync_at", "TIMESTAMP"},
+	{"repos", "mirror_next_sync_at", "TIMESTAMP"},
+	{"tokens", "scope_bits", "INTEGER"},
+	{"tokens", "scope_repo_ids", "TEXT"},
+	{"tokens", "scope_namespace_ids", "TEXT"},
+	{"tokens", "name", "TEXT"},
+	{"push_events", "deploy_key_id", "TEXT REFERENCES deploy_keys(id) ON DELETE SET NULL"},
+	{"auth_sessions", "user_code", "TEXT"},
+}
+
+// addedIndexes index added columns, so they are created after
+// addMissingColumns, or replace indexes that have changed.
+const addedIndexes = `
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_auth_sessions_user_code ON auth_sessions(user_code);
+	DROP INDEX IF EXISTS idx_namespaces_external;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_namespaces_external_id ON namespaces(external_id);
+`
+
+func (s *SQLiteStore) addMissingColumns() error {
+	for _, c := range addedColumns {
+		var count int
+		err := s.db.QueryRow(
+			"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column,
+		).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("inspect %s: %w", c.table, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return fmt.Errorf("add %s.%s: %w", c.table, c.column, err)
+		}
+	}
 	return nil
 }
 
@@ -71,6 +126,7 @@ func (s *SQLiteStore) createSchema() error {
 		token_hash TEXT NOT NULL,          -- argon2id hash with embedded salt
 		token_lookup TEXT NOT NULL,        -- first 8 chars of ID for fast lookup
 		is_admin BOOLEAN NOT NULL DEFAULT FALSE,  -- admin tokens only access /api/v1/admin/* routes
+		name TEXT,                         -- human-readable label, e.g. "laptop" or "CI"
 
 		-- User binding (required for non-admin tokens, NULL only for admin tokens)
 		user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
@@ -78,7 +134,13 @@ func (s *SQLiteStore) createSchema() error {
 		-- Lifecycle
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		expires_at TIMESTAMP,            -- NULL = never
-		last_used_at TIMESTAMP
+		last_used_at TIMESTAMP,
+
+		-- Scope (scope_bits NULL = the user's full access); the allow-lists
+		-- are comma-separated IDs
+		scope_bits INTEGER,
+		scope_repo_ids TEXT,
+		scope_namespace_ids TEXT
 	);
 
 	-- Folders for organizing repos (flat, no nesting)
@@ -108,6 +170,15 @@ func (s *SQLiteStore) createSchema() error {
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 
+		-- Pull mirror (NULL mirror_url = regular repo)
+		mirror_url TEXT,
+		mirror_interval_seconds INTEGER,
+		mirror_credentials TEXT,        -- name of a server-configured credential
+		mirror_status TEXT,             -- pending, succeeded, failed
+		mirror_error TEXT,
+		mirror_last_sync_at TIMESTAMP,
+		mirror_next_sync_at TIMESTAMP,
+
 		UNIQUE(namespace_id, name)
 	);
 
@@ -134,7 +205,235 @@ func (s *SQLiteStore) createSchema() error {
 		token TEXT,
 		status TEXT NOT NULL DEFAULT 'pending',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		expires_at TIMESTAMP NOT NULL
+		expires_at TIMESTAMP NOT NULL,
+
+		-- Short code a user enters to approve a device login
+		user_code TEXT
+	);
+
+	-- SSH public keys used to authenticate git over SSH
+	CREATE TABLE IF NOT EXISTS ssh_keys (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name TEXT,
+		key_type TEXT NOT NULL,
+		fingerprint TEXT NOT NULL UNIQUE,  -- SHA256 fingerprint, e.g. SHA256:abc...
+		public_key TEXT NOT NULL,          -- authorized_keys format
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP
+	);
+
+	-- Deploy keys grant git access to a single repo without a user. Each is
+	-- either a token (token_* set) or an SSH public key (key_type etc. set).
+	CREATE TABLE IF NOT EXISTS deploy_keys (
+		id TEXT PRIMARY KEY,
+		repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		read_only BOOLEAN NOT NULL DEFAULT TRUE,
+		token_hash TEXT,
+		token_lookup TEXT UNIQUE,
+		key_type TEXT,
+		fingerprint TEXT UNIQUE,
+		public_key TEXT,
+		created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP
+	);
+
+	-- Branch protection rules, enforced on push and ref API updates
+	CREATE TABLE IF NOT EXISTS branch_protections (
+		id TEXT PRIMARY KEY,
+		repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+		pattern TEXT NOT NULL,                  -- branch name or glob, e.g. main, release/*
+		block_force_push BOOLEAN NOT NULL DEFAULT FALSE,
+		block_deletion BOOLEAN NOT NULL DEFAULT FALSE,
+		require_linear_history BOOLEAN NOT NULL DEFAULT FALSE,
+		push_permission INTEGER NOT NULL DEFAULT 0,  -- repo permission bit required to push, 0 = repo:write
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+		UNIQUE(repo_id, pattern)
+	);
+
+	-- Outgoing webhooks, registered on a single repo or on every repo in a namespace
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id TEXT PRIMARY KEY,
+		repo_id TEXT REFERENCES repos(id) ON DELETE CASCADE,
+		namespace_id TEXT REFERENCES namespaces(id) ON DELETE CASCADE,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL DEFAULT '',
+		events TEXT NOT NULL,                   -- comma-separated event names, * = all
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+		CHECK ((repo_id IS NULL) != (namespace_id IS NULL))
+	);
+
+	-- Webhook delivery attempts, retried with backoff until they succeed or give up
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id TEXT PRIMARY KEY,
+		webhook_id TEXT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending', -- pending, succeeded, failed
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP,
+		last_attempt_at TIMESTAMP,
+		response_status INTEGER,
+		response_body TEXT,
+		error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Ref updates made by git pushes, kept as an audit log
+	CREATE TABLE IF NOT EXISTS push_events (
+		id TEXT PRIMARY KEY,
+		repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+		ref TEXT NOT NULL,
+		old_sha TEXT NOT NULL,                  -- all zeros when the ref was created
+		new_sha TEXT NOT NULL,                  -- all zeros when the ref was deleted
+		user_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+		token_id TEXT REFERENCES tokens(id) ON DELETE SET NULL,  -- NULL for SSH pushes
+		deploy_key_id TEXT REFERENCES deploy_keys(id) ON DELETE SET NULL,
+		forced BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Git LFS file locks, at most one per path
+	CREATE TABLE IF NOT EXISTS lfs_locks (
+		id TEXT PRIMARY KEY,
+		repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+		path TEXT NOT NULL,
+		owner_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		ref TEXT,                               -- ref the lock was taken on, informational
+		locked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+		UNIQUE(repo_id, path)
+	);
+
+	-- Downstream remotes that every push is replicated to
+	CREATE TABLE IF NOT EXISTS push_mirrors (
+		id TEXT PRIMARY KEY,
+		repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+		url TEXT NOT NULL,
+		credentials TEXT,                       -- name of a server-configured credential
+		status TEXT NOT NULL DEFAULT 'pending', -- pending, succeeded, failed
+		attempts INTEGER NOT NULL DEFAULT 0,    -- failed attempts since the last queued push
+		generation INTEGER NOT NULL DEFAULT 0,  -- bumped whenever a push is queued
+		last_error TEXT,
+		last_sync_at TIMESTAMP,
+		next_attempt_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+		UNIQUE(repo_id, url)
+	);
+
+	-- Commit of each repo's default branch that the code search index reflects
+	CREATE TABLE IF NOT EXISTS search_index_state (
+		repo_id TEXT PRIMARY KEY REFERENCES repos(id) ON DELETE CASCADE,
+		ref TEXT NOT NULL,
+		commit_sha TEXT NOT NULL, -- empty while the default branch has no commits
+		indexed_at TIMESTAMP NOT NULL
+	);
+
+	-- Code search index; trigram tokens make substring matches indexable
+	CREATE VIRTUAL TABLE IF NOT EXISTS search_documents USING fts5(
+		repo_id UNINDEXED,
+		path,
+		blob_sha UNINDEXED,
+		content,
+		tokenize = 'trigram'
+	);
+
+	-- Virtual tables cannot hold foreign keys, so clean up on repo deletion
+	CREATE TRIGGER IF NOT EXISTS search_documents_repo_delete AFTER DELETE ON repos
+	BEGIN
+		DELETE FROM search_documents WHERE repo_id = OLD.id;
+	END;
+
+	-- Proposals to merge one branch of a repo into another
+	CREATE TABLE IF NOT EXISTS merge_requests (
+		id TEXT PRIMARY KEY,
+		repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+		number INTEGER NOT NULL,                -- per-repo sequence, starting at 1
+		title TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		source_branch TEXT NOT NULL,
+		target_branch TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'open',    -- open, merged, closed
+		author_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+		source_sha TEXT,                        -- branch heads when merged or closed
+		target_sha TEXT,
+		merge_strategy TEXT,                    -- merge, squash, rebase
+		merge_commit_sha TEXT,
+		merged_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		merged_at TIMESTAMP,
+		closed_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+		UNIQUE(repo_id, number)
+	);
+
+	-- Review threads: discussions anchored to a line of a diff
+	CREATE TABLE IF NOT EXISTS review_threads (
+		id TEXT PRIMARY KEY,
+		repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+		commit_sha TEXT NOT NULL,               -- head of the diff
+		base_sha TEXT NOT NULL DEFAULT '',      -- base of the diff, empty for a root commit
+		path TEXT NOT NULL,
+		side TEXT NOT NULL,                     -- new (line at commit_sha) or old (line at base_sha)
+		line INTEGER NOT NULL,
+		ref TEXT,                               -- branch whose pushes move the thread
+		original_commit_sha TEXT NOT NULL,
+		original_line INTEGER NOT NULL,
+		outdated BOOLEAN NOT NULL DEFAULT FALSE,
+		resolved BOOLEAN NOT NULL DEFAULT FALSE,
+		resolved_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		resolved_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS review_comments (
+		id TEXT PRIMARY KEY,
+		thread_id TEXT NOT NULL REFERENCES review_threads(id) ON DELETE CASCADE,
+		author_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+		body TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Releases: published tags with notes and downloadable assets
+	CREATE TABLE IF NOT EXISTS releases (
+		id TEXT PRIMARY KEY,
+		repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+		tag_name TEXT NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		notes TEXT NOT NULL DEFAULT '',
+		draft BOOLEAN NOT NULL DEFAULT FALSE,
+		prerelease BOOLEAN NOT NULL DEFAULT FALSE,
+		author_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+		published_at TIMESTAMP,                 -- NULL while a draft
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+		UNIQUE(repo_id, tag_name)
+	);
+
+	CREATE TABLE IF NOT EXISTS release_assets (
+		id TEXT PRIMARY KEY,
+		release_id TEXT NOT NULL REFERENCES releases(id) ON DELETE CASCADE,
+		repo_id TEXT NOT NULL REFERENCES repos(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,                   -- key of the content in release storage
+		uploader_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+		UNIQUE(release_id, name)
 	);
 
 	-- Create indexes
@@ -147,6 +446,23 @@ func (s *SQLiteStore) createSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_repo_grants_user ON user_repo_grants(user_id);
 	CREATE INDEX IF NOT EXISTS idx_users_primary_namespace ON users(primary_namespace_id);
 	CREATE INDEX IF NOT EXISTS idx_auth_sessions_expires ON auth_sessions(expires_at);
+	CREATE INDEX IF NOT EXISTS idx_ssh_keys_user ON ssh_keys(user_id);
+	CREATE INDEX IF NOT EXISTS idx_deploy_keys_repo ON deploy_keys(repo_id);
+	CREATE INDEX IF NOT EXISTS idx_branch_protections_repo ON branch_protections(repo_id);
+	CREATE INDEX IF NOT EXISTS idx_webhooks_repo ON webhooks(repo_id);
+	CREATE INDEX IF NOT EXISTS idx_webhooks_namespace ON webhooks(namespace_id);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries(status, next_attempt_at);
+	CREATE INDEX IF NOT EXISTS idx_push_events_repo ON push_events(repo_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_lfs_locks_repo ON lfs_locks(repo_id, locked_at);
+	CREATE INDEX IF NOT EXISTS idx_push_mirrors_due ON push_mirrors(status, next_attempt_at);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_merge_requests_open ON merge_requests(repo_id, source_branch, target_branch) WHERE status = 'open';
+	CREATE INDEX IF NOT EXISTS idx_review_threads_commit ON review_threads(repo_id, commit_sha);
+	CREATE INDEX IF NOT EXISTS idx_review_threads_ref ON review_threads(repo_id, ref) WHERE ref IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_review_comments_thread ON review_comments(thread_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_releases_repo ON releases(repo_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_release_assets_release ON release_assets(release_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_release_assets_repo ON release_assets(repo_id, sha256);
 	`
 
 	_, err := s.db.Exec(schema)
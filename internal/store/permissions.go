@@ -2,6 +2,7 @@ package store
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -143,6 +144,67 @@ func DefaultNamespaceGrant() Permission {
 	return PermNamespaceWrite | PermRepoAdmin
 }
 
+// TokenScope restricts a token to part of its user's access. The token's
+// effective permissions are the intersection of the scope and the user's
+// grants.
+type TokenScope struct {
+	// Allow is the most the token may do, with implied permissions expanded.
+	// Zero places no limit on permissions.
+	Allow Permission
+	// RepoIDs and NamespaceIDs limit the token to the listed repos and every
+	// repo in the listed namespaces. Both empty places no limit on resources.
+	RepoIDs      []string
+	NamespaceIDs []string
+}
+
+// allows reports whether the scope's permission mask includes required.
+func (s *TokenScope) allows(required Permission) bool {
+	return s.Allow == 0 || ExpandImplied(s.Allow).Has(required)
+}
+
+func (s *TokenScope) limitsResources() bool {
+	return len(s.RepoIDs) > 0 || len(s.NamespaceIDs) > 0
+}
+
+// CoversNamespace reports whether the namespace is in the scope's allow-list.
+// A nil scope covers everything.
+func (s *TokenScope) CoversNamespace(namespaceID string) bool {
+	if s == nil || !s.limitsResources() {
+		return true
+	}
+	return slices.Contains(s.NamespaceIDs, namespaceID)
+}
+
+// CoversRepo reports whether the repo, or its namespace, is in the scope's
+// allow-list. A nil scope covers everything.
+func (s *TokenScope) CoversRepo(repo *Repo) bool {
+	return s.CoversNamespace(repo.NamespaceID) || slices.Contains(s.RepoIDs, repo.ID)
+}
+
+// AllowsNamespace reports whether the scope permits required on a namespace.
+func (s *TokenScope) AllowsNamespace(namespaceID string, required Permission) bool {
+	return s == nil || (s.allows(required) && s.CoversNamespace(namespaceID))
+}
+
+// AllowsRepo reports whether the scope permits required on a repo.
+func (s *TokenScope) AllowsRepo(repo *Repo, required Permission) bool {
+	return s == nil || (s.allows(required) && s.CoversRepo(repo))
+}
+
+// Permission returns what a deploy key may do on its repo.
+func (k *DeployKey) Permission() Permission {
+	if k.ReadOnly {
+		return PermRepoRead
+	}
+	return PermRepoRead | PermRepoWrite
+}
+
+// AllowsRepo reports whether the deploy key permits required on a repo.
+// Deploy keys only reach their own repo and never grant namespace access.
+func (k *DeployKey) AllowsRepo(repo *Repo, required Permission) bool {
+	return k.RepoID == repo.ID && k.Permission().Has(required)
+}
+
 // PermissionChecker provides methods to check token permissions against grants.
 type PermissionChecker struct {
 	store Store
@@ -155,7 +217,7 @@ func NewPermissionChecker(store Store) *PermissionChecker {
 
 // CheckNamespacePermission checks if a token has the required permission for a namespace.
 // For user-bound tokens, it checks user grants; for machine tokens, it checks token grants.
-// Expand allow bits but not deny bits.
+// Expand allow bits but not deny bits. A scoped token is also limited by its scope.
 func (pc *PermissionChecker) CheckNamespacePermission(tokenID, namespaceID string, required Permission) (bool, error) {
 	token, err := pc.store.GetTokenByID(tokenID)
 	if err != nil {
@@ -165,11 +227,17 @@ func (pc *PermissionChecker) CheckNamespacePermission(tokenID, namespaceID strin
 		return false, nil
 	}
 
-	if token.UserID == nil {
+	if token.UserID == nil || !token.Scope.AllowsNamespace(namespaceID, required) {
 		return false, nil
 	}
 
-	grant, err := pc.store.GetNamespaceGrant(*token.UserID, namespaceID)
+	return pc.CheckUserNamespacePermission(*token.UserID, namespaceID, required)
+}
+
+// CheckUserNamespacePermission checks if a user has the required permission for a namespace.
+// Used directly by transports that authenticate a user without a token, such as SSH.
+func (pc *PermissionChecker) CheckUserNamespacePermission(userID, namespaceID string, required Permission) (bool, error) {
+	grant, err := pc.store.GetNamespaceGrant(userID, namespaceID)
 	if err != nil {
 		return false, err
 	}
@@ -187,6 +255,7 @@ func (pc *PermissionChecker) CheckNamespacePermission(tokenID, namespaceID strin
 // CheckRepoPermission checks if a token has the required permission for a repo.
 // For user-bound tokens, it checks user grants; for machine tokens, it checks token grants.
 // Combines namespace and repo grants, expanding allow bits but not deny bits.
+// A scoped token is also limited by its scope.
 func (pc *PermissionChecker) CheckRepoPermission(tokenID string, repo *Repo, required Permission) (bool, error) {
 	token, err := pc.store.GetTokenByID(tokenID)
 	if err != nil {
@@ -196,13 +265,19 @@ func (pc *PermissionChecker) CheckRepoPermission(tokenID string, repo *Repo, req
 		return false, nil
 	}
 
-	if token.UserID == nil {
+	if token.UserID == nil || !token.Scope.AllowsRepo(repo, required) {
 		return false, nil
 	}
 
+	return pc.CheckUserRepoPermission(*token.UserID, repo, required)
+}
+
+// CheckUserRepoPermission checks if a user has the required permission for a repo.
+// Combines namespace and repo grants, expanding allow bits but not deny bits.
+func (pc *PermissionChecker) CheckUserRepoPermission(userID string, repo *Repo, required Permission) (bool, error) {
 	var allowNS, denyNS, allowRepo, denyRepo Permission
 
-	nsGrant, err := pc.store.GetNamespaceGrant(*token.UserID, repo.NamespaceID)
+	nsGrant, err := pc.store.GetNamespaceGrant(userID, repo.NamespaceID)
 	if err != nil {
 		return false, err
 	}
@@ -211,7 +286,7 @@ func (pc *PermissionChecker) CheckRepoPermission(tokenID string, repo *Repo, req
 		denyNS = nsGrant.DenyBits
 	}
 
-	repoGrant, err := pc.store.GetRepoGrant(*token.UserID, repo.ID)
+	repoGrant, err := pc.store.GetRepoGrant(userID, repo.ID)
 	if err != nil {
 		return false, err
 	}
@@ -242,6 +317,8 @@ func (pc *PermissionChecker) HasAnyRepoGrants(tokenID, namespaceID string) (bool
 
 // CanAccessNamespace checks if a token can access a namespace at all.
 // Returns true if the user has a namespace grant OR has any repo grants in the namespace.
+// A token scoped to other namespaces can only access the namespace through
+// its scoped repos.
 func (pc *PermissionChecker) CanAccessNamespace(tokenID, namespaceID string) (bool, error) {
 	token, err := pc.store.GetTokenByID(tokenID)
 	if err != nil {
@@ -251,6 +328,22 @@ func (pc *PermissionChecker) CanAccessNamespace(tokenID, namespaceID string) (bo
 		return false, nil
 	}
 
+	if !token.Scope.CoversNamespace(namespaceID) {
+		for _, repoID := range token.Scope.RepoIDs {
+			repo, err := pc.store.GetRepoByID(repoID)
+			if err != nil {
+				return false, err
+			}
+			if repo == nil || repo.NamespaceID != namespaceID {
+				continue
+			}
+			if ok, err := pc.CheckUserRepoPermission(*token.UserID, repo, PermRepoRead); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+
 	grant, err := pc.store.GetNamespaceGrant(*token.UserID, namespaceID)
 	if err != nil {
 		return false, err
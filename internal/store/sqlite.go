@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -46,21 +47,98 @@ func (s *SQLiteStore) Close() error {
 	return s.db.Close()
 }
 
+// Backup writes a consistent copy of the database to dstPath using SQLite's
+// online backup API, so it is safe to run while the server is writing.
+func (s *SQLiteStore) Backup(ctx context.Context, dstPath string) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		backuper, ok := driverConn.(interface {
+			NewBackup(dstURI string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return fmt.Errorf("driver does not support online backup")
+		}
+
+		backup, err := backuper.NewBackup(dstPath)
+		if err != nil {
+			return fmt.Errorf("start backup: %w", err)
+		}
+
+		// Copying every page in one step holds a single read transaction,
+		// so the copy reflects one point in time.
+		if _, err := backup.Step(-1); err != nil {
+			backup.Finish()
+			return fmt.Errorf("copy database: %w", err)
+		}
+		if err := backup.Finish(); err != nil {
+			return fmt.Errorf("finish backup: %w", err)
+		}
+		return nil
+	})
+}
+
+// CheckIntegrity runs SQLite's integrity check, returning an error describing
+// the first problems found if the database is corrupt.
+func (s *SQLiteStore) CheckIntegrity() error {
+	rows, err := s.db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("scan integrity check: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("database is corrupt: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
 // CreateToken creates a new token.
 func (s *SQLiteStore) CreateToken(token *Token) error {
 	query := `
-		INSERT INTO tokens (id, token_hash, token_lookup, is_admin, user_id, created_at, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO tokens (id, token_hash, token_lookup, is_admin, user_id, name, created_at, expires_at,
+			scope_bits, scope_repo_ids, scope_namespace_ids)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	var scopeBits sql.NullInt64
+	var scopeRepoIDs, scopeNamespaceIDs sql.NullString
+	if token.Scope != nil {
+		scopeBits = sql.NullInt64{Int64: int64(token.Scope.Allow), Valid: true}
+		scopeRepoIDs = sql.NullString{String: strings.Join(token.Scope.RepoIDs, ","), Valid: true}
+		scopeNamespaceIDs = sql.NullString{String: strings.Join(token.Scope.NamespaceIDs, ","), Valid: true}
+	}
+
 	_, err := s.db.Exec(query,
 		token.ID,
 		token.TokenHash,
 		token.TokenLookup,
 		token.IsAdmin,
 		ToNullString(token.UserID),
+		ToNullString(token.Name),
 		token.CreatedAt,
 		ToNullTime(token.ExpiresAt),
+		scopeBits,
+		scopeRepoIDs,
+		scopeNamespaceIDs,
 	)
 
 	if err != nil {
@@ -73,6 +151,10 @@ func (s *SQLiteStore) CreateToken(token *Token) error {
 }
 
 func isTokenLookupCollision(err error) bool {
+	return isUniqueConstraintError(err)
+}
+
+func isUniqueConstraintError(err error) bool {
 	var sqliteErr *sqlite.Error
 	if !errors.As(err, &sqliteErr) {
 		return false
@@ -84,8 +166,7 @@ func isTokenLookupCollision(err error) bool {
 // GetTokenByLookup retrieves a token by lookup key.
 func (s *SQLiteStore) GetTokenByLookup(lookup string) (*Token, error) {
 	query := `
-		SELECT id, token_hash, token_lookup, is_admin, user_id,
-			   created_at, expires_at, last_used_at
+		SELECT ` + tokenColumns + `
 		FROM tokens
 		WHERE token_lookup = ?
 	`
@@ -107,11 +188,14 @@ func (s *SQLiteStore) CreateRepo(repo *Repo) error {
 	query := `
 		INSERT INTO repos (
 			id, namespace_id, name, description, public,
-			size_bytes, last_push_at, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			size_bytes, last_push_at, created_at, updated_at,
+			mirror_url, mirror_interval_seconds, mirror_credentials,
+			mirror_status, mirror_next_sync_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := s.db.Exec(query,
+	mirror := mirrorConfigArgs(repo.Mirror)
+	_, err := s.db.Exec(query, append([]any{
 		repo.ID,
 		repo.NamespaceID,
 		repo.Name,
@@ -121,7 +205,7 @@ func (s *SQLiteStore) CreateRepo(repo *Repo) error {
 		ToNullTime(repo.LastPushAt),
 		repo.CreatedAt,
 		repo.UpdatedAt,
-	)
+	}, mirror...)...)
 	if err != nil {
 		return fmt.Errorf("insert repo: %w", err)
 	}
@@ -130,30 +214,46 @@ func (s *SQLiteStore) CreateRepo(repo *Repo) error {
 
 // GetRepo retrieves a repository by namespace and name.
 func (s *SQLiteStore) GetRepo(namespaceID, name string) (*Repo, error) {
-	query := `
-		SELECT id, namespace_id, name, description, public,
-			   size_bytes, last_push_at, created_at, updated_at
-		FROM repos
-		WHERE namespace_id = ? AND name = ?
+	query := `SELECT ` + repoColumns + `
+		FROM repos r
+		WHERE r.namespace_id = ? AND r.name = ?
 	`
 	return s.scanRepo(s.db.QueryRow(query, namespaceID, name))
 }
 
 // GetRepoByID retrieves a repository by ID.
 func (s *SQLiteStore) GetRepoByID(id string) (*Repo, error) {
-	query := `
-		SELECT id, namespace_id, name, description, public,
-			   size_bytes, last_push_at, created_at, updated_at
-		FROM repos
-		WHERE id = ?
+	query := `SELECT ` + repoColumns + `
+		FROM repos r
+		WHERE r.id = ?
 	`
 	return s.scanRepo(s.db.QueryRow(query, id))
 }
 
+// repoColumns selects a repo aliased as r, in the order scanRepoRow reads it.
+const repoColumns = `r.id, r.namespace_id, r.name, r.description, r.public,
+	r.size_bytes, r.last_push_at, r.created_at, r.updated_at,
+	r.mirror_url, r.mirror_interval_seconds, r.mirror_credentials,
+	r.mirror_status, r.mirror_error, r.mirror_last_sync_at, r.mirror_next_sync_at`
+
 func (s *SQLiteStore) scanRepo(row *sql.Row) (*Repo, error) {
+	repo, err := scanRepoRow(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan repo: %w", err)
+	}
+	return repo, nil
+}
+
+func scanRepoRow(row rowScanner) (*Repo, error) {
 	var repo Repo
 	var description sql.NullString
 	var lastPushAt sql.NullTime
+	var mirrorURL, mirrorCredentials, mirrorStatus, mirrorError sql.NullString
+	var mirrorInterval sql.NullInt64
+	var mirrorLastSyncAt, mirrorNextSyncAt sql.NullTime
 
 	err := row.Scan(
 		&repo.ID,
@@ -165,20 +265,49 @@ func (s *SQLiteStore) scanRepo(row *sql.Row) (*Repo, error) {
 		&lastPushAt,
 		&repo.CreatedAt,
 		&repo.UpdatedAt,
+		&mirrorURL,
+		&mirrorInterval,
+		&mirrorCredentials,
+		&mirrorStatus,
+		&mirrorError,
+		&mirrorLastSyncAt,
+		&mirrorNextSyncAt,
 	)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, nil
-	}
 	if err != nil {
-		return nil, fmt.Errorf("scan repo: %w", err)
+		return nil, err
 	}
 
 	repo.Description = FromNullString(description)
 	repo.LastPushAt = FromNullTime(lastPushAt)
 
+	if mirrorURL.Valid {
+		repo.Mirror = &RepoMirror{
+			URL:             mirrorURL.String,
+			IntervalSeconds: int(mirrorInterval.Int64),
+			Credentials:     FromNullString(mirrorCredentials),
+			Status:          mirrorStatus.String,
+			LastError:       FromNullString(mirrorError),
+			LastSyncAt:      FromNullTime(mirrorLastSyncAt),
+			NextSyncAt:      FromNullTime(mirrorNextSyncAt),
+		}
+	}
+
 	return &repo, nil
 }
 
+// scanRepos reads every row of a query that selects repoColumns.
+func scanRepos(rows *sql.Rows) ([]Repo, error) {
+	var repos []Repo
+	for rows.Next() {
+		repo, err := scanRepoRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan repo: %w", err)
+		}
+		repos = append(repos, *repo)
+	}
+	return repos, rows.Err()
+}
+
 // UpdateRepoLastPush updates the last push time for a repository.
 func (s *SQLiteStore) UpdateRepoLastPush(id string, pushTime time.Time) error {
 	query := `
@@ -217,6 +346,91 @@ func (s *SQLiteStore) UpdateRepoSize(id string, sizeBytes int64) error {
 	return nil
 }
 
+// mirrorConfigArgs returns the mirror_url, mirror_interval_seconds,
+// mirror_credentials, mirror_status and mirror_next_sync_at values for a mirror
+// config. A new or changed mirror is pending and due immediately.
+func mirrorConfigArgs(mirror *RepoMirror) []any {
+	if mirror == nil {
+		return []any{nil, nil, nil, nil, nil}
+	}
+	return []any{
+		mirror.URL,
+		mirror.IntervalSeconds,
+		ToNullString(mirror.Credentials),
+		MirrorStatusPending,
+		time.Now(),
+	}
+}
+
+// UpdateRepoMirror sets or, when mirror is nil, removes a repo's pull mirror
+// config. The sync status is reset and the mirror is due for an immediate sync.
+func (s *SQLiteStore) UpdateRepoMirror(id string, mirror *RepoMirror) error {
+	query := `
+		UPDATE repos
+		SET mirror_url = ?, mirror_interval_seconds = ?, mirror_credentials = ?,
+			mirror_status = ?, mirror_next_sync_at = ?,
+			mirror_error = NULL, mirror_last_sync_at = NULL, updated_at = ?
+		WHERE id = ?
+	`
+
+	args := append(mirrorConfigArgs(mirror), time.Now(), id)
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("update repo mirror: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RecordRepoMirrorSync stores the outcome of a mirror sync and schedules the
+// next one. syncErr is nil when the sync succeeded. Repos that stopped being
+// mirrors in the meantime are left untouched.
+func (s *SQLiteStore) RecordRepoMirrorSync(id string, syncedAt, nextSyncAt time.Time, syncErr *string) error {
+	status := MirrorStatusSucceeded
+	if syncErr != nil {
+		status = MirrorStatusFailed
+	}
+
+	query := `
+		UPDATE repos
+		SET mirror_status = ?, mirror_error = ?, mirror_last_sync_at = ?, mirror_next_sync_at = ?
+		WHERE id = ? AND mirror_url IS NOT NULL
+	`
+
+	_, err := s.db.Exec(query, status, ToNullString(syncErr), syncedAt, nextSyncAt, id)
+	if err != nil {
+		return fmt.Errorf("record repo mirror sync: %w", err)
+	}
+	return nil
+}
+
+// ListDueRepoMirrors returns mirror repos whose next sync is at or before now,
+// most overdue first.
+func (s *SQLiteStore) ListDueRepoMirrors(now time.Time, limit int) ([]Repo, error) {
+	query := `SELECT ` + repoColumns + `
+		FROM repos r
+		WHERE r.mirror_url IS NOT NULL AND r.mirror_next_sync_at <= ?
+		ORDER BY r.mirror_next_sync_at
+		LIMIT ?
+	`
+
+	rows, err := s.db.Query(query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query due repo mirrors: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRepos(rows)
+}
+
 // GetNamespace retrieves a namespace by ID.
 func (s *SQLiteStore) GetNamespace(id string) (*Namespace, error) {
 	query := `
@@ -237,6 +451,16 @@ func (s *SQLiteStore) GetNamespaceByName(name string) (*Namespace, error) {
 	return s.scanNamespace(s.db.QueryRow(query, name))
 }
 
+// GetNamespaceByExternalID retrieves the namespace with the given external ID.
+func (s *SQLiteStore) GetNamespaceByExternalID(externalID string) (*Namespace, error) {
+	query := `
+		SELECT id, name, created_at, repo_limit, storage_limit_bytes, external_id
+		FROM namespaces
+		WHERE external_id = ?
+	`
+	return s.scanNamespace(s.db.QueryRow(query, externalID))
+}
+
 func (s *SQLiteStore) scanNamespace(row *sql.Row) (*Namespace, error) {
 	var ns Namespace
 	var repoLimit, storageLimit sql.NullInt64
@@ -286,6 +510,54 @@ func (s *SQLiteStore) CreateNamespace(ns *Namespace) error {
 	return nil
 }
 
+// CreateNamespaceWithOwner creates a namespace together with the user it is
+// the primary namespace of and the user's grant on it, so a failure leaves
+// none of them behind. Returns ErrDuplicateNamespace if the namespace name or
+// external ID is already in use.
+func (s *SQLiteStore) CreateNamespaceWithOwner(ns *Namespace, user *User, grant *NamespaceGrant) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO namespaces (id, name, created_at, repo_limit, storage_limit_bytes, external_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`,
+		ns.ID,
+		ns.Name,
+		ns.CreatedAt,
+		ToNullInt64(ns.RepoLimit),
+		ToNullInt64(ns.StorageLimitBytes),
+		ToNullString(ns.ExternalID),
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicateNamespace
+		}
+		return fmt.Errorf("insert namespace: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO users (id, primary_namespace_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+	`, user.ID, user.PrimaryNamespaceID, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("insert user: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_namespace_grants (user_id, namespace_id, allow_bits, deny_bits, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, grant.UserID, grant.NamespaceID, grant.AllowBits, grant.DenyBits, grant.CreatedAt, grant.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("insert namespace grant: %w", err)
+	}
+
+	return tx.Commit()
+}
+
 // ListNamespaces lists all namespaces with cursor-based pagination.
 func (s *SQLiteStore) ListNamespaces(cursor string, limit int) ([]Namespace, error) {
 	query := `
@@ -372,18 +644,33 @@ func (s *SQLiteStore) DeleteNamespace(id string) error {
 // GetTokenByID retrieves a token by ID.
 func (s *SQLiteStore) GetTokenByID(id string) (*Token, error) {
 	query := `
-		SELECT id, token_hash, token_lookup, is_admin, user_id,
-			   created_at, expires_at, last_used_at
+		SELECT ` + tokenColumns + `
 		FROM tokens
 		WHERE id = ?
 	`
 	return s.scanToken(s.db.QueryRow(query, id))
 }
 
+const tokenColumns = `id, token_hash, token_lookup, is_admin, user_id, name,
+			   created_at, expires_at, last_used_at,
+			   scope_bits, scope_repo_ids, scope_namespace_ids`
+
 func (s *SQLiteStore) scanToken(row *sql.Row) (*Token, error) {
+	token, err := scanTokenRow(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan token: %w", err)
+	}
+	return token, nil
+}
+
+func scanTokenRow(row rowScanner) (*Token, error) {
 	var token Token
-	var userID sql.NullString
+	var userID, name, scopeRepoIDs, scopeNamespaceIDs sql.NullString
 	var expiresAt, lastUsedAt sql.NullTime
+	var scopeBits sql.NullInt64
 
 	err := row.Scan(
 		&token.ID,
@@ -391,29 +678,45 @@ func (s *SQLiteStore) scanToken(row *sql.Row) (*Token, error) {
 		&token.TokenLookup,
 		&token.IsAdmin,
 		&userID,
+		&name,
 		&token.CreatedAt,
 		&expiresAt,
 		&lastUsedAt,
+		&scopeBits,
+		&scopeRepoIDs,
+		&scopeNamespaceIDs,
 	)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, nil
-	}
 	if err != nil {
-		return nil, fmt.Errorf("scan token: %w", err)
+		return nil, err
 	}
 
 	token.UserID = FromNullString(userID)
+	token.Name = FromNullString(name)
 	token.ExpiresAt = FromNullTime(expiresAt)
 	token.LastUsedAt = FromNullTime(lastUsedAt)
+	if scopeBits.Valid {
+		token.Scope = &TokenScope{
+			Allow:        Permission(scopeBits.Int64),
+			RepoIDs:      splitIDs(scopeRepoIDs.String),
+			NamespaceIDs: splitIDs(scopeNamespaceIDs.String),
+		}
+	}
 
 	return &token, nil
 }
 
+// splitIDs splits a comma-separated list of IDs.
+func splitIDs(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
 // ListTokens lists all tokens with cursor-based pagination.
 func (s *SQLiteStore) ListTokens(cursor string, limit int) ([]Token, error) {
 	query := `
-		SELECT id, token_hash, token_lookup, is_admin, user_id,
-			   created_at, expires_at, last_used_at
+		SELECT ` + tokenColumns + `
 		FROM tokens
 		WHERE id > ?
 		ORDER BY id
@@ -428,27 +731,11 @@ func (s *SQLiteStore) ListTokens(cursor string, limit int) ([]Token, error) {
 
 	var tokens []Token
 	for rows.Next() {
-		var token Token
-		var userID sql.NullString
-		var expiresAt, lastUsedAt sql.NullTime
-
-		if err := rows.Scan(
-			&token.ID,
-			&token.TokenHash,
-			&token.TokenLookup,
-			&token.IsAdmin,
-			&userID,
-			&token.CreatedAt,
-			&expiresAt,
-			&lastUsedAt,
-		); err != nil {
+		token, err := scanTokenRow(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan token: %w", err)
 		}
-
-		token.UserID = FromNullString(userID)
-		token.ExpiresAt = FromNullTime(expiresAt)
-		token.LastUsedAt = FromNullTime(lastUsedAt)
-		tokens = append(tokens, token)
+		tokens = append(tokens, *token)
 	}
 
 	return tokens, rows.Err()
@@ -472,28 +759,42 @@ func (s *SQLiteStore) DeleteToken(id string) error {
 	return nil
 }
 
+// UpdateTokenLastUsed records when a token was last used to authenticate.
+func (s *SQLiteStore) UpdateTokenLastUsed(id string, usedAt time.Time) error {
+	result, err := s.db.Exec("UPDATE tokens SET last_used_at = ? WHERE id = ?", usedAt, id)
+	if err != nil {
+		return fmt.Errorf("update token last_used_at: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 // ListRepos lists repos in a namespace with cursor-based pagination.
 func (s *SQLiteStore) ListRepos(namespaceID, cursor string, limit int) ([]Repo, error) {
 	var rows *sql.Rows
 	var err error
 
 	if limit > 0 {
-		query := `
-			SELECT id, namespace_id, name, description, public,
-				   size_bytes, last_push_at, created_at, updated_at
-			FROM repos
-			WHERE namespace_id = ? AND name > ?
-			ORDER BY name
+		query := `SELECT ` + repoColumns + `
+			FROM repos r
+			WHERE r.namespace_id = ? AND r.name > ?
+			ORDER BY r.name
 			LIMIT ?
 		`
 		rows, err = s.db.Query(query, namespaceID, cursor, limit)
 	} else {
-		query := `
-			SELECT id, namespace_id, name, description, public,
-				   size_bytes, last_push_at, created_at, updated_at
-			FROM repos
-			WHERE namespace_id = ? AND name > ?
-			ORDER BY name
+		query := `SELECT ` + repoColumns + `
+			FROM repos r
+			WHERE r.namespace_id = ? AND r.name > ?
+			ORDER BY r.name
 		`
 		rows, err = s.db.Query(query, namespaceID, cursor)
 	}
@@ -502,32 +803,7 @@ func (s *SQLiteStore) ListRepos(namespaceID, cursor string, limit int) ([]Repo,
 	}
 	defer rows.Close()
 
-	var repos []Repo
-	for rows.Next() {
-		var repo Repo
-		var description sql.NullString
-		var lastPushAt sql.NullTime
-
-		if err := rows.Scan(
-			&repo.ID,
-			&repo.NamespaceID,
-			&repo.Name,
-			&description,
-			&repo.Public,
-			&repo.SizeBytes,
-			&lastPushAt,
-			&repo.CreatedAt,
-			&repo.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("scan repo: %w", err)
-		}
-
-		repo.Description = FromNullString(description)
-		repo.LastPushAt = FromNullTime(lastPushAt)
-		repos = append(repos, repo)
-	}
-
-	return repos, rows.Err()
+	return scanRepos(rows)
 }
 
 // ListReposWithFolders lists repos with their folder associations in a single query.
@@ -874,8 +1150,7 @@ func (s *SQLiteStore) ListRepoFolders(repoID string) ([]Folder, error) {
 // ListFolderRepos lists all repos in a folder.
 func (s *SQLiteStore) ListFolderRepos(folderID string) ([]Repo, error) {
 	query := `
-		SELECT r.id, r.namespace_id, r.name, r.description, r.public,
-			   r.size_bytes, r.last_push_at, r.created_at, r.updated_at
+		SELECT ` + repoColumns + `
 		FROM repos r
 		JOIN repo_folders rf ON r.id = rf.repo_id
 		WHERE rf.folder_id = ?
@@ -888,32 +1163,7 @@ func (s *SQLiteStore) ListFolderRepos(folderID string) ([]Repo, error) {
 	}
 	defer rows.Close()
 
-	var repos []Repo
-	for rows.Next() {
-		var repo Repo
-		var description sql.NullString
-		var lastPushAt sql.NullTime
-
-		if err := rows.Scan(
-			&repo.ID,
-			&repo.NamespaceID,
-			&repo.Name,
-			&description,
-			&repo.Public,
-			&repo.SizeBytes,
-			&lastPushAt,
-			&repo.CreatedAt,
-			&repo.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("scan repo: %w", err)
-		}
-
-		repo.Description = FromNullString(description)
-		repo.LastPushAt = FromNullTime(lastPushAt)
-		repos = append(repos, repo)
-	}
-
-	return repos, rows.Err()
+	return scanRepos(rows)
 }
 
 // SetRepoFolders replaces all folders for a repo with the given folder IDs.
@@ -1048,6 +1298,34 @@ func (s *SQLiteStore) GetRepoLFSSize(repoID string) (int64, error) {
 	return size.Int64, nil
 }
 
+// GetNamespaceUsage sums the repos, git storage, LFS storage and release
+// assets of a namespace. Assets sharing stored content are counted once.
+func (s *SQLiteStore) GetNamespaceUsage(namespaceID string) (*NamespaceUsage, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM repos WHERE namespace_id = ?),
+			(SELECT COALESCE(SUM(size_bytes), 0) FROM repos WHERE namespace_id = ?),
+			(SELECT COALESCE(SUM(l.size), 0) FROM lfs_objects l
+			 JOIN repos r ON r.id = l.repo_id WHERE r.namespace_id = ?),
+			(SELECT COALESCE(SUM(size), 0) FROM (
+				SELECT DISTINCT a.repo_id, a.sha256, a.size FROM release_assets a
+				JOIN repos r ON r.id = a.repo_id WHERE r.namespace_id = ?
+			))
+	`
+
+	var usage NamespaceUsage
+	err := s.db.QueryRow(query, namespaceID, namespaceID, namespaceID, namespaceID).Scan(
+		&usage.RepoCount,
+		&usage.GitBytes,
+		&usage.LFSBytes,
+		&usage.ReleaseBytes,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query namespace usage: %w", err)
+	}
+	return &usage, nil
+}
+
 // CreateUser creates a new user.
 func (s *SQLiteStore) CreateUser(user *User) error {
 	query := `
@@ -1270,6 +1548,40 @@ func (s *SQLiteStore) GetNamespaceGrant(userID, namespaceID string) (*NamespaceG
 	return &grant, nil
 }
 
+// ListNamespaceGrants lists all user grants for a namespace.
+func (s *SQLiteStore) ListNamespaceGrants(namespaceID string) ([]NamespaceGrant, error) {
+	query := `
+		SELECT user_id, namespace_id, allow_bits, deny_bits, created_at, updated_at
+		FROM user_namespace_grants
+		WHERE namespace_id = ?
+		ORDER BY user_id
+	`
+
+	rows, err := s.db.Query(query, namespaceID)
+	if err != nil {
+		return nil, fmt.Errorf("query namespace grants: %w", err)
+	}
+	defer rows.Close()
+
+	var grants []NamespaceGrant
+	for rows.Next() {
+		var grant NamespaceGrant
+		if err := rows.Scan(
+			&grant.UserID,
+			&grant.NamespaceID,
+			&grant.AllowBits,
+			&grant.DenyBits,
+			&grant.CreatedAt,
+			&grant.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan namespace grant: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
+
 // ListUserNamespaceGrants lists all namespace grants for a user.
 func (s *SQLiteStore) ListUserNamespaceGrants(userID string) ([]NamespaceGrant, error) {
 	query := `
@@ -1422,11 +1734,45 @@ func (s *SQLiteStore) ListUserRepoGrants(userID string) ([]RepoGrant, error) {
 	return grants, rows.Err()
 }
 
+// ListNamespaceRepoGrants lists all grants on repos in a namespace.
+func (s *SQLiteStore) ListNamespaceRepoGrants(namespaceID string) ([]RepoGrant, error) {
+	query := `
+		SELECT g.user_id, g.repo_id, g.allow_bits, g.deny_bits, g.created_at, g.updated_at
+		FROM user_repo_grants g
+		JOIN repos r ON r.id = g.repo_id
+		WHERE r.namespace_id = ?
+		ORDER BY g.repo_id, g.user_id
+	`
+
+	rows, err := s.db.Query(query, namespaceID)
+	if err != nil {
+		return nil, fmt.Errorf("query repo grants: %w", err)
+	}
+	defer rows.Close()
+
+	var grants []RepoGrant
+	for rows.Next() {
+		var grant RepoGrant
+		if err := rows.Scan(
+			&grant.UserID,
+			&grant.RepoID,
+			&grant.AllowBits,
+			&grant.DenyBits,
+			&grant.CreatedAt,
+			&grant.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan repo grant: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
+
 // ListUserReposWithGrants returns repos in a namespace that the user has repo grants for.
 func (s *SQLiteStore) ListUserReposWithGrants(userID, namespaceID string) ([]Repo, error) {
 	query := `
-		SELECT r.id, r.namespace_id, r.name, r.description, r.public,
-			   r.size_bytes, r.last_push_at, r.created_at, r.updated_at
+		SELECT ` + repoColumns + `
 		FROM repos r
 		JOIN user_repo_grants g ON g.repo_id = r.id
 		WHERE g.user_id = ? AND r.namespace_id = ?
@@ -1439,32 +1785,7 @@ func (s *SQLiteStore) ListUserReposWithGrants(userID, namespaceID string) ([]Rep
 	}
 	defer rows.Close()
 
-	var repos []Repo
-	for rows.Next() {
-		var repo Repo
-		var description sql.NullString
-		var lastPushAt sql.NullTime
-
-		if err := rows.Scan(
-			&repo.ID,
-			&repo.NamespaceID,
-			&repo.Name,
-			&description,
-			&repo.Public,
-			&repo.SizeBytes,
-			&lastPushAt,
-			&repo.CreatedAt,
-			&repo.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("scan repo: %w", err)
-		}
-
-		repo.Description = FromNullString(description)
-		repo.LastPushAt = FromNullTime(lastPushAt)
-		repos = append(repos, repo)
-	}
-
-	return repos, rows.Err()
+	return scanRepos(rows)
 }
 
 // HasRepoGrantsInNamespace returns true if the user has any repo grants in the namespace.
@@ -1488,14 +1809,12 @@ func (s *SQLiteStore) ListAllUserAccessibleRepos(userID string) ([]Repo, error)
 	repoReadBits := int(PermRepoRead | PermRepoWrite | PermRepoAdmin)
 
 	query := `
-		SELECT DISTINCT r.id, r.namespace_id, r.name, r.description, r.public,
-			   r.size_bytes, r.last_push_at, r.created_at, r.updated_at
+		SELECT DISTINCT ` + repoColumns + `
 		FROM repos r
 		JOIN user_namespace_grants ng ON ng.namespace_id = r.namespace_id
 		WHERE ng.user_id = ? AND (ng.allow_bits & ?) != 0 AND (ng.deny_bits & ?) = 0
 		UNION
-		SELECT DISTINCT r.id, r.namespace_id, r.name, r.description, r.public,
-			   r.size_bytes, r.last_push_at, r.created_at, r.updated_at
+		SELECT DISTINCT ` + repoColumns + `
 		FROM repos r
 		JOIN user_repo_grants rg ON rg.repo_id = r.id
 		WHERE rg.user_id = ? AND (rg.allow_bits & ?) != 0 AND (rg.deny_bits & ?) = 0
@@ -1508,39 +1827,13 @@ func (s *SQLiteStore) ListAllUserAccessibleRepos(userID string) ([]Repo, error)
 	}
 	defer rows.Close()
 
-	var repos []Repo
-	for rows.Next() {
-		var repo Repo
-		var description sql.NullString
-		var lastPushAt sql.NullTime
-
-		if err := rows.Scan(
-			&repo.ID,
-			&repo.NamespaceID,
-			&repo.Name,
-			&description,
-			&repo.Public,
-			&repo.SizeBytes,
-			&lastPushAt,
-			&repo.CreatedAt,
-			&repo.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("scan repo: %w", err)
-		}
-
-		repo.Description = FromNullString(description)
-		repo.LastPushAt = FromNullTime(lastPushAt)
-		repos = append(repos, repo)
-	}
-
-	return repos, rows.Err()
+	return scanRepos(rows)
 }
 
 // ListUserTokens lists all tokens belonging to a user.
 func (s *SQLiteStore) ListUserTokens(userID string) ([]Token, error) {
 	query := `
-		SELECT id, token_hash, token_lookup, is_admin, user_id,
-			   created_at, expires_at, last_used_at
+		SELECT ` + tokenColumns + `
 		FROM tokens
 		WHERE user_id = ?
 		ORDER BY created_at DESC
@@ -1554,38 +1847,23 @@ func (s *SQLiteStore) ListUserTokens(userID string) ([]Token, error) {
 
 	var tokens []Token
 	for rows.Next() {
-		var token Token
-		var userID sql.NullString
-		var expiresAt, lastUsedAt sql.NullTime
-
-		if err := rows.Scan(
-			&token.ID,
-			&token.TokenHash,
-			&token.TokenLookup,
-			&token.IsAdmin,
-			&userID,
-			&token.CreatedAt,
-			&expiresAt,
-			&lastUsedAt,
-		); err != nil {
+		token, err := scanTokenRow(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan token: %w", err)
 		}
-
-		token.UserID = FromNullString(userID)
-		token.ExpiresAt = FromNullTime(expiresAt)
-		token.LastUsedAt = FromNullTime(lastUsedAt)
-		tokens = append(tokens, token)
+		tokens = append(tokens, *token)
 	}
 
 	return tokens, rows.Err()
 }
 
-// GenerateUserToken creates a new token bound to a user.
-func (s *SQLiteStore) GenerateUserToken(userID string, expiresAt *time.Time) (string, *Token, error) {
+// GenerateUserToken creates a new token bound to a user. A nil scope gives
+// the token all of the user's permissions.
+func (s *SQLiteStore) GenerateUserToken(userID string, name *string, expiresAt *time.Time, scope *TokenScope) (string, *Token, error) {
 	const maxAttempts = 5
 
 	for attempt := 0; attempt < maxAttempts; attempt++ {
-		rawToken, token, err := s.generateUserTokenAttempt(userID, expiresAt)
+		rawToken, token, err := s.generateUserTokenAttempt(userID, name, expiresAt, scope)
 		if err != nil {
 			if errors.Is(err, ErrTokenLookupCollision) {
 				continue
@@ -1598,7 +1876,7 @@ func (s *SQLiteStore) GenerateUserToken(userID string, expiresAt *time.Time) (st
 	return "", nil, fmt.Errorf("generate user token: %w", ErrTokenLookupCollision)
 }
 
-func (s *SQLiteStore) generateUserTokenAttempt(userID string, expiresAt *time.Time) (string, *Token, error) {
+func (s *SQLiteStore) generateUserTokenAttempt(userID string, name *string, expiresAt *time.Time, scope *TokenScope) (string, *Token, error) {
 	now := time.Now()
 	tokenID := uuid.New().String()
 	tokenLookup := tokenID[:8]
@@ -1621,8 +1899,10 @@ func (s *SQLiteStore) generateUserTokenAttempt(userID string, expiresAt *time.Ti
 		TokenLookup: tokenLookup,
 		IsAdmin:     false,
 		UserID:      &userID,
+		Name:        name,
 		CreatedAt:   now,
 		ExpiresAt:   expiresAt,
+		Scope:       scope,
 	}
 
 	if err := s.CreateToken(token); err != nil {
@@ -1632,11 +1912,12 @@ func (s *SQLiteStore) generateUserTokenAttempt(userID string, expiresAt *time.Ti
 	return rawToken, token, nil
 }
 
-// CreateAuthSession creates a new auth session.
+// CreateAuthSession creates a new auth session. Returns ErrDuplicateUserCode
+// if another session has the same user code.
 func (s *SQLiteStore) CreateAuthSession(session *AuthSession) error {
 	query := `
-		INSERT INTO auth_sessions (id, user_id, token, status, created_at, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO auth_sessions (id, user_id, token, status, user_code, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := s.db.Exec(query,
@@ -1644,31 +1925,52 @@ func (s *SQLiteStore) CreateAuthSession(session *AuthSession) error {
 		ToNullString(session.UserID),
 		ToNullString(session.Token),
 		session.Status,
+		ToNullString(session.UserCode),
 		session.CreatedAt,
 		session.ExpiresAt,
 	)
 	if err != nil {
+		if session.UserCode != nil && isUniqueConstraintError(err) {
+			return ErrDuplicateUserCode
+		}
 		return fmt.Errorf("insert auth session: %w", err)
 	}
 	return nil
 }
 
+const authSessionColumns = `id, user_id, token, status, user_code, created_at, expires_at`
+
 // GetAuthSession retrieves an auth session by ID.
 func (s *SQLiteStore) GetAuthSession(id string) (*AuthSession, error) {
 	query := `
-		SELECT id, user_id, token, status, created_at, expires_at
+		SELECT ` + authSessionColumns + `
 		FROM auth_sessions
 		WHERE id = ?
 	`
+	return scanAuthSession(s.db.QueryRow(query, id))
+}
+
+// GetAuthSessionByUserCode retrieves a device login's auth session by its
+// user code.
+func (s *SQLiteStore) GetAuthSessionByUserCode(userCode string) (*AuthSession, error) {
+	query := `
+		SELECT ` + authSessionColumns + `
+		FROM auth_sessions
+		WHERE user_code = ?
+	`
+	return scanAuthSession(s.db.QueryRow(query, userCode))
+}
 
+func scanAuthSession(row rowScanner) (*AuthSession, error) {
 	var session AuthSession
-	var userID, token sql.NullString
+	var userID, token, userCode sql.NullString
 
-	err := s.db.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&session.ID,
 		&userID,
 		&token,
 		&session.Status,
+		&userCode,
 		&session.CreatedAt,
 		&session.ExpiresAt,
 	)
@@ -1681,6 +1983,7 @@ func (s *SQLiteStore) GetAuthSession(id string) (*AuthSession, error) {
 
 	session.UserID = FromNullString(userID)
 	session.Token = FromNullString(token)
+	session.UserCode = FromNullString(userCode)
 
 	return &session, nil
 }
@@ -1735,3 +2038,2166 @@ func (s *SQLiteStore) DeleteExpiredAuthSessions() error {
 	}
 	return nil
 }
+
+// CreateSSHKey registers a new SSH public key for a user. Returns
+// ErrDuplicateSSHKey if the key is already registered as a user or deploy key.
+func (s *SQLiteStore) CreateSSHKey(key *SSHKey) error {
+	taken, err := s.fingerprintRegistered("deploy_keys", key.Fingerprint)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicateSSHKey
+	}
+
+	query := `
+		INSERT INTO ssh_keys (id, user_id, name, key_type, fingerprint, public_key, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = s.db.Exec(query,
+		key.ID,
+		key.UserID,
+		ToNullString(key.Name),
+		key.KeyType,
+		key.Fingerprint,
+		key.PublicKey,
+		key.CreatedAt,
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicateSSHKey
+		}
+		return fmt.Errorf("insert ssh key: %w", err)
+	}
+	return nil
+}
+
+// GetSSHKey retrieves an SSH key by ID.
+func (s *SQLiteStore) GetSSHKey(id string) (*SSHKey, error) {
+	query := `
+		SELECT id, user_id, name, key_type, fingerprint, public_key, created_at, last_used_at
+		FROM ssh_keys
+		WHERE id = ?
+	`
+	return s.scanSSHKey(s.db.QueryRow(query, id))
+}
+
+// GetSSHKeyByFingerprint retrieves an SSH key by its SHA256 fingerprint.
+func (s *SQLiteStore) GetSSHKeyByFingerprint(fingerprint string) (*SSHKey, error) {
+	query := `
+		SELECT id, user_id, name, key_type, fingerprint, public_key, created_at, last_used_at
+		FROM ssh_keys
+		WHERE fingerprint = ?
+	`
+	return s.scanSSHKey(s.db.QueryRow(query, fingerprint))
+}
+
+func (s *SQLiteStore) scanSSHKey(row *sql.Row) (*SSHKey, error) {
+	var key SSHKey
+	var name sql.NullString
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&name,
+		&key.KeyType,
+		&key.Fingerprint,
+		&key.PublicKey,
+		&key.CreatedAt,
+		&lastUsedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan ssh key: %w", err)
+	}
+
+	key.Name = FromNullString(name)
+	key.LastUsedAt = FromNullTime(lastUsedAt)
+
+	return &key, nil
+}
+
+// ListUserSSHKeys lists all SSH keys registered to a user.
+func (s *SQLiteStore) ListUserSSHKeys(userID string) ([]SSHKey, error) {
+	query := `
+		SELECT id, user_id, name, key_type, fingerprint, public_key, created_at, last_used_at
+		FROM ssh_keys
+		WHERE user_id = ?
+		ORDER BY created_at
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query ssh keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []SSHKey
+	for rows.Next() {
+		var key SSHKey
+		var name sql.NullString
+		var lastUsedAt sql.NullTime
+
+		if err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&name,
+			&key.KeyType,
+			&key.Fingerprint,
+			&key.PublicKey,
+			&key.CreatedAt,
+			&lastUsedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan ssh key: %w", err)
+		}
+
+		key.Name = FromNullString(name)
+		key.LastUsedAt = FromNullTime(lastUsedAt)
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteSSHKey deletes an SSH key by ID.
+func (s *SQLiteStore) DeleteSSHKey(id string) error {
+	result, err := s.db.Exec("DELETE FROM ssh_keys WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete ssh key: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// UpdateSSHKeyLastUsed records when an SSH key was last used to authenticate.
+func (s *SQLiteStore) UpdateSSHKeyLastUsed(id string, usedAt time.Time) error {
+	result, err := s.db.Exec("UPDATE ssh_keys SET last_used_at = ? WHERE id = ?", usedAt, id)
+	if err != nil {
+		return fmt.Errorf("update ssh key last_used_at: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// fingerprintRegistered reports whether an SSH fingerprint is in use by the
+// given table. A key authenticates as one user or one deploy key, so
+// fingerprints are unique across ssh_keys and deploy_keys.
+func (s *SQLiteStore) fingerprintRegistered(table, fingerprint string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM "+table+" WHERE fingerprint = ?)", fingerprint).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("check %s fingerprint: %w", table, err)
+	}
+	return exists, nil
+}
+
+const deployKeyColumns = `id, repo_id, name, read_only, token_hash, token_lookup, key_type,
+	fingerprint, public_key, created_by, created_at, last_used_at`
+
+// CreateDeployKey stores a deploy key. Returns ErrDuplicateSSHKey if its
+// public key is already registered as a deploy key or user key.
+func (s *SQLiteStore) CreateDeployKey(key *DeployKey) error {
+	if key.Fingerprint != nil {
+		taken, err := s.fingerprintRegistered("ssh_keys", *key.Fingerprint)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicateSSHKey
+		}
+	}
+
+	query := `
+		INSERT INTO deploy_keys (` + deployKeyColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		key.ID,
+		key.RepoID,
+		key.Name,
+		key.ReadOnly,
+		sql.NullString{String: key.TokenHash, Valid: key.TokenHash != ""},
+		sql.NullString{String: key.TokenLookup, Valid: key.TokenLookup != ""},
+		ToNullString(key.KeyType),
+		ToNullString(key.Fingerprint),
+		ToNullString(key.PublicKey),
+		ToNullString(key.CreatedBy),
+		key.CreatedAt,
+		ToNullTime(key.LastUsedAt),
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			if key.Fingerprint != nil {
+				return ErrDuplicateSSHKey
+			}
+			return ErrTokenLookupCollision
+		}
+		return fmt.Errorf("insert deploy key: %w", err)
+	}
+	return nil
+}
+
+// GenerateDeployKeyToken assigns key an ID and a new token, stores it, and
+// returns the raw token. The caller fills in the repo, name and mode.
+func (s *SQLiteStore) GenerateDeployKeyToken(key *DeployKey) (string, error) {
+	const maxAttempts = 5
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		key.ID = uuid.New().String()
+		key.TokenLookup = key.ID[:8]
+
+		secret, err := core.GenerateTokenSecret(24)
+		if err != nil {
+			return "", fmt.Errorf("generate token secret: %w", err)
+		}
+
+		rawToken := core.BuildDeployToken(key.TokenLookup, secret)
+
+		key.TokenHash, err = core.HashToken(rawToken)
+		if err != nil {
+			return "", fmt.Errorf("hash token: %w", err)
+		}
+
+		if err := s.CreateDeployKey(key); err != nil {
+			if errors.Is(err, ErrTokenLookupCollision) {
+				continue
+			}
+			return "", err
+		}
+		return rawToken, nil
+	}
+
+	return "", fmt.Errorf("generate deploy key token: %w", ErrTokenLookupCollision)
+}
+
+// GetDeployKey retrieves a deploy key by ID.
+func (s *SQLiteStore) GetDeployKey(id string) (*DeployKey, error) {
+	return scanDeployKey(s.db.QueryRow("SELECT "+deployKeyColumns+" FROM deploy_keys WHERE id = ?", id))
+}
+
+// GetDeployKeyByLookup retrieves a token deploy key by its token lookup key.
+func (s *SQLiteStore) GetDeployKeyByLookup(lookup string) (*DeployKey, error) {
+	return scanDeployKey(s.db.QueryRow("SELECT "+deployKeyColumns+" FROM deploy_keys WHERE token_lookup = ?", lookup))
+}
+
+// GetDeployKeyByFingerprint retrieves an SSH deploy key by its SHA256 fingerprint.
+func (s *SQLiteStore) GetDeployKeyByFingerprint(fingerprint string) (*DeployKey, error) {
+	return scanDeployKey(s.db.QueryRow("SELECT "+deployKeyColumns+" FROM deploy_keys WHERE fingerprint = ?", fingerprint))
+}
+
+func scanDeployKey(row rowScanner) (*DeployKey, error) {
+	var key DeployKey
+	var tokenHash, tokenLookup, keyType, fingerprint, publicKey, createdBy sql.NullString
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&key.ID,
+		&key.RepoID,
+		&key.Name,
+		&key.ReadOnly,
+		&tokenHash,
+		&tokenLookup,
+		&keyType,
+		&fingerprint,
+		&publicKey,
+		&createdBy,
+		&key.CreatedAt,
+		&lastUsedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan deploy key: %w", err)
+	}
+
+	key.TokenHash = tokenHash.String
+	key.TokenLookup = tokenLookup.String
+	key.KeyType = FromNullString(keyType)
+	key.Fingerprint = FromNullString(fingerprint)
+	key.PublicKey = FromNullString(publicKey)
+	key.CreatedBy = FromNullString(createdBy)
+	key.LastUsedAt = FromNullTime(lastUsedAt)
+
+	return &key, nil
+}
+
+// ListRepoDeployKeys lists a repository's deploy keys, oldest first.
+func (s *SQLiteStore) ListRepoDeployKeys(repoID string) ([]DeployKey, error) {
+	query := `
+		SELECT ` + deployKeyColumns + `
+		FROM deploy_keys
+		WHERE repo_id = ?
+		ORDER BY created_at
+	`
+
+	rows, err := s.db.Query(query, repoID)
+	if err != nil {
+		return nil, fmt.Errorf("query deploy keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []DeployKey
+	for rows.Next() {
+		key, err := scanDeployKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteDeployKey deletes a deploy key.
+func (s *SQLiteStore) DeleteDeployKey(id string) error {
+	result, err := s.db.Exec("DELETE FROM deploy_keys WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete deploy key: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// UpdateDeployKeyLastUsed records when a deploy key was last used to authenticate.
+func (s *SQLiteStore) UpdateDeployKeyLastUsed(id string, usedAt time.Time) error {
+	result, err := s.db.Exec("UPDATE deploy_keys SET last_used_at = ? WHERE id = ?", usedAt, id)
+	if err != nil {
+		return fmt.Errorf("update deploy key last_used_at: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// CreateBranchProtection creates a new branch protection rule.
+func (s *SQLiteStore) CreateBranchProtection(rule *BranchProtection) error {
+	query := `
+		INSERT INTO branch_protections (id, repo_id, pattern, block_force_push, block_deletion,
+			require_linear_history, push_permission, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		rule.ID,
+		rule.RepoID,
+		rule.Pattern,
+		rule.BlockForcePush,
+		rule.BlockDeletion,
+		rule.RequireLinearHistory,
+		rule.PushPermission,
+		rule.CreatedAt,
+		rule.UpdatedAt,
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicateBranchProtection
+		}
+		return fmt.Errorf("insert branch protection: %w", err)
+	}
+	return nil
+}
+
+// GetBranchProtection retrieves a branch protection rule by ID.
+func (s *SQLiteStore) GetBranchProtection(id string) (*BranchProtection, error) {
+	query := `
+		SELECT id, repo_id, pattern, block_force_push, block_deletion,
+			   require_linear_history, push_permission, created_at, updated_at
+		FROM branch_protections
+		WHERE id = ?
+	`
+
+	var rule BranchProtection
+	err := s.db.QueryRow(query, id).Scan(
+		&rule.ID,
+		&rule.RepoID,
+		&rule.Pattern,
+		&rule.BlockForcePush,
+		&rule.BlockDeletion,
+		&rule.RequireLinearHistory,
+		&rule.PushPermission,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan branch protection: %w", err)
+	}
+	return &rule, nil
+}
+
+// ListBranchProtections lists all branch protection rules for a repository.
+func (s *SQLiteStore) ListBranchProtections(repoID string) ([]BranchProtection, error) {
+	query := `
+		SELECT id, repo_id, pattern, block_force_push, block_deletion,
+			   require_linear_history, push_permission, created_at, updated_at
+		FROM branch_protections
+		WHERE repo_id = ?
+		ORDER BY pattern
+	`
+
+	rows, err := s.db.Query(query, repoID)
+	if err != nil {
+		return nil, fmt.Errorf("query branch protections: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []BranchProtection
+	for rows.Next() {
+		var rule BranchProtection
+		if err := rows.Scan(
+			&rule.ID,
+			&rule.RepoID,
+			&rule.Pattern,
+			&rule.BlockForcePush,
+			&rule.BlockDeletion,
+			&rule.RequireLinearHistory,
+			&rule.PushPermission,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan branch protection: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// UpdateBranchProtection updates an existing branch protection rule.
+func (s *SQLiteStore) UpdateBranchProtection(rule *BranchProtection) error {
+	query := `
+		UPDATE branch_protections
+		SET pattern = ?, block_force_push = ?, block_deletion = ?,
+			require_linear_history = ?, push_permission = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := s.db.Exec(query,
+		rule.Pattern,
+		rule.BlockForcePush,
+		rule.BlockDeletion,
+		rule.RequireLinearHistory,
+		rule.PushPermission,
+		rule.UpdatedAt,
+		rule.ID,
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicateBranchProtection
+		}
+		return fmt.Errorf("update branch protection: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteBranchProtection deletes a branch protection rule by ID.
+func (s *SQLiteStore) DeleteBranchProtection(id string) error {
+	result, err := s.db.Exec("DELETE FROM branch_protections WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete branch protection: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const webhookColumns = `id, repo_id, namespace_id, url, secret, events, active, created_at, updated_at`
+
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	var hook Webhook
+	var repoID, namespaceID sql.NullString
+	var events string
+
+	if err := row.Scan(
+		&hook.ID,
+		&repoID,
+		&namespaceID,
+		&hook.URL,
+		&hook.Secret,
+		&events,
+		&hook.Active,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	hook.RepoID = FromNullString(repoID)
+	hook.NamespaceID = FromNullString(namespaceID)
+	hook.Events = splitWebhookEvents(events)
+	return &hook, nil
+}
+
+func splitWebhookEvents(events string) []string {
+	if events == "" {
+		return []string{}
+	}
+	return strings.Split(events, ",")
+}
+
+func (s *SQLiteStore) queryWebhooks(query string, args ...any) ([]Webhook, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var hooks []Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook: %w", err)
+		}
+		hooks = append(hooks, *hook)
+	}
+
+	return hooks, rows.Err()
+}
+
+// CreateWebhook creates a new webhook.
+func (s *SQLiteStore) CreateWebhook(hook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (id, repo_id, namespace_id, url, secret, events, active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		hook.ID,
+		ToNullString(hook.RepoID),
+		ToNullString(hook.NamespaceID),
+		hook.URL,
+		hook.Secret,
+		strings.Join(hook.Events, ","),
+		hook.Active,
+		hook.CreatedAt,
+		hook.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert webhook: %w", err)
+	}
+	return nil
+}
+
+// GetWebhook retrieves a webhook by ID.
+func (s *SQLiteStore) GetWebhook(id string) (*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = ?`
+
+	hook, err := scanWebhook(s.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan webhook: %w", err)
+	}
+	return hook, nil
+}
+
+// ListRepoWebhooks lists the webhooks registered on a repository.
+func (s *SQLiteStore) ListRepoWebhooks(repoID string) ([]Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE repo_id = ? ORDER BY created_at, id`
+	return s.queryWebhooks(query, repoID)
+}
+
+// ListNamespaceWebhooks lists the webhooks registered on a namespace.
+func (s *SQLiteStore) ListNamespaceWebhooks(namespaceID string) ([]Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE namespace_id = ? ORDER BY created_at, id`
+	return s.queryWebhooks(query, namespaceID)
+}
+
+// ListActiveWebhooksForRepo lists the active webhooks that receive events for a
+// repository: those registered on the repo itself and on its namespace.
+func (s *SQLiteStore) ListActiveWebhooksForRepo(repoID, namespaceID string) ([]Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE active = TRUE AND (repo_id = ? OR namespace_id = ?)
+		ORDER BY created_at, id
+	`
+	return s.queryWebhooks(query, repoID, namespaceID)
+}
+
+// UpdateWebhook updates an existing webhook.
+func (s *SQLiteStore) UpdateWebhook(hook *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = ?, secret = ?, events = ?, active = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := s.db.Exec(query,
+		hook.URL,
+		hook.Secret,
+		strings.Join(hook.Events, ","),
+		hook.Active,
+		hook.UpdatedAt,
+		hook.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update webhook: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteWebhook deletes a webhook and its deliveries.
+func (s *SQLiteStore) DeleteWebhook(id string) error {
+	result, err := s.db.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at,
+	last_attempt_at, response_status, response_body, error, created_at`
+
+func scanWebhookDelivery(row rowScanner) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var nextAttemptAt, lastAttemptAt sql.NullTime
+	var responseStatus sql.NullInt64
+	var responseBody, deliveryErr sql.NullString
+
+	if err := row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&nextAttemptAt,
+		&lastAttemptAt,
+		&responseStatus,
+		&responseBody,
+		&deliveryErr,
+		&d.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	d.NextAttemptAt = FromNullTime(nextAttemptAt)
+	d.LastAttemptAt = FromNullTime(lastAttemptAt)
+	d.ResponseStatus = FromNullInt64(responseStatus)
+	d.ResponseBody = FromNullString(responseBody)
+	d.Error = FromNullString(deliveryErr)
+	return &d, nil
+}
+
+func (s *SQLiteStore) queryWebhookDeliveries(query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// CreateWebhookDelivery queues a new webhook delivery.
+func (s *SQLiteStore) CreateWebhookDelivery(d *WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (` + webhookDeliveryColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		d.ID,
+		d.WebhookID,
+		d.Event,
+		d.Payload,
+		d.Status,
+		d.Attempts,
+		ToNullTime(d.NextAttemptAt),
+		ToNullTime(d.LastAttemptAt),
+		ToNullInt64(d.ResponseStatus),
+		ToNullString(d.ResponseBody),
+		ToNullString(d.Error),
+		d.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// GetWebhookDelivery retrieves a webhook delivery by ID.
+func (s *SQLiteStore) GetWebhookDelivery(id string) (*WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = ?`
+
+	d, err := scanWebhookDelivery(s.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan webhook delivery: %w", err)
+	}
+	return d, nil
+}
+
+// ListWebhookDeliveries lists deliveries for a webhook, newest first.
+// The cursor is the ID of the last delivery on the previous page.
+func (s *SQLiteStore) ListWebhookDeliveries(webhookID, cursor string, limit int) ([]WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		  AND (? = '' OR (created_at, id) < (SELECT created_at, id FROM webhook_deliveries WHERE id = ?))
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`
+	return s.queryWebhookDeliveries(query, webhookID, cursor, cursor, limit)
+}
+
+// ListDueWebhookDeliveries lists pending deliveries whose next attempt is due, oldest first.
+func (s *SQLiteStore) ListDueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?
+	`
+	return s.queryWebhookDeliveries(query, WebhookDeliveryPending, now, limit)
+}
+
+// UpdateWebhookDelivery records the outcome of a delivery attempt.
+func (s *SQLiteStore) UpdateWebhookDelivery(d *WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?,
+			response_status = ?, response_body = ?, error = ?
+		WHERE id = ?
+	`
+
+	result, err := s.db.Exec(query,
+		d.Status,
+		d.Attempts,
+		ToNullTime(d.NextAttemptAt),
+		ToNullTime(d.LastAttemptAt),
+		ToNullInt64(d.ResponseStatus),
+		ToNullString(d.ResponseBody),
+		ToNullString(d.Error),
+		d.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update webhook delivery: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// CreatePushEvents records the ref updates of a single push.
+func (s *SQLiteStore) CreatePushEvents(events []PushEvent) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO push_events (id, repo_id, ref, old_sha, new_sha, user_id, token_id, deploy_key_id, forced, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	for _, e := range events {
+		if _, err := tx.Exec(query,
+			e.ID,
+			e.RepoID,
+			e.Ref,
+			e.OldSHA,
+			e.NewSHA,
+			ToNullString(e.UserID),
+			ToNullString(e.TokenID),
+			ToNullString(e.DeployKeyID),
+			e.Forced,
+			e.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("insert push event: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListRepoPushEvents lists push events for a repository, newest first.
+// The cursor is the ID of the last event on the previous page.
+func (s *SQLiteStore) ListRepoPushEvents(repoID, cursor string, limit int) ([]PushEvent, error) {
+	query := `
+		SELECT id, repo_id, ref, old_sha, new_sha, user_id, token_id, deploy_key_id, forced, created_at
+		FROM push_events
+		WHERE repo_id = ?
+		  AND (? = '' OR (created_at, id) < (SELECT created_at, id FROM push_events WHERE id = ?))
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := s.db.Query(query, repoID, cursor, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query push events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []PushEvent
+	for rows.Next() {
+		var e PushEvent
+		var userID, tokenID, deployKeyID sql.NullString
+
+		if err := rows.Scan(
+			&e.ID,
+			&e.RepoID,
+			&e.Ref,
+			&e.OldSHA,
+			&e.NewSHA,
+			&userID,
+			&tokenID,
+			&deployKeyID,
+			&e.Forced,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan push event: %w", err)
+		}
+
+		e.UserID = FromNullString(userID)
+		e.TokenID = FromNullString(tokenID)
+		e.DeployKeyID = FromNullString(deployKeyID)
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// CreateLFSLock creates an LFS lock. Returns ErrDuplicateLFSLock if the path is already locked.
+func (s *SQLiteStore) CreateLFSLock(lock *LFSLock) error {
+	query := `
+		INSERT INTO lfs_locks (id, repo_id, path, owner_id, ref, locked_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		lock.ID,
+		lock.RepoID,
+		lock.Path,
+		lock.OwnerID,
+		ToNullString(lock.Ref),
+		lock.LockedAt,
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicateLFSLock
+		}
+		return fmt.Errorf("insert lfs lock: %w", err)
+	}
+	return nil
+}
+
+const lfsLockColumns = `
+	l.id, l.repo_id, l.path, l.owner_id, l.ref, COALESCE(n.name, ''), l.locked_at
+	FROM lfs_locks l
+	JOIN users u ON u.id = l.owner_id
+	LEFT JOIN namespaces n ON n.id = u.primary_namespace_id
+`
+
+func scanLFSLock(row rowScanner) (*LFSLock, error) {
+	var lock LFSLock
+	var ref sql.NullString
+
+	if err := row.Scan(
+		&lock.ID,
+		&lock.RepoID,
+		&lock.Path,
+		&lock.OwnerID,
+		&ref,
+		&lock.OwnerName,
+		&lock.LockedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	lock.Ref = FromNullString(ref)
+	return &lock, nil
+}
+
+// GetLFSLock retrieves an LFS lock by ID within a repo.
+func (s *SQLiteStore) GetLFSLock(repoID, id string) (*LFSLock, error) {
+	query := `SELECT ` + lfsLockColumns + ` WHERE l.repo_id = ? AND l.id = ?`
+
+	lock, err := scanLFSLock(s.db.QueryRow(query, repoID, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get lfs lock: %w", err)
+	}
+	return lock, nil
+}
+
+// ListLFSLocks lists a repo's LFS locks, oldest first, optionally limited to one path.
+// The cursor is the ID of the last lock on the previous page.
+func (s *SQLiteStore) ListLFSLocks(repoID, path, cursor string, limit int) ([]LFSLock, error) {
+	query := `SELECT ` + lfsLockColumns + `
+		WHERE l.repo_id = ?
+		  AND (? = '' OR l.path = ?)
+		  AND (? = '' OR (l.locked_at, l.id) > (SELECT locked_at, id FROM lfs_locks WHERE id = ?))
+		ORDER BY l.locked_at, l.id
+		LIMIT ?
+	`
+
+	rows, err := s.db.Query(query, repoID, path, path, cursor, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query lfs locks: %w", err)
+	}
+	defer rows.Close()
+
+	var locks []LFSLock
+	for rows.Next() {
+		lock, err := scanLFSLock(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan lfs lock: %w", err)
+		}
+		locks = append(locks, *lock)
+	}
+
+	return locks, rows.Err()
+}
+
+// DeleteLFSLock deletes an LFS lock.
+func (s *SQLiteStore) DeleteLFSLock(id string) error {
+	result, err := s.db.Exec("DELETE FROM lfs_locks WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete lfs lock: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// CreatePushMirror creates a push mirror. Returns ErrDuplicatePushMirror if the
+// repo already pushes to the URL.
+func (s *SQLiteStore) CreatePushMirror(mirror *PushMirror) error {
+	query := `
+		INSERT INTO push_mirrors (id, repo_id, url, credentials, status, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		mirror.ID,
+		mirror.RepoID,
+		mirror.URL,
+		ToNullString(mirror.Credentials),
+		mirror.Status,
+		ToNullTime(mirror.NextAttemptAt),
+		mirror.CreatedAt,
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicatePushMirror
+		}
+		return fmt.Errorf("insert push mirror: %w", err)
+	}
+	return nil
+}
+
+const pushMirrorColumns = `id, repo_id, url, credentials, status, attempts, generation,
+	last_error, last_sync_at, next_attempt_at, created_at`
+
+func scanPushMirror(row rowScanner) (*PushMirror, error) {
+	var mirror PushMirror
+	var credentials, lastError sql.NullString
+	var lastSyncAt, nextAttemptAt sql.NullTime
+
+	err := row.Scan(
+		&mirror.ID,
+		&mirror.RepoID,
+		&mirror.URL,
+		&credentials,
+		&mirror.Status,
+		&mirror.Attempts,
+		&mirror.Generation,
+		&lastError,
+		&lastSyncAt,
+		&nextAttemptAt,
+		&mirror.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mirror.Credentials = FromNullString(credentials)
+	mirror.LastError = FromNullString(lastError)
+	mirror.LastSyncAt = FromNullTime(lastSyncAt)
+	mirror.NextAttemptAt = FromNullTime(nextAttemptAt)
+
+	return &mirror, nil
+}
+
+func scanPushMirrors(rows *sql.Rows) ([]PushMirror, error) {
+	var mirrors []PushMirror
+	for rows.Next() {
+		mirror, err := scanPushMirror(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan push mirror: %w", err)
+		}
+		mirrors = append(mirrors, *mirror)
+	}
+	return mirrors, rows.Err()
+}
+
+// GetPushMirror retrieves a push mirror of a repo by ID.
+func (s *SQLiteStore) GetPushMirror(repoID, id string) (*PushMirror, error) {
+	query := `SELECT ` + pushMirrorColumns + ` FROM push_mirrors WHERE repo_id = ? AND id = ?`
+
+	mirror, err := scanPushMirror(s.db.QueryRow(query, repoID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan push mirror: %w", err)
+	}
+	return mirror, nil
+}
+
+// ListPushMirrors lists a repo's push mirrors, oldest first.
+func (s *SQLiteStore) ListPushMirrors(repoID string) ([]PushMirror, error) {
+	query := `SELECT ` + pushMirrorColumns + ` FROM push_mirrors WHERE repo_id = ? ORDER BY created_at, id`
+
+	rows, err := s.db.Query(query, repoID)
+	if err != nil {
+		return nil, fmt.Errorf("query push mirrors: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPushMirrors(rows)
+}
+
+// DeletePushMirror deletes a push mirror.
+func (s *SQLiteStore) DeletePushMirror(id string) error {
+	result, err := s.db.Exec("DELETE FROM push_mirrors WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete push mirror: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// QueuePushMirrors schedules a push to every mirror of a repo, restarting
+// their retry counts.
+func (s *SQLiteStore) QueuePushMirrors(repoID string, now time.Time) error {
+	query := `
+		UPDATE push_mirrors
+		SET status = ?, attempts = 0, generation = generation + 1, next_attempt_at = ?
+		WHERE repo_id = ?
+	`
+
+	if _, err := s.db.Exec(query, MirrorStatusPending, now, repoID); err != nil {
+		return fmt.Errorf("queue push mirrors: %w", err)
+	}
+	return nil
+}
+
+// ListDuePushMirrors returns pending push mirrors whose next attempt is at or
+// before now, most overdue first.
+func (s *SQLiteStore) ListDuePushMirrors(now time.Time, limit int) ([]PushMirror, error) {
+	query := `SELECT ` + pushMirrorColumns + `
+		FROM push_mirrors
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at
+		LIMIT ?
+	`
+
+	rows, err := s.db.Query(query, MirrorStatusPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query due push mirrors: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPushMirrors(rows)
+}
+
+// RecordPushMirrorAttempt stores the outcome of a push attempt. It returns
+// false without writing anything if another push was queued since the mirror
+// was read, leaving that push pending.
+func (s *SQLiteStore) RecordPushMirrorAttempt(mirror *PushMirror) (bool, error) {
+	query := `
+		UPDATE push_mirrors
+		SET status = ?, attempts = ?, last_error = ?, last_sync_at = ?, next_attempt_at = ?
+		WHERE id = ? AND generation = ?
+	`
+
+	result, err := s.db.Exec(query,
+		mirror.Status,
+		mirror.Attempts,
+		ToNullString(mirror.LastError),
+		ToNullTime(mirror.LastSyncAt),
+		ToNullTime(mirror.NextAttemptAt),
+		mirror.ID,
+		mirror.Generation,
+	)
+	if err != nil {
+		return false, fmt.Errorf("record push mirror attempt: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// GetSearchIndexState retrieves the code search index state of a repo.
+func (s *SQLiteStore) GetSearchIndexState(repoID string) (*SearchIndexState, error) {
+	query := `SELECT repo_id, ref, commit_sha, indexed_at FROM search_index_state WHERE repo_id = ?`
+
+	var state SearchIndexState
+	err := s.db.QueryRow(query, repoID).Scan(&state.RepoID, &state.Ref, &state.CommitSHA, &state.IndexedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan search index state: %w", err)
+	}
+	return &state, nil
+}
+
+// ReplaceSearchDocuments replaces a repo's indexed documents and records the
+// commit they were read from.
+func (s *SQLiteStore) ReplaceSearchDocuments(state *SearchIndexState, docs []SearchDocument) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM search_documents WHERE repo_id = ?", state.RepoID); err != nil {
+		return fmt.Errorf("delete search documents: %w", err)
+	}
+
+	insert := `INSERT INTO search_documents (repo_id, path, blob_sha, content) VALUES (?, ?, ?, ?)`
+	for _, doc := range docs {
+		if _, err := tx.Exec(insert, state.RepoID, doc.Path, doc.BlobSHA, doc.Content); err != nil {
+			return fmt.Errorf("insert search document: %w", err)
+		}
+	}
+
+	upsert := `
+		INSERT INTO search_index_state (repo_id, ref, commit_sha, indexed_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(repo_id) DO UPDATE SET
+			ref = excluded.ref,
+			commit_sha = excluded.commit_sha,
+			indexed_at = excluded.indexed_at
+	`
+	if _, err := tx.Exec(upsert, state.RepoID, state.Ref, state.CommitSHA, state.IndexedAt); err != nil {
+		return fmt.Errorf("upsert search index state: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// SearchDocuments lists indexed documents of the given repos in ID order.
+func (s *SQLiteStore) SearchDocuments(q SearchDocumentQuery) ([]SearchDocument, error) {
+	if len(q.RepoIDs) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.Repeat("?, ", len(q.RepoIDs)-1) + "?"
+	query := `
+		SELECT rowid, repo_id, path, blob_sha, content
+		FROM search_documents
+		WHERE repo_id IN (` + placeholders + `) AND rowid > ?
+	`
+
+	args := make([]any, 0, len(q.RepoIDs)+3)
+	for _, id := range q.RepoIDs {
+		args = append(args, id)
+	}
+	args = append(args, q.AfterID)
+
+	// With the trigram tokenizer a quoted phrase matches any substring.
+	if q.Contains != "" {
+		query += ` AND search_documents MATCH ?`
+		args = append(args, `content : "`+strings.ReplaceAll(q.Contains, `"`, `""`)+`"`)
+	}
+	query += ` ORDER BY rowid LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query search documents: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []SearchDocument
+	for rows.Next() {
+		var doc SearchDocument
+		if err := rows.Scan(&doc.ID, &doc.RepoID, &doc.Path, &doc.BlobSHA, &doc.Content); err != nil {
+			return nil, fmt.Errorf("scan search document: %w", err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// CreateMergeRequest creates a merge request and assigns it the repo's next
+// number. Returns ErrDuplicateMergeRequest if one is already open for the
+// same branches.
+func (s *SQLiteStore) CreateMergeRequest(mr *MergeRequest) error {
+	query := `
+		INSERT INTO merge_requests (
+			id, repo_id, number, title, description, source_branch, target_branch,
+			status, author_id, created_at, updated_at
+		)
+		VALUES (?, ?, (SELECT COALESCE(MAX(number), 0) + 1 FROM merge_requests WHERE repo_id = ?), ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING number
+	`
+
+	err := s.db.QueryRow(query,
+		mr.ID,
+		mr.RepoID,
+		mr.RepoID,
+		mr.Title,
+		mr.Description,
+		mr.SourceBranch,
+		mr.TargetBranch,
+		mr.Status,
+		ToNullString(mr.AuthorID),
+		mr.CreatedAt,
+		mr.UpdatedAt,
+	).Scan(&mr.Number)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicateMergeRequest
+		}
+		return fmt.Errorf("insert merge request: %w", err)
+	}
+	return nil
+}
+
+const mergeRequestColumns = `
+	m.id, m.repo_id, m.number, m.title, m.description, m.source_branch, m.target_branch,
+	m.status, m.author_id, COALESCE(n.name, ''), m.source_sha, m.target_sha,
+	m.merge_strategy, m.merge_commit_sha, m.merged_by, m.merged_at, m.closed_at,
+	m.created_at, m.updated_at
+	FROM merge_requests m
+	LEFT JOIN users u ON u.id = m.author_id
+	LEFT JOIN namespaces n ON n.id = u.primary_namespace_id
+`
+
+func scanMergeRequest(row rowScanner) (*MergeRequest, error) {
+	var mr MergeRequest
+	var authorID, sourceSHA, targetSHA, strategy, mergeCommitSHA, mergedBy sql.NullString
+	var mergedAt, closedAt sql.NullTime
+
+	if err := row.Scan(
+		&mr.ID,
+		&mr.RepoID,
+		&mr.Number,
+		&mr.Title,
+		&mr.Description,
+		&mr.SourceBranch,
+		&mr.TargetBranch,
+		&mr.Status,
+		&authorID,
+		&mr.AuthorName,
+		&sourceSHA,
+		&targetSHA,
+		&strategy,
+		&mergeCommitSHA,
+		&mergedBy,
+		&mergedAt,
+		&closedAt,
+		&mr.CreatedAt,
+		&mr.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	mr.AuthorID = FromNullString(authorID)
+	mr.SourceSHA = FromNullString(sourceSHA)
+	mr.TargetSHA = FromNullString(targetSHA)
+	mr.MergeStrategy = FromNullString(strategy)
+	mr.MergeCommitSHA = FromNullString(mergeCommitSHA)
+	mr.MergedBy = FromNullString(mergedBy)
+	mr.MergedAt = FromNullTime(mergedAt)
+	mr.ClosedAt = FromNullTime(closedAt)
+	return &mr, nil
+}
+
+// GetMergeRequest retrieves a merge request by its number within a repo.
+func (s *SQLiteStore) GetMergeRequest(repoID string, number int64) (*MergeRequest, error) {
+	query := `SELECT ` + mergeRequestColumns + ` WHERE m.repo_id = ? AND m.number = ?`
+
+	mr, err := scanMergeRequest(s.db.QueryRow(query, repoID, number))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get merge request: %w", err)
+	}
+	return mr, nil
+}
+
+// ListMergeRequests lists a repo's merge requests, newest first, optionally
+// limited to one status. The cursor is the number of the last merge request
+// on the previous page.
+func (s *SQLiteStore) ListMergeRequests(repoID, status, cursor string, limit int) ([]MergeRequest, error) {
+	query := `SELECT ` + mergeRequestColumns + `
+		WHERE m.repo_id = ?
+		  AND (? = '' OR m.status = ?)
+		  AND (? = '' OR m.number < CAST(? AS INTEGER))
+		ORDER BY m.number DESC
+		LIMIT ?
+	`
+
+	rows, err := s.db.Query(query, repoID, status, status, cursor, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query merge requests: %w", err)
+	}
+	defer rows.Close()
+
+	var mrs []MergeRequest
+	for rows.Next() {
+		mr, err := scanMergeRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan merge request: %w", err)
+		}
+		mrs = append(mrs, *mr)
+	}
+
+	return mrs, rows.Err()
+}
+
+// UpdateMergeRequest updates a merge request's editable fields and state.
+// Returns ErrDuplicateMergeRequest if reopening it would clash with another
+// open merge request.
+func (s *SQLiteStore) UpdateMergeRequest(mr *MergeRequest) error {
+	query := `
+		UPDATE merge_requests
+		SET title = ?, description = ?, target_branch = ?, status = ?,
+			source_sha = ?, target_sha = ?, merge_strategy = ?, merge_commit_sha = ?,
+			merged_by = ?, merged_at = ?, closed_at = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := s.db.Exec(query,
+		mr.Title,
+		mr.Description,
+		mr.TargetBranch,
+		mr.Status,
+		ToNullString(mr.SourceSHA),
+		ToNullString(mr.TargetSHA),
+		ToNullString(mr.MergeStrategy),
+		ToNullString(mr.MergeCommitSHA),
+		ToNullString(mr.MergedBy),
+		ToNullTime(mr.MergedAt),
+		ToNullTime(mr.ClosedAt),
+		mr.UpdatedAt,
+		mr.ID,
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicateMergeRequest
+		}
+		return fmt.Errorf("update merge request: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// CreateReviewThread creates a review thread with its first comment.
+func (s *SQLiteStore) CreateReviewThread(thread *ReviewThread, comment *ReviewComment) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO review_threads (
+			id, repo_id, commit_sha, base_sha, path, side, line, ref,
+			original_commit_sha, original_line, created_at, updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = tx.Exec(query,
+		thread.ID,
+		thread.RepoID,
+		thread.CommitSHA,
+		thread.BaseSHA,
+		thread.Path,
+		thread.Side,
+		thread.Line,
+		ToNullString(thread.Ref),
+		thread.OriginalCommitSHA,
+		thread.OriginalLine,
+		thread.CreatedAt,
+		thread.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert review thread: %w", err)
+	}
+
+	if err := insertReviewComment(tx, comment); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const reviewThreadColumns = `
+	id, repo_id, commit_sha, base_sha, path, side, line, ref,
+	original_commit_sha, original_line, outdated, resolved, resolved_by, resolved_at,
+	created_at, updated_at
+	FROM review_threads
+`
+
+func scanReviewThread(row rowScanner) (*ReviewThread, error) {
+	var thread ReviewThread
+	var ref, resolvedBy sql.NullString
+	var resolvedAt sql.NullTime
+
+	if err := row.Scan(
+		&thread.ID,
+		&thread.RepoID,
+		&thread.CommitSHA,
+		&thread.BaseSHA,
+		&thread.Path,
+		&thread.Side,
+		&thread.Line,
+		&ref,
+		&thread.OriginalCommitSHA,
+		&thread.OriginalLine,
+		&thread.Outdated,
+		&thread.Resolved,
+		&resolvedBy,
+		&resolvedAt,
+		&thread.CreatedAt,
+		&thread.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	thread.Ref = FromNullString(ref)
+	thread.ResolvedBy = FromNullString(resolvedBy)
+	thread.ResolvedAt = FromNullTime(resolvedAt)
+	thread.Comments = []ReviewComment{}
+	return &thread, nil
+}
+
+// GetReviewThread retrieves a review thread and its comments.
+func (s *SQLiteStore) GetReviewThread(repoID, id string) (*ReviewThread, error) {
+	query := `SELECT ` + reviewThreadColumns + ` WHERE repo_id = ? AND id = ?`
+
+	thread, err := scanReviewThread(s.db.QueryRow(query, repoID, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get review thread: %w", err)
+	}
+
+	threads := []ReviewThread{*thread}
+	if err := s.loadReviewComments(threads); err != nil {
+		return nil, err
+	}
+	return &threads[0], nil
+}
+
+// ListReviewThreads lists the review threads matching a query with their
+// comments, ordered by path and line.
+func (s *SQLiteStore) ListReviewThreads(q ReviewThreadQuery) ([]ReviewThread, error) {
+	query := `SELECT ` + reviewThreadColumns + ` WHERE repo_id = ?`
+	args := []any{q.RepoID}
+
+	if q.CommitSHA != "" {
+		query += ` AND commit_sha = ?`
+		args = append(args, q.CommitSHA)
+	}
+	if q.BaseSHA != nil {
+		query += ` AND base_sha = ?`
+		args = append(args, *q.BaseSHA)
+	}
+	if q.Path != "" {
+		query += ` AND path = ?`
+		args = append(args, q.Path)
+	}
+	if q.Ref != "" {
+		query += ` AND ref = ?`
+		args = append(args, q.Ref)
+	}
+	if q.ExcludeOutdated {
+		query += ` AND outdated = FALSE`
+	}
+	query += ` ORDER BY path, side, line, created_at, id`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query review threads: %w", err)
+	}
+	defer rows.Close()
+
+	var threads []ReviewThread
+	for rows.Next() {
+		thread, err := scanReviewThread(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan review thread: %w", err)
+		}
+		threads = append(threads, *thread)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadReviewComments(threads); err != nil {
+		return nil, err
+	}
+	return threads, nil
+}
+
+// loadReviewComments fills in the comments of each thread.
+func (s *SQLiteStore) loadReviewComments(threads []ReviewThread) error {
+	if len(threads) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(threads))
+	args := make([]any, len(threads))
+	for i, thread := range threads {
+		index[thread.ID] = i
+		args[i] = thread.ID
+	}
+
+	placeholders := strings.Repeat("?, ", len(threads)-1) + "?"
+	query := `SELECT ` + reviewCommentColumns + `
+		WHERE c.thread_id IN (` + placeholders + `)
+		ORDER BY c.created_at, c.id
+	`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("query review comments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		comment, err := scanReviewComment(rows)
+		if err != nil {
+			return fmt.Errorf("scan review comment: %w", err)
+		}
+		i := index[comment.ThreadID]
+		threads[i].Comments = append(threads[i].Comments, *comment)
+	}
+
+	return rows.Err()
+}
+
+// UpdateReviewThread updates a thread's anchor and its outdated and resolved state.
+func (s *SQLiteStore) UpdateReviewThread(thread *ReviewThread) error {
+	query := `
+		UPDATE review_threads
+		SET commit_sha = ?, line = ?, outdated = ?, resolved = ?, resolved_by = ?,
+			resolved_at = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := s.db.Exec(query,
+		thread.CommitSHA,
+		thread.Line,
+		thread.Outdated,
+		thread.Resolved,
+		ToNullString(thread.ResolvedBy),
+		ToNullTime(thread.ResolvedAt),
+		thread.UpdatedAt,
+		thread.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update review thread: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteReviewThread deletes a review thread and its comments.
+func (s *SQLiteStore) DeleteReviewThread(id string) error {
+	_, err := s.db.Exec("DELETE FROM review_threads WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete review thread: %w", err)
+	}
+	return nil
+}
+
+// CreateReviewComment adds a comment to a review thread.
+func (s *SQLiteStore) CreateReviewComment(comment *ReviewComment) error {
+	return insertReviewComment(s.db, comment)
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertReviewComment(db execer, comment *ReviewComment) error {
+	query := `
+		INSERT INTO review_comments (id, thread_id, author_id, body, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := db.Exec(query,
+		comment.ID,
+		comment.ThreadID,
+		ToNullString(comment.AuthorID),
+		comment.Body,
+		comment.CreatedAt,
+		comment.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert review comment: %w", err)
+	}
+	return nil
+}
+
+const reviewCommentColumns = `
+	c.id, c.thread_id, c.author_id, COALESCE(n.name, ''), c.body, c.created_at, c.updated_at
+	FROM review_comments c
+	LEFT JOIN users u ON u.id = c.author_id
+	LEFT JOIN namespaces n ON n.id = u.primary_namespace_id
+`
+
+func scanReviewComment(row rowScanner) (*ReviewComment, error) {
+	var comment ReviewComment
+	var authorID sql.NullString
+
+	if err := row.Scan(
+		&comment.ID,
+		&comment.ThreadID,
+		&authorID,
+		&comment.AuthorName,
+		&comment.Body,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	comment.AuthorID = FromNullString(authorID)
+	return &comment, nil
+}
+
+// GetReviewComment retrieves a comment of a review thread.
+func (s *SQLiteStore) GetReviewComment(threadID, id string) (*ReviewComment, error) {
+	query := `SELECT ` + reviewCommentColumns + ` WHERE c.thread_id = ? AND c.id = ?`
+
+	comment, err := scanReviewComment(s.db.QueryRow(query, threadID, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get review comment: %w", err)
+	}
+	return comment, nil
+}
+
+// UpdateReviewComment updates a comment's body.
+func (s *SQLiteStore) UpdateReviewComment(comment *ReviewComment) error {
+	result, err := s.db.Exec(
+		"UPDATE review_comments SET body = ?, updated_at = ? WHERE id = ?",
+		comment.Body, comment.UpdatedAt, comment.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update review comment: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteReviewComment deletes a comment, and its thread if no comments remain.
+func (s *SQLiteStore) DeleteReviewComment(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var threadID string
+	err = tx.QueryRow("DELETE FROM review_comments WHERE id = ? RETURNING thread_id", id).Scan(&threadID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("delete review comment: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM review_threads
+		WHERE id = ? AND NOT EXISTS (SELECT 1 FROM review_comments WHERE thread_id = ?)
+	`, threadID, threadID)
+	if err != nil {
+		return fmt.Errorf("delete empty review thread: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// CreateRelease creates a release. Returns ErrDuplicateRelease if the tag
+// already has one.
+func (s *SQLiteStore) CreateRelease(release *Release) error {
+	query := `
+		INSERT INTO releases (
+			id, repo_id, tag_name, title, notes, draft, prerelease, author_id,
+			published_at, created_at, updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		release.ID,
+		release.RepoID,
+		release.TagName,
+		release.Title,
+		release.Notes,
+		release.Draft,
+		release.Prerelease,
+		ToNullString(release.AuthorID),
+		ToNullTime(release.PublishedAt),
+		release.CreatedAt,
+		release.UpdatedAt,
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicateRelease
+		}
+		return fmt.Errorf("insert release: %w", err)
+	}
+	return nil
+}
+
+const releaseColumns = `
+	rl.id, rl.repo_id, rl.tag_name, rl.title, rl.notes, rl.draft, rl.prerelease,
+	rl.author_id, COALESCE(n.name, ''), rl.published_at, rl.created_at, rl.updated_at
+	FROM releases rl
+	LEFT JOIN users u ON u.id = rl.author_id
+	LEFT JOIN namespaces n ON n.id = u.primary_namespace_id
+`
+
+func scanRelease(row rowScanner) (*Release, error) {
+	var release Release
+	var authorID sql.NullString
+	var publishedAt sql.NullTime
+
+	if err := row.Scan(
+		&release.ID,
+		&release.RepoID,
+		&release.TagName,
+		&release.Title,
+		&release.Notes,
+		&release.Draft,
+		&release.Prerelease,
+		&authorID,
+		&release.AuthorName,
+		&publishedAt,
+		&release.CreatedAt,
+		&release.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	release.AuthorID = FromNullString(authorID)
+	release.PublishedAt = FromNullTime(publishedAt)
+	release.Assets = []ReleaseAsset{}
+	return &release, nil
+}
+
+// getRelease retrieves the release matching a condition on the releases
+// table, with its assets.
+func (s *SQLiteStore) getRelease(where string, args ...any) (*Release, error) {
+	release, err := scanRelease(s.db.QueryRow(`SELECT `+releaseColumns+` WHERE `+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get release: %w", err)
+	}
+
+	releases := []Release{*release}
+	if err := s.loadReleaseAssets(releases); err != nil {
+		return nil, err
+	}
+	return &releases[0], nil
+}
+
+// GetRelease retrieves a release of a repo and its assets.
+func (s *SQLiteStore) GetRelease(repoID, id string) (*Release, error) {
+	return s.getRelease(`rl.repo_id = ? AND rl.id = ?`, repoID, id)
+}
+
+// GetReleaseByTag retrieves the release of a tag and its assets.
+func (s *SQLiteStore) GetReleaseByTag(repoID, tag string) (*Release, error) {
+	return s.getRelease(`rl.repo_id = ? AND rl.tag_name = ?`, repoID, tag)
+}
+
+// ListReleases lists a repo's releases with their assets, newest first. The
+// cursor is the ID of the last release on the previous page.
+func (s *SQLiteStore) ListReleases(repoID string, includeDrafts bool, cursor string, limit int) ([]Release, error) {
+	query := `SELECT ` + releaseColumns + `
+		WHERE rl.repo_id = ?
+		  AND (? OR rl.draft = FALSE)
+		  AND (? = '' OR (rl.created_at, rl.id) < (SELECT created_at, id FROM releases WHERE id = ?))
+		ORDER BY rl.created_at DESC, rl.id DESC
+		LIMIT ?
+	`
+
+	rows, err := s.db.Query(query, repoID, includeDrafts, cursor, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query releases: %w", err)
+	}
+	defer rows.Close()
+
+	var releases []Release
+	for rows.Next() {
+		release, err := scanRelease(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan release: %w", err)
+		}
+		releases = append(releases, *release)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadReleaseAssets(releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// loadReleaseAssets fills in the assets of each release.
+func (s *SQLiteStore) loadReleaseAssets(releases []Release) error {
+	if len(releases) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(releases))
+	args := make([]any, len(releases))
+	for i, release := range releases {
+		index[release.ID] = i
+		args[i] = release.ID
+	}
+
+	placeholders := strings.Repeat("?, ", len(releases)-1) + "?"
+	query := `SELECT ` + releaseAssetColumns + `
+		WHERE release_id IN (` + placeholders + `)
+		ORDER BY created_at, id
+	`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("query release assets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		asset, err := scanReleaseAsset(rows)
+		if err != nil {
+			return fmt.Errorf("scan release asset: %w", err)
+		}
+		i := index[asset.ReleaseID]
+		releases[i].Assets = append(releases[i].Assets, *asset)
+	}
+
+	return rows.Err()
+}
+
+// UpdateRelease updates a release's tag, text and flags. Returns
+// ErrDuplicateRelease if the new tag already has a release.
+func (s *SQLiteStore) UpdateRelease(release *Release) error {
+	query := `
+		UPDATE releases
+		SET tag_name = ?, title = ?, notes = ?, draft = ?, prerelease = ?,
+			published_at = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := s.db.Exec(query,
+		release.TagName,
+		release.Title,
+		release.Notes,
+		release.Draft,
+		release.Prerelease,
+		ToNullTime(release.PublishedAt),
+		release.UpdatedAt,
+		release.ID,
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicateRelease
+		}
+		return fmt.Errorf("update release: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteRelease deletes a release and its asset records. Stored asset
+// content is left to the caller.
+func (s *SQLiteStore) DeleteRelease(id string) error {
+	_, err := s.db.Exec("DELETE FROM releases WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete release: %w", err)
+	}
+	return nil
+}
+
+// CreateReleaseAsset records an uploaded asset. Returns
+// ErrDuplicateReleaseAsset if the release already has an asset with the name.
+func (s *SQLiteStore) CreateReleaseAsset(asset *ReleaseAsset) error {
+	query := `
+		INSERT INTO release_assets (
+			id, release_id, repo_id, name, content_type, size, sha256, uploader_id, created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		asset.ID,
+		asset.ReleaseID,
+		asset.RepoID,
+		asset.Name,
+		asset.ContentType,
+		asset.Size,
+		asset.SHA256,
+		ToNullString(asset.UploaderID),
+		asset.CreatedAt,
+	)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrDuplicateReleaseAsset
+		}
+		return fmt.Errorf("insert release asset: %w", err)
+	}
+	return nil
+}
+
+const releaseAssetColumns = `
+	id, release_id, repo_id, name, content_type, size, sha256, uploader_id, created_at
+	FROM release_assets
+`
+
+func scanReleaseAsset(row rowScanner) (*ReleaseAsset, error) {
+	var asset ReleaseAsset
+	var uploaderID sql.NullString
+
+	if err := row.Scan(
+		&asset.ID,
+		&asset.ReleaseID,
+		&asset.RepoID,
+		&asset.Name,
+		&asset.ContentType,
+		&asset.Size,
+		&asset.SHA256,
+		&uploaderID,
+		&asset.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	asset.UploaderID = FromNullString(uploaderID)
+	return &asset, nil
+}
+
+// GetReleaseAsset retrieves an asset of a release.
+func (s *SQLiteStore) GetReleaseAsset(releaseID, id string) (*ReleaseAsset, error) {
+	query := `SELECT ` + releaseAssetColumns + ` WHERE release_id = ? AND id = ?`
+
+	asset, err := scanReleaseAsset(s.db.QueryRow(query, releaseID, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get release asset: %w", err)
+	}
+	return asset, nil
+}
+
+// ListRepoReleaseAssets lists the assets of every release of a repo.
+func (s *SQLiteStore) ListRepoReleaseAssets(repoID string) ([]ReleaseAsset, error) {
+	query := `SELECT ` + releaseAssetColumns + ` WHERE repo_id = ? ORDER BY created_at, id`
+
+	rows, err := s.db.Query(query, repoID)
+	if err != nil {
+		return nil, fmt.Errorf("query release assets: %w", err)
+	}
+	defer rows.Close()
+
+	var assets []ReleaseAsset
+	for rows.Next() {
+		asset, err := scanReleaseAsset(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan release asset: %w", err)
+		}
+		assets = append(assets, *asset)
+	}
+
+	return assets, rows.Err()
+}
+
+// CountReleaseAssetBlobs counts the assets of a repo stored as the given
+// content, so callers know when the stored object is no longer used.
+func (s *SQLiteStore) CountReleaseAssetBlobs(repoID, sha256 string) (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM release_assets WHERE repo_id = ? AND sha256 = ?", repoID, sha256,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count release assets: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteReleaseAsset deletes an asset record. Stored content is left to the
+// caller.
+func (s *SQLiteStore) DeleteReleaseAsset(id string) error {
+	_, err := s.db.Exec("DELETE FROM release_assets WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete release asset: %w", err)
+	}
+	return nil
+}
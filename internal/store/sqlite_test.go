@@ -21,6 +21,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/bantamhq/ephemeral/internal/core"
 )
 
 func newTestStore(t *testing.T) *SQLiteStore {
@@ -110,6 +112,20 @@ func TestStore_NamespaceLifecycle(t *testing.T) {
 		assert.Equal(t, "ns-1", got.ID)
 	})
 
+	t.Run("get by external ID", func(t *testing.T) {
+		externalID := "ext-1"
+		require.NoError(t, s.CreateNamespace(&Namespace{ID: "ns-ext", Name: "ext-ns", CreatedAt: time.Now(), ExternalID: &externalID}))
+
+		got, err := s.GetNamespaceByExternalID(externalID)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, "ns-ext", got.ID)
+
+		got, err = s.GetNamespaceByExternalID("missing")
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
 	t.Run("list", func(t *testing.T) {
 		namespaces, err := s.ListNamespaces("", 10)
 		require.NoError(t, err)
@@ -970,7 +986,7 @@ func TestStore_UserBoundTokens(t *testing.T) {
 	user := createTestUser(t, s, "user-tokens", ns.ID)
 
 	t.Run("generate user bound token", func(t *testing.T) {
-		rawToken, token, err := s.GenerateUserToken(user.ID, nil)
+		rawToken, token, err := s.GenerateUserToken(user.ID, nil, nil, nil)
 		require.NoError(t, err)
 		assert.NotEmpty(t, rawToken)
 		require.NotNil(t, token.UserID)
@@ -983,6 +999,26 @@ func TestStore_UserBoundTokens(t *testing.T) {
 		assert.Len(t, tokens, 1)
 	})
 
+	t.Run("named token records last use", func(t *testing.T) {
+		name := "laptop"
+		_, token, err := s.GenerateUserToken(user.ID, &name, nil, nil)
+		require.NoError(t, err)
+
+		got, err := s.GetTokenByID(token.ID)
+		require.NoError(t, err)
+		require.NotNil(t, got.Name)
+		assert.Equal(t, "laptop", *got.Name)
+		assert.Nil(t, got.LastUsedAt)
+
+		usedAt := time.Now().Truncate(time.Second)
+		require.NoError(t, s.UpdateTokenLastUsed(token.ID, usedAt))
+
+		got, err = s.GetTokenByID(token.ID)
+		require.NoError(t, err)
+		require.NotNil(t, got.LastUsedAt)
+		assert.True(t, usedAt.Equal(*got.LastUsedAt))
+	})
+
 	t.Run("token with user_id", func(t *testing.T) {
 		userID := user.ID
 		token := &Token{
@@ -1074,6 +1110,109 @@ func TestPermissionChecker_UserBoundTokenPermissions(t *testing.T) {
 	})
 }
 
+func TestPermissionChecker_ScopedTokens(t *testing.T) {
+	s := newTestStore(t)
+	ns := createTestNamespace(t, s, "ns-scoped")
+	otherNs := createTestNamespace(t, s, "ns-scoped-other")
+	repo := createTestRepo(t, s, ns.ID, "scoped-repo")
+	otherRepo := createTestRepo(t, s, ns.ID, "other-repo")
+	user := createTestUser(t, s, "user-scoped", ns.ID)
+
+	for _, nsID := range []string{ns.ID, otherNs.ID} {
+		require.NoError(t, s.UpsertNamespaceGrant(&NamespaceGrant{
+			UserID:      user.ID,
+			NamespaceID: nsID,
+			AllowBits:   PermNamespaceWrite | PermRepoAdmin,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}))
+	}
+
+	checker := NewPermissionChecker(s)
+
+	t.Run("scope round trips", func(t *testing.T) {
+		_, token, err := s.GenerateUserToken(user.ID, nil, nil, &TokenScope{
+			Allow:   PermRepoRead,
+			RepoIDs: []string{repo.ID},
+		})
+		require.NoError(t, err)
+
+		got, err := s.GetTokenByID(token.ID)
+		require.NoError(t, err)
+		require.NotNil(t, got.Scope)
+		assert.Equal(t, PermRepoRead, got.Scope.Allow)
+		assert.Equal(t, []string{repo.ID}, got.Scope.RepoIDs)
+		assert.Empty(t, got.Scope.NamespaceIDs)
+
+		_, unscoped, err := s.GenerateUserToken(user.ID, nil, nil, nil)
+		require.NoError(t, err)
+		got, err = s.GetTokenByID(unscoped.ID)
+		require.NoError(t, err)
+		assert.Nil(t, got.Scope)
+	})
+
+	t.Run("repo scope limits permission and repos", func(t *testing.T) {
+		_, token, err := s.GenerateUserToken(user.ID, nil, nil, &TokenScope{
+			Allow:   PermRepoRead,
+			RepoIDs: []string{repo.ID},
+		})
+		require.NoError(t, err)
+
+		has, err := checker.CheckRepoPermission(token.ID, repo, PermRepoRead)
+		require.NoError(t, err)
+		assert.True(t, has, "scoped token should read its repo")
+
+		has, err = checker.CheckRepoPermission(token.ID, repo, PermRepoWrite)
+		require.NoError(t, err)
+		assert.False(t, has, "read scope should not allow write")
+
+		has, err = checker.CheckRepoPermission(token.ID, otherRepo, PermRepoRead)
+		require.NoError(t, err)
+		assert.False(t, has, "scoped token should not read other repos")
+
+		has, err = checker.CheckNamespacePermission(token.ID, ns.ID, PermNamespaceRead)
+		require.NoError(t, err)
+		assert.False(t, has, "repo scope should not grant namespace access")
+
+		canAccess, err := checker.CanAccessNamespace(token.ID, ns.ID)
+		require.NoError(t, err)
+		assert.True(t, canAccess, "scoped token should see the namespace of its repo")
+
+		canAccess, err = checker.CanAccessNamespace(token.ID, otherNs.ID)
+		require.NoError(t, err)
+		assert.False(t, canAccess)
+	})
+
+	t.Run("namespace scope covers its repos", func(t *testing.T) {
+		_, token, err := s.GenerateUserToken(user.ID, nil, nil, &TokenScope{
+			NamespaceIDs: []string{ns.ID},
+		})
+		require.NoError(t, err)
+
+		has, err := checker.CheckRepoPermission(token.ID, otherRepo, PermRepoAdmin)
+		require.NoError(t, err)
+		assert.True(t, has, "scope without a permission mask keeps the user's grants")
+
+		has, err = checker.CheckNamespacePermission(token.ID, otherNs.ID, PermNamespaceRead)
+		require.NoError(t, err)
+		assert.False(t, has, "scoped token should not reach other namespaces")
+	})
+
+	t.Run("scope never widens grants", func(t *testing.T) {
+		require.NoError(t, s.DeleteNamespaceGrant(user.ID, otherNs.ID))
+
+		_, token, err := s.GenerateUserToken(user.ID, nil, nil, &TokenScope{
+			Allow:        PermNamespaceAdmin | PermRepoAdmin,
+			NamespaceIDs: []string{otherNs.ID},
+		})
+		require.NoError(t, err)
+
+		has, err := checker.CheckNamespacePermission(token.ID, otherNs.ID, PermNamespaceRead)
+		require.NoError(t, err)
+		assert.False(t, has)
+	})
+}
+
 func TestStore_UserCascadeDelete(t *testing.T) {
 	s := newTestStore(t)
 	userNs := createTestNamespace(t, s, "ns-user-cascade-primary")
@@ -1097,7 +1236,7 @@ func TestStore_UserCascadeDelete(t *testing.T) {
 		UpdatedAt: time.Now(),
 	}))
 
-	_, token, err := s.GenerateUserToken(user.ID, nil)
+	_, token, err := s.GenerateUserToken(user.ID, nil, nil, nil)
 	require.NoError(t, err)
 
 	t.Run("deleting user cascades grants and tokens", func(t *testing.T) {
@@ -1113,3 +1252,625 @@ func TestStore_UserCascadeDelete(t *testing.T) {
 		assert.Nil(t, tokenGot, "user-bound token should be deleted")
 	})
 }
+
+func TestStore_DeviceAuthSessions(t *testing.T) {
+	s := newTestStore(t)
+
+	now := time.Now()
+	code := "BCDFGHJK"
+	require.NoError(t, s.CreateAuthSession(&AuthSession{ID: "session-1", Status: "pending", UserCode: &code, CreatedAt: now, ExpiresAt: now.Add(time.Minute)}))
+	require.NoError(t, s.CreateAuthSession(&AuthSession{ID: "session-2", Status: "pending", CreatedAt: now, ExpiresAt: now.Add(time.Minute)}))
+	require.NoError(t, s.CreateAuthSession(&AuthSession{ID: "session-3", Status: "pending", CreatedAt: now, ExpiresAt: now.Add(time.Minute)}))
+
+	t.Run("get by user code", func(t *testing.T) {
+		got, err := s.GetAuthSessionByUserCode(code)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, "session-1", got.ID)
+		require.NotNil(t, got.UserCode)
+		assert.Equal(t, code, *got.UserCode)
+
+		got, err = s.GetAuthSessionByUserCode("MISSING1")
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("duplicate user code returns ErrDuplicateUserCode", func(t *testing.T) {
+		err := s.CreateAuthSession(&AuthSession{ID: "session-4", Status: "pending", UserCode: &code, CreatedAt: now, ExpiresAt: now.Add(time.Minute)})
+		assert.ErrorIs(t, err, ErrDuplicateUserCode)
+	})
+}
+
+func TestStore_CreateNamespaceWithOwner(t *testing.T) {
+	s := newTestStore(t)
+
+	now := time.Now()
+	externalID := "https://idp.example.com#subject-1"
+	create := func(id, name string) error {
+		return s.CreateNamespaceWithOwner(
+			&Namespace{ID: "ns-" + id, Name: name, CreatedAt: now, ExternalID: &externalID},
+			&User{ID: id, PrimaryNamespaceID: "ns-" + id, CreatedAt: now, UpdatedAt: now},
+			&NamespaceGrant{UserID: id, NamespaceID: "ns-" + id, AllowBits: DefaultNamespaceGrant(), CreatedAt: now, UpdatedAt: now},
+		)
+	}
+
+	require.NoError(t, create("user-1", "jane"))
+
+	user, err := s.GetUserByPrimaryNamespaceID("ns-user-1")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	grant, err := s.GetNamespaceGrant("user-1", "ns-user-1")
+	require.NoError(t, err)
+	require.NotNil(t, grant)
+
+	t.Run("duplicate external ID leaves nothing behind", func(t *testing.T) {
+		assert.ErrorIs(t, create("user-2", "jane-2"), ErrDuplicateNamespace)
+
+		ns, err := s.GetNamespace("ns-user-2")
+		require.NoError(t, err)
+		assert.Nil(t, ns)
+		user, err := s.GetUser("user-2")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	})
+
+	t.Run("duplicate name returns ErrDuplicateNamespace", func(t *testing.T) {
+		other := "https://idp.example.com#subject-2"
+		err := s.CreateNamespaceWithOwner(
+			&Namespace{ID: "ns-user-3", Name: "jane", CreatedAt: now, ExternalID: &other},
+			&User{ID: "user-3", PrimaryNamespaceID: "ns-user-3", CreatedAt: now, UpdatedAt: now},
+			&NamespaceGrant{UserID: "user-3", NamespaceID: "ns-user-3", AllowBits: DefaultNamespaceGrant(), CreatedAt: now, UpdatedAt: now},
+		)
+		assert.ErrorIs(t, err, ErrDuplicateNamespace)
+	})
+}
+
+func TestStore_SSHKeys(t *testing.T) {
+	s := newTestStore(t)
+	userNs := createTestNamespace(t, s, "ns-ssh-keys")
+	user := createTestUser(t, s, "user-ssh-keys", userNs.ID)
+
+	key := &SSHKey{
+		ID:          "key-1",
+		UserID:      user.ID,
+		KeyType:     "ssh-ed25519",
+		Fingerprint: "SHA256:abc",
+		PublicKey:   "ssh-ed25519 AAAA",
+		CreatedAt:   time.Now(),
+	}
+	require.NoError(t, s.CreateSSHKey(key))
+
+	t.Run("duplicate fingerprint returns ErrDuplicateSSHKey", func(t *testing.T) {
+		dup := *key
+		dup.ID = "key-2"
+		assert.ErrorIs(t, s.CreateSSHKey(&dup), ErrDuplicateSSHKey)
+	})
+
+	t.Run("deleting user cascades keys", func(t *testing.T) {
+		require.NoError(t, s.DeleteUser(user.ID))
+
+		got, err := s.GetSSHKeyByFingerprint(key.Fingerprint)
+		require.NoError(t, err)
+		assert.Nil(t, got, "ssh key should be deleted with its user")
+	})
+}
+
+func TestStore_DeployKeys(t *testing.T) {
+	s := newTestStore(t)
+	ns := createTestNamespace(t, s, "ns-deploy-keys")
+	user := createTestUser(t, s, "user-deploy-keys", ns.ID)
+
+	now := time.Now()
+	repo := &Repo{ID: "repo-deploy", NamespaceID: ns.ID, Name: "deploy", CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, s.CreateRepo(repo))
+
+	t.Run("token key is found by lookup", func(t *testing.T) {
+		key := &DeployKey{RepoID: repo.ID, Name: "ci", ReadOnly: true, CreatedAt: now}
+		raw, err := s.GenerateDeployKeyToken(key)
+		require.NoError(t, err)
+
+		lookup, _, err := core.ParseDeployToken(raw)
+		require.NoError(t, err)
+		got, err := s.GetDeployKeyByLookup(lookup)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, key.ID, got.ID)
+		assert.NoError(t, core.VerifyToken(raw, got.TokenHash))
+	})
+
+	t.Run("fingerprints are unique across user and deploy keys", func(t *testing.T) {
+		fingerprint := "SHA256:deploy"
+		keyType, publicKey := "ssh-ed25519", "ssh-ed25519 AAAA"
+		key := &DeployKey{
+			ID: "deploy-ssh", RepoID: repo.ID, Name: "prod",
+			KeyType: &keyType, Fingerprint: &fingerprint, PublicKey: &publicKey, CreatedAt: now,
+		}
+		require.NoError(t, s.CreateDeployKey(key))
+
+		userKey := &SSHKey{ID: "user-ssh", UserID: user.ID, KeyType: keyType, Fingerprint: fingerprint, PublicKey: publicKey, CreatedAt: now}
+		assert.ErrorIs(t, s.CreateSSHKey(userKey), ErrDuplicateSSHKey)
+	})
+
+	t.Run("access is limited to the key's repo and mode", func(t *testing.T) {
+		other := &Repo{ID: "repo-other", NamespaceID: ns.ID}
+		readOnly := &DeployKey{RepoID: repo.ID, ReadOnly: true}
+		readWrite := &DeployKey{RepoID: repo.ID}
+
+		assert.True(t, readOnly.AllowsRepo(repo, PermRepoRead))
+		assert.False(t, readOnly.AllowsRepo(repo, PermRepoWrite))
+		assert.True(t, readWrite.AllowsRepo(repo, PermRepoWrite))
+		assert.False(t, readWrite.AllowsRepo(repo, PermRepoAdmin))
+		assert.False(t, readWrite.AllowsRepo(other, PermRepoRead))
+	})
+
+	t.Run("deleting repo cascades keys", func(t *testing.T) {
+		require.NoError(t, s.DeleteRepo(repo.ID))
+
+		keys, err := s.ListRepoDeployKeys(repo.ID)
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+}
+
+func TestStore_NamespaceUsage(t *testing.T) {
+	s := newTestStore(t)
+	ns := createTestNamespace(t, s, "ns-usage")
+	other := createTestNamespace(t, s, "ns-usage-other")
+
+	now := time.Now()
+	for _, repo := range []*Repo{
+		{ID: "repo-a", NamespaceID: ns.ID, Name: "a", SizeBytes: 100, CreatedAt: now, UpdatedAt: now},
+		{ID: "repo-b", NamespaceID: ns.ID, Name: "b", SizeBytes: 50, CreatedAt: now, UpdatedAt: now},
+		{ID: "repo-c", NamespaceID: other.ID, Name: "c", SizeBytes: 1000, CreatedAt: now, UpdatedAt: now},
+	} {
+		require.NoError(t, s.CreateRepo(repo))
+	}
+
+	require.NoError(t, s.CreateLFSObject(&LFSObject{RepoID: "repo-a", OID: "oid-1", Size: 10, CreatedAt: now}))
+	require.NoError(t, s.CreateLFSObject(&LFSObject{RepoID: "repo-b", OID: "oid-2", Size: 5, CreatedAt: now}))
+	require.NoError(t, s.CreateLFSObject(&LFSObject{RepoID: "repo-c", OID: "oid-3", Size: 500, CreatedAt: now}))
+
+	require.NoError(t, s.CreateRelease(&Release{ID: "rel-a", RepoID: "repo-a", TagName: "v1", CreatedAt: now, UpdatedAt: now}))
+	for _, asset := range []*ReleaseAsset{
+		{ID: "asset-1", Name: "app.tar.gz", Size: 7, SHA256: "sha-1"},
+		{ID: "asset-2", Name: "copy.tar.gz", Size: 7, SHA256: "sha-1"},
+		{ID: "asset-3", Name: "app.zip", Size: 3, SHA256: "sha-2"},
+	} {
+		asset.ReleaseID, asset.RepoID, asset.ContentType, asset.CreatedAt = "rel-a", "repo-a", "application/octet-stream", now
+		require.NoError(t, s.CreateReleaseAsset(asset))
+	}
+
+	usage, err := s.GetNamespaceUsage(ns.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, usage.RepoCount)
+	assert.Equal(t, int64(150), usage.GitBytes)
+	assert.Equal(t, int64(15), usage.LFSBytes, "only LFS objects of the namespace's repos count")
+	assert.Equal(t, int64(10), usage.ReleaseBytes, "assets sharing content count once")
+	assert.Equal(t, int64(175), usage.StorageBytes())
+
+	empty := createTestNamespace(t, s, "ns-usage-empty")
+	usage, err = s.GetNamespaceUsage(empty.ID)
+	require.NoError(t, err)
+	assert.Equal(t, NamespaceUsage{}, *usage)
+}
+
+func TestStore_LFSLocks(t *testing.T) {
+	s := newTestStore(t)
+	ns := createTestNamespace(t, s, "ns-locks")
+	user := createTestUser(t, s, "user-locks", ns.ID)
+	repo := createTestRepo(t, s, ns.ID, "assets")
+
+	now := time.Now()
+	for i, id := range []string{"lock-b", "lock-a", "lock-c"} {
+		require.NoError(t, s.CreateLFSLock(&LFSLock{
+			ID:       id,
+			RepoID:   repo.ID,
+			Path:     id + ".bin",
+			OwnerID:  user.ID,
+			LockedAt: now.Add(time.Duration(i) * time.Second),
+		}))
+	}
+
+	t.Run("duplicate path returns ErrDuplicateLFSLock", func(t *testing.T) {
+		err := s.CreateLFSLock(&LFSLock{ID: "lock-dup", RepoID: repo.ID, Path: "lock-a.bin", OwnerID: user.ID, LockedAt: now})
+		assert.ErrorIs(t, err, ErrDuplicateLFSLock)
+	})
+
+	t.Run("list pages oldest first with owner name", func(t *testing.T) {
+		page, err := s.ListLFSLocks(repo.ID, "", "", 2)
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, "lock-b", page[0].ID)
+		assert.Equal(t, "lock-a", page[1].ID)
+		assert.Equal(t, ns.Name, page[0].OwnerName)
+
+		rest, err := s.ListLFSLocks(repo.ID, "", page[1].ID, 2)
+		require.NoError(t, err)
+		require.Len(t, rest, 1)
+		assert.Equal(t, "lock-c", rest[0].ID)
+	})
+}
+
+func TestStore_SearchDocuments(t *testing.T) {
+	s := newTestStore(t)
+	ns := createTestNamespace(t, s, "ns-search")
+	repo := createTestRepo(t, s, ns.ID, "search")
+
+	state := &SearchIndexState{RepoID: repo.ID, Ref: "refs/heads/main", CommitSHA: "abc123", IndexedAt: time.Now()}
+	require.NoError(t, s.ReplaceSearchDocuments(state, []SearchDocument{
+		{Path: "main.go", BlobSHA: "b1", Content: "func ParseConfig() {}"},
+		{Path: "README.md", BlobSHA: "b2", Content: "Say \"hello\" to the config parser"},
+	}))
+
+	t.Run("contains matches substrings ignoring case", func(t *testing.T) {
+		docs, err := s.SearchDocuments(SearchDocumentQuery{RepoIDs: []string{repo.ID}, Contains: "parseconf", Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "main.go", docs[0].Path)
+
+		docs, err = s.SearchDocuments(SearchDocumentQuery{RepoIDs: []string{repo.ID}, Contains: `"hello"`, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "README.md", docs[0].Path)
+	})
+
+	t.Run("pages by ID", func(t *testing.T) {
+		page, err := s.SearchDocuments(SearchDocumentQuery{RepoIDs: []string{repo.ID}, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+
+		rest, err := s.SearchDocuments(SearchDocumentQuery{RepoIDs: []string{repo.ID}, AfterID: page[0].ID, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, rest, 1)
+		assert.NotEqual(t, page[0].Path, rest[0].Path)
+	})
+
+	t.Run("replacing drops old documents", func(t *testing.T) {
+		state.CommitSHA = "def456"
+		require.NoError(t, s.ReplaceSearchDocuments(state, []SearchDocument{{Path: "main.go", BlobSHA: "b3", Content: "package main"}}))
+
+		docs, err := s.SearchDocuments(SearchDocumentQuery{RepoIDs: []string{repo.ID}, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "b3", docs[0].BlobSHA)
+
+		got, err := s.GetSearchIndexState(repo.ID)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, "def456", got.CommitSHA)
+	})
+
+	t.Run("deleting the repo drops its documents", func(t *testing.T) {
+		require.NoError(t, s.DeleteRepo(repo.ID))
+
+		var count int
+		require.NoError(t, s.db.QueryRow("SELECT COUNT(*) FROM search_documents").Scan(&count))
+		assert.Zero(t, count)
+	})
+}
+
+func TestStore_MergeRequests(t *testing.T) {
+	s := newTestStore(t)
+	ns := createTestNamespace(t, s, "ns-mrs")
+	user := createTestUser(t, s, "user-mrs", ns.ID)
+	repo := createTestRepo(t, s, ns.ID, "app")
+	other := createTestRepo(t, s, ns.ID, "other")
+
+	now := time.Now()
+	newMR := func(id string, repo *Repo, source string) *MergeRequest {
+		return &MergeRequest{
+			ID:           id,
+			RepoID:       repo.ID,
+			Title:        "Merge " + source,
+			SourceBranch: source,
+			TargetBranch: "main",
+			Status:       MergeRequestOpen,
+			AuthorID:     &user.ID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+	}
+
+	first := newMR("mr-1", repo, "feature-a")
+	require.NoError(t, s.CreateMergeRequest(first))
+	second := newMR("mr-2", repo, "feature-b")
+	require.NoError(t, s.CreateMergeRequest(second))
+	elsewhere := newMR("mr-3", other, "feature-a")
+	require.NoError(t, s.CreateMergeRequest(elsewhere))
+
+	assert.Equal(t, int64(1), first.Number)
+	assert.Equal(t, int64(2), second.Number)
+	assert.Equal(t, int64(1), elsewhere.Number, "numbers are per repo")
+
+	t.Run("one open merge request per branch pair", func(t *testing.T) {
+		err := s.CreateMergeRequest(newMR("mr-dup", repo, "feature-a"))
+		assert.ErrorIs(t, err, ErrDuplicateMergeRequest)
+	})
+
+	t.Run("get fills author name", func(t *testing.T) {
+		got, err := s.GetMergeRequest(repo.ID, 2)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, "mr-2", got.ID)
+		assert.Equal(t, ns.Name, got.AuthorName)
+
+		missing, err := s.GetMergeRequest(repo.ID, 99)
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+	})
+
+	t.Run("closing frees the branch pair", func(t *testing.T) {
+		closedAt := now.Add(time.Minute)
+		first.Status = MergeRequestClosed
+		first.ClosedAt = &closedAt
+		first.UpdatedAt = closedAt
+		require.NoError(t, s.UpdateMergeRequest(first))
+
+		require.NoError(t, s.CreateMergeRequest(newMR("mr-4", repo, "feature-a")))
+
+		first.Status = MergeRequestOpen
+		assert.ErrorIs(t, s.UpdateMergeRequest(first), ErrDuplicateMergeRequest, "cannot reopen over an open duplicate")
+	})
+
+	t.Run("list pages newest first and filters by status", func(t *testing.T) {
+		page, err := s.ListMergeRequests(repo.ID, "", "", 2)
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, int64(3), page[0].Number)
+		assert.Equal(t, int64(2), page[1].Number)
+
+		rest, err := s.ListMergeRequests(repo.ID, "", "2", 2)
+		require.NoError(t, err)
+		require.Len(t, rest, 1)
+		assert.Equal(t, int64(1), rest[0].Number)
+
+		closed, err := s.ListMergeRequests(repo.ID, MergeRequestClosed, "", 10)
+		require.NoError(t, err)
+		require.Len(t, closed, 1)
+		assert.Equal(t, "mr-1", closed[0].ID)
+	})
+}
+
+func TestStore_InitializeAddsMissingColumns(t *testing.T) {
+	s, err := NewSQLiteStore(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	// A repos table from before pull mirrors existed.
+	_, err = s.db.Exec(`CREATE TABLE repos (
+		id TEXT PRIMARY KEY,
+		namespace_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT,
+		public BOOLEAN DEFAULT FALSE,
+		size_bytes INTEGER DEFAULT 0,
+		last_push_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Initialize())
+	require.NoError(t, s.Initialize(), "initialize is idempotent")
+
+	ns := createTestNamespace(t, s, "ns-legacy")
+	repo := createTestRepo(t, s, ns.ID, "legacy")
+	require.NoError(t, s.UpdateRepoMirror(repo.ID, &RepoMirror{URL: "https://example.com/repo.git", IntervalSeconds: 60}))
+
+	due, err := s.ListDueRepoMirrors(time.Now(), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, MirrorStatusPending, due[0].Mirror.Status)
+}
+
+func TestStore_ReviewThreads(t *testing.T) {
+	s := newTestStore(t)
+	ns := createTestNamespace(t, s, "ns-reviews")
+	user := createTestUser(t, s, "user-reviews", ns.ID)
+	repo := createTestRepo(t, s, ns.ID, "app")
+
+	now := time.Now()
+	feature := "feature"
+	newThread := func(id, commit, path string, line int, ref *string) (*ReviewThread, *ReviewComment) {
+		thread := &ReviewThread{
+			ID:                id,
+			RepoID:            repo.ID,
+			CommitSHA:         commit,
+			BaseSHA:           "base",
+			Path:              path,
+			Side:              ReviewSideNew,
+			Line:              line,
+			Ref:               ref,
+			OriginalCommitSHA: commit,
+			OriginalLine:      line,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		}
+		comment := &ReviewComment{
+			ID:        id + "-c1",
+			ThreadID:  id,
+			AuthorID:  &user.ID,
+			Body:      "Comment on " + path,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		return thread, comment
+	}
+
+	require.NoError(t, s.CreateReviewThread(newThread("t-1", "c1", "b.go", 3, &feature)))
+	require.NoError(t, s.CreateReviewThread(newThread("t-2", "c1", "a.go", 7, nil)))
+	require.NoError(t, s.CreateReviewThread(newThread("t-3", "c2", "a.go", 1, &feature)))
+
+	reply := &ReviewComment{ID: "t-1-c2", ThreadID: "t-1", AuthorID: &user.ID, Body: "Reply", CreatedAt: now.Add(time.Second), UpdatedAt: now.Add(time.Second)}
+	require.NoError(t, s.CreateReviewComment(reply))
+
+	t.Run("get includes comments in order", func(t *testing.T) {
+		thread, err := s.GetReviewThread(repo.ID, "t-1")
+		require.NoError(t, err)
+		require.NotNil(t, thread)
+		require.Len(t, thread.Comments, 2)
+		assert.Equal(t, "t-1-c1", thread.Comments[0].ID)
+		assert.Equal(t, "Reply", thread.Comments[1].Body)
+		assert.Equal(t, ns.Name, thread.Comments[0].AuthorName)
+
+		missing, err := s.GetReviewThread("other-repo", "t-1")
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+	})
+
+	t.Run("list filters by diff and ref", func(t *testing.T) {
+		base := "base"
+		threads, err := s.ListReviewThreads(ReviewThreadQuery{RepoID: repo.ID, CommitSHA: "c1", BaseSHA: &base})
+		require.NoError(t, err)
+		require.Len(t, threads, 2)
+		assert.Equal(t, "a.go", threads[0].Path, "ordered by path")
+		assert.Len(t, threads[1].Comments, 2)
+
+		root := ""
+		threads, err = s.ListReviewThreads(ReviewThreadQuery{RepoID: repo.ID, CommitSHA: "c1", BaseSHA: &root})
+		require.NoError(t, err)
+		assert.Empty(t, threads)
+
+		threads, err = s.ListReviewThreads(ReviewThreadQuery{RepoID: repo.ID, Ref: "feature"})
+		require.NoError(t, err)
+		assert.Len(t, threads, 2)
+	})
+
+	t.Run("update moves and resolves threads", func(t *testing.T) {
+		thread, err := s.GetReviewThread(repo.ID, "t-3")
+		require.NoError(t, err)
+
+		resolvedAt := now.Add(time.Minute)
+		thread.CommitSHA = "c3"
+		thread.Line = 4
+		thread.Outdated = true
+		thread.Resolved = true
+		thread.ResolvedBy = &user.ID
+		thread.ResolvedAt = &resolvedAt
+		require.NoError(t, s.UpdateReviewThread(thread))
+
+		got, err := s.GetReviewThread(repo.ID, "t-3")
+		require.NoError(t, err)
+		assert.Equal(t, "c3", got.CommitSHA)
+		assert.Equal(t, 4, got.Line)
+		assert.Equal(t, "c2", got.OriginalCommitSHA)
+		assert.Equal(t, 1, got.OriginalLine)
+		assert.True(t, got.Outdated)
+		assert.True(t, got.Resolved)
+
+		threads, err := s.ListReviewThreads(ReviewThreadQuery{RepoID: repo.ID, Ref: "feature", ExcludeOutdated: true})
+		require.NoError(t, err)
+		require.Len(t, threads, 1)
+		assert.Equal(t, "t-1", threads[0].ID)
+	})
+
+	t.Run("deleting the last comment deletes the thread", func(t *testing.T) {
+		require.NoError(t, s.DeleteReviewComment("t-1-c1"))
+		thread, err := s.GetReviewThread(repo.ID, "t-1")
+		require.NoError(t, err)
+		require.NotNil(t, thread)
+		assert.Len(t, thread.Comments, 1)
+
+		require.NoError(t, s.DeleteReviewComment("t-1-c2"))
+		thread, err = s.GetReviewThread(repo.ID, "t-1")
+		require.NoError(t, err)
+		assert.Nil(t, thread)
+	})
+}
+
+func TestStore_Releases(t *testing.T) {
+	s := newTestStore(t)
+	ns := createTestNamespace(t, s, "ns-releases")
+	user := createTestUser(t, s, "user-releases", ns.ID)
+	repo := createTestRepo(t, s, ns.ID, "app")
+
+	now := time.Now()
+	newRelease := func(id, tag string, draft bool, createdAt time.Time) *Release {
+		release := &Release{
+			ID:        id,
+			RepoID:    repo.ID,
+			TagName:   tag,
+			Title:     "Release " + tag,
+			Draft:     draft,
+			AuthorID:  &user.ID,
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		}
+		if !draft {
+			release.PublishedAt = &createdAt
+		}
+		return release
+	}
+
+	v1 := newRelease("rel-1", "v1.0.0", false, now)
+	require.NoError(t, s.CreateRelease(v1))
+	require.NoError(t, s.CreateRelease(newRelease("rel-2", "v1.1.0", false, now.Add(time.Minute))))
+	require.NoError(t, s.CreateRelease(newRelease("rel-3", "v2.0.0", true, now.Add(2*time.Minute))))
+
+	assert.ErrorIs(t, s.CreateRelease(newRelease("rel-dup", "v1.0.0", false, now)), ErrDuplicateRelease)
+
+	asset := &ReleaseAsset{
+		ID:          "asset-1",
+		ReleaseID:   v1.ID,
+		RepoID:      repo.ID,
+		Name:        "app.tar.gz",
+		ContentType: "application/gzip",
+		Size:        42,
+		SHA256:      "abc",
+		UploaderID:  &user.ID,
+		CreatedAt:   now,
+	}
+	require.NoError(t, s.CreateReleaseAsset(asset))
+	dup := *asset
+	dup.ID = "asset-dup"
+	assert.ErrorIs(t, s.CreateReleaseAsset(&dup), ErrDuplicateReleaseAsset)
+
+	t.Run("get fills author and assets", func(t *testing.T) {
+		got, err := s.GetReleaseByTag(repo.ID, "v1.0.0")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, v1.ID, got.ID)
+		assert.Equal(t, ns.Name, got.AuthorName)
+		require.Len(t, got.Assets, 1)
+		assert.Equal(t, "app.tar.gz", got.Assets[0].Name)
+
+		missing, err := s.GetRelease(repo.ID, "nope")
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+	})
+
+	t.Run("list pages newest first and hides drafts", func(t *testing.T) {
+		page, err := s.ListReleases(repo.ID, true, "", 2)
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, "rel-3", page[0].ID)
+		assert.Equal(t, "rel-2", page[1].ID)
+
+		rest, err := s.ListReleases(repo.ID, true, "rel-2", 2)
+		require.NoError(t, err)
+		require.Len(t, rest, 1)
+		assert.Equal(t, "rel-1", rest[0].ID)
+		assert.Len(t, rest[0].Assets, 1)
+
+		published, err := s.ListReleases(repo.ID, false, "", 10)
+		require.NoError(t, err)
+		assert.Len(t, published, 2)
+	})
+
+	t.Run("update rejects a tag with a release", func(t *testing.T) {
+		v1.TagName = "v1.1.0"
+		assert.ErrorIs(t, s.UpdateRelease(v1), ErrDuplicateRelease)
+	})
+
+	t.Run("deleting a release deletes its assets", func(t *testing.T) {
+		count, err := s.CountReleaseAssetBlobs(repo.ID, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+
+		require.NoError(t, s.DeleteRelease(v1.ID))
+
+		assets, err := s.ListRepoReleaseAssets(repo.ID)
+		require.NoError(t, err)
+		assert.Empty(t, assets)
+	})
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"time"
 )
@@ -8,6 +9,8 @@ import (
 // Store defines the database interface.
 type Store interface {
 	Initialize() error
+	Backup(ctx context.Context, dstPath string) error
+	CheckIntegrity() error
 
 	// Token operations
 	CreateToken(token *Token) error
@@ -28,13 +31,15 @@ type Store interface {
 
 	// User token operations
 	ListUserTokens(userID string) ([]Token, error)
-	GenerateUserToken(userID string, expiresAt *time.Time) (rawToken string, token *Token, err error)
+	GenerateUserToken(userID string, name *string, expiresAt *time.Time, scope *TokenScope) (rawToken string, token *Token, err error)
+	UpdateTokenLastUsed(id string, usedAt time.Time) error
 
 	// Namespace grant operations (user-level)
 	UpsertNamespaceGrant(grant *NamespaceGrant) error
 	DeleteNamespaceGrant(userID, namespaceID string) error
 	GetNamespaceGrant(userID, namespaceID string) (*NamespaceGrant, error)
 	ListUserNamespaceGrants(userID string) ([]NamespaceGrant, error)
+	ListNamespaceGrants(namespaceID string) ([]NamespaceGrant, error)
 	CountNamespaceUsers(namespaceID string) (int, error)
 
 	// Repo grant operations (user-level)
@@ -42,6 +47,7 @@ type Store interface {
 	DeleteRepoGrant(userID, repoID string) error
 	GetRepoGrant(userID, repoID string) (*RepoGrant, error)
 	ListUserRepoGrants(userID string) ([]RepoGrant, error)
+	ListNamespaceRepoGrants(namespaceID string) ([]RepoGrant, error)
 	ListUserReposWithGrants(userID, namespaceID string) ([]Repo, error)
 	ListAllUserAccessibleRepos(userID string) ([]Repo, error)
 	HasRepoGrantsInNamespace(userID, namespaceID string) (bool, error)
@@ -57,6 +63,11 @@ type Store interface {
 	UpdateRepoLastPush(id string, pushTime time.Time) error
 	UpdateRepoSize(id string, sizeBytes int64) error
 
+	// Repo mirror operations
+	UpdateRepoMirror(id string, mirror *RepoMirror) error
+	RecordRepoMirrorSync(id string, syncedAt, nextSyncAt time.Time, syncErr *string) error
+	ListDueRepoMirrors(now time.Time, limit int) ([]Repo, error)
+
 	// Folder operations
 	CreateFolder(folder *Folder) error
 	GetFolderByID(id string) (*Folder, error)
@@ -76,11 +87,14 @@ type Store interface {
 
 	// Namespace operations
 	CreateNamespace(ns *Namespace) error
+	CreateNamespaceWithOwner(ns *Namespace, user *User, grant *NamespaceGrant) error
 	GetNamespace(id string) (*Namespace, error)
 	GetNamespaceByName(name string) (*Namespace, error)
+	GetNamespaceByExternalID(externalID string) (*Namespace, error)
 	ListNamespaces(cursor string, limit int) ([]Namespace, error)
 	UpdateNamespace(ns *Namespace) error
 	DeleteNamespace(id string) error
+	GetNamespaceUsage(namespaceID string) (*NamespaceUsage, error)
 
 	// LFS object operations
 	CreateLFSObject(obj *LFSObject) error
@@ -92,10 +106,106 @@ type Store interface {
 	// Auth session operations
 	CreateAuthSession(session *AuthSession) error
 	GetAuthSession(id string) (*AuthSession, error)
+	GetAuthSessionByUserCode(userCode string) (*AuthSession, error)
 	CompleteAuthSession(id string, userID string, token string) error
 	DeleteAuthSession(id string) error
 	DeleteExpiredAuthSessions() error
 
+	// SSH key operations
+	CreateSSHKey(key *SSHKey) error
+	GetSSHKey(id string) (*SSHKey, error)
+	GetSSHKeyByFingerprint(fingerprint string) (*SSHKey, error)
+	ListUserSSHKeys(userID string) ([]SSHKey, error)
+	DeleteSSHKey(id string) error
+	UpdateSSHKeyLastUsed(id string, usedAt time.Time) error
+
+	// Deploy key operations
+	CreateDeployKey(key *DeployKey) error
+	GenerateDeployKeyToken(key *DeployKey) (string, error)
+	GetDeployKey(id string) (*DeployKey, error)
+	GetDeployKeyByLookup(lookup string) (*DeployKey, error)
+	GetDeployKeyByFingerprint(fingerprint string) (*DeployKey, error)
+	ListRepoDeployKeys(repoID string) ([]DeployKey, error)
+	DeleteDeployKey(id string) error
+	UpdateDeployKeyLastUsed(id string, usedAt time.Time) error
+
+	// Branch protection operations
+	CreateBranchProtection(rule *BranchProtection) error
+	GetBranchProtection(id string) (*BranchProtection, error)
+	ListBranchProtections(repoID string) ([]BranchProtection, error)
+	UpdateBranchProtection(rule *BranchProtection) error
+	DeleteBranchProtection(id string) error
+
+	// Webhook operations
+	CreateWebhook(hook *Webhook) error
+	GetWebhook(id string) (*Webhook, error)
+	ListRepoWebhooks(repoID string) ([]Webhook, error)
+	ListNamespaceWebhooks(namespaceID string) ([]Webhook, error)
+	ListActiveWebhooksForRepo(repoID, namespaceID string) ([]Webhook, error)
+	UpdateWebhook(hook *Webhook) error
+	DeleteWebhook(id string) error
+
+	// Webhook delivery operations
+	CreateWebhookDelivery(delivery *WebhookDelivery) error
+	GetWebhookDelivery(id string) (*WebhookDelivery, error)
+	ListWebhookDeliveries(webhookID, cursor string, limit int) ([]WebhookDelivery, error)
+	ListDueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(delivery *WebhookDelivery) error
+
+	// Push event operations
+	CreatePushEvents(events []PushEvent) error
+	ListRepoPushEvents(repoID, cursor string, limit int) ([]PushEvent, error)
+
+	// LFS lock operations
+	CreateLFSLock(lock *LFSLock) error
+	GetLFSLock(repoID, id string) (*LFSLock, error)
+	ListLFSLocks(repoID, path, cursor string, limit int) ([]LFSLock, error)
+	DeleteLFSLock(id string) error
+
+	// Push mirror operations
+	CreatePushMirror(mirror *PushMirror) error
+	GetPushMirror(repoID, id string) (*PushMirror, error)
+	ListPushMirrors(repoID string) ([]PushMirror, error)
+	DeletePushMirror(id string) error
+	QueuePushMirrors(repoID string, now time.Time) error
+	ListDuePushMirrors(now time.Time, limit int) ([]PushMirror, error)
+	RecordPushMirrorAttempt(mirror *PushMirror) (bool, error)
+
+	// Code search operations
+	GetSearchIndexState(repoID string) (*SearchIndexState, error)
+	ReplaceSearchDocuments(state *SearchIndexState, docs []SearchDocument) error
+	SearchDocuments(query SearchDocumentQuery) ([]SearchDocument, error)
+
+	// Merge request operations
+	CreateMergeRequest(mr *MergeRequest) error
+	GetMergeRequest(repoID string, number int64) (*MergeRequest, error)
+	ListMergeRequests(repoID, status, cursor string, limit int) ([]MergeRequest, error)
+	UpdateMergeRequest(mr *MergeRequest) error
+
+	// Review thread operations
+	CreateReviewThread(thread *ReviewThread, comment *ReviewComment) error
+	GetReviewThread(repoID, id string) (*ReviewThread, error)
+	ListReviewThreads(q ReviewThreadQuery) ([]ReviewThread, error)
+	UpdateReviewThread(thread *ReviewThread) error
+	DeleteReviewThread(id string) error
+	CreateReviewComment(comment *ReviewComment) error
+	GetReviewComment(threadID, id string) (*ReviewComment, error)
+	UpdateReviewComment(comment *ReviewComment) error
+	DeleteReviewComment(id string) error
+
+	// Release operations
+	CreateRelease(release *Release) error
+	GetRelease(repoID, id string) (*Release, error)
+	GetReleaseByTag(repoID, tag string) (*Release, error)
+	ListReleases(repoID string, includeDrafts bool, cursor string, limit int) ([]Release, error)
+	UpdateRelease(release *Release) error
+	DeleteRelease(id string) error
+	CreateReleaseAsset(asset *ReleaseAsset) error
+	GetReleaseAsset(releaseID, id string) (*ReleaseAsset, error)
+	ListRepoReleaseAssets(repoID string) ([]ReleaseAsset, error)
+	CountReleaseAssetBlobs(repoID, sha256 string) (int, error)
+	DeleteReleaseAsset(id string) error
+
 	Close() error
 }
 
@@ -108,15 +218,35 @@ type Namespace struct {
 	ExternalID        *string   `json:"external_id,omitempty"`
 }
 
+// NamespaceUsage is the resource usage counted against a namespace's quotas.
+type NamespaceUsage struct {
+	RepoCount    int   `json:"repo_count"`
+	GitBytes     int64 `json:"git_bytes"`
+	LFSBytes     int64 `json:"lfs_bytes"`
+	ReleaseBytes int64 `json:"release_bytes"`
+}
+
+// StorageBytes is the total storage counted against StorageLimitBytes.
+func (u NamespaceUsage) StorageBytes() int64 {
+	return u.GitBytes + u.LFSBytes + u.ReleaseBytes
+}
+
 type Token struct {
 	ID          string     `json:"id"`
 	TokenHash   string     `json:"-"`
 	TokenLookup string     `json:"-"`
 	IsAdmin     bool       `json:"is_admin"`
 	UserID      *string    `json:"user_id,omitempty"`
+	Name        *string    `json:"name,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
 	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	// Scope limits a user token to part of its user's access. Nil means the
+	// token has all of the user's permissions.
+	Scope *TokenScope `json:"-"`
+	// DeployKey is set when git over HTTP authenticated with a deploy key
+	// token. Such tokens have no row in the tokens table.
+	DeployKey *DeployKey `json:"-"`
 }
 
 // User represents a user that can have multiple tokens sharing permissions.
@@ -157,6 +287,27 @@ type Repo struct {
 	LastPushAt  *time.Time `json:"last_push_at,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
+	// Mirror is set when the repo is a read-only pull mirror of an upstream remote.
+	Mirror *RepoMirror `json:"mirror,omitempty"`
+}
+
+// Mirror sync statuses.
+const (
+	MirrorStatusPending   = "pending"
+	MirrorStatusSucceeded = "succeeded"
+	MirrorStatusFailed    = "failed"
+)
+
+// RepoMirror is the pull mirror config and sync state of a repo.
+type RepoMirror struct {
+	URL             string `json:"url"`
+	IntervalSeconds int    `json:"interval_seconds"`
+	// Credentials names a server-configured credential used to fetch from URL.
+	Credentials *string    `json:"credentials,omitempty"`
+	Status      string     `json:"status"`
+	LastError   *string    `json:"last_error,omitempty"`
+	LastSyncAt  *time.Time `json:"last_sync_at,omitempty"`
+	NextSyncAt  *time.Time `json:"next_sync_at,omitempty"`
 }
 
 type Folder struct {
@@ -179,15 +330,303 @@ type LFSObject struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// AuthSession is a pending CLI login, completed with a token once the user
+// authenticates. Device logins also have a UserCode the user approves.
 type AuthSession struct {
 	ID        string    `json:"id"`
 	UserID    *string   `json:"user_id,omitempty"`
 	Token     *string   `json:"token,omitempty"`
 	Status    string    `json:"status"`
+	UserCode  *string   `json:"user_code,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
+// SSHKey is a public key registered by a user for git over SSH.
+type SSHKey struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Name        *string    `json:"name,omitempty"`
+	KeyType     string     `json:"key_type"`
+	Fingerprint string     `json:"fingerprint"`
+	PublicKey   string     `json:"public_key"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// DeployKey is a credential bound to a single repo rather than a user, for
+// deployment servers and CI. It is either a token, used over HTTP, or an SSH
+// public key.
+type DeployKey struct {
+	ID          string     `json:"id"`
+	RepoID      string     `json:"repo_id"`
+	Name        string     `json:"name"`
+	ReadOnly    bool       `json:"read_only"`
+	TokenHash   string     `json:"-"`
+	TokenLookup string     `json:"-"`
+	KeyType     *string    `json:"key_type,omitempty"`
+	Fingerprint *string    `json:"fingerprint,omitempty"`
+	PublicKey   *string    `json:"public_key,omitempty"`
+	CreatedBy   *string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// BranchProtection restricts how matching branches of a repo may be updated.
+type BranchProtection struct {
+	ID                   string     `json:"id"`
+	RepoID               string     `json:"repo_id"`
+	Pattern              string     `json:"pattern"`
+	BlockForcePush       bool       `json:"block_force_push"`
+	BlockDeletion        bool       `json:"block_deletion"`
+	RequireLinearHistory bool       `json:"require_linear_history"`
+	PushPermission       Permission `json:"push_permission"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook is an outgoing HTTP callback. Exactly one of RepoID and NamespaceID is
+// set; namespace hooks fire for every repo in the namespace.
+type Webhook struct {
+	ID          string    `json:"id"`
+	RepoID      *string   `json:"repo_id,omitempty"`
+	NamespaceID *string   `json:"namespace_id,omitempty"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"-"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is a single event queued for a webhook, along with the
+// outcome of its most recent attempt.
+type WebhookDelivery struct {
+	ID             string     `json:"id"`
+	WebhookID      string     `json:"webhook_id"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	ResponseBody   *string    `json:"response_body,omitempty"`
+	Error          *string    `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// PushEvent records a single ref update made by a git push.
+type PushEvent struct {
+	ID          string    `json:"id"`
+	RepoID      string    `json:"repo_id"`
+	Ref         string    `json:"ref"`
+	OldSHA      string    `json:"old_sha"`
+	NewSHA      string    `json:"new_sha"`
+	UserID      *string   `json:"user_id,omitempty"`
+	TokenID     *string   `json:"token_id,omitempty"`
+	DeployKeyID *string   `json:"deploy_key_id,omitempty"`
+	Forced      bool      `json:"forced"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// LFSLock is a Git LFS file lock held by a user on a path in a repo.
+type LFSLock struct {
+	ID      string  `json:"id"`
+	RepoID  string  `json:"repo_id"`
+	Path    string  `json:"path"`
+	OwnerID string  `json:"owner_id"`
+	Ref     *string `json:"ref,omitempty"`
+	// OwnerName is the owner's primary namespace name, filled in on reads.
+	OwnerName string    `json:"owner_name"`
+	LockedAt  time.Time `json:"locked_at"`
+}
+
+// PushMirror is a downstream remote that receives every push to a repo.
+// Status uses the MirrorStatus values.
+type PushMirror struct {
+	ID     string `json:"id"`
+	RepoID string `json:"repo_id"`
+	URL    string `json:"url"`
+	// Credentials names a server-configured credential used to push to URL.
+	Credentials   *string    `json:"credentials,omitempty"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     *string    `json:"last_error,omitempty"`
+	LastSyncAt    *time.Time `json:"last_sync_at,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// Generation changes whenever a push is queued, so an attempt that
+	// started before the latest push does not mark the mirror up to date.
+	Generation int64 `json:"-"`
+}
+
+// SearchIndexState records which commit of a repo's default branch the code
+// search index reflects. CommitSHA is empty while the branch has no commits.
+type SearchIndexState struct {
+	RepoID    string    `json:"repo_id"`
+	Ref       string    `json:"ref"`
+	CommitSHA string    `json:"commit_sha"`
+	IndexedAt time.Time `json:"indexed_at"`
+}
+
+// SearchDocument is a file from a repo's default branch in the code search index.
+type SearchDocument struct {
+	// ID orders documents and is used as the search cursor.
+	ID      int64  `json:"-"`
+	RepoID  string `json:"repo_id"`
+	Path    string `json:"path"`
+	BlobSHA string `json:"blob_sha"`
+	Content string `json:"-"`
+}
+
+// SearchDocumentQuery selects candidate documents for a code search.
+type SearchDocumentQuery struct {
+	RepoIDs []string
+	// Contains, when set, restricts results to documents containing the
+	// string, ignoring case. The trigram index cannot match strings shorter
+	// than three characters, so callers must not set shorter values.
+	Contains string
+	// AfterID skips documents up to and including this ID.
+	AfterID int64
+	Limit   int
+}
+
+// Merge request statuses.
+const (
+	MergeRequestOpen   = "open"
+	MergeRequestMerged = "merged"
+	MergeRequestClosed = "closed"
+)
+
+// MergeRequest proposes merging a source branch into a target branch of the
+// same repo. Status uses the MergeRequest status values.
+type MergeRequest struct {
+	ID     string `json:"id"`
+	RepoID string `json:"repo_id"`
+	// Number identifies the merge request within its repo, starting at 1.
+	Number       int64   `json:"number"`
+	Title        string  `json:"title"`
+	Description  string  `json:"description"`
+	SourceBranch string  `json:"source_branch"`
+	TargetBranch string  `json:"target_branch"`
+	Status       string  `json:"status"`
+	AuthorID     *string `json:"author_id,omitempty"`
+	// AuthorName is the author's primary namespace name, filled in on reads.
+	AuthorName string `json:"author_name"`
+	// SourceSHA and TargetSHA record the branch heads when the merge request
+	// was merged or closed.
+	SourceSHA      *string    `json:"source_sha,omitempty"`
+	TargetSHA      *string    `json:"target_sha,omitempty"`
+	MergeStrategy  *string    `json:"merge_strategy,omitempty"`
+	MergeCommitSHA *string    `json:"merge_commit_sha,omitempty"`
+	MergedBy       *string    `json:"merged_by,omitempty"`
+	MergedAt       *time.Time `json:"merged_at,omitempty"`
+	ClosedAt       *time.Time `json:"closed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Sides of a diff a review thread can be anchored to.
+const (
+	ReviewSideNew = "new"
+	ReviewSideOld = "old"
+)
+
+// ReviewThread is a discussion anchored to a line of the diff from BaseSHA to
+// CommitSHA. Side says whether Line is a line of the file at CommitSHA (new)
+// or at BaseSHA (old).
+type ReviewThread struct {
+	ID        string `json:"id"`
+	RepoID    string `json:"repo_id"`
+	CommitSHA string `json:"commit_sha"`
+	// BaseSHA is empty for the diff of a root commit.
+	BaseSHA string `json:"base_sha"`
+	Path    string `json:"path"`
+	Side    string `json:"side"`
+	Line    int    `json:"line"`
+	// Ref is the branch the thread follows. When it is pushed, the thread is
+	// moved to the new head or marked outdated if its line changed.
+	Ref               *string    `json:"ref,omitempty"`
+	OriginalCommitSHA string     `json:"original_commit_sha"`
+	OriginalLine      int        `json:"original_line"`
+	Outdated          bool       `json:"outdated"`
+	Resolved          bool       `json:"resolved"`
+	ResolvedBy        *string    `json:"resolved_by,omitempty"`
+	ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+	// Comments are filled in on reads, oldest first.
+	Comments  []ReviewComment `json:"comments"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// ReviewComment is a comment in a review thread.
+type ReviewComment struct {
+	ID       string  `json:"id"`
+	ThreadID string  `json:"thread_id"`
+	AuthorID *string `json:"author_id,omitempty"`
+	// AuthorName is the author's primary namespace name, filled in on reads.
+	AuthorName string    `json:"author_name"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Release publishes a tag of a repo with notes and downloadable assets.
+type Release struct {
+	ID         string  `json:"id"`
+	RepoID     string  `json:"repo_id"`
+	TagName    string  `json:"tag_name"`
+	Title      string  `json:"title"`
+	Notes      string  `json:"notes"`
+	Draft      bool    `json:"draft"`
+	Prerelease bool    `json:"prerelease"`
+	AuthorID   *string `json:"author_id,omitempty"`
+	// AuthorName is the author's primary namespace name, filled in on reads.
+	AuthorName string `json:"author_name"`
+	// Assets are filled in on reads, in upload order.
+	Assets []ReleaseAsset `json:"assets"`
+	// PublishedAt is nil while the release is a draft.
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ReleaseAsset is a file attached to a release. The content is kept in
+// release storage under the repo and its SHA256, so identical uploads to a
+// repo share one stored object.
+type ReleaseAsset struct {
+	ID          string    `json:"id"`
+	ReleaseID   string    `json:"release_id"`
+	RepoID      string    `json:"repo_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	UploaderID  *string   `json:"uploader_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ReviewThreadQuery selects a repo's review threads. Empty fields match
+// everything.
+type ReviewThreadQuery struct {
+	RepoID    string
+	CommitSHA string
+	// BaseSHA, when set, must match exactly; empty matches root commit diffs.
+	BaseSHA *string
+	Path    string
+	Ref     string
+	// ExcludeOutdated skips threads whose line has changed.
+	ExcludeOutdated bool
+}
+
 func ToNullString(s *string) sql.NullString {
 	if s == nil {
 		return sql.NullString{}
@@ -77,6 +77,12 @@ type Model struct {
 	namespaces       []client.NamespaceWithAccess
 	namespacesLoaded bool
 
+	searching bool
+	search    SearchModel
+
+	managingTokens bool
+	tokens         TokensModel
+
 	detailTab      detailTab
 	detailViewport viewport.Model
 	detailCache    map[string]*RepoDetail
@@ -117,6 +123,7 @@ func NewModel(c *client.Client, namespace, server string) Model {
 		detailCache:     make(map[string]*RepoDetail),
 		detailScroll:    make(map[detailTab]int),
 		detailViewport:  viewport.New(0, 0),
+		search:          NewSearchModel(),
 		repoCursor:      -1,
 		savedRepoCursor: -1,
 	}
@@ -221,6 +221,11 @@ func (m Model) loadDetail(repoID string) tea.Cmd {
 			defaultRef = refs[0].Name
 		}
 
+		pushEvents, _, err := m.client.ListPushEvents(ctx, repoID, "", detailPushEventsLimit)
+		if err != nil {
+			return DetailLoadedMsg{RepoID: repoID, Err: fmt.Errorf("list push events: %w", err)}
+		}
+
 		var commits []client.Commit
 		var tree []client.TreeEntry
 		var readme *string
@@ -250,9 +255,39 @@ func (m Model) loadDetail(repoID string) tea.Cmd {
 			RepoID:         repoID,
 			Refs:           refs,
 			Commits:        commits,
+			PushEvents:     pushEvents,
 			Tree:           tree,
 			Readme:         readme,
 			ReadmeFilename: readmeFilename,
 		}
 	}
 }
+
+func (m Model) searchCode(query string, regex bool) tea.Cmd {
+	return func() tea.Msg {
+		contextLines := searchContextLines
+		opts := client.CodeSearchOptions{Regex: regex, Context: &contextLines}
+		results, nextCursor, err := m.client.SearchCode(context.Background(), query, opts, "", searchPageSize)
+		return searchResultsMsg{query: query, results: results, hasMore: nextCursor != "", err: err}
+	}
+}
+
+func (m Model) loadTokens() tea.Cmd {
+	return func() tea.Msg {
+		tokens, err := m.client.ListTokens(context.Background())
+		return tokensLoadedMsg{tokens: tokens, err: err}
+	}
+}
+
+func (m Model) createToken(name string) tea.Cmd {
+	return func() tea.Msg {
+		rawToken, _, err := m.client.CreateToken(context.Background(), client.CreateTokenOptions{Name: name})
+		return tokenCreatedMsg{name: name, token: rawToken, err: err}
+	}
+}
+
+func (m Model) revokeToken(id string) tea.Cmd {
+	return func() tea.Msg {
+		return tokenRevokedMsg{err: m.client.DeleteToken(context.Background(), id)}
+	}
+}
@@ -162,3 +162,24 @@ func friendlyError(err error) (title, message string) {
 
 	return "Error", errStr
 }
+
+func shortSHA(sha string) string {
+	if len(sha) > shortSHAWidth {
+		return sha[:shortSHAWidth]
+	}
+	return sha
+}
+
+func isZeroSHA(sha string) bool {
+	return strings.Trim(sha, "0") == ""
+}
+
+// shortRefName strips the refs/heads/ or refs/tags/ prefix from a full ref name.
+func shortRefName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		if name, ok := strings.CutPrefix(ref, prefix); ok {
+			return name
+		}
+	}
+	return ref
+}
@@ -25,6 +25,8 @@ type KeyMap struct {
 	CloneDir        key.Binding
 	ManageFolders   key.Binding
 	SwitchNamespace key.Binding
+	Search          key.Binding
+	Tokens          key.Binding
 }
 
 var DefaultKeyMap = KeyMap{
@@ -92,6 +94,14 @@ var DefaultKeyMap = KeyMap{
 		key.WithKeys("tab"),
 		key.WithHelp("tab", "switch namespace"),
 	),
+	Search: key.NewBinding(
+		key.WithKeys("/"),
+		key.WithHelp("/", "search code"),
+	),
+	Tokens: key.NewBinding(
+		key.WithKeys("t"),
+		key.WithHelp("t", "tokens"),
+	),
 }
 
 type helpKeyMap struct {
@@ -101,15 +111,15 @@ type helpKeyMap struct {
 
 func (h helpKeyMap) ShortHelp() []key.Binding {
 	if h.hasSelectedRepo {
-		return []key.Binding{h.Help, h.Clone, h.ManageFolders, h.SwitchNamespace, h.Quit}
+		return []key.Binding{h.Help, h.Clone, h.ManageFolders, h.Search, h.SwitchNamespace, h.Quit}
 	}
-	return []key.Binding{h.Help, h.NewFolder, h.SwitchNamespace, h.Quit}
+	return []key.Binding{h.Help, h.NewFolder, h.Search, h.SwitchNamespace, h.Quit}
 }
 
 func (h helpKeyMap) FullHelp() [][]key.Binding {
 	shortcuts := []key.Binding{h.Up, h.Down, h.Left, h.Right, h.Enter, h.Escape}
 	editActions := []key.Binding{h.NewFolder, h.Rename, h.Delete}
-	meta := []key.Binding{h.SwitchNamespace, h.Help, h.Quit}
+	meta := []key.Binding{h.Search, h.Tokens, h.SwitchNamespace, h.Help, h.Quit}
 
 	if !h.hasSelectedRepo {
 		return [][]key.Binding{shortcuts, editActions, meta}
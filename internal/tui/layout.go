@@ -30,7 +30,8 @@ const (
 	detailViewportTopPadding    = 0
 	detailViewportBottomPadding = 1
 
-	detailCommitsLimit = 20
+	detailCommitsLimit    = 20
+	detailPushEventsLimit = 10
 
 	shortSHAWidth           = 7
 	tabContentBorderWidth   = 2
@@ -48,6 +49,17 @@ const (
 	namespacePickerWidth    = 40
 	namespacePickerHeight   = 15
 	namespacePickerMaxItems = 8
+
+	searchPageSize         = 50
+	searchContextLines     = 1
+	searchMatchesPerResult = 3
+	searchQueryMaxLength   = 256
+	searchModeLabelWidth   = 10
+	searchHeaderRows       = 4
+	searchHintRows         = 1
+
+	tokenNameMaxLength = 100
+	tokensHeaderRows   = 3
 )
 
 type layoutSizes struct {
@@ -75,6 +75,7 @@ type RepoDetail struct {
 	Refs           []client.Ref
 	DefaultRef     string
 	Commits        []client.Commit
+	PushEvents     []client.PushEvent
 	Tree           []client.TreeEntry
 	Readme         *string
 	ReadmeFilename string
@@ -84,6 +85,7 @@ type DetailLoadedMsg struct {
 	RepoID         string
 	Refs           []client.Ref
 	Commits        []client.Commit
+	PushEvents     []client.PushEvent
 	Tree           []client.TreeEntry
 	Readme         *string
 	ReadmeFilename string
@@ -0,0 +1,242 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/bantamhq/ephemeral/internal/client"
+)
+
+type SearchCloseMsg struct{}
+
+type SearchSubmitMsg struct {
+	Query string
+	Regex bool
+}
+
+type searchResultsMsg struct {
+	query   string
+	results []client.CodeSearchResult
+	hasMore bool
+	err     error
+}
+
+// SearchModel is the code search view: a query input above a scrollable list
+// of matching files.
+type SearchModel struct {
+	input   textinput.Model
+	regex   bool
+	query   string
+	results []client.CodeSearchResult
+	hasMore bool
+	cursor  int
+	loading bool
+	err     error
+	width   int
+	height  int
+}
+
+func NewSearchModel() SearchModel {
+	ti := textinput.New()
+	ti.Placeholder = "Search code"
+	ti.Prompt = "/ "
+	ti.CharLimit = searchQueryMaxLength
+	ti.Focus()
+
+	return SearchModel{input: ti}
+}
+
+func (s SearchModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (s *SearchModel) SetSize(width, height int) {
+	s.width = width
+	s.height = height
+	s.input.Width = max(width-lipgloss.Width(s.input.Prompt)-searchModeLabelWidth, 1)
+}
+
+func (s SearchModel) Update(msg tea.Msg) (SearchModel, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc":
+			return s, func() tea.Msg { return SearchCloseMsg{} }
+
+		case "enter":
+			query := strings.TrimSpace(s.input.Value())
+			if query == "" || s.loading {
+				return s, nil
+			}
+			s.loading = true
+			s.err = nil
+			regex := s.regex
+			return s, func() tea.Msg { return SearchSubmitMsg{Query: query, Regex: regex} }
+
+		case "ctrl+r":
+			s.regex = !s.regex
+			return s, nil
+
+		case "up":
+			if s.cursor > 0 {
+				s.cursor--
+			}
+			return s, nil
+
+		case "down":
+			if s.cursor < len(s.results)-1 {
+				s.cursor++
+			}
+			return s, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	s.input, cmd = s.input.Update(msg)
+	return s, cmd
+}
+
+// SetResults shows the results of a submitted search.
+func (s *SearchModel) SetResults(msg searchResultsMsg) {
+	s.loading = false
+	s.query = msg.query
+	s.err = msg.err
+	s.results = msg.results
+	s.hasMore = msg.hasMore
+	s.cursor = 0
+}
+
+func (s SearchModel) View() string {
+	var b strings.Builder
+
+	b.WriteString(Styles.Common.Header.Width(s.width).Render(" Search"))
+	b.WriteString("\n\n")
+
+	mode := "literal"
+	if s.regex {
+		mode = "regex"
+	}
+	b.WriteString(s.input.View())
+	b.WriteString(" ")
+	b.WriteString(Styles.Common.MetaText.Render("[" + mode + "]"))
+	b.WriteString("\n\n")
+
+	bodyHeight := max(s.height-searchHeaderRows-searchHintRows, 1)
+	b.WriteString(lipgloss.NewStyle().Height(bodyHeight).MaxHeight(bodyHeight).Render(s.bodyView(bodyHeight)))
+	b.WriteString("\n")
+	b.WriteString(Styles.Dialog.Hint.Render("enter search • ctrl+r toggle regex • ↑/↓ select • esc close"))
+
+	return b.String()
+}
+
+func (s SearchModel) bodyView(height int) string {
+	switch {
+	case s.loading:
+		return Styles.Common.MetaText.Render("Searching...")
+	case s.err != nil:
+		return Styles.Common.Error.Render("Search failed: " + s.err.Error())
+	case s.query == "":
+		return Styles.Common.MetaText.Render("Type a query and press enter to search the default branch of every repo.")
+	case len(s.results) == 0:
+		return Styles.Common.MetaText.Render(fmt.Sprintf("No results for %q", s.query))
+	}
+
+	var lines []string
+	selectedStart, selectedEnd := 0, 0
+	for i, result := range s.results {
+		if i == s.cursor {
+			selectedStart = len(lines)
+		}
+		lines = append(lines, s.renderResult(result, i == s.cursor)...)
+		if i == s.cursor {
+			selectedEnd = len(lines)
+		}
+		lines = append(lines, "")
+	}
+
+	summary := fmt.Sprintf("%d files", len(s.results))
+	if s.hasMore {
+		summary = fmt.Sprintf("First %d files", len(s.results))
+	}
+	lines = append(lines, Styles.Common.MetaText.Render(summary))
+
+	start := 0
+	if selectedEnd > height {
+		start = min(selectedStart, selectedEnd-height)
+	}
+	end := min(start+height, len(lines))
+
+	return strings.Join(lines[start:end], "\n")
+}
+
+func (s SearchModel) renderResult(result client.CodeSearchResult, selected bool) []string {
+	prefix := "  "
+	if selected {
+		prefix = "→ "
+	}
+
+	title := prefix + result.Repo + "/" + result.Path
+	titleStyle := Styles.Search.Path
+	if selected {
+		titleStyle = Styles.Search.PathSelected
+	}
+	lines := []string{titleStyle.Render(truncateWithEllipsis(title, s.width))}
+
+	numberWidth := 1
+	for _, match := range result.Matches {
+		numberWidth = max(numberWidth, len(fmt.Sprint(match.LineNumber+len(match.After))))
+	}
+
+	for i, match := range result.Matches {
+		if i == searchMatchesPerResult {
+			break
+		}
+		for j, line := range match.Before {
+			lines = append(lines, s.renderContextLine(match.LineNumber-len(match.Before)+j, numberWidth, line))
+		}
+		gutter := fmt.Sprintf("    %*d│ ", numberWidth, match.LineNumber)
+		lines = append(lines, lipgloss.NewStyle().MaxWidth(s.width).Render(
+			Styles.Common.MetaText.Render(gutter)+highlightMatches(match.Line, match.Ranges)))
+		for j, line := range match.After {
+			lines = append(lines, s.renderContextLine(match.LineNumber+1+j, numberWidth, line))
+		}
+	}
+
+	if hidden := len(result.Matches) - searchMatchesPerResult; hidden > 0 || result.Truncated {
+		more := "    more matches"
+		if hidden > 0 && !result.Truncated {
+			more = fmt.Sprintf("    %d more matches", hidden)
+		}
+		lines = append(lines, Styles.Common.MetaText.Render(more))
+	}
+
+	return lines
+}
+
+func (s SearchModel) renderContextLine(number, numberWidth int, line string) string {
+	text := fmt.Sprintf("    %*d  %s", numberWidth, number, expandTabs(line))
+	return Styles.Common.MetaText.MaxWidth(s.width).Render(text)
+}
+
+// highlightMatches renders a line with its matched byte ranges highlighted.
+func highlightMatches(line string, ranges [][2]int) string {
+	var b strings.Builder
+	pos := 0
+	for _, r := range ranges {
+		if r[0] < pos || r[1] > len(line) {
+			continue
+		}
+		b.WriteString(expandTabs(line[pos:r[0]]))
+		b.WriteString(Styles.Search.Match.Render(expandTabs(line[r[0]:r[1]])))
+		pos = r[1]
+	}
+	b.WriteString(expandTabs(line[pos:]))
+	return b.String()
+}
+
+func expandTabs(s string) string {
+	return strings.ReplaceAll(s, "\t", "    ")
+}
@@ -62,6 +62,12 @@ type TreeStyles struct {
 	Dir        lipgloss.Style
 }
 
+type SearchStyles struct {
+	Path         lipgloss.Style
+	PathSelected lipgloss.Style
+	Match        lipgloss.Style
+}
+
 type FooterStyles struct {
 	Namespace     lipgloss.Style
 	Help          lipgloss.Style
@@ -90,6 +96,7 @@ type StyleConfig struct {
 	Picker PickerStyles
 	Commit CommitStyles
 	Tree   TreeStyles
+	Search SearchStyles
 	Footer FooterStyles
 	Common CommonStyles
 }
@@ -221,6 +228,17 @@ func NewStyles() *StyleConfig {
 				Bold(true),
 		},
 
+		Search: SearchStyles{
+			Path: lipgloss.NewStyle().
+				Bold(true),
+			PathSelected: lipgloss.NewStyle().
+				Background(colors.Subdued).
+				Foreground(colors.PrimaryReverse).
+				Bold(true),
+			Match: lipgloss.NewStyle().
+				Reverse(true),
+		},
+
 		Footer: FooterStyles{
 			Namespace: lipgloss.NewStyle().
 				Background(colors.Primary).
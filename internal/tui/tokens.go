@@ -0,0 +1,305 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/bantamhq/ephemeral/internal/client"
+)
+
+type TokensCloseMsg struct{}
+
+type TokenCreateMsg struct {
+	Name string
+}
+
+type TokenRevokeMsg struct {
+	ID string
+}
+
+type tokensLoadedMsg struct {
+	tokens []client.UserToken
+	err    error
+}
+
+type tokenCreatedMsg struct {
+	name  string
+	token string
+	err   error
+}
+
+type tokenRevokedMsg struct {
+	err error
+}
+
+type tokensMode int
+
+const (
+	tokensBrowsing tokensMode = iota
+	tokensNaming
+	tokensConfirmRevoke
+)
+
+// TokensModel is the token management view: the user's tokens with actions
+// to create and revoke them. A newly created token is shown until the view
+// is closed, since it can't be retrieved again.
+type TokensModel struct {
+	input   textinput.Model
+	mode    tokensMode
+	tokens  []client.UserToken
+	cursor  int
+	loading bool
+	err     error
+	created string
+	name    string
+	width   int
+	height  int
+}
+
+func NewTokensModel() TokensModel {
+	ti := textinput.New()
+	ti.Placeholder = "Token name"
+	ti.Prompt = "Name: "
+	ti.CharLimit = tokenNameMaxLength
+
+	return TokensModel{input: ti, loading: true}
+}
+
+func (t *TokensModel) SetSize(width, height int) {
+	t.width = width
+	t.height = height
+	t.input.Width = max(width-lipgloss.Width(t.input.Prompt)-1, 1)
+}
+
+func (t TokensModel) Update(msg tea.Msg) (TokensModel, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return t, nil
+	}
+
+	switch t.mode {
+	case tokensNaming:
+		return t.updateNaming(keyMsg)
+	case tokensConfirmRevoke:
+		return t.updateConfirmRevoke(keyMsg)
+	}
+
+	switch keyMsg.String() {
+	case "esc", "q":
+		return t, func() tea.Msg { return TokensCloseMsg{} }
+
+	case "up", "k":
+		if t.cursor > 0 {
+			t.cursor--
+		}
+
+	case "down", "j":
+		if t.cursor < len(t.tokens)-1 {
+			t.cursor++
+		}
+
+	case "n":
+		if t.loading {
+			return t, nil
+		}
+		t.mode = tokensNaming
+		t.input.Reset()
+		return t, t.input.Focus()
+
+	case "d":
+		token, ok := t.selected()
+		if !ok || t.loading {
+			return t, nil
+		}
+		if token.Current {
+			t.err = fmt.Errorf("can't revoke the token this session uses")
+			return t, nil
+		}
+		t.err = nil
+		t.mode = tokensConfirmRevoke
+	}
+
+	return t, nil
+}
+
+func (t TokensModel) updateNaming(msg tea.KeyMsg) (TokensModel, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		t.mode = tokensBrowsing
+		t.input.Blur()
+		return t, nil
+
+	case "enter":
+		name := strings.TrimSpace(t.input.Value())
+		if name == "" {
+			return t, nil
+		}
+		t.mode = tokensBrowsing
+		t.input.Blur()
+		t.loading = true
+		t.err = nil
+		return t, func() tea.Msg { return TokenCreateMsg{Name: name} }
+	}
+
+	var cmd tea.Cmd
+	t.input, cmd = t.input.Update(msg)
+	return t, cmd
+}
+
+func (t TokensModel) updateConfirmRevoke(msg tea.KeyMsg) (TokensModel, tea.Cmd) {
+	t.mode = tokensBrowsing
+	if msg.String() != "y" {
+		return t, nil
+	}
+
+	token, ok := t.selected()
+	if !ok {
+		return t, nil
+	}
+	t.loading = true
+	return t, func() tea.Msg { return TokenRevokeMsg{ID: token.ID} }
+}
+
+func (t TokensModel) selected() (client.UserToken, bool) {
+	if t.cursor < 0 || t.cursor >= len(t.tokens) {
+		return client.UserToken{}, false
+	}
+	return t.tokens[t.cursor], true
+}
+
+// SetTokens shows a freshly loaded token list.
+func (t *TokensModel) SetTokens(msg tokensLoadedMsg) {
+	t.loading = false
+	if msg.err != nil {
+		t.err = msg.err
+		return
+	}
+	t.tokens = msg.tokens
+	t.cursor = min(t.cursor, max(len(t.tokens)-1, 0))
+}
+
+// SetCreated records the raw value of a newly created token.
+func (t *TokensModel) SetCreated(msg tokenCreatedMsg) {
+	if msg.err != nil {
+		t.loading = false
+		t.err = msg.err
+		return
+	}
+	t.created = msg.token
+	t.name = msg.name
+}
+
+// SetError shows a failed action.
+func (t *TokensModel) SetError(err error) {
+	t.loading = false
+	t.err = err
+}
+
+func (t TokensModel) View() string {
+	var b strings.Builder
+
+	b.WriteString(Styles.Common.Header.Width(t.width).Render(" Tokens"))
+	b.WriteString("\n\n")
+
+	footer := t.footerView()
+	bodyHeight := max(t.height-tokensHeaderRows-lipgloss.Height(footer), 1)
+	b.WriteString(lipgloss.NewStyle().Height(bodyHeight).MaxHeight(bodyHeight).Render(t.bodyView(bodyHeight)))
+	b.WriteString("\n")
+	b.WriteString(footer)
+
+	return b.String()
+}
+
+func (t TokensModel) bodyView(height int) string {
+	switch {
+	case t.loading && len(t.tokens) == 0:
+		return Styles.Common.MetaText.Render("Loading tokens...")
+	case len(t.tokens) == 0:
+		return Styles.Common.MetaText.Render("No tokens.")
+	}
+
+	lines := make([]string, len(t.tokens))
+	for i, token := range t.tokens {
+		lines[i] = t.renderToken(token, i == t.cursor)
+	}
+
+	start := 0
+	if t.cursor >= height {
+		start = t.cursor - height + 1
+	}
+	end := min(start+height, len(lines))
+
+	return strings.Join(lines[start:end], "\n")
+}
+
+func (t TokensModel) renderToken(token client.UserToken, selected bool) string {
+	prefix := "  "
+	style := Styles.Search.Path
+	if selected {
+		prefix = "→ "
+		style = Styles.Search.PathSelected
+	}
+
+	name := "-"
+	if token.Name != nil {
+		name = *token.Name
+	}
+
+	lastUsed := "never used"
+	if token.LastUsedAt != nil {
+		lastUsed = "last used " + formatRelativeTime(token.LastUsedAt)
+	}
+	meta := []string{token.ID[:8], "created " + formatRelativeTime(&token.CreatedAt), lastUsed}
+	if token.ExpiresAt != nil {
+		if token.ExpiresAt.Before(time.Now()) {
+			meta = append(meta, "expired")
+		} else {
+			meta = append(meta, "expires "+token.ExpiresAt.Format("2006-01-02"))
+		}
+	}
+	if token.Scope != nil {
+		meta = append(meta, "scoped")
+	}
+	if token.Current {
+		meta = append(meta, "this session")
+	}
+
+	line := style.Render(prefix+name) + "  " + Styles.Common.MetaText.Render(strings.Join(meta, " · "))
+	return lipgloss.NewStyle().MaxWidth(t.width).Render(line)
+}
+
+func (t TokensModel) footerView() string {
+	var lines []string
+
+	if t.created != "" {
+		lines = append(lines,
+			"Created "+t.name+": "+t.created,
+			Styles.Common.MetaText.Render("Copy it now; it won't be shown again."),
+			"")
+	}
+
+	if t.err != nil {
+		lines = append(lines, Styles.Common.Error.Render(t.err.Error()), "")
+	}
+
+	switch t.mode {
+	case tokensNaming:
+		lines = append(lines, t.input.View(), Styles.Dialog.Hint.Render("enter create • esc cancel"))
+	case tokensConfirmRevoke:
+		token, _ := t.selected()
+		name := token.ID[:8]
+		if token.Name != nil {
+			name = *token.Name
+		}
+		lines = append(lines, "Revoke "+name+"?", Styles.Dialog.Hint.Render("y revoke • any other key cancel"))
+	default:
+		lines = append(lines, Styles.Dialog.Hint.Render("n new • d revoke • ↑/↓ select • esc close"))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -98,12 +98,61 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case NamespacePickerSelectMsg:
 		return m.handleNamespaceSelected(msg)
+
+	case SearchCloseMsg:
+		m.searching = false
+		return m, nil
+
+	case SearchSubmitMsg:
+		return m, m.searchCode(msg.Query, msg.Regex)
+
+	case searchResultsMsg:
+		m.search.SetResults(msg)
+		return m, nil
+
+	case TokensCloseMsg:
+		m.managingTokens = false
+		return m, nil
+
+	case TokenCreateMsg:
+		return m, m.createToken(msg.Name)
+
+	case TokenRevokeMsg:
+		return m, m.revokeToken(msg.ID)
+
+	case tokensLoadedMsg:
+		m.tokens.SetTokens(msg)
+		return m, nil
+
+	case tokenCreatedMsg:
+		m.tokens.SetCreated(msg)
+		if msg.err != nil {
+			return m, nil
+		}
+		return m, m.loadTokens()
+
+	case tokenRevokedMsg:
+		if msg.err != nil {
+			m.tokens.SetError(msg.err)
+			return m, nil
+		}
+		return m, m.loadTokens()
 	}
 
 	return m, nil
 }
 
 func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.searching {
+		var cmd tea.Cmd
+		m.search, cmd = m.search.Update(msg)
+		return m, cmd
+	}
+	if m.managingTokens {
+		var cmd tea.Cmd
+		m.tokens, cmd = m.tokens.Update(msg)
+		return m, cmd
+	}
 	if m.modal == modalHelp {
 		return m.handleHelpKey(msg)
 	}
@@ -124,6 +173,8 @@ func (m Model) handleHelpKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (m Model) handleWindowSize(msg tea.WindowSizeMsg) (tea.Model, tea.Cmd) {
 	m.width = msg.Width
 	m.height = msg.Height
+	m.search.SetSize(max(m.width-contentPaddingWidth, 1), m.mainHeight())
+	m.tokens.SetSize(max(m.width-contentPaddingWidth, 1), m.mainHeight())
 	m.updateViewportSize()
 	m.setViewportContent()
 	return m, nil
@@ -305,6 +356,7 @@ func (m Model) handleDetailLoaded(msg DetailLoadedMsg) (tea.Model, tea.Cmd) {
 		RepoID:         msg.RepoID,
 		Refs:           msg.Refs,
 		Commits:        msg.Commits,
+		PushEvents:     msg.PushEvents,
 		Tree:           msg.Tree,
 		Readme:         msg.Readme,
 		ReadmeFilename: msg.ReadmeFilename,
@@ -400,6 +452,16 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case key.Matches(msg, m.keys.SwitchNamespace):
 		return m.openNamespaceSwitcher()
+
+	case key.Matches(msg, m.keys.Search):
+		m.searching = true
+		return m, m.search.Init()
+
+	case key.Matches(msg, m.keys.Tokens):
+		m.managingTokens = true
+		m.tokens = NewTokensModel()
+		m.tokens.SetSize(max(m.width-contentPaddingWidth, 1), m.mainHeight())
+		return m, m.loadTokens()
 	}
 
 	return m, nil
@@ -1058,6 +1120,9 @@ func (m Model) handleNamespaceSelected(msg NamespacePickerSelectMsg) (tea.Model,
 	m.focusedColumn = columnFolders
 	m.statusMsg = "Switched to namespace: " + msg.Name
 
+	m.search = NewSearchModel()
+	m.search.SetSize(max(m.width-contentPaddingWidth, 1), m.mainHeight())
+
 	return m, tea.Batch(m.spinner.Tick, m.loadData())
 }
 
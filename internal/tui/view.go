@@ -60,6 +60,14 @@ func (m Model) mainContentView(height int) string {
 		return overlay.Composite(m.errorView(), background, overlay.Center, overlay.Center, 0, 0)
 	}
 
+	if m.searching {
+		return lipgloss.NewStyle().Padding(0, 1).Render(m.search.View())
+	}
+
+	if m.managingTokens {
+		return lipgloss.NewStyle().Padding(0, 1).Render(m.tokens.View())
+	}
+
 	layout := m.layoutSizes()
 
 	listHeight := height - headerHeight
@@ -606,31 +614,76 @@ func (m Model) getActivityContent(width int) string {
 		return " " + Styles.Common.MetaText.Render("Loading...")
 	}
 
-	if m.currentDetail == nil || len(m.currentDetail.Commits) == 0 {
-		return " " + Styles.Common.MetaText.Render("No commits")
+	if m.currentDetail == nil || (len(m.currentDetail.Commits) == 0 && len(m.currentDetail.PushEvents) == 0) {
+		return " " + Styles.Common.MetaText.Render("No activity")
+	}
+
+	var sections []string
+	if len(m.currentDetail.PushEvents) > 0 {
+		sections = append(sections, m.renderPushEvents(width))
+	}
+	if len(m.currentDetail.Commits) > 0 {
+		sections = append(sections, m.renderRecentCommits(width))
+	}
+
+	return strings.Join(sections, "\n\n")
+}
+
+func (m Model) renderPushEvents(width int) string {
+	t := tree.Root(" ⁜ Recent Pushes")
+	for _, event := range m.currentDetail.PushEvents {
+		t.Child(renderPushEvent(event, width))
 	}
 
+	t.EnumeratorStyle(Styles.Tree.Enumerator).
+		Enumerator(treeEnumerator).
+		Indenter(treeIndenter)
+
+	return t.String()
+}
+
+// renderPushEvent renders a ref update as "main abc1234 → def5678 • forced • 2h ago".
+func renderPushEvent(event client.PushEvent, width int) string {
+	ref := truncateWithEllipsis(shortRefName(event.Ref), width/3)
+
+	var change string
+	switch {
+	case isZeroSHA(event.OldSHA):
+		change = Styles.Common.MetaText.Render("created") + " " + Styles.Commit.Hash.Render(shortSHA(event.NewSHA))
+	case isZeroSHA(event.NewSHA):
+		change = Styles.Commit.StatRemoved.Render("deleted")
+	default:
+		change = Styles.Commit.Hash.Render(shortSHA(event.OldSHA)) + Styles.Common.MetaText.Render(" → ") + Styles.Commit.Hash.Render(shortSHA(event.NewSHA))
+	}
+
+	line := ref + " " + change
+	if event.Forced {
+		line += " " + Styles.Common.MetaText.Render("•") + " " + Styles.Commit.StatRemoved.Render("forced")
+	}
+
+	createdAt := event.CreatedAt
+	return line + " " + Styles.Common.MetaText.Render("•") + " " + Styles.Common.MetaText.Render(formatRelativeTime(&createdAt))
+}
+
+func (m Model) renderRecentCommits(width int) string {
 	t := tree.Root(" ⁜ Recent Commits")
 	enumeratorWidth := lipgloss.Width(Styles.Tree.Enumerator.Render("├─"))
 	for _, commit := range m.currentDetail.Commits {
-		shortSHA := commit.SHA
-		if len(shortSHA) > shortSHAWidth {
-			shortSHA = shortSHA[:shortSHAWidth]
-		}
+		sha := shortSHA(commit.SHA)
 
 		message := firstLine(commit.Message)
 		timeAgo := formatRelativeTime(&commit.Author.Date)
 
-		messageWidth := width - enumeratorWidth - lipgloss.Width(shortSHA) - lipgloss.Width("•") - lipgloss.Width(timeAgo) - 3
+		messageWidth := width - enumeratorWidth - lipgloss.Width(sha) - lipgloss.Width("•") - lipgloss.Width(timeAgo) - 3
 		if messageWidth < 1 {
-			commitLine := Styles.Commit.Hash.Render(shortSHA) + " " + Styles.Common.MetaText.Render("•") + " " + Styles.Common.MetaText.Render(timeAgo)
+			commitLine := Styles.Commit.Hash.Render(sha) + " " + Styles.Common.MetaText.Render("•") + " " + Styles.Common.MetaText.Render(timeAgo)
 			t.Child(tree.Root(commitLine).Child(renderCommitStats(commit.Stats)))
 			continue
 		}
 
 		message = truncateWithEllipsis(message, messageWidth)
 
-		commitLine := Styles.Commit.Hash.Render(shortSHA) + " " + Styles.Common.MetaText.Render("•") + " " + message + " " + Styles.Common.MetaText.Render(timeAgo)
+		commitLine := Styles.Commit.Hash.Render(sha) + " " + Styles.Common.MetaText.Render("•") + " " + message + " " + Styles.Common.MetaText.Render(timeAgo)
 		t.Child(tree.Root(commitLine).Child(renderCommitStats(commit.Stats)))
 	}
 
@@ -6,6 +6,7 @@ SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
 source "$SCRIPT_DIR/lib.sh"
 
 require_admin_token
+trap cleanup EXIT
 
 echo ""
 echo -e "${BLUE}═══════════════════════════════════════${NC}"
@@ -146,6 +147,101 @@ expect_contains "$RESPONSE" "not found" "complete with bad user fails"
 admin_curl -X DELETE "$ADMIN_API/users/$USER_ID" > /dev/null 2>&1
 admin_curl -X DELETE "$ADMIN_API/namespaces/auth-test-ns" > /dev/null 2>&1
 
+###############################################################################
+section "Device Login"
+###############################################################################
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"device-login-ns"}' \
+    "$ADMIN_API/namespaces")
+DEVICE_NS_ID=$(get_id "$RESPONSE")
+track_namespace "$DEVICE_NS_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$DEVICE_NS_ID\"}" \
+    "$ADMIN_API/users")
+DEVICE_USER_ID=$(get_id "$RESPONSE")
+track_user "$DEVICE_USER_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{}' \
+    "$ADMIN_API/users/$DEVICE_USER_ID/tokens")
+DEVICE_USER_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"scope":{"allow":["repo:read"]}}' \
+    "$ADMIN_API/users/$DEVICE_USER_ID/tokens")
+DEVICE_SCOPED_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+
+RESPONSE=$(anon_curl -X POST -H "Content-Type: application/json" \
+    -d '{"device":true}' \
+    "$API/auth/sessions")
+DEVICE_SESSION_ID=$(echo "$RESPONSE" | jq -r '.data.id')
+USER_CODE=$(echo "$RESPONSE" | jq -r '.data.user_code')
+expect_contains "$USER_CODE" "^[B-Z]\{4\}-[B-Z]\{4\}$" "device session has a user code"
+
+RESPONSE=$(anon_curl -X POST -H "Content-Type: application/json" \
+    -d '{}' \
+    "$API/auth/sessions")
+expect_json "$RESPONSE" '.data.user_code // "none"' "none" "other sessions have no user code"
+
+RESPONSE=$(auth_curl_with "$DEVICE_SCOPED_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d "{\"user_code\":\"$USER_CODE\"}" \
+    "$API/auth/device/approve")
+expect_contains "$RESPONSE" "Scoped tokens cannot" "scoped token cannot approve"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"user_code\":\"$USER_CODE\"}" \
+    "$API/auth/device/approve")
+expect_contains "$RESPONSE" "Admin token cannot" "admin token cannot approve"
+
+RESPONSE=$(auth_curl_with "$DEVICE_USER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"user_code":"BBBB-BBBB"}' \
+    "$API/auth/device/approve")
+expect_contains "$RESPONSE" "Unknown or expired code" "unknown code rejected"
+
+LOWER_CODE=$(echo "$USER_CODE" | tr 'A-Z' 'a-z' | tr -d '-')
+STATUS=$(auth_curl_with "$DEVICE_USER_TOKEN" -o /dev/null -w "%{http_code}" -X POST -H "Content-Type: application/json" \
+    -d "{\"user_code\":\"$LOWER_CODE\"}" \
+    "$API/auth/device/approve")
+if [ "$STATUS" = "204" ]; then
+    pass "code approved as typed"
+else
+    fail "code approved as typed" "204" "$STATUS"
+fi
+
+RESPONSE=$(auth_curl_with "$DEVICE_USER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d "{\"user_code\":\"$USER_CODE\"}" \
+    "$API/auth/device/approve")
+expect_contains "$RESPONSE" "Code already used" "code is single use"
+
+RESPONSE=$(anon_curl "$API/auth/sessions/$DEVICE_SESSION_ID")
+DEVICE_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+expect_contains "$DEVICE_TOKEN" "^eph_" "device receives a token"
+
+RESPONSE=$(auth_curl_with "$DEVICE_TOKEN" "$API/namespaces")
+expect_contains "$RESPONSE" "device-login-ns" "device token belongs to the approving user"
+
+RESPONSE=$(anon_curl "$BASE_URL/auth/device?code=BCDF-GHJK")
+expect_contains "$RESPONSE" 'value="BCDF-GHJK"' "approval page prefills the code"
+
+RESPONSE=$(anon_curl -X POST -H "Content-Type: application/json" \
+    -d '{"device":true}' \
+    "$API/auth/sessions")
+WEB_SESSION_ID=$(echo "$RESPONSE" | jq -r '.data.id')
+WEB_CODE=$(echo "$RESPONSE" | jq -r '.data.user_code')
+
+RESPONSE=$(curl -s --data-urlencode "user_code=$WEB_CODE" --data-urlencode "token=$DEVICE_SCOPED_TOKEN" \
+    "$BASE_URL/auth/device")
+expect_contains "$RESPONSE" "unscoped token" "approval page rejects scoped tokens"
+
+RESPONSE=$(curl -s --data-urlencode "user_code=$WEB_CODE" --data-urlencode "token=$DEVICE_USER_TOKEN" \
+    "$BASE_URL/auth/device")
+expect_contains "$RESPONSE" "Login approved" "approval page approves with a token"
+
+RESPONSE=$(anon_curl "$API/auth/sessions/$WEB_SESSION_ID")
+expect_json "$RESPONSE" '.data.status' "completed" "web approval completes the session"
+
 ###############################################################################
 section "Auth Sessions - Expiration"
 ###############################################################################
@@ -0,0 +1,161 @@
+#!/bin/bash
+# Commit Search Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Commit Search Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+# commit_as makes an empty commit with the given author email and date.
+commit_as() {
+    local email="$1"
+    local date="$2"
+    local message="$3"
+    GIT_AUTHOR_NAME="${email%@*}" GIT_AUTHOR_EMAIL="$email" GIT_AUTHOR_DATE="$date" \
+    GIT_COMMITTER_NAME="${email%@*}" GIT_COMMITTER_EMAIL="$email" GIT_COMMITTER_DATE="$date" \
+        git commit -q --allow-empty -m "$message"
+}
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+NS_JSON=$(auth_curl "$API/namespaces")
+NS_NAME=$(echo "$NS_JSON" | jq -r '.data[] | select(.is_primary == true) | .name' 2>/dev/null)
+if [ -z "$NS_NAME" ] || [ "$NS_NAME" = "null" ]; then
+    echo "Failed to get namespace name"
+    exit 1
+fi
+
+TMPDIR=$(mktemp -d)
+
+for name in test-commits-api test-commits-web; do
+    RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+        -d "{\"name\":\"$name\"}" \
+        "$API/repos")
+    ID=$(get_id "$RESPONSE")
+    if [ -z "$ID" ]; then
+        echo "Failed to create repo: $RESPONSE"
+        exit 1
+    fi
+    track_repo "$ID"
+    if [ "$name" = "test-commits-api" ]; then
+        API_ID="$ID"
+    else
+        WEB_ID="$ID"
+    fi
+done
+
+cd "$TMPDIR"
+git init -q api
+cd api
+git checkout -q -b main 2>/dev/null || true
+commit_as "alice@example.com" "2024-03-01T10:00:00Z" "Initial API"
+commit_as "bob@example.com" "2024-03-04T10:00:00Z" "Add rate limiting"
+commit_as "alice@example.com" "2024-03-05T10:00:00Z" "Fix token refresh"
+git checkout -q -b feature
+commit_as "alice@example.com" "2024-03-06T10:00:00Z" "Add webhooks"
+git remote add origin "http://x-token:$TOKEN@${BASE_URL#http://}/git/$NS_NAME/test-commits-api.git"
+git push -q origin main feature 2>/dev/null
+
+cd "$TMPDIR"
+git init -q web
+cd web
+git checkout -q -b main 2>/dev/null || true
+commit_as "bob@example.com" "2024-03-02T10:00:00Z" "Initial web"
+commit_as "Alice@Example.com" "2024-03-07T10:00:00Z" "Fix layout on mobile"
+git remote add origin "http://x-token:$TOKEN@${BASE_URL#http://}/git/$NS_NAME/test-commits-web.git"
+git push -q origin main 2>/dev/null
+info "Pushed test history"
+
+###############################################################################
+section "Repo Commit Filters"
+###############################################################################
+
+RESPONSE=$(auth_curl "$API/repos/$API_ID/commits?ref=main&author=alice@example.com")
+expect_json "$RESPONSE" '[.data[].message | rtrimstr("\n")] | join(",")' "Fix token refresh,Initial API" "author filter"
+
+RESPONSE=$(auth_curl "$API/repos/$API_ID/commits?ref=main&since=2024-03-02&until=2024-03-04")
+expect_json "$RESPONSE" '[.data[].message | rtrimstr("\n")] | join(",")' "Add rate limiting" "date range is inclusive of whole days"
+
+RESPONSE=$(auth_curl "$API/repos/$API_ID/commits?ref=main&since=2024-03-04T12:00:00Z")
+expect_json "$RESPONSE" '[.data[].message | rtrimstr("\n")] | join(",")' "Fix token refresh" "RFC 3339 since"
+
+RESPONSE=$(auth_curl -G --data-urlencode "grep=^(Add|Fix) " "$API/repos/$API_ID/commits?ref=feature")
+expect_json "$RESPONSE" '.data | length' "3" "message regex filter"
+
+RESPONSE=$(auth_curl -G --data-urlencode "grep=(" "$API/repos/$API_ID/commits")
+expect_contains "$RESPONSE" "Invalid grep" "invalid regex rejected"
+
+RESPONSE=$(auth_curl "$API/repos/$API_ID/commits?since=yesterday")
+expect_contains "$RESPONSE" "Invalid since" "invalid date rejected"
+
+RESPONSE=$(auth_curl "$API/repos/$API_ID/commits?ref=main&limit=1")
+CURSOR=$(echo "$RESPONSE" | jq -r '.next_cursor')
+expect_json "$RESPONSE" '.data[0].message | rtrimstr("\n")' "Fix token refresh" "first page"
+RESPONSE=$(auth_curl "$API/repos/$API_ID/commits?ref=main&limit=1&cursor=$CURSOR")
+expect_json "$RESPONSE" '.data[0].message | rtrimstr("\n")' "Add rate limiting" "next page continues after the cursor"
+
+RESPONSE=$(auth_curl "$API/repos/$API_ID/commits?ref=main&author=alice@example.com&limit=1")
+CURSOR=$(echo "$RESPONSE" | jq -r '.next_cursor')
+RESPONSE=$(auth_curl "$API/repos/$API_ID/commits?ref=main&author=alice@example.com&limit=1&cursor=$CURSOR")
+expect_json "$RESPONSE" '.data[0].message | rtrimstr("\n")' "Initial API" "filtered pagination"
+expect_json "$RESPONSE" '.has_more' "false" "filtered last page"
+
+###############################################################################
+section "Namespace Commit Search"
+###############################################################################
+
+search_commits() {
+    auth_curl -G "$@" "$API/namespaces/$NS_NAME/commits/search"
+}
+
+RESPONSE=$(search_commits --data-urlencode "author=alice@example.com" --data-urlencode "since=2024-03-05")
+expect_json "$RESPONSE" '[.data[].message | rtrimstr("\n")] | join(",")' "Fix layout on mobile,Add webhooks,Fix token refresh" "searches every repo and branch, newest first"
+expect_json "$RESPONSE" '[.data[].repo] | join(",")' "test-commits-web,test-commits-api,test-commits-api" "results name their repo"
+expect_json "$RESPONSE" '.data[0].repo_id' "$WEB_ID" "results include repo id"
+
+RESPONSE=$(search_commits --data-urlencode "grep=^Initial")
+expect_json "$RESPONSE" '[.data[] | select(.repo | startswith("test-commits-")) | .message | rtrimstr("\n")] | join(",")' "Initial web,Initial API" "message search across repos"
+
+RESPONSE=$(search_commits --data-urlencode "author=bob@example.com" --data-urlencode "limit=1")
+expect_json "$RESPONSE" '.data[0].message | rtrimstr("\n")' "Add rate limiting" "first page"
+expect_json "$RESPONSE" '.has_more' "true" "has more results"
+CURSOR=$(echo "$RESPONSE" | jq -r '.next_cursor')
+RESPONSE=$(search_commits --data-urlencode "author=bob@example.com" --data-urlencode "limit=1" --data-urlencode "cursor=$CURSOR")
+expect_json "$RESPONSE" '.data[0].message | rtrimstr("\n")' "Initial web" "second page"
+expect_json "$RESPONSE" '.has_more' "false" "last page"
+
+RESPONSE=$(search_commits --data-urlencode "cursor=abc")
+expect_contains "$RESPONSE" "Invalid cursor" "invalid cursor rejected"
+
+###############################################################################
+section "Access Control"
+###############################################################################
+
+RESPONSE=$(anon_curl -G --data-urlencode "author=alice@example.com" "$API/namespaces/$NS_NAME/commits/search")
+expect_json "$RESPONSE" '.data | length' "0" "anonymous search skips private repos"
+
+auth_curl -X PATCH -H "Content-Type: application/json" -d '{"public":true}' "$API/repos/$WEB_ID" > /dev/null
+RESPONSE=$(anon_curl -G --data-urlencode "author=alice@example.com" "$API/namespaces/$NS_NAME/commits/search")
+expect_json "$RESPONSE" '[.data[].message | rtrimstr("\n")] | join(",")' "Fix layout on mobile" "anonymous search includes public repos"
+
+STATUS=$(anon_curl -o /dev/null -w "%{http_code}" "$API/namespaces/no-such-namespace-xyz/commits/search")
+if [ "$STATUS" = "404" ]; then
+    pass "unknown namespace returns 404"
+else
+    fail "unknown namespace returns 404" "404" "$STATUS"
+fi
+
+cd /
+rm -rf "$TMPDIR"
+
+###############################################################################
+summary
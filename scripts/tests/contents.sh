@@ -0,0 +1,231 @@
+#!/bin/bash
+# Contents API Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+require_admin_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Contents API Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+put_file() {
+    auth_curl -X PUT -H "Content-Type: application/json" -d "$2" "$API/repos/$REPO_ID/contents/$1"
+}
+
+delete_file() {
+    auth_curl -X DELETE -H "Content-Type: application/json" -d "$2" "$API/repos/$REPO_ID/contents/$1"
+}
+
+commit_files() {
+    auth_curl -X POST -H "Content-Type: application/json" -d "$1" "$API/repos/$REPO_ID/contents"
+}
+
+blob_sha() {
+    auth_curl "$API/repos/$REPO_ID/blob/main/$1" | jq -r '.data.sha'
+}
+
+branch_sha() {
+    auth_curl "$API/repos/$REPO_ID/refs" | jq -r ".data[] | select(.name == \"$1\") | .commit_sha"
+}
+
+expect_status() {
+    if [ "$1" = "$2" ]; then
+        pass "$3"
+    else
+        fail "$3" "$2" "$1"
+    fi
+}
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+NS_JSON=$(auth_curl "$API/namespaces")
+NS_NAME=$(echo "$NS_JSON" | jq -r '.data[] | select(.is_primary == true) | .name' 2>/dev/null)
+if [ -z "$NS_NAME" ] || [ "$NS_NAME" = "null" ]; then
+    echo "Failed to get namespace name"
+    exit 1
+fi
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"test-contents"}' \
+    "$API/repos")
+REPO_ID=$(get_id "$RESPONSE")
+if [ -z "$REPO_ID" ]; then
+    echo "Failed to create repo: $RESPONSE"
+    exit 1
+fi
+track_repo "$REPO_ID"
+
+# A second user who can write to the repo, and administers their own namespace.
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"contents-writer"}' "$ADMIN_API/namespaces")
+WRITER_NS_ID=$(get_id "$RESPONSE")
+track_namespace "$WRITER_NS_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$WRITER_NS_ID\"}" "$ADMIN_API/users")
+WRITER_ID=$(get_id "$RESPONSE")
+track_user "$WRITER_ID"
+
+admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"repo_id\":\"$REPO_ID\",\"allow\":[\"repo:write\"]}" \
+    "$ADMIN_API/users/$WRITER_ID/repo-grants" > /dev/null
+admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$WRITER_NS_ID\",\"allow\":[\"namespace:admin\",\"repo:admin\"]}" \
+    "$ADMIN_API/users/$WRITER_ID/namespace-grants" > /dev/null
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{}' "$ADMIN_API/users/$WRITER_ID/tokens")
+WRITER_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+
+###############################################################################
+section "Create and Update"
+###############################################################################
+
+RESPONSE=$(put_file "README.md" '{"content":"# Hello\n"}')
+expect_json "$RESPONSE" '.data.branch' "main" "first commit goes to the default branch"
+expect_json "$RESPONSE" '.data.files[0].action' "created" "file created"
+expect_json "$RESPONSE" '.data.commit.parent_shas | length' "0" "root commit in an empty repo"
+expect_json "$RESPONSE" '.data.commit.message | rtrimstr("\n")' "Create README.md" "default create message"
+expect_json "$RESPONSE" '.data.commit.author.name' "$NS_NAME" "authored by the user"
+README_SHA=$(echo "$RESPONSE" | jq -r '.data.files[0].sha')
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/blob/main/README.md")
+expect_json "$RESPONSE" '.data.content | rtrimstr("\n")' "# Hello" "content readable through the blob API"
+expect_json "$RESPONSE" '.data.sha' "$README_SHA" "blob sha matches"
+
+HEAD_SHA=$(branch_sha main)
+RESPONSE=$(put_file "README.md" "{\"content\":\"# Hello again\n\",\"sha\":\"$README_SHA\",\"parent_sha\":\"$HEAD_SHA\",\"message\":\"Greet again\",\"author\":{\"name\":\"Web Editor\",\"email\":\"web@example.com\"}}")
+expect_json "$RESPONSE" '.data.files[0].action' "updated" "file updated"
+expect_json "$RESPONSE" '.data.commit.parent_shas[0]' "$HEAD_SHA" "commit on top of the branch"
+expect_json "$RESPONSE" '.data.commit.message | rtrimstr("\n")' "Greet again" "custom message"
+expect_json "$RESPONSE" '.data.commit.author.name' "Web Editor" "supplied author"
+expect_json "$RESPONSE" '.data.commit.committer.name' "$NS_NAME" "committed by the user"
+
+RESPONSE=$(put_file "README.md" "{\"content\":\"stale\",\"sha\":\"$README_SHA\"}")
+expect_json "$RESPONSE" '.code' "sha_mismatch" "stale blob sha rejected"
+expect_json "$RESPONSE" '.path' "README.md" "conflicting path reported"
+
+RESPONSE=$(put_file "README.md" "{\"content\":\"stale\",\"parent_sha\":\"$HEAD_SHA\"}")
+expect_json "$RESPONSE" '.code' "ref_moved" "stale parent sha rejected"
+
+RESPONSE=$(put_file "README.md" '{"content":"# Hello again\n"}')
+expect_contains "$RESPONSE" "No changes" "unchanged content rejected"
+
+RESPONSE=$(put_file "logo.bin" '{"content":"AAECAw==","encoding":"base64"}')
+expect_json "$RESPONSE" '.data.files[0].size' "4" "base64 content decoded"
+
+RESPONSE=$(put_file "docs/guide/intro.md" '{"content":"intro","branch":"main"}')
+expect_json "$RESPONSE" '.data.files[0].path' "docs/guide/intro.md" "nested directories created"
+
+###############################################################################
+section "Validation"
+###############################################################################
+
+RESPONSE=$(put_file "README.md" '{}')
+expect_contains "$RESPONSE" "content is required" "content required"
+
+RESPONSE=$(put_file ".git/config" '{"content":"x"}')
+expect_contains "$RESPONSE" "Invalid path" "paths inside .git rejected"
+
+RESPONSE=$(put_file "a.txt" '{"content":"x","encoding":"latin1"}')
+expect_contains "$RESPONSE" "encoding must be" "unknown encoding rejected"
+
+RESPONSE=$(put_file "a.txt" '{"content":"***","encoding":"base64"}')
+expect_contains "$RESPONSE" "not valid base64" "invalid base64 rejected"
+
+RESPONSE=$(put_file "README.md/nested" '{"content":"x"}')
+expect_json "$RESPONSE" '.code' "path_conflict" "writing below a file rejected"
+
+RESPONSE=$(put_file "docs" '{"content":"x"}')
+expect_json "$RESPONSE" '.code' "path_conflict" "overwriting a directory rejected"
+
+RESPONSE=$(put_file "a.txt" '{"content":"x","branch":"nope"}')
+expect_contains "$RESPONSE" "Branch not found" "missing branch rejected"
+
+###############################################################################
+section "Delete"
+###############################################################################
+
+RESPONSE=$(delete_file "logo.bin" '{}')
+expect_json "$RESPONSE" '.data.files[0].action' "deleted" "file deleted"
+expect_json "$RESPONSE" '.data.commit.message | rtrimstr("\n")' "Delete logo.bin" "default delete message"
+
+STATUS=$(auth_curl -o /dev/null -w "%{http_code}" -X DELETE "$API/repos/$REPO_ID/contents/logo.bin")
+expect_status "$STATUS" "404" "deleting a missing file returns 404"
+
+###############################################################################
+section "Multi-file Commits"
+###############################################################################
+
+RESPONSE=$(commit_files '{"files":[{"path":"a.txt","content":"a"},{"path":"b.txt","content":"b"}]}')
+expect_contains "$RESPONSE" "message is required" "message required for several files"
+
+RESPONSE=$(commit_files '{"message":"Dup","files":[{"path":"a.txt","content":"a"},{"path":"a.txt","content":"b"}]}')
+expect_contains "$RESPONSE" "more than once" "duplicate paths rejected"
+
+RESPONSE=$(commit_files '{"message":"Bad","files":[{"path":"a.txt","action":"rename"}]}')
+expect_contains "$RESPONSE" "action must be" "unknown action rejected"
+
+HEAD_SHA=$(branch_sha main)
+GUIDE_SHA=$(blob_sha "docs/guide/intro.md")
+RESPONSE=$(commit_files "{\"message\":\"Restructure\",\"files\":[{\"path\":\"src/main.go\",\"content\":\"package main\n\"},{\"path\":\"README.md\",\"content\":\"# Project\n\"},{\"path\":\"docs/guide/intro.md\",\"action\":\"delete\",\"sha\":\"$GUIDE_SHA\"}]}")
+expect_json "$RESPONSE" '[.data.files[].action] | join(",")' "created,updated,deleted" "all files in one commit"
+expect_json "$RESPONSE" '.data.commit.parent_shas[0]' "$HEAD_SHA" "single commit on the branch"
+expect_json "$RESPONSE" '.data.commit.stats.files_changed' "3" "commit touches every file"
+COMMIT_SHA=$(echo "$RESPONSE" | jq -r '.data.commit.sha')
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/tree/main/")
+expect_not_contains "$RESPONSE" '"docs"' "empty directories removed"
+
+RESPONSE=$(commit_files '{"message":"Partial","files":[{"path":"c.txt","content":"c"},{"path":"missing.txt","action":"delete"}]}')
+expect_json "$RESPONSE" '.code' "not_found" "one bad file rejects the commit"
+expect_contains "$(branch_sha main)" "$COMMIT_SHA" "branch unchanged after a rejected commit"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/events")
+expect_contains "$RESPONSE" "$COMMIT_SHA" "commit recorded as a push event"
+
+###############################################################################
+section "Permissions and Protection"
+###############################################################################
+
+RESPONSE=$(auth_curl_with "$WRITER_TOKEN" -X PUT -H "Content-Type: application/json" \
+    -d '{"content":"from writer"}' "$API/repos/$REPO_ID/contents/writer.txt")
+expect_json "$RESPONSE" '.data.commit.author.name' "contents-writer" "writer can commit"
+
+auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"pattern":"main","push_permission":"repo:admin"}' \
+    "$API/repos/$REPO_ID/protections" > /dev/null
+
+RESPONSE=$(auth_curl_with "$WRITER_TOKEN" -X PUT -H "Content-Type: application/json" \
+    -d '{"content":"again"}' "$API/repos/$REPO_ID/contents/writer.txt")
+expect_contains "$RESPONSE" "repo:admin" "branch protection applies"
+
+STATUS=$(anon_curl -o /dev/null -w "%{http_code}" -X PUT -H "Content-Type: application/json" \
+    -d '{"content":"x"}' "$API/repos/$REPO_ID/contents/anon.txt")
+expect_status "$STATUS" "401" "anonymous write rejected"
+
+###############################################################################
+section "Quota"
+###############################################################################
+
+RESPONSE=$(auth_curl_with "$WRITER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"quota","namespace":"contents-writer"}' "$API/repos")
+QUOTA_REPO_ID=$(get_id "$RESPONSE")
+
+auth_curl_with "$WRITER_TOKEN" -X PATCH -H "Content-Type: application/json" \
+    -d '{"storage_limit_bytes":1}' "$API/namespaces/contents-writer" > /dev/null
+
+RESPONSE=$(auth_curl_with "$WRITER_TOKEN" -X PUT -H "Content-Type: application/json" \
+    -d '{"content":"too big"}' "$API/repos/$QUOTA_REPO_ID/contents/file.txt")
+expect_json "$RESPONSE" '.code' "quota_exceeded" "storage quota applies"
+
+###############################################################################
+summary
@@ -0,0 +1,195 @@
+#!/bin/bash
+# Deploy Key Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+require_admin_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Deploy Key Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+GIT_HOST="${BASE_URL#http://}"
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"deploy-key-ns"}' \
+    "$ADMIN_API/namespaces")
+NS_ID=$(get_id "$RESPONSE")
+track_namespace "$NS_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$NS_ID\"}" \
+    "$ADMIN_API/users")
+USER_ID=$(get_id "$RESPONSE")
+track_user "$USER_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{}' \
+    "$ADMIN_API/users/$USER_ID/tokens")
+OWNER_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"site","public":false}' \
+    "$API/repos")
+REPO_ID=$(get_id "$RESPONSE")
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"other","public":false}' \
+    "$API/repos")
+OTHER_REPO_ID=$(get_id "$RESPONSE")
+
+if [ -z "$REPO_ID" ] || [ -z "$OTHER_REPO_ID" ]; then
+    echo "Failed to create repos: $RESPONSE"
+    exit 1
+fi
+info "Created repos: $REPO_ID $OTHER_REPO_ID"
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+
+git init -q repo
+cd repo
+git checkout -q -b main
+echo "hello" > README.md
+git add .
+git commit -q -m "Initial"
+git push -q "http://x-token:$OWNER_TOKEN@$GIT_HOST/git/deploy-key-ns/site.git" main 2>/dev/null
+git push -q "http://x-token:$OWNER_TOKEN@$GIT_HOST/git/deploy-key-ns/other.git" main 2>/dev/null
+
+ssh-keygen -q -t ed25519 -N "" -C "deploy@example" -f "$TMPDIR/deploy_key"
+PUBLIC_KEY=$(cat "$TMPDIR/deploy_key.pub")
+
+###############################################################################
+section "Create Deploy Keys"
+###############################################################################
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"reader"}' \
+    "$API/repos/$REPO_ID/deploy-keys")
+READ_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+expect_json "$RESPONSE" '.data.metadata.read_only' "true" "read-only by default"
+expect_contains "$READ_TOKEN" "^ephd_" "deploy token returned once"
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"writer","read_only":false}' \
+    "$API/repos/$REPO_ID/deploy-keys")
+WRITE_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+WRITE_KEY_ID=$(echo "$RESPONSE" | jq -r '.data.metadata.id')
+expect_json "$RESPONSE" '.data.metadata.read_only' "false" "read-write key created"
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d "{\"public_key\":\"$PUBLIC_KEY\"}" \
+    "$API/repos/$REPO_ID/deploy-keys")
+SSH_KEY_ID=$(echo "$RESPONSE" | jq -r '.data.metadata.id')
+expect_json "$RESPONSE" '.data.metadata.name' "deploy@example" "SSH key named from comment"
+expect_json "$RESPONSE" '.data.token // "none"' "none" "no token for SSH keys"
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d "{\"public_key\":\"$PUBLIC_KEY\"}" \
+    "$API/repos/$OTHER_REPO_ID/deploy-keys")
+expect_contains "$RESPONSE" "already registered" "SSH key can't be reused"
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d "{\"public_key\":\"$PUBLIC_KEY\"}" \
+    "$API/user/keys")
+expect_contains "$RESPONSE" "already registered" "deploy key can't become a user key"
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{}' \
+    "$API/repos/$REPO_ID/deploy-keys")
+expect_contains "$RESPONSE" "name is required" "name required"
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" "$API/repos/$REPO_ID/deploy-keys")
+expect_json "$RESPONSE" '.data | length' "3" "list shows keys"
+expect_not_contains "$RESPONSE" "token_hash" "list hides token hashes"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"scope\":{\"allow\":[\"repo:write\"],\"repo_ids\":[\"$REPO_ID\"]}}" \
+    "$ADMIN_API/users/$USER_ID/tokens")
+WRITER_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+
+RESPONSE=$(auth_curl_with "$WRITER_TOKEN" "$API/repos/$REPO_ID/deploy-keys")
+expect_contains "$RESPONSE" "Insufficient permissions" "repo:admin required"
+
+###############################################################################
+section "Git Over HTTP"
+###############################################################################
+
+OUTPUT=$(git clone -q "http://x-token:$READ_TOKEN@$GIT_HOST/git/deploy-key-ns/site.git" "$TMPDIR/clone" 2>&1 && echo "cloned")
+expect_contains "$OUTPUT" "cloned" "read-only key can clone"
+
+echo "more" >> README.md
+git commit -q -am "More"
+OUTPUT=$(git push "http://x-token:$READ_TOKEN@$GIT_HOST/git/deploy-key-ns/site.git" main 2>&1 || true)
+expect_contains "$OUTPUT" "Write access denied" "read-only key cannot push"
+
+OUTPUT=$(git push "http://x-token:$WRITE_TOKEN@$GIT_HOST/git/deploy-key-ns/site.git" main 2>&1 || true)
+expect_contains "$OUTPUT" "main -> main" "read-write key can push"
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" "$API/repos/$REPO_ID/events")
+expect_json "$RESPONSE" '.data[0].deploy_key_id' "$WRITE_KEY_ID" "push event records deploy key"
+
+OUTPUT=$(git clone -q "http://x-token:$WRITE_TOKEN@$GIT_HOST/git/deploy-key-ns/other.git" "$TMPDIR/other" 2>&1 || true)
+expect_contains "$OUTPUT" "403" "other repos denied"
+
+OUTPUT=$(git push "http://x-token:$WRITE_TOKEN@$GIT_HOST/git/deploy-key-ns/created.git" main 2>&1 || true)
+expect_contains "$OUTPUT" "403" "cannot create repos"
+
+RESPONSE=$(auth_curl_with "$WRITE_TOKEN" "$API/repos/$REPO_ID")
+expect_contains "$RESPONSE" "Invalid token format" "rejected by the REST API"
+
+###############################################################################
+section "LFS"
+###############################################################################
+
+LFS_URL="$BASE_URL/git/deploy-key-ns/site.git/info/lfs"
+OID="4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+RESPONSE=$(curl -s -u "x-token:$READ_TOKEN" -H "Content-Type: application/vnd.git-lfs+json" \
+    -d "{\"operation\":\"upload\",\"objects\":[{\"oid\":\"$OID\",\"size\":12}]}" \
+    "$LFS_URL/objects/batch")
+expect_contains "$RESPONSE" "Write access denied" "read-only key cannot upload"
+
+RESPONSE=$(curl -s -u "x-token:$WRITE_TOKEN" -H "Content-Type: application/vnd.git-lfs+json" \
+    -d "{\"operation\":\"upload\",\"objects\":[{\"oid\":\"$OID\",\"size\":12}]}" \
+    "$LFS_URL/objects/batch")
+expect_contains "$RESPONSE" '"upload"' "read-write key can upload"
+
+###############################################################################
+section "Remove Deploy Keys"
+###############################################################################
+
+RESPONSE=$(auth_curl_with "$OWNER_TOKEN" -X DELETE "$API/repos/$OTHER_REPO_ID/deploy-keys/$SSH_KEY_ID")
+expect_contains "$RESPONSE" "Deploy key not found" "key not reachable through other repo"
+
+STATUS=$(auth_curl_with "$OWNER_TOKEN" -o /dev/null -w "%{http_code}" -X DELETE "$API/repos/$REPO_ID/deploy-keys/$WRITE_KEY_ID")
+if [ "$STATUS" = "204" ]; then
+    pass "key removed"
+else
+    fail "key removed" "204" "$STATUS"
+fi
+
+OUTPUT=$(git push "http://x-token:$WRITE_TOKEN@$GIT_HOST/git/deploy-key-ns/site.git" main 2>&1 || true)
+expect_contains "$OUTPUT" "Authentication failed\|Invalid token" "removed key rejected"
+
+###############################################################################
+section "Cleanup Repos"
+###############################################################################
+
+auth_curl_with "$OWNER_TOKEN" -X DELETE "$API/repos/$REPO_ID" > /dev/null
+auth_curl_with "$OWNER_TOKEN" -X DELETE "$API/repos/$OTHER_REPO_ID" > /dev/null
+pass "repos deleted"
+
+cd /
+rm -rf "$TMPDIR"
+
+summary
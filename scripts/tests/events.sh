@@ -0,0 +1,115 @@
+#!/bin/bash
+# Push Event Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Push Event Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+NS_JSON=$(auth_curl "$API/namespaces")
+NS_NAME=$(echo "$NS_JSON" | jq -r '.data[] | select(.is_primary == true) | .name' 2>/dev/null)
+if [ -z "$NS_NAME" ] || [ "$NS_NAME" = "null" ]; then
+    echo "Failed to get namespace name"
+    exit 1
+fi
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"test-events","public":false}' \
+    "$API/repos")
+
+REPO_ID=$(get_id "$RESPONSE")
+if [ -z "$REPO_ID" ]; then
+    echo "Failed to create repo: $RESPONSE"
+    exit 1
+fi
+track_repo "$REPO_ID"
+info "Created repo: $REPO_ID"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/events")
+expect_json "$RESPONSE" '.data | length' "0" "new repo has no events"
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+
+git init -q repo
+cd repo
+git checkout -q -b main 2>/dev/null || true
+git remote add origin "http://x-token:$TOKEN@${BASE_URL#http://}/git/$NS_NAME/test-events.git"
+
+###############################################################################
+section "Record Pushes"
+###############################################################################
+
+echo "one" > file.txt
+git add .
+git commit -q -m "First"
+FIRST_SHA=$(git rev-parse HEAD)
+git push -q origin main 2>/dev/null
+git push -q origin main:refs/heads/feature 2>/dev/null
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/events")
+expect_json "$RESPONSE" '.data | length' "2" "one event per ref"
+expect_json "$RESPONSE" '[.data[] | select(.ref == "refs/heads/main")][0].new_sha' "$FIRST_SHA" "event records new SHA"
+expect_json "$RESPONSE" '[.data[] | select(.ref == "refs/heads/main")][0].old_sha' "0000000000000000000000000000000000000000" "created ref has zero old SHA"
+expect_json "$RESPONSE" '.data[0].token_id != null and .data[0].user_id != null' "true" "event records pusher and token"
+
+echo "two" >> file.txt
+git commit -q -am "Second"
+SECOND_SHA=$(git rev-parse HEAD)
+git push -q origin main 2>/dev/null
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/events")
+expect_json "$RESPONSE" '.data[0].old_sha' "$FIRST_SHA" "fast-forward records old SHA"
+expect_json "$RESPONSE" '.data[0].forced' "false" "fast-forward is not forced"
+
+git reset -q --hard "$FIRST_SHA"
+echo "rewritten" >> file.txt
+git commit -q -am "Rewritten"
+git push -q -f origin main 2>/dev/null
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/events")
+expect_json "$RESPONSE" '.data[0].old_sha' "$SECOND_SHA" "force push records replaced SHA"
+expect_json "$RESPONSE" '.data[0].forced' "true" "force push is flagged"
+
+git push -q origin --delete feature 2>/dev/null
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/events")
+expect_json "$RESPONSE" '.data[0].new_sha' "0000000000000000000000000000000000000000" "deleted ref has zero new SHA"
+
+cd /
+rm -rf "$TMPDIR"
+
+###############################################################################
+section "Pagination"
+###############################################################################
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/events?limit=2")
+expect_json "$RESPONSE" '.has_more' "true" "first page has more"
+CURSOR=$(echo "$RESPONSE" | jq -r '.next_cursor')
+FIRST_PAGE_IDS=$(echo "$RESPONSE" | jq -r '[.data[].id] | join(",")')
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/events?limit=2&cursor=$CURSOR")
+expect_json "$RESPONSE" '.data | length' "2" "second page"
+SECOND_PAGE_IDS=$(echo "$RESPONSE" | jq -r '[.data[].id] | join(",")')
+if [ "$FIRST_PAGE_IDS" != "$SECOND_PAGE_IDS" ]; then
+    pass "pages do not overlap"
+else
+    fail "pages do not overlap" "different IDs" "$SECOND_PAGE_IDS"
+fi
+
+RESPONSE=$(anon_curl "$API/repos/$REPO_ID/events")
+expect_contains "$RESPONSE" "Authentication required\|Unauthorized" "anonymous access denied"
+
+###############################################################################
+summary
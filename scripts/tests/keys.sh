@@ -0,0 +1,79 @@
+#!/bin/bash
+# SSH Keys API Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+require_admin_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  SSH Keys API Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+KEY_DIR=$(mktemp -d)
+ssh-keygen -q -t ed25519 -N "" -C "keys-test@example" -f "$KEY_DIR/id_ed25519"
+PUBLIC_KEY=$(cat "$KEY_DIR/id_ed25519.pub")
+
+###############################################################################
+section "User: Add Key"
+###############################################################################
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"public_key\":\"$PUBLIC_KEY\"}" \
+    "$API/user/keys")
+
+KEY_ID=$(get_id "$RESPONSE")
+expect_json "$RESPONSE" '.data.key_type' "ssh-ed25519" "key type detected"
+expect_json "$RESPONSE" '.data.name' "keys-test@example" "name defaults to key comment"
+expect_contains "$RESPONSE" '"fingerprint":"SHA256:' "fingerprint computed"
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"public_key\":\"$PUBLIC_KEY\"}" \
+    "$API/user/keys")
+expect_contains "$RESPONSE" "already registered" "duplicate fingerprint rejected"
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"public_key":"not-a-key"}' \
+    "$API/user/keys")
+expect_contains "$RESPONSE" "invalid public key" "malformed key rejected"
+
+###############################################################################
+section "User: List Keys"
+###############################################################################
+
+RESPONSE=$(auth_curl "$API/user/keys")
+expect_contains "$RESPONSE" "$KEY_ID" "list contains added key"
+
+###############################################################################
+section "Admin: User Keys"
+###############################################################################
+
+USER_ID=$(admin_curl "$ADMIN_API/users" | jq -r '.data[0].id')
+
+RESPONSE=$(admin_curl "$ADMIN_API/users/$USER_ID/keys")
+expect_contains "$RESPONSE" '"data"' "admin can list user keys"
+
+RESPONSE=$(auth_curl "$ADMIN_API/users/$USER_ID/keys")
+expect_contains "$RESPONSE" "Admin access required" "user token rejected on admin route"
+
+###############################################################################
+section "User: Remove Key"
+###############################################################################
+
+STATUS=$(auth_curl -o /dev/null -w "%{http_code}" -X DELETE "$API/user/keys/$KEY_ID")
+if [ "$STATUS" = "204" ]; then
+    pass "key removed"
+else
+    fail "key removed" "204" "$STATUS"
+fi
+
+RESPONSE=$(auth_curl -X DELETE "$API/user/keys/$KEY_ID")
+expect_contains "$RESPONSE" "not found" "removed key no longer exists"
+
+rm -rf "$KEY_DIR"
+
+summary
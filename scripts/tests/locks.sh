@@ -0,0 +1,173 @@
+#!/bin/bash
+# Git LFS Locking Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Git LFS Locking Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+LFS_TYPE="Content-Type: application/vnd.git-lfs+json"
+
+# lfs_curl <token> <curl args...>
+lfs_curl() {
+    local token="$1"
+    shift
+    curl -s -u "x-token:$token" -H "$LFS_TYPE" -H "Accept: application/vnd.git-lfs+json" "$@"
+}
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+# Alice and Bob share a namespace that is neither user's primary namespace.
+# Alice administers it, Bob can only write.
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"locks-shared"}' "$ADMIN_API/namespaces")
+SHARED_NS_ID=$(get_id "$RESPONSE")
+if [ -z "$SHARED_NS_ID" ]; then
+    echo "Failed to create namespace: $RESPONSE"
+    exit 1
+fi
+track_namespace "$SHARED_NS_ID"
+
+for NAME in alice bob; do
+    RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+        -d "{\"name\":\"locks-$NAME\"}" "$ADMIN_API/namespaces")
+    NS_ID=$(get_id "$RESPONSE")
+    track_namespace "$NS_ID"
+
+    RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+        -d "{\"namespace_id\":\"$NS_ID\"}" "$ADMIN_API/users")
+    USER_ID=$(get_id "$RESPONSE")
+    track_user "$USER_ID"
+
+    if [ "$NAME" = "alice" ]; then
+        GRANT='["namespace:admin","repo:admin"]'
+    else
+        GRANT='["namespace:read","repo:write"]'
+    fi
+    admin_curl -X POST -H "Content-Type: application/json" \
+        -d "{\"namespace_id\":\"$SHARED_NS_ID\",\"allow\":$GRANT}" \
+        "$ADMIN_API/users/$USER_ID/namespace-grants" > /dev/null
+
+    RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+        -d '{}' "$ADMIN_API/users/$USER_ID/tokens")
+    if [ "$NAME" = "alice" ]; then
+        ALICE_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+    else
+        BOB_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+    fi
+done
+
+RESPONSE=$(auth_curl_with "$ALICE_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"assets","namespace":"locks-shared"}' "$API/repos")
+REPO_ID=$(get_id "$RESPONSE")
+if [ -z "$REPO_ID" ]; then
+    echo "Failed to create repo: $RESPONSE"
+    exit 1
+fi
+track_repo "$REPO_ID"
+
+LFS_URL="$BASE_URL/git/locks-shared/assets.git/info/lfs"
+GIT_URL="http://x-token:$ALICE_TOKEN@${BASE_URL#http://}/git/locks-shared/assets.git"
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+git init -q repo
+cd repo
+git checkout -q -b main 2>/dev/null || true
+echo "v1" > model.bin
+git add .
+git commit -q -m "Add model"
+git push -q "$GIT_URL" main 2>/dev/null
+info "Created repo: $REPO_ID"
+
+###############################################################################
+section "Create Locks"
+###############################################################################
+
+RESPONSE=$(lfs_curl "$BOB_TOKEN" -X POST -d '{"path":"model.bin","ref":{"name":"refs/heads/main"}}' "$LFS_URL/locks")
+LOCK_ID=$(echo "$RESPONSE" | jq -r '.lock.id')
+expect_json "$RESPONSE" '.lock.path' "model.bin" "bob locks model.bin"
+expect_json "$RESPONSE" '.lock.owner.name' "locks-bob" "lock owner is bob"
+
+STATUS=$(lfs_curl "$ALICE_TOKEN" -o /dev/null -w "%{http_code}" -X POST -d '{"path":"model.bin"}' "$LFS_URL/locks")
+if [ "$STATUS" = "409" ]; then
+    pass "locking a locked path conflicts"
+else
+    fail "locking a locked path conflicts" "409" "$STATUS"
+fi
+
+RESPONSE=$(lfs_curl "$ALICE_TOKEN" -X POST -d '{"path":"model.bin"}' "$LFS_URL/locks")
+expect_json "$RESPONSE" '.lock.id' "$LOCK_ID" "conflict returns existing lock"
+
+RESPONSE=$(lfs_curl "$ALICE_TOKEN" -X POST -d '{"path":"../escape"}' "$LFS_URL/locks")
+expect_contains "$RESPONSE" "Invalid path" "path outside repo rejected"
+
+###############################################################################
+section "List and Verify"
+###############################################################################
+
+RESPONSE=$(lfs_curl "$ALICE_TOKEN" "$LFS_URL/locks")
+expect_json "$RESPONSE" '.locks | length' "1" "list locks"
+
+RESPONSE=$(lfs_curl "$ALICE_TOKEN" "$LFS_URL/locks?path=other.bin")
+expect_json "$RESPONSE" '.locks | length' "0" "filter locks by path"
+
+RESPONSE=$(lfs_curl "$ALICE_TOKEN" "$LFS_URL/locks?id=$LOCK_ID")
+expect_json "$RESPONSE" '.locks[0].path' "model.bin" "filter locks by id"
+
+RESPONSE=$(lfs_curl "$ALICE_TOKEN" -X POST -d '{}' "$LFS_URL/locks/verify")
+expect_json "$RESPONSE" '.theirs[0].id' "$LOCK_ID" "verify lists bob's lock as theirs for alice"
+expect_json "$RESPONSE" '.ours | length' "0" "alice owns no locks"
+
+RESPONSE=$(lfs_curl "$BOB_TOKEN" -X POST -d '{}' "$LFS_URL/locks/verify")
+expect_json "$RESPONSE" '.ours[0].id' "$LOCK_ID" "verify lists lock as ours for bob"
+
+###############################################################################
+section "Push Enforcement"
+###############################################################################
+
+echo "v2" > model.bin
+git commit -q -am "Update model"
+
+OUTPUT=$(git push "$GIT_URL" main 2>&1 || true)
+expect_contains "$OUTPUT" "model.bin is locked by locks-bob" "push modifying another user's locked path rejected"
+
+###############################################################################
+section "Unlock"
+###############################################################################
+
+RESPONSE=$(lfs_curl "$ALICE_TOKEN" -X POST -d '{}' "$LFS_URL/locks/$LOCK_ID/unlock")
+expect_contains "$RESPONSE" "owned by locks-bob" "unlock of another user's lock requires force"
+
+RESPONSE=$(lfs_curl "$ALICE_TOKEN" -X POST -d '{"path":"notes.bin"}' "$LFS_URL/locks")
+ALICE_LOCK_ID=$(echo "$RESPONSE" | jq -r '.lock.id')
+
+RESPONSE=$(lfs_curl "$BOB_TOKEN" -X POST -d '{"force":true}' "$LFS_URL/locks/$ALICE_LOCK_ID/unlock")
+expect_contains "$RESPONSE" "requires repo:admin" "force unlock requires repo:admin"
+
+RESPONSE=$(lfs_curl "$ALICE_TOKEN" -X POST -d '{"force":true}' "$LFS_URL/locks/$LOCK_ID/unlock")
+expect_json "$RESPONSE" '.lock.id' "$LOCK_ID" "admin force unlocks bob's lock"
+
+RESPONSE=$(lfs_curl "$ALICE_TOKEN" -X POST -d '{}' "$LFS_URL/locks/$ALICE_LOCK_ID/unlock")
+expect_json "$RESPONSE" '.lock.id' "$ALICE_LOCK_ID" "owner unlocks own lock"
+
+if git push -q "$GIT_URL" main 2>/dev/null; then
+    pass "push succeeds once the lock is released"
+else
+    fail "push succeeds once the lock is released" "push succeeded" "push rejected"
+fi
+
+cd /
+rm -rf "$TMPDIR"
+
+###############################################################################
+summary
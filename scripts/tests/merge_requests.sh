@@ -0,0 +1,253 @@
+#!/bin/bash
+# Merge Request Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Merge Request Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+# commit_file writes a file and commits it.
+commit_file() {
+    echo -e "$2" > "$1"
+    git add "$1"
+    git -c user.name=dev -c user.email=dev@example.com commit -q -m "$3"
+}
+
+create_mr() {
+    auth_curl -X POST -H "Content-Type: application/json" -d "$1" "$API/repos/$REPO_ID/merge-requests"
+}
+
+merge_mr() {
+    auth_curl -X POST -H "Content-Type: application/json" -d "$2" "$API/repos/$REPO_ID/merge-requests/$1/merge"
+}
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+NS_JSON=$(auth_curl "$API/namespaces")
+NS_NAME=$(echo "$NS_JSON" | jq -r '.data[] | select(.is_primary == true) | .name' 2>/dev/null)
+if [ -z "$NS_NAME" ] || [ "$NS_NAME" = "null" ]; then
+    echo "Failed to get namespace name"
+    exit 1
+fi
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"test-merge-requests"}' \
+    "$API/repos")
+REPO_ID=$(get_id "$RESPONSE")
+if [ -z "$REPO_ID" ]; then
+    echo "Failed to create repo: $RESPONSE"
+    exit 1
+fi
+track_repo "$REPO_ID"
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+git init -q work
+cd work
+git checkout -q -b main 2>/dev/null || true
+commit_file README "one\ntwo\nthree" "Initial commit"
+
+git checkout -q -b feature
+commit_file feature.txt "feature" "Add feature"
+commit_file docs.txt "docs" "Add docs"
+
+git checkout -q main
+git checkout -q -b squashme
+commit_file squash.txt "a" "Squash part 1"
+commit_file squash.txt "a\nb" "Squash part 2"
+
+git checkout -q main
+git checkout -q -b rebaseme
+commit_file rebase.txt "rebase" "Rebase me"
+
+git checkout -q main
+git checkout -q -b conflict
+commit_file README "one\nconflict\nthree" "Conflicting change"
+
+git checkout -q main
+commit_file main.txt "main" "Work on main"
+commit_file README "one\nmain\nthree" "Change readme on main"
+
+git remote add origin "http://x-token:$TOKEN@${BASE_URL#http://}/git/$NS_NAME/test-merge-requests.git"
+git push -q origin main feature squashme rebaseme conflict 2>/dev/null
+info "Pushed test branches"
+
+###############################################################################
+section "Create"
+###############################################################################
+
+RESPONSE=$(create_mr '{"title":"Add feature","description":"Adds the feature","source_branch":"feature"}')
+expect_json "$RESPONSE" '.data.number' "1" "numbers start at 1"
+expect_json "$RESPONSE" '.data.target_branch' "main" "target defaults to the default branch"
+expect_json "$RESPONSE" '.data.status' "open" "new merge request is open"
+expect_json "$RESPONSE" '.data.author_name' "$NS_NAME" "author name"
+expect_json "$RESPONSE" '.data.merge_status' "clean" "mergeable"
+expect_json "$RESPONSE" '.data.ahead_by' "2" "ahead by"
+expect_json "$RESPONSE" '.data.behind_by' "2" "behind by"
+
+RESPONSE=$(create_mr '{"title":"Again","source_branch":"feature"}')
+expect_contains "$RESPONSE" "already exists" "duplicate open merge request rejected"
+
+RESPONSE=$(create_mr '{"title":"Missing","source_branch":"nope"}')
+expect_contains "$RESPONSE" "Branch not found" "missing branch rejected"
+
+RESPONSE=$(create_mr '{"title":"Same","source_branch":"main"}')
+expect_contains "$RESPONSE" "must differ" "same branch rejected"
+
+RESPONSE=$(create_mr '{"source_branch":"feature","target_branch":"conflict"}')
+expect_contains "$RESPONSE" "title is required" "title required"
+
+RESPONSE=$(create_mr '{"title":"Squash it","description":"Two parts","source_branch":"squashme"}')
+expect_json "$RESPONSE" '.data.number' "2" "second merge request"
+RESPONSE=$(create_mr '{"title":"Rebase it","source_branch":"rebaseme"}')
+expect_json "$RESPONSE" '.data.number' "3" "third merge request"
+RESPONSE=$(create_mr '{"title":"Conflicts","source_branch":"conflict"}')
+expect_json "$RESPONSE" '.data.merge_status' "conflicts" "conflicts detected"
+expect_json "$RESPONSE" '.data.conflicts | join(",")' "README" "conflicting files listed"
+expect_json "$RESPONSE" '.data.mergeable' "false" "not mergeable"
+
+###############################################################################
+section "List and Get"
+###############################################################################
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/merge-requests")
+expect_json "$RESPONSE" '[.data[].number] | join(",")' "4,3,2,1" "newest first"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/merge-requests?limit=2")
+CURSOR=$(echo "$RESPONSE" | jq -r '.next_cursor')
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/merge-requests?limit=2&cursor=$CURSOR")
+expect_json "$RESPONSE" '[.data[].number] | join(",")' "2,1" "second page"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/merge-requests?status=bogus")
+expect_contains "$RESPONSE" "status must be" "invalid status rejected"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/merge-requests/1")
+expect_json "$RESPONSE" '.data.title' "Add feature" "get merge request"
+
+STATUS=$(auth_curl -o /dev/null -w "%{http_code}" "$API/repos/$REPO_ID/merge-requests/99")
+if [ "$STATUS" = "404" ]; then
+    pass "unknown merge request returns 404"
+else
+    fail "unknown merge request returns 404" "404" "$STATUS"
+fi
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/merge-requests/1/diff")
+expect_json "$RESPONSE" '.data.base_ref' "main" "diff base ref"
+expect_json "$RESPONSE" '.data.commits | length' "2" "diff lists source commits"
+expect_contains "$RESPONSE" "feature.txt" "diff includes source changes"
+expect_not_contains "$RESPONSE" "main.txt" "diff is from the merge base"
+
+###############################################################################
+section "Update"
+###############################################################################
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"title":"Add the feature"}' \
+    "$API/repos/$REPO_ID/merge-requests/1")
+expect_json "$RESPONSE" '.data.title' "Add the feature" "update title"
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"status":"closed"}' \
+    "$API/repos/$REPO_ID/merge-requests/4")
+expect_json "$RESPONSE" '.data.status' "closed" "close merge request"
+expect_json "$RESPONSE" '.data.source_sha != null' "true" "closing records the branch heads"
+
+RESPONSE=$(merge_mr 4 '{}')
+expect_contains "$RESPONSE" "not open" "closed merge request cannot be merged"
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"status":"open"}' \
+    "$API/repos/$REPO_ID/merge-requests/4")
+expect_json "$RESPONSE" '.data.status' "open" "reopen merge request"
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"status":"merged"}' \
+    "$API/repos/$REPO_ID/merge-requests/4")
+expect_contains "$RESPONSE" "status must be" "cannot set merged status directly"
+
+###############################################################################
+section "Merge"
+###############################################################################
+
+RESPONSE=$(merge_mr 4 '{}')
+expect_json "$RESPONSE" '.code' "merge_conflict" "conflicting merge rejected"
+expect_json "$RESPONSE" '.conflicts | join(",")' "README" "conflicts listed"
+
+RESPONSE=$(merge_mr 1 '{"strategy":"octopus"}')
+expect_contains "$RESPONSE" "strategy must be" "invalid strategy rejected"
+
+RESPONSE=$(merge_mr 1 '{}')
+expect_json "$RESPONSE" '.data.status' "merged" "merge commit"
+expect_json "$RESPONSE" '.data.merge_strategy' "merge" "default strategy is merge"
+MERGE_SHA=$(echo "$RESPONSE" | jq -r '.data.merge_commit_sha')
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/commits/$MERGE_SHA")
+expect_json "$RESPONSE" '.data.parent_shas | length' "2" "merge commit has two parents"
+expect_contains "$RESPONSE" "Merge branch 'feature' into 'main'" "default merge message"
+expect_json "$RESPONSE" '.data.committer.name' "$NS_NAME" "merged as the user"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/refs")
+expect_contains "$RESPONSE" "$MERGE_SHA" "target branch moved"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/events")
+expect_contains "$RESPONSE" "$MERGE_SHA" "merge recorded as a push event"
+
+RESPONSE=$(merge_mr 1 '{}')
+expect_contains "$RESPONSE" "not open" "merged merge request cannot be merged again"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/merge-requests/1/diff")
+expect_json "$RESPONSE" '.data.commits | length' "2" "merged diff uses recorded heads"
+
+RESPONSE=$(merge_mr 2 '{"strategy":"squash"}')
+expect_json "$RESPONSE" '.data.merge_strategy' "squash" "squash merge"
+SQUASH_SHA=$(echo "$RESPONSE" | jq -r '.data.merge_commit_sha')
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/commits/$SQUASH_SHA")
+expect_json "$RESPONSE" '.data.parent_shas | length' "1" "squash commit has one parent"
+expect_json "$RESPONSE" '.data.message | rtrimstr("\n")' "Squash it (#2)
+
+Two parts" "squash message from title and description"
+expect_json "$RESPONSE" '.data.author.email' "dev@example.com" "squash credits the branch author"
+
+# Require linear history so only rebase merges are allowed.
+auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"pattern":"main","require_linear_history":true}' \
+    "$API/repos/$REPO_ID/protections" > /dev/null
+
+RESPONSE=$(merge_mr 3 '{"strategy":"merge"}')
+expect_contains "$RESPONSE" "linear" "branch protection applies to merges"
+
+RESPONSE=$(merge_mr 3 '{"strategy":"rebase"}')
+expect_json "$RESPONSE" '.data.merge_strategy' "rebase" "rebase merge"
+REBASE_SHA=$(echo "$RESPONSE" | jq -r '.data.merge_commit_sha')
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/commits/$REBASE_SHA")
+expect_json "$RESPONSE" '.data.message | rtrimstr("\n")' "Rebase me" "rebased commit keeps its message"
+expect_json "$RESPONSE" '.data.parent_shas[0]' "$SQUASH_SHA" "rebased onto the target"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/merge-requests?status=merged")
+expect_json "$RESPONSE" '[.data[].number] | join(",")' "3,2,1" "list merged"
+
+###############################################################################
+section "Access Control"
+###############################################################################
+
+STATUS=$(anon_curl -o /dev/null -w "%{http_code}" "$API/repos/$REPO_ID/merge-requests")
+if [ "$STATUS" = "401" ]; then
+    pass "anonymous list rejected"
+else
+    fail "anonymous list rejected" "401" "$STATUS"
+fi
+
+cd /
+rm -rf "$TMPDIR"
+
+###############################################################################
+summary
@@ -0,0 +1,200 @@
+#!/bin/bash
+# Branch Merge Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Branch Merge Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+# commit_file writes a file and commits it.
+commit_file() {
+    echo -e "$2" > "$1"
+    git add "$1"
+    git -c user.name=dev -c user.email=dev@example.com commit -q -m "$3"
+}
+
+merge() {
+    auth_curl -X POST -H "Content-Type: application/json" -d "$1" "$API/repos/$REPO_ID/merges"
+}
+
+branch_sha() {
+    auth_curl "$API/repos/$REPO_ID/refs" | jq -r ".data[] | select(.name == \"$1\") | .commit_sha"
+}
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+NS_JSON=$(auth_curl "$API/namespaces")
+NS_NAME=$(echo "$NS_JSON" | jq -r '.data[] | select(.is_primary == true) | .name' 2>/dev/null)
+if [ -z "$NS_NAME" ] || [ "$NS_NAME" = "null" ]; then
+    echo "Failed to get namespace name"
+    exit 1
+fi
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"test-merges"}' \
+    "$API/repos")
+REPO_ID=$(get_id "$RESPONSE")
+if [ -z "$REPO_ID" ]; then
+    echo "Failed to create repo: $RESPONSE"
+    exit 1
+fi
+track_repo "$REPO_ID"
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+git init -q work
+cd work
+git checkout -q -b main 2>/dev/null || true
+commit_file README "one\ntwo\nthree" "Initial commit"
+
+git checkout -q -b ahead
+commit_file ahead.txt "ahead" "Ahead of main"
+
+git checkout -q -b diverged main
+commit_file diverged.txt "diverged" "Diverge from main"
+
+git checkout -q -b conflict main
+commit_file README "one\nconflict\nthree" "Conflicting change"
+
+git checkout -q -b target main
+git checkout -q main
+commit_file main.txt "main" "Work on main"
+commit_file README "one\nmain\nthree" "Change readme on main"
+
+git remote add origin "http://x-token:$TOKEN@${BASE_URL#http://}/git/$NS_NAME/test-merges.git"
+git push -q origin main ahead diverged conflict target 2>/dev/null
+TARGET_SHA=$(git rev-parse target)
+AHEAD_SHA=$(git rev-parse ahead)
+info "Pushed test branches"
+
+###############################################################################
+section "Validation"
+###############################################################################
+
+RESPONSE=$(merge '{"head":"ahead"}')
+expect_contains "$RESPONSE" "base: ref name is required" "base required"
+
+RESPONSE=$(merge '{"base":"main"}')
+expect_contains "$RESPONSE" "head is required" "head required"
+
+RESPONSE=$(merge '{"base":"nope","head":"ahead"}')
+expect_contains "$RESPONSE" "Branch not found" "missing base rejected"
+
+RESPONSE=$(merge '{"base":"main","head":"nope"}')
+expect_contains "$RESPONSE" "Reference not found" "missing head rejected"
+
+RESPONSE=$(merge '{"base":"main","head":"ahead","strategy":"octopus"}')
+expect_contains "$RESPONSE" "strategy must be" "invalid strategy rejected"
+
+RESPONSE=$(merge '{"base":"main","head":"ahead","fast_forward":"sometimes"}')
+expect_contains "$RESPONSE" "fast_forward must be" "invalid fast_forward rejected"
+
+RESPONSE=$(merge '{"base":"main","head":"ahead","strategy":"squash","fast_forward":"only"}')
+expect_contains "$RESPONSE" "only applies to the merge strategy" "fast_forward needs the merge strategy"
+
+RESPONSE=$(merge '{"base":"main","head":"ahead","author":{"name":"bot"}}')
+expect_contains "$RESPONSE" "author name and email are required" "incomplete author rejected"
+
+###############################################################################
+section "Fast-forward"
+###############################################################################
+
+RESPONSE=$(merge '{"base":"main","head":"target"}')
+expect_json "$RESPONSE" '.data.result' "up_to_date" "nothing to merge when head is in base"
+expect_json "$RESPONSE" '.data.sha' "$(git rev-parse main)" "base not moved"
+
+RESPONSE=$(merge "{\"base\":\"target\",\"head\":\"$AHEAD_SHA\",\"fast_forward\":\"only\"}")
+expect_json "$RESPONSE" '.data.result' "fast_forward" "fast-forward to a commit"
+expect_json "$RESPONSE" '.data.old_sha' "$TARGET_SHA" "old sha reported"
+expect_json "$RESPONSE" '.data.sha' "$AHEAD_SHA" "fast-forwarded to head"
+expect_contains "$(branch_sha target)" "$AHEAD_SHA" "base branch moved"
+
+RESPONSE=$(merge '{"base":"target","head":"diverged","fast_forward":"only"}')
+expect_json "$RESPONSE" '.code' "not_fast_forward" "diverged head cannot fast-forward"
+
+###############################################################################
+section "Merge"
+###############################################################################
+
+RESPONSE=$(merge '{"base":"target","head":"diverged","author":{"name":"Merge Bot","email":"bot@example.com"}}')
+expect_json "$RESPONSE" '.data.result' "merged" "merge commit created"
+MERGE_SHA=$(echo "$RESPONSE" | jq -r '.data.sha')
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/commits/$MERGE_SHA")
+expect_json "$RESPONSE" '.data.parent_shas | join(",")' "$AHEAD_SHA,$(git rev-parse diverged)" "merge commit parents"
+expect_json "$RESPONSE" '.data.author.name' "Merge Bot" "supplied author"
+expect_json "$RESPONSE" '.data.author.email' "bot@example.com" "supplied author email"
+expect_json "$RESPONSE" '.data.committer.name' "$NS_NAME" "committed as the user"
+expect_json "$RESPONSE" '.data.message | rtrimstr("\n")' "Merge branch 'diverged' into target" "default merge message"
+
+RESPONSE=$(merge '{"base":"main","head":"ahead","fast_forward":"never","message":"Bring in ahead"}')
+expect_json "$RESPONSE" '.data.result' "merged" "merge commit instead of fast-forward"
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/commits/$(echo "$RESPONSE" | jq -r '.data.sha')")
+expect_json "$RESPONSE" '.data.parent_shas | length' "2" "no fast-forward creates two parents"
+expect_json "$RESPONSE" '.data.message | rtrimstr("\n")' "Bring in ahead" "custom message"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/events")
+expect_contains "$RESPONSE" "$MERGE_SHA" "merge recorded as a push event"
+
+###############################################################################
+section "Conflicts"
+###############################################################################
+
+MAIN_SHA=$(branch_sha main)
+RESPONSE=$(merge '{"base":"main","head":"conflict"}')
+expect_json "$RESPONSE" '.code' "merge_conflict" "conflicting merge rejected"
+expect_json "$RESPONSE" '.conflicts | join(",")' "README" "conflicting files listed"
+expect_contains "$(branch_sha main)" "$MAIN_SHA" "base unchanged after conflict"
+
+###############################################################################
+section "Rebase and Squash"
+###############################################################################
+
+RESPONSE=$(merge '{"base":"main","head":"diverged","strategy":"rebase"}')
+expect_json "$RESPONSE" '.data.result' "merged" "rebase onto base"
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/commits/$(echo "$RESPONSE" | jq -r '.data.sha')")
+expect_json "$RESPONSE" '.data.parent_shas[0]' "$MAIN_SHA" "rebased commit on top of base"
+expect_json "$RESPONSE" '.data.author.name' "dev" "rebased commit keeps its author"
+
+auth_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"name\":\"squashed\",\"type\":\"branch\",\"target\":\"$(git rev-parse main~2)\"}" \
+    "$API/repos/$REPO_ID/refs" > /dev/null
+RESPONSE=$(merge '{"base":"squashed","head":"ahead","strategy":"squash"}')
+expect_json "$RESPONSE" '.data.result' "merged" "squash merge"
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/commits/$(echo "$RESPONSE" | jq -r '.data.sha')")
+expect_json "$RESPONSE" '.data.parent_shas | length' "1" "squash commit has one parent"
+expect_json "$RESPONSE" '.data.message | rtrimstr("\n")' "Squash branch 'ahead' into squashed" "default squash message"
+
+###############################################################################
+section "Protection and Access"
+###############################################################################
+
+auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"pattern":"target","require_linear_history":true}' \
+    "$API/repos/$REPO_ID/protections" > /dev/null
+
+RESPONSE=$(merge '{"base":"target","head":"main"}')
+expect_contains "$RESPONSE" "linear" "branch protection applies"
+
+STATUS=$(anon_curl -o /dev/null -w "%{http_code}" -X POST -H "Content-Type: application/json" \
+    -d '{"base":"main","head":"ahead"}' "$API/repos/$REPO_ID/merges")
+if [ "$STATUS" = "401" ]; then
+    pass "anonymous merge rejected"
+else
+    fail "anonymous merge rejected" "401" "$STATUS"
+fi
+
+cd /
+rm -rf "$TMPDIR"
+
+###############################################################################
+summary
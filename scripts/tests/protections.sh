@@ -0,0 +1,148 @@
+#!/bin/bash
+# Branch Protection Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Branch Protection Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+NS_JSON=$(auth_curl "$API/namespaces")
+NS_NAME=$(echo "$NS_JSON" | jq -r '.data[] | select(.is_primary == true) | .name' 2>/dev/null)
+if [ -z "$NS_NAME" ] || [ "$NS_NAME" = "null" ]; then
+    echo "Failed to get namespace name"
+    exit 1
+fi
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"test-protections","public":false}' \
+    "$API/repos")
+
+REPO_ID=$(get_id "$RESPONSE")
+if [ -z "$REPO_ID" ]; then
+    echo "Failed to create repo: $RESPONSE"
+    exit 1
+fi
+track_repo "$REPO_ID"
+info "Created repo: $REPO_ID"
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+
+git clone -q "http://x-token:$TOKEN@${BASE_URL#http://}/git/$NS_NAME/test-protections.git" repo 2>/dev/null
+cd repo
+git checkout -q -b main 2>/dev/null || true
+
+echo "one" > file.txt
+git add .
+git commit -q -m "First"
+echo "two" >> file.txt
+git commit -q -am "Second"
+git push -q origin main 2>/dev/null
+git push -q origin main:refs/heads/feature 2>/dev/null
+
+###############################################################################
+section "Manage Rules"
+###############################################################################
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"pattern":"main","block_force_push":true,"block_deletion":true,"require_linear_history":true}' \
+    "$API/repos/$REPO_ID/protections")
+RULE_ID=$(get_id "$RESPONSE")
+expect_json "$RESPONSE" '.data.pattern' "main" "create rule"
+expect_json "$RESPONSE" '.data.push_permission' "repo:write" "push permission defaults to repo:write"
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"pattern":"main"}' \
+    "$API/repos/$REPO_ID/protections")
+expect_contains "$RESPONSE" "already exists" "duplicate pattern rejected"
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"pattern":"main","push_permission":"namespace:admin"}' \
+    "$API/repos/$REPO_ID/protections")
+expect_contains "$RESPONSE" "push_permission must be" "invalid push permission rejected"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/protections")
+expect_contains "$RESPONSE" "$RULE_ID" "list rules"
+
+###############################################################################
+section "Push Enforcement"
+###############################################################################
+
+git reset -q --hard HEAD~1
+echo "rewritten" >> file.txt
+git commit -q -am "Rewritten"
+
+OUTPUT=$(git push -f origin main 2>&1 || true)
+expect_contains "$OUTPUT" "force push to protected branch is not allowed" "force push rejected with reason"
+
+OUTPUT=$(git push origin --delete main 2>&1 || true)
+expect_contains "$OUTPUT" "rejected" "branch deletion rejected"
+
+OUTPUT=$(git push -f origin HEAD:feature 2>&1 || true)
+expect_not_contains "$OUTPUT" "rejected" "unprotected branch accepts force push"
+
+git fetch -q origin
+git reset -q --hard origin/main
+git checkout -q -b side
+echo "side" > side.txt
+git add side.txt
+git commit -q -m "Side"
+git checkout -q main
+echo "three" >> file.txt
+git commit -q -am "Third"
+git merge -q --no-ff --no-edit side
+OUTPUT=$(git push origin main 2>&1 || true)
+expect_contains "$OUTPUT" "requires linear history" "merge commit rejected"
+
+###############################################################################
+section "API Enforcement"
+###############################################################################
+
+auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"pattern":"release/*","block_deletion":true}' \
+    "$API/repos/$REPO_ID/protections" > /dev/null
+
+auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"release/1.0","type":"branch","target":"main"}' \
+    "$API/repos/$REPO_ID/refs" > /dev/null
+
+RESPONSE=$(auth_curl -X DELETE "$API/repos/$REPO_ID/refs/branch/release/1.0")
+expect_contains "$RESPONSE" "cannot be deleted" "API delete of protected branch rejected"
+
+ROOT_SHA=$(git rev-list --max-parents=0 HEAD)
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d "{\"target\":\"$ROOT_SHA\"}" \
+    "$API/repos/$REPO_ID/refs/branch/main")
+expect_contains "$RESPONSE" "force push" "API rewind of protected branch rejected"
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"push_permission":"repo:admin","block_deletion":false}' \
+    "$API/repos/$REPO_ID/protections/$RULE_ID")
+expect_json "$RESPONSE" '.data.push_permission' "repo:admin" "update rule"
+
+STATUS=$(auth_curl -o /dev/null -w "%{http_code}" -X DELETE "$API/repos/$REPO_ID/protections/$RULE_ID")
+if [ "$STATUS" = "204" ]; then
+    pass "delete rule"
+else
+    fail "delete rule" "204" "$STATUS"
+fi
+
+OUTPUT=$(git push -f origin main 2>&1 || true)
+expect_not_contains "$OUTPUT" "rejected" "push accepted after rule removed"
+
+cd /
+rm -rf "$TMPDIR"
+
+###############################################################################
+summary
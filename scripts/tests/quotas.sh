@@ -0,0 +1,140 @@
+#!/bin/bash
+# Namespace Quota Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Namespace Quota Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"quotas-ns","repo_limit":1}' \
+    "$ADMIN_API/namespaces")
+NS_ID=$(get_id "$RESPONSE")
+if [ -z "$NS_ID" ]; then
+    echo "Failed to create namespace: $RESPONSE"
+    exit 1
+fi
+track_namespace "$NS_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$NS_ID\"}" \
+    "$ADMIN_API/users")
+USER_ID=$(get_id "$RESPONSE")
+track_user "$USER_ID"
+
+# namespace:admin is needed to change the limits during the test.
+admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$NS_ID\",\"allow\":[\"namespace:admin\",\"repo:admin\"]}" \
+    "$ADMIN_API/users/$USER_ID/namespace-grants" > /dev/null
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{}' \
+    "$ADMIN_API/users/$USER_ID/tokens")
+NS_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+
+GIT_BASE="http://x-token:$NS_TOKEN@${BASE_URL#http://}/git/quotas-ns"
+
+###############################################################################
+section "Usage"
+###############################################################################
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" "$API/namespaces/quotas-ns/usage")
+expect_json "$RESPONSE" '.data.repo_count' "0" "empty namespace has no repos"
+expect_json "$RESPONSE" '.data.repo_limit' "1" "usage reports repo limit"
+expect_json "$RESPONSE" '.data.storage_bytes' "0" "empty namespace uses no storage"
+
+RESPONSE=$(auth_curl "$API/namespaces/quotas-ns/usage")
+expect_contains "$RESPONSE" "Insufficient permissions\|Forbidden\|not found" "usage requires namespace access"
+
+###############################################################################
+section "Repo Limit"
+###############################################################################
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"first","namespace":"quotas-ns"}' \
+    "$API/repos")
+REPO_ID=$(get_id "$RESPONSE")
+expect_json "$RESPONSE" '.data.name' "first" "create repo within limit"
+
+STATUS=$(auth_curl_with "$NS_TOKEN" -o /dev/null -w "%{http_code}" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"second","namespace":"quotas-ns"}' \
+    "$API/repos")
+if [ "$STATUS" = "403" ]; then
+    pass "create repo over limit returns 403"
+else
+    fail "create repo over limit returns 403" "403" "$STATUS"
+fi
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"second","namespace":"quotas-ns"}' \
+    "$API/repos")
+expect_json "$RESPONSE" '.code' "quota_exceeded" "quota error code"
+expect_json "$RESPONSE" '.quota' "repo_limit" "quota error names the quota"
+expect_json "$RESPONSE" '.used' "1" "quota error reports usage"
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+
+git init -q repo
+cd repo
+git checkout -q -b main 2>/dev/null || true
+echo "hello" > file.txt
+git add .
+git commit -q -m "Initial"
+
+if git push -q "$GIT_BASE/auto-created.git" main 2>/dev/null; then
+    fail "push auto-create over limit rejected" "push rejected" "push succeeded"
+else
+    pass "push auto-create over limit rejected"
+fi
+
+###############################################################################
+section "Storage Limit"
+###############################################################################
+
+if git push -q "$GIT_BASE/first.git" main 2>/dev/null; then
+    pass "push within storage limit"
+else
+    fail "push within storage limit" "push succeeded" "push rejected"
+fi
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" "$API/namespaces/quotas-ns/usage")
+GIT_BYTES=$(echo "$RESPONSE" | jq -r '.data.git_bytes')
+if [ "$GIT_BYTES" -gt 0 ] 2>/dev/null; then
+    pass "usage counts pushed git storage"
+else
+    fail "usage counts pushed git storage" "> 0" "$GIT_BYTES"
+fi
+
+auth_curl_with "$NS_TOKEN" -X PATCH -H "Content-Type: application/json" \
+    -d '{"storage_limit_bytes":1}' \
+    "$API/namespaces/quotas-ns" > /dev/null
+
+echo "more" >> file.txt
+git commit -q -am "Second"
+
+if git push -q "$GIT_BASE/first.git" main 2>/dev/null; then
+    fail "push over storage limit rejected" "push rejected" "push succeeded"
+else
+    pass "push over storage limit rejected"
+fi
+
+cd /
+rm -rf "$TMPDIR"
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" "$API/namespaces/quotas-ns/usage")
+expect_json "$RESPONSE" '.data.storage_limit_bytes' "1" "usage reports storage limit"
+
+###############################################################################
+summary
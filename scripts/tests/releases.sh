@@ -0,0 +1,268 @@
+#!/bin/bash
+# Releases API Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+require_admin_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Releases API Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+create_release() {
+    auth_curl -X POST -H "Content-Type: application/json" -d "$1" "$API/repos/$REPO_ID/releases"
+}
+
+upload_asset() {
+    auth_curl -X POST -H "Content-Type: ${4:-application/octet-stream}" \
+        --data-binary "@$3" "$API/repos/$REPO_ID/releases/$1/assets?name=$2"
+}
+
+expect_status() {
+    if [ "$1" = "$2" ]; then
+        pass "$3"
+    else
+        fail "$3" "$2" "$1"
+    fi
+}
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+NS_JSON=$(auth_curl "$API/namespaces")
+NS_NAME=$(echo "$NS_JSON" | jq -r '.data[] | select(.is_primary == true) | .name' 2>/dev/null)
+if [ -z "$NS_NAME" ] || [ "$NS_NAME" = "null" ]; then
+    echo "Failed to get namespace name"
+    exit 1
+fi
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"test-releases"}' \
+    "$API/repos")
+REPO_ID=$(get_id "$RESPONSE")
+if [ -z "$REPO_ID" ]; then
+    echo "Failed to create repo: $RESPONSE"
+    exit 1
+fi
+track_repo "$REPO_ID"
+
+RESPONSE=$(auth_curl -X PUT -H "Content-Type: application/json" \
+    -d '{"content":"# Releases\n"}' "$API/repos/$REPO_ID/contents/README.md")
+COMMIT_SHA=$(echo "$RESPONSE" | jq -r '.data.commit.sha')
+
+for TAG in v1.0.0 v2.0.0-rc1 v3.0.0; do
+    auth_curl -X POST -H "Content-Type: application/json" \
+        -d "{\"name\":\"$TAG\",\"sha\":\"$COMMIT_SHA\",\"type\":\"tag\"}" \
+        "$API/repos/$REPO_ID/refs" > /dev/null
+done
+
+# A second user who can only read the repo.
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"releases-reader"}' "$ADMIN_API/namespaces")
+READER_NS_ID=$(get_id "$RESPONSE")
+track_namespace "$READER_NS_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$READER_NS_ID\"}" "$ADMIN_API/users")
+READER_ID=$(get_id "$RESPONSE")
+track_user "$READER_ID"
+
+admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"repo_id\":\"$REPO_ID\",\"allow\":[\"repo:read\"]}" \
+    "$ADMIN_API/users/$READER_ID/repo-grants" > /dev/null
+admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$READER_NS_ID\",\"allow\":[\"namespace:admin\",\"repo:admin\"]}" \
+    "$ADMIN_API/users/$READER_ID/namespace-grants" > /dev/null
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{}' "$ADMIN_API/users/$READER_ID/tokens")
+READER_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+
+TMPDIR=$(mktemp -d)
+
+###############################################################################
+section "Create"
+###############################################################################
+
+RESPONSE=$(create_release '{"tag_name":"v1.0.0","title":"First release","notes":"Initial version"}')
+expect_json "$RESPONSE" '.data.tag_name' "v1.0.0" "release created"
+expect_json "$RESPONSE" '.data.title' "First release" "title set"
+expect_json "$RESPONSE" '.data.draft' "false" "published by default"
+expect_json "$RESPONSE" '.data.published_at != null' "true" "published_at set"
+expect_json "$RESPONSE" '.data.assets | length' "0" "no assets yet"
+RELEASE_ID=$(get_id "$RESPONSE")
+
+RESPONSE=$(create_release '{"tag_name":"v2.0.0-rc1","prerelease":true}')
+expect_json "$RESPONSE" '.data.title' "v2.0.0-rc1" "title defaults to the tag"
+expect_json "$RESPONSE" '.data.prerelease' "true" "prerelease flag set"
+
+RESPONSE=$(create_release '{"tag_name":"v3.0.0","draft":true}')
+expect_json "$RESPONSE" '.data.draft' "true" "draft created"
+expect_json "$RESPONSE" '.data.published_at' "null" "draft is not published"
+DRAFT_ID=$(get_id "$RESPONSE")
+
+RESPONSE=$(create_release '{"tag_name":"v1.0.0"}')
+expect_contains "$RESPONSE" "already exists" "one release per tag"
+
+RESPONSE=$(create_release '{"tag_name":"v9.9.9"}')
+expect_contains "$RESPONSE" "Tag not found" "tag must exist"
+
+###############################################################################
+section "Read"
+###############################################################################
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/releases")
+expect_json "$RESPONSE" '.data | length' "3" "writer sees drafts"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/releases/tags/v1.0.0")
+expect_json "$RESPONSE" '.data.id' "$RELEASE_ID" "release found by tag"
+
+RESPONSE=$(auth_curl_with "$READER_TOKEN" "$API/repos/$REPO_ID/releases")
+expect_json "$RESPONSE" '[.data[].tag_name] | sort | join(",")' "v1.0.0,v2.0.0-rc1" "reader does not see drafts"
+
+STATUS=$(auth_curl_with "$READER_TOKEN" -o /dev/null -w "%{http_code}" "$API/repos/$REPO_ID/releases/$DRAFT_ID")
+expect_status "$STATUS" "404" "draft hidden from reader"
+
+STATUS=$(auth_curl_with "$READER_TOKEN" -o /dev/null -w "%{http_code}" -X POST -H "Content-Type: application/json" \
+    -d '{"tag_name":"v3.0.0"}' "$API/repos/$REPO_ID/releases")
+expect_status "$STATUS" "403" "reader cannot create releases"
+
+STATUS=$(anon_curl -o /dev/null -w "%{http_code}" "$API/repos/$REPO_ID/releases")
+expect_status "$STATUS" "401" "private releases require auth"
+
+###############################################################################
+section "Update"
+###############################################################################
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"draft":false,"notes":"Now public"}' "$API/repos/$REPO_ID/releases/$DRAFT_ID")
+expect_json "$RESPONSE" '.data.draft' "false" "draft published"
+expect_json "$RESPONSE" '.data.published_at != null' "true" "published_at set on publish"
+
+RESPONSE=$(auth_curl_with "$READER_TOKEN" "$API/repos/$REPO_ID/releases/$DRAFT_ID")
+expect_json "$RESPONSE" '.data.notes' "Now public" "published release visible to reader"
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"tag_name":"v1.0.0"}' "$API/repos/$REPO_ID/releases/$DRAFT_ID")
+expect_contains "$RESPONSE" "already exists" "retagging onto a released tag rejected"
+
+###############################################################################
+section "Assets"
+###############################################################################
+
+printf 'binary \x00\x01\x02 payload' > "$TMPDIR/app.bin"
+RESPONSE=$(upload_asset "$RELEASE_ID" "app-linux-amd64" "$TMPDIR/app.bin")
+expect_json "$RESPONSE" '.data.name' "app-linux-amd64" "asset uploaded"
+expect_json "$RESPONSE" '.data.size' "$(wc -c < "$TMPDIR/app.bin" | tr -d ' ')" "asset size recorded"
+expect_json "$RESPONSE" '.data.sha256' "$(sha256sum "$TMPDIR/app.bin" | cut -d' ' -f1)" "asset sha256 recorded"
+ASSET_ID=$(get_id "$RESPONSE")
+
+RESPONSE=$(upload_asset "$RELEASE_ID" "app-linux-amd64" "$TMPDIR/app.bin")
+expect_contains "$RESPONSE" "already has an asset" "duplicate asset name rejected"
+
+RESPONSE=$(upload_asset "$RELEASE_ID" "..%2Fescape" "$TMPDIR/app.bin")
+expect_contains "$RESPONSE" "name must be a file name" "path-like names rejected"
+
+echo '{"version":1}' > "$TMPDIR/manifest.json"
+RESPONSE=$(upload_asset "$RELEASE_ID" "manifest.json" "$TMPDIR/manifest.json" "application/json")
+expect_json "$RESPONSE" '.data.content_type' "application/json" "content type recorded"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/releases/$RELEASE_ID")
+expect_json "$RESPONSE" '[.data.assets[].name] | join(",")' "app-linux-amd64,manifest.json" "assets listed in upload order"
+
+auth_curl -D "$TMPDIR/headers" -o "$TMPDIR/download.bin" "$API/repos/$REPO_ID/releases/$RELEASE_ID/assets/$ASSET_ID"
+if cmp -s "$TMPDIR/app.bin" "$TMPDIR/download.bin"; then
+    pass "download matches upload"
+else
+    fail "download matches upload" "identical content" "$(od -c "$TMPDIR/download.bin" | head -3)"
+fi
+expect_contains "$(cat "$TMPDIR/headers")" 'filename=app-linux-amd64' "download is an attachment"
+
+RESPONSE=$(auth_curl_with "$READER_TOKEN" "$API/repos/$REPO_ID/releases/$RELEASE_ID/assets/$ASSET_ID")
+expect_contains "$RESPONSE" "payload" "reader can download"
+
+# The same content uploaded to another release shares storage.
+USAGE_BEFORE=$(auth_curl "$API/namespaces/$NS_NAME/usage" | jq -r '.data.release_bytes')
+RESPONSE=$(upload_asset "$DRAFT_ID" "app-linux-amd64" "$TMPDIR/app.bin")
+SHARED_ID=$(get_id "$RESPONSE")
+RESPONSE=$(auth_curl "$API/namespaces/$NS_NAME/usage")
+expect_json "$RESPONSE" '.data.release_bytes' "$USAGE_BEFORE" "identical content counted once"
+
+STATUS=$(auth_curl -o /dev/null -w "%{http_code}" -X DELETE "$API/repos/$REPO_ID/releases/$RELEASE_ID/assets/$ASSET_ID")
+expect_status "$STATUS" "204" "asset deleted"
+
+STATUS=$(auth_curl -o /dev/null -w "%{http_code}" "$API/repos/$REPO_ID/releases/$RELEASE_ID/assets/$ASSET_ID")
+expect_status "$STATUS" "404" "deleted asset gone"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/releases/$DRAFT_ID/assets/$SHARED_ID")
+expect_contains "$RESPONSE" "payload" "shared content kept for the other asset"
+
+STATUS=$(auth_curl_with "$READER_TOKEN" -o /dev/null -w "%{http_code}" -X POST \
+    --data-binary "@$TMPDIR/app.bin" "$API/repos/$REPO_ID/releases/$RELEASE_ID/assets?name=x")
+expect_status "$STATUS" "403" "reader cannot upload"
+
+###############################################################################
+section "Public Access"
+###############################################################################
+
+auth_curl -X PATCH -H "Content-Type: application/json" -d '{"public":true}' "$API/repos/$REPO_ID" > /dev/null
+auth_curl -X PATCH -H "Content-Type: application/json" -d '{"draft":true}' "$API/repos/$REPO_ID/releases/$DRAFT_ID" > /dev/null
+
+RESPONSE=$(anon_curl "$API/repos/$REPO_ID/releases")
+expect_json "$RESPONSE" '[.data[].tag_name] | sort | join(",")' "v1.0.0,v2.0.0-rc1" "anonymous list of a public repo skips drafts"
+
+RESPONSE=$(anon_curl "$API/repos/$REPO_ID/releases/tags/v1.0.0")
+MANIFEST_ID=$(echo "$RESPONSE" | jq -r '.data.assets[] | select(.name == "manifest.json") | .id')
+RESPONSE=$(anon_curl "$API/repos/$REPO_ID/releases/$RELEASE_ID/assets/$MANIFEST_ID")
+expect_json "$RESPONSE" '.version' "1" "anonymous download from a public repo"
+
+STATUS=$(anon_curl -o /dev/null -w "%{http_code}" "$API/repos/$REPO_ID/releases/$DRAFT_ID/assets/$SHARED_ID")
+expect_status "$STATUS" "404" "draft assets hidden from anonymous users"
+
+STATUS=$(anon_curl -o /dev/null -w "%{http_code}" -X POST \
+    --data-binary "@$TMPDIR/app.bin" "$API/repos/$REPO_ID/releases/$RELEASE_ID/assets?name=x")
+expect_status "$STATUS" "401" "anonymous upload rejected"
+
+###############################################################################
+section "Quota"
+###############################################################################
+
+RESPONSE=$(auth_curl_with "$READER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"quota","namespace":"releases-reader"}' "$API/repos")
+QUOTA_REPO_ID=$(get_id "$RESPONSE")
+RESPONSE=$(auth_curl_with "$READER_TOKEN" -X PUT -H "Content-Type: application/json" \
+    -d '{"content":"x"}' "$API/repos/$QUOTA_REPO_ID/contents/README.md")
+QUOTA_SHA=$(echo "$RESPONSE" | jq -r '.data.commit.sha')
+auth_curl_with "$READER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d "{\"name\":\"v1\",\"sha\":\"$QUOTA_SHA\",\"type\":\"tag\"}" "$API/repos/$QUOTA_REPO_ID/refs" > /dev/null
+RESPONSE=$(auth_curl_with "$READER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"tag_name":"v1"}' "$API/repos/$QUOTA_REPO_ID/releases")
+QUOTA_RELEASE_ID=$(get_id "$RESPONSE")
+
+auth_curl_with "$READER_TOKEN" -X PATCH -H "Content-Type: application/json" \
+    -d '{"storage_limit_bytes":1}' "$API/namespaces/releases-reader" > /dev/null
+
+RESPONSE=$(auth_curl_with "$READER_TOKEN" -X POST --data-binary "@$TMPDIR/app.bin" \
+    "$API/repos/$QUOTA_REPO_ID/releases/$QUOTA_RELEASE_ID/assets?name=app.bin")
+expect_json "$RESPONSE" '.code' "quota_exceeded" "storage quota applies to assets"
+
+###############################################################################
+section "Delete"
+###############################################################################
+
+STATUS=$(auth_curl -o /dev/null -w "%{http_code}" -X DELETE "$API/repos/$REPO_ID/releases/$DRAFT_ID")
+expect_status "$STATUS" "204" "release deleted"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/releases")
+expect_json "$RESPONSE" '.data | length' "2" "release removed from list"
+
+rm -rf "$TMPDIR"
+
+###############################################################################
+summary
@@ -0,0 +1,248 @@
+#!/bin/bash
+# Review Thread Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+require_admin_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Review Thread Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+# commit_file writes a file and commits it.
+commit_file() {
+    echo -e "$2" > "$1"
+    git add "$1"
+    git -c user.name=dev -c user.email=dev@example.com commit -q -m "$3"
+}
+
+create_thread() {
+    auth_curl -X POST -H "Content-Type: application/json" -d "$1" "$API/repos/$REPO_ID/review-threads"
+}
+
+expect_status() {
+    if [ "$1" = "$2" ]; then
+        pass "$3"
+    else
+        fail "$3" "$2" "$1"
+    fi
+}
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+NS_JSON=$(auth_curl "$API/namespaces")
+NS_NAME=$(echo "$NS_JSON" | jq -r '.data[] | select(.is_primary == true) | .name' 2>/dev/null)
+if [ -z "$NS_NAME" ] || [ "$NS_NAME" = "null" ]; then
+    echo "Failed to get namespace name"
+    exit 1
+fi
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"test-review-threads"}' \
+    "$API/repos")
+REPO_ID=$(get_id "$RESPONSE")
+if [ -z "$REPO_ID" ]; then
+    echo "Failed to create repo: $RESPONSE"
+    exit 1
+fi
+track_repo "$REPO_ID"
+
+# A second user who can only read the repo.
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"review-reader"}' "$ADMIN_API/namespaces")
+READER_NS_ID=$(get_id "$RESPONSE")
+track_namespace "$READER_NS_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$READER_NS_ID\"}" "$ADMIN_API/users")
+READER_ID=$(get_id "$RESPONSE")
+track_user "$READER_ID"
+
+admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"repo_id\":\"$REPO_ID\",\"allow\":[\"repo:read\"]}" \
+    "$ADMIN_API/users/$READER_ID/repo-grants" > /dev/null
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{}' "$ADMIN_API/users/$READER_ID/tokens")
+READER_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+git init -q work
+cd work
+git checkout -q -b main 2>/dev/null || true
+commit_file app.txt "one\ntwo\nthree\nfour" "Initial commit"
+commit_file app.txt "one\ntwo\nTHREE\nfour\nfive" "Update app"
+printf '\x00\x01\x02' > data.bin
+git add data.bin
+git -c user.name=dev -c user.email=dev@example.com commit -q -m "Add binary"
+
+git checkout -q -b feature HEAD~1
+commit_file app.txt "one\ntwo\nTHREE\nfour\nfive\nsix" "Add six"
+
+git remote add origin "http://x-token:$TOKEN@${BASE_URL#http://}/git/$NS_NAME/test-review-threads.git"
+git push -q origin main feature 2>/dev/null
+INITIAL_SHA=$(git rev-parse main~2)
+UPDATE_SHA=$(git rev-parse main~1)
+BINARY_SHA=$(git rev-parse main)
+FEATURE_SHA=$(git rev-parse feature)
+info "Pushed test branches"
+
+###############################################################################
+section "Create"
+###############################################################################
+
+RESPONSE=$(create_thread "{\"commit_sha\":\"$UPDATE_SHA\",\"path\":\"app.txt\",\"line\":3,\"body\":\"Why uppercase?\"}")
+THREAD_ID=$(get_id "$RESPONSE")
+expect_json "$RESPONSE" '.data.side' "new" "side defaults to new"
+expect_json "$RESPONSE" '.data.base_sha' "$INITIAL_SHA" "base defaults to the first parent"
+expect_json "$RESPONSE" '.data.resolved' "false" "new thread is unresolved"
+expect_json "$RESPONSE" '.data.comments[0].body' "Why uppercase?" "first comment stored"
+expect_json "$RESPONSE" '.data.comments[0].author_name' "$NS_NAME" "author name"
+
+RESPONSE=$(create_thread "{\"commit_sha\":\"$UPDATE_SHA\",\"path\":\"app.txt\",\"side\":\"old\",\"line\":3,\"body\":\"Was lowercase\"}")
+expect_json "$RESPONSE" '.data.side' "old" "comment on the old side"
+
+RESPONSE=$(create_thread "{\"commit_sha\":\"$INITIAL_SHA\",\"path\":\"app.txt\",\"side\":\"old\",\"line\":1,\"body\":\"x\"}")
+expect_contains "$RESPONSE" "needs a base commit" "old side of a root commit rejected"
+
+RESPONSE=$(create_thread "{\"commit_sha\":\"$UPDATE_SHA\",\"path\":\"app.txt\",\"line\":9,\"body\":\"x\"}")
+expect_contains "$RESPONSE" "line must be at most 5" "line past end of file rejected"
+
+RESPONSE=$(create_thread "{\"commit_sha\":\"$UPDATE_SHA\",\"path\":\"missing.txt\",\"line\":1,\"body\":\"x\"}")
+expect_contains "$RESPONSE" "Path not found" "missing path rejected"
+
+RESPONSE=$(create_thread "{\"commit_sha\":\"$BINARY_SHA\",\"path\":\"data.bin\",\"line\":1,\"body\":\"x\"}")
+expect_contains "$RESPONSE" "binary" "binary file rejected"
+
+RESPONSE=$(create_thread "{\"commit_sha\":\"$UPDATE_SHA\",\"path\":\"app.txt\",\"line\":1,\"body\":\"\"}")
+expect_contains "$RESPONSE" "body is required" "empty body rejected"
+
+RESPONSE=$(create_thread "{\"commit_sha\":\"$UPDATE_SHA\",\"path\":\"app.txt\",\"line\":1,\"ref\":\"feature\",\"body\":\"x\"}")
+expect_contains "$RESPONSE" "head of ref" "ref must point at the commit"
+
+###############################################################################
+section "List"
+###############################################################################
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/commits/$UPDATE_SHA/diff")
+expect_json "$RESPONSE" '.data.review_threads | length' "2" "commit diff lists its threads"
+expect_json "$RESPONSE" '[.data.review_threads[].side] | join(",")' "new,old" "threads ordered by side"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/compare/$INITIAL_SHA...$UPDATE_SHA")
+expect_json "$RESPONSE" '.data.diff.review_threads | length' "2" "compare lists threads for the same range"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/commits/$BINARY_SHA/diff")
+expect_json "$RESPONSE" '.data.review_threads | length' "0" "other commits have no threads"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/review-threads?commit=$UPDATE_SHA&path=app.txt")
+expect_json "$RESPONSE" '.data | length' "2" "list by commit and path"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/review-threads")
+expect_contains "$RESPONSE" "commit or ref is required" "list needs a commit or ref"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/review-threads/$THREAD_ID")
+expect_json "$RESPONSE" '.data.line' "3" "get thread"
+
+###############################################################################
+section "Replies and Resolution"
+###############################################################################
+
+RESPONSE=$(auth_curl_with "$READER_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"body":"It is a constant"}' \
+    "$API/repos/$REPO_ID/review-threads/$THREAD_ID/comments")
+REPLY_ID=$(get_id "$RESPONSE")
+expect_json "$RESPONSE" '.data.author_name' "review-reader" "reader can reply"
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"body":"Edited"}' \
+    "$API/repos/$REPO_ID/review-threads/$THREAD_ID/comments/$REPLY_ID")
+expect_contains "$RESPONSE" "Only the author" "only the author can edit a comment"
+
+RESPONSE=$(auth_curl_with "$READER_TOKEN" -X PATCH -H "Content-Type: application/json" \
+    -d '{"body":"It is a constant now"}' \
+    "$API/repos/$REPO_ID/review-threads/$THREAD_ID/comments/$REPLY_ID")
+expect_json "$RESPONSE" '.data.body' "It is a constant now" "author edits a comment"
+
+STATUS=$(auth_curl_with "$READER_TOKEN" -o /dev/null -w "%{http_code}" -X PATCH \
+    -H "Content-Type: application/json" -d '{"resolved":true}' \
+    "$API/repos/$REPO_ID/review-threads/$THREAD_ID")
+expect_status "$STATUS" "403" "reader cannot resolve someone else's thread"
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"resolved":true}' \
+    "$API/repos/$REPO_ID/review-threads/$THREAD_ID")
+expect_json "$RESPONSE" '.data.resolved' "true" "resolve thread"
+expect_json "$RESPONSE" '.data.resolved_at != null' "true" "resolution time recorded"
+expect_json "$RESPONSE" '.data.comments | length' "2" "thread keeps its replies"
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"resolved":false}' \
+    "$API/repos/$REPO_ID/review-threads/$THREAD_ID")
+expect_json "$RESPONSE" '.data.resolved_by == null' "true" "unresolve thread"
+
+STATUS=$(auth_curl -o /dev/null -w "%{http_code}" -X DELETE \
+    "$API/repos/$REPO_ID/review-threads/$THREAD_ID/comments/$REPLY_ID")
+expect_status "$STATUS" "204" "repo admin deletes a reply"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/review-threads/$THREAD_ID")
+expect_json "$RESPONSE" '.data.comments | length' "1" "reply removed"
+
+FIRST_ID=$(echo "$RESPONSE" | jq -r '.data.comments[0].id')
+auth_curl -X DELETE "$API/repos/$REPO_ID/review-threads/$THREAD_ID/comments/$FIRST_ID" > /dev/null
+STATUS=$(auth_curl -o /dev/null -w "%{http_code}" "$API/repos/$REPO_ID/review-threads/$THREAD_ID")
+expect_status "$STATUS" "404" "deleting the last comment deletes the thread"
+
+###############################################################################
+section "Re-anchoring"
+###############################################################################
+
+RESPONSE=$(create_thread "{\"commit_sha\":\"$FEATURE_SHA\",\"path\":\"app.txt\",\"line\":4,\"ref\":\"feature\",\"body\":\"Keep four\"}")
+MOVING_ID=$(get_id "$RESPONSE")
+expect_json "$RESPONSE" '.data.ref' "feature" "thread follows a branch"
+
+RESPONSE=$(create_thread "{\"commit_sha\":\"$FEATURE_SHA\",\"path\":\"app.txt\",\"line\":6,\"ref\":\"feature\",\"body\":\"Six?\"}")
+CHANGING_ID=$(get_id "$RESPONSE")
+
+git checkout -q feature
+commit_file app.txt "zero\none\ntwo\nTHREE\nfour\nfive\nSIX" "Rework app"
+git push -q origin feature 2>/dev/null
+NEW_FEATURE_SHA=$(git rev-parse feature)
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/review-threads/$MOVING_ID")
+expect_json "$RESPONSE" '.data.commit_sha' "$NEW_FEATURE_SHA" "thread moved to the new head"
+expect_json "$RESPONSE" '.data.line' "5" "line shifted past the inserted line"
+expect_json "$RESPONSE" '.data.original_line' "4" "original line kept"
+expect_json "$RESPONSE" '.data.outdated' "false" "moved thread is current"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/review-threads/$CHANGING_ID")
+expect_json "$RESPONSE" '.data.outdated' "true" "changed line marks the thread outdated"
+expect_json "$RESPONSE" '.data.commit_sha' "$FEATURE_SHA" "outdated thread keeps its commit"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/review-threads?ref=feature&outdated=false")
+expect_json "$RESPONSE" '[.data[].id] | join(",")' "$MOVING_ID" "list current threads on a branch"
+
+###############################################################################
+section "Access Control"
+###############################################################################
+
+STATUS=$(anon_curl -o /dev/null -w "%{http_code}" "$API/repos/$REPO_ID/review-threads?ref=feature")
+expect_status "$STATUS" "401" "anonymous list of a private repo rejected"
+
+STATUS=$(anon_curl -o /dev/null -w "%{http_code}" -X POST -H "Content-Type: application/json" \
+    -d "{\"commit_sha\":\"$UPDATE_SHA\",\"path\":\"app.txt\",\"line\":1,\"body\":\"x\"}" \
+    "$API/repos/$REPO_ID/review-threads")
+expect_status "$STATUS" "401" "anonymous comment rejected"
+
+cd /
+rm -rf "$TMPDIR"
+
+###############################################################################
+summary
@@ -56,6 +56,17 @@ host = "127.0.0.1"
 
 [storage]
 data_dir = "./data"
+
+[lfs]
+enabled = true
+
+[mirrors]
+allow_local = true
+
+[mirrors.credentials.example]
+username = "mirror"
+password = "secret"
+url_prefixes = ["https://example.com/acme/"]
 EOF
 
 cd "$TEST_DIR"
@@ -144,6 +155,23 @@ run_suite "Admin-Users" "users.sh"
 run_suite "Admin-Namespaces" "namespaces.sh"
 run_suite "Folders" "folders.sh"
 run_suite "Content" "content.sh"
+run_suite "SSH-Keys" "keys.sh"
+run_suite "Protections" "protections.sh"
+run_suite "Webhooks" "webhooks.sh"
+run_suite "Push-Events" "events.sh"
+run_suite "Quotas" "quotas.sh"
+run_suite "LFS-Locks" "locks.sh"
+run_suite "Mirrors" "mirrors.sh"
+run_suite "Push-Mirrors" "push_mirrors.sh"
+run_suite "Search" "search.sh"
+run_suite "Commit-Search" "commit_search.sh"
+run_suite "Merge-Requests" "merge_requests.sh"
+run_suite "Merges" "merges.sh"
+run_suite "Contents" "contents.sh"
+run_suite "Review-Threads" "review_threads.sh"
+run_suite "Releases" "releases.sh"
+run_suite "Scoped-Tokens" "scoped_tokens.sh"
+run_suite "Deploy-Keys" "deploy_keys.sh"
 
 # Final summary
 echo ""
@@ -0,0 +1,164 @@
+#!/bin/bash
+# Scoped Token Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+require_admin_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Scoped Token Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"scoped-token-ns"}' \
+    "$ADMIN_API/namespaces")
+NS_ID=$(get_id "$RESPONSE")
+track_namespace "$NS_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$NS_ID\"}" \
+    "$ADMIN_API/users")
+USER_ID=$(get_id "$RESPONSE")
+track_user "$USER_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{}' \
+    "$ADMIN_API/users/$USER_ID/tokens")
+FULL_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+
+RESPONSE=$(auth_curl_with "$FULL_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"scoped-a","public":false}' \
+    "$API/repos")
+REPO_A_ID=$(get_id "$RESPONSE")
+
+RESPONSE=$(auth_curl_with "$FULL_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"scoped-b","public":false}' \
+    "$API/repos")
+REPO_B_ID=$(get_id "$RESPONSE")
+
+if [ -z "$REPO_A_ID" ] || [ -z "$REPO_B_ID" ]; then
+    echo "Failed to create repos: $RESPONSE"
+    exit 1
+fi
+info "Created repos: $REPO_A_ID $REPO_B_ID"
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+
+git init -q repo
+cd repo
+git checkout -q -b main
+echo "hello" > README.md
+git add .
+git commit -q -m "Initial"
+git push -q "http://x-token:$FULL_TOKEN@${BASE_URL#http://}/git/scoped-token-ns/scoped-a.git" main 2>/dev/null
+
+###############################################################################
+section "Create Scoped Tokens"
+###############################################################################
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"scope\":{\"allow\":[\"repo:read\"],\"repo_ids\":[\"$REPO_A_ID\"]}}" \
+    "$ADMIN_API/users/$USER_ID/tokens")
+READ_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+expect_json "$RESPONSE" '.data.metadata.scope.allow[0]' "repo:read" "scope permission returned"
+expect_json "$RESPONSE" '.data.metadata.scope.repo_ids[0]' "$REPO_A_ID" "scope repos returned"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"scope\":{\"allow\":[\"repo:write\"],\"namespace_ids\":[\"$NS_ID\"]}}" \
+    "$ADMIN_API/users/$USER_ID/tokens")
+NS_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+expect_json "$RESPONSE" '.data.metadata.scope.namespace_ids[0]' "$NS_ID" "scope namespaces returned"
+
+RESPONSE=$(admin_curl "$ADMIN_API/users/$USER_ID/tokens")
+expect_json "$RESPONSE" '[.data[] | select(.scope != null)] | length' "2" "list shows scopes"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"scope":{}}' \
+    "$ADMIN_API/users/$USER_ID/tokens")
+expect_contains "$RESPONSE" "scope" "empty scope rejected"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"scope":{"allow":["repo:bogus"]}}' \
+    "$ADMIN_API/users/$USER_ID/tokens")
+expect_contains "$RESPONSE" "Invalid permission" "unknown permission rejected"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"scope":{"repo_ids":["nonexistent"]}}' \
+    "$ADMIN_API/users/$USER_ID/tokens")
+expect_contains "$RESPONSE" "Repository not found" "unknown repo rejected"
+
+###############################################################################
+section "Repo Scope"
+###############################################################################
+
+RESPONSE=$(auth_curl_with "$READ_TOKEN" "$API/repos/$REPO_A_ID")
+expect_json "$RESPONSE" '.data.id' "$REPO_A_ID" "can read scoped repo"
+
+RESPONSE=$(auth_curl_with "$READ_TOKEN" "$API/repos/$REPO_B_ID")
+expect_not_contains "$RESPONSE" "\"id\":\"$REPO_B_ID\"" "cannot read other repo"
+
+RESPONSE=$(auth_curl_with "$READ_TOKEN" -X PATCH -H "Content-Type: application/json" \
+    -d '{"description":"changed"}' \
+    "$API/repos/$REPO_A_ID")
+expect_contains "$RESPONSE" "error" "cannot update with read scope"
+
+RESPONSE=$(auth_curl_with "$READ_TOKEN" "$API/repos?namespace=scoped-token-ns")
+expect_json "$RESPONSE" '[.data[].id] | join(",")' "$REPO_A_ID" "repo list filtered to scope"
+
+RESPONSE=$(auth_curl_with "$READ_TOKEN" "$API/repos")
+expect_json "$RESPONSE" '[.data[].id] | join(",")' "$REPO_A_ID" "default repo list filtered to scope"
+
+RESPONSE=$(auth_curl_with "$READ_TOKEN" "$API/namespaces")
+expect_json "$RESPONSE" '[.data[].name] | join(",")' "scoped-token-ns" "namespace list limited to scope"
+
+OUTPUT=$(git clone -q "http://x-token:$READ_TOKEN@${BASE_URL#http://}/git/scoped-token-ns/scoped-a.git" "$TMPDIR/clone" 2>&1 && echo "cloned")
+expect_contains "$OUTPUT" "cloned" "can clone scoped repo"
+
+echo "more" >> README.md
+git commit -q -am "More"
+OUTPUT=$(git push "http://x-token:$READ_TOKEN@${BASE_URL#http://}/git/scoped-token-ns/scoped-a.git" main 2>&1 || true)
+expect_contains "$OUTPUT" "Write access denied" "push rejected with read scope"
+
+RESPONSE=$(auth_curl_with "$READ_TOKEN" "$API/user/keys")
+expect_contains "$RESPONSE" "Scoped tokens cannot manage SSH keys" "cannot manage SSH keys"
+
+###############################################################################
+section "Namespace Scope"
+###############################################################################
+
+OUTPUT=$(git push "http://x-token:$NS_TOKEN@${BASE_URL#http://}/git/scoped-token-ns/scoped-a.git" main 2>&1 || true)
+expect_contains "$OUTPUT" "main -> main" "push allowed with write scope"
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" "$API/repos?namespace=scoped-token-ns")
+expect_json_length "$RESPONSE" '.data' "2" "all namespace repos listed"
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" -X DELETE "$API/repos/$REPO_B_ID")
+expect_contains "$RESPONSE" "error" "cannot delete with write scope"
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"scoped-c","public":false}' \
+    "$API/repos")
+expect_contains "$RESPONSE" "error" "cannot create repos without namespace permission"
+
+###############################################################################
+section "Cleanup Repos"
+###############################################################################
+
+auth_curl_with "$FULL_TOKEN" -X DELETE "$API/repos/$REPO_A_ID" > /dev/null
+auth_curl_with "$FULL_TOKEN" -X DELETE "$API/repos/$REPO_B_ID" > /dev/null
+pass "repos deleted"
+
+cd /
+rm -rf "$TMPDIR"
+
+summary
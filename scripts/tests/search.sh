@@ -0,0 +1,191 @@
+#!/bin/bash
+# Code Search Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Code Search Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+# search runs a code search in the test namespace; extra curl arguments such
+# as --data-urlencode "mode=regex" are passed through.
+search() {
+    local query="$1"
+    shift
+    auth_curl -G --data-urlencode "q=$query" --data-urlencode "namespace=$NS_NAME" "$@" "$API/search/code"
+}
+
+# wait_for_results polls until a search returns the expected number of files.
+wait_for_results() {
+    local query="$1"
+    local count="$2"
+    local response
+    for _ in $(seq 1 50); do
+        response=$(search "$query" --data-urlencode "repo=test-search")
+        if [ "$(echo "$response" | jq -r '.data | length')" = "$count" ]; then
+            break
+        fi
+        sleep 0.2
+    done
+    echo "$response"
+}
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+NS_JSON=$(auth_curl "$API/namespaces")
+NS_NAME=$(echo "$NS_JSON" | jq -r '.data[] | select(.is_primary == true) | .name' 2>/dev/null)
+if [ -z "$NS_NAME" ] || [ "$NS_NAME" = "null" ]; then
+    echo "Failed to get namespace name"
+    exit 1
+fi
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"test-search"}' \
+    "$API/repos")
+REPO_ID=$(get_id "$RESPONSE")
+if [ -z "$REPO_ID" ]; then
+    echo "Failed to create repo: $RESPONSE"
+    exit 1
+fi
+track_repo "$REPO_ID"
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"test-search-other"}' \
+    "$API/repos")
+OTHER_ID=$(get_id "$RESPONSE")
+track_repo "$OTHER_ID"
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+git init -q work
+cd work
+git checkout -q -b main 2>/dev/null || true
+mkdir -p docs cmd
+cat > cmd/main.go <<'EOF'
+package main
+
+// main loads the configuration.
+func main() {
+	cfg := ParseConfig("server.toml")
+	run(cfg)
+}
+
+func ParseConfig(path string) Config {
+	return Config{}
+}
+EOF
+echo "Call parseconfig before starting the server." > docs/guide.md
+printf 'PNG\0ParseConfig' > docs/logo.png
+git add .
+git commit -q -m "Initial commit"
+git remote add origin "http://x-token:$TOKEN@${BASE_URL#http://}/git/$NS_NAME/test-search.git"
+git push -q origin main 2>/dev/null
+info "Pushed test content"
+
+###############################################################################
+section "Literal Search"
+###############################################################################
+
+RESPONSE=$(wait_for_results "ParseConfig" "2")
+expect_json "$RESPONSE" '.data | length' "2" "search is case-insensitive and skips binary files"
+expect_json "$RESPONSE" '[.data[].path] | sort | join(",")' "cmd/main.go,docs/guide.md" "matching files returned"
+expect_json "$RESPONSE" '.data[0].repo' "test-search" "result names repo"
+expect_json "$RESPONSE" '.data[0].ref' "main" "result names default branch"
+
+RESPONSE=$(search "ParseConfig" --data-urlencode "case_sensitive=true" --data-urlencode "path=*.go")
+expect_json "$RESPONSE" '.data | length' "1" "case-sensitive search"
+expect_json "$RESPONSE" '.data[0].matches | length' "2" "every matching line returned"
+expect_json "$RESPONSE" '.data[0].matches[0].line_number' "5" "match line number"
+expect_json "$RESPONSE" '.data[0].matches[0].ranges[0] | join(",")' "8,19" "match byte range"
+expect_json "$RESPONSE" '.data[0].matches[0].before | length' "2" "default context before"
+expect_json "$RESPONSE" '.data[0].matches[0].after[0]' "	run(cfg)" "context after"
+
+RESPONSE=$(search "ParseConfig" --data-urlencode "context=0" --data-urlencode "path=cmd/")
+expect_json "$RESPONSE" '.data[0].path' "cmd/main.go" "directory path filter"
+expect_json "$RESPONSE" '.data[0].matches[0].before == null' "true" "context can be disabled"
+
+RESPONSE=$(search "ParseConfig" --data-urlencode "repo=test-search-other")
+expect_json "$RESPONSE" '.data | length' "0" "repo filter"
+
+###############################################################################
+section "Regex Search"
+###############################################################################
+
+RESPONSE=$(search 'func\s+\w+Config\(' --data-urlencode "mode=regex")
+expect_json "$RESPONSE" '.data | length' "1" "regex search"
+expect_json "$RESPONSE" '.data[0].matches[0].line' "func ParseConfig(path string) Config {" "regex match line"
+
+RESPONSE=$(search '(' --data-urlencode "mode=regex")
+expect_contains "$RESPONSE" "Invalid regular expression" "invalid regex rejected"
+
+RESPONSE=$(search 'x*' --data-urlencode "mode=regex")
+expect_contains "$RESPONSE" "must not match empty text" "empty-matching regex rejected"
+
+RESPONSE=$(auth_curl "$API/search/code")
+expect_contains "$RESPONSE" "Query is required" "query required"
+
+###############################################################################
+section "Pagination"
+###############################################################################
+
+RESPONSE=$(search "ParseConfig" --data-urlencode "limit=1")
+expect_json "$RESPONSE" '.data | length' "1" "first page"
+expect_json "$RESPONSE" '.has_more' "true" "has more results"
+CURSOR=$(echo "$RESPONSE" | jq -r '.next_cursor')
+FIRST=$(echo "$RESPONSE" | jq -r '.data[0].path')
+
+RESPONSE=$(search "ParseConfig" --data-urlencode "limit=1" --data-urlencode "cursor=$CURSOR")
+expect_json "$RESPONSE" '.data | length' "1" "second page"
+expect_json "$RESPONSE" '.has_more' "false" "last page"
+expect_json "$RESPONSE" ".data[0].path != \"$FIRST\"" "true" "pages do not overlap"
+
+###############################################################################
+section "Re-indexing After Push"
+###############################################################################
+
+sed -i.bak 's/ParseConfig/LoadSettings/g' cmd/main.go && rm cmd/main.go.bak
+git commit -q -am "Rename config loader"
+git push -q origin main 2>/dev/null
+
+RESPONSE=$(wait_for_results "LoadSettings" "1")
+expect_json "$RESPONSE" '.data[0].path' "cmd/main.go" "new content searchable after push"
+expect_json "$RESPONSE" '.data[0].commit_sha' "$(git rev-parse main)" "index follows pushed commit"
+
+RESPONSE=$(search "ParseConfig" --data-urlencode "case_sensitive=true")
+expect_json "$RESPONSE" '.data | length' "0" "old content removed from index"
+
+###############################################################################
+section "Access Control"
+###############################################################################
+
+RESPONSE=$(anon_curl -G --data-urlencode "q=LoadSettings" --data-urlencode "namespace=$NS_NAME" "$API/search/code")
+expect_json "$RESPONSE" '.data | length' "0" "anonymous search skips private repos"
+
+STATUS=$(anon_curl -o /dev/null -w "%{http_code}" -G --data-urlencode "q=LoadSettings" \
+    --data-urlencode "namespace=$NS_NAME" --data-urlencode "repo=test-search" "$API/search/code")
+if [ "$STATUS" = "401" ]; then
+    pass "anonymous search of private repo requires auth"
+else
+    fail "anonymous search of private repo requires auth" "401" "$STATUS"
+fi
+
+RESPONSE=$(anon_curl -G --data-urlencode "q=LoadSettings" "$API/search/code")
+expect_contains "$RESPONSE" "Namespace is required" "anonymous search needs namespace"
+
+auth_curl -X PATCH -H "Content-Type: application/json" -d '{"public":true}' "$API/repos/$REPO_ID" > /dev/null
+RESPONSE=$(anon_curl -G --data-urlencode "q=LoadSettings" --data-urlencode "namespace=$NS_NAME" "$API/search/code")
+expect_json "$RESPONSE" '.data | length' "1" "anonymous search includes public repos"
+
+cd /
+rm -rf "$TMPDIR"
+
+###############################################################################
+summary
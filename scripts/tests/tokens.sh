@@ -119,6 +119,85 @@ expect_contains "$RESPONSE" "expired\|invalid" "expired token rejected"
 admin_curl -X DELETE "$ADMIN_API/users/$EXPIRE_USER_ID" > /dev/null 2>&1
 admin_curl -X DELETE "$ADMIN_API/namespaces/token-expire-test-ns" > /dev/null 2>&1
 
+###############################################################################
+section "User: Own Tokens"
+###############################################################################
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"token-self-test-ns"}' \
+    "$ADMIN_API/namespaces")
+
+SELF_NS_ID=$(get_id "$RESPONSE")
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$SELF_NS_ID\"}" \
+    "$ADMIN_API/users")
+
+SELF_USER_ID=$(get_id "$RESPONSE")
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"laptop"}' \
+    "$ADMIN_API/users/$SELF_USER_ID/tokens")
+SELF_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+SELF_TOKEN_ID=$(echo "$RESPONSE" | jq -r '.data.metadata.id')
+expect_json "$RESPONSE" '.data.metadata.name' "laptop" "admin-created token has name"
+
+RESPONSE=$(auth_curl_with "$SELF_TOKEN" "$API/user/tokens")
+expect_json "$RESPONSE" '.data | length' "1" "list own tokens"
+expect_json "$RESPONSE" '.data[0].current' "true" "current token marked"
+expect_json "$RESPONSE" '.data[0].last_used_at != null' "true" "last_used_at recorded"
+
+RESPONSE=$(auth_curl_with "$SELF_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"ci","expires_in_seconds":3600}' \
+    "$API/user/tokens")
+CI_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+CI_TOKEN_ID=$(echo "$RESPONSE" | jq -r '.data.metadata.id')
+expect_contains "$RESPONSE" '"token":"eph_' "create own token"
+expect_json "$RESPONSE" '.data.metadata.name' "ci" "own token has name"
+expect_json "$RESPONSE" '.data.metadata.expires_at != null' "true" "own token has expiry"
+
+RESPONSE=$(auth_curl_with "$SELF_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"expires_in_seconds":-1}' \
+    "$API/user/tokens")
+expect_contains "$RESPONSE" "cannot be negative" "negative expiry rejected"
+
+RESPONSE=$(auth_curl_with "$CI_TOKEN" "$API/repos")
+expect_contains "$RESPONSE" '"data"' "new token authenticates"
+
+RESPONSE=$(auth_curl_with "$SELF_TOKEN" "$API/user/tokens")
+expect_json "$RESPONSE" '.data | length' "2" "list includes new token"
+expect_json "$RESPONSE" ".data[] | select(.id == \"$CI_TOKEN_ID\") | .last_used_at != null" "true" "new token use recorded"
+
+RESPONSE=$(auth_curl_with "$SELF_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"read-only","scope":{"allow":["repo:read"]}}' \
+    "$API/user/tokens")
+SCOPED_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+expect_json "$RESPONSE" '.data.metadata.scope.allow[0]' "repo:read" "create scoped own token"
+
+RESPONSE=$(auth_curl_with "$SCOPED_TOKEN" "$API/user/tokens")
+expect_contains "$RESPONSE" "Scoped tokens cannot manage tokens" "scoped token cannot list tokens"
+
+RESPONSE=$(auth_curl_with "$SCOPED_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"escalate"}' \
+    "$API/user/tokens")
+expect_contains "$RESPONSE" "Scoped tokens cannot manage tokens" "scoped token cannot create tokens"
+
+OTHER_TOKEN_ID=$(auth_curl "$API/user/tokens" | jq -r '.data[] | select(.current) | .id')
+RESPONSE=$(auth_curl_with "$SELF_TOKEN" -X DELETE "$API/user/tokens/$OTHER_TOKEN_ID")
+expect_contains "$RESPONSE" "Token not found" "cannot revoke another user's token"
+
+STATUS=$(auth_curl_with "$SELF_TOKEN" -o /dev/null -w "%{http_code}" -X DELETE "$API/user/tokens/$CI_TOKEN_ID")
+expect_json "{\"status\":$STATUS}" '.status' "204" "revoke own token"
+
+RESPONSE=$(auth_curl_with "$CI_TOKEN" "$API/repos")
+expect_contains "$RESPONSE" "Invalid token" "revoked token rejected"
+
+RESPONSE=$(auth_curl_with "$SELF_TOKEN" "$API/user/tokens")
+expect_not_contains "$RESPONSE" "$CI_TOKEN_ID" "revoked token no longer listed"
+
+admin_curl -X DELETE "$ADMIN_API/users/$SELF_USER_ID" > /dev/null 2>&1
+admin_curl -X DELETE "$ADMIN_API/namespaces/token-self-test-ns" > /dev/null 2>&1
+
 ###############################################################################
 section "Admin Token Enforcement"
 ###############################################################################
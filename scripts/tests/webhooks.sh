@@ -0,0 +1,191 @@
+#!/bin/bash
+# Webhook Tests
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+source "$SCRIPT_DIR/lib.sh"
+
+require_token
+trap cleanup EXIT
+
+echo ""
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+echo -e "${BLUE}  Webhook Tests${NC}"
+echo -e "${BLUE}═══════════════════════════════════════${NC}"
+
+# Nothing listens here, so deliveries are recorded as failed attempts.
+HOOK_URL="http://127.0.0.1:9/hook"
+
+###############################################################################
+section "Setup"
+###############################################################################
+
+NS_JSON=$(auth_curl "$API/namespaces")
+NS_NAME=$(echo "$NS_JSON" | jq -r '.data[] | select(.is_primary == true) | .name' 2>/dev/null)
+if [ -z "$NS_NAME" ] || [ "$NS_NAME" = "null" ]; then
+    echo "Failed to get namespace name"
+    exit 1
+fi
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"test-webhooks","public":false}' \
+    "$API/repos")
+
+REPO_ID=$(get_id "$RESPONSE")
+if [ -z "$REPO_ID" ]; then
+    echo "Failed to create repo: $RESPONSE"
+    exit 1
+fi
+track_repo "$REPO_ID"
+info "Created repo: $REPO_ID"
+
+###############################################################################
+section "Manage Hooks"
+###############################################################################
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"url\":\"$HOOK_URL\",\"secret\":\"s3cret\",\"events\":[\"push\",\"repo.rename\"]}" \
+    "$API/repos/$REPO_ID/hooks")
+HOOK_ID=$(get_id "$RESPONSE")
+expect_json "$RESPONSE" '.data.has_secret' "true" "create repo hook"
+expect_not_contains "$RESPONSE" "s3cret" "secret is not returned"
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"url\":\"$HOOK_URL\",\"events\":[\"repo.explode\"]}" \
+    "$API/repos/$REPO_ID/hooks")
+expect_contains "$RESPONSE" "unknown event" "unknown event rejected"
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d '{"url":"ftp://example.com"}' \
+    "$API/repos/$REPO_ID/hooks")
+expect_contains "$RESPONSE" "http or https" "non-http URL rejected"
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/hooks")
+expect_contains "$RESPONSE" "$HOOK_ID" "list repo hooks"
+
+###############################################################################
+section "Deliveries"
+###############################################################################
+
+TMPDIR=$(mktemp -d)
+cd "$TMPDIR"
+
+git init -q repo
+cd repo
+git checkout -q -b main 2>/dev/null || true
+echo "hello" > file.txt
+git add .
+git commit -q -m "Initial"
+git push -q "http://x-token:$TOKEN@${BASE_URL#http://}/git/$NS_NAME/test-webhooks.git" main 2>/dev/null
+HEAD_SHA=$(git rev-parse HEAD)
+
+cd /
+rm -rf "$TMPDIR"
+
+auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"name":"test-webhooks-renamed"}' \
+    "$API/repos/$REPO_ID" > /dev/null
+
+sleep 1
+
+RESPONSE=$(auth_curl "$API/repos/$REPO_ID/hooks/$HOOK_ID/deliveries")
+expect_json "$RESPONSE" '.data[0].event' "repo.rename" "rename delivery listed newest first"
+expect_json "$RESPONSE" '.data[0].payload.old_name' "test-webhooks" "rename payload carries old name"
+expect_json "$RESPONSE" '.data[1].event' "push" "push delivery listed"
+expect_json "$RESPONSE" '.data[1].payload.refs[0].after' "$HEAD_SHA" "push payload carries new SHA"
+expect_json "$RESPONSE" '.data[1].attempts' "1" "delivery attempted"
+expect_json "$RESPONSE" '.data[1].status' "pending" "failed attempt scheduled for retry"
+expect_contains "$(echo "$RESPONSE" | jq -r '.data[1].error')" "not public" "local hook address refused"
+expect_json "$RESPONSE" '.data[1].response_body' "null" "no response body recorded"
+DELIVERY_ID=$(echo "$RESPONSE" | jq -r '.data[1].id')
+
+RESPONSE=$(auth_curl -X POST "$API/repos/$REPO_ID/hooks/$HOOK_ID/deliveries/$DELIVERY_ID/redeliver")
+expect_json "$RESPONSE" '.data.event' "push" "redeliver queues a copy"
+REDELIVERY_ID=$(get_id "$RESPONSE")
+if [ -n "$REDELIVERY_ID" ] && [ "$REDELIVERY_ID" != "$DELIVERY_ID" ]; then
+    pass "redelivery has a new ID"
+else
+    fail "redelivery has a new ID" "new ID" "$REDELIVERY_ID"
+fi
+
+###############################################################################
+section "Namespace Hooks"
+###############################################################################
+
+# Namespace hooks require namespace:admin, so use a dedicated namespace and user.
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{"name":"webhooks-ns"}' \
+    "$ADMIN_API/namespaces")
+HOOK_NS_ID=$(get_id "$RESPONSE")
+track_namespace "$HOOK_NS_ID"
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$HOOK_NS_ID\"}" \
+    "$ADMIN_API/users")
+HOOK_USER_ID=$(get_id "$RESPONSE")
+track_user "$HOOK_USER_ID"
+
+admin_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"namespace_id\":\"$HOOK_NS_ID\",\"allow\":[\"namespace:admin\",\"repo:admin\"]}" \
+    "$ADMIN_API/users/$HOOK_USER_ID/namespace-grants" > /dev/null
+
+RESPONSE=$(admin_curl -X POST -H "Content-Type: application/json" \
+    -d '{}' \
+    "$ADMIN_API/users/$HOOK_USER_ID/tokens")
+NS_TOKEN=$(echo "$RESPONSE" | jq -r '.data.token')
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d "{\"url\":\"$HOOK_URL\",\"events\":[\"*\"]}" \
+    "$API/namespaces/webhooks-ns/hooks")
+NS_HOOK_ID=$(get_id "$RESPONSE")
+expect_json "$RESPONSE" '.data.events[0]' "*" "create namespace hook"
+
+RESPONSE=$(auth_curl -X POST -H "Content-Type: application/json" \
+    -d "{\"url\":\"$HOOK_URL\"}" \
+    "$API/namespaces/webhooks-ns/hooks")
+expect_contains "$RESPONSE" "Insufficient permissions\|Forbidden" "namespace hooks require namespace:admin"
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" -X POST -H "Content-Type: application/json" \
+    -d '{"name":"ns-hooked","public":false,"namespace":"webhooks-ns"}' \
+    "$API/repos")
+NS_REPO_ID=$(get_id "$RESPONSE")
+
+auth_curl_with "$NS_TOKEN" -X PATCH -H "Content-Type: application/json" \
+    -d '{"public":true}' \
+    "$API/repos/$NS_REPO_ID" > /dev/null
+
+auth_curl_with "$NS_TOKEN" -X DELETE "$API/repos/$NS_REPO_ID" > /dev/null
+
+sleep 1
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" "$API/namespaces/webhooks-ns/hooks/$NS_HOOK_ID/deliveries")
+expect_json "$RESPONSE" '[.data[].event] | join(",")' "repo.delete,repo.visibility,repo.create" "namespace hook receives repo lifecycle events"
+
+RESPONSE=$(auth_curl_with "$NS_TOKEN" "$API/namespaces/webhooks-ns/hooks/$HOOK_ID/deliveries")
+expect_contains "$RESPONSE" "Webhook not found" "repo hook not visible through another namespace"
+
+STATUS=$(auth_curl_with "$NS_TOKEN" -o /dev/null -w "%{http_code}" -X DELETE "$API/namespaces/webhooks-ns/hooks/$NS_HOOK_ID")
+if [ "$STATUS" = "204" ]; then
+    pass "delete namespace hook"
+else
+    fail "delete namespace hook" "204" "$STATUS"
+fi
+
+###############################################################################
+section "Delete Hooks"
+###############################################################################
+
+RESPONSE=$(auth_curl -X PATCH -H "Content-Type: application/json" \
+    -d '{"active":false}' \
+    "$API/repos/$REPO_ID/hooks/$HOOK_ID")
+expect_json "$RESPONSE" '.data.active' "false" "deactivate hook"
+
+STATUS=$(auth_curl -o /dev/null -w "%{http_code}" -X DELETE "$API/repos/$REPO_ID/hooks/$HOOK_ID")
+if [ "$STATUS" = "204" ]; then
+    pass "delete repo hook"
+else
+    fail "delete repo hook" "204" "$STATUS"
+fi
+
+###############################################################################
+summary